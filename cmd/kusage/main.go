@@ -8,8 +8,12 @@ import (
 )
 
 func main() {
+	// Level defaults to warn and is adjusted by the CLI once flags are parsed
+	level := &slog.LevelVar{}
+	level.Set(slog.LevelWarn)
+
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-		Level: slog.LevelWarn,
+		Level: level,
 		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
 			// Simplify log output for CLI, remove "time" and "source" fields
 			if a.Key == "time" || a.Key == "source" {
@@ -20,7 +24,7 @@ func main() {
 	}))
 	slog.SetDefault(logger)
 
-	if err := cli.Run(); err != nil {
+	if err := cli.Run(level); err != nil {
 		slog.Error("command failed", "error", err)
 		os.Exit(1)
 	}
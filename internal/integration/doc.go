@@ -0,0 +1,9 @@
+// Package integration contains end-to-end tests that exercise the complete
+// collect, analyze and format pipeline against a real kube-apiserver started
+// with controller-runtime envtest, plus a stub metrics.k8s.io server.
+//
+// The tests are guarded by the "integration" build tag and require the envtest
+// binaries (see the KUBEBUILDER_ASSETS environment variable). Run them with:
+//
+//	make integration
+package integration
@@ -0,0 +1,189 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	"github.com/mchmarny/kusage/pkg/collector/fake"
+)
+
+const metricsPathPrefix = "/apis/metrics.k8s.io/v1beta1/"
+
+var (
+	// coreClient talks to the envtest kube-apiserver
+	coreClient kubernetes.Interface
+	// metricsClient talks to the stub metrics server
+	metricsClient metricsv.Interface
+	// fixture is the data seeded into both servers
+	fixture *fake.Fixture
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		fmt.Println("KUBEBUILDER_ASSETS not set, skipping integration tests (run make integration)")
+		os.Exit(0)
+	}
+
+	os.Exit(run(m))
+}
+
+// run starts the test environment, seeds it and runs the tests.
+func run(m *testing.M) int {
+	env := &envtest.Environment{}
+	cfg, err := env.Start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start envtest: %v\n", err)
+		return 1
+	}
+	defer func() {
+		if err := env.Stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to stop envtest: %v\n", err)
+		}
+	}()
+
+	fixture, err = fake.DefaultFixture()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load fixture: %v\n", err)
+		return 1
+	}
+
+	core, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create core client: %v\n", err)
+		return 1
+	}
+	coreClient = core
+
+	if err := seedPods(context.Background(), core, fixture.Pods.Items); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to seed pods: %v\n", err)
+		return 1
+	}
+
+	stub := httptest.NewServer(&metricsServer{items: fixture.Metrics.Items})
+	defer stub.Close()
+
+	metricsClient, err = metricsv.NewForConfig(&rest.Config{Host: stub.URL})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create metrics client: %v\n", err)
+		return 1
+	}
+
+	return m.Run()
+}
+
+// seedPods creates the fixture namespaces and pods in the API server and
+// applies their recorded status through the status subresource.
+func seedPods(ctx context.Context, client kubernetes.Interface, pods []corev1.Pod) error {
+	namespaces := make(map[string]bool)
+
+	for i := range pods {
+		pod := pods[i].DeepCopy()
+
+		if !namespaces[pod.Namespace] {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: pod.Namespace}}
+			if _, err := client.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+				return fmt.Errorf("create namespace %s: %w", pod.Namespace, err)
+			}
+			namespaces[pod.Namespace] = true
+		}
+
+		status := pod.Status
+		pod.ResourceVersion = ""
+		pod.UID = ""
+		pod.CreationTimestamp = metav1.Time{}
+		pod.Status = corev1.PodStatus{}
+
+		created, err := client.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("create pod %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+
+		created.Status = status
+		if _, err := client.CoreV1().Pods(pod.Namespace).UpdateStatus(ctx, created, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("update pod status %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// metricsServer is a stub of the metrics.k8s.io pod metrics endpoints.
+// It supports namespace scoping, label selectors and Limit/Continue pagination,
+// where the continue token is the offset of the next item.
+type metricsServer struct {
+	items []metricsv1beta1.PodMetrics
+}
+
+// ServeHTTP serves /apis/metrics.k8s.io/v1beta1/pods and
+// /apis/metrics.k8s.io/v1beta1/namespaces/{namespace}/pods.
+func (s *metricsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, metricsPathPrefix)
+
+	var namespace string
+	switch {
+	case path == "pods":
+	case strings.HasPrefix(path, "namespaces/") && strings.HasSuffix(path, "/pods"):
+		namespace = strings.TrimSuffix(strings.TrimPrefix(path, "namespaces/"), "/pods")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var matched []metricsv1beta1.PodMetrics
+	for _, item := range s.items {
+		if namespace != "" && item.Namespace != namespace {
+			continue
+		}
+		if !selector.Matches(labels.Set(item.Labels)) {
+			continue
+		}
+		matched = append(matched, item)
+	}
+
+	list := metricsv1beta1.PodMetricsList{
+		TypeMeta: metav1.TypeMeta{Kind: "PodMetricsList", APIVersion: "metrics.k8s.io/v1beta1"},
+		Items:    matched,
+	}
+
+	// Apply Limit/Continue pagination
+	offset, _ := strconv.Atoi(r.URL.Query().Get("continue"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if offset > len(matched) {
+		offset = len(matched)
+	}
+	list.Items = matched[offset:]
+	if limit > 0 && len(list.Items) > limit {
+		list.Items = list.Items[:limit]
+		list.Continue = strconv.Itoa(offset + limit)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,122 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mchmarny/kusage/pkg/analyzer"
+	"github.com/mchmarny/kusage/pkg/collector"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/output"
+)
+
+// newOptions returns options for an all-namespace pod memory run.
+func newOptions() config.Options {
+	opts := config.Options{
+		AllNamespaces: true,
+		Mode:          config.ModePods,
+		Resource:      config.ResourceMemory,
+		Sort:          config.SortByPercentage,
+		Output:        config.OutputTable,
+		TopN:          3,
+		Threshold:     80,
+		Timeout:       30 * time.Second,
+	}
+	opts.ApplyDefaults()
+	return opts
+}
+
+func TestPipeline_PodsMemory(t *testing.T) {
+	opts := newOptions()
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	rows, err := collector.New(coreClient, metricsClient).Collect(ctx, opts)
+	if err != nil {
+		t.Fatalf("collect failed: %v", err)
+	}
+
+	a := analyzer.New()
+	a.Sort(rows, opts)
+	rows = a.Filter(rows, opts)
+
+	var buf bytes.Buffer
+	if err := output.NewWithWriter(&buf).PrintTable(rows, opts); err != nil {
+		t.Fatalf("print failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected header and 3 rows, got %d lines:\n%s", len(lines), buf.String())
+	}
+
+	expected := []string{"node-exporter-p9x4l", "payments-db-0", "payments-api-7c9d8f6b5-m8zrt"}
+	for i, name := range expected {
+		if !strings.Contains(lines[i+1], name) {
+			t.Errorf("row %d: expected %s, got %q", i+1, name, lines[i+1])
+		}
+	}
+}
+
+func TestPipeline_WideMetadata(t *testing.T) {
+	opts := newOptions()
+	opts.Namespace = "payments"
+	opts.AllNamespaces = false
+	opts.Output = config.OutputWide
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	rows, err := collector.New(coreClient, metricsClient).Collect(ctx, opts)
+	if err != nil {
+		t.Fatalf("collect failed: %v", err)
+	}
+
+	for _, row := range rows {
+		if row.Node == "" || row.Owner == "" {
+			t.Errorf("expected node and owner to survive API round trip for %s", row.Name)
+		}
+		if row.Timestamp.IsZero() || row.Window == 0 {
+			t.Errorf("expected metrics window and timestamp for %s", row.Name)
+		}
+	}
+}
+
+func TestHarness_MetricsPagination(t *testing.T) {
+	var (
+		total int
+		pages int
+		token string
+	)
+
+	for {
+		list, err := metricsClient.MetricsV1beta1().PodMetricses("").List(context.Background(), metav1.ListOptions{
+			Limit:    5,
+			Continue: token,
+		})
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		total += len(list.Items)
+		pages++
+		if list.Continue == "" {
+			break
+		}
+		token = list.Continue
+	}
+
+	if total != len(fixture.Metrics.Items) {
+		t.Errorf("expected %d items across pages, got %d", len(fixture.Metrics.Items), total)
+	}
+	if pages < 2 {
+		t.Errorf("expected multiple pages, got %d", pages)
+	}
+}
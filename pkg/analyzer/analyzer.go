@@ -4,7 +4,10 @@
 package analyzer
 
 import (
+	"fmt"
+	"math"
 	"sort"
+	"strings"
 
 	"github.com/mchmarny/kusage/pkg/config"
 	"github.com/mchmarny/kusage/pkg/metrics"
@@ -48,6 +51,688 @@ func (a *Analyzer) Filter(rows []metrics.Row, opts config.Options) []metrics.Row
 	return rows[:opts.TopN]
 }
 
+// summaryBuckets defines the percentage ranges used for the distribution summary.
+var summaryBuckets = []metrics.Bucket{
+	{Label: "0-25%", Min: 0, Max: 25},
+	{Label: "25-50%", Min: 25, Max: 50},
+	{Label: "50-75%", Min: 50, Max: 75},
+	{Label: "75-90%", Min: 75, Max: 90},
+	{Label: "90-100%", Min: 90, Max: 100},
+	{Label: ">=100%", Min: 100, Max: math.Inf(1)},
+}
+
+// Summarize computes aggregate statistics over all provided rows.
+// It should be called before Filter so the summary reflects the complete
+// result set rather than only the top N rows.
+func (a *Analyzer) Summarize(rows []metrics.Row, opts config.Options) metrics.Summary {
+	summary := metrics.Summary{
+		Count:     len(rows),
+		Threshold: opts.Threshold,
+		Buckets:   make([]metrics.Bucket, len(summaryBuckets)),
+	}
+	copy(summary.Buckets, summaryBuckets)
+
+	var totalPercentage float64
+	for _, row := range rows {
+		switch opts.Resource {
+		case config.ResourceCPU:
+			summary.TotalUsage += float64(row.UsageMc)
+			summary.TotalLimit += float64(row.LimitMc)
+		default:
+			summary.TotalUsage += row.UsageMi
+			summary.TotalLimit += row.LimitMi
+		}
+
+		totalPercentage += row.Percentage
+		if row.Percentage > summary.MaxPercentage {
+			summary.MaxPercentage = row.Percentage
+		}
+		if row.Percentage >= opts.Threshold {
+			summary.OverThreshold++
+		}
+
+		for i := range summary.Buckets {
+			if row.Percentage >= summary.Buckets[i].Min && row.Percentage < summary.Buckets[i].Max {
+				summary.Buckets[i].Count++
+				break
+			}
+		}
+	}
+
+	if len(rows) > 0 {
+		summary.AvgPercentage = totalPercentage / float64(len(rows))
+	}
+
+	return summary
+}
+
+// GroupByNode partitions rows by node, preserving the existing row order
+// within each group. Groups are ordered by their first appearance, so after
+// Sort the node hosting the highest ranked row comes first.
+func (a *Analyzer) GroupByNode(rows []metrics.Row, opts config.Options) []metrics.Group {
+	return a.group(rows, opts, func(row metrics.Row) string { return row.Node })
+}
+
+// SumByNode replaces rows with one row per node, named after the node, that
+// sums the usage and limits of the pods scheduled on it and recomputes the
+// percentage, so nodes are ranked by how close their pods are collectively to
+// their limits. Pods not scheduled on any node are summed under <none>.
+func (a *Analyzer) SumByNode(rows []metrics.Row, opts config.Options) []metrics.Row {
+	groups := a.GroupByNode(rows, opts)
+	result := make([]metrics.Row, 0, len(groups))
+	for _, group := range groups {
+		total := group.Total
+		total.Node = group.Key
+		result = append(result, total)
+	}
+	return result
+}
+
+// Classify sets the severity of every row from the warning and critical
+// thresholds that apply to its namespace and labels.
+func (a *Analyzer) Classify(rows []metrics.Row, opts config.Options) {
+	for i := range rows {
+		warning, critical := opts.Thresholds.For(rows[i].Namespace, rows[i].Labels, opts.Threshold)
+		switch {
+		case rows[i].Percentage >= critical:
+			rows[i].Severity = metrics.SeverityCritical
+		case rows[i].Percentage >= warning:
+			rows[i].Severity = metrics.SeverityWarning
+		default:
+			rows[i].Severity = metrics.SeverityOK
+		}
+	}
+}
+
+// UnassignedCostCenter is the group key of rows in namespaces without a cost center
+const UnassignedCostCenter = "<unassigned>"
+
+// GroupByCostCenter partitions rows by the cost center of their namespace and
+// records the namespaces and unused limit headroom of each group. Groups are
+// ordered by total usage, largest first.
+func (a *Analyzer) GroupByCostCenter(rows []metrics.Row, costCenters map[string]string, opts config.Options) []metrics.Group {
+	groups := a.group(rows, opts, func(row metrics.Row) string {
+		if costCenter, ok := costCenters[row.Namespace]; ok {
+			return costCenter
+		}
+		return UnassignedCostCenter
+	})
+
+	for i := range groups {
+		seen := make(map[string]bool)
+		for _, row := range groups[i].Rows {
+			if !seen[row.Namespace] {
+				seen[row.Namespace] = true
+				groups[i].Namespaces = append(groups[i].Namespaces, row.Namespace)
+			}
+
+			switch opts.Resource {
+			case config.ResourceCPU:
+				groups[i].Headroom += math.Max(float64(row.LimitMc-row.UsageMc), 0)
+			default:
+				groups[i].Headroom += math.Max(row.LimitMi-row.UsageMi, 0)
+			}
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		left, right := groups[i].Total, groups[j].Total
+		if opts.Resource == config.ResourceCPU {
+			return left.UsageMc > right.UsageMc
+		}
+		return left.UsageMi > right.UsageMi
+	})
+
+	return groups
+}
+
+// ProjectPools records the usage growth of each pool found in growth and orders
+// pools by projected days until full, soonest first. Pools without a projection
+// follow, ordered by name.
+func (a *Analyzer) ProjectPools(pools []metrics.NodePool, growth map[string]float64) {
+	for i := range pools {
+		pools[i].GrowthPerDay, pools[i].HasGrowth = growth[pools[i].Name]
+	}
+
+	sort.SliceStable(pools, func(i, j int) bool {
+		left, leftOK := pools[i].DaysToFull()
+		right, rightOK := pools[j].DaysToFull()
+		if leftOK != rightOK {
+			return leftOK
+		}
+		if leftOK && left != right {
+			return left < right
+		}
+		return pools[i].Name < pools[j].Name
+	})
+}
+
+// Compare matches the rows of two clusters by namespace and workload, since pod
+// names differ between clusters, and returns one comparison per workload. Rows
+// without a controller are matched by name. Workloads running in only one
+// cluster come first, followed by the largest absolute percentage changes.
+// Comparisons whose change is below minDelta percentage points are dropped.
+func (a *Analyzer) Compare(left, right []metrics.Row, minDelta float64, opts config.Options) []metrics.Comparison {
+	leftUsage, rightUsage := workloadUsage(left, opts), workloadUsage(right, opts)
+
+	// Every workload of either cluster, once
+	workloads := make(map[workload]bool, len(leftUsage)+len(rightUsage))
+	for w := range leftUsage {
+		workloads[w] = true
+	}
+	for w := range rightUsage {
+		workloads[w] = true
+	}
+
+	var result []metrics.Comparison
+	for w := range workloads {
+		c := metrics.Comparison{Namespace: w.namespace, Workload: w.name, Left: leftUsage[w], Right: rightUsage[w]}
+		if delta, ok := c.Delta(); ok && math.Abs(delta) < minDelta {
+			continue
+		}
+		result = append(result, c)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		left, leftBoth := result[i].Delta()
+		right, rightBoth := result[j].Delta()
+		if leftBoth != rightBoth {
+			return !leftBoth
+		}
+		if math.Abs(left) != math.Abs(right) {
+			return math.Abs(left) > math.Abs(right)
+		}
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Workload < result[j].Workload
+	})
+
+	return result
+}
+
+// workload identifies a workload within a cluster
+type workload struct {
+	namespace string
+	name      string
+}
+
+// workloadUsage sums the usage and limits of rows per workload.
+func workloadUsage(rows []metrics.Row, opts config.Options) map[workload]*metrics.WorkloadUsage {
+	usage := make(map[workload]*metrics.WorkloadUsage)
+	for _, row := range rows {
+		w := workload{namespace: row.Namespace, name: workloadKey(row)}
+		u, ok := usage[w]
+		if !ok {
+			u = &metrics.WorkloadUsage{}
+			usage[w] = u
+		}
+		u.Rows++
+		switch opts.Resource {
+		case config.ResourceCPU:
+			u.Usage += float64(row.UsageMc)
+			u.Limit += float64(row.LimitMc)
+		default:
+			u.Usage += row.UsageMi
+			u.Limit += row.LimitMi
+		}
+	}
+
+	for _, u := range usage {
+		if u.Limit > 0 {
+			u.Percentage = u.Usage / u.Limit * 100
+		}
+	}
+	return usage
+}
+
+// workloadKey returns the owner of a row, followed by the container name in
+// container mode, or the row name for rows without an owner.
+func workloadKey(row metrics.Row) string {
+	if row.Owner == "" {
+		return row.Name
+	}
+	if row.Mode == config.ModeContainers {
+		if _, container, ok := strings.Cut(row.Name, ":"); ok {
+			return row.Owner + ":" + container
+		}
+	}
+	return row.Owner
+}
+
+// Verdicts explaining why a pending pod cannot be scheduled
+const (
+	// VerdictConstraints means nodes have enough free capacity, so scheduling is
+	// blocked by taints, affinity or other constraints
+	VerdictConstraints = "constraints"
+	// VerdictInflation means the pod would fit if the pods already on a node
+	// requested no more than they use
+	VerdictInflation = "request-inflation"
+	// VerdictCapacity means no node could fit the pod even with right-sized requests
+	VerdictCapacity = "capacity"
+)
+
+// RankVolumes orders volumes by usage percentage, highest first, and keeps
+// the top opts.TopN. Ties are ordered by namespace, claim and pod.
+func (a *Analyzer) RankVolumes(volumes []metrics.VolumeUsage, opts config.Options) []metrics.VolumeUsage {
+	sort.SliceStable(volumes, func(i, j int) bool {
+		left, right := volumes[i], volumes[j]
+		if left.Percentage != right.Percentage {
+			return left.Percentage > right.Percentage
+		}
+		if left.Namespace != right.Namespace {
+			return left.Namespace < right.Namespace
+		}
+		if left.Claim != right.Claim {
+			return left.Claim < right.Claim
+		}
+		return left.Pod < right.Pod
+	})
+
+	if opts.TopN > 0 && opts.TopN < len(volumes) {
+		return volumes[:opts.TopN]
+	}
+	return volumes
+}
+
+// RankQuotas orders quota resources by the share of their hard limit in use,
+// highest first, so the quotas closest to exhaustion lead. Ties are ordered by
+// namespace, quota and resource.
+func (a *Analyzer) RankQuotas(quotas []metrics.QuotaUsage) []metrics.QuotaUsage {
+	sort.SliceStable(quotas, func(i, j int) bool {
+		left, right := quotas[i], quotas[j]
+		if left.Percentage() != right.Percentage() {
+			return left.Percentage() > right.Percentage()
+		}
+		if left.Namespace != right.Namespace {
+			return left.Namespace < right.Namespace
+		}
+		if left.Quota != right.Quota {
+			return left.Quota < right.Quota
+		}
+		return left.Resource < right.Resource
+	})
+	return quotas
+}
+
+// RankSidecars orders pods by the share of their usage of opts.Resource their
+// sidecars account for, highest first, and keeps the top opts.TopN. The
+// returned TOTAL entry sums every pod, including those past the cut.
+func (a *Analyzer) RankSidecars(pods []metrics.SidecarUsage, opts config.Options) ([]metrics.SidecarUsage, metrics.SidecarUsage) {
+	total := metrics.SidecarUsage{Namespace: "TOTAL", Name: fmt.Sprintf("%d pods", len(pods))}
+	for _, pod := range pods {
+		total.Sidecars.Add(pod.Sidecars)
+		total.Total.Add(pod.Total)
+	}
+
+	share := func(pod metrics.SidecarUsage) float64 {
+		if opts.Resource == config.ResourceCPU {
+			if pod.Total.CPUMc == 0 {
+				return 0
+			}
+			return float64(pod.Sidecars.CPUMc) / float64(pod.Total.CPUMc)
+		}
+		if pod.Total.MemoryMi == 0 {
+			return 0
+		}
+		return pod.Sidecars.MemoryMi / pod.Total.MemoryMi
+	}
+	sort.SliceStable(pods, func(i, j int) bool {
+		left, right := share(pods[i]), share(pods[j])
+		if left != right {
+			return left > right
+		}
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Name < pods[j].Name
+	})
+
+	if opts.TopN > 0 && opts.TopN < len(pods) {
+		pods = pods[:opts.TopN]
+	}
+	return pods, total
+}
+
+// DiagnosePending counts, for every pending pod, the schedulable nodes it fits
+// into as allocated now and with requests right-sized to current usage, and
+// records the resulting verdict. Pods are ordered by namespace and name.
+func (a *Analyzer) DiagnosePending(pending []metrics.PendingPod, nodes []metrics.NodeAllocation) {
+	for i := range pending {
+		pod := &pending[i]
+		pod.FitsNow, pod.FitsRightsized = 0, 0
+		for _, node := range nodes {
+			if node.Unschedulable {
+				continue
+			}
+			if node.Fits(pod.RequestMc, pod.RequestMi) {
+				pod.FitsNow++
+			}
+			if node.FitsRightsized(pod.RequestMc, pod.RequestMi) {
+				pod.FitsRightsized++
+			}
+		}
+
+		switch {
+		case pod.FitsNow > 0:
+			pod.Verdict = VerdictConstraints
+		case pod.FitsRightsized > 0:
+			pod.Verdict = VerdictInflation
+		default:
+			pod.Verdict = VerdictCapacity
+		}
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool {
+		if pending[i].Namespace != pending[j].Namespace {
+			return pending[i].Namespace < pending[j].Namespace
+		}
+		return pending[i].Name < pending[j].Name
+	})
+}
+
+// TypicalPodShape returns the mean CPU and memory request of the pods on the
+// nodes, or a zero shape when no pods are scheduled.
+func (a *Analyzer) TypicalPodShape(nodes []metrics.NodeAllocation) metrics.PodShape {
+	var (
+		pods        int64
+		requestedMc int64
+		requestedMi float64
+	)
+	for _, node := range nodes {
+		pods += node.Pods
+		requestedMc += node.RequestedMc
+		requestedMi += node.RequestedMi
+	}
+	if pods == 0 {
+		return metrics.PodShape{}
+	}
+	return metrics.PodShape{CPUMc: requestedMc / pods, MemoryMi: requestedMi / float64(pods)}
+}
+
+// Fragmentation packs the unrequested capacity of every schedulable node with
+// pods of shape and reports the capacity left over: CPU stranded by a lack of
+// memory and vice versa. A shape that requests nothing of a resource is never
+// limited by it. Nodes are ordered by name.
+func (a *Analyzer) Fragmentation(nodes []metrics.NodeAllocation, shape metrics.PodShape) metrics.Fragmentation {
+	result := metrics.Fragmentation{Shape: shape}
+	for _, node := range nodes {
+		if node.Unschedulable {
+			continue
+		}
+		result.AllocatableMc += node.AllocatableMc
+		result.AllocatableMi += node.AllocatableMi
+
+		free := metrics.NodeFragmentation{
+			Name:   node.Name,
+			FreeMc: max(node.AllocatableMc-node.RequestedMc, 0),
+			FreeMi: max(node.AllocatableMi-node.RequestedMi, 0),
+		}
+		fits := int64(-1)
+		if shape.CPUMc > 0 {
+			fits = free.FreeMc / shape.CPUMc
+		}
+		if shape.MemoryMi > 0 {
+			byMemory := int64(math.Floor(free.FreeMi / shape.MemoryMi))
+			if fits < 0 || byMemory < fits {
+				fits = byMemory
+			}
+		}
+		free.Fits = max(fits, 0)
+		free.StrandedMc = free.FreeMc - free.Fits*shape.CPUMc
+		free.StrandedMi = free.FreeMi - float64(free.Fits)*shape.MemoryMi
+		result.Nodes = append(result.Nodes, free)
+	}
+
+	sort.Slice(result.Nodes, func(i, j int) bool {
+		return result.Nodes[i].Name < result.Nodes[j].Name
+	})
+	return result
+}
+
+// Check evaluates every policy rule against the rows of its resource and the
+// container limits, returning the violations in rule order and, within a
+// rule, by namespace and name.
+func (a *Analyzer) Check(policy *config.Policy, rows map[config.ResourceKind][]metrics.Row, limits []metrics.ContainerLimits) []metrics.Violation {
+	var violations []metrics.Violation
+	for _, rule := range policy.Rules {
+		var broken []metrics.Violation
+		switch {
+		case rule.MaxPercent != nil:
+			for _, row := range rows[rule.Resource] {
+				podName, _, _ := strings.Cut(row.Name, ":")
+				if !rule.Matches(row.Namespace, row.Labels) || rule.Excepted(row.Namespace, row.Owner, podName) {
+					continue
+				}
+				if row.Percentage > *rule.MaxPercent {
+					broken = append(broken, metrics.Violation{
+						Namespace: row.Namespace,
+						Name:      row.Name,
+						Owner:     row.Owner,
+						Detail:    fmt.Sprintf("%s usage at %.1f%% of limit exceeds %.1f%%", rule.Resource, row.Percentage, *rule.MaxPercent),
+					})
+				}
+			}
+		default:
+			for _, container := range limits {
+				if !rule.Matches(container.Namespace, container.Labels) || rule.Excepted(container.Namespace, container.Owner, container.Pod) {
+					continue
+				}
+				if detail := limitViolation(rule, container); detail != "" {
+					broken = append(broken, metrics.Violation{
+						Namespace: container.Namespace,
+						Name:      container.Pod + ":" + container.Container,
+						Owner:     container.Owner,
+						Detail:    detail,
+					})
+				}
+			}
+		}
+
+		sort.SliceStable(broken, func(i, j int) bool {
+			if broken[i].Namespace != broken[j].Namespace {
+				return broken[i].Namespace < broken[j].Namespace
+			}
+			return broken[i].Name < broken[j].Name
+		})
+		for i := range broken {
+			broken[i].Rule = rule.Name
+		}
+		violations = append(violations, broken...)
+	}
+
+	return violations
+}
+
+// RuleRegression is the rule reported for workloads whose usage percentage
+// regressed beyond the baseline tolerance
+const RuleRegression = "regression"
+
+// Baseline records the usage percentage of every workload, per resource, from
+// the rows of each resource. Workloads are keyed as in Compare so pods
+// replaced by a rollout keep their baseline.
+func (a *Analyzer) Baseline(rows map[config.ResourceKind][]metrics.Row, opts config.Options) metrics.Baseline {
+	baseline := metrics.Baseline{Mode: opts.Mode}
+	for resource, resourceRows := range rows {
+		resourceOpts := opts
+		resourceOpts.Resource = resource
+		for w, usage := range workloadUsage(resourceRows, resourceOpts) {
+			baseline.Workloads = append(baseline.Workloads, metrics.BaselineEntry{
+				Namespace:  w.namespace,
+				Workload:   w.name,
+				Resource:   resource,
+				Percentage: usage.Percentage,
+			})
+		}
+	}
+
+	sort.Slice(baseline.Workloads, func(i, j int) bool {
+		left, right := baseline.Workloads[i], baseline.Workloads[j]
+		if left.Namespace != right.Namespace {
+			return left.Namespace < right.Namespace
+		}
+		if left.Workload != right.Workload {
+			return left.Workload < right.Workload
+		}
+		return left.Resource < right.Resource
+	})
+
+	return baseline
+}
+
+// Regressions returns a violation for every workload of current whose usage
+// percentage exceeds its accepted percentage in baseline by more than
+// tolerance points. Workloads missing from the baseline are not regressions.
+func (a *Analyzer) Regressions(baseline, current metrics.Baseline, tolerance float64) []metrics.Violation {
+	type key struct {
+		namespace string
+		workload  string
+		resource  config.ResourceKind
+	}
+	accepted := make(map[key]float64, len(baseline.Workloads))
+	for _, entry := range baseline.Workloads {
+		accepted[key{entry.Namespace, entry.Workload, entry.Resource}] = entry.Percentage
+	}
+
+	var violations []metrics.Violation
+	for _, entry := range current.Workloads {
+		before, ok := accepted[key{entry.Namespace, entry.Workload, entry.Resource}]
+		if !ok || entry.Percentage <= before+tolerance {
+			continue
+		}
+		violations = append(violations, metrics.Violation{
+			Rule:      RuleRegression,
+			Namespace: entry.Namespace,
+			Name:      entry.Workload,
+			Detail: fmt.Sprintf("%s usage at %.1f%% of limit, up from %.1f%% in baseline (tolerance %.1f)",
+				entry.Resource, entry.Percentage, before, tolerance),
+		})
+	}
+
+	return violations
+}
+
+// limitViolation describes how a container breaks a limits rule, or returns
+// an empty string when it complies.
+func limitViolation(rule config.Rule, container metrics.ContainerLimits) string {
+	if rule.ForbidUnlimited {
+		if !container.CPU && !container.Memory {
+			return "no resource limits set"
+		}
+		return ""
+	}
+
+	var missing []string
+	for _, resource := range rule.RequireLimits {
+		if (resource == config.ResourceCPU && !container.CPU) || (resource == config.ResourceMemory && !container.Memory) {
+			missing = append(missing, string(resource))
+		}
+	}
+	if len(missing) == 0 {
+		return ""
+	}
+	return "missing " + strings.Join(missing, ", ") + " limit"
+}
+
+// group partitions rows using the provided key function and computes
+// the aggregated total of each group.
+func (a *Analyzer) group(rows []metrics.Row, opts config.Options, key func(metrics.Row) string) []metrics.Group {
+	var groups []metrics.Group
+	index := make(map[string]int)
+
+	for _, row := range rows {
+		k := key(row)
+		if k == "" {
+			k = "<none>"
+		}
+		i, exists := index[k]
+		if !exists {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, metrics.Group{Key: k})
+		}
+		groups[i].Rows = append(groups[i].Rows, row)
+	}
+
+	for i := range groups {
+		groups[i].Total = a.total(groups[i].Key, groups[i].Rows, opts)
+	}
+
+	return groups
+}
+
+// total aggregates usage, limits and restarts across rows and recomputes the percentage.
+func (a *Analyzer) total(name string, rows []metrics.Row, opts config.Options) metrics.Row {
+	total := metrics.Row{Name: name, Resource: opts.Resource, Mode: opts.Mode}
+	for _, row := range rows {
+		total.UsageBytes += row.UsageBytes
+		total.LimitBytes += row.LimitBytes
+		total.UsageMi += row.UsageMi
+		total.LimitMi += row.LimitMi
+		total.UsageMc += row.UsageMc
+		total.LimitMc += row.LimitMc
+		total.RequestBytes += row.RequestBytes
+		total.RequestMi += row.RequestMi
+		total.RequestMc += row.RequestMc
+		total.Restarts += row.Restarts
+		total.Cost += row.Cost
+		total.CPUPeriods += row.CPUPeriods
+		total.ThrottledPeriods += row.ThrottledPeriods
+		if row.Network != nil {
+			if total.Network == nil {
+				total.Network = &metrics.NetworkUsage{}
+			}
+			total.Network.RxBytesPerSecond += row.Network.RxBytesPerSecond
+			total.Network.TxBytesPerSecond += row.Network.TxBytesPerSecond
+		}
+		if total.Node == "" {
+			total.Node = row.Node
+		}
+	}
+
+	total.SetThrottle(total.CPUPeriods, total.ThrottledPeriods)
+	setPercentage(&total, opts.Resource)
+
+	return total
+}
+
+// setPercentage recomputes the usage percentage of an aggregated row from its
+// usage and limit of resource, or the higher of both resources with all.
+func setPercentage(row *metrics.Row, resource config.ResourceKind) {
+	if resource != config.ResourceAll {
+		row.Percentage, _ = row.ResourcePercentage(resource)
+		return
+	}
+	memory, _ := row.ResourcePercentage(config.ResourceMemory)
+	cpu, _ := row.ResourcePercentage(config.ResourceCPU)
+	row.Percentage = max(memory, cpu)
+}
+
+// Rank appends a ranking step to each trace, reporting where the traced rows
+// landed in the sorted result set and whether they survived the TopN cut.
+// The rows must already be sorted with Sort.
+func (a *Analyzer) Rank(traces []metrics.Trace, rows []metrics.Row, opts config.Options) {
+	position := make(map[string]int, len(rows))
+	for i, row := range rows {
+		position[row.Namespace+"/"+row.Name] = i + 1
+	}
+
+	for i := range traces {
+		for _, row := range traces[i].Rows {
+			rank, ok := position[row.Namespace+"/"+row.Name]
+			if !ok {
+				continue
+			}
+			detail := fmt.Sprintf("%s ranked #%d of %d at %.1f%%", row.Name, rank, len(rows), row.Percentage)
+			if opts.TopN > 0 && rank > opts.TopN {
+				traces[i].AddStep("ranking", false, detail+fmt.Sprintf(", outside --top %d", opts.TopN))
+				continue
+			}
+			traces[i].AddStep("ranking", true, detail)
+		}
+	}
+}
+
 // compareRows implements the comparison logic for sorting rows.
 // This method encapsulates the complex multi-criteria sorting logic
 // and provides stable, deterministic ordering.
@@ -58,6 +743,14 @@ func (a *Analyzer) compareRows(left, right metrics.Row, opts config.Options) boo
 		return a.compareByUsage(left, right, opts.Resource)
 	case config.SortByLimit:
 		return a.compareByLimit(left, right, opts.Resource)
+	case config.SortByRestarts:
+		return a.compareByRestarts(left, right)
+	case config.SortByScore:
+		return a.compareByScore(left, right)
+	case config.SortByThrottle:
+		return a.compareByThrottle(left, right)
+	case config.SortByForecast:
+		return a.compareByForecast(left, right)
 	default: // config.SortByPercentage
 		return a.compareByPercentage(left, right)
 	}
@@ -99,6 +792,44 @@ func (a *Analyzer) compareByLimit(left, right metrics.Row, resource config.Resou
 	}
 }
 
+// compareByRestarts compares rows by container restart count.
+func (a *Analyzer) compareByRestarts(left, right metrics.Row) bool {
+	if left.Restarts == right.Restarts {
+		return a.compareByPercentage(left, right)
+	}
+	return left.Restarts > right.Restarts // Descending order
+}
+
+// compareByThrottle compares rows by the share of CFS periods throttled.
+func (a *Analyzer) compareByThrottle(left, right metrics.Row) bool {
+	if left.ThrottlePercent == right.ThrottlePercent {
+		return a.compareByPercentage(left, right)
+	}
+	return left.ThrottlePercent > right.ThrottlePercent // Descending order
+}
+
+// compareByForecast compares rows by the hours until memory reaches the
+// limit, soonest first. Rows without a forecast follow.
+func (a *Analyzer) compareByForecast(left, right metrics.Row) bool {
+	switch {
+	case left.HoursToLimit == nil && right.HoursToLimit == nil:
+		return a.compareByPercentage(left, right)
+	case left.HoursToLimit == nil || right.HoursToLimit == nil:
+		return left.HoursToLimit != nil
+	case *left.HoursToLimit == *right.HoursToLimit:
+		return a.compareByPercentage(left, right)
+	}
+	return *left.HoursToLimit < *right.HoursToLimit // Ascending order
+}
+
+// compareByScore compares rows by the score expression result.
+func (a *Analyzer) compareByScore(left, right metrics.Row) bool {
+	if left.Score == right.Score {
+		return a.compareByPercentage(left, right)
+	}
+	return left.Score > right.Score // Descending order
+}
+
 // compareByPercentage compares rows by usage percentage.
 func (a *Analyzer) compareByPercentage(left, right metrics.Row) bool {
 	if left.Percentage == right.Percentage {
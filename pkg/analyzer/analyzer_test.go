@@ -1,12 +1,25 @@
 package analyzer
 
 import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
+	"k8s.io/apimachinery/pkg/labels"
+
 	"github.com/mchmarny/kusage/pkg/config"
 	"github.com/mchmarny/kusage/pkg/metrics"
 )
 
+// ptr returns a pointer to v.
+func ptr[T any](v T) *T {
+	return &v
+}
+
 func TestAnalyzer_Sort(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -40,6 +53,45 @@ func TestAnalyzer_Sort(t *testing.T) {
 			},
 			expected: []string{"pod-b", "pod-a", "pod-c"},
 		},
+		{
+			name: "sort by forecast ascending",
+			rows: []metrics.Row{
+				{Name: "pod-a", Percentage: 90.0},
+				{Name: "pod-b", Percentage: 10.0, HoursToLimit: ptr(30.0)},
+				{Name: "pod-c", Percentage: 50.0, HoursToLimit: ptr(2.0)},
+			},
+			opts: config.Options{
+				Sort:     config.SortByForecast,
+				Resource: config.ResourceMemory,
+			},
+			expected: []string{"pod-c", "pod-b", "pod-a"},
+		},
+		{
+			name: "sort by restarts descending",
+			rows: []metrics.Row{
+				{Name: "pod-a", Restarts: 1, Percentage: 90.0},
+				{Name: "pod-b", Restarts: 5, Percentage: 10.0},
+				{Name: "pod-c", Restarts: 1, Percentage: 95.0},
+			},
+			opts: config.Options{
+				Sort:     config.SortByRestarts,
+				Resource: config.ResourceMemory,
+			},
+			expected: []string{"pod-b", "pod-c", "pod-a"},
+		},
+		{
+			name: "sort by throttle",
+			rows: []metrics.Row{
+				{Name: "pod-a", ThrottlePercent: 2.5, Percentage: 90.0},
+				{Name: "pod-b", ThrottlePercent: 40, Percentage: 30.0},
+				{Name: "pod-c", Percentage: 95.0},
+			},
+			opts: config.Options{
+				Sort:     config.SortByThrottle,
+				Resource: config.ResourceCPU,
+			},
+			expected: []string{"pod-b", "pod-a", "pod-c"},
+		},
 		{
 			name: "stable sort with secondary criteria",
 			rows: []metrics.Row{
@@ -131,6 +183,562 @@ func TestAnalyzer_Filter(t *testing.T) {
 	}
 }
 
+func TestAnalyzer_Rank(t *testing.T) {
+	rows := []metrics.Row{
+		{Namespace: "default", Name: "pod-a", Percentage: 90.0},
+		{Namespace: "default", Name: "pod-b", Percentage: 50.0},
+		{Namespace: "default", Name: "pod-c", Percentage: 10.0},
+	}
+
+	tests := []struct {
+		name   string
+		traced string
+		topN   int
+		passed bool
+	}{
+		{name: "inside top", traced: "pod-a", topN: 2, passed: true},
+		{name: "outside top", traced: "pod-c", topN: 2, passed: false},
+		{name: "no top limit", traced: "pod-c", topN: 0, passed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			traces := []metrics.Trace{{
+				Namespace: "default",
+				Name:      tt.traced,
+				Rows:      []metrics.Row{{Namespace: "default", Name: tt.traced}},
+			}}
+
+			New().Rank(traces, rows, config.Options{TopN: tt.topN})
+
+			if len(traces[0].Steps) != 1 {
+				t.Fatalf("expected 1 ranking step, got %d", len(traces[0].Steps))
+			}
+			if traces[0].Steps[0].Passed != tt.passed {
+				t.Errorf("expected passed=%t, got %t (%s)", tt.passed, traces[0].Steps[0].Passed, traces[0].Steps[0].Detail)
+			}
+		})
+	}
+}
+
+func TestAnalyzer_Summarize(t *testing.T) {
+	rows := []metrics.Row{
+		{Name: "pod-a", UsageMi: 90, LimitMi: 100, Percentage: 90.0},
+		{Name: "pod-b", UsageMi: 50, LimitMi: 100, Percentage: 50.0},
+		{Name: "pod-c", UsageMi: 10, LimitMi: 100, Percentage: 10.0},
+		{Name: "pod-d", UsageMi: 120, LimitMi: 100, Percentage: 120.0},
+	}
+
+	summary := New().Summarize(rows, config.Options{Resource: config.ResourceMemory, Threshold: 80})
+
+	if summary.Count != 4 {
+		t.Errorf("expected count 4, got %d", summary.Count)
+	}
+	if summary.TotalUsage != 270 || summary.TotalLimit != 400 {
+		t.Errorf("unexpected totals: usage=%v limit=%v", summary.TotalUsage, summary.TotalLimit)
+	}
+	if summary.AvgPercentage != 67.5 {
+		t.Errorf("expected average 67.5, got %v", summary.AvgPercentage)
+	}
+	if summary.MaxPercentage != 120 {
+		t.Errorf("expected max 120, got %v", summary.MaxPercentage)
+	}
+	if summary.OverThreshold != 2 {
+		t.Errorf("expected 2 rows over threshold, got %d", summary.OverThreshold)
+	}
+
+	var bucketed int
+	for _, bucket := range summary.Buckets {
+		bucketed += bucket.Count
+	}
+	if bucketed != len(rows) {
+		t.Errorf("expected all %d rows in buckets, got %d", len(rows), bucketed)
+	}
+}
+
+func TestAnalyzer_GroupByNode(t *testing.T) {
+	rows := []metrics.Row{
+		{Name: "pod-a", Node: "node-2", UsageMi: 90, LimitMi: 100},
+		{Name: "pod-b", Node: "node-1", UsageMi: 50, LimitMi: 100},
+		{Name: "pod-c", Node: "node-2", UsageMi: 10, LimitMi: 100},
+	}
+
+	groups := New().GroupByNode(rows, config.Options{Resource: config.ResourceMemory})
+
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+	if groups[0].Key != "node-2" || len(groups[0].Rows) != 2 {
+		t.Errorf("expected node-2 first with 2 rows, got %s with %d", groups[0].Key, len(groups[0].Rows))
+	}
+	if groups[0].Total.UsageMi != 100 || groups[0].Total.Percentage != 50 {
+		t.Errorf("unexpected node-2 total: usage=%v pct=%v", groups[0].Total.UsageMi, groups[0].Total.Percentage)
+	}
+}
+
+func TestAnalyzer_SumByNode(t *testing.T) {
+	rows := []metrics.Row{
+		{Namespace: "web", Name: "pod-a", Node: "node-2", UsageMi: 90, LimitMi: 100, Restarts: 1},
+		{Namespace: "web", Name: "pod-b", Node: "node-1", UsageMi: 50, LimitMi: 100},
+		{Namespace: "api", Name: "pod-c", Node: "node-2", UsageMi: 10, LimitMi: 100, Restarts: 2},
+		{Namespace: "api", Name: "pod-d", UsageMi: 0, LimitMi: 100},
+	}
+
+	nodes := New().SumByNode(rows, config.Options{Mode: config.ModePods, Resource: config.ResourceMemory})
+
+	if len(nodes) != 3 {
+		t.Fatalf("expected 3 node rows, got %d", len(nodes))
+	}
+	node := nodes[0]
+	if node.Name != "node-2" || node.Node != "node-2" || node.Namespace != "" {
+		t.Errorf("expected node-2 first, got %+v", node)
+	}
+	if node.UsageMi != 100 || node.LimitMi != 200 || node.Percentage != 50 || node.Restarts != 3 {
+		t.Errorf("unexpected node-2 sums: usage=%v limit=%v pct=%v restarts=%d", node.UsageMi, node.LimitMi, node.Percentage, node.Restarts)
+	}
+	if nodes[2].Name != "<none>" {
+		t.Errorf("expected unscheduled pods summed under <none>, got %s", nodes[2].Name)
+	}
+}
+
+func TestAnalyzer_GroupContainerNames(t *testing.T) {
+	rows := []metrics.Row{
+		{Namespace: "web", Name: "api-1:app", Owner: "Deployment/api", Node: "node-1", UsageMi: 40, LimitMi: 100, Percentage: 40, Restarts: 1},
+		{Namespace: "web", Name: "api-2:app", Owner: "Deployment/api", Node: "node-2", UsageMi: 90, LimitMi: 100, Percentage: 90},
+		{Namespace: "web", Name: "api-1:proxy", Owner: "Deployment/api", UsageMi: 10, LimitMi: 50, Percentage: 20},
+		{Namespace: "web", Name: "api-3:app", Owner: "Deployment/api", UsageMi: 20, LimitMi: 100, Percentage: 20, Restarts: 2},
+		{Namespace: "web", Name: "debug:app", UsageMi: 5, LimitMi: 10, Percentage: 50},
+	}
+
+	merged := New().GroupContainerNames(rows)
+
+	if len(merged) != 3 {
+		t.Fatalf("expected 3 merged rows, got %+v", merged)
+	}
+	app := merged[0]
+	if app.Name != "app" || app.Owner != "Deployment/api" || app.Node != "" {
+		t.Errorf("expected the app container of Deployment/api first, got %+v", app)
+	}
+	if app.UsageMi != 90 || app.Percentage != 90 || app.Restarts != 3 {
+		t.Errorf("expected the replica closest to its limit with summed restarts, got usage=%v pct=%v restarts=%d", app.UsageMi, app.Percentage, app.Restarts)
+	}
+	want := metrics.ReplicaStats{Count: 3, MeanPercentage: 50, P95Percentage: 90, MaxPercentage: 90}
+	if app.Replicas == nil || *app.Replicas != want {
+		t.Errorf("expected replica stats %+v, got %+v", want, app.Replicas)
+	}
+	if merged[1].Name != "proxy" || merged[1].Replicas.Count != 1 {
+		t.Errorf("expected the proxy container alone, got %+v", merged[1])
+	}
+	if merged[2].Owner != "Pod/debug" {
+		t.Errorf("expected a bare pod merged per pod, got owner %q", merged[2].Owner)
+	}
+}
+
+func TestAnalyzer_Score(t *testing.T) {
+	rows := []metrics.Row{
+		{Name: "pod-a", Resource: config.ResourceMemory, UsageMi: 90, LimitMi: 100, RequestMi: 60, Percentage: 90},
+		{Name: "pod-b", Resource: config.ResourceMemory, UsageMi: 50, LimitMi: 100, RequestMi: 25, Percentage: 50, Restarts: 3},
+		{Name: "pod-c", Resource: config.ResourceMemory, UsageMi: 30, LimitMi: 100, Percentage: 30, Labels: map[string]string{"tier": "critical"}},
+	}
+
+	source := `(has(row.labels.tier) && row.labels.tier == "critical" ? 10.0 : 1.0) * row.percentage + row.restarts * 20.0 + (row.request > 0 ? row.usage / row.request : 0.0)`
+	program, err := CompileScore(source)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	a := New()
+	opts := config.Options{Resource: config.ResourceMemory, Sort: config.SortByScore, ScoreExpr: program}
+	if err := a.Score(rows, opts); err != nil {
+		t.Fatalf("score failed: %v", err)
+	}
+
+	want := map[string]float64{"pod-a": 91.5, "pod-b": 112, "pod-c": 300}
+	for _, row := range rows {
+		if row.Score != want[row.Name] {
+			t.Errorf("%s: expected score %v, got %v", row.Name, want[row.Name], row.Score)
+		}
+	}
+
+	a.Sort(rows, opts)
+	for i, name := range []string{"pod-c", "pod-b", "pod-a"} {
+		if rows[i].Name != name {
+			t.Errorf("position %d: expected %s, got %s", i, name, rows[i].Name)
+		}
+	}
+
+	failing, err := CompileScore("row.usage / row.request")
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if err := a.Score(rows, config.Options{Resource: config.ResourceMemory, ScoreExpr: failing}); err == nil {
+		t.Error("expected error for a row without requests")
+	}
+
+	for _, source := range []string{"row.percentag", "row.namespace", "row.name + 1"} {
+		if _, err := CompileScore(source); err == nil {
+			t.Errorf("expected %q to fail to compile", source)
+		}
+	}
+}
+
+func TestAnalyzer_ScoreIntegerLiterals(t *testing.T) {
+	rows := []metrics.Row{
+		{Name: "pod-a", Resource: config.ResourceMemory, UsageMi: 40, LimitMi: 100, Percentage: 40},
+		{Name: "pod-b", Resource: config.ResourceMemory, UsageMi: 25, LimitMi: 100, Percentage: 25, Restarts: 3},
+	}
+
+	program, err := CompileScore("row.percentage * (row.restarts + 1) - 2 * row.restarts + row.usage / 5")
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	if err := New().Score(rows, config.Options{Resource: config.ResourceMemory, ScoreExpr: program}); err != nil {
+		t.Fatalf("score failed: %v", err)
+	}
+
+	want := map[string]float64{"pod-a": 48, "pod-b": 99}
+	for _, row := range rows {
+		if row.Score != want[row.Name] {
+			t.Errorf("%s: expected score %v, got %v", row.Name, want[row.Name], row.Score)
+		}
+	}
+}
+
+func TestAnalyzer_ScoreWeights(t *testing.T) {
+	rows := []metrics.Row{
+		{Namespace: "batch", Name: "import-0", Resource: config.ResourceMemory, Percentage: 90, PriorityClass: "batch"},
+		{Namespace: "prod-eu", Name: "api-0", Resource: config.ResourceMemory, Percentage: 80},
+		{Namespace: "dev", Name: "web-0", Resource: config.ResourceMemory, Percentage: 85},
+		{Namespace: "prod-eu", Name: "db-0", Resource: config.ResourceMemory, Percentage: 60, PriorityClass: "critical"},
+	}
+	weights := &config.Weights{
+		PriorityClasses: map[string]float64{"critical": 3, "batch": 0.5},
+		Namespaces:      []config.NamespaceWeight{{Namespace: "prod-*", Weight: 1.5}},
+	}
+
+	a := New()
+	opts := config.Options{Resource: config.ResourceMemory, Sort: config.SortByScore, Weights: weights}
+	if err := a.Score(rows, opts); err != nil {
+		t.Fatalf("score failed: %v", err)
+	}
+
+	// The priority class takes precedence over the namespace tier
+	want := map[string]float64{"import-0": 45, "api-0": 120, "web-0": 85, "db-0": 180}
+	for _, row := range rows {
+		if row.Score != want[row.Name] {
+			t.Errorf("%s: expected score %v, got %v", row.Name, want[row.Name], row.Score)
+		}
+	}
+
+	a.Sort(rows, opts)
+	for i, name := range []string{"db-0", "api-0", "web-0", "import-0"} {
+		if rows[i].Name != name {
+			t.Errorf("position %d: expected %s, got %s", i, name, rows[i].Name)
+		}
+	}
+}
+
+func TestAnalyzer_Diff(t *testing.T) {
+	a := New()
+	first := a.Diff(nil, []metrics.Row{
+		{Namespace: "web", Name: "api-0", Percentage: 80},
+		{Namespace: "web", Name: "api-1", Percentage: 70},
+		{Namespace: "batch", Name: "import-0", Percentage: 60},
+	}, 5)
+	for i, change := range first.Changes {
+		if change != (metrics.RowChange{}) {
+			t.Errorf("row %d: expected no change on the first refresh, got %+v", i, change)
+		}
+	}
+
+	second := a.Diff(&first, []metrics.Row{
+		{Namespace: "web", Name: "api-0", Percentage: 91},
+		{Namespace: "web", Name: "api-2", Percentage: 75},
+		{Namespace: "web", Name: "api-1", Percentage: 72},
+	}, 5)
+	want := []metrics.RowChange{{Delta: 11}, {Entered: true}, {}}
+	for i, change := range second.Changes {
+		if change != want[i] {
+			t.Errorf("%s: expected %+v, got %+v", second.Rows[i].Name, want[i], change)
+		}
+	}
+	if len(second.Gone) != 1 || second.Gone[0].Name != "import-0" {
+		t.Errorf("expected import-0 to be gone, got %+v", second.Gone)
+	}
+}
+
+func TestAnalyzer_MergeSamples(t *testing.T) {
+	cpu := func(name string, usage int64) metrics.Row {
+		return metrics.Row{Namespace: "web", Name: name, Resource: config.ResourceCPU, UsageMc: usage, LimitMc: 1000}
+	}
+	merged := New().MergeSamples([][]metrics.Row{
+		{cpu("api-0", 100), cpu("api-1", 500)},
+		{cpu("api-0", 900), cpu("api-1", 500)},
+		{cpu("api-0", 200), cpu("api-2", 50)},
+	})
+
+	if len(merged) != 3 {
+		t.Fatalf("expected 3 rows, got %+v", merged)
+	}
+	api0 := merged[0]
+	if api0.Name != "api-0" || api0.UsageMc != 400 || api0.Percentage != 40 {
+		t.Errorf("expected api-0 at its mean usage of 400m (40%%), got %dm (%v%%)", api0.UsageMc, api0.Percentage)
+	}
+	if s := api0.Samples; s == nil || s.Count != 3 || s.Min != 100 || s.Avg != 400 || s.P95 != 900 || s.Max != 900 {
+		t.Errorf("unexpected api-0 samples %+v", api0.Samples)
+	}
+	if merged[1].Samples.Count != 2 || merged[2].Name != "api-2" || merged[2].Samples.Count != 1 {
+		t.Errorf("expected rows missing from samples to count fewer, got %+v and %+v", merged[1].Samples, merged[2].Samples)
+	}
+
+	memory := New().MergeSamples([][]metrics.Row{
+		{{Namespace: "web", Name: "api-0", Resource: config.ResourceMemory, UsageMi: 100, LimitMi: 400}},
+		{{Namespace: "web", Name: "api-0", Resource: config.ResourceMemory, UsageMi: 300, LimitMi: 400}},
+	})
+	if memory[0].UsageMi != 200 || memory[0].UsageBytes != 200*metrics.BytesPerMi || memory[0].Percentage != 50 {
+		t.Errorf("expected the mean memory usage of 200Mi (50%%), got %+v", memory[0])
+	}
+}
+
+func TestAnalyzer_Recommend(t *testing.T) {
+	row := func(name string, usageMi float64, usageMc int64) metrics.Row {
+		return metrics.Row{
+			Namespace: "web", Name: name, Resource: config.ResourceAll, Owner: "Deployment/api",
+			UsageMi: usageMi, UsageMc: usageMc, RequestMi: 512, LimitMi: 1024, RequestMc: 500, LimitMc: 1000,
+		}
+	}
+	rows := []metrics.Row{
+		row("api-1:api", 200, 100),
+		row("api-2:api", 300, 40),
+		row("api-1:api", 250, 150),
+		{Namespace: "web", Name: "debug:shell", Resource: config.ResourceAll, UsageMi: 1, UsageMc: 1},
+	}
+	recommendations := New().Recommend(rows, config.Options{RequestHeadroom: 1.2, LimitHeadroom: 1.5})
+
+	if len(recommendations) != 2 {
+		t.Fatalf("expected a recommendation per workload container, got %+v", recommendations)
+	}
+	api := recommendations[0]
+	if api.Owner != "Deployment/api" || api.Container != "api" || api.Pods != 2 {
+		t.Errorf("expected the api container of 2 replicas, got %+v", api)
+	}
+	if api.UsedMi != 300 || api.UsedMc != 150 {
+		t.Errorf("expected the peak usage across replicas and samples, got %vMi and %dm", api.UsedMi, api.UsedMc)
+	}
+	want := metrics.ResourceSettings{MemoryRequestMi: 360, MemoryLimitMi: 450, CPURequestMc: 180, CPULimitMc: 225}
+	if api.Suggested != want || api.Current.MemoryLimitMi != 1024 {
+		t.Errorf("expected suggested %+v over the current settings, got %+v and %+v", want, api.Suggested, api.Current)
+	}
+
+	// Pods without a controller are their own workload, and suggestions have a floor
+	shell := recommendations[1]
+	if shell.Owner != "Pod/debug" || shell.Suggested.MemoryRequestMi != 16 || shell.Suggested.CPURequestMc != 10 {
+		t.Errorf("expected the standalone pod at the minimum suggestion, got %+v", shell)
+	}
+
+	// Without a limit headroom no limits are suggested
+	noLimits := New().Recommend(rows, config.Options{RequestHeadroom: 1.2})
+	if noLimits[0].Suggested.MemoryLimitMi != 0 || noLimits[0].Suggested.CPULimitMc != 0 {
+		t.Errorf("expected no suggested limits, got %+v", noLimits[0].Suggested)
+	}
+}
+
+func TestAnalyzer_ApplyDisruptionBudgets(t *testing.T) {
+	recommendations := []metrics.Recommendation{
+		{Namespace: "web", Owner: "Deployment/api", Labels: map[string]string{"app": "api", "team": "web"}},
+		{Namespace: "web", Owner: "Deployment/worker", Labels: map[string]string{"app": "worker", "team": "web"}},
+		{Namespace: "web", Owner: "Pod/debug", Labels: map[string]string{"run": "debug"}},
+		{Namespace: "batch", Owner: "Deployment/api", Labels: map[string]string{"app": "api"}},
+	}
+	budgets := []metrics.DisruptionBudget{
+		{Namespace: "web", Name: "team", Selector: labels.SelectorFromSet(labels.Set{"team": "web"}), Allowed: 2},
+		{Namespace: "web", Name: "api", Selector: labels.SelectorFromSet(labels.Set{"app": "api"}), Allowed: 0},
+		{Namespace: "web", Name: "none", Selector: labels.Nothing(), Allowed: 0},
+	}
+	New().ApplyDisruptionBudgets(recommendations, budgets)
+
+	want := []metrics.Disruption{
+		{Budget: "api", Allowed: 0},
+		{Budget: "team", Allowed: 2},
+		{},
+		{},
+	}
+	for i, r := range recommendations {
+		if r.Disruption == nil || *r.Disruption != want[i] {
+			t.Errorf("expected %s/%s constrained by %+v, got %+v", r.Namespace, r.Owner, want[i], r.Disruption)
+		}
+	}
+}
+
+func TestAnalyzer_Select(t *testing.T) {
+	rows := []metrics.Row{
+		{Namespace: "team-a", Name: "pod-a", Resource: config.ResourceMemory, Percentage: 90},
+		{Namespace: "team-b", Name: "pod-b", Resource: config.ResourceMemory, Percentage: 50},
+		{Namespace: "kube-system", Name: "pod-c", Resource: config.ResourceMemory, Percentage: 95},
+	}
+
+	program, err := CompileFilter(`row.percentage > 80 && row.namespace.startsWith("team-")`)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	a := New()
+	opts := config.Options{Resource: config.ResourceMemory, FilterExpr: program}
+
+	traces := []metrics.Trace{{Name: "pod-b", Rows: rows[1:2]}}
+	a.SelectTraces(traces, opts)
+	if len(traces[0].Steps) != 1 || traces[0].Steps[0].Stage != StageFilterExpr || traces[0].Steps[0].Passed {
+		t.Errorf("expected failed filter-expr step, got %+v", traces[0].Steps)
+	}
+
+	selected, err := a.Select(rows, opts)
+	if err != nil {
+		t.Fatalf("select failed: %v", err)
+	}
+	if len(selected) != 1 || selected[0].Name != "pod-a" {
+		t.Errorf("expected only pod-a, got %+v", selected)
+	}
+
+	if _, err := CompileFilter("row.percentage"); err == nil {
+		t.Error("expected error for a non-boolean filter expression")
+	}
+	missing, err := CompileFilter(`row.labels.tier == "web"`)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if _, err := a.Select(rows, config.Options{FilterExpr: missing}); err == nil {
+		t.Error("expected error for a missing label")
+	}
+}
+
+func TestAnalyzer_SelectFieldVariables(t *testing.T) {
+	rows := []metrics.Row{
+		{Namespace: "team-a", Name: "pod-a", Resource: config.ResourceMemory, Percentage: 90},
+		{Namespace: "team-b", Name: "pod-b", Resource: config.ResourceMemory, Percentage: 50},
+		{Namespace: "kube-system", Name: "pod-c", Resource: config.ResourceMemory, Percentage: 95},
+	}
+
+	program, err := CompileFilter(`pct > 75 && namespace != "kube-system"`)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	selected, err := New().Select(rows, config.Options{Resource: config.ResourceMemory, FilterExpr: program})
+	if err != nil {
+		t.Fatalf("select failed: %v", err)
+	}
+	if len(selected) != 1 || selected[0].Name != "pod-a" {
+		t.Errorf("expected only pod-a, got %+v", selected)
+	}
+
+	if _, err := CompileFilter(`percentage > 75 && name.startsWith("pod-") && restarts == 0`); err != nil {
+		t.Errorf("expected the field variables to compile, got %v", err)
+	}
+	if _, err := CompileFilter(`pcnt > 75`); err == nil {
+		t.Error("expected an undeclared variable to fail to compile")
+	}
+}
+
+func TestQualifyNamespace(t *testing.T) {
+	tests := map[string]string{
+		`namespace != "kube-system"`:           `row.namespace != "kube-system"`,
+		`row.namespace == "a"`:                 `row.namespace == "a"`,
+		`row. namespace == "a"`:                `row. namespace == "a"`,
+		`name == "namespace"`:                  `name == "namespace"`,
+		`name == 'it\'s namespace'`:            `name == 'it\'s namespace'`,
+		`name == r"\" || namespace == "a"`:     `name == r"\" || row.namespace == "a"`,
+		`name == """namespace""" && namespace`: `name == """namespace""" && row.namespace`,
+		`namespaces == 1 || my_namespace == 2`: `namespaces == 1 || my_namespace == 2`,
+	}
+	for source, want := range tests {
+		if got := qualifyNamespace(source); got != want {
+			t.Errorf("%s: expected %s, got %s", source, want, got)
+		}
+	}
+}
+
+func TestAnalyzer_SelectPercentageRange(t *testing.T) {
+	rows := func() []metrics.Row {
+		return []metrics.Row{
+			{Name: "hot", Resource: config.ResourceMemory, LimitMi: 100, Percentage: 92},
+			{Name: "warm", Resource: config.ResourceMemory, LimitMi: 100, Percentage: 50},
+			{Name: "idle", Resource: config.ResourceMemory, LimitMi: 100, Percentage: 4},
+			{Name: "unlimited", Resource: config.ResourceMemory, UsageMi: 300},
+		}
+	}
+	bound := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name     string
+		min, max *float64
+		expected []string
+	}{
+		{name: "unbounded", expected: []string{"hot", "warm", "idle", "unlimited"}},
+		{name: "hot rows", min: bound(80), expected: []string{"hot"}},
+		{name: "underutilized rows", max: bound(20), expected: []string{"idle"}},
+		{name: "inclusive range", min: bound(4), max: bound(50), expected: []string{"warm", "idle"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := New().Select(rows(), config.Options{MinPercentage: tt.min, MaxPercentage: tt.max})
+			if err != nil {
+				t.Fatalf("select failed: %v", err)
+			}
+			var names []string
+			for _, row := range selected {
+				names = append(names, row.Name)
+			}
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, names)
+			}
+		})
+	}
+
+	traces := []metrics.Trace{{Name: "warm", Rows: rows()[1:2]}}
+	New().SelectTraces(traces, config.Options{MinPercentage: bound(80)})
+	if len(traces[0].Steps) != 1 || traces[0].Steps[0].Stage != StagePercentageRange || traces[0].Steps[0].Passed {
+		t.Errorf("expected a failed percentage-range step, got %+v", traces[0].Steps)
+	}
+}
+
+func TestAnalyzer_GroupByCostCenter(t *testing.T) {
+	rows := []metrics.Row{
+		{Namespace: "payments", Name: "pod-a", UsageMi: 90, LimitMi: 100},
+		{Namespace: "monitoring", Name: "pod-b", UsageMi: 20, LimitMi: 100},
+		{Namespace: "kube-system", Name: "pod-c", UsageMi: 150, LimitMi: 100},
+		{Namespace: "default", Name: "pod-d", UsageMi: 5, LimitMi: 10},
+		{Namespace: "payments", Name: "pod-e", UsageMi: 10, LimitMi: 50},
+	}
+	costCenters := map[string]string{"payments": "cc-1042", "monitoring": "platform", "kube-system": "platform"}
+
+	groups := New().GroupByCostCenter(rows, costCenters, config.Options{Resource: config.ResourceMemory})
+
+	expected := []struct {
+		key        string
+		namespaces []string
+		usage      float64
+		headroom   float64
+	}{
+		{key: "platform", namespaces: []string{"monitoring", "kube-system"}, usage: 170, headroom: 80},
+		{key: "cc-1042", namespaces: []string{"payments"}, usage: 100, headroom: 50},
+		{key: UnassignedCostCenter, namespaces: []string{"default"}, usage: 5, headroom: 5},
+	}
+
+	if len(groups) != len(expected) {
+		t.Fatalf("expected %d groups, got %d", len(expected), len(groups))
+	}
+	for i, want := range expected {
+		got := groups[i]
+		if got.Key != want.key || strings.Join(got.Namespaces, ",") != strings.Join(want.namespaces, ",") {
+			t.Errorf("group %d: expected %s %v, got %s %v", i, want.key, want.namespaces, got.Key, got.Namespaces)
+		}
+		if got.Total.UsageMi != want.usage || got.Headroom != want.headroom {
+			t.Errorf("%s: expected usage %v headroom %v, got %v and %v", want.key, want.usage, want.headroom, got.Total.UsageMi, got.Headroom)
+		}
+	}
+}
+
 // BenchmarkSort measures the performance of the sorting algorithm
 func BenchmarkSort(b *testing.B) {
 	// Create a large dataset for benchmarking
@@ -161,3 +769,489 @@ func BenchmarkSort(b *testing.B) {
 		analyzer.Sort(rowsCopy, opts)
 	}
 }
+
+func TestAnalyzer_ProjectPools(t *testing.T) {
+	pools := []metrics.NodePool{
+		{Name: "batch", Allocatable: 1000, Usage: 900},
+		{Name: "general", Allocatable: 1000, Usage: 400},
+		{Name: "gpu", Allocatable: 1000, Usage: 500},
+		{Name: "shrinking", Allocatable: 1000, Usage: 100},
+		{Name: "system", Allocatable: 1000, Usage: 950},
+	}
+	growth := map[string]float64{"general": 20, "gpu": 100, "shrinking": -10, "system": 5}
+
+	New().ProjectPools(pools, growth)
+
+	expected := []struct {
+		name string
+		days float64
+		ok   bool
+	}{
+		{name: "gpu", days: 5, ok: true},
+		{name: "system", days: 10, ok: true},
+		{name: "general", days: 30, ok: true},
+		{name: "batch"},
+		{name: "shrinking"},
+	}
+	for i, want := range expected {
+		days, ok := pools[i].DaysToFull()
+		if pools[i].Name != want.name || ok != want.ok || days != want.days {
+			t.Errorf("pool %d: expected %s %v/%t, got %s %v/%t", i, want.name, want.days, want.ok, pools[i].Name, days, ok)
+		}
+	}
+	if !pools[4].HasGrowth || pools[3].HasGrowth {
+		t.Errorf("expected growth only for pools with history: %+v", pools)
+	}
+}
+
+func TestAnalyzer_DiagnosePending(t *testing.T) {
+	nodes := []metrics.NodeAllocation{
+		// 1000m/2048Mi free, 3000m/4096Mi with right-sized requests
+		{Name: "node-a", AllocatableMc: 4000, AllocatableMi: 8192, RequestedMc: 3000, RequestedMi: 6144, ReclaimableMc: 2000, ReclaimableMi: 2048},
+		// 3500m/6144Mi free but cordoned
+		{Name: "node-b", Unschedulable: true, AllocatableMc: 4000, AllocatableMi: 8192, RequestedMc: 500, RequestedMi: 2048},
+		// 500m/1024Mi free, nothing reclaimable
+		{Name: "node-c", AllocatableMc: 4000, AllocatableMi: 8192, RequestedMc: 3500, RequestedMi: 7168},
+	}
+	pending := []metrics.PendingPod{
+		{Namespace: "web", Name: "large", RequestMc: 2000, RequestMi: 1024},
+		{Namespace: "batch", Name: "huge", RequestMc: 500, RequestMi: 6144},
+		{Namespace: "web", Name: "affinity", RequestMc: 250, RequestMi: 512},
+	}
+
+	New().DiagnosePending(pending, nodes)
+
+	expected := []metrics.PendingPod{
+		{Namespace: "batch", Name: "huge", RequestMc: 500, RequestMi: 6144, Verdict: VerdictCapacity},
+		{Namespace: "web", Name: "affinity", RequestMc: 250, RequestMi: 512, FitsNow: 2, FitsRightsized: 2, Verdict: VerdictConstraints},
+		{Namespace: "web", Name: "large", RequestMc: 2000, RequestMi: 1024, FitsRightsized: 1, Verdict: VerdictInflation},
+	}
+	for i, want := range expected {
+		if pending[i] != want {
+			t.Errorf("pod %d:\n got %+v\nwant %+v", i, pending[i], want)
+		}
+	}
+}
+
+func TestAnalyzer_Fragmentation(t *testing.T) {
+	nodes := []metrics.NodeAllocation{
+		// Memory is exhausted while CPU is free
+		{Name: "node-b", AllocatableMc: 4000, AllocatableMi: 8192, RequestedMc: 1000, RequestedMi: 7680, Pods: 6},
+		// Cordoned nodes do not take new pods
+		{Name: "node-c", Unschedulable: true, AllocatableMc: 4000, AllocatableMi: 8192, Pods: 0},
+		// CPU is exhausted while memory is free
+		{Name: "node-a", AllocatableMc: 4000, AllocatableMi: 8192, RequestedMc: 3750, RequestedMi: 2048, Pods: 2},
+	}
+
+	a := New()
+	shape := a.TypicalPodShape(nodes)
+	if shape != (metrics.PodShape{CPUMc: 593, MemoryMi: 1216}) {
+		t.Fatalf("unexpected shape %+v", shape)
+	}
+
+	got := a.Fragmentation(nodes, metrics.PodShape{CPUMc: 500, MemoryMi: 1024})
+	expected := []metrics.NodeFragmentation{
+		{Name: "node-a", FreeMc: 250, FreeMi: 6144, Fits: 0, StrandedMc: 250, StrandedMi: 6144},
+		{Name: "node-b", FreeMc: 3000, FreeMi: 512, Fits: 0, StrandedMc: 3000, StrandedMi: 512},
+	}
+	if len(got.Nodes) != len(expected) {
+		t.Fatalf("expected %d nodes, got %+v", len(expected), got.Nodes)
+	}
+	for i, want := range expected {
+		if got.Nodes[i] != want {
+			t.Errorf("node %d:\n got %+v\nwant %+v", i, got.Nodes[i], want)
+		}
+	}
+	if got.AllocatableMc != 8000 || got.AllocatableMi != 16384 {
+		t.Errorf("unexpected allocatable %d/%v", got.AllocatableMc, got.AllocatableMi)
+	}
+
+	// A shape without a memory request is only limited by CPU
+	got = a.Fragmentation(nodes[:1], metrics.PodShape{CPUMc: 1000})
+	if n := got.Nodes[0]; n.Fits != 3 || n.StrandedMc != 0 || n.StrandedMi != 512 {
+		t.Errorf("unexpected cpu-only packing %+v", n)
+	}
+}
+
+func TestAnalyzer_RankSidecars(t *testing.T) {
+	pods := []metrics.SidecarUsage{
+		{Namespace: "web", Name: "api-a", Sidecars: metrics.ResourceTotals{MemoryMi: 50, CPUMc: 50}, Total: metrics.ResourceTotals{MemoryMi: 500, CPUMc: 100}},
+		{Namespace: "web", Name: "api-b", Sidecars: metrics.ResourceTotals{MemoryMi: 50, CPUMc: 10}, Total: metrics.ResourceTotals{MemoryMi: 100, CPUMc: 100}},
+		{Namespace: "web", Name: "api-c", Sidecars: metrics.ResourceTotals{MemoryMi: 10, CPUMc: 20}, Total: metrics.ResourceTotals{MemoryMi: 400, CPUMc: 100}},
+	}
+
+	got, total := New().RankSidecars(pods, config.Options{Resource: config.ResourceCPU, TopN: 2})
+	if len(got) != 2 || got[0].Name != "api-a" || got[1].Name != "api-c" {
+		t.Errorf("unexpected cpu ranking %+v", got)
+	}
+	// The total covers the pods past the cut
+	if total.Name != "3 pods" || total.Sidecars.MemoryMi != 110 || total.Total.MemoryMi != 1000 {
+		t.Errorf("unexpected total %+v", total)
+	}
+}
+
+func TestAnalyzer_TopN(t *testing.T) {
+	a := New()
+
+	var rows []metrics.Row
+	for i := range 50 {
+		// Repeating percentages exercise the identity tie-break
+		rows = append(rows, metrics.Row{Namespace: "default", Name: fmt.Sprintf("pod-%02d", i), Percentage: float64((i * 37) % 20)})
+	}
+
+	for _, sortKey := range []config.SortKey{config.SortByPercentage, config.SortByUsage} {
+		for _, n := range []int{1, 5, 50, 80} {
+			opts := config.Options{Sort: sortKey, Resource: config.ResourceMemory, TopN: n}
+
+			top := a.NewTopN(opts)
+			for _, row := range rows {
+				top.Push(row)
+			}
+
+			expected := append([]metrics.Row(nil), rows...)
+			a.Sort(expected, opts)
+			expected = a.Filter(expected, opts)
+
+			got := top.Rows()
+			if len(got) != len(expected) || top.Len() != len(expected) {
+				t.Fatalf("sort %s top %d: expected %d rows, got %d", sortKey, n, len(expected), len(got))
+			}
+			for i := range got {
+				if got[i].Name != expected[i].Name {
+					t.Errorf("sort %s top %d: row %d expected %s, got %s", sortKey, n, i, expected[i].Name, got[i].Name)
+				}
+			}
+		}
+	}
+}
+
+func TestAnalyzer_Compare(t *testing.T) {
+	left := []metrics.Row{
+		{Namespace: "web", Name: "api-7c9d8-a", Owner: "Deployment/api", UsageMi: 100, LimitMi: 200},
+		{Namespace: "web", Name: "api-7c9d8-b", Owner: "Deployment/api", UsageMi: 100, LimitMi: 200},
+		{Namespace: "web", Name: "cache-0", Owner: "StatefulSet/cache", UsageMi: 90, LimitMi: 100},
+		{Namespace: "web", Name: "legacy-0", Owner: "StatefulSet/legacy", UsageMi: 10, LimitMi: 100},
+		{Namespace: "ops", Name: "debug", UsageMi: 5, LimitMi: 10},
+	}
+	right := []metrics.Row{
+		{Namespace: "web", Name: "api-5f6a7-x", Owner: "Deployment/api", UsageMi: 300, LimitMi: 400},
+		{Namespace: "web", Name: "cache-0", Owner: "StatefulSet/cache", UsageMi: 92, LimitMi: 100},
+		{Namespace: "web", Name: "worker-1", Owner: "Deployment/worker", UsageMi: 10, LimitMi: 20},
+		{Namespace: "ops", Name: "debug", UsageMi: 5, LimitMi: 10},
+	}
+
+	expected := []struct {
+		workload    string
+		left, right int
+		delta       float64
+	}{
+		{workload: "Deployment/worker", right: 1},
+		{workload: "StatefulSet/legacy", left: 1},
+		{workload: "Deployment/api", left: 2, right: 1, delta: 25},
+		{workload: "StatefulSet/cache", left: 1, right: 1, delta: 2},
+	}
+
+	comparisons := New().Compare(left, right, 1, config.Options{Resource: config.ResourceMemory})
+	if len(comparisons) != len(expected) {
+		t.Fatalf("expected %d comparisons, got %+v", len(expected), comparisons)
+	}
+	for i, want := range expected {
+		got := comparisons[i]
+		rows := func(u *metrics.WorkloadUsage) int {
+			if u == nil {
+				return 0
+			}
+			return u.Rows
+		}
+		delta, _ := got.Delta()
+		if got.Workload != want.workload || rows(got.Left) != want.left || rows(got.Right) != want.right || math.Abs(delta-want.delta) > 1e-9 {
+			t.Errorf("comparison %d: expected %s %d/%d %v, got %s %d/%d %v",
+				i, want.workload, want.left, want.right, want.delta, got.Workload, rows(got.Left), rows(got.Right), delta)
+		}
+	}
+}
+
+func TestAnalyzer_Classify(t *testing.T) {
+	critical := 100.0
+	opts := config.Options{
+		Threshold: 80,
+		Thresholds: &config.Thresholds{Policies: []config.ThresholdPolicy{
+			{Namespace: "dev", Critical: &critical},
+		}},
+	}
+	rows := []metrics.Row{
+		{Namespace: "prod", Percentage: 50},
+		{Namespace: "prod", Percentage: 80},
+		{Namespace: "prod", Percentage: 96},
+		{Namespace: "dev", Percentage: 96},
+	}
+
+	New().Classify(rows, opts)
+
+	expected := []metrics.Severity{metrics.SeverityOK, metrics.SeverityWarning, metrics.SeverityCritical, metrics.SeverityWarning}
+	for i, want := range expected {
+		if rows[i].Severity != want {
+			t.Errorf("row %d: expected %s, got %s", i, want, rows[i].Severity)
+		}
+	}
+}
+
+func TestAnalyzer_Check(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	data := `rules:
+- name: memory-ceiling
+  maxPercent: 90
+  exceptions: ["batch/Job/*"]
+- name: cpu-ceiling
+  resource: cpu
+  maxPercent: 100
+  namespace: web
+- name: memory-limits
+  requireLimits: [memory, cpu]
+  selector: tier=web
+- name: no-unlimited
+  forbidUnlimited: true
+  exceptions: ["ops/Pod/debug"]
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := config.LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy failed: %v", err)
+	}
+
+	rows := map[config.ResourceKind][]metrics.Row{
+		config.ResourceMemory: {
+			{Namespace: "web", Name: "api-a:app", Owner: "Deployment/api", Percentage: 95},
+			{Namespace: "web", Name: "api-b:app", Owner: "Deployment/api", Percentage: 90},
+			{Namespace: "batch", Name: "import-x:job", Owner: "Job/import", Percentage: 99},
+		},
+		config.ResourceCPU: {
+			{Namespace: "web", Name: "api-a:app", Owner: "Deployment/api", Percentage: 120},
+			{Namespace: "batch", Name: "import-x:job", Owner: "Job/import", Percentage: 300},
+		},
+	}
+	web := map[string]string{"tier": "web"}
+	limits := []metrics.ContainerLimits{
+		{Namespace: "web", Pod: "api-a", Container: "app", Owner: "Deployment/api", Labels: web, CPU: true, Memory: true},
+		{Namespace: "web", Pod: "api-a", Container: "proxy", Owner: "Deployment/api", Labels: web, Memory: true},
+		{Namespace: "web", Pod: "api-b", Container: "proxy", Owner: "Deployment/api", Labels: web},
+		{Namespace: "ops", Pod: "debug", Container: "shell"},
+		{Namespace: "ops", Pod: "toolbox", Container: "shell"},
+	}
+
+	expected := []metrics.Violation{
+		{Rule: "memory-ceiling", Namespace: "web", Name: "api-a:app", Owner: "Deployment/api", Detail: "memory usage at 95.0% of limit exceeds 90.0%"},
+		{Rule: "cpu-ceiling", Namespace: "web", Name: "api-a:app", Owner: "Deployment/api", Detail: "cpu usage at 120.0% of limit exceeds 100.0%"},
+		{Rule: "memory-limits", Namespace: "web", Name: "api-a:proxy", Owner: "Deployment/api", Detail: "missing cpu limit"},
+		{Rule: "memory-limits", Namespace: "web", Name: "api-b:proxy", Owner: "Deployment/api", Detail: "missing memory, cpu limit"},
+		{Rule: "no-unlimited", Namespace: "ops", Name: "toolbox:shell", Detail: "no resource limits set"},
+		{Rule: "no-unlimited", Namespace: "web", Name: "api-b:proxy", Owner: "Deployment/api", Detail: "no resource limits set"},
+	}
+
+	violations := New().Check(policy, rows, limits)
+	if len(violations) != len(expected) {
+		t.Fatalf("expected %d violations, got %+v", len(expected), violations)
+	}
+	for i, want := range expected {
+		if violations[i] != want {
+			t.Errorf("violation %d:\n got %+v\nwant %+v", i, violations[i], want)
+		}
+	}
+}
+
+func TestAnalyzer_Regressions(t *testing.T) {
+	opts := config.Options{Mode: config.ModePods}
+	rows := map[config.ResourceKind][]metrics.Row{
+		config.ResourceMemory: {
+			{Namespace: "web", Name: "api-7c9d8-a", Owner: "Deployment/api", UsageMi: 150, LimitMi: 200},
+			{Namespace: "web", Name: "api-7c9d8-b", Owner: "Deployment/api", UsageMi: 170, LimitMi: 200},
+			{Namespace: "web", Name: "cache-0", Owner: "StatefulSet/cache", UsageMi: 84, LimitMi: 100},
+			{Namespace: "web", Name: "worker-1", Owner: "Deployment/worker", UsageMi: 99, LimitMi: 100},
+		},
+		config.ResourceCPU: {
+			{Namespace: "web", Name: "api-7c9d8-a", Owner: "Deployment/api", UsageMc: 400, LimitMc: 500},
+		},
+	}
+
+	current := New().Baseline(rows, opts)
+	expected := []metrics.BaselineEntry{
+		{Namespace: "web", Workload: "Deployment/api", Resource: config.ResourceCPU, Percentage: 80},
+		{Namespace: "web", Workload: "Deployment/api", Resource: config.ResourceMemory, Percentage: 80},
+		{Namespace: "web", Workload: "Deployment/worker", Resource: config.ResourceMemory, Percentage: 99},
+		{Namespace: "web", Workload: "StatefulSet/cache", Resource: config.ResourceMemory, Percentage: 84},
+	}
+	if current.Mode != config.ModePods || len(current.Workloads) != len(expected) {
+		t.Fatalf("unexpected baseline %+v", current)
+	}
+	for i, want := range expected {
+		if got := current.Workloads[i]; got != want {
+			t.Errorf("entry %d:\n got %+v\nwant %+v", i, got, want)
+		}
+	}
+
+	// worker is new and cache is within tolerance, so only api regressed
+	accepted := metrics.Baseline{Mode: config.ModePods, Workloads: []metrics.BaselineEntry{
+		{Namespace: "web", Workload: "Deployment/api", Resource: config.ResourceCPU, Percentage: 78},
+		{Namespace: "web", Workload: "Deployment/api", Resource: config.ResourceMemory, Percentage: 60},
+		{Namespace: "web", Workload: "StatefulSet/cache", Resource: config.ResourceMemory, Percentage: 80},
+	}}
+	violations := New().Regressions(accepted, current, 5)
+	want := metrics.Violation{
+		Rule: RuleRegression, Namespace: "web", Name: "Deployment/api",
+		Detail: "memory usage at 80.0% of limit, up from 60.0% in baseline (tolerance 5.0)",
+	}
+	if len(violations) != 1 || violations[0] != want {
+		t.Errorf("unexpected regressions %+v", violations)
+	}
+}
+
+func TestAnalyzer_RankVolumes(t *testing.T) {
+	volumes := []metrics.VolumeUsage{
+		{Namespace: "web", Claim: "cache", Pod: "cache-1", Percentage: 40},
+		{Namespace: "payments", Claim: "data", Pod: "db-0", Percentage: 92},
+		{Namespace: "web", Claim: "cache", Pod: "cache-0", Percentage: 40},
+		{Namespace: "logs", Claim: "spool", Pod: "agent-x", Percentage: 10},
+	}
+
+	got := New().RankVolumes(volumes, config.Options{TopN: 3})
+	var names []string
+	for _, v := range got {
+		names = append(names, v.Pod)
+	}
+	if strings.Join(names, ",") != "db-0,cache-0,cache-1" {
+		t.Errorf("unexpected order %v", names)
+	}
+}
+
+func TestAnalyzer_RankQuotas(t *testing.T) {
+	quotas := []metrics.QuotaUsage{
+		{Namespace: "web", Quota: "compute", Resource: "limits.cpu", Hard: 1000, Used: 400},
+		{Namespace: "payments", Quota: "compute", Resource: "limits.memory", Hard: 1024, Used: 1000},
+		{Namespace: "web", Quota: "compute", Resource: "limits.memory", Hard: 1024, Used: 409.6},
+		{Namespace: "logs", Quota: "unset", Resource: "requests.cpu"},
+	}
+
+	var names []string
+	for _, q := range New().RankQuotas(quotas) {
+		names = append(names, q.Namespace+"/"+q.Resource)
+	}
+	if strings.Join(names, ",") != "payments/limits.memory,web/limits.cpu,web/limits.memory,logs/requests.cpu" {
+		t.Errorf("unexpected order %v", names)
+	}
+}
+
+func TestAnalyzer_Waste(t *testing.T) {
+	rows := []metrics.Row{
+		{Namespace: "web", Name: "api-1:app", RequestMi: 512, LimitMi: 1024, UsageMi: 128, RequestMc: 500, LimitMc: 1000, UsageMc: 100},
+		{Namespace: "web", Name: "api-1:proxy", RequestMi: 64, LimitMi: 128, UsageMi: 96, RequestMc: 100, UsageMc: 20},
+		{Namespace: "web", Name: "api-2:app", RequestMi: 512, LimitMi: 1024, UsageMi: 500, RequestMc: 500, LimitMc: 1000, UsageMc: 450},
+		{Namespace: "batch", Name: "job-1:worker", UsageMi: 256, UsageMc: 900},
+	}
+
+	report := New().Waste(rows, config.Options{WasteBasis: config.WasteBasisRequests, Resource: config.ResourceMemory, TopN: 2})
+	if len(report.Pods) != 2 || report.Pods[0].Name != "api-1" || report.Pods[1].Name != "api-2" {
+		t.Fatalf("expected api-1 then api-2, got %+v", report.Pods)
+	}
+	// The proxy uses more than it requests, which leaves nothing unused
+	if pod := report.Pods[0]; pod.ReservedMi != 576 || pod.UnusedMi != 384 || pod.UnusedMc != 480 {
+		t.Errorf("unexpected api-1 waste %+v", pod)
+	}
+	if len(report.Namespaces) != 2 || report.Namespaces[0].Namespace != "web" || report.Namespaces[0].Pods != 2 {
+		t.Errorf("expected web first with 2 pods, got %+v", report.Namespaces)
+	}
+	if report.Total.Pods != 3 || report.Total.UnusedMi != 396 || report.Total.UnusedMc != 530 {
+		t.Errorf("unexpected total %+v", report.Total)
+	}
+
+	report = New().Waste(rows, config.Options{WasteBasis: config.WasteBasisLimits, Resource: config.ResourceCPU})
+	if len(report.Pods) != 3 || report.Pods[0].Name != "api-1" || report.Pods[0].UnusedMc != 900 || report.Pods[0].UnusedMi != 928 {
+		t.Errorf("expected api-1 first by unused cpu limit, got %+v", report.Pods)
+	}
+}
+
+func TestAnalyzer_PriceAndRollupCost(t *testing.T) {
+	rows := []metrics.Row{
+		{Namespace: "web", Name: "api-1", Node: "spot-1", RequestMc: 1000, UsageMc: 200, RequestMi: 1024, UsageMi: 512, Labels: map[string]string{"team": "storefront"}},
+		{Namespace: "web", Name: "api-2", Node: "node-1", RequestMc: 500, UsageMc: 1500, UsageMi: 2048, Labels: map[string]string{"team": "storefront"}},
+		{Namespace: "batch", Name: "job-1", Node: "node-1", UsageMc: 1000},
+	}
+	pricing := &config.Pricing{
+		Price:     config.Price{CPUCoreHour: 0.04, MemoryGiBHour: 0.005},
+		PoolLabel: "pool",
+		Pools:     []config.PoolPrice{{Pool: "spot*", Price: config.Price{CPUCoreHour: 0.01, MemoryGiBHour: 0.001}}},
+	}
+
+	a := New()
+	a.Price(rows, pricing, map[string]string{"spot-1": "spot", "node-1": "standard"})
+
+	// Rows are billed for the greater of their request and usage
+	for i, want := range []float64{0.011, 0.07, 0.04} {
+		if math.Abs(rows[i].Cost-want) > 1e-9 {
+			t.Errorf("%s: expected cost %v, got %v", rows[i].Name, want, rows[i].Cost)
+		}
+	}
+
+	rollups := a.RollupCost(rows, config.Options{CostBy: config.CostByNamespace})
+	if len(rollups) != 2 || rollups[0].Key != "web" || rollups[0].Rows != 2 || math.Abs(rollups[0].Cost-0.081) > 1e-9 {
+		t.Errorf("expected web first, got %+v", rollups)
+	}
+
+	rollups = a.RollupCost(rows, config.Options{CostBy: "team"})
+	if len(rollups) != 2 || rollups[0].Key != "storefront" || rollups[1].Key != "<none>" {
+		t.Errorf("expected storefront then <none>, got %+v", rollups)
+	}
+}
+
+func TestAnalyzer_GroupCronJobs(t *testing.T) {
+	rows := []metrics.Row{
+		{Namespace: "batch", Name: "report-28900000-a", Owner: "Job/report-28900000", UsageMi: 100, LimitMi: 400},
+		{Namespace: "batch", Name: "report-28900000-b", Owner: "Job/report-28900000", UsageMi: 150, LimitMi: 400},
+		{Namespace: "batch", Name: "api-5d4c-x", Owner: "Deployment/api", UsageMi: 10, LimitMi: 100},
+		{Namespace: "batch", Name: "report-28900060-a", Owner: "Job/report-28900060", UsageMi: 50, LimitMi: 400, Restarts: 1},
+		{Namespace: "batch", Name: "migrate-x", Owner: "Job/migrate", UsageMi: 20, LimitMi: 100},
+	}
+
+	tests := []struct {
+		aggregation config.Aggregation
+		usage       float64
+		limit       float64
+	}{
+		// The first execution ran two pods
+		{config.AggregationMax, 250, 800},
+		{config.AggregationAvg, 150, 600},
+	}
+	for _, tt := range tests {
+		opts := config.Options{Mode: config.ModePods, Resource: config.ResourceMemory, CronJobAggregation: tt.aggregation}
+		got := New().GroupCronJobs(append([]metrics.Row(nil), rows...), opts)
+
+		if len(got) != 3 || got[0].Owner != "Deployment/api" || got[1].Owner != "Job/migrate" {
+			t.Fatalf("%s: unexpected rows %+v", tt.aggregation, got)
+		}
+		cron := got[2]
+		if cron.Name != "report" || cron.Owner != "CronJob/report" || cron.Namespace != "batch" {
+			t.Errorf("%s: unexpected cronjob row %+v", tt.aggregation, cron)
+		}
+		if cron.UsageMi != tt.usage || cron.LimitMi != tt.limit || cron.Percentage != tt.usage/tt.limit*100 {
+			t.Errorf("%s: expected %v/%v, got %v/%v (%v%%)", tt.aggregation, tt.usage, tt.limit, cron.UsageMi, cron.LimitMi, cron.Percentage)
+		}
+	}
+}
+
+func TestCronJobOf(t *testing.T) {
+	tests := []struct {
+		owner string
+		want  string
+	}{
+		{"Job/nightly-backup-28901440", "nightly-backup"},
+		{"Job/migrate-42", ""},
+		{"Deployment/api-28901440", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got, _ := CronJobOf(tt.owner); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.owner, tt.want, got)
+		}
+	}
+}
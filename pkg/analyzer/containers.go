@@ -0,0 +1,79 @@
+// Package analyzer - aggregation of containers across replicas
+package analyzer
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// GroupContainerNames replaces container rows with one row per container name
+// of a workload, merging the containers of its replicas. The row, named after
+// the container and owned by the workload, keeps the usage and limit of the
+// replica closest to its limit, so it is ranked by the highest percentage, and
+// records the count, mean, p95 and max percentage of the replicas. The
+// containers of pods without an owner are merged per pod.
+func (a *Analyzer) GroupContainerNames(rows []metrics.Row) []metrics.Row {
+	var (
+		order  []string
+		groups = make(map[string][]metrics.Row)
+	)
+	for _, row := range rows {
+		pod, container, _ := strings.Cut(row.Name, ":")
+		row.Name = container
+		if row.Owner == "" {
+			row.Owner = "Pod/" + pod
+		}
+
+		key := row.Cluster + "/" + row.Namespace + "/" + row.Owner + "/" + container
+		if _, exists := groups[key]; !exists {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], row)
+	}
+
+	result := make([]metrics.Row, 0, len(order))
+	for _, key := range order {
+		replicas := groups[key]
+		merged := replicas[0]
+		percentages := make([]float64, 0, len(replicas))
+		var restarts int32
+		crashLoop := false
+		for _, row := range replicas {
+			if row.Percentage > merged.Percentage {
+				merged = row
+			}
+			percentages = append(percentages, row.Percentage)
+			restarts += row.Restarts
+			crashLoop = crashLoop || row.CrashLoop
+		}
+
+		merged.Restarts = restarts
+		merged.CrashLoop = crashLoop
+		merged.Replicas = replicaStats(percentages)
+		// Replicas run on different nodes with different pod labels
+		merged.Node = ""
+		merged.Labels = nil
+		result = append(result, merged)
+	}
+	return result
+}
+
+// replicaStats summarizes percentages; p95 uses the nearest-rank method.
+func replicaStats(percentages []float64) *metrics.ReplicaStats {
+	sort.Float64s(percentages)
+	var sum float64
+	for _, p := range percentages {
+		sum += p
+	}
+	n := len(percentages)
+	rank := int(math.Ceil(0.95*float64(n))) - 1
+	return &metrics.ReplicaStats{
+		Count:          n,
+		MeanPercentage: sum / float64(n),
+		P95Percentage:  percentages[rank],
+		MaxPercentage:  percentages[n-1],
+	}
+}
@@ -0,0 +1,52 @@
+// Package analyzer - cost estimates
+package analyzer
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// Price sets the hourly cost of every row at the price of the pool of its
+// node, with pools mapping node names to their pool. A row is billed for the
+// greater of its request and its usage of each resource: the request is held
+// for it by the scheduler, and usage above it is consumed all the same.
+func (a *Analyzer) Price(rows []metrics.Row, pricing *config.Pricing, pools map[string]string) {
+	for i := range rows {
+		row := &rows[i]
+		price := pricing.For(pools[row.Node])
+		row.Cost = price.Cost(max(row.RequestMc, row.UsageMc), max(row.RequestMi, row.UsageMi))
+	}
+}
+
+// RollupCost sums the cost of rows per namespace, or per value of the pod
+// label opts.CostBy, most expensive first. Rows without the label are rolled
+// up under <none>.
+func (a *Analyzer) RollupCost(rows []metrics.Row, opts config.Options) []metrics.CostRollup {
+	var rollups []metrics.CostRollup
+	index := make(map[string]int)
+	for _, row := range rows {
+		key := row.Namespace
+		if opts.CostBy != config.CostByNamespace {
+			key = row.Labels[opts.CostBy]
+		}
+		if key == "" {
+			key = "<none>"
+		}
+		i, exists := index[key]
+		if !exists {
+			i = len(rollups)
+			index[key] = i
+			rollups = append(rollups, metrics.CostRollup{Key: key})
+		}
+		rollups[i].Rows++
+		rollups[i].Cost += row.Cost
+	}
+
+	slices.SortFunc(rollups, func(left, right metrics.CostRollup) int {
+		return cmp.Or(cmp.Compare(right.Cost, left.Cost), cmp.Compare(left.Key, right.Key))
+	})
+	return rollups
+}
@@ -0,0 +1,121 @@
+// Package analyzer - aggregation of CronJob executions
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// cronJobName matches the Jobs a CronJob creates, named after the CronJob
+// with the scheduled time in minutes since the epoch appended
+var cronJobName = regexp.MustCompile(`^Job/(.+)-(\d{8,})$`)
+
+// CronJobOf returns the CronJob that created the Job owning a row, from the
+// name the CronJob controller gives its Jobs.
+func CronJobOf(owner string) (string, bool) {
+	match := cronJobName.FindStringSubmatch(owner)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// GroupCronJobs replaces the rows of pods created by CronJob executions with
+// one row per CronJob, or per CronJob container in containers mode. The rows
+// of an execution (a Job, possibly running several pods) are summed, and the
+// executions combined by opts.CronJobAggregation: the largest execution with
+// max, or their mean with avg. Other rows are returned unchanged, in order,
+// followed by the CronJob rows.
+func (a *Analyzer) GroupCronJobs(rows []metrics.Row, opts config.Options) []metrics.Row {
+	type cronJob struct {
+		name       string
+		executions map[string][]metrics.Row
+		order      []string
+	}
+
+	var (
+		result []metrics.Row
+		jobs   []*cronJob
+		index  = make(map[string]*cronJob)
+	)
+	for _, row := range rows {
+		name, ok := CronJobOf(row.Owner)
+		if !ok {
+			result = append(result, row)
+			continue
+		}
+		if opts.Mode == config.ModeContainers {
+			if _, container, found := strings.Cut(row.Name, ":"); found {
+				name += ":" + container
+			}
+		}
+
+		key := row.Namespace + "/" + name
+		job, exists := index[key]
+		if !exists {
+			job = &cronJob{name: name, executions: make(map[string][]metrics.Row)}
+			index[key] = job
+			jobs = append(jobs, job)
+		}
+		if _, seen := job.executions[row.Owner]; !seen {
+			job.order = append(job.order, row.Owner)
+		}
+		job.executions[row.Owner] = append(job.executions[row.Owner], row)
+	}
+
+	for _, job := range jobs {
+		executions := make([]metrics.Row, 0, len(job.order))
+		for _, owner := range job.order {
+			execution := a.total(owner, job.executions[owner], opts)
+			execution.Namespace = job.executions[owner][0].Namespace
+			executions = append(executions, execution)
+		}
+		result = append(result, a.combineExecutions(job.name, executions, opts))
+	}
+	return result
+}
+
+// combineExecutions merges the totals of the executions of a CronJob into a
+// single row by opts.CronJobAggregation and recomputes its percentage.
+func (a *Analyzer) combineExecutions(name string, executions []metrics.Row, opts config.Options) metrics.Row {
+	first := executions[0]
+	combined := first
+	if opts.CronJobAggregation == config.AggregationAvg {
+		combined = a.total(first.Name, executions, opts)
+		n := int64(len(executions))
+		combined.UsageBytes /= n
+		combined.LimitBytes /= n
+		combined.UsageMi /= float64(n)
+		combined.LimitMi /= float64(n)
+		combined.UsageMc /= n
+		combined.LimitMc /= n
+		combined.RequestBytes /= n
+		combined.RequestMi /= float64(n)
+		combined.RequestMc /= n
+	} else {
+		for _, execution := range executions[1:] {
+			if a.compareByUsage(execution, combined, opts.Resource) {
+				combined = execution
+			}
+		}
+		combined.Restarts = 0
+		for _, execution := range executions {
+			combined.Restarts += execution.Restarts
+		}
+	}
+
+	owner, _, _ := strings.Cut(name, ":")
+	combined.Namespace = first.Namespace
+	combined.Name = name
+	combined.Owner = "CronJob/" + owner
+	// Executions run on different nodes over time
+	combined.Node = ""
+	combined.Labels = nil
+	combined.Network = nil
+	setPercentage(&combined, opts.Resource)
+
+	return combined
+}
@@ -0,0 +1,437 @@
+// Package analyzer - CEL score and filter expressions over rows
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/decls"
+	"github.com/google/cel-go/common/env"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/stdlib"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/ext"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+const (
+	// StageFilterExpr is the trace stage reporting the --filter-expr outcome
+	StageFilterExpr = "filter-expr"
+	// StagePercentageRange is the trace stage reporting the --min-pct and --max-pct outcome
+	StagePercentageRange = "percentage-range"
+)
+
+// exprRow is the row variable of score and filter expressions. Its fields are named
+// after the JSON output and are also declared as top-level variables, with pct
+// as an alias of percentage, so pct > 75 reads as row.percentage > 75; usage,
+// limit and request are in the units of the selected resource: Mi for memory
+// and millicores for CPU. Restarts is an int and the other numbers are
+// doubles; arithmetic mixes the two, so row.percentage * (row.restarts + 1)
+// needs no double literals.
+type exprRow struct {
+	Namespace       string            `cel:"namespace"`
+	Name            string            `cel:"name"`
+	Resource        string            `cel:"resource"`
+	Mode            string            `cel:"mode"`
+	Usage           float64           `cel:"usage"`
+	Limit           float64           `cel:"limit"`
+	Request         float64           `cel:"request"`
+	Percentage      float64           `cel:"percentage"`
+	ThrottlePercent float64           `cel:"throttle_percent"`
+	Restarts        int64             `cel:"restarts"`
+	CrashLoop       bool              `cel:"crash_loop"`
+	Node            string            `cel:"node"`
+	Owner           string            `cel:"owner"`
+	PriorityClass   string            `cel:"priority_class"`
+	Labels          map[string]string `cel:"labels"`
+	Score           float64           `cel:"score"`
+}
+
+// newExprRow returns the row variable describing row.
+func newExprRow(row metrics.Row) exprRow {
+	r := exprRow{
+		Namespace:       row.Namespace,
+		Name:            row.Name,
+		Resource:        string(row.Resource),
+		Mode:            string(row.Mode),
+		Usage:           row.UsageMi,
+		Limit:           row.LimitMi,
+		Request:         row.RequestMi,
+		Percentage:      row.Percentage,
+		ThrottlePercent: row.ThrottlePercent,
+		Restarts:        int64(row.Restarts),
+		CrashLoop:       row.CrashLoop,
+		Node:            row.Node,
+		Owner:           row.Owner,
+		PriorityClass:   row.PriorityClass,
+		Labels:          row.Labels,
+		Score:           row.Score,
+	}
+	if row.Resource == config.ResourceCPU {
+		r.Usage = float64(row.UsageMc)
+		r.Limit = float64(row.LimitMc)
+		r.Request = float64(row.RequestMc)
+	}
+	if r.Labels == nil {
+		r.Labels = map[string]string{}
+	}
+	return r
+}
+
+// exprVars returns the variables of row expressions for row: row itself and
+// each of its fields, named after their cel tag, plus pct.
+func exprVars(row metrics.Row) map[string]any {
+	r := newExprRow(row)
+	vars := map[string]any{"row": r, "pct": r.Percentage}
+	v := reflect.ValueOf(r)
+	for i := range v.NumField() {
+		vars[v.Type().Field(i).Tag.Get("cel")] = v.Field(i).Interface()
+	}
+	return vars
+}
+
+// exprFieldTypes maps the Go types of exprRow fields to their CEL types.
+var exprFieldTypes = map[reflect.Type]*cel.Type{
+	reflect.TypeFor[string]():            cel.StringType,
+	reflect.TypeFor[float64]():           cel.DoubleType,
+	reflect.TypeFor[int64]():             cel.IntType,
+	reflect.TypeFor[bool]():              cel.BoolType,
+	reflect.TypeFor[map[string]string](): cel.MapType(cel.StringType, cel.StringType),
+}
+
+// exprEnv is the CEL environment of row expressions, declaring the row variable
+// and its fields. namespace is a reserved word in CEL and is not declared;
+// qualifyNamespace reads it as row.namespace instead.
+var exprEnv = sync.OnceValues(func() (*cel.Env, error) {
+	opts := []cel.EnvOption{
+		cel.StdLib(cel.StdLibSubset(&env.LibrarySubset{ExcludeFunctions: arithmeticFunctions()})),
+		ext.NativeTypes(reflect.TypeFor[exprRow](), ext.ParseStructTags(true)),
+		cel.Variable("row", cel.ObjectType("analyzer.exprRow")),
+		cel.Variable("pct", cel.DoubleType),
+		cel.CrossTypeNumericComparisons(true),
+		ext.Strings(),
+	}
+	for _, field := range reflect.VisibleFields(reflect.TypeFor[exprRow]()) {
+		name := field.Tag.Get("cel")
+		if name == "namespace" {
+			continue
+		}
+		typ, ok := exprFieldTypes[field.Type]
+		if !ok {
+			return nil, fmt.Errorf("row field %s has no expression type", name)
+		}
+		opts = append(opts, cel.Variable(name, typ))
+	}
+	arithmetic, err := mixedArithmetic()
+	if err != nil {
+		return nil, err
+	}
+	return cel.NewCustomEnv(append(opts, arithmetic...)...)
+})
+
+// arithmeticOperators are the standard operators redeclared by mixedArithmetic.
+var arithmeticOperators = []struct {
+	name, id string
+	trait    int
+	apply    func(lhs, rhs ref.Val) ref.Val
+}{
+	{operators.Add, "add", traits.AdderType, func(lhs, rhs ref.Val) ref.Val { return lhs.(traits.Adder).Add(rhs) }},
+	{operators.Subtract, "subtract", traits.SubtractorType, func(lhs, rhs ref.Val) ref.Val { return lhs.(traits.Subtractor).Subtract(rhs) }},
+	{operators.Multiply, "multiply", traits.MultiplierType, func(lhs, rhs ref.Val) ref.Val { return lhs.(traits.Multiplier).Multiply(rhs) }},
+	{operators.Divide, "divide", traits.DividerType, func(lhs, rhs ref.Val) ref.Val { return lhs.(traits.Divider).Divide(rhs) }},
+}
+
+// arithmeticFunctions excludes the standard arithmetic operators, which
+// mixedArithmetic declares instead.
+func arithmeticFunctions() []*env.Function {
+	var fns []*env.Function
+	for _, op := range arithmeticOperators {
+		fns = append(fns, &env.Function{Name: op.name})
+	}
+	return fns
+}
+
+// mixedArithmetic declares +, -, * and / with their standard overloads plus
+// one for each mix of an int and a double operand, which CEL does not
+// convert implicitly. Mixed operands are computed in doubles.
+func mixedArithmetic() ([]cel.EnvOption, error) {
+	standard := map[string]*decls.FunctionDecl{}
+	for _, fn := range stdlib.Functions() {
+		standard[fn.Name()] = fn
+	}
+
+	var opts []cel.EnvOption
+	for _, op := range arithmeticOperators {
+		fn, ok := standard[op.name]
+		if !ok {
+			return nil, fmt.Errorf("standard library has no %s operator", op.name)
+		}
+		var fnOpts []cel.FunctionOpt
+		for _, o := range fn.OverloadDecls() {
+			fnOpts = append(fnOpts, cel.Overload(o.ID(), o.ArgTypes(), o.ResultType()))
+		}
+		apply := op.apply
+		fnOpts = append(fnOpts,
+			cel.Overload(op.id+"_double_int", []*cel.Type{cel.DoubleType, cel.IntType}, cel.DoubleType),
+			cel.Overload(op.id+"_int_double", []*cel.Type{cel.IntType, cel.DoubleType}, cel.DoubleType),
+			cel.SingletonBinaryBinding(func(lhs, rhs ref.Val) ref.Val {
+				if l, ok := lhs.(types.Int); ok {
+					if _, ok := rhs.(types.Double); ok {
+						lhs = types.Double(l)
+					}
+				}
+				if r, ok := rhs.(types.Int); ok {
+					if _, ok := lhs.(types.Double); ok {
+						rhs = types.Double(r)
+					}
+				}
+				return apply(lhs, rhs)
+			}, op.trait))
+		opts = append(opts, cel.Function(op.name, fnOpts...))
+	}
+	return opts, nil
+}
+
+// CompileScore compiles a --score-expr expression, which must evaluate to a
+// number. Unknown fields and type errors are reported before any data is
+// collected.
+func CompileScore(source string) (*config.Expression, error) {
+	return compileExpr(source, cel.DoubleType, cel.IntType)
+}
+
+// CompileFilter compiles a --filter expression, which must evaluate to a
+// bool.
+func CompileFilter(source string) (*config.Expression, error) {
+	return compileExpr(source, cel.BoolType)
+}
+
+// compileExpr compiles source in the row environment and checks that its
+// result is one of the given types, or dynamic.
+func compileExpr(source string, results ...*cel.Type) (*config.Expression, error) {
+	env, err := exprEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the expression environment: %w", err)
+	}
+
+	ast, issues := env.Compile(qualifyNamespace(source))
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	output := ast.OutputType()
+	if !output.IsExactType(cel.DynType) && !slices.ContainsFunc(results, output.IsExactType) {
+		return nil, fmt.Errorf("expression %q returns %s, expected %s", source, output, results[0])
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	return &config.Expression{Source: source, Program: program}, nil
+}
+
+// qualifyNamespace rewrites each bare namespace identifier in source, outside
+// string literals and field selections, to row.namespace. namespace is a
+// reserved word in CEL, so unlike the other fields it cannot be declared as a
+// variable.
+func qualifyNamespace(source string) string {
+	var b strings.Builder
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == '"' || c == '\'':
+			end := stringEnd(source, i, false)
+			b.WriteString(source[i:end])
+			i = end
+		case c == '_' || isLetter(c):
+			end := i + 1
+			for end < len(source) && (source[end] == '_' || isLetter(source[end]) || isDigit(source[end])) {
+				end++
+			}
+			word := source[i:end]
+			switch {
+			case end < len(source) && (source[end] == '"' || source[end] == '\'') && strings.Trim(word, "rRbB") == "" && len(word) <= 2:
+				// prefixed string literal, whose quotes a raw r prefix does not let backslashes escape
+				end = stringEnd(source, end, strings.ContainsAny(word, "rR"))
+				b.WriteString(source[i:end])
+			case word == "namespace" && !strings.HasSuffix(strings.TrimRight(source[:i], " \t\r\n"), "."):
+				b.WriteString("row.namespace")
+			default:
+				b.WriteString(word)
+			}
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+func isLetter(c byte) bool { return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' }
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+// stringEnd returns the index just past the string literal starting with the
+// quote at source[start], or len(source) when it is not terminated.
+func stringEnd(source string, start int, raw bool) int {
+	quote := source[start : start+1]
+	if strings.HasPrefix(source[start:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	for i := start + len(quote); i < len(source); i++ {
+		if source[i] == '\\' && !raw {
+			i++
+			continue
+		}
+		if strings.HasPrefix(source[i:], quote) {
+			return i + len(quote)
+		}
+	}
+	return len(source)
+}
+
+// evalScore evaluates a score expression for row.
+func evalScore(e *config.Expression, row metrics.Row) (float64, error) {
+	value, _, err := e.Program.Eval(exprVars(row))
+	if err != nil {
+		return 0, err
+	}
+
+	var score float64
+	switch v := value.Value().(type) {
+	case float64:
+		score = v
+	case int64:
+		score = float64(v)
+	default:
+		return 0, fmt.Errorf("expression %q returned %s, expected a number", e, value.Type())
+	}
+	if math.IsNaN(score) || math.IsInf(score, 0) {
+		return 0, fmt.Errorf("expression %q returned %v", e, score)
+	}
+	return score, nil
+}
+
+// evalFilter evaluates a filter expression for row.
+func evalFilter(e *config.Expression, row metrics.Row) (bool, error) {
+	value, _, err := e.Program.Eval(exprVars(row))
+	if err != nil {
+		return false, err
+	}
+	keep, ok := value.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q returned %s, expected a bool", e, value.Type())
+	}
+	return keep, nil
+}
+
+// Score evaluates the score expression for every row, or takes its
+// percentage without one, multiplies it by the weight of the row and stores
+// the result in Row.Score. It is a no-op when neither a score expression nor
+// weights are configured.
+func (a *Analyzer) Score(rows []metrics.Row, opts config.Options) error {
+	if !opts.Scored() {
+		return nil
+	}
+
+	for i := range rows {
+		score := rows[i].Percentage
+		if opts.ScoreExpr != nil {
+			var err error
+			score, err = evalScore(opts.ScoreExpr, rows[i])
+			if err != nil {
+				return fmt.Errorf("failed to score %s/%s: %w", rows[i].Namespace, rows[i].Name, err)
+			}
+		}
+		rows[i].Score = score * opts.Weights.For(rows[i].Namespace, rows[i].PriorityClass)
+	}
+
+	return nil
+}
+
+// Select returns the rows whose percentage is within opts.MinPercentage and
+// opts.MaxPercentage and for which the filter expression is true. Rows are
+// filtered in place. It is a no-op when neither is configured.
+func (a *Analyzer) Select(rows []metrics.Row, opts config.Options) ([]metrics.Row, error) {
+	if opts.FilterExpr == nil && opts.MinPercentage == nil && opts.MaxPercentage == nil {
+		return rows, nil
+	}
+
+	selected := rows[:0]
+	for _, row := range rows {
+		if ok, _ := inPercentageRange(row, opts); !ok {
+			continue
+		}
+		if opts.FilterExpr != nil {
+			keep, err := evalFilter(opts.FilterExpr, row)
+			if err != nil {
+				return nil, fmt.Errorf("failed to filter %s/%s: %w", row.Namespace, row.Name, err)
+			}
+			if !keep {
+				continue
+			}
+		}
+		selected = append(selected, row)
+	}
+
+	return selected, nil
+}
+
+// inPercentageRange reports whether the percentage of row is at least
+// opts.MinPercentage and at most opts.MaxPercentage, with the reason when it
+// is not. Rows without a limit have no percentage and are outside any range.
+func inPercentageRange(row metrics.Row, opts config.Options) (bool, string) {
+	if opts.MinPercentage == nil && opts.MaxPercentage == nil {
+		return true, ""
+	}
+	if !row.HasLimit() {
+		return false, "has no limit and no percentage"
+	}
+	if opts.MinPercentage != nil && row.Percentage < *opts.MinPercentage {
+		return false, fmt.Sprintf("%.1f%% is below --min-pct %g", row.Percentage, *opts.MinPercentage)
+	}
+	if opts.MaxPercentage != nil && row.Percentage > *opts.MaxPercentage {
+		return false, fmt.Sprintf("%.1f%% is above --max-pct %g", row.Percentage, *opts.MaxPercentage)
+	}
+	return true, fmt.Sprintf("%.1f%% is within the percentage range", row.Percentage)
+}
+
+// SelectTraces appends a percentage range and a filter expression step to
+// each trace, reporting whether its rows pass --min-pct, --max-pct and
+// --filter-expr.
+func (a *Analyzer) SelectTraces(traces []metrics.Trace, opts config.Options) {
+	if opts.MinPercentage != nil || opts.MaxPercentage != nil {
+		for i := range traces {
+			for _, row := range traces[i].Rows {
+				ok, detail := inPercentageRange(row, opts)
+				traces[i].AddStep(StagePercentageRange, ok, fmt.Sprintf("%s %s", row.Name, detail))
+			}
+		}
+	}
+	if opts.FilterExpr == nil {
+		return
+	}
+
+	for i := range traces {
+		for _, row := range traces[i].Rows {
+			keep, err := evalFilter(opts.FilterExpr, row)
+			switch {
+			case err != nil:
+				traces[i].AddStep(StageFilterExpr, false, fmt.Sprintf("%s: %v", row.Name, err))
+			case keep:
+				traces[i].AddStep(StageFilterExpr, true, fmt.Sprintf("%s matches %q", row.Name, opts.FilterExpr))
+			default:
+				traces[i].AddStep(StageFilterExpr, false, fmt.Sprintf("%s does not match %q", row.Name, opts.FilterExpr))
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Package analyzer - request and limit recommendations
+package analyzer
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+const (
+	// minSuggestedMemoryMi is the smallest memory request or limit suggested,
+	// so idle containers are not squeezed to nothing
+	minSuggestedMemoryMi = 16
+	// minSuggestedCPUMc is the smallest CPU request or limit suggested
+	minSuggestedCPUMc = 10
+)
+
+// Recommend suggests the requests and limits of every container of every
+// workload from container rows of both resources, which may span the replicas
+// of the workload and repeated samples. The peak usage observed for a
+// container is scaled by opts.RequestHeadroom into its suggested requests and
+// by opts.LimitHeadroom into its suggested limits, rounded up to whole Mi and
+// millicores. Recommendations are ordered by namespace, workload and container.
+func (a *Analyzer) Recommend(rows []metrics.Row, opts config.Options) []metrics.Recommendation {
+	var (
+		recommendations []metrics.Recommendation
+		index           = make(map[string]int)
+		pods            = make(map[string]map[string]bool)
+	)
+	for _, row := range rows {
+		pod, container, _ := strings.Cut(row.Name, ":")
+		owner := row.Owner
+		if owner == "" {
+			owner = "Pod/" + pod
+		}
+
+		key := row.Cluster + "/" + row.Namespace + "/" + owner + "/" + container
+		i, exists := index[key]
+		if !exists {
+			i = len(recommendations)
+			index[key] = i
+			pods[key] = make(map[string]bool)
+			recommendations = append(recommendations, metrics.Recommendation{
+				Namespace: row.Namespace,
+				Owner:     owner,
+				Container: container,
+				Labels:    row.Labels,
+			})
+		}
+
+		r := &recommendations[i]
+		pods[key][pod] = true
+		r.Pods = len(pods[key])
+		r.UsedMi = max(r.UsedMi, row.UsageMi)
+		r.UsedMc = max(r.UsedMc, row.UsageMc)
+		r.Current = metrics.ResourceSettings{
+			MemoryRequestMi: row.RequestMi,
+			MemoryLimitMi:   row.LimitMi,
+			CPURequestMc:    row.RequestMc,
+			CPULimitMc:      row.LimitMc,
+		}
+	}
+
+	for i := range recommendations {
+		r := &recommendations[i]
+		r.Suggested = metrics.ResourceSettings{
+			MemoryRequestMi: suggestMemory(r.UsedMi, opts.RequestHeadroom),
+			CPURequestMc:    suggestCPU(r.UsedMc, opts.RequestHeadroom),
+		}
+		if opts.LimitHeadroom > 0 {
+			r.Suggested.MemoryLimitMi = suggestMemory(r.UsedMi, opts.LimitHeadroom)
+			r.Suggested.CPULimitMc = suggestCPU(r.UsedMc, opts.LimitHeadroom)
+		}
+	}
+
+	slices.SortFunc(recommendations, func(a, b metrics.Recommendation) int {
+		return cmp.Or(
+			cmp.Compare(a.Namespace, b.Namespace),
+			cmp.Compare(a.Owner, b.Owner),
+			cmp.Compare(a.Container, b.Container),
+		)
+	})
+	return recommendations
+}
+
+// ApplyDisruptionBudgets sets the Disruption of every recommendation to the
+// budget of its namespace selecting its pods that allows the fewest evictions.
+// Budgets limit node drains and other voluntary evictions, such as a rightsizer
+// evicting pods to apply a suggestion, but not the rollout of a patched workload.
+func (a *Analyzer) ApplyDisruptionBudgets(recommendations []metrics.Recommendation, budgets []metrics.DisruptionBudget) {
+	for i := range recommendations {
+		r := &recommendations[i]
+		r.Disruption = &metrics.Disruption{}
+		for _, budget := range budgets {
+			if budget.Namespace != r.Namespace || !budget.Selector.Matches(labels.Set(r.Labels)) {
+				continue
+			}
+			if r.Disruption.Budget == "" || budget.Allowed < r.Disruption.Allowed {
+				r.Disruption = &metrics.Disruption{Budget: budget.Name, Allowed: budget.Allowed}
+			}
+		}
+	}
+}
+
+// suggestMemory scales usedMi by headroom, rounded up to whole Mi.
+func suggestMemory(usedMi, headroom float64) float64 {
+	return max(math.Ceil(usedMi*headroom), minSuggestedMemoryMi)
+}
+
+// suggestCPU scales usedMc by headroom, rounded up to whole millicores.
+func suggestCPU(usedMc int64, headroom float64) int64 {
+	return max(int64(math.Ceil(float64(usedMc)*headroom)), minSuggestedCPUMc)
+}
@@ -0,0 +1,81 @@
+// Package analyzer - usage over repeated collections
+package analyzer
+
+import (
+	"math"
+	"sort"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// MergeSamples merges the rows of repeated collections into one row per pod
+// or container, in the order they were first found. A merged row reports its
+// mean usage and the percentage of the limit it makes, and summarizes the
+// usage sampled in Row.Samples; its other fields are those of the latest
+// collection it was found in. Rows are matched by cluster, namespace and name.
+func (a *Analyzer) MergeSamples(samples [][]metrics.Row) []metrics.Row {
+	var (
+		order  []string
+		latest = make(map[string]metrics.Row)
+		usage  = make(map[string][]float64)
+	)
+	for _, rows := range samples {
+		for _, row := range rows {
+			key := row.Cluster + "/" + row.Namespace + "/" + row.Name
+			if _, exists := latest[key]; !exists {
+				order = append(order, key)
+			}
+			latest[key] = row
+			usage[key] = append(usage[key], sampledUsage(row))
+		}
+	}
+
+	result := make([]metrics.Row, 0, len(order))
+	for _, key := range order {
+		row := latest[key]
+		stats := sampleStats(usage[key])
+		switch row.Resource {
+		case config.ResourceCPU:
+			row.UsageMc = int64(math.Round(stats.Avg))
+			if row.LimitMc > 0 {
+				row.Percentage = stats.Avg / float64(row.LimitMc) * 100
+			}
+		default:
+			row.UsageMi = stats.Avg
+			row.UsageBytes = metrics.MiToBytes(stats.Avg)
+			if row.LimitMi > 0 {
+				row.Percentage = stats.Avg / row.LimitMi * 100
+			}
+		}
+		row.Samples = stats
+		result = append(result, row)
+	}
+	return result
+}
+
+// sampledUsage returns the usage of row in the units of its resource.
+func sampledUsage(row metrics.Row) float64 {
+	if row.Resource == config.ResourceCPU {
+		return float64(row.UsageMc)
+	}
+	return row.UsageMi
+}
+
+// sampleStats summarizes usage; p95 uses the nearest-rank method.
+func sampleStats(usage []float64) *metrics.SampleStats {
+	sort.Float64s(usage)
+	var sum float64
+	for _, u := range usage {
+		sum += u
+	}
+	n := len(usage)
+	rank := int(math.Ceil(0.95*float64(n))) - 1
+	return &metrics.SampleStats{
+		Count: n,
+		Min:   usage[0],
+		Avg:   sum / float64(n),
+		P95:   usage[rank],
+		Max:   usage[n-1],
+	}
+}
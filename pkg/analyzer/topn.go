@@ -0,0 +1,73 @@
+// Package analyzer - bounded top-N selection of streamed rows
+package analyzer
+
+import (
+	"container/heap"
+	"slices"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// TopN keeps the opts.TopN highest ranked rows pushed to it, in the order
+// Sort would produce, holding at most TopN rows at any time. It lets rows be
+// streamed from the collector without materializing the full result set.
+type TopN struct {
+	rows rowHeap
+}
+
+// NewTopN returns an empty TopN ranking rows by opts.Sort.
+func (a *Analyzer) NewTopN(opts config.Options) *TopN {
+	return &TopN{rows: rowHeap{analyzer: a, opts: opts}}
+}
+
+// Push offers a row, replacing the lowest ranked row kept once TopN rows are held.
+func (t *TopN) Push(row metrics.Row) {
+	if t.rows.opts.TopN <= 0 {
+		return
+	}
+	if len(t.rows.items) < t.rows.opts.TopN {
+		heap.Push(&t.rows, row)
+		return
+	}
+	if t.rows.analyzer.compareRows(row, t.rows.items[0], t.rows.opts) {
+		t.rows.items[0] = row
+		heap.Fix(&t.rows, 0)
+	}
+}
+
+// Len returns the number of rows kept.
+func (t *TopN) Len() int {
+	return len(t.rows.items)
+}
+
+// Rows returns the kept rows, highest ranked first.
+func (t *TopN) Rows() []metrics.Row {
+	rows := slices.Clone(t.rows.items)
+	t.rows.analyzer.Sort(rows, t.rows.opts)
+	return rows
+}
+
+// rowHeap is a min-heap with the lowest ranked row at the root, so it is the
+// one evicted when a higher ranked row arrives.
+type rowHeap struct {
+	analyzer *Analyzer
+	opts     config.Options
+	items    []metrics.Row
+}
+
+func (h *rowHeap) Len() int { return len(h.items) }
+
+func (h *rowHeap) Less(i, j int) bool {
+	return h.analyzer.compareRows(h.items[j], h.items[i], h.opts)
+}
+
+func (h *rowHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *rowHeap) Push(x any) { h.items = append(h.items, x.(metrics.Row)) }
+
+func (h *rowHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
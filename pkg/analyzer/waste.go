@@ -0,0 +1,76 @@
+// Package analyzer - unused reserved resources
+package analyzer
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// Waste sums the reserved and unused resources of every pod and namespace
+// from container rows of both resources. Reservations are the requests or,
+// with config.WasteBasisLimits, the limits of the containers; containers
+// without one reserve nothing. Pods and namespaces are ranked by the unused
+// amount of opts.Resource, highest first, and the top opts.TopN pods kept;
+// namespace totals and the TOTAL entry cover every pod.
+func (a *Analyzer) Waste(rows []metrics.Row, opts config.Options) metrics.WasteReport {
+	var (
+		pods       []metrics.Waste
+		podIndex   = make(map[string]int)
+		namespaces = make(map[string]*metrics.Waste)
+	)
+	for _, row := range rows {
+		pod, _, _ := strings.Cut(row.Name, ":")
+		reservedMi, reservedMc := row.RequestMi, row.RequestMc
+		if opts.WasteBasis == config.WasteBasisLimits {
+			reservedMi, reservedMc = row.LimitMi, row.LimitMc
+		}
+		container := metrics.Waste{
+			ReservedMi: reservedMi,
+			UsedMi:     row.UsageMi,
+			UnusedMi:   max(reservedMi-row.UsageMi, 0),
+			ReservedMc: reservedMc,
+			UsedMc:     row.UsageMc,
+			UnusedMc:   max(reservedMc-row.UsageMc, 0),
+		}
+
+		key := row.Cluster + "/" + row.Namespace + "/" + pod
+		i, exists := podIndex[key]
+		if !exists {
+			i = len(pods)
+			podIndex[key] = i
+			pods = append(pods, metrics.Waste{Namespace: row.Namespace, Name: pod, Pods: 1})
+			if namespaces[row.Namespace] == nil {
+				namespaces[row.Namespace] = &metrics.Waste{Namespace: row.Namespace}
+			}
+			namespaces[row.Namespace].Pods++
+		}
+		pods[i].Add(container)
+		namespaces[row.Namespace].Add(container)
+	}
+
+	report := metrics.WasteReport{Total: metrics.Waste{Namespace: "TOTAL"}}
+	for _, namespace := range namespaces {
+		report.Namespaces = append(report.Namespaces, *namespace)
+		report.Total.Add(*namespace)
+	}
+
+	rank := func(left, right metrics.Waste) int {
+		unused := cmp.Compare(right.UnusedMi, left.UnusedMi)
+		if opts.Resource == config.ResourceCPU {
+			unused = cmp.Compare(right.UnusedMc, left.UnusedMc)
+		}
+		return cmp.Or(unused, cmp.Compare(left.Namespace, right.Namespace), cmp.Compare(left.Name, right.Name))
+	}
+	slices.SortFunc(pods, rank)
+	slices.SortFunc(report.Namespaces, rank)
+
+	if opts.TopN > 0 && opts.TopN < len(pods) {
+		pods = pods[:opts.TopN]
+	}
+	report.Pods = pods
+	return report
+}
@@ -0,0 +1,51 @@
+// Package analyzer - differences between the refreshes of watch mode
+package analyzer
+
+import (
+	"math"
+
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// Diff returns the refresh listing rows, marking the rows that entered since
+// the previous refresh and those whose percentage moved by at least delta
+// percentage points, and collecting the previous rows no longer listed. Rows
+// are matched by namespace and name. Without a previous refresh no row is
+// marked.
+func (a *Analyzer) Diff(previous *metrics.Refresh, rows []metrics.Row, delta float64) metrics.Refresh {
+	refresh := metrics.Refresh{Rows: rows, Changes: make([]metrics.RowChange, len(rows))}
+	if previous == nil {
+		return refresh
+	}
+
+	before := make(map[string]metrics.Row, len(previous.Rows))
+	for _, row := range previous.Rows {
+		before[refreshKey(row)] = row
+	}
+
+	listed := make(map[string]bool, len(rows))
+	for i, row := range rows {
+		key := refreshKey(row)
+		listed[key] = true
+		last, ok := before[key]
+		switch {
+		case !ok:
+			refresh.Changes[i].Entered = true
+		case math.Abs(row.Percentage-last.Percentage) >= delta:
+			refresh.Changes[i].Delta = row.Percentage - last.Percentage
+		}
+	}
+
+	for _, row := range previous.Rows {
+		if !listed[refreshKey(row)] {
+			refresh.Gone = append(refresh.Gone, row)
+		}
+	}
+
+	return refresh
+}
+
+// refreshKey identifies a row across refreshes.
+func refreshKey(row metrics.Row) string {
+	return row.Namespace + "/" + row.Name
+}
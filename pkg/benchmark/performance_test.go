@@ -129,13 +129,10 @@ func GenerateMockMetrics(pods []corev1.Pod) []metrics.PodMetrics {
 		}
 
 		for _, container := range pod.Spec.Containers {
-			cm := metrics.ContainerMetrics{
-				Name: container.Name,
-				Usage: corev1.ResourceList{
-					corev1.ResourceMemory: resource.MustParse("256Mi"), // 50% of limit
-					corev1.ResourceCPU:    resource.MustParse("250m"),  // 50% of limit
-				},
-			}
+			cm := metrics.NewContainerMetrics(container.Name, corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("256Mi"), // 50% of limit
+				corev1.ResourceCPU:    resource.MustParse("250m"),  // 50% of limit
+			})
 			pm.Containers = append(pm.Containers, cm)
 		}
 
@@ -245,9 +242,7 @@ func benchmarkProcessingThroughput(b *testing.B, config BenchmarkConfig) {
 				if podInfo.HasMemoryLimit() {
 					var totalUsageMi float64
 					for _, container := range pm.Containers {
-						if qty, ok := container.Usage[corev1.ResourceMemory]; ok {
-							totalUsageMi += float64(qty.Value()) / (1024 * 1024)
-						}
+						totalUsageMi += float64(container.MemoryBytes) / (1024 * 1024)
 					}
 
 					percentage := (totalUsageMi / podInfo.MemoryLimitMi) * 100
@@ -0,0 +1,181 @@
+// Package bundle produces diagnostic bundles that capture everything needed to
+// reproduce a performance or correctness problem on a cluster we can't access:
+// sanitized options, timing metrics, runtime profiles and, optionally, the raw
+// API responses the collector received.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Bundle accumulates diagnostic files and writes them as a gzipped tarball.
+// It is safe for concurrent use.
+type Bundle struct {
+	path     string
+	created  time.Time
+	recorder *Recorder
+
+	mutex     sync.Mutex
+	files     map[string][]byte
+	cpu       bytes.Buffer
+	profiling bool
+}
+
+// New creates a bundle that will be written to path.
+func New(path string) *Bundle {
+	return &Bundle{
+		path:    path,
+		created: time.Now(),
+		files:   make(map[string][]byte),
+	}
+}
+
+// RecordResponses enables recording of raw API responses and returns the
+// recorder whose Wrap method must be installed on the API client transport.
+func (b *Bundle) RecordResponses() (*Recorder, error) {
+	recorder, err := NewRecorder()
+	if err != nil {
+		return nil, err
+	}
+	b.recorder = recorder
+	return recorder, nil
+}
+
+// Recorder returns the response recorder, or nil when responses are not captured.
+func (b *Bundle) Recorder() *Recorder {
+	return b.recorder
+}
+
+// Start begins CPU profiling for the duration of the run.
+func (b *Bundle) Start() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if err := pprof.StartCPUProfile(&b.cpu); err != nil {
+		return fmt.Errorf("failed to start cpu profile: %w", err)
+	}
+	b.profiling = true
+	return nil
+}
+
+// AddJSON adds v to the bundle as an indented JSON file.
+func (b *Bundle) AddJSON(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	b.Add(name, append(data, '\n'))
+	return nil
+}
+
+// Add adds a file with the given content to the bundle, replacing any previous content.
+func (b *Bundle) Add(name string, data []byte) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.files[name] = data
+}
+
+// Write stops profiling, captures heap and goroutine profiles and writes the
+// bundle to its path. Recorded responses are included and their spool removed.
+func (b *Bundle) Write() error {
+	b.mutex.Lock()
+	if b.profiling {
+		pprof.StopCPUProfile()
+		b.profiling = false
+		b.files["profiles/cpu.pprof"] = b.cpu.Bytes()
+	}
+	b.mutex.Unlock()
+
+	for _, name := range []string{"heap", "goroutine", "allocs"} {
+		var buf bytes.Buffer
+		if profile := pprof.Lookup(name); profile != nil {
+			if err := profile.WriteTo(&buf, 0); err != nil {
+				return fmt.Errorf("failed to capture %s profile: %w", name, err)
+			}
+			b.Add("profiles/"+name+".pprof", buf.Bytes())
+		}
+	}
+
+	if err := b.AddJSON("runtime.json", map[string]any{
+		"created":    b.created.UTC(),
+		"duration":   time.Since(b.created).String(),
+		"go_version": runtime.Version(),
+		"os":         runtime.GOOS,
+		"arch":       runtime.GOARCH,
+		"num_cpu":    runtime.NumCPU(),
+	}); err != nil {
+		return err
+	}
+
+	file, err := os.Create(filepath.Clean(b.path))
+	if err != nil {
+		return fmt.Errorf("failed to create bundle %s: %w", b.path, err)
+	}
+	defer file.Close()
+
+	if err := b.writeArchive(file); err != nil {
+		return fmt.Errorf("failed to write bundle %s: %w", b.path, err)
+	}
+	return file.Close()
+}
+
+// writeArchive writes all files and recorded responses as a gzipped tarball.
+func (b *Bundle) writeArchive(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	b.mutex.Lock()
+	names := make([]string, 0, len(b.files))
+	for name := range b.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := writeEntry(tw, name, b.files[name], b.created); err != nil {
+			b.mutex.Unlock()
+			return err
+		}
+	}
+	b.mutex.Unlock()
+
+	if b.recorder != nil {
+		if err := b.recorder.archive(tw, b.created); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeEntry writes a single regular file to the archive.
+func writeEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s header: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readArchive returns the contents of every file in a gzipped tarball.
+func readArchive(t *testing.T, path string) map[string]string {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open bundle: %v", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("failed to read gzip: %v", err)
+	}
+
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read tar: %v", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", header.Name, err)
+		}
+		files[header.Name] = string(data)
+	}
+	return files
+}
+
+func TestBundle_Write(t *testing.T) {
+	const podList = `{"kind":"PodList","items":[{"metadata":{"name":"api","annotations":{
+		"kubectl.kubernetes.io/last-applied-configuration":"{\"secret\":\"s3cr3t\"}","team":"payments"}},
+		"spec":{"containers":[{"name":"api","env":[{"name":"TOKEN","value":"s3cr3t"},
+		{"name":"FROM_SECRET","valueFrom":{"secretKeyRef":{"name":"creds","key":"token"}}}]}]}}]}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, podList)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	b := New(path)
+
+	recorder, err := b.RecordResponses()
+	if err != nil {
+		t.Fatalf("failed to enable recording: %v", err)
+	}
+	if err := b.Start(); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+
+	client := &http.Client{Transport: recorder.Wrap(http.DefaultTransport)}
+	resp, err := client.Get(server.URL + "/api/v1/pods?limit=500")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != podList {
+		t.Error("caller must receive the unmodified response body")
+	}
+
+	if err := b.AddJSON("options.json", map[string]string{"mode": "pods"}); err != nil {
+		t.Fatalf("failed to add options: %v", err)
+	}
+	if err := b.Write(); err != nil {
+		t.Fatalf("failed to write bundle: %v", err)
+	}
+
+	files := readArchive(t, path)
+	for _, name := range []string{
+		"options.json", "runtime.json", "profiles/cpu.pprof", "profiles/heap.pprof",
+		"profiles/goroutine.pprof", "responses/index.json", "responses/0001-pods.json",
+	} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected %s in bundle", name)
+		}
+	}
+
+	response := files["responses/0001-pods.json"]
+	if strings.Contains(response, "s3cr3t") {
+		t.Error("expected env values and last-applied annotation to be redacted")
+	}
+	if !strings.Contains(response, "secretKeyRef") || !strings.Contains(response, `"team": "payments"`) {
+		t.Error("expected non-sensitive fields to be preserved")
+	}
+	if strings.Contains(files["responses/index.json"], server.Listener.Addr().String()) {
+		t.Error("expected server address to be omitted from the index")
+	}
+	if !strings.Contains(files["responses/index.json"], "/api/v1/pods?limit=500") {
+		t.Error("expected request path and query in the index")
+	}
+
+	if _, err := os.Stat(recorder.dir); !os.IsNotExist(err) {
+		t.Error("expected response spool to be removed")
+	}
+}
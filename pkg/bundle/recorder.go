@@ -0,0 +1,199 @@
+// Package bundle - recording of raw API responses
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// redacted replaces values that may contain secrets
+	redacted = "REDACTED"
+	// lastAppliedAnnotation holds a full copy of the applied manifest, including env values
+	lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+// Entry describes a single recorded API response.
+type Entry struct {
+	File     string `json:"file,omitempty"`
+	Method   string `json:"method"`
+	URL      string `json:"url"`
+	Status   int    `json:"status,omitempty"`
+	Bytes    int    `json:"bytes"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Recorder captures raw API responses for inclusion in a bundle. Responses are
+// spooled to a temporary directory rather than held in memory, and environment
+// variable values and last-applied annotations are redacted before writing.
+type Recorder struct {
+	dir string
+
+	mutex   sync.Mutex
+	entries []Entry
+}
+
+// NewRecorder creates a recorder with its own spool directory.
+func NewRecorder() (*Recorder, error) {
+	dir, err := os.MkdirTemp("", "kusage-bundle-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create response spool: %w", err)
+	}
+	return &Recorder{dir: dir}, nil
+}
+
+// Wrap returns a transport that records every response passing through rt.
+func (r *Recorder) Wrap(rt http.RoundTripper) http.RoundTripper {
+	return &recordingTransport{next: rt, recorder: r}
+}
+
+// Entries returns the recorded responses in order.
+func (r *Recorder) Entries() []Entry {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Entry(nil), r.entries...)
+}
+
+// Close removes the spool directory.
+func (r *Recorder) Close() error {
+	return os.RemoveAll(r.dir)
+}
+
+// record stores a response body and appends its entry to the index.
+func (r *Recorder) record(entry Entry, body []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if body != nil {
+		resourcePath, _, _ := strings.Cut(entry.URL, "?")
+		entry.File = fmt.Sprintf("responses/%04d-%s.json", len(r.entries)+1, path.Base(resourcePath))
+		if err := os.WriteFile(filepath.Join(r.dir, filepath.Base(entry.File)), redact(body), 0o600); err != nil {
+			entry.File = ""
+			entry.Error = fmt.Sprintf("failed to spool response: %v", err)
+		}
+	}
+	r.entries = append(r.entries, entry)
+}
+
+// archive writes the response index and spooled responses to the archive and removes the spool.
+func (r *Recorder) archive(tw *tar.Writer, modTime time.Time) error {
+	defer r.Close()
+
+	index, err := json.MarshalIndent(r.Entries(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode response index: %w", err)
+	}
+	if err := writeEntry(tw, "responses/index.json", append(index, '\n'), modTime); err != nil {
+		return err
+	}
+
+	for _, entry := range r.Entries() {
+		if entry.File == "" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(r.dir, filepath.Base(entry.File)))
+		if err != nil {
+			return fmt.Errorf("failed to read spooled response %s: %w", entry.File, err)
+		}
+		if err := writeEntry(tw, entry.File, data, modTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordingTransport records responses of the wrapped transport.
+type recordingTransport struct {
+	next     http.RoundTripper
+	recorder *Recorder
+}
+
+// RoundTrip performs the request and records the response. The response body is
+// read in full and replaced, so the caller sees the same content. Only the path
+// and query are recorded to avoid capturing the cluster address.
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	entry := Entry{Method: req.Method, URL: req.URL.RequestURI()}
+
+	resp, err := t.next.RoundTrip(req)
+	entry.Duration = time.Since(start).String()
+	if err != nil {
+		entry.Error = err.Error()
+		t.recorder.record(entry, nil)
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry.Status = resp.StatusCode
+	entry.Bytes = len(body)
+	t.recorder.record(entry, body)
+
+	return resp, nil
+}
+
+// redact removes environment variable values and last-applied annotations from
+// a JSON document. Documents that are not JSON are returned unchanged.
+func redact(data []byte) []byte {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return data
+	}
+
+	redactValue(doc)
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+// redactValue walks a decoded JSON value and redacts sensitive fields in place.
+func redactValue(v any) {
+	switch value := v.(type) {
+	case map[string]any:
+		for key, child := range value {
+			switch key {
+			case "env":
+				if vars, ok := child.([]any); ok {
+					for _, item := range vars {
+						if envVar, ok := item.(map[string]any); ok {
+							if _, ok := envVar["value"]; ok {
+								envVar["value"] = redacted
+							}
+						}
+					}
+				}
+			case "annotations":
+				if annotations, ok := child.(map[string]any); ok {
+					if _, ok := annotations[lastAppliedAnnotation]; ok {
+						annotations[lastAppliedAnnotation] = redacted
+					}
+				}
+			}
+			redactValue(child)
+		}
+	case []any:
+		for _, item := range value {
+			redactValue(item)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+// Package cadvisor reads pod usage by scraping the kubelet cAdvisor endpoint of
+// every node through the API server node proxy, for clusters with neither a
+// metrics-server nor Prometheus. It requires get on the nodes/proxy resource.
+// CPU usage is a counter, so every node is scraped twice and the rate between
+// the two scrapes is reported.
+package cadvisor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"golang.org/x/sync/errgroup"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+const (
+	// DefaultInterval is the time between the two scrapes of a node; the kubelet
+	// refreshes cAdvisor stats every 10-15s so shorter intervals yield no rate
+	DefaultInterval = 15 * time.Second
+	// maxConcurrentNodes bounds the number of nodes scraped at once
+	maxConcurrentNodes = 10
+
+	memoryMetric    = "container_memory_working_set_bytes"
+	cpuMetric       = "container_cpu_usage_seconds_total"
+	periodsMetric   = "container_cpu_cfs_periods_total"
+	throttledMetric = "container_cpu_cfs_throttled_periods_total"
+)
+
+// Source scrapes pod usage from the cAdvisor endpoint of every node.
+// It satisfies collector.MetricsSource.
+type Source struct {
+	client   kubernetes.Interface
+	interval time.Duration
+	scrape   func(ctx context.Context, node string) ([]byte, error)
+	sleep    func(ctx context.Context, d time.Duration) error
+	now      func() time.Time
+}
+
+// New creates a usage source listing and proxying to nodes with client.
+func New(client kubernetes.Interface) *Source {
+	s := &Source{
+		client:   client,
+		interval: DefaultInterval,
+		sleep:    sleep,
+		now:      time.Now,
+	}
+	s.scrape = s.proxy
+	return s
+}
+
+// WithInterval sets the time between the two scrapes CPU rates are computed over.
+func (s *Source) WithInterval(interval time.Duration) *Source {
+	s.interval = interval
+	return s
+}
+
+// Plan returns the requests PodMetrics issues, for dry runs: the node list
+// and two scrapes of every node.
+func (s *Source) Plan(_ config.Options) []metrics.PlannedRequest {
+	return []metrics.PlannedRequest{
+		{Server: "kubernetes", Method: "GET", Path: "/api/v1/nodes", Requests: 1},
+		{Server: "kubernetes", Method: "GET", Path: "/api/v1/nodes/{node}/proxy/metrics/cadvisor", Requests: 2, Per: "node"},
+	}
+}
+
+// containerKey identifies a container by namespace, pod and name
+type containerKey struct {
+	namespace, pod, container string
+}
+
+// sample is the usage of a container in a single scrape
+type sample struct {
+	memory float64
+	cpu    float64
+	// periods and throttled are the CFS period counters, exported for containers with a CPU limit
+	periods   float64
+	throttled float64
+	// at is the time the CPU counter was read, from the sample timestamp when exported
+	at time.Time
+}
+
+// PodMetrics returns the usage of every container of the target namespace, or
+// of all namespaces with opts.AllNamespaces: the working set from the second
+// scrape, and the CPU rate and CFS periods throttled between both scrapes.
+// Nodes that cannot be scraped are skipped with a warning. Pods are ordered by
+// namespace and name.
+func (s *Source) PodMetrics(ctx context.Context, opts config.Options) ([]metrics.PodMetrics, error) {
+	namespace := opts.Namespace
+	if opts.AllNamespaces {
+		namespace = ""
+	}
+
+	nodes, err := s.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	if len(nodes.Items) == 0 {
+		return nil, errors.New("no nodes found")
+	}
+
+	// Scrape every node twice, all nodes between the same pair of sleeps so the
+	// total duration does not grow with the number of nodes
+	names := make([]string, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		names = append(names, node.Name)
+	}
+	first := s.scrapeNodes(ctx, names, namespace)
+	if err := s.sleep(ctx, s.interval); err != nil {
+		return nil, err
+	}
+	second := s.scrapeNodes(ctx, names, namespace)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(second) == 0 {
+		return nil, fmt.Errorf("failed to scrape cadvisor on all %d nodes (requires get on nodes/proxy)", len(names))
+	}
+
+	usage := make(map[containerKey]sample)
+	for _, name := range names {
+		before, ok := first[name]
+		if !ok {
+			continue
+		}
+		for key, last := range second[name] {
+			prev, ok := before[key]
+			if elapsed := last.at.Sub(prev.at).Seconds(); ok && elapsed > 0 && last.cpu >= prev.cpu {
+				last.cpu = (last.cpu - prev.cpu) / elapsed
+			} else {
+				// Containers started between scrapes, or restarted, have no rate yet
+				last.cpu = 0
+			}
+			if ok && last.periods >= prev.periods && last.throttled >= prev.throttled {
+				last.periods -= prev.periods
+				last.throttled -= prev.throttled
+			} else {
+				last.periods, last.throttled = 0, 0
+			}
+			usage[key] = last
+		}
+	}
+	now := s.now()
+	pods := make(map[string]*metrics.PodMetrics)
+	keys := make([]containerKey, 0, len(usage))
+	for key := range usage {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].container < keys[j].container })
+	for _, key := range keys {
+		podKey := key.namespace + "/" + key.pod
+		pod, ok := pods[podKey]
+		if !ok {
+			pod = &metrics.PodMetrics{
+				ObjectMeta: metav1.ObjectMeta{Namespace: key.namespace, Name: key.pod},
+				Timestamp:  metav1.NewTime(now),
+				Window:     metav1.Duration{Duration: s.interval},
+			}
+			pods[podKey] = pod
+		}
+		u := usage[key]
+		pod.Containers = append(pod.Containers, metrics.ContainerMetrics{
+			Name:                key.container,
+			MemoryBytes:         int64(u.memory),
+			CPUMillicores:       int64(math.Round(u.cpu * 1000)),
+			CPUPeriods:          int64(u.periods),
+			CPUThrottledPeriods: int64(u.throttled),
+		})
+	}
+
+	result := make([]metrics.PodMetrics, 0, len(pods))
+	for _, pm := range pods {
+		result = append(result, *pm)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// scrapeNodes scrapes every node concurrently, returning the usage by node
+// name. Nodes that cannot be scraped are logged and omitted.
+func (s *Source) scrapeNodes(ctx context.Context, names []string, namespace string) map[string]map[containerKey]sample {
+	var mutex sync.Mutex
+	result := make(map[string]map[containerKey]sample, len(names))
+
+	var g errgroup.Group
+	g.SetLimit(maxConcurrentNodes)
+	for _, name := range names {
+		g.Go(func() error {
+			usage, err := s.scrapeNode(ctx, name, namespace)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("skipping node, failed to scrape cadvisor", "node", name, "error", err)
+				}
+				return nil
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			result[name] = usage
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	return result
+}
+
+// scrapeNode reads the container usage of a node, limited to namespace when set.
+func (s *Source) scrapeNode(ctx context.Context, node, namespace string) (map[containerKey]sample, error) {
+	scrapedAt := s.now()
+	data, err := s.scrape(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cadvisor metrics of node %s: %w", node, err)
+	}
+
+	usage := make(map[containerKey]sample)
+	each := func(name string, apply func(entry *sample, value float64, m *dto.Metric)) {
+		family, ok := families[name]
+		if !ok {
+			return
+		}
+		for _, m := range family.GetMetric() {
+			key, ok := keyOf(m, namespace)
+			if !ok {
+				continue
+			}
+			entry := usage[key]
+			apply(&entry, value(m), m)
+			usage[key] = entry
+		}
+	}
+
+	each(memoryMetric, func(entry *sample, v float64, _ *dto.Metric) {
+		entry.memory = max(entry.memory, v)
+	})
+	each(cpuMetric, func(entry *sample, v float64, m *dto.Metric) {
+		entry.cpu = v
+		entry.at = scrapedAt
+		if m.TimestampMs != nil {
+			entry.at = time.UnixMilli(m.GetTimestampMs())
+		}
+	})
+	each(periodsMetric, func(entry *sample, v float64, _ *dto.Metric) {
+		entry.periods = v
+	})
+	each(throttledMetric, func(entry *sample, v float64, _ *dto.Metric) {
+		entry.throttled = v
+	})
+
+	return usage, nil
+}
+
+// keyOf returns the container a series belongs to, skipping pod and node
+// level cgroups, pause containers and series outside namespace.
+func keyOf(m *dto.Metric, namespace string) (containerKey, bool) {
+	var key containerKey
+	for _, label := range m.GetLabel() {
+		switch label.GetName() {
+		case "namespace":
+			key.namespace = label.GetValue()
+		case "pod":
+			key.pod = label.GetValue()
+		case "container":
+			key.container = label.GetValue()
+		}
+	}
+	if key.namespace == "" || key.pod == "" || metrics.IsInfrastructureContainer(key.container) {
+		return key, false
+	}
+	if namespace != "" && key.namespace != namespace {
+		return key, false
+	}
+	return key, true
+}
+
+// value returns the value of a gauge, counter or untyped sample.
+func value(m *dto.Metric) float64 {
+	switch {
+	case m.Gauge != nil:
+		return m.GetGauge().GetValue()
+	case m.Counter != nil:
+		return m.GetCounter().GetValue()
+	default:
+		return m.GetUntyped().GetValue()
+	}
+}
+
+// proxy reads /metrics/cadvisor of node through the API server node proxy.
+func (s *Source) proxy(ctx context.Context, node string) ([]byte, error) {
+	data, err := s.client.CoreV1().RESTClient().Get().
+		AbsPath("/api/v1/nodes", node, "proxy", "metrics", "cadvisor").
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrape cadvisor of node %s: %w", node, err)
+	}
+	return data, nil
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
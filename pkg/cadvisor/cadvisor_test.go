@@ -0,0 +1,110 @@
+package cadvisor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/mchmarny/kusage/pkg/config"
+)
+
+// scrapes are the two cAdvisor scrapes of node-a, 15s apart
+var scrapes = []string{
+	`# TYPE container_cpu_usage_seconds_total counter
+container_cpu_usage_seconds_total{container="app",namespace="web",pod="api-a"} 100 1700000000000
+container_cpu_usage_seconds_total{container="proxy",namespace="web",pod="api-a"} 50 1700000000000
+container_cpu_usage_seconds_total{container="",namespace="web",pod="api-a"} 150 1700000000000
+container_cpu_usage_seconds_total{container="app",namespace="other",pod="db-0"} 10 1700000000000
+# TYPE container_cpu_cfs_periods_total counter
+container_cpu_cfs_periods_total{container="app",namespace="web",pod="api-a"} 1000
+# TYPE container_cpu_cfs_throttled_periods_total counter
+container_cpu_cfs_throttled_periods_total{container="app",namespace="web",pod="api-a"} 100
+# TYPE container_memory_working_set_bytes gauge
+container_memory_working_set_bytes{container="app",namespace="web",pod="api-a"} 1000 1700000000000
+`,
+	`# TYPE container_cpu_usage_seconds_total counter
+container_cpu_usage_seconds_total{container="app",namespace="web",pod="api-a"} 103 1700000015000
+container_cpu_usage_seconds_total{container="proxy",namespace="web",pod="api-a"} 2 1700000015000
+container_cpu_usage_seconds_total{container="POD",namespace="web",pod="api-a"} 1 1700000015000
+container_cpu_usage_seconds_total{container="app",namespace="other",pod="db-0"} 20 1700000015000
+# TYPE container_cpu_cfs_periods_total counter
+container_cpu_cfs_periods_total{container="app",namespace="web",pod="api-a"} 1150
+# TYPE container_cpu_cfs_throttled_periods_total counter
+container_cpu_cfs_throttled_periods_total{container="app",namespace="web",pod="api-a"} 130
+# TYPE container_memory_working_set_bytes gauge
+container_memory_working_set_bytes{container="app",namespace="web",pod="api-a"} 2000 1700000015000
+container_memory_working_set_bytes{container="proxy",namespace="web",pod="api-a"} 300 1700000015000
+container_memory_working_set_bytes{container="app",namespace="web",pod="api-b"} 400 1700000015000
+`,
+}
+
+// newTestSource returns a source over the given nodes; node-a answers with
+// scrapes and every other node fails.
+func newTestSource(nodes ...string) *Source {
+	client := fake.NewClientset()
+	for _, name := range nodes {
+		_, _ = client.CoreV1().Nodes().Create(context.Background(), &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}, metav1.CreateOptions{})
+	}
+
+	var mutex sync.Mutex
+	calls := 0
+	source := New(client)
+	source.sleep = func(context.Context, time.Duration) error { return nil }
+	source.scrape = func(_ context.Context, node string) ([]byte, error) {
+		if node != "node-a" {
+			return nil, errors.New("forbidden")
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		data := scrapes[calls]
+		calls++
+		return []byte(data), nil
+	}
+	return source
+}
+
+func TestSource_PodMetrics(t *testing.T) {
+	source := newTestSource("node-a", "node-b")
+
+	pods, err := source.PodMetrics(context.Background(), config.Options{Namespace: "web"})
+	if err != nil {
+		t.Fatalf("PodMetrics failed: %v", err)
+	}
+
+	if len(pods) != 2 || pods[0].Name != "api-a" || pods[1].Name != "api-b" {
+		t.Fatalf("unexpected pods %+v", pods)
+	}
+	if pods[0].Window.Duration != DefaultInterval {
+		t.Errorf("expected window %v, got %v", DefaultInterval, pods[0].Window.Duration)
+	}
+
+	api := pods[0].Containers
+	if len(api) != 2 || api[0].Name != "app" || api[1].Name != "proxy" {
+		t.Fatalf("unexpected containers %+v", api)
+	}
+	if api[0].MemoryBytes != 2000 || api[0].CPUMillicores != 200 || api[0].CPUPeriods != 150 || api[0].CPUThrottledPeriods != 30 {
+		t.Errorf("unexpected app usage %+v", api[0])
+	}
+	// The proxy counter reset between scrapes, so it has no rate yet
+	if api[1].MemoryBytes != 300 || api[1].CPUMillicores != 0 {
+		t.Errorf("unexpected proxy usage %+v", api[1])
+	}
+	if c := pods[1].Containers; len(c) != 1 || c[0].MemoryBytes != 400 || c[0].CPUMillicores != 0 {
+		t.Errorf("unexpected api-b usage %+v", c)
+	}
+}
+
+func TestSource_PodMetrics_AllNodesFail(t *testing.T) {
+	source := newTestSource("node-b", "node-c")
+
+	_, err := source.PodMetrics(context.Background(), config.Options{AllNamespaces: true})
+	if err == nil {
+		t.Fatal("expected error when no node can be scraped")
+	}
+}
@@ -0,0 +1,108 @@
+// Package capacity measures node-pool usage growth from Prometheus history so
+// pool headroom can be projected forward. Usage comes from cAdvisor series
+// carrying a node label (as scraped by kube-prometheus) and nodes are mapped to
+// pools through kube_node_labels, so the pool label must be exported by
+// kube-state-metrics (--metric-labels-allowlist=nodes=[...]).
+package capacity
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/mchmarny/kusage/pkg/collector"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/prometheus"
+)
+
+const (
+	// smoothing is the longest period usage is averaged over at each end of the
+	// growth window, so daily peaks do not dominate the trend
+	smoothing = 24 * time.Hour
+	// step is the subquery resolution used for averaging
+	step = 5 * time.Minute
+)
+
+// Estimator measures pool usage growth from a Prometheus-compatible backend.
+type Estimator struct {
+	querier prometheus.Querier
+	now     func() time.Time
+}
+
+// New creates a growth estimator using the provided querier.
+func New(querier prometheus.Querier) *Estimator {
+	return &Estimator{
+		querier: querier,
+		now:     time.Now,
+	}
+}
+
+// Growth returns the usage change per day of every pool of opts.PoolLabel,
+// in Mi for memory or millicores for CPU, measured between the average usage
+// now and opts.GrowthWindow ago. Pools without data at both ends are omitted.
+func (e *Estimator) Growth(ctx context.Context, opts config.Options) (map[string]float64, error) {
+	label := prometheus.LabelName(opts.PoolLabel)
+	query := PoolUsageQuery(opts.Resource, label, min(opts.GrowthWindow, smoothing))
+
+	now := e.now()
+	var current, past map[string]float64
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		usage, err := e.usage(ctx, query, label, now)
+		current = usage
+		return err
+	})
+	g.Go(func() error {
+		usage, err := e.usage(ctx, query, label, now.Add(-opts.GrowthWindow))
+		past = usage
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	days := opts.GrowthWindow.Hours() / 24
+	growth := make(map[string]float64, len(current))
+	for pool, usage := range current {
+		if before, ok := past[pool]; ok {
+			growth[pool] = (usage - before) / days
+		}
+	}
+
+	return growth, nil
+}
+
+// usage evaluates the pool usage query at ts and indexes the result by pool.
+func (e *Estimator) usage(ctx context.Context, query, label string, ts time.Time) (map[string]float64, error) {
+	samples, err := e.querier.Query(ctx, query, ts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pool usage history: %w", err)
+	}
+
+	usage := make(map[string]float64, len(samples))
+	for _, sample := range samples {
+		pool := sample.Labels[label]
+		if pool == "" {
+			pool = collector.UnpooledNodes
+		}
+		usage[pool] += sample.Value
+	}
+	return usage, nil
+}
+
+// PoolUsageQuery returns a query averaging the usage of resource over the
+// preceding period per value of the kube_node_labels label, in Mi for memory
+// or millicores for CPU.
+func PoolUsageQuery(resource config.ResourceKind, label string, period time.Duration) string {
+	perNode := `sum by (node) (container_memory_working_set_bytes{container!=""}) / 1048576`
+	if resource == config.ResourceCPU {
+		perNode = `sum by (node) (rate(container_cpu_usage_seconds_total{container!=""}[5m])) * 1000`
+	}
+
+	nodeLabels := fmt.Sprintf(`max by (node, %s) (kube_node_labels)`, label)
+	return fmt.Sprintf(`sum by (%s) (avg_over_time((%s * on (node) group_left (%s) %s)[%ds:%ds]))`,
+		label, perNode, label, nodeLabels, int64(period.Seconds()), int64(step.Seconds()))
+}
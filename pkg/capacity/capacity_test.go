@@ -0,0 +1,73 @@
+package capacity
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/collector"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/prometheus"
+)
+
+// fakeQuerier returns the samples recorded for the evaluation time
+type fakeQuerier struct {
+	samples map[time.Time][]prometheus.Sample
+	err     error
+}
+
+func (f *fakeQuerier) Query(_ context.Context, query string, ts time.Time) ([]prometheus.Sample, error) {
+	if !strings.Contains(query, "label_cloud_google_com_gke_nodepool") {
+		return nil, errors.New("query not grouped by pool label")
+	}
+	return f.samples[ts], f.err
+}
+
+// pool returns a sample for the pool label
+func pool(name string, value float64) prometheus.Sample {
+	return prometheus.Sample{Labels: map[string]string{"label_cloud_google_com_gke_nodepool": name}, Value: value}
+}
+
+func TestEstimator_Growth(t *testing.T) {
+	now := time.Date(2025, 9, 15, 12, 0, 0, 0, time.UTC)
+	week := 7 * 24 * time.Hour
+
+	querier := &fakeQuerier{samples: map[time.Time][]prometheus.Sample{
+		now:            {pool("pool-a", 8400), pool("pool-b", 3000), pool("", 700), pool("pool-new", 100)},
+		now.Add(-week): {pool("pool-a", 7000), pool("pool-b", 3350), pool("", 700)},
+	}}
+	estimator := New(querier)
+	estimator.now = func() time.Time { return now }
+
+	opts := config.Options{Resource: config.ResourceMemory, PoolLabel: "cloud.google.com/gke-nodepool", GrowthWindow: week}
+	growth, err := estimator.Growth(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Growth failed: %v", err)
+	}
+
+	expected := map[string]float64{"pool-a": 200, "pool-b": -50, collector.UnpooledNodes: 0}
+	if len(growth) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, growth)
+	}
+	for name, want := range expected {
+		if got, ok := growth[name]; !ok || got != want {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+
+	querier.err = errors.New("connection refused")
+	if _, err := estimator.Growth(context.Background(), opts); err == nil {
+		t.Fatal("expected query error")
+	}
+}
+
+func TestPoolUsageQuery(t *testing.T) {
+	got := PoolUsageQuery(config.ResourceCPU, "label_pool", 24*time.Hour)
+	want := `sum by (label_pool) (avg_over_time((sum by (node) (rate(container_cpu_usage_seconds_total{container!=""}[5m])) * 1000 ` +
+		`* on (node) group_left (label_pool) max by (node, label_pool) (kube_node_labels))[86400s:300s]))`
+	if got != want {
+		t.Errorf("PoolUsageQuery:\n got %s\nwant %s", got, want)
+	}
+}
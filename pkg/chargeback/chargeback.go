@@ -0,0 +1,172 @@
+// Package chargeback computes per-group consumed and reserved resource totals
+// over a period from Prometheus history, for internal billing. Usage comes from
+// cAdvisor (container_memory_working_set_bytes, container_cpu_usage_seconds_total),
+// reservations from kube-state-metrics (kube_pod_container_resource_requests),
+// and pods are attributed to groups through kube_pod_labels, so the grouping
+// label must be exported by kube-state-metrics (--metric-labels-allowlist).
+package chargeback
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/prometheus"
+)
+
+const (
+	// UnlabeledGroup is the group of pods without the grouping label
+	UnlabeledGroup = "<unlabeled>"
+
+	// minStep is the smallest subquery resolution used to integrate usage
+	minStep = time.Minute
+	// stepsPerPeriod is the number of subquery steps the period is divided into
+	stepsPerPeriod = 720
+	// bytesPerGiB converts bytes to GiB
+	bytesPerGiB = 1 << 30
+)
+
+// Collector computes chargeback reports from a Prometheus-compatible backend.
+type Collector struct {
+	querier prometheus.Querier
+	now     func() time.Time
+}
+
+// New creates a chargeback collector using the provided querier.
+func New(querier prometheus.Querier) *Collector {
+	return &Collector{
+		querier: querier,
+		now:     time.Now,
+	}
+}
+
+// series identifies one of the per-pod series integrated over the period
+type series struct {
+	// expr is a PromQL expression returning one series per namespace/pod
+	expr string
+	// scale converts the integrated value (unit-seconds) to the reported unit-hours
+	scale float64
+	// set stores the result on the line
+	set func(line *metrics.ChargebackLine, value float64)
+}
+
+// Collect returns one line per value of opts.GroupLabel, ordered by group name,
+// with usage and requests integrated over opts.Period ending now.
+func (c *Collector) Collect(ctx context.Context, opts config.Options) ([]metrics.ChargebackLine, error) {
+	// Restrict every series to the target namespace unless all are requested
+	namespace := ""
+	if !opts.AllNamespaces && opts.Namespace != "" {
+		namespace = "namespace=" + prometheus.QuoteValue(opts.Namespace)
+	}
+	selector := `container!="", pod!=""` + prefixComma(namespace)
+
+	all := []series{
+		{
+			expr:  fmt.Sprintf(`sum by (namespace, pod) (rate(container_cpu_usage_seconds_total{%s}[5m]))`, selector),
+			scale: 1,
+			set:   func(l *metrics.ChargebackLine, v float64) { l.CPUCoreHoursUsed = v },
+		},
+		{
+			expr:  fmt.Sprintf(`sum by (namespace, pod) (kube_pod_container_resource_requests{resource="cpu"%s})`, prefixComma(namespace)),
+			scale: 1,
+			set:   func(l *metrics.ChargebackLine, v float64) { l.CPUCoreHoursReserved = v },
+		},
+		{
+			expr:  fmt.Sprintf(`sum by (namespace, pod) (container_memory_working_set_bytes{%s})`, selector),
+			scale: 1.0 / bytesPerGiB,
+			set:   func(l *metrics.ChargebackLine, v float64) { l.MemoryGiBHoursUsed = v },
+		},
+		{
+			expr:  fmt.Sprintf(`sum by (namespace, pod) (kube_pod_container_resource_requests{resource="memory"%s})`, prefixComma(namespace)),
+			scale: 1.0 / bytesPerGiB,
+			set:   func(l *metrics.ChargebackLine, v float64) { l.MemoryGiBHoursReserved = v },
+		},
+	}
+
+	label := prometheus.LabelName(opts.GroupLabel)
+	step := Step(opts.Period)
+	ts := c.now()
+
+	var (
+		mutex sync.Mutex
+		lines = make(map[string]*metrics.ChargebackLine)
+	)
+
+	g, ctx := errgroup.WithContext(ctx)
+	for _, s := range all {
+		g.Go(func() error {
+			query := IntegrateQuery(s.expr, label, namespace, opts.Period, step)
+			samples, err := c.querier.Query(ctx, query, ts)
+			if err != nil {
+				return fmt.Errorf("failed to query chargeback totals: %w", err)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, sample := range samples {
+				group := sample.Labels[label]
+				if group == "" {
+					group = UnlabeledGroup
+				}
+				line, ok := lines[group]
+				if !ok {
+					line = &metrics.ChargebackLine{Group: group}
+					lines[group] = line
+				}
+				// Each step sample stands for step seconds of consumption
+				s.set(line, sample.Value*step.Seconds()/3600*s.scale)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	result := make([]metrics.ChargebackLine, 0, len(lines))
+	for _, line := range lines {
+		result = append(result, *line)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Group < result[j].Group
+	})
+
+	return result, nil
+}
+
+// IntegrateQuery returns a query summing a per-pod series over period, sampled
+// every step, per value of the kube_pod_labels label. Pods are joined with their
+// labels inside the subquery so pods deleted during the period are attributed too.
+func IntegrateQuery(perPod, label, namespace string, period, step time.Duration) string {
+	podLabels := fmt.Sprintf(`max by (namespace, pod, %s) (kube_pod_labels{%s})`, label, namespace)
+	return fmt.Sprintf(`sum by (%s) (sum_over_time((%s * on (namespace, pod) group_left (%s) %s)[%s:%s]))`,
+		label, perPod, label, podLabels, promDuration(period), promDuration(step))
+}
+
+// Step returns the subquery resolution for period: the period divided into
+// stepsPerPeriod steps, rounded to whole minutes and at least minStep.
+func Step(period time.Duration) time.Duration {
+	step := (period / stepsPerPeriod).Round(time.Minute)
+	return max(step, minStep)
+}
+
+// promDuration formats d in PromQL duration syntax using whole seconds.
+func promDuration(d time.Duration) string {
+	return fmt.Sprintf("%ds", int64(math.Round(d.Seconds())))
+}
+
+// prefixComma prefixes a non-empty matcher list with a comma.
+func prefixComma(matchers string) string {
+	if strings.TrimSpace(matchers) == "" {
+		return ""
+	}
+	return ", " + matchers
+}
@@ -0,0 +1,113 @@
+package chargeback
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/prometheus"
+)
+
+// fakeQuerier answers queries by the metric they integrate
+type fakeQuerier struct {
+	mutex   sync.Mutex
+	queries []string
+	results map[string][]prometheus.Sample
+	err     error
+}
+
+func (f *fakeQuerier) Query(_ context.Context, query string, _ time.Time) ([]prometheus.Sample, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.queries = append(f.queries, query)
+	if f.err != nil {
+		return nil, f.err
+	}
+	for metric, samples := range f.results {
+		if strings.Contains(query, metric) {
+			return samples, nil
+		}
+	}
+	return nil, nil
+}
+
+// team returns a sample for the team label
+func team(name string, value float64) prometheus.Sample {
+	labels := map[string]string{}
+	if name != "" {
+		labels["label_team"] = name
+	}
+	return prometheus.Sample{Labels: labels, Value: value}
+}
+
+func TestCollector_Collect(t *testing.T) {
+	// A 30 day period is integrated in 1h steps, so each sample value is per step-hour
+	querier := &fakeQuerier{results: map[string][]prometheus.Sample{
+		"container_cpu_usage_seconds_total":  {team("payments", 300), team("", 10)},
+		`resource="cpu"`:                     {team("payments", 720)},
+		"container_memory_working_set_bytes": {team("payments", 1536*bytesPerGiB)},
+		`resource="memory"`:                  {team("payments", 2880*bytesPerGiB)},
+	}}
+
+	opts := config.Options{Mode: config.ModeChargeback, Namespace: "payments", GroupLabel: "team", Period: 30 * 24 * time.Hour}
+	lines, err := New(querier).Collect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	if len(querier.queries) != 4 {
+		t.Fatalf("expected 4 queries, got %d", len(querier.queries))
+	}
+	for _, query := range querier.queries {
+		if !strings.Contains(query, `namespace="payments"`) || !strings.Contains(query, "[2592000s:3600s]") {
+			t.Errorf("query not restricted to namespace and period: %s", query)
+		}
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %+v", len(lines), lines)
+	}
+	if lines[0].Group != UnlabeledGroup || lines[0].CPUCoreHoursUsed != 10 {
+		t.Errorf("unexpected unlabeled line: %+v", lines[0])
+	}
+	payments := lines[1]
+	if payments.Group != "payments" || payments.CPUCoreHoursUsed != 300 || payments.CPUCoreHoursReserved != 720 ||
+		payments.MemoryGiBHoursUsed != 1536 || payments.MemoryGiBHoursReserved != 2880 {
+		t.Errorf("unexpected payments line: %+v", payments)
+	}
+}
+
+func TestCollector_CollectError(t *testing.T) {
+	querier := &fakeQuerier{err: errors.New("connection refused")}
+	opts := config.Options{Mode: config.ModeChargeback, AllNamespaces: true, GroupLabel: "team", Period: time.Hour}
+
+	if _, err := New(querier).Collect(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("expected query error, got %v", err)
+	}
+}
+
+func TestIntegrateQuery(t *testing.T) {
+	got := IntegrateQuery("sum by (namespace, pod) (x)", "label_team", "", 24*time.Hour, 2*time.Minute)
+	want := `sum by (label_team) (sum_over_time((sum by (namespace, pod) (x) * on (namespace, pod) group_left (label_team) ` +
+		`max by (namespace, pod, label_team) (kube_pod_labels{}))[86400s:120s]))`
+	if got != want {
+		t.Errorf("IntegrateQuery:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestStep(t *testing.T) {
+	tests := map[time.Duration]time.Duration{
+		time.Hour:           time.Minute,
+		24 * time.Hour:      2 * time.Minute,
+		30 * 24 * time.Hour: time.Hour,
+	}
+	for period, want := range tests {
+		if got := Step(period); got != want {
+			t.Errorf("Step(%v) = %v, want %v", period, got, want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// readBaseline loads the accepted workload percentages recorded by --update-baseline.
+func readBaseline(path string) (metrics.Baseline, error) {
+	var baseline metrics.Baseline
+
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return baseline, fmt.Errorf("failed to read baseline (record one with --update-baseline): %w", err)
+	}
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return baseline, fmt.Errorf("failed to parse baseline %s: %w", path, err)
+	}
+
+	return baseline, nil
+}
+
+// writeBaseline records the workload percentages to path as indented JSON, so
+// baseline changes can be reviewed when the file is kept in version control.
+func writeBaseline(path string, baseline metrics.Baseline) error {
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode baseline: %w", err)
+	}
+	if err := os.WriteFile(filepath.Clean(path), append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write baseline: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mchmarny/kusage/pkg/bundle"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/k8s"
+	"github.com/mchmarny/kusage/pkg/observability"
+)
+
+// runWithBundle runs the analysis while capturing a diagnostic bundle.
+// The bundle is written even when the run fails, since that is when it is most useful.
+func runWithBundle(opts config.Options, metrics *observability.Metrics) error {
+	b := bundle.New(opts.DebugBundle)
+
+	var clientOpts []k8s.Option
+	if opts.DebugBundleResponses {
+		recorder, err := b.RecordResponses()
+		if err != nil {
+			return err
+		}
+		clientOpts = append(clientOpts, k8s.WithTransportWrapper(recorder.Wrap))
+	}
+
+	if err := b.Start(); err != nil {
+		return err
+	}
+
+	runErr := run(opts, metrics, clientOpts...)
+
+	metrics.Finalize()
+	if err := b.AddJSON("options.json", sanitizeOptions(opts)); err != nil {
+		return errors.Join(runErr, err)
+	}
+	if err := b.AddJSON("metrics.json", metrics.GetSummary()); err != nil {
+		return errors.Join(runErr, err)
+	}
+	if runErr != nil {
+		b.Add("error.txt", []byte(runErr.Error()+"\n"))
+	}
+
+	if err := b.Write(); err != nil {
+		return errors.Join(runErr, err)
+	}
+
+	// Use Warn so the location is visible at the default log level
+	slog.Warn("diagnostic bundle written", "path", opts.DebugBundle)
+
+	return runErr
+}
+
+// optionHandling is how an Options field is recorded in a diagnostic bundle.
+type optionHandling int
+
+const (
+	// optionIncluded records the value of the field.
+	optionIncluded optionHandling = iota
+	// optionRedacted records the field with its credentials removed.
+	optionRedacted
+	// optionOmitted leaves the field out, as for local file paths.
+	optionOmitted
+)
+
+// bundleOptionFields classifies every Options field for the bundle. Fields
+// missing here are left out, and TestSanitizeOptions_ClassifiesEveryField
+// fails until they are classified.
+var bundleOptionFields = map[string]optionHandling{
+	"Namespace":            optionIncluded,
+	"AllNamespaces":        optionIncluded,
+	"NamespacePattern":     optionIncluded,
+	"Namespaces":           optionIncluded,
+	"LabelSelector":        optionIncluded,
+	"ExcludeNamespaces":    optionIncluded,
+	"ExcludeLabels":        optionIncluded,
+	"Mode":                 optionIncluded,
+	"Resource":             optionIncluded,
+	"Sort":                 optionIncluded,
+	"TopN":                 optionIncluded,
+	"NoHeaders":            optionIncluded,
+	"Output":               optionIncluded,
+	"Timeout":              optionIncluded,
+	"CacheTTL":             optionIncluded,
+	"NodeSubtotals":        optionIncluded,
+	"IncludeCompleted":     optionIncluded,
+	"ExcludeCrashLoop":     optionIncluded,
+	"SampleFraction":       optionIncluded,
+	"IncludeNoLimit":       optionIncluded,
+	"LimitRanges":          optionIncluded,
+	"Forecast":             optionIncluded,
+	"GroupBy":              optionIncluded,
+	"CronJobAggregation":   optionIncluded,
+	"ShowDensity":          optionIncluded,
+	"SchedulableOnly":      optionIncluded,
+	"ShowNetwork":          optionIncluded,
+	"SummaryOnly":          optionIncluded,
+	"Threshold":            optionIncluded,
+	"Thresholds":           optionIncluded,
+	"Color":                optionIncluded,
+	"LogLevel":             optionIncluded,
+	"CostCenterKey":        optionIncluded,
+	"GroupLabel":           optionIncluded,
+	"Period":               optionIncluded,
+	"PrometheusURL":        optionRedacted,
+	"PrometheusHeaders":    optionRedacted,
+	"PrometheusTenant":     optionIncluded,
+	"PrometheusTimeout":    optionIncluded,
+	"LimitsSource":         optionIncluded,
+	"Source":               optionIncluded,
+	"UsageRange":           optionIncluded,
+	"Aggregation":          optionIncluded,
+	"PoolLabel":            optionIncluded,
+	"GrowthWindow":         optionIncluded,
+	"SidecarPatterns":      optionIncluded,
+	"PodCPUMc":             optionIncluded,
+	"PodMemoryMi":          optionIncluded,
+	"Contexts":             optionIncluded,
+	"Compare":              optionIncluded,
+	"LabelColumns":         optionIncluded,
+	"Context":              optionIncluded,
+	"Kubeconfig":           optionOmitted,
+	"Cluster":              optionIncluded,
+	"Listen":               optionIncluded,
+	"Budgets":              optionIncluded,
+	"Interval":             optionIncluded,
+	"Samples":              optionIncluded,
+	"Watch":                optionIncluded,
+	"WatchDelta":           optionIncluded,
+	"SaveSnapshot":         optionIncluded,
+	"SnapshotDir":          optionOmitted,
+	"Export":               optionIncluded,
+	"ExportLabels":         optionIncluded,
+	"RequestHeadroom":      optionIncluded,
+	"LimitHeadroom":        optionIncluded,
+	"PatchDir":             optionOmitted,
+	"Kustomize":            optionIncluded,
+	"KubectlPatches":       optionIncluded,
+	"WasteBasis":           optionIncluded,
+	"MinDelta":             optionIncluded,
+	"Policy":               optionIncluded,
+	"Baseline":             optionOmitted,
+	"UpdateBaseline":       optionIncluded,
+	"Tolerance":            optionIncluded,
+	"WhyPod":               optionIncluded,
+	"ScoreExpr":            optionIncluded,
+	"Weights":              optionIncluded,
+	"Pricing":              optionIncluded,
+	"CostBy":               optionIncluded,
+	"FilterExpr":           optionIncluded,
+	"MinPercentage":        optionIncluded,
+	"MaxPercentage":        optionIncluded,
+	"PageSize":             optionIncluded,
+	"MaxConcurrency":       optionIncluded,
+	"EnableMetrics":        optionIncluded,
+	"MetricsOutput":        optionOmitted,
+	"MaxMemoryMB":          optionIncluded,
+	"LowMemory":            optionIncluded,
+	"Strict":               optionIncluded,
+	"StrictThreshold":      optionIncluded,
+	"FailAbove":            optionIncluded,
+	"DryRun":               optionIncluded,
+	"DebugBundle":          optionOmitted,
+	"DebugBundleResponses": optionIncluded,
+	"APIImpact":            optionIncluded,
+	"GCPercent":            optionIncluded,
+}
+
+// redactedValue replaces credentials in a bundled option.
+const redactedValue = "REDACTED"
+
+// sanitizeOptions returns the options relevant to reproducing a run, keyed by
+// the snake_case field name. Local file paths are omitted, credentials are
+// redacted, and durations, log levels and expressions are rendered as text.
+func sanitizeOptions(opts config.Options) map[string]any {
+	sanitized := map[string]any{
+		"version": fmt.Sprintf("%s (commit: %s, date: %s)", Version, Commit, Date),
+	}
+	value := reflect.ValueOf(opts)
+	for i := range value.NumField() {
+		field := value.Type().Field(i)
+		handling, ok := bundleOptionFields[field.Name]
+		if !ok || handling == optionOmitted {
+			continue
+		}
+		v := bundleValue(value.Field(i).Interface())
+		if handling == optionRedacted {
+			v = redact(v)
+		}
+		sanitized[snakeCase(field.Name)] = v
+	}
+	return sanitized
+}
+
+// bundleValue renders the option types that do not marshal to readable JSON.
+func bundleValue(v any) any {
+	switch v := v.(type) {
+	case time.Duration:
+		return v.String()
+	case slog.Level:
+		return v.String()
+	case *regexp.Regexp:
+		return regexSource(v)
+	case *config.Expression:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// redact removes credentials from a URL, or the values of a header map.
+func redact(v any) any {
+	switch v := v.(type) {
+	case string:
+		u, err := url.Parse(v)
+		if err != nil {
+			return redactedValue
+		}
+		if u.User != nil {
+			u.User = url.User(redactedValue)
+		}
+		if u.RawQuery != "" {
+			u.RawQuery = redactedValue
+		}
+		return u.String()
+	case map[string]string:
+		redacted := make(map[string]string, len(v))
+		for k := range v {
+			redacted[k] = redactedValue
+		}
+		return redacted
+	default:
+		return redactedValue
+	}
+}
+
+// snakeCase converts a Go field name, such as PodCPUMc, to pod_cpu_mc.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// regexSource returns the source of an optional regular expression.
+func regexSource(re *regexp.Regexp) string {
+	if re == nil {
+		return ""
+	}
+	return re.String()
+}
@@ -0,0 +1,175 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// cacheEntry is a collection recorded by a previous run.
+type cacheEntry struct {
+	// CollectedAt is when the rows were collected
+	CollectedAt time.Time `json:"collected_at"`
+	// Rows are the collected rows, before scoring, filtering and sorting
+	Rows []metrics.Row `json:"rows"`
+}
+
+// cachedCollector reuses the rows a previous run collected from the same
+// cluster with the same scope while they are younger than the TTL, so runs
+// that only change how rows are sorted, filtered or printed do not list pods
+// and metrics again.
+type cachedCollector struct {
+	collector rowCollector
+	dir       string
+	cluster   string
+	ttl       time.Duration
+	now       func() time.Time
+}
+
+// newCachedCollector returns a cachedCollector storing collections of cluster
+// (the API server URL) in the kusage directory of the user cache dir.
+func newCachedCollector(c rowCollector, cluster string, ttl time.Duration) *cachedCollector {
+	return &cachedCollector{
+		collector: c,
+		dir:       defaultCacheDir(),
+		cluster:   cluster,
+		ttl:       ttl,
+		now:       time.Now,
+	}
+}
+
+// defaultCacheDir returns kusage in the user cache directory, or an empty
+// string when it cannot be determined, which disables caching.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "kusage")
+}
+
+// Collect returns the cached rows for the scope of opts when they are fresh,
+// otherwise it collects them and records them for later runs. Failing to read
+// or write the cache is logged and never fails the run.
+func (c *cachedCollector) Collect(ctx context.Context, opts config.Options) ([]metrics.Row, error) {
+	if c.dir == "" {
+		return c.collector.Collect(ctx, opts)
+	}
+	path := filepath.Join(c.dir, cacheKey(c.cluster, opts)+".json")
+
+	if entry, ok := c.read(path); ok {
+		slog.Debug("using cached rows", "path", path, "age", c.now().Sub(entry.CollectedAt), "rows", len(entry.Rows))
+		return entry.Rows, nil
+	}
+
+	rows, err := c.collector.Collect(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.write(path, cacheEntry{CollectedAt: c.now(), Rows: rows}); err != nil {
+		slog.Warn("failed to cache rows", "path", path, "error", err)
+	}
+	return rows, nil
+}
+
+// read returns the entry at path when it exists and is younger than the TTL.
+func (c *cachedCollector) read(path string) (cacheEntry, bool) {
+	var entry cacheEntry
+
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("failed to read cached rows", "path", path, "error", err)
+		}
+		return entry, false
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		slog.Warn("ignoring unreadable cached rows", "path", path, "error", err)
+		return entry, false
+	}
+
+	age := c.now().Sub(entry.CollectedAt)
+	if age < 0 || age >= c.ttl {
+		slog.Debug("cached rows expired", "path", path, "age", age)
+		return entry, false
+	}
+	return entry, true
+}
+
+// write records entry to path, replacing the file atomically so a concurrent
+// run never reads a partial entry.
+func (c *cachedCollector) write(path string, entry cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cached rows: %w", err)
+	}
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(c.dir, "rows-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// cacheKey hashes the cluster and the options that determine which rows are
+// collected. Options applied after collection, such as sorting, --top,
+// expressions and output formats, are left out so they can change between
+// runs sharing a cache entry.
+func cacheKey(cluster string, opts config.Options) string {
+	var excludeNamespaces, excludeLabels string
+	if opts.ExcludeNamespaces != nil {
+		excludeNamespaces = opts.ExcludeNamespaces.String()
+	}
+	if opts.ExcludeLabels != nil {
+		excludeLabels = opts.ExcludeLabels.String()
+	}
+
+	scope, _ := json.Marshal([]any{
+		cluster,
+		opts.Mode,
+		opts.Resource,
+		opts.Namespace,
+		opts.AllNamespaces,
+		opts.NamespacePattern,
+		opts.LabelSelector,
+		excludeNamespaces,
+		excludeLabels,
+		opts.IncludeCompleted,
+		opts.ExcludeCrashLoop,
+		opts.IncludeNoLimit,
+		opts.LimitsSource,
+		opts.LimitRanges,
+		opts.SampleFraction,
+		opts.Source,
+		opts.UsageRange,
+		opts.Aggregation,
+		opts.Forecast,
+		opts.PrometheusURL,
+		opts.PrometheusTenant,
+		// marshaled with sorted names and only stored hashed, as values may hold credentials
+		opts.PrometheusHeaders,
+	})
+	sum := sha256.Sum256(scope)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// countingCollector returns the same rows on every call and counts the calls.
+type countingCollector struct {
+	rows  []metrics.Row
+	calls int
+}
+
+func (c *countingCollector) Collect(_ context.Context, _ config.Options) ([]metrics.Row, error) {
+	c.calls++
+	return c.rows, nil
+}
+
+func TestCachedCollector(t *testing.T) {
+	source := &countingCollector{rows: []metrics.Row{{Namespace: "payments", Name: "api-0", UsageMi: 100, LimitMi: 200, Percentage: 50}}}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := &cachedCollector{collector: source, dir: t.TempDir(), cluster: "https://cluster-a", ttl: time.Minute, now: func() time.Time { return now }}
+	opts := config.Options{Namespace: "payments", Mode: config.ModePods, Resource: config.ResourceMemory, Sort: config.SortByPercentage, TopN: 20}
+
+	collect := func(opts config.Options) []metrics.Row {
+		t.Helper()
+		rows, err := c.Collect(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("Collect failed: %v", err)
+		}
+		return rows
+	}
+
+	collect(opts)
+	if source.calls != 1 {
+		t.Fatalf("expected the first run to collect, got %d calls", source.calls)
+	}
+
+	// Sort, top and output do not change the rows collected
+	resorted := opts
+	resorted.Sort, resorted.TopN, resorted.Output = config.SortByUsage, 5, config.OutputJSON
+	now = now.Add(30 * time.Second)
+	rows := collect(resorted)
+	if source.calls != 1 {
+		t.Errorf("expected cached rows within the ttl, got %d calls", source.calls)
+	}
+	if len(rows) != 1 || rows[0].Name != "api-0" || rows[0].UsageMi != 100 {
+		t.Errorf("expected the cached row, got %+v", rows)
+	}
+
+	// A different scope is collected separately
+	other := opts
+	other.Resource = config.ResourceCPU
+	collect(other)
+	if source.calls != 2 {
+		t.Errorf("expected a different resource to collect, got %d calls", source.calls)
+	}
+
+	// Expired rows are collected again
+	now = now.Add(time.Minute)
+	collect(opts)
+	if source.calls != 3 {
+		t.Errorf("expected expired rows to be collected again, got %d calls", source.calls)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	opts := config.Options{Namespace: "payments", Mode: config.ModePods, Resource: config.ResourceMemory}
+
+	if cacheKey("https://cluster-a", opts) == cacheKey("https://cluster-b", opts) {
+		t.Error("expected clusters to have different keys")
+	}
+
+	selected := opts
+	selected.LabelSelector = "app=api"
+	if cacheKey("https://cluster-a", opts) == cacheKey("https://cluster-a", selected) {
+		t.Error("expected label selectors to have different keys")
+	}
+
+	defaulted := opts
+	defaulted.LimitRanges = true
+	if cacheKey("https://cluster-a", opts) == cacheKey("https://cluster-a", defaulted) {
+		t.Error("expected LimitRange default limits to have different keys")
+	}
+
+	sampled := opts
+	sampled.SampleFraction = 0.1
+	if cacheKey("https://cluster-a", opts) == cacheKey("https://cluster-a", sampled) {
+		t.Error("expected sample fractions to have different keys")
+	}
+
+	authorized := opts
+	authorized.PrometheusHeaders = map[string]string{"Authorization": "Bearer a", "X-Scope-OrgID": "team-a"}
+	reauthorized := opts
+	reauthorized.PrometheusHeaders = map[string]string{"X-Scope-OrgID": "team-a", "Authorization": "Bearer b"}
+	if cacheKey("https://cluster-a", opts) == cacheKey("https://cluster-a", authorized) ||
+		cacheKey("https://cluster-a", authorized) == cacheKey("https://cluster-a", reauthorized) {
+		t.Error("expected Prometheus headers to have different keys")
+	}
+	reordered := opts
+	reordered.PrometheusHeaders = map[string]string{"X-Scope-OrgID": "team-a", "Authorization": "Bearer a"}
+	if cacheKey("https://cluster-a", authorized) != cacheKey("https://cluster-a", reordered) {
+		t.Error("expected the same Prometheus headers to share a key")
+	}
+
+	presented := opts
+	presented.Sort, presented.TopN, presented.NoHeaders = config.SortByLimit, 3, true
+	if cacheKey("https://cluster-a", opts) != cacheKey("https://cluster-a", presented) {
+		t.Error("expected presentation options to share a key")
+	}
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/collector"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/k8s"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/observability"
+	"github.com/mchmarny/kusage/pkg/output"
+)
+
+// parseDoctor parses the doctor command, which checks the components pod
+// metrics are served through and names the failing one.
+func (p *Parser) parseDoctor(args []string) (*config.Options, error) {
+	fs := flag.NewFlagSet(p.programName+" doctor", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		allNamespaces = fs.Bool("A", false, "If present, list pod metrics across all namespaces")
+		namespace     = fs.String("n", "default", "Namespace to list pod metrics in (ignored with -A)")
+		noHeaders     = fs.Bool("no-headers", false, "If true, suppress headers in the output")
+		timeout       = fs.Duration("timeout", 30*time.Second, "Time allowed for the whole run, across all checks (e.g. 5m)")
+		kube          = p.defineKubeconfigFlags(fs)
+
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &config.Options{
+		Namespace:     *namespace,
+		AllNamespaces: *allNamespaces,
+		Mode:          config.ModeDoctor,
+		NoHeaders:     *noHeaders,
+		Output:        config.OutputTable,
+		LogLevel:      level,
+		Timeout:       *timeout,
+	}
+	kube.apply(opts)
+	p.applyPluginDefaults(fs, opts)
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return opts, nil
+}
+
+// runDoctor checks the metrics APIService, its backing service and endpoints,
+// and the pod metrics list, printing one line per check. It fails when a
+// component fails so scripts can gate on a healthy metrics API.
+func runDoctor(opts config.Options, observer *observability.Metrics) error {
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, observer)...)
+	if err != nil {
+		if observer != nil {
+			observer.RecordError(err, "kubernetes client initialization")
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	dataCollector := collector.New(clientManager.CoreClient(), clientManager.MetricsClient()).WithMetrics(observer)
+	checks := dataCollector.CheckMetricsAPI(ctx, opts)
+
+	outputFormatter := output.New()
+	defer outputFormatter.Close()
+	if err := outputFormatter.PrintChecks(checks, opts); err != nil {
+		return err
+	}
+
+	return checksError(checks)
+}
+
+// checksError names the failed components, or returns nil when none failed.
+func checksError(checks []metrics.Check) error {
+	var failed []string
+	for _, check := range checks {
+		if check.Status == metrics.CheckFailed {
+			failed = append(failed, check.Component)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("metrics API check failed: %s", strings.Join(failed, ", "))
+}
@@ -0,0 +1,27 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+func TestChecksError(t *testing.T) {
+	checks := []metrics.Check{
+		{Component: "APIService v1beta1.metrics.k8s.io", Status: metrics.CheckOK},
+		{Component: "Service kube-system/metrics-server", Status: metrics.CheckUnknown},
+	}
+	if err := checksError(checks); err != nil {
+		t.Errorf("expected unknown components not to fail, got %v", err)
+	}
+
+	checks = append(checks,
+		metrics.Check{Component: "EndpointSlices of kube-system/metrics-server", Status: metrics.CheckFailed},
+		metrics.Check{Component: "PodMetrics in namespace payments", Status: metrics.CheckFailed},
+	)
+	err := checksError(checks)
+	want := "metrics API check failed: EndpointSlices of kube-system/metrics-server, PodMetrics in namespace payments"
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+}
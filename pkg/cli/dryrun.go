@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"github.com/mchmarny/kusage/pkg/collector"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/k8s"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/output"
+)
+
+// runDryRun prints the requests the analysis would issue for opts without
+// issuing any. The kubeconfig is read to select the sources, but no API is
+// contacted.
+func runDryRun(opts config.Options) error {
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, nil)...)
+	if err != nil {
+		return err
+	}
+	dataCollector, err := newDataCollector(clientManager, opts, nil)
+	if err != nil {
+		return err
+	}
+
+	outputFormatter := output.New()
+	defer outputFormatter.Close()
+	return outputFormatter.PrintPlan(planRun(dataCollector, opts), clientManager.Config().Host, opts)
+}
+
+// planRun returns the requests of the collection followed by those of the
+// lookups run on the collected rows.
+func planRun(c *collector.Collector, opts config.Options) []metrics.PlannedRequest {
+	plan := c.Plan(opts)
+
+	if opts.CostCenterKey != "" {
+		request := metrics.PlannedRequest{Server: collector.ServerKubernetes, Method: "GET", Path: "/api/v1/namespaces", Requests: 1}
+		if !opts.AllNamespaces {
+			request.Path += "/" + opts.Namespace
+		}
+		plan = append(plan, request)
+	}
+
+	// Network rates are measured between two reads of each kubelet
+	if opts.ShowNetwork && !opts.SummaryOnly && opts.CostCenterKey == "" {
+		plan = append(plan, metrics.PlannedRequest{
+			Server:   collector.ServerKubernetes,
+			Method:   "GET",
+			Path:     "/api/v1/nodes/{node}/proxy/stats/summary",
+			Requests: 2,
+			Per:      "node hosting a reported pod",
+		})
+	}
+
+	return plan
+}
@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/k8s"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/observability"
+	"github.com/mchmarny/kusage/pkg/output"
+)
+
+// parseExport parses the export command, which writes the memory and CPU of
+// every container in scope as a tidy CSV dataset, one line per container per
+// sample.
+func (p *Parser) parseExport(args []string) (*config.Options, error) {
+	fs := flag.NewFlagSet(p.programName+" export", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		allNamespaces = fs.Bool("A", false, "If present, export across all namespaces")
+		namespace     = fs.String("n", "default", "Namespace or glob of namespaces to use (ignored with -A)")
+		labelSelector = fs.String("l", "", "Label selector")
+		excludeNS     = fs.String("nx", "", "Regex of namespaces to exclude")
+		excludeLabels = fs.String("lx", "", "Regex of labels to exclude")
+		format        = fs.String("format", "csv", "Dataset format: csv|feather (feather is not supported yet)")
+		includeLabels = fs.Bool("include-labels", false, "Add a label_<key> column per pod label")
+		noHeaders     = fs.Bool("no-headers", false, "If true, suppress the header line")
+		samples       = fs.Int("samples", 1, "Collect usage this many times, --interval apart")
+		interval      = fs.Duration("interval", 30*time.Second, "Time between the collections of --samples")
+		pageSize      = fs.Int64("page-size", 500, "Number of items to fetch per API call")
+		enableMetrics = fs.Bool("metrics", false, "Enable detailed performance metrics collection")
+		timeout       = fs.Duration("timeout", 30*time.Second, "Time allowed for the whole run, across all pages and retries (e.g. 5m)")
+		kube          = p.defineKubeconfigFlags(fs)
+
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+	switch *format {
+	case "csv":
+	case "feather":
+		// Arrow is not a dependency; pandas converts the CSV in one line
+		return nil, errors.New("feather export is not supported yet, export csv and convert it with " +
+			"pandas.read_csv(\"usage.csv\").to_feather(\"usage.feather\")")
+	default:
+		return nil, fmt.Errorf("unsupported export format %q (expected csv|feather)", *format)
+	}
+	if *samples < 1 {
+		return nil, fmt.Errorf("invalid --samples %d (expected at least 1)", *samples)
+	}
+
+	// Exports carry both resources of every container, limited or not, so the
+	// dataset covers the whole scope
+	opts := &config.Options{
+		Namespace:      *namespace,
+		AllNamespaces:  *allNamespaces,
+		LabelSelector:  *labelSelector,
+		Mode:           config.ModeContainers,
+		Resource:       config.ResourceAll,
+		Sort:           config.SortByPercentage,
+		Output:         config.OutputCSV,
+		NoHeaders:      *noHeaders,
+		LogLevel:       level,
+		IncludeNoLimit: true,
+		PageSize:       *pageSize,
+		EnableMetrics:  *enableMetrics,
+		Timeout:        *timeout,
+		Samples:        *samples,
+		Interval:       *interval,
+		Export:         true,
+		ExportLabels:   *includeLabels,
+	}
+	kube.apply(opts)
+
+	// Samples are collected --interval apart within the timeout
+	if opts.Samples > 1 && !flagSet(fs, "timeout") {
+		opts.Timeout += time.Duration(opts.Samples-1) * opts.Interval
+	}
+
+	if *excludeNS != "" {
+		excludeRegex, err := regexp.Compile(*excludeNS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nx regex: %w", err)
+		}
+		opts.ExcludeNamespaces = excludeRegex
+	}
+	if *excludeLabels != "" {
+		excludeRegex, err := regexp.Compile(*excludeLabels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --lx regex: %w", err)
+		}
+		opts.ExcludeLabels = excludeRegex
+	}
+
+	p.applyPluginDefaults(fs, opts)
+	p.parseNamespacePattern(opts)
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return opts, nil
+}
+
+// runExport collects the containers in scope opts.Samples times and writes
+// the rows of every sample to stdout.
+func runExport(opts config.Options, observer *observability.Metrics) error {
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, observer)...)
+	if err != nil {
+		if observer != nil {
+			observer.RecordError(err, "kubernetes client initialization")
+		}
+		return err
+	}
+	dataCollector, err := newDataCollector(clientManager, opts, observer)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	collectionStart := time.Now()
+	samples, err := collectSamples(ctx, dataCollector, opts, waitInterval)
+	if err != nil {
+		if observer != nil {
+			observer.RecordError(err, "data collection")
+		}
+		return err
+	}
+	if observer != nil {
+		observer.SetCollectionDuration(time.Since(collectionStart))
+		for _, sample := range samples {
+			observer.ResultsGenerated += int64(len(sample.Rows))
+		}
+	}
+
+	outputFormatter := output.New()
+	defer outputFormatter.Close()
+	return outputFormatter.PrintExport(samples, opts)
+}
+
+// collectSamples collects the rows of c opts.Samples times, opts.Interval
+// apart, keeping every sample with the time its collection started.
+func collectSamples(ctx context.Context, c rowCollector, opts config.Options, wait func(ctx context.Context, d time.Duration) error) ([]metrics.Snapshot, error) {
+	samples := make([]metrics.Snapshot, 0, opts.Samples)
+	for i := range opts.Samples {
+		if i > 0 {
+			if err := wait(ctx, opts.Interval); err != nil {
+				return nil, fmt.Errorf("export interrupted after %d of %d samples: %w", i, opts.Samples, err)
+			}
+		}
+		takenAt := time.Now()
+		rows, err := c.Collect(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d of %d: %w", i+1, opts.Samples, err)
+		}
+		slog.Debug("export sampled", "sample", i+1, "of", opts.Samples, "rows", len(rows))
+		samples = append(samples, metrics.Snapshot{TakenAt: takenAt.UTC(), Mode: opts.Mode, Rows: rows})
+	}
+	return samples, nil
+}
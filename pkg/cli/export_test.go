@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+func TestCollectSamples(t *testing.T) {
+	row := func(usage int64) metrics.Row {
+		return metrics.Row{Namespace: "web", Name: "api-0:api", Resource: config.ResourceAll, UsageMc: usage}
+	}
+	source := &sequenceCollector{collections: [][]metrics.Row{{row(100)}, {row(300)}}}
+	var waits []time.Duration
+	wait := func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	opts := config.Options{Mode: config.ModeContainers, Samples: 2, Interval: time.Minute}
+	samples, err := collectSamples(context.Background(), source, opts, wait)
+	if err != nil {
+		t.Fatalf("collectSamples failed: %v", err)
+	}
+	if len(waits) != 1 || waits[0] != time.Minute {
+		t.Errorf("expected one wait of a minute, got %v", waits)
+	}
+	// Every sample is kept as collected rather than merged
+	if len(samples) != 2 || samples[0].Rows[0].UsageMc != 100 || samples[1].Rows[0].UsageMc != 300 {
+		t.Errorf("expected both samples as collected, got %+v", samples)
+	}
+	if samples[0].TakenAt.IsZero() || samples[1].TakenAt.Before(samples[0].TakenAt) {
+		t.Errorf("expected samples stamped in order, got %s and %s", samples[0].TakenAt, samples[1].TakenAt)
+	}
+
+	// An interrupted wait fails the export
+	source.calls = 0
+	failed := func(context.Context, time.Duration) error { return context.Canceled }
+	if _, err := collectSamples(context.Background(), source, opts, failed); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the interruption to be returned, got %v", err)
+	}
+}
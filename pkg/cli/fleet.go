@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/k8s"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/observability"
+)
+
+// fleetCollector collects the rows of several kubeconfig contexts
+// concurrently, naming the context each row was collected from, so a fleet
+// is ranked as one.
+type fleetCollector struct {
+	contexts   []string
+	collectors []rowCollector
+}
+
+// newFleetCollector returns a fleetCollector with a client and collector per
+// context in opts.Contexts.
+func newFleetCollector(opts config.Options, observer *observability.Metrics, clientOpts ...k8s.Option) (*fleetCollector, error) {
+	f := &fleetCollector{contexts: opts.Contexts}
+	for _, name := range opts.Contexts {
+		clientManager, err := k8s.NewClientManager(append(append(clientOptions(opts, observer), clientOpts...), k8s.WithContext(name))...)
+		if err != nil {
+			return nil, fmt.Errorf("context %s: %w", name, err)
+		}
+		c, err := newDataCollector(clientManager, opts, observer)
+		if err != nil {
+			return nil, err
+		}
+		f.collectors = append(f.collectors, c)
+	}
+	return f, nil
+}
+
+// Collect returns the rows of every context in the order of the contexts. The
+// first failing context fails the collection.
+func (f *fleetCollector) Collect(ctx context.Context, opts config.Options) ([]metrics.Row, error) {
+	results := make([][]metrics.Row, len(f.collectors))
+
+	g, gctx := errgroup.WithContext(ctx)
+	for i, c := range f.collectors {
+		g.Go(func() error {
+			rows, err := c.Collect(gctx, opts)
+			if err != nil {
+				return fmt.Errorf("context %s: %w", f.contexts[i], err)
+			}
+			for j := range rows {
+				rows[j].Cluster = f.contexts[i]
+			}
+			results[i] = rows
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	var rows []metrics.Row
+	for _, r := range results {
+		rows = append(rows, r...)
+	}
+	return rows, nil
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// failingCollector fails every collection.
+type failingCollector struct{}
+
+func (failingCollector) Collect(_ context.Context, _ config.Options) ([]metrics.Row, error) {
+	return nil, errors.New("metrics API unavailable")
+}
+
+func TestFleetCollector(t *testing.T) {
+	f := &fleetCollector{
+		contexts: []string{"prod-us", "prod-eu"},
+		collectors: []rowCollector{
+			&countingCollector{rows: []metrics.Row{{Namespace: "payments", Name: "api-0", Percentage: 50}}},
+			&countingCollector{rows: []metrics.Row{{Namespace: "payments", Name: "api-0", Percentage: 90}, {Namespace: "search", Name: "web-0", Percentage: 10}}},
+		},
+	}
+
+	rows, err := f.Collect(context.Background(), config.Options{})
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	want := []string{"prod-us", "prod-eu", "prod-eu"}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %d rows, got %+v", len(want), rows)
+	}
+	for i, cluster := range want {
+		if rows[i].Cluster != cluster {
+			t.Errorf("row %d: expected cluster %s, got %q", i, cluster, rows[i].Cluster)
+		}
+	}
+
+	f.collectors[1] = failingCollector{}
+	if _, err := f.Collect(context.Background(), config.Options{}); err == nil || err.Error() != "context prod-eu: metrics API unavailable" {
+		t.Errorf("expected the failing context to be named, got %v", err)
+	}
+}
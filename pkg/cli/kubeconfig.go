@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"flag"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/k8s"
+	"github.com/mchmarny/kusage/pkg/observability"
+)
+
+// kubeconfigFlags are the flags selecting the cluster to analyze, shared by
+// every command and named as in kubectl.
+type kubeconfigFlags struct {
+	context    *string
+	kubeconfig *string
+	cluster    *string
+}
+
+// defineKubeconfigFlags registers the kubeconfig override flags on fs.
+func (p *Parser) defineKubeconfigFlags(fs *flag.FlagSet) *kubeconfigFlags {
+	return &kubeconfigFlags{
+		context:    fs.String("context", "", "Kubeconfig context to use (default: the current context)"),
+		kubeconfig: fs.String("kubeconfig", "", "Path to the kubeconfig file to use (default: $KUBECONFIG or ~/.kube/config)"),
+		cluster:    fs.String("cluster", "", "Kubeconfig cluster to use (default: the cluster of the context)"),
+	}
+}
+
+// apply copies the kubeconfig overrides to opts.
+func (f *kubeconfigFlags) apply(opts *config.Options) {
+	opts.Context = *f.context
+	opts.Kubeconfig = *f.kubeconfig
+	opts.Cluster = *f.cluster
+}
+
+// clientOptions returns the client options selecting the cluster of opts.
+// With an observer, the requests of the clients and their waits on the
+// client-side rate limit are recorded in it.
+func clientOptions(opts config.Options, observer *observability.Metrics) []k8s.Option {
+	var clientOpts []k8s.Option
+	if observer != nil {
+		clientOpts = append(clientOpts, k8s.WithTransportWrapper(observer.WrapTransport), k8s.WithRateLimitObserver(observer.RecordRateLimitWait))
+	}
+	return append(clientOpts, k8s.SelectionOptions(opts.Context, opts.Kubeconfig, opts.Cluster)...)
+}
@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
+
+	"github.com/mchmarny/kusage/pkg/analyzer"
+	"github.com/mchmarny/kusage/pkg/collector"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/observability"
+	"github.com/mchmarny/kusage/pkg/output"
+)
+
+const (
+	// bytesPerMB converts the --max-memory value to bytes
+	bytesPerMB = 1024 * 1024
+	// progressInterval is the shortest time between two redraws of the
+	// provisional top rows of a --low-memory run
+	progressInterval = time.Second
+)
+
+// applyMemoryTuning configures the Go runtime for the requested memory budget.
+// The soft memory limit is derived from --max-memory unless GOMEMLIMIT is set,
+// which lets the GC work harder as the heap approaches the limit instead of
+// growing it on large all-namespace scans. When --gc-percent is set it
+// overrides GOGC; -1 combined with the memory limit trades GC frequency for
+// memory headroom, which reduces GC thrash when building large result sets.
+func applyMemoryTuning(opts *config.Options) {
+	if _, ok := os.LookupEnv("GOMEMLIMIT"); ok {
+		slog.Debug("memory limit set by environment, ignoring --max-memory", "GOMEMLIMIT", os.Getenv("GOMEMLIMIT"))
+	} else if opts.MaxMemoryMB > 0 {
+		debug.SetMemoryLimit(opts.MaxMemoryMB * bytesPerMB)
+		slog.Debug("memory limit applied", "max_memory_mb", opts.MaxMemoryMB)
+	}
+
+	if opts.GCPercent != 0 {
+		previous := debug.SetGCPercent(opts.GCPercent)
+		slog.Debug("gc percent applied", "gc_percent", opts.GCPercent, "previous", previous)
+	}
+}
+
+// rowCollector collects the result rows of an analysis.
+type rowCollector interface {
+	Collect(ctx context.Context, opts config.Options) ([]metrics.Row, error)
+}
+
+// topNCollector streams rows page by page for --low-memory runs and keeps
+// only the opts.TopN highest ranked.
+type topNCollector struct {
+	streaming *collector.StreamingCollector
+	analyzer  *analyzer.Analyzer
+	// progress, when set, receives the provisional top rows and the number of
+	// rows streamed so far, at most every progressInterval
+	progress func(rows []metrics.Row, streamed int)
+}
+
+// newTopNCollector returns a topNCollector whose page size is halved whenever
+// heap usage crosses a watermark of the --max-memory budget.
+func newTopNCollector(coreClient kubernetes.Interface, metricsClient metricsv.Interface, a *analyzer.Analyzer, opts config.Options, observer *observability.Metrics) *topNCollector {
+	c := collector.NewStreamingCollector(coreClient, metricsClient).
+		WithMaxConcurrency(int64(opts.MaxConcurrency)).
+		WithMemoryHook(func(event collector.MemoryEvent) collector.MemoryAction {
+			slog.Warn("memory watermark crossed, reducing page size",
+				"watermark", event.Watermark, "used_bytes", event.UsedBytes, "page_size", event.PageSize)
+			return collector.MemoryReducePageSize
+		})
+	c.WithPageSize(opts.PageSize)
+	c.WithMetrics(observer)
+	return &topNCollector{streaming: c, analyzer: a}
+}
+
+// WithProgress sets the function the provisional top rows are passed to
+// while the collection is streaming.
+func (t *topNCollector) WithProgress(progress func(rows []metrics.Row, streamed int)) *topNCollector {
+	t.progress = progress
+	return t
+}
+
+// Collect streams rows and keeps the opts.TopN highest ranked. Each row is
+// scored, classified and filtered as it arrives, so the full result set is
+// never held in memory.
+func (t *topNCollector) Collect(ctx context.Context, opts config.Options) ([]metrics.Row, error) {
+	// Stop the collection if a row fails to score or filter
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	top := t.analyzer.NewTopN(opts)
+	streamed := 0
+	reported := time.Now()
+	for result := range t.streaming.CollectStreaming(ctx, opts) {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		streamed++
+
+		batch := []metrics.Row{*result.Row}
+		if err := t.analyzer.Score(batch, opts); err != nil {
+			return nil, err
+		}
+		t.analyzer.Classify(batch, opts)
+		batch, err := t.analyzer.Select(batch, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range batch {
+			top.Push(row)
+		}
+		if t.progress != nil && time.Since(reported) >= progressInterval {
+			t.progress(top.Rows(), streamed)
+			reported = time.Now()
+		}
+	}
+
+	slog.Debug("streamed rows into top-n", "rows", streamed, "kept", top.Len())
+	return top.Rows(), nil
+}
+
+// progressiveOutput reports whether a --low-memory run redraws its
+// provisional top rows while streaming: for tables on a terminal, which the
+// final table replaces.
+func progressiveOutput(opts config.Options) bool {
+	if opts.Output != config.OutputTable && opts.Output != config.OutputWide {
+		return false
+	}
+	return opts.Samples <= 1 && isTerminal(os.Stdout)
+}
+
+// progressPrinter redraws the provisional top rows of a --low-memory run.
+type progressPrinter struct {
+	w     io.Writer
+	opts  config.Options
+	drawn bool
+}
+
+// print clears the screen and prints the provisional top rows under a line
+// with the number of rows streamed so far.
+func (p *progressPrinter) print(rows []metrics.Row, streamed int) {
+	p.drawn = true
+	if _, err := fmt.Fprintf(p.w, "%sStreaming, %d rows so far; provisional top %d:\n\n", clearScreen, streamed, len(rows)); err != nil {
+		slog.Debug("failed to print progress", "error", err)
+		return
+	}
+	if err := output.NewWithWriter(p.w).PrintTable(rows, p.opts); err != nil {
+		slog.Debug("failed to print progress", "error", err)
+	}
+}
+
+// clear clears the last provisional table, if any, before the final output.
+func (p *progressPrinter) clear() {
+	if p != nil && p.drawn {
+		fmt.Fprint(p.w, clearScreen)
+	}
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mchmarny/kusage/pkg/analyzer"
+	"github.com/mchmarny/kusage/pkg/collector"
+	"github.com/mchmarny/kusage/pkg/collector/fake"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+func TestTopNCollector_MatchesCollect(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+	coreClient, metricsClient, err := fake.NewClients(fixture)
+	if err != nil {
+		t.Fatalf("failed to create clients: %v", err)
+	}
+
+	opts := config.Options{AllNamespaces: true, Mode: config.ModeContainers, Resource: config.ResourceMemory, TopN: 3, LowMemory: true}
+	opts.ApplyDefaults()
+	a := analyzer.New()
+
+	expected, err := collector.New(coreClient, metricsClient).Collect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	a.Sort(expected, opts)
+	expected = a.Filter(expected, opts)
+
+	got, err := newTopNCollector(coreClient, metricsClient, a, opts, nil).Collect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("top-n Collect failed: %v", err)
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d rows, got %d", len(expected), len(got))
+	}
+	for i := range got {
+		if got[i].Namespace != expected[i].Namespace || got[i].Name != expected[i].Name || got[i].Percentage != expected[i].Percentage {
+			t.Errorf("row %d: expected %s/%s %.1f%%, got %s/%s %.1f%%", i,
+				expected[i].Namespace, expected[i].Name, expected[i].Percentage, got[i].Namespace, got[i].Name, got[i].Percentage)
+		}
+	}
+}
+
+func TestProgressPrinter(t *testing.T) {
+	var out bytes.Buffer
+	p := &progressPrinter{w: &out, opts: config.Options{Mode: config.ModePods, Resource: config.ResourceMemory, Output: config.OutputTable}}
+
+	p.clear()
+	if out.Len() != 0 {
+		t.Fatalf("expected nothing cleared before the first redraw, got %q", out.String())
+	}
+
+	p.print([]metrics.Row{{Namespace: "web", Name: "api-0", Resource: config.ResourceMemory, UsageMi: 90, LimitMi: 100, Percentage: 90}}, 250)
+	if !strings.HasPrefix(out.String(), clearScreen+"Streaming, 250 rows so far; provisional top 1:") || !strings.Contains(out.String(), "api-0") {
+		t.Errorf("expected the provisional top rows, got %q", out.String())
+	}
+
+	out.Reset()
+	p.clear()
+	if out.String() != clearScreen {
+		t.Errorf("expected the provisional table cleared before the final output, got %q", out.String())
+	}
+
+	var none *progressPrinter
+	none.clear()
+}
@@ -7,17 +7,35 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"math"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/mchmarny/kusage/pkg/analyzer"
 	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/k8s"
+	"github.com/mchmarny/kusage/pkg/kubelet"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/output"
 )
 
 const (
 	// Name of the CLI program.
 	Name = "kusage"
+	// PluginBinary is the binary name kubectl looks up on PATH for `kubectl usage`.
+	PluginBinary = "kubectl-usage"
+	// PluginName is the program name when invoked as a kubectl plugin.
+	PluginName = "kubectl usage"
 )
 
 var (
@@ -35,6 +53,8 @@ type Parser struct {
 	programVersion string
 	commitSha      string
 	builtTime      string
+	usageOutput    io.Writer
+	input          io.Reader
 }
 
 // NewParser creates a new CLI parser instance.
@@ -44,20 +64,54 @@ func NewParser() *Parser {
 		programVersion: Version,
 		commitSha:      Commit,
 		builtTime:      Date,
+		usageOutput:    os.Stderr,
+		input:          os.Stdin,
 	}
 }
 
+// WithUsageOutput sets the writer the help text is printed to (default: stderr).
+func (p *Parser) WithUsageOutput(w io.Writer) *Parser {
+	p.usageOutput = w
+	return p
+}
+
+// WithInput sets the reader options documents are read from with run -f -
+// (default: stdin).
+func (p *Parser) WithInput(r io.Reader) *Parser {
+	p.input = r
+	return p
+}
+
 // Parse processes command-line arguments and returns a validated configuration.
 // This method implements comprehensive argument parsing with proper error handling
 // and validation, following CLI best practices for user experience.
 func (p *Parser) Parse(args []string) (*config.Options, error) {
+	if len(args) > 0 {
+		p.programName = invocationName(args[0])
+	}
 	if len(args) < 2 {
 		p.PrintUsage()
-		return nil, errors.New("missing subcommand: pods|containers")
+		return nil, errors.New("missing subcommand: pods|containers|compare|check|chargeback|pools|pending|volumes|sidecars|nodes|fragmentation|recommend|quota|waste|run|serve|snapshot|export|doctor")
 	}
 
 	// Parse subcommand
 	subcommand := args[1]
+	switch subcommand {
+	case "compare":
+		return p.parseCompare(args[2:])
+	case "check":
+		return p.parseCheck(args[2:])
+	case "run":
+		return p.parseRun(args[2:])
+	case "serve":
+		return p.parseServe(args[2:])
+	case "snapshot":
+		return p.parseSnapshot(args[2:])
+	case "export":
+		return p.parseExport(args[2:])
+	case "doctor":
+		return p.parseDoctor(args[2:])
+	}
 	mode, err := p.parseMode(subcommand)
 	if err != nil {
 		if subcommand == "-h" || subcommand == "--help" || subcommand == "help" {
@@ -65,40 +119,313 @@ func (p *Parser) Parse(args []string) (*config.Options, error) {
 			return nil, nil
 		}
 		if subcommand == "-v" || subcommand == "--version" || subcommand == "version" {
-			fmt.Printf("%s version %s (commit: %s, date: %s)\n", p.programName, p.programVersion, p.commitSha, p.builtTime)
-			return nil, nil
+			return nil, p.printVersion(os.Stdout, args[2:])
 		}
 		p.PrintUsage()
 		return nil, err
 	}
 
+	// Chargeback, node-pool, pending, volume, sidecar, node, fragmentation, recommendation, quota and waste reports have their own flag sets
+	switch mode {
+	case config.ModeChargeback:
+		return p.parseChargeback(args[2:])
+	case config.ModePools:
+		return p.parsePools(args[2:])
+	case config.ModePending:
+		return p.parsePending(args[2:])
+	case config.ModeVolumes:
+		return p.parseVolumes(args[2:])
+	case config.ModeSidecars:
+		return p.parseSidecars(args[2:])
+	case config.ModeNodes:
+		return p.parseNodes(args[2:])
+	case config.ModeFragmentation:
+		return p.parseFragmentation(args[2:])
+	case config.ModeRecommend:
+		return p.parseRecommend(args[2:])
+	case config.ModeQuota:
+		return p.parseQuota(args[2:])
+	case config.ModeWaste:
+		return p.parseWaste(args[2:])
+	}
+
+	return p.parseAnalysis(mode, args[2:], false)
+}
+
+// parseCompare parses the compare command, which runs the pods (default) or
+// containers analysis named by its first argument against several contexts.
+func (p *Parser) parseCompare(args []string) (*config.Options, error) {
+	mode := config.ModePods
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		m, err := p.parseMode(args[0])
+		if err != nil || (m != config.ModePods && m != config.ModeContainers) {
+			return nil, fmt.Errorf("unknown compare analysis %q (expected pods|containers)", args[0])
+		}
+		mode, args = m, args[1:]
+	}
+	return p.parseAnalysis(mode, args, true)
+}
+
+// parseCheck parses the check command, which evaluates the rules of a policy
+// file, or detects regressions against a baseline, for the pods (default) or
+// containers named by its first argument.
+func (p *Parser) parseCheck(args []string) (*config.Options, error) {
+	mode := config.ModePods
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		m, err := p.parseMode(args[0])
+		if err != nil || (m != config.ModePods && m != config.ModeContainers) {
+			return nil, fmt.Errorf("unknown check analysis %q (expected pods|containers)", args[0])
+		}
+		mode, args = m, args[1:]
+	}
+
+	fs := flag.NewFlagSet(p.programName+" check", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		allNamespaces = fs.Bool("A", false, "If present, check across all namespaces")
+		namespace     = fs.String("n", "default", "Namespace or glob of namespaces to use (ignored with -A)")
+		labelSelector = fs.String("l", "", "Label selector")
+		excludeNS     = fs.String("nx", "", "Regex of namespaces to exclude")
+		excludeLabels = fs.String("lx", "", "Regex of labels to exclude")
+		policyFile    = fs.String("policy", "", "Policy file with the rules to evaluate")
+		baseline      = fs.String("baseline", "", "Baseline file of accepted workload percentages to detect regressions against")
+		update        = fs.Bool("update-baseline", false, "Record the current workload percentages to the baseline file")
+		tolerance     = fs.Float64("tolerance", 5, "Percentage points a workload may exceed its baseline by")
+		noHeaders     = fs.Bool("no-headers", false, "If true, suppress headers in the output")
+		enableMetrics = fs.Bool("metrics", false, "Enable detailed performance metrics collection")
+		timeout       = fs.Duration("timeout", 30*time.Second, "Time allowed for the whole run, across all pages and retries (e.g. 5m)")
+		kube          = p.defineKubeconfigFlags(fs)
+
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	if *policyFile == "" && *baseline == "" {
+		return nil, errors.New("check requires --policy or --baseline")
+	}
+	var policy *config.Policy
+	if *policyFile != "" {
+		policy, err = config.LoadPolicy(*policyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	opts := &config.Options{
+		Namespace:      *namespace,
+		AllNamespaces:  *allNamespaces,
+		LabelSelector:  *labelSelector,
+		Mode:           mode,
+		Resource:       config.ResourceMemory,
+		NoHeaders:      *noHeaders,
+		Output:         config.OutputTable,
+		LogLevel:       level,
+		EnableMetrics:  *enableMetrics,
+		Policy:         policy,
+		Baseline:       *baseline,
+		UpdateBaseline: *update,
+		Tolerance:      *tolerance,
+		Timeout:        *timeout,
+	}
+	kube.apply(opts)
+
+	if *excludeNS != "" {
+		excludeRegex, err := regexp.Compile(*excludeNS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nx regex: %w", err)
+		}
+		opts.ExcludeNamespaces = excludeRegex
+	}
+	if *excludeLabels != "" {
+		excludeRegex, err := regexp.Compile(*excludeLabels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --lx regex: %w", err)
+		}
+		opts.ExcludeLabels = excludeRegex
+	}
+
+	p.applyPluginDefaults(fs, opts)
+	p.parseNamespacePattern(opts)
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return opts, nil
+}
+
+// parseAnalysis parses the flags of the pods and containers analysis. With
+// compare set, the flags selecting the contexts to compare are accepted too.
+func (p *Parser) parseAnalysis(mode config.Mode, args []string, compare bool) (*config.Options, error) {
+	// The profile of the active context supplies defaults the given flags override
+	var profileName string
+	if !compare {
+		name, profile, err := p.contextProfile(args)
+		if err != nil {
+			return nil, err
+		}
+		profileName, args = name, append(profile, args...)
+	}
+
 	// Create flag set for the subcommand
-	fs := flag.NewFlagSet(p.programName, flag.ExitOnError)
+	// Errors are returned to the caller instead of exiting, and the flag
+	// package's generated usage is replaced by PrintUsage
+	fs := flag.NewFlagSet(p.programName, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
 
 	// Define flags with appropriate defaults and help text
 	var (
 		allNamespaces = fs.Bool("A", false, "If present, list across all namespaces")
-		namespace     = fs.String("n", "default", "Namespace to use (ignored with -A)")
+		namespace     = fs.String("n", "default", "Namespace or glob of namespaces to use (ignored with -A)")
 		labelSelector = fs.String("l", "", "Label selector")
 		excludeNS     = fs.String("nx", "", "Regex of namespaces to exclude (e.g. ^(kube-system|gpu-operator)$)")
 		excludeLabels = fs.String("lx", "", "Regex of labels to exclude (e.g. ^(app=system|tier=infrastructure)$)")
-		resource      = fs.String("resource", "memory", "Resource to score: memory|cpu (default: memory)")
-		sortBy        = fs.String("sort", "pct", "Sort key: pct|usage|limit (default: pct)")
+		resource      = fs.String("resource", "memory", "Resource to score: memory|cpu|all (default: memory)")
+		sortBy        = fs.String("sort", "pct", "Sort key: pct|usage|limit|restarts|score|throttle|forecast (default: pct, or score with --score-expr or --weights)")
 		topN          = fs.Int("top", 20, "Show top N rows")
 		noHeaders     = fs.Bool("no-headers", false, "If true, suppress headers in the output")
+		outputFormat  = fs.String("o", "table", "Output format: table|wide|<plugin>")
+		nodeSubtotals = fs.Bool("node-subtotals", false, "Group rows by node and print a subtotal per node")
+		groupBy       = fs.String("group-by", "", "Replace rows with one row per group: node (pods only) or container-name (containers only)")
+		showNetwork   = fs.Bool("show-network", false, "Add pod network RX/TX rate columns from the kubelet Summary API (pods only)")
+		summaryOnly   = fs.Bool("summary-only", false, "Print only aggregate statistics, no per-row output")
+		costCenter    = fs.String("cost-center", "", "Namespace label or annotation to aggregate usage, limits and headroom by (e.g. cost-center)")
+		threshold     = fs.Float64("threshold", 80, "Usage percentage counted as over threshold in the summary")
+		configFile    = fs.String("config", os.Getenv(config.ConfigEnv), "Configuration file with threshold policies and context profiles (default: kusage/config.yaml in the user config dir)")
+		color         = fs.String("color", "auto", "Highlight percentages at or above their thresholds: auto|always|never")
+		watch         = fs.Duration("watch", 0, "Refresh the table at this interval until interrupted, marking rows that changed (e.g. 30s)")
+		watchDelta    = fs.Float64("watch-delta", 5, "Change of the percentage, in percentage points, that marks a row in watch mode")
+		samples       = fs.Int("samples", 1, "Collect usage this many times, --interval apart, and report min/avg/p95/max per row")
+		interval      = fs.Duration("interval", 30*time.Second, "Time between the collections of --samples")
+		why           = fs.String("why", "", "Explain how a pod is filtered and scored (e.g. pod/my-pod)")
+		scoreExpr     = fs.String("score-expr", "", "CEL expression over row computing a SCORE column (e.g. row.percentage * (row.restarts + 1))")
+		weightsFile   = fs.String("weights", "", "Weights file multiplying the score by priority class or namespace tier")
+		pricingFile   = fs.String("pricing", "", "Pricing file of the cost per CPU-hour and GiB-hour, optionally per node pool, adding a COST/h column")
+		costBy        = fs.String("cost-by", "", "Roll the costs of all rows up below the table by namespace or by this pod label (e.g. team)")
+		minPct        = fs.Float64("min-pct", 0, "Only show rows at or above this usage percentage (e.g. 80)")
+		maxPct        = fs.Float64("max-pct", 0, "Only show rows at or below this usage percentage (e.g. 20)")
+		completed     = fs.Bool("include-completed", false, "Include pods that ran to completion (phase Succeeded)")
+		crashLoop     = fs.Bool("exclude-crashloop", false, "Exclude pods with a container waiting in CrashLoopBackOff instead of marking them CRASHLOOP")
+		noLimit       = fs.Bool("include-no-limit", false, "Include pods and containers without a limit of the resource, with a - limit and percentage")
+		limitRanges   = fs.Bool("limit-ranges", false, "Give containers without a limit the default limit of their namespace LimitRange")
+		sampleFrac    = fs.Float64("sample-fraction", 1, "Analyze a random fraction of the pods, the same pods on every run (e.g. 0.1)")
+		cronJobs      = fs.String("group-cronjobs", "", "Merge the pods of CronJob executions into one row per CronJob, combining executions by: max|avg")
+		strict        = fs.Bool("strict", false, "Fail when more than --strict-threshold percent of pod metrics belong to pods missing from the pod list")
+		strictPct     = fs.Float64("strict-threshold", 5, "Percentage of pod metrics without a listed pod tolerated with --strict")
+		failAbove     = fs.String("fail-above", "", "Exit non-zero when a row's usage percentage exceeds this threshold, for every resource (e.g. 90) or per resource (e.g. memory=90,cpu=80)")
+
+		// Data source flags
+		limitsSource = fs.String("limits-source", string(config.LimitsSourceAPI), "Where pod limits and requests are read from: api|kube-state-metrics")
+		usageSource  = fs.String("source", string(config.UsageSourceMetricsServer), "Where usage is read from: metrics-server|prometheus|datadog|cadvisor")
+		usageRange   = fs.String("range", "1h", "Period usage is aggregated over with --source prometheus|datadog (e.g. 1h, 7d)")
+		aggregation  = fs.String("aggregation", string(config.AggregationAvg), "Aggregation of usage over --range: avg|max|p95")
+		forecast     = fs.Bool("forecast", false, "Add a FORECAST column with the time until memory reaches the limit at its growth over --range")
+		prom         = p.definePrometheusFlags(fs, "Prometheus query API base URL")
 
 		// Performance flags for large-scale operations
 		pageSize       = fs.Int64("page-size", 500, "Number of items to fetch per API call")
 		maxConcurrency = fs.Int("max-concurrency", 10, "Maximum number of concurrent operations")
 		enableMetrics  = fs.Bool("metrics", false, "Enable detailed performance metrics collection")
+		timeout        = fs.Duration("timeout", 30*time.Second, "Time allowed for the whole run, across all pages and retries (e.g. 5m)")
+		kube           = p.defineKubeconfigFlags(fs)
+		metricsOutput  = fs.String("metrics-output", "", "Write the metrics summary as JSON to a file, or - for stderr (implies --metrics)")
 		maxMemoryMB    = fs.Int64("max-memory", 2048, "Maximum memory usage in MB")
+		gcPercent      = fs.Int("gc-percent", 0, "GC target percentage, -1 to collect only near --max-memory (default: runtime default)")
+		lowMemory      = fs.Bool("low-memory", false, "Stream pods and metrics page by page and keep only the --top rows")
+		cacheTTL       = fs.Duration("cache-ttl", 0, "Reuse the rows collected by a previous run with the same scope for this long (e.g. 60s)")
+
+		// Diagnostic flags
+		debugBundle     = fs.String("debug-bundle", "", "Write a diagnostic bundle (options, timings, profiles) to this .tar.gz file")
+		bundleResponses = fs.Bool("debug-bundle-responses", false, "Include raw API responses in the diagnostic bundle (env values redacted)")
+		dryRun          = fs.Bool("dry-run", false, "Print the API requests the analysis would issue without issuing them")
+		apiImpact       = fs.Bool("api-impact", false, "Report the API requests issued (counts, bytes, time, throttling) on stderr at the end of the run")
+
+		logLevel     string
+		labelColumns string
+		filterExpr   string
+	)
+
+	// Log level is exposed under both a short and a long name
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	// Label columns are named as in kubectl
+	fs.StringVar(&labelColumns, "L", "", "Comma-separated pod labels shown as columns (shorthand)")
+	fs.StringVar(&labelColumns, "label-columns", "", "Comma-separated pod labels shown as columns, e.g. app,team")
+
+	// Row filters are exposed under a short and the original long name
+	fs.StringVar(&filterExpr, "filter", "", "Boolean CEL expression over the row fields selecting rows (e.g. pct > 75 && namespace != \"kube-system\")")
+	fs.StringVar(&filterExpr, "filter-expr", "", "Alias of --filter")
+
+	// Multi-cluster flags
+	var (
+		contexts string
+		minDelta float64
 	)
+	if compare {
+		fs.StringVar(&contexts, "contexts", "", "Comma-separated pair of kubeconfig contexts to compare")
+		fs.Float64Var(&minDelta, "min-delta", 0, "Only show workloads whose usage percentage changed by at least this many points")
+	} else {
+		fs.StringVar(&contexts, "contexts", "", "Comma-separated kubeconfig contexts to collect from and rank together")
+	}
 
 	// Parse flags from the remaining arguments
-	if err := fs.Parse(args[2:]); err != nil {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		if profileName != "" {
+			return nil, fmt.Errorf("failed to parse flags with the profile of context %s: %w", profileName, err)
+		}
 		return nil, fmt.Errorf("failed to parse flags: %w", err)
 	}
 
+	output, err := p.parseOutput(*outputFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := p.parseLimitsSource(*limitsSource)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := p.parseUsageSource(*usageSource)
+	if err != nil {
+		return nil, err
+	}
+
+	agg, err := p.parseAggregation(*aggregation)
+	if err != nil {
+		return nil, err
+	}
+
+	window, err := p.parsePeriod(*usageRange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --range: %w", err)
+	}
+
 	// Build and validate configuration
 	opts := &config.Options{
 		Namespace:     *namespace,
@@ -109,13 +436,151 @@ func (p *Parser) Parse(args []string) (*config.Options, error) {
 		Sort:          p.parseSort(*sortBy),
 		TopN:          *topN,
 		NoHeaders:     *noHeaders,
-		Timeout:       30 * time.Second, // Default timeout for Kubernetes operations
+		Output:        output,
+		LogLevel:      level,
+		NodeSubtotals: *nodeSubtotals,
+		ShowNetwork:   *showNetwork,
+		SummaryOnly:   *summaryOnly,
+		CostCenterKey: *costCenter,
+		CostBy:        *costBy,
+		Threshold:     *threshold,
+		LimitsSource:  source,
+		Source:        usage,
+		UsageRange:    window,
+		Aggregation:   agg,
+		Timeout:       *timeout,
+
+		IncludeCompleted:   *completed,
+		ExcludeCrashLoop:   *crashLoop,
+		IncludeNoLimit:     *noLimit,
+		LimitRanges:        *limitRanges,
+		SampleFraction:     *sampleFrac,
+		Forecast:           *forecast,
+		CronJobAggregation: config.Aggregation(strings.ToLower(*cronJobs)),
+		GroupBy:            config.GroupKey(strings.ToLower(*groupBy)),
+		Strict:             *strict,
+		StrictThreshold:    *strictPct,
 
 		// Performance options for large-scale operations
 		PageSize:       *pageSize,
 		MaxConcurrency: *maxConcurrency,
-		EnableMetrics:  *enableMetrics,
+		EnableMetrics:  *enableMetrics || *metricsOutput != "" || *debugBundle != "",
+		MetricsOutput:  *metricsOutput,
 		MaxMemoryMB:    *maxMemoryMB,
+		LowMemory:      *lowMemory,
+		CacheTTL:       *cacheTTL,
+		Watch:          *watch,
+		WatchDelta:     *watchDelta,
+		Samples:        *samples,
+		Interval:       *interval,
+		GCPercent:      *gcPercent,
+
+		// Diagnostic options
+		DebugBundle:          *debugBundle,
+		DebugBundleResponses: *bundleResponses,
+		DryRun:               *dryRun,
+		APIImpact:            *apiImpact,
+	}
+	kube.apply(opts)
+
+	// Label columns must name valid label keys
+	for _, key := range strings.Split(labelColumns, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid -L label %q: %s", key, strings.Join(errs, "; "))
+			}
+			opts.LabelColumns = append(opts.LabelColumns, key)
+		}
+	}
+
+	// Network rates are measured between two reads of each kubelet
+	if opts.ShowNetwork && !flagSet(fs, "timeout") {
+		opts.Timeout += kubelet.DefaultInterval
+	}
+
+	// A sample of no pods would report nothing
+	if opts.SampleFraction <= 0 {
+		return nil, fmt.Errorf("invalid --sample-fraction %v (expected more than 0 and at most 1)", opts.SampleFraction)
+	}
+
+	// Thresholds without a resource apply to the resources analyzed
+	if *failAbove != "" {
+		opts.FailAbove, err = p.parseFailAbove(*failAbove, opts.Resource)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Samples are collected --interval apart within the timeout
+	if opts.Samples < 1 {
+		return nil, fmt.Errorf("invalid --samples %d (expected at least 1)", opts.Samples)
+	}
+	if opts.Samples > 1 && !flagSet(fs, "timeout") {
+		opts.Timeout += time.Duration(opts.Samples-1) * opts.Interval
+	}
+
+	// Compile the score expression; unless --sort is given, rows are ranked by score
+	if *scoreExpr != "" {
+		score, err := analyzer.CompileScore(*scoreExpr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --score-expr: %w", err)
+		}
+		opts.ScoreExpr = score
+		if !flagSet(fs, "sort") {
+			opts.Sort = config.SortByScore
+		}
+	}
+
+	// Weights multiply the score, or the percentage without a score expression
+	if *weightsFile != "" {
+		weights, err := config.LoadWeights(*weightsFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.Weights = weights
+		if !flagSet(fs, "sort") {
+			opts.Sort = config.SortByScore
+		}
+	}
+
+	// Prices turn the usage of every row into an hourly cost
+	if *pricingFile != "" {
+		pricing, err := config.LoadPricing(*pricingFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.Pricing = pricing
+	}
+	if opts.CostBy != "" && opts.CostBy != config.CostByNamespace {
+		if errs := validation.IsQualifiedName(opts.CostBy); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid --cost-by label %q: %s", opts.CostBy, strings.Join(errs, "; "))
+		}
+	}
+
+	// Compile the row filter expression
+	if filterExpr != "" {
+		filter, err := analyzer.CompileFilter(filterExpr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --filter: %w", err)
+		}
+		opts.FilterExpr = filter
+	}
+
+	// Percentage bounds apply only when given, so 0 remains a valid bound
+	if flagSet(fs, "min-pct") {
+		opts.MinPercentage = minPct
+	}
+	if flagSet(fs, "max-pct") {
+		opts.MaxPercentage = maxPct
+	}
+
+	// Parse and validate the pod to trace
+	if *why != "" {
+		podName, err := p.parseWhy(*why)
+		if err != nil {
+			return nil, err
+		}
+		opts.WhyPod = podName
 	}
 
 	// Parse and validate namespace exclusion regex
@@ -136,6 +601,45 @@ func (p *Parser) Parse(args []string) (*config.Options, error) {
 		opts.ExcludeLabels = excludeRegex
 	}
 
+	// Load threshold policies; only an explicitly named file must exist
+	configPath, required := *configFile, *configFile != ""
+	if !required {
+		configPath = config.DefaultConfigPath()
+	}
+	file, err := config.LoadFile(configPath, required)
+	if err != nil {
+		return nil, err
+	}
+	opts.Thresholds = file.Thresholds
+
+	opts.Color, err = p.parseColor(*color)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the contexts to collect from, or to compare
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(contexts, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			if seen[name] {
+				return nil, fmt.Errorf("--contexts lists context %q more than once", name)
+			}
+			seen[name] = true
+			opts.Contexts = append(opts.Contexts, name)
+		}
+	}
+	if compare {
+		if len(opts.Contexts) != 2 {
+			return nil, fmt.Errorf("--contexts requires two contexts (e.g. prod-a,prod-b), got %q", contexts)
+		}
+		opts.Compare = true
+		opts.MinDelta = minDelta
+	}
+
+	prom.apply(opts)
+	p.applyPluginDefaults(fs, opts)
+	p.parseNamespacePattern(opts)
+
 	// Validate the complete configuration
 	if err := opts.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
@@ -144,79 +648,1177 @@ func (p *Parser) Parse(args []string) (*config.Options, error) {
 	return opts, nil
 }
 
-// parseMode converts a string subcommand to a Mode value.
-func (p *Parser) parseMode(subcommand string) (config.Mode, error) {
-	switch subcommand {
-	case string(config.ModePods):
-		return config.ModePods, nil
-	case string(config.ModeContainers):
-		return config.ModeContainers, nil
-	default:
-		return "", fmt.Errorf("unknown subcommand %q (expected pods|containers)", subcommand)
+// parseChargeback parses the flags of the chargeback subcommand.
+func (p *Parser) parseChargeback(args []string) (*config.Options, error) {
+	fs := flag.NewFlagSet(p.programName+" chargeback", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		namespace     = fs.String("n", "", "Namespace to report on (default: all namespaces)")
+		groupLabel    = fs.String("group-label", "team", "Pod label to group totals by")
+		period        = fs.String("period", "30d", "Reporting period ending now (e.g. 12h, 7d, 30d)")
+		prom          = p.definePrometheusFlags(fs, "Prometheus query API base URL")
+		outputFormat  = fs.String("o", "table", "Output format: table|csv")
+		noHeaders     = fs.Bool("no-headers", false, "If true, suppress headers in the output")
+		enableMetrics = fs.Bool("metrics", false, "Enable detailed performance metrics collection")
+		// Range subqueries over long periods are slower than list calls
+		timeout = fs.Duration("timeout", 2*time.Minute, "Time allowed for the whole run, across all pages and retries (e.g. 5m)")
+		kube    = p.defineKubeconfigFlags(fs)
+
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
 	}
-}
 
-// parseResource converts a string resource type to a ResourceKind value.
-func (p *Parser) parseResource(resource string) config.ResourceKind {
-	switch strings.ToLower(resource) {
-	case "cpu":
-		return config.ResourceCPU
-	default:
-		return config.ResourceMemory
+	periodDuration, err := p.parsePeriod(*period)
+	if err != nil {
+		return nil, err
 	}
-}
 
-// parseSort converts a string sort key to a SortKey value.
-func (p *Parser) parseSort(sortKey string) config.SortKey {
-	switch strings.ToLower(sortKey) {
-	case "usage":
-		return config.SortByUsage
-	case "limit":
-		return config.SortByLimit
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	var output config.OutputFormat
+	switch strings.ToLower(*outputFormat) {
+	case "", string(config.OutputTable):
+		output = config.OutputTable
+	case string(config.OutputCSV):
+		output = config.OutputCSV
 	default:
-		return config.SortByPercentage
+		return nil, fmt.Errorf("unknown output format %q (expected table|csv)", *outputFormat)
 	}
-}
 
-// PrintUsage outputs comprehensive usage information.
-// This method provides detailed help text following Unix CLI conventions
-// and includes examples for common use cases.
-func (p *Parser) PrintUsage() {
-	fmt.Fprintf(os.Stderr, `kusage — rank pods/containers by resource usage-to-limit ratio
+	opts := &config.Options{
+		Namespace:     *namespace,
+		AllNamespaces: *namespace == "",
+		Mode:          config.ModeChargeback,
+		NoHeaders:     *noHeaders,
+		Output:        output,
+		LogLevel:      level,
+		GroupLabel:    *groupLabel,
+		Period:        periodDuration,
+		EnableMetrics: *enableMetrics,
+		Timeout:       *timeout,
+	}
+	kube.apply(opts)
 
-Usage:
-  kusage pods [flags]
-  kusage containers [flags]
+	prom.apply(opts)
 
-Basic Flags:
-  -A                         All namespaces
-  -n string                  Namespace (ignored with -A) (default "default")
-  -l string                  Label selector
-  --nx string                Regex of namespaces to exclude (e.g. ^(kube-system|gpu-operator)$)
-  --lx string                Regex of labels to exclude (e.g. ^(app=system|tier=infrastructure)$)
-  --resource string          Resource to score: memory|cpu (default memory)
-  --sort string              Sort key: pct|usage|limit (default pct)
-  --top int                  Show top N rows (default 20)
-  --no-headers               Suppress headers
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
 
-Performance Flags (for large clusters):
-  --page-size int            Items to fetch per API call (default 500)
-  --max-concurrency int      Maximum concurrent operations (default 10)
-  --metrics                  Enable performance metrics collection (default false)
-  --max-memory int           Maximum memory usage in MB (default 2048)
+	return opts, nil
+}
 
-Other Flags:
-  -h, --help                 Show help
-  -v, --version              Show version
+// parsePools parses the flags of the pools subcommand.
+func (p *Parser) parsePools(args []string) (*config.Options, error) {
+	fs := flag.NewFlagSet(p.programName+" pools", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
 
-Requirements:
-  - pods (get, list) permissions in target namespaces
-  - pods/metrics (get, list) permissions  via metrics.k8s.io API group
-  - metrics-server must be installed and running in the cluster
+	var (
+		poolLabel     = fs.String("pool-label", "cloud.google.com/gke-nodepool", "Node label to group nodes into pools by")
+		resource      = fs.String("resource", "memory", "Resource to report: memory|cpu (default: memory)")
+		prom          = p.definePrometheusFlags(fs, "Prometheus query API base URL used to project growth")
+		growthWindow  = fs.String("growth-window", "7d", "History used to measure usage growth (e.g. 7d, 4w)")
+		noHeaders     = fs.Bool("no-headers", false, "If true, suppress headers in the output")
+		enableMetrics = fs.Bool("metrics", false, "Enable detailed performance metrics collection")
+		timeout       = fs.Duration("timeout", 30*time.Second, "Time allowed for the whole run, across all pages and retries (e.g. 5m)")
+		kube          = p.defineKubeconfigFlags(fs)
 
-Examples:
-  kusage pods -A --nx '^(kube-system|monitoring)$' --lx '^(app=system|tier=infrastructure)$'
-  kusage containers -n gpu-operator --resource cpu --sort memory --top 50
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
 
-`)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	window, err := p.parsePeriod(*growthWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &config.Options{
+		AllNamespaces: true,
+		Mode:          config.ModePools,
+		Resource:      p.parseResource(*resource),
+		NoHeaders:     *noHeaders,
+		Output:        config.OutputTable,
+		LogLevel:      level,
+		PoolLabel:     *poolLabel,
+		GrowthWindow:  window,
+		EnableMetrics: *enableMetrics,
+		Timeout:       *timeout,
+	}
+	kube.apply(opts)
+
+	prom.apply(opts)
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return opts, nil
+}
+
+// parsePending parses the flags of the pending subcommand.
+func (p *Parser) parsePending(args []string) (*config.Options, error) {
+	fs := flag.NewFlagSet(p.programName+" pending", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		allNamespaces = fs.Bool("A", false, "If present, list across all namespaces")
+		namespace     = fs.String("n", "default", "Namespace or glob of namespaces to use (ignored with -A)")
+		labelSelector = fs.String("l", "", "Label selector")
+		excludeNS     = fs.String("nx", "", "Regex of namespaces to exclude")
+		excludeLabels = fs.String("lx", "", "Regex of labels to exclude")
+		noHeaders     = fs.Bool("no-headers", false, "If true, suppress headers in the output")
+		enableMetrics = fs.Bool("metrics", false, "Enable detailed performance metrics collection")
+		timeout       = fs.Duration("timeout", 30*time.Second, "Time allowed for the whole run, across all pages and retries (e.g. 5m)")
+		kube          = p.defineKubeconfigFlags(fs)
+
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &config.Options{
+		Namespace:     *namespace,
+		AllNamespaces: *allNamespaces,
+		LabelSelector: *labelSelector,
+		Mode:          config.ModePending,
+		NoHeaders:     *noHeaders,
+		Output:        config.OutputTable,
+		LogLevel:      level,
+		EnableMetrics: *enableMetrics,
+		Timeout:       *timeout,
+	}
+	kube.apply(opts)
+
+	if *excludeNS != "" {
+		excludeRegex, err := regexp.Compile(*excludeNS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nx regex: %w", err)
+		}
+		opts.ExcludeNamespaces = excludeRegex
+	}
+	if *excludeLabels != "" {
+		excludeRegex, err := regexp.Compile(*excludeLabels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --lx regex: %w", err)
+		}
+		opts.ExcludeLabels = excludeRegex
+	}
+
+	p.applyPluginDefaults(fs, opts)
+	p.parseNamespacePattern(opts)
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return opts, nil
+}
+
+// parseVolumes parses the flags of the volumes subcommand.
+func (p *Parser) parseVolumes(args []string) (*config.Options, error) {
+	fs := flag.NewFlagSet(p.programName+" volumes", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		allNamespaces = fs.Bool("A", false, "If present, list across all namespaces")
+		namespace     = fs.String("n", "default", "Namespace or glob of namespaces to use (ignored with -A)")
+		labelSelector = fs.String("l", "", "Label selector of the pods mounting the volumes")
+		excludeNS     = fs.String("nx", "", "Regex of namespaces to exclude")
+		excludeLabels = fs.String("lx", "", "Regex of labels to exclude")
+		topN          = fs.Int("top", 20, "Show top N volumes")
+		noHeaders     = fs.Bool("no-headers", false, "If true, suppress headers in the output")
+		enableMetrics = fs.Bool("metrics", false, "Enable detailed performance metrics collection")
+		timeout       = fs.Duration("timeout", 30*time.Second, "Time allowed for the whole run, across all pages and retries (e.g. 5m)")
+		kube          = p.defineKubeconfigFlags(fs)
+
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &config.Options{
+		Namespace:     *namespace,
+		AllNamespaces: *allNamespaces,
+		LabelSelector: *labelSelector,
+		Mode:          config.ModeVolumes,
+		TopN:          *topN,
+		NoHeaders:     *noHeaders,
+		Output:        config.OutputTable,
+		LogLevel:      level,
+		EnableMetrics: *enableMetrics,
+		Timeout:       *timeout,
+	}
+	kube.apply(opts)
+
+	if *excludeNS != "" {
+		excludeRegex, err := regexp.Compile(*excludeNS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nx regex: %w", err)
+		}
+		opts.ExcludeNamespaces = excludeRegex
+	}
+	if *excludeLabels != "" {
+		excludeRegex, err := regexp.Compile(*excludeLabels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --lx regex: %w", err)
+		}
+		opts.ExcludeLabels = excludeRegex
+	}
+
+	p.applyPluginDefaults(fs, opts)
+	p.parseNamespacePattern(opts)
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return opts, nil
+}
+
+// parseQuota parses the flags of the quota subcommand. Quotas cover whole
+// namespaces, so pods are not selected by label.
+func (p *Parser) parseQuota(args []string) (*config.Options, error) {
+	fs := flag.NewFlagSet(p.programName+" quota", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		allNamespaces = fs.Bool("A", false, "If present, list across all namespaces")
+		namespace     = fs.String("n", "default", "Namespace or glob of namespaces to use (ignored with -A)")
+		excludeNS     = fs.String("nx", "", "Regex of namespaces to exclude")
+		threshold     = fs.Float64("threshold", 90, "Share of a hard limit in use at which a quota is near exhaustion")
+		noHeaders     = fs.Bool("no-headers", false, "If true, suppress headers in the output")
+		enableMetrics = fs.Bool("metrics", false, "Enable detailed performance metrics collection")
+		timeout       = fs.Duration("timeout", 30*time.Second, "Time allowed for the whole run, across all pages and retries (e.g. 5m)")
+		kube          = p.defineKubeconfigFlags(fs)
+
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &config.Options{
+		Namespace:     *namespace,
+		AllNamespaces: *allNamespaces,
+		Mode:          config.ModeQuota,
+		Threshold:     *threshold,
+		NoHeaders:     *noHeaders,
+		Output:        config.OutputTable,
+		LogLevel:      level,
+		EnableMetrics: *enableMetrics,
+		Timeout:       *timeout,
+	}
+	kube.apply(opts)
+
+	if *excludeNS != "" {
+		excludeRegex, err := regexp.Compile(*excludeNS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nx regex: %w", err)
+		}
+		opts.ExcludeNamespaces = excludeRegex
+	}
+
+	p.applyPluginDefaults(fs, opts)
+	p.parseNamespacePattern(opts)
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return opts, nil
+}
+
+// parseSidecars parses the flags of the sidecars subcommand.
+func (p *Parser) parseSidecars(args []string) (*config.Options, error) {
+	fs := flag.NewFlagSet(p.programName+" sidecars", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		allNamespaces = fs.Bool("A", false, "If present, list across all namespaces")
+		namespace     = fs.String("n", "default", "Namespace or glob of namespaces to use (ignored with -A)")
+		labelSelector = fs.String("l", "", "Label selector")
+		excludeNS     = fs.String("nx", "", "Regex of namespaces to exclude")
+		excludeLabels = fs.String("lx", "", "Regex of labels to exclude")
+		sidecars      = fs.String("sidecars", config.DefaultSidecarPatterns, "Comma-separated globs matched against container and image names to identify sidecars")
+		resource      = fs.String("resource", "memory", "Resource whose sidecar share ranks pods: memory|cpu (default: memory)")
+		topN          = fs.Int("top", 20, "Show top N pods")
+		noHeaders     = fs.Bool("no-headers", false, "If true, suppress headers in the output")
+		enableMetrics = fs.Bool("metrics", false, "Enable detailed performance metrics collection")
+		timeout       = fs.Duration("timeout", 30*time.Second, "Time allowed for the whole run, across all pages and retries (e.g. 5m)")
+		kube          = p.defineKubeconfigFlags(fs)
+
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &config.Options{
+		Namespace:     *namespace,
+		AllNamespaces: *allNamespaces,
+		LabelSelector: *labelSelector,
+		Mode:          config.ModeSidecars,
+		Resource:      p.parseResource(*resource),
+		TopN:          *topN,
+		NoHeaders:     *noHeaders,
+		Output:        config.OutputTable,
+		LogLevel:      level,
+		EnableMetrics: *enableMetrics,
+		Timeout:       *timeout,
+	}
+	kube.apply(opts)
+	for _, pattern := range strings.Split(*sidecars, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid --sidecars pattern %q: %w", pattern, err)
+		}
+		opts.SidecarPatterns = append(opts.SidecarPatterns, pattern)
+	}
+
+	if *excludeNS != "" {
+		excludeRegex, err := regexp.Compile(*excludeNS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nx regex: %w", err)
+		}
+		opts.ExcludeNamespaces = excludeRegex
+	}
+	if *excludeLabels != "" {
+		excludeRegex, err := regexp.Compile(*excludeLabels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --lx regex: %w", err)
+		}
+		opts.ExcludeLabels = excludeRegex
+	}
+
+	p.applyPluginDefaults(fs, opts)
+	p.parseNamespacePattern(opts)
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return opts, nil
+}
+
+// parseNodes parses the flags of the nodes subcommand.
+func (p *Parser) parseNodes(args []string) (*config.Options, error) {
+	fs := flag.NewFlagSet(p.programName+" nodes", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		showDensity   = fs.Bool("show-density", false, "Add PODS and DENSITY columns with pods scheduled against pod capacity")
+		schedulable   = fs.Bool("schedulable-only", false, "Leave cordoned nodes and nodes with NoSchedule or NoExecute taints out of the TOTAL")
+		noHeaders     = fs.Bool("no-headers", false, "If true, suppress headers in the output")
+		enableMetrics = fs.Bool("metrics", false, "Enable detailed performance metrics collection")
+		timeout       = fs.Duration("timeout", 30*time.Second, "Time allowed for the whole run, across all pages and retries (e.g. 5m)")
+		kube          = p.defineKubeconfigFlags(fs)
+
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &config.Options{
+		AllNamespaces:   true,
+		Mode:            config.ModeNodes,
+		ShowDensity:     *showDensity,
+		SchedulableOnly: *schedulable,
+		NoHeaders:       *noHeaders,
+		Output:          config.OutputTable,
+		LogLevel:        level,
+		EnableMetrics:   *enableMetrics,
+		Timeout:         *timeout,
+	}
+	kube.apply(opts)
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return opts, nil
+}
+
+// parseFragmentation parses the flags of the fragmentation subcommand.
+func (p *Parser) parseFragmentation(args []string) (*config.Options, error) {
+	fs := flag.NewFlagSet(p.programName+" fragmentation", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		podCPU        = fs.String("pod-cpu", "", "CPU request of the pod shape free capacity is packed with, e.g. 500m (default: mean pod request)")
+		podMemory     = fs.String("pod-memory", "", "Memory request of the pod shape free capacity is packed with, e.g. 1Gi (default: mean pod request)")
+		noHeaders     = fs.Bool("no-headers", false, "If true, suppress headers in the output")
+		enableMetrics = fs.Bool("metrics", false, "Enable detailed performance metrics collection")
+		timeout       = fs.Duration("timeout", 30*time.Second, "Time allowed for the whole run, across all pages and retries (e.g. 5m)")
+		kube          = p.defineKubeconfigFlags(fs)
+
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &config.Options{
+		AllNamespaces: true,
+		Mode:          config.ModeFragmentation,
+		NoHeaders:     *noHeaders,
+		Output:        config.OutputTable,
+		LogLevel:      level,
+		EnableMetrics: *enableMetrics,
+		Timeout:       *timeout,
+	}
+	kube.apply(opts)
+
+	if *podCPU != "" {
+		q, err := resource.ParseQuantity(*podCPU)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --pod-cpu %q: %w", *podCPU, err)
+		}
+		opts.PodCPUMc = q.MilliValue()
+	}
+	if *podMemory != "" {
+		q, err := resource.ParseQuantity(*podMemory)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --pod-memory %q: %w", *podMemory, err)
+		}
+		opts.PodMemoryMi = float64(q.Value()) / metrics.BytesPerMi
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return opts, nil
+}
+
+// parsePeriod parses a duration that, in addition to Go duration units,
+// accepts whole days (d) and weeks (w), such as 30d or 2w.
+func (p *Parser) parsePeriod(value string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if count, found := strings.CutSuffix(value, suffix); found {
+			n, err := strconv.Atoi(count)
+			if err != nil || n <= 0 || int64(n) > math.MaxInt64/int64(unit) {
+				return 0, fmt.Errorf("invalid period %q (expected e.g. 12h, 7d or 4w)", value)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid period %q (expected e.g. 12h, 7d or 4w)", value)
+	}
+	return d, nil
+}
+
+// parseMode converts a string subcommand to a Mode value.
+func (p *Parser) parseMode(subcommand string) (config.Mode, error) {
+	switch subcommand {
+	case string(config.ModePods):
+		return config.ModePods, nil
+	case string(config.ModeContainers):
+		return config.ModeContainers, nil
+	case string(config.ModeChargeback):
+		return config.ModeChargeback, nil
+	case string(config.ModePools):
+		return config.ModePools, nil
+	case string(config.ModePending):
+		return config.ModePending, nil
+	case string(config.ModeVolumes):
+		return config.ModeVolumes, nil
+	case string(config.ModeSidecars):
+		return config.ModeSidecars, nil
+	case string(config.ModeNodes):
+		return config.ModeNodes, nil
+	case string(config.ModeFragmentation):
+		return config.ModeFragmentation, nil
+	case string(config.ModeRecommend):
+		return config.ModeRecommend, nil
+	case string(config.ModeQuota):
+		return config.ModeQuota, nil
+	case string(config.ModeWaste):
+		return config.ModeWaste, nil
+	default:
+		return "", fmt.Errorf("unknown subcommand %q (expected pods|containers|compare|chargeback|pools|pending|volumes|sidecars|nodes|fragmentation|recommend|quota|waste)", subcommand)
+	}
+}
+
+// parseResource converts a string resource type to a ResourceKind value.
+func (p *Parser) parseResource(resource string) config.ResourceKind {
+	switch strings.ToLower(resource) {
+	case "cpu":
+		return config.ResourceCPU
+	case "all":
+		return config.ResourceAll
+	default:
+		return config.ResourceMemory
+	}
+}
+
+// parseSort converts a string sort key to a SortKey value.
+func (p *Parser) parseSort(sortKey string) config.SortKey {
+	switch strings.ToLower(sortKey) {
+	case "usage":
+		return config.SortByUsage
+	case "limit":
+		return config.SortByLimit
+	case "restarts":
+		return config.SortByRestarts
+	case "score":
+		return config.SortByScore
+	case "throttle":
+		return config.SortByThrottle
+	case "forecast":
+		return config.SortByForecast
+	default:
+		return config.SortByPercentage
+	}
+}
+
+// flagSet reports whether the named flag was explicitly set on the command line.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// parseOutput converts a string output format to an OutputFormat value.
+func (p *Parser) parseOutput(format string) (config.OutputFormat, error) {
+	switch strings.ToLower(format) {
+	case "", string(config.OutputTable):
+		return config.OutputTable, nil
+	case string(config.OutputWide):
+		return config.OutputWide, nil
+	case string(config.OutputJSON):
+		return config.OutputJSON, nil
+	default:
+		// Any other name selects a kusage-output-<name> plugin on PATH
+		if name := strings.ToLower(format); output.ValidPluginName(name) {
+			return config.OutputFormat(name), nil
+		}
+		return "", fmt.Errorf("unknown output format %q (expected table|wide|json or an output plugin name)", format)
+	}
+}
+
+// parseLimitsSource validates the source pod limits are read from.
+func (p *Parser) parseLimitsSource(value string) (config.LimitsSource, error) {
+	switch config.LimitsSource(value) {
+	case "", config.LimitsSourceAPI:
+		return config.LimitsSourceAPI, nil
+	case config.LimitsSourceKubeStateMetrics, "ksm":
+		return config.LimitsSourceKubeStateMetrics, nil
+	default:
+		return "", fmt.Errorf("unknown limits source %q (expected api|kube-state-metrics)", value)
+	}
+}
+
+// parseUsageSource validates the source usage is read from.
+func (p *Parser) parseUsageSource(value string) (config.UsageSource, error) {
+	switch config.UsageSource(value) {
+	case "", config.UsageSourceMetricsServer:
+		return config.UsageSourceMetricsServer, nil
+	case config.UsageSourcePrometheus, config.UsageSourceDatadog, config.UsageSourceCAdvisor:
+		return config.UsageSource(value), nil
+	default:
+		return "", fmt.Errorf("unknown source %q (expected metrics-server|prometheus|datadog|cadvisor)", value)
+	}
+}
+
+// parseAggregation validates how usage over a range is combined.
+func (p *Parser) parseAggregation(value string) (config.Aggregation, error) {
+	switch config.Aggregation(value) {
+	case "", config.AggregationAvg:
+		return config.AggregationAvg, nil
+	case config.AggregationMax, config.AggregationP95:
+		return config.Aggregation(value), nil
+	default:
+		return "", fmt.Errorf("unknown aggregation %q (expected avg|max|p95)", value)
+	}
+}
+
+// parseColor reports whether color is enabled for the --color value. Automatic
+// color requires stdout to be a terminal and NO_COLOR to be unset.
+func (p *Parser) parseColor(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "", "auto":
+		if _, set := os.LookupEnv("NO_COLOR"); set {
+			return false, nil
+		}
+		return isTerminal(os.Stdout), nil
+	default:
+		return false, fmt.Errorf("invalid --color %q (expected auto|always|never)", value)
+	}
+}
+
+// parseFailAbove parses a --fail-above value: a percentage applied to every
+// analyzed resource, or comma-separated resource=percentage pairs.
+func (p *Parser) parseFailAbove(value string, resource config.ResourceKind) (map[config.ResourceKind]float64, error) {
+	if threshold, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+		if resource == config.ResourceAll {
+			return map[config.ResourceKind]float64{config.ResourceMemory: threshold, config.ResourceCPU: threshold}, nil
+		}
+		return map[config.ResourceKind]float64{resource: threshold}, nil
+	}
+
+	thresholds := make(map[config.ResourceKind]float64)
+	for _, pair := range strings.Split(value, ",") {
+		name, number, found := strings.Cut(strings.TrimSpace(pair), "=")
+		threshold, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+		if !found || err != nil {
+			return nil, fmt.Errorf("invalid --fail-above %q (expected e.g. 90 or memory=90,cpu=80)", value)
+		}
+		kind := config.ResourceKind(strings.ToLower(strings.TrimSpace(name)))
+		if _, dup := thresholds[kind]; dup {
+			return nil, fmt.Errorf("--fail-above sets resource %q more than once", name)
+		}
+		thresholds[kind] = threshold
+	}
+	return thresholds, nil
+}
+
+// parseNamespacePattern treats a -n value containing glob metacharacters,
+// such as team-payments-*, as a pattern of namespaces rather than a name.
+// The matching namespaces are resolved by the collector from the namespace list.
+func (p *Parser) parseNamespacePattern(opts *config.Options) {
+	if opts.AllNamespaces || !strings.ContainsAny(opts.Namespace, "*?[") {
+		return
+	}
+	opts.NamespacePattern = opts.Namespace
+	opts.Namespace = ""
+	opts.AllNamespaces = true
+}
+
+// applyPluginDefaults adjusts the defaults of opts when invoked as a kubectl
+// plugin: as in kubectl, a namespace not given with -n or -A is the namespace
+// of the kubeconfig context rather than "default".
+func (p *Parser) applyPluginDefaults(fs *flag.FlagSet, opts *config.Options) {
+	if p.programName != PluginName || opts.AllNamespaces || flagSet(fs, "n") {
+		return
+	}
+	opts.Namespace = k8s.ContextNamespace(opts.Kubeconfig, opts.Context)
+}
+
+// parseLogLevel converts a string log level to a slog.Level value.
+func (p *Parser) parseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "", "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelWarn, fmt.Errorf("unknown log level %q (expected debug|info|warn|error)", level)
+	}
+}
+
+// parseWhy extracts the pod name from a --why argument in kubectl's
+// TYPE/NAME form (pod/my-pod). A bare pod name is accepted as well.
+func (p *Parser) parseWhy(value string) (string, error) {
+	kind, name, found := strings.Cut(value, "/")
+	if !found {
+		return value, nil
+	}
+	switch strings.ToLower(kind) {
+	case "pod", "pods", "po":
+	default:
+		return "", fmt.Errorf("invalid --why %q (expected pod/NAME)", value)
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid --why %q (expected pod/NAME)", value)
+	}
+	return name, nil
+}
+
+// PrintUsage outputs comprehensive usage information.
+// This method provides detailed help text following Unix CLI conventions
+// and includes examples for common use cases.
+func (p *Parser) PrintUsage() {
+	usage := fmt.Sprintf(`kusage — rank pods/containers by resource usage-to-limit ratio
+
+Usage:
+  kusage pods [flags]
+  kusage containers [flags]
+  kusage compare [pods|containers] --contexts A,B [flags]
+  kusage check [pods|containers] [--policy FILE] [--baseline FILE] [flags]
+  kusage chargeback [flags]
+  kusage pools [flags]
+  kusage pending [flags]
+  kusage volumes [flags]
+  kusage sidecars [flags]
+  kusage nodes [flags]
+  kusage fragmentation [flags]
+  kusage recommend [--request-headroom 1.2] [--limit-headroom 1.5] [--patch-dir DIR [--kustomize]] [--kubectl] [flags]
+  kusage quota [--threshold 90] [flags]
+  kusage waste [--basis requests|limits] [flags]
+  kusage run -f FILE|- [flags]
+  kusage serve [pods|containers] [--listen :9090] [--interval 60s] [flags]
+  kusage snapshot save [pods|containers] [flags]
+  kusage snapshot list [--dir DIR]
+  kusage export [--format csv] [--include-labels] [--samples N] [flags]
+  kusage doctor [-n NAMESPACE|-A] [flags]
+  kusage version [-o json]
+
+Basic Flags:
+  -A                         All namespaces
+  -n string                  Namespace, or glob of namespaces (e.g. team-*) (ignored with -A) (default "default")
+  -l string                  Label selector
+  --nx string                Regex of namespaces to exclude (e.g. ^(kube-system|gpu-operator)$)
+  --lx string                Regex of labels to exclude (e.g. ^(app=system|tier=infrastructure)$)
+  --resource string          Resource to score: memory|cpu|all (default memory); all shows memory and CPU side by side,
+                             ranked by the higher percentage (usage and limit sort by memory)
+  --sort string              Sort key: pct|usage|limit|restarts|score|throttle|forecast (default pct, or score with --score-expr or --weights);
+                             throttle (share of CFS periods throttled) needs --resource cpu and --source prometheus|cadvisor;
+                             forecast (soonest first) needs --forecast
+  --top int                  Show top N rows (default 20)
+  --no-headers               Suppress headers
+  -o string                  Output format: table|wide|json (wide adds metadata columns, json prints the rows as an array)
+                             or the name of a kusage-output-<name> plugin on PATH that receives rows as NDJSON (default table)
+  -L, --label-columns string Comma-separated pod labels shown as columns after the others, as in kubectl (e.g. app,team)
+  --node-subtotals           Group rows by node and print a usage subtotal per node
+  --group-by string          Replace the pod rows with one row per node summing the usage and limits of the pods
+                             scheduled on it, ranking nodes by how close their pods are to their limits: node (pods only);
+                             or merge the containers of the same name across the replicas of a workload into one row with
+                             their count and mean, p95 and max %%USED, ranked by the max: container-name (containers only)
+  --show-network            Add RX/s and TX/s columns with pod network rates from the kubelet Summary API
+                             (pods only; requires get on nodes/proxy, adds ~15s)
+  --summary-only             Print only aggregate statistics (totals, averages, distribution)
+  --cost-center string       Aggregate usage, limits and unused headroom per cost center read from this namespace
+                             label or annotation (requires get/list namespaces)
+  --pricing string           YAML file of the cost per CPU core-hour and GiB-hour, optionally per node pool, adding an
+                             hourly COST/h column billed on the greater of request and usage
+  --cost-by string           Roll the costs of all rows up below the table by namespace or by the value of this pod
+                             label (requires --pricing)
+  --threshold float          Usage percentage counted as over threshold in the summary and the default
+                             warning threshold (default 80)
+  --config string            Config file with per-namespace/selector warning and critical thresholds and per-context
+                             profiles of default flags (default $KUSAGE_CONFIG or kusage/config.yaml in the user config dir)
+  --color string             Highlight %%USED at or above the warning/critical threshold: auto|always|never (default auto)
+  --watch duration           Refresh the table at this interval until interrupted (e.g. 30s), with a CHANGE column marking
+                             rows that entered the top rows (NEW) or moved by --watch-delta, and rows that are gone (GONE);
+                             on a terminal, entering a row # shows the detail of its pod until Enter returns to the table
+  --watch-delta float        Change of %%USED, in percentage points, that marks a row in watch mode (default 5)
+  --samples int              Collect usage this many times, --interval apart, and replace USED with the MIN, AVG, P95 and
+                             MAX usage of every row; %%USED is the AVG (default 1; --resource memory or cpu)
+  --interval duration        Time between the collections of --samples (default 30s); extends the default --timeout
+  --why string               Explain which rule excluded a pod or how its percentage was computed (e.g. pod/my-pod)
+                             along with its node, QoS, restarts and the kubectl commands to investigate it
+  --score-expr string        CEL expression computing a sortable SCORE column from the row variable: row.usage, row.limit,
+                             row.request (Mi or mCPU), row.percentage, row.throttle_percent, row.restarts, row.crash_loop,
+                             row.namespace, row.name, row.node, row.owner, row.priority_class and row.labels, also
+                             usable bare (pct for percentage); restarts is an int and ints and doubles mix in arithmetic
+  --weights string           YAML file of score multipliers per priority class and namespace glob, so critical tiers rank
+                             above batch pods at the same percentage; scores pct without --score-expr
+  --filter, --filter-expr string
+                             Boolean CEL expression over the same row fields selecting which rows to keep, e.g.
+                             'pct > 75 && namespace != "kube-system"'; combines conditions the --nx and
+                             --lx regexes cannot express
+  --min-pct float            Only show rows whose %%USED is at or above this percentage (e.g. 80 for hot rows); rows
+                             without a limit are dropped
+  --max-pct float            Only show rows whose %%USED is at or below this percentage (e.g. 20 for underutilized rows)
+  --include-completed        Include pods that ran to completion (phase Succeeded), excluded by default
+  --exclude-crashloop        Exclude pods with a container waiting in CrashLoopBackOff; by default their rows are kept
+                             and marked CRASHLOOP, as their near-zero usage does not mean they are oversized
+  --include-no-limit         Include pods and containers without a limit of --resource, excluded by default; they show
+                             their usage with a - limit and %%USED, so sort by usage to rank them
+  --limit-ranges             Give containers without a limit the default limit of the LimitRange of their namespace,
+                             which the kubelet enforces, and mark such limits "(default)"
+  --sample-fraction float    Analyze only this fraction of the pods (default 1), picked by a hash of their namespace and
+                             name so every run samples the same pods, for a fast representative view of enormous clusters
+  --group-cronjobs string    Merge the pods of each CronJob's executions into one row, summing the pods of an execution
+                             and combining executions by their largest or mean usage: max|avg
+  --strict                   Fail when more than --strict-threshold percent of the metrics-server pod metrics belong to
+                             pods missing from the pod list (deleted or restarted between the list calls); without it
+                             they are dropped with a warning
+  --strict-threshold float   Percentage of unmatched pod metrics tolerated with --strict (default 5)
+  --fail-above string        Exit non-zero when %%USED of any printed row exceeds this percentage, for every analyzed
+                             resource (e.g. 90) or per resource (e.g. memory=90,cpu=80), to gate CI and cron jobs
+
+Cluster Flags (every command):
+  --context string           Kubeconfig context to use (default: the current context; compare uses --contexts)
+  --kubeconfig string        Path to the kubeconfig file to use (default: $KUBECONFIG or ~/.kube/config)
+  --cluster string           Kubeconfig cluster to use with the credentials of the context (default: the cluster
+                             of the context)
+  --contexts string          Comma-separated kubeconfig contexts pods or containers are collected from concurrently and
+                             ranked together, with a CLUSTER column naming the context of each row
+
+Source Flags (pods and containers):
+  --limits-source string     Read pod limits, requests, owners and labels from kube-state-metrics series instead
+                             of listing pods: api|kube-state-metrics (default api)
+  --source string            Read usage from metrics-server or aggregate cAdvisor series (container_memory_working_set_bytes,
+                             container_cpu_usage_seconds_total) from Prometheus, or kubelet check metrics from Datadog
+                             (keys from DD_API_KEY and DD_APP_KEY, site from DD_SITE), or scrape /metrics/cadvisor of
+                             every node through the API server (requires get on nodes/proxy, takes ~15s):
+                             metrics-server|prometheus|datadog|cadvisor (default metrics-server)
+  --range string             Period usage is aggregated over with --source prometheus|datadog, e.g. 1h, 7d (default 1h)
+  --aggregation string       Aggregation of usage over --range: avg|max|p95 (default avg)
+  --forecast                 Add a FORECAST column estimating when memory reaches the limit, from the current working set
+                             and a linear fit of its growth over --range (--source prometheus|datadog, memory or all)
+  --prometheus-url string    Prometheus query API base URL for kube-state-metrics and usage (default $KUSAGE_PROMETHEUS_URL)
+
+Prometheus Flags (chargeback, pools, --source prometheus and --limits-source kube-state-metrics):
+  --prometheus-tenant string Tenant sent as X-Scope-OrgID to Thanos, Cortex or Mimir (default $KUSAGE_PROMETHEUS_TENANT);
+                             for VictoriaMetrics cluster put the tenant in the URL (.../select/<tenant>/prometheus)
+  --prometheus-header string Header sent with every query as 'Name: Value', e.g. 'Authorization: Bearer ...' (repeatable)
+  --prometheus-timeout dur   Query evaluation timeout requested from the server for long range queries, e.g. 5m
+
+Compare Flags (plus the pods/containers flags above):
+  --contexts string          Comma-separated pair of kubeconfig contexts to run the analysis against
+  --min-delta float          Only show workloads whose %%USED changed by at least this many points (default 0)
+
+Check Flags:
+  --policy string            Policy file whose rules (maxPercent, requireLimits, forbidUnlimited, with namespace,
+                             selector and workload exceptions) are evaluated; exits non-zero on any violation
+  --baseline string          Baseline file of accepted per-workload memory and CPU percentages; workloads above
+                             their baseline by more than --tolerance are reported as regressions
+  --update-baseline          Record the current percentages to the --baseline file instead of comparing
+  --tolerance float          Percentage points a workload may exceed its baseline by (default 5)
+  -A, -n, -l, --nx, --lx     Select the pods to check, as for pods
+
+Chargeback Flags:
+  --prometheus-url string    Prometheus query API base URL (default $KUSAGE_PROMETHEUS_URL)
+  --group-label string       Pod label to total by, exported by kube-state-metrics as kube_pod_labels (default "team")
+  --period string            Reporting period ending now, e.g. 12h, 7d, 4w (default 30d)
+  -n string                  Namespace to report on (default: all namespaces)
+  -o string                  Output format: table|csv (default table)
+
+Pools Flags:
+  --pool-label string        Node label to group nodes into pools by (default "cloud.google.com/gke-nodepool")
+  --resource string          Resource to report: memory|cpu (default memory)
+  --prometheus-url string    Prometheus query API base URL used to project days until each pool is full (optional)
+  --growth-window string     History used to measure usage growth, e.g. 7d, 4w (default 7d)
+
+Pending Flags:
+  -A, -n, -l, --nx, --lx     Select the unschedulable pods to report, as for pods; node capacity always
+                             accounts for pods in all namespaces
+
+Volumes Flags:
+  -A, -n, -l, --nx, --lx     Select the pods whose mounted persistent volume claims are reported, as for pods
+  --top int                  Show the N fullest volumes (default 20)
+
+Sidecars Flags:
+  -A, -n, -l, --nx, --lx     Select the pods whose sidecar overhead is reported, as for pods
+  --sidecars string          Comma-separated globs matched against container names and image names (without
+                             registry and tag) identifying sidecars; native sidecar init containers always count
+                             (default "istio-proxy,proxyv2,linkerd-proxy,envoy*,consul-dataplane,cloud-sql-proxy,vault-agent*,fluent-bit")
+  --resource string          Resource whose sidecar share of usage ranks pods: memory|cpu (default memory)
+  --top int                  Show the N pods with the largest sidecar share (default 20)
+
+Nodes Flags:
+  --show-density             Add PODS (scheduled/capacity) and DENSITY columns to spot nodes limited by pod count
+  --schedulable-only         Leave cordoned nodes and nodes with NoSchedule or NoExecute taints out of the TOTAL, so it
+                             covers schedulable capacity only
+  --no-headers               Suppress headers; every node is listed, with the requests of pods in all namespaces
+
+Fragmentation Flags:
+  --pod-cpu string           CPU request of the pod shape free node capacity is packed with, e.g. 500m
+                             (default: mean CPU request of the scheduled pods)
+  --pod-memory string        Memory request of the pod shape, e.g. 1Gi (default: mean memory request of the scheduled pods)
+
+Recommend Flags:
+  --request-headroom float   Factor the peak usage of a container across its replicas is multiplied by into the
+                             suggested requests (default 1.2)
+  --limit-headroom float     Factor the peak usage is multiplied by into the suggested limits (default 1.5), 0 to
+                             suggest no limits
+  --patch-dir string         Write a strategic merge patch of the suggested resources per Deployment, StatefulSet,
+                             DaemonSet or ReplicaSet to this directory
+  --kustomize                Also write a kustomization.yaml to --patch-dir declaring a kustomize component of the
+                             patches, included from an overlay with components: [DIR]
+  --kubectl                  Print a kubectl patch command per workload, ready to apply, instead of the table
+  --samples int              Collect this many samples, --interval apart, and recommend from the peak (default 1)
+  -A, -n, -l, --nx, --lx     Select the containers to recommend for, as for containers
+
+  The PDB column shows the PodDisruptionBudget allowing the fewest voluntary evictions of the workload's pods,
+  or unknown without list access on poddisruptionbudgets.
+
+Quota Flags:
+  --threshold float          Share of a hard limit in use at which a ResourceQuota is marked NEAR (default 90);
+                             EXHAUSTED once it is fully used
+  -A, -n, --nx               Select the namespaces whose quotas are compared with the usage of their pods
+
+Waste Flags:
+  --basis string             Reservation the unused resources of a container are measured against: requests|limits
+                             (default "requests"); containers without one reserve nothing
+  --resource string          Resource pods and namespaces are ranked by their unused amount of: memory|cpu
+                             (default "memory")
+  --top int                  Show the top N pods (default 20); the namespace totals cover all pods
+  -A, -n, -l, --nx, --lx     Select the pods to report, as for pods
+
+Run Flags:
+  -f string                  Options document (YAML or JSON) naming the command, its positional args and its flags
+                             without dashes, or - to read it from stdin; flags after -f override the document, e.g.
+                               command: pods
+                               options: {A: true, nx: ^kube-system$, resource: cpu, top: 50, o: wide}
+
+Serve Flags:
+  --listen string            Address serving the usage of the last collection on /metrics (default ":9090")
+  --interval duration        Time between collections (default 60s); a collection is skipped, and counted in
+                             kusage_collection_runs_skipped_total, while the previous one is still running
+  --timeout duration         Time allowed for each collection (default 30s)
+  --config string            Config file whose budgets: expose kusage_namespace_{memory,cpu}_budget_ratio and
+                             _budget_breached per budgeted namespace, counting pods without limits too
+  -A, -n, -l, --nx, --lx     Select the pods to expose, as for pods
+
+Snapshot Flags:
+  --dir string               Directory snapshots are saved to and listed from (default ~/.kusage/snapshots); save
+                             records the memory and CPU rows of the current context with the time they were taken
+  -A, -n, -l, --nx, --lx     Select the pods to save, as for pods
+
+Export Flags:
+  --format string            Dataset format (default csv): one line per container per sample with memory in bytes,
+                             CPU in millicores and empty unset requests and limits; feather is not supported yet and
+                             fails with the pandas command converting the csv
+  --include-labels           Add a label_<key> column per pod label, empty for pods without it
+  --samples int              Collect this many samples, --interval apart (default 1); every sample is exported
+  -A, -n, -l, --nx, --lx     Select the containers to export, as for containers
+
+Doctor Flags:
+  -A, -n                     Namespace to list pod metrics in, as for pods; doctor also checks the v1beta1.metrics.k8s.io
+                             APIService is registered and Available and its backing service has ready endpoints, and
+                             exits non-zero naming the failing component
+
+Performance Flags (for large clusters):
+  --timeout duration         Time allowed for the whole run, every command (default 30s, 2m for chargeback, plus 15s
+                             with --show-network); it covers all pages, retries and backoff, so raise it (e.g. 5m) for
+                             -A scans of large clusters, while each API call is still bounded by a 60s client timeout
+  --page-size int            Items to fetch per API call (default 500)
+  --max-concurrency int      Maximum concurrent operations (default 10)
+  --metrics                  Enable performance metrics collection (default false)
+  --metrics-output string    Write the metrics summary as JSON to a file, or - for stderr (implies --metrics)
+  --max-memory int           Soft memory limit in MB applied as GOMEMLIMIT unless set in the environment (default 2048)
+  --gc-percent int           GC target percentage, -1 to collect only near --max-memory (default: GOGC or 100)
+  --low-memory               Stream pods and metrics page by page into a bounded top-N heap instead of holding
+                             every row in memory, redrawing the provisional top rows on a terminal while streaming
+                             (requires --top and metrics-server usage)
+  --cache-ttl duration       Reuse the pods and usage collected by a previous run against the same cluster, namespaces,
+                             selectors, mode, resource and sources for this long, e.g. 60s, so re-sorting, filtering
+                             or changing the output does not query the API again (cached in the user cache dir)
+
+Diagnostic Flags:
+  --debug-bundle string      Write options, timing metrics and pprof profiles to a .tar.gz bundle (implies --metrics)
+  --debug-bundle-responses   Include raw API responses in the bundle (env values and last-applied annotations redacted)
+  --dry-run                  Print the requests the analysis would issue (server, path, label selector, page size and
+                             how often each is repeated) and the estimated request count, without issuing any
+  --api-impact               Print the requests the run issued per endpoint (requests, bytes received, time, 429
+                             throttling, failures) and the client-side rate limit wait on stderr after the results
+
+Other Flags:
+  -v, --log-level string     Log level: debug|info|warn|error (default warn)
+  -h, --help                 Show help
+  -v, --version              Show version (version -o json adds the Go version, output formats and usage sources)
+
+Requirements:
+  - pods (get, list) permissions in target namespaces
+  - pods/metrics (get, list) permissions  via metrics.k8s.io API group
+  - metrics-server must be installed and running in the cluster, unless usage is read with --source
+    prometheus|datadog|cadvisor
+  - nodes (list) permissions for the pools, pending, nodes and fragmentation reports, and --pricing with pools
+  - nodes/proxy (get) permissions for the volumes and nodes reports, --show-network and --source cadvisor
+  - nodes/metrics (list) permissions via metrics.k8s.io API group for the CPU USED and MEM USED columns of the
+    nodes report
+  - resourcequotas (list) permissions for the quota report
+  - limitranges (list) permissions for --limit-ranges
+  - apiservices (get), services (get) and endpointslices (list) permissions, optional, to name the failing
+    component of the metrics API when pod metrics cannot be listed, and for doctor
+
+Examples:
+  kusage pods -A --nx '^(kube-system|monitoring)$' --lx '^(app=system|tier=infrastructure)$'
+  kusage containers -n gpu-operator --resource cpu --sort memory --top 50
+  kusage pods -A --nx '^kube-system$' --why pod/my-pod
+  kusage pods -A --score-expr 'row.percentage * (row.restarts + 1) * (has(row.labels.tier) && row.labels.tier == "web" ? 2.0 : 1.0)'
+  kusage pods -A --weights weights.yaml
+  kusage pods -A --resource all --pricing pricing.yaml --cost-by team
+  kusage pods -A --top 10 --watch 30s
+  kusage pods -A --resource cpu --samples 5 --interval 30s
+  kusage pods -A --filter 'row.percentage > 80 && row.namespace.startsWith("team-")'
+  kusage containers -A --filter 'row.percentage > 75 && row.namespace != "kube-system" && row.owner.startsWith("Deployment/")'
+  kusage pods -A --cost-center cost-center
+  kusage containers -A --max-pct 20 --sort usage
+  kusage pods -A --resource cpu --group-by node
+  kusage containers -n payments --group-by container-name
+  kusage pods -n payments --resource all
+  kusage containers -A --include-no-limit --sort usage
+  kusage containers -n team-a --limit-ranges
+  kusage pods -A --resource all --fail-above memory=90,cpu=80
+  kusage pods -A --sample-fraction 0.1 --summary-only
+  kusage pods -A --exclude-crashloop
+  kusage pods -A --timeout 5m --page-size 250
+  kusage run -f weekly-cpu.yaml --top 10
+  kusage serve containers -A --nx '^kube-system$' --listen :9090 --interval 2m
+  kusage snapshot save -A --nx '^kube-system$' && kusage snapshot list
+  kusage export -A --include-labels --samples 10 --interval 1m > usage.csv
+  kusage doctor -n payments
+  kusage pods -n batch --source prometheus --range 24h --aggregation max --include-completed --group-cronjobs max
+  kusage pods -A --limits-source kube-state-metrics --prometheus-url http://prometheus.monitoring:9090
+  kusage pods -n payments --source prometheus --range 7d --aggregation p95 --prometheus-url http://prometheus.monitoring:9090
+  kusage containers -A --source prometheus --range 6h --forecast --sort forecast
+  DD_API_KEY=... DD_APP_KEY=... kusage pods -A --source datadog --range 24h --aggregation max
+  kusage containers -n web --source cadvisor
+  kusage containers -n web --resource cpu --sort throttle --source cadvisor
+  kusage pods -n web --resource cpu --show-network
+  kusage pods -A --context staging --kubeconfig ~/.kube/staging.yaml
+  kusage pods -A --contexts prod-us,prod-eu --top 20
+  kusage pods -A -L app,team
+  kusage compare --contexts prod-a,prod-b -n payments --min-delta 10
+  kusage check containers -A --nx '^kube-system$' --policy policy.yaml
+  kusage check -n payments --baseline baseline.json --tolerance 10
+  kusage chargeback --prometheus-url http://prometheus.monitoring:9090 --group-label team --period 30d -o csv
+  kusage chargeback --prometheus-url http://thanos-query:9090 --prometheus-tenant platform --prometheus-timeout 5m --period 90d
+  kusage pools --pool-label eks.amazonaws.com/nodegroup --resource cpu --prometheus-url http://prometheus.monitoring:9090
+  kusage pending -A --nx '^kube-system$'
+  kusage volumes -A --top 10
+  kusage sidecars -A --resource cpu --sidecars 'istio-proxy,linkerd-proxy,vault-agent*'
+  kusage nodes --show-density
+  kusage nodes --schedulable-only
+  kusage fragmentation --pod-cpu 500m --pod-memory 1Gi
+  kusage recommend -n payments --samples 10 --interval 1m --patch-dir patches
+  kusage recommend -n payments --limit-headroom 0 --kubectl | sh
+  kusage quota -A --nx '^kube-system$' --threshold 80
+  kusage waste -A --nx '^kube-system$' --basis requests
+  kusage waste -n payments --basis limits --resource cpu
+  kusage pods -A -o markdown             # renders with kusage-output-markdown from PATH
+  kusage pods -A --metrics-output /var/log/kusage/metrics.json
+  kusage pods -A --cache-ttl 60s --sort usage -o json
+  kusage pods -A --debug-bundle kusage-debug.tar.gz --debug-bundle-responses
+  kusage containers -A --nx '^kube-system$' -l tier=web --page-size 250 --dry-run
+  kusage pods -A --page-size 1000 --api-impact
+
+`)
+
+	// Examples use the name the binary was invoked by, e.g. kubectl usage,
+	// and -n defaults to the namespace of the context as in kubectl
+	if p.programName != Name {
+		usage = p.programName + strings.TrimPrefix(usage, Name)
+		usage = strings.ReplaceAll(usage, "\n  "+Name+" ", "\n  "+p.programName+" ")
+		usage = strings.ReplaceAll(usage, `(ignored with -A) (default "default")`, "(ignored with -A) (default: the namespace of the context)")
+	}
+	fmt.Fprint(p.usageOutput, usage)
+}
+
+// invocationName returns the program name for the binary in arg0: the
+// kubectl plugin name when installed as kubectl-usage, or kubectl-usage.exe
+// on Windows, otherwise kusage.
+func invocationName(arg0 string) string {
+	base := filepath.Base(arg0)
+	if strings.EqualFold(filepath.Ext(base), ".exe") {
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if base == PluginBinary {
+		return PluginName
+	}
+	return Name
 }
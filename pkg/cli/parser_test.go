@@ -0,0 +1,1013 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/analyzer"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// newTestParser returns a parser that discards the help text.
+func newTestParser() *Parser {
+	return NewParser().WithUsageOutput(io.Discard)
+}
+
+// FuzzParse feeds arbitrary flag lists to the pods subcommand. Arguments are
+// separated by NUL so that individual values may contain spaces.
+func FuzzParse(f *testing.F) {
+	seeds := []string{
+		"-A\x00--nx\x00^(kube-system|monitoring)$",
+		"-n\x00payments\x00-l\x00app=api,tier!=cache",
+		"-n\x00team-payments-*\x00--nx\x00sandbox",
+		"--resource\x00cpu\x00--sort\x00restarts\x00--top\x000",
+		"--threshold\x00NaN",
+		"--threshold\x00-1",
+		"--top\x00-5",
+		"--why\x00pod/\x00-o\x00wide",
+		"--why\x00deploy/api",
+		"--max-memory\x009223372036854775807",
+		"--gc-percent\x00-2",
+		"-v\x00DEBUG\x00--log-level\x00error",
+		"--page-size\x00-1\x00--max-concurrency\x000",
+		"--metrics-output\x00-",
+		"--source\x00prometheus\x00--prometheus-url\x00http://prometheus:9090\x00--range\x007d\x00--aggregation\x00p95",
+		"--limits-source\x00ksm\x00--prometheus-url\x00http://prometheus:9090\x00--prometheus-tenant\x00a",
+		"--prometheus-header\x00Authorization: Bearer x\x00--prometheus-timeout\x005m",
+		"--timeout\x005m\x00--show-network",
+		"--timeout\x00-1s",
+		"-h",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		args := append([]string{Name, "pods"}, strings.Split(input, "\x00")...)
+
+		opts, err := newTestParser().Parse(args)
+		if err != nil || opts == nil {
+			return
+		}
+
+		// Anything accepted by the parser must be a valid, usable configuration
+		if err := opts.Validate(); err != nil {
+			t.Fatalf("parsed options fail validation: %v", err)
+		}
+		if opts.TopN < 0 || opts.PageSize <= 0 || opts.MaxConcurrency <= 0 {
+			t.Fatalf("invalid limits: top=%d page-size=%d concurrency=%d", opts.TopN, opts.PageSize, opts.MaxConcurrency)
+		}
+		if math.IsNaN(opts.Threshold) || opts.Threshold < 0 {
+			t.Fatalf("invalid threshold: %v", opts.Threshold)
+		}
+		if opts.MaxMemoryMB*bytesPerMB <= 0 {
+			t.Fatalf("max-memory overflows when converted to bytes: %d", opts.MaxMemoryMB)
+		}
+		if opts.GCPercent < -1 {
+			t.Fatalf("invalid gc percent: %d", opts.GCPercent)
+		}
+		if strings.Contains(opts.WhyPod, "/") {
+			t.Fatalf("why pod name contains a kind prefix: %q", opts.WhyPod)
+		}
+	})
+}
+
+// FuzzExclusionRegex checks that --nx and --lx either reject a pattern with an
+// error or produce a regex that can be matched against arbitrary input.
+func FuzzExclusionRegex(f *testing.F) {
+	f.Add("^(kube-system|gpu-operator)$", "kube-system")
+	f.Add("^(app=system|tier=infrastructure)$", "app=system,tier=web")
+	f.Add("(", "default")
+	f.Add("a{1001}", "aaaa")
+	f.Add(`\p{Greek}+`, "αβγ")
+	f.Add("", "")
+
+	f.Fuzz(func(t *testing.T, pattern, subject string) {
+		args := []string{Name, "containers", "--nx", pattern, "--lx", pattern}
+
+		opts, err := newTestParser().Parse(args)
+		if err != nil {
+			return
+		}
+		if opts == nil {
+			t.Fatal("expected options when parsing succeeds")
+		}
+
+		if pattern == "" {
+			if opts.ExcludeNamespaces != nil || opts.ExcludeLabels != nil {
+				t.Fatal("empty pattern must not set an exclusion regex")
+			}
+			return
+		}
+		if opts.ExcludeNamespaces == nil || opts.ExcludeLabels == nil {
+			t.Fatalf("pattern %q accepted but exclusion regex not set", pattern)
+		}
+
+		opts.ExcludeNamespaces.MatchString(subject)
+		opts.ExcludeLabels.MatchString(subject)
+	})
+}
+
+func TestParse_Timeout(t *testing.T) {
+	tests := []struct {
+		args []string
+		want time.Duration
+	}{
+		{args: []string{"pods", "-A"}, want: 30 * time.Second},
+		{args: []string{"pods", "-A", "--timeout", "5m"}, want: 5 * time.Minute},
+		{args: []string{"pods", "--show-network"}, want: 45 * time.Second},
+		{args: []string{"pods", "--show-network", "--timeout", "2m"}, want: 2 * time.Minute},
+		{args: []string{"nodes", "--timeout", "90s"}, want: 90 * time.Second},
+	}
+	for _, tt := range tests {
+		opts, err := newTestParser().Parse(append([]string{Name}, tt.args...))
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tt.args, err)
+		}
+		if opts.Timeout != tt.want {
+			t.Errorf("%v: expected timeout %v, got %v", tt.args, tt.want, opts.Timeout)
+		}
+	}
+
+	if _, err := newTestParser().Parse([]string{Name, "pods", "--timeout", "0s"}); err == nil {
+		t.Error("expected a zero timeout to be rejected")
+	}
+}
+
+func TestParse_Kubeconfig(t *testing.T) {
+	commands := [][]string{{"pods"}, {"containers"}, {"check", "--baseline", "b.json"}, {"chargeback", "--prometheus-url", "http://prometheus:9090"}, {"pools"}, {"pending"}, {"volumes"}, {"sidecars"}, {"nodes"}, {"fragmentation"}, {"quota"}}
+	for _, command := range commands {
+		args := append([]string{Name}, command...)
+		args = append(args, "--context", "staging", "--kubeconfig", "/tmp/staging.yaml", "--cluster", "staging-east")
+		opts, err := newTestParser().Parse(args)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", command, err)
+		}
+		if opts.Context != "staging" || opts.Kubeconfig != "/tmp/staging.yaml" || opts.Cluster != "staging-east" {
+			t.Errorf("%v: expected the kubeconfig overrides, got context %q, kubeconfig %q, cluster %q", command, opts.Context, opts.Kubeconfig, opts.Cluster)
+		}
+		if got := len(clientOptions(*opts, nil)); got != 3 {
+			t.Errorf("%v: expected 3 client options, got %d", command, got)
+		}
+	}
+
+	if _, err := newTestParser().Parse([]string{Name, "compare", "--contexts", "a,b", "--kubeconfig", "/tmp/all.yaml"}); err != nil {
+		t.Errorf("expected compare to accept --kubeconfig: %v", err)
+	}
+	if _, err := newTestParser().Parse([]string{Name, "compare", "--contexts", "a,b", "--context", "c"}); err == nil {
+		t.Error("expected compare to reject --context")
+	}
+}
+
+func TestParse_Contexts(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "pods", "-A", "--contexts", "prod-us, prod-eu,prod-ap", "-o", "json"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(opts.Contexts) != 3 || opts.Contexts[1] != "prod-eu" || opts.Compare {
+		t.Errorf("expected three contexts ranked together, got %q (compare %t)", opts.Contexts, opts.Compare)
+	}
+
+	opts, err = newTestParser().Parse([]string{Name, "compare", "--contexts", "prod-us,prod-eu"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !opts.Compare {
+		t.Error("expected compare to set Compare")
+	}
+
+	invalid := [][]string{
+		{"pods", "--contexts", "prod-us,prod-us"},
+		{"pods", "--contexts", "prod-us,prod-eu", "--node-subtotals"},
+		{"pods", "--contexts", "prod-us,prod-eu", "--context", "staging"},
+		{"containers", "--contexts", "prod-us,prod-eu", "--cache-ttl", "1m"},
+	}
+	for _, args := range invalid {
+		if _, err := newTestParser().Parse(append([]string{Name}, args...)); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestParse_LabelColumns(t *testing.T) {
+	for _, flag := range []string{"-L", "--label-columns"} {
+		opts, err := newTestParser().Parse([]string{Name, "containers", flag, "app, app.kubernetes.io/part-of,"})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", flag, err)
+		}
+		if len(opts.LabelColumns) != 2 || opts.LabelColumns[0] != "app" || opts.LabelColumns[1] != "app.kubernetes.io/part-of" {
+			t.Errorf("%s: expected two label columns, got %q", flag, opts.LabelColumns)
+		}
+	}
+
+	if _, err := newTestParser().Parse([]string{Name, "pods", "-L", "app=web"}); err == nil {
+		t.Error("expected an invalid label key to be rejected")
+	}
+	if _, err := newTestParser().Parse([]string{Name, "pods", "-L", "app", "--group-by", "node"}); err == nil {
+		t.Error("expected label columns to be rejected with --group-by")
+	}
+}
+
+func TestParse_GroupByContainerName(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "containers", "--group-by", "container-name"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.GroupBy != config.GroupByContainerName {
+		t.Errorf("expected group-by container-name, got %q", opts.GroupBy)
+	}
+
+	invalid := [][]string{
+		{"pods", "--group-by", "container-name"},
+		{"containers", "--group-by", "container-name", "--resource", "all"},
+		{"containers", "--group-by", "container-name", "--low-memory"},
+		{"containers", "--group-by", "node"},
+	}
+	for _, args := range invalid {
+		if _, err := newTestParser().Parse(append([]string{Name}, args...)); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestParse_ContextProfile(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+	profiles := `profiles:
+  prod:
+    A: true
+    nx: ^kube-system$
+    top: 50
+  dev:
+    "n": dev
+`
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	if err := os.WriteFile(configFile, []byte(profiles), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if err := os.WriteFile(kubeconfig, []byte("apiVersion: v1\nkind: Config\ncurrent-context: dev\n"), 0o600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+
+	// The profile of --context applies beneath the given flags
+	opts, err := newTestParser().Parse([]string{Name, "pods", "--config", configFile, "--context=prod", "--top", "10"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !opts.AllNamespaces || opts.ExcludeNamespaces == nil || opts.TopN != 10 {
+		t.Errorf("expected the prod profile with --top overridden, got -A %t, --nx %v, --top %d", opts.AllNamespaces, opts.ExcludeNamespaces, opts.TopN)
+	}
+
+	// Without --context, the current context of the kubeconfig selects the profile
+	opts, err = newTestParser().Parse([]string{Name, "containers", "-config", configFile, "--kubeconfig", kubeconfig})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Namespace != "dev" || opts.AllNamespaces {
+		t.Errorf("expected the dev profile of the current context, got namespace %q", opts.Namespace)
+	}
+
+	// Contexts without a profile, and runs across contexts, keep the flag defaults
+	for _, args := range [][]string{
+		{"pods", "--config", configFile, "--context", "staging"},
+		{"pods", "--config", configFile, "--contexts", "prod,dev"},
+	} {
+		opts, err = newTestParser().Parse(append([]string{Name}, args...))
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", args, err)
+		}
+		if opts.AllNamespaces || opts.Namespace != "default" {
+			t.Errorf("%v: expected no profile, got -A %t, namespace %q", args, opts.AllNamespaces, opts.Namespace)
+		}
+	}
+
+	if err := os.WriteFile(configFile, []byte("profiles:\n  prod:\n    no-such-flag: true\n"), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if _, err := newTestParser().Parse([]string{Name, "pods", "--config", configFile, "--context", "prod"}); err == nil || !strings.Contains(err.Error(), "profile of context prod") {
+		t.Errorf("expected an unknown profile flag to name the profile, got %v", err)
+	}
+}
+
+func TestParse_Run(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "weekly.yaml")
+	document := `command: pods
+options:
+  A: true
+  resource: cpu
+  top: 50
+  o: wide
+`
+	if err := os.WriteFile(file, []byte(document), 0o600); err != nil {
+		t.Fatalf("failed to write document: %v", err)
+	}
+
+	opts, err := newTestParser().Parse([]string{Name, "run", "-f", file, "--top", "10"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Mode != config.ModePods || !opts.AllNamespaces || opts.Resource != config.ResourceCPU || opts.Output != config.OutputWide {
+		t.Errorf("expected the document options, got %+v", opts)
+	}
+	if opts.TopN != 10 {
+		t.Errorf("expected flags after the document to override it, got top %d", opts.TopN)
+	}
+
+	stdin := strings.NewReader("command: compare\nargs: [containers]\noptions: {contexts: 'prod,staging'}\n")
+	opts, err = newTestParser().WithInput(stdin).Parse([]string{Name, "run", "-f", "-"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Mode != config.ModeContainers || len(opts.Contexts) != 2 {
+		t.Errorf("expected the compare document from stdin, got %+v", opts)
+	}
+
+	invalid := []string{
+		"options: {A: true}",
+		"command: run",
+		"command: pods\noptions: {no-such-flag: true}",
+		"command: pods\noptions: {A: null}",
+		"command: pods\nflags: {A: true}",
+	}
+	for _, document := range invalid {
+		if _, err := newTestParser().WithInput(strings.NewReader(document)).Parse([]string{Name, "run", "-f", "-"}); err == nil {
+			t.Errorf("%q: expected an error", document)
+		}
+	}
+	if _, err := newTestParser().WithInput(strings.NewReader("command: pods\noptions: {n: dev}")).Parse([]string{Name, "run", "-f", "-"}); err == nil || !strings.Contains(err.Error(), "quote") {
+		t.Errorf("expected an unquoted n to be reported, got %v", err)
+	}
+	if _, err := newTestParser().Parse([]string{Name, "run"}); err == nil {
+		t.Error("expected run without -f to be rejected")
+	}
+}
+
+func TestParse_PluginNamespace(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	const data = `apiVersion: v1
+kind: Config
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    namespace: payments
+current-context: dev
+`
+	if err := os.WriteFile(kubeconfig, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"kubectl-usage", "pods"}, want: "payments"},
+		{args: []string{"kubectl-usage", "pods", "-n", "web"}, want: "web"},
+		{args: []string{"kusage", "pods"}, want: "default"},
+		{args: []string{"kubectl-usage", "recommend"}, want: "payments"},
+		{args: []string{"kubectl-usage", "waste"}, want: "payments"},
+		{args: []string{"kubectl-usage", "snapshot", "save"}, want: "payments"},
+		{args: []string{"kubectl-usage", "export"}, want: "payments"},
+	}
+	for _, tt := range tests {
+		opts, err := newTestParser().Parse(append(tt.args, "--kubeconfig", kubeconfig))
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tt.args, err)
+		}
+		if opts.Namespace != tt.want {
+			t.Errorf("%v: expected namespace %q, got %q", tt.args, tt.want, opts.Namespace)
+		}
+	}
+}
+
+// TestParse_PluginName checks that the help text follows the name the binary
+// was invoked by.
+func TestParse_PluginName(t *testing.T) {
+	tests := []struct {
+		arg0 string
+		want string
+	}{
+		{arg0: "kusage", want: "\n  kusage pods [flags]"},
+		{arg0: "/usr/local/bin/kubectl-usage", want: "\n  kubectl usage pods [flags]"},
+		{arg0: "/opt/bin/kubectl-usage.exe", want: "\n  kubectl usage pods [flags]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg0, func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := NewParser().WithUsageOutput(&buf).Parse([]string{tt.arg0, "-h"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			usage := buf.String()
+			if !strings.Contains(usage, tt.want) {
+				t.Errorf("expected help text to contain %q", tt.want)
+			}
+			if tt.arg0 != "kusage" && !strings.Contains(usage, "(default: the namespace of the context)") {
+				t.Error("expected -n to default to the namespace of the context as a plugin")
+			}
+			// Names that are not the program name are left alone
+			if !strings.Contains(usage, "kusage-output-markdown") {
+				t.Error("expected output plugin name to be unchanged")
+			}
+		})
+	}
+}
+
+func TestPrintVersion_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newTestParser().printVersion(&buf, []string{"-o", "json"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var info VersionInfo
+	if err := json.Unmarshal(buf.Bytes(), &info); err != nil {
+		t.Fatalf("version output is not valid JSON: %v", err)
+	}
+	if info.Version != Version || info.GoVersion == "" {
+		t.Errorf("expected version %s and a Go version, got %+v", Version, info)
+	}
+	if len(info.OutputFormats) == 0 || len(info.UsageSources) == 0 {
+		t.Errorf("expected output formats and usage sources, got %+v", info)
+	}
+
+	if err := newTestParser().printVersion(&buf, []string{"-o", "yaml"}); err == nil {
+		t.Error("expected an error for an unknown version format")
+	}
+}
+
+// FuzzParseWhy checks that every accepted --why value yields a bare pod name.
+func FuzzParseWhy(f *testing.F) {
+	for _, seed := range []string{"my-pod", "pod/my-pod", "pods/x", "PO/x", "pod/", "deploy/x", "pod/a/b", "/"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		name, err := newTestParser().parseWhy(value)
+		if err != nil {
+			return
+		}
+		if strings.Contains(value, "/") && (name == "" || strings.Contains(name, "/")) {
+			t.Fatalf("parseWhy(%q) returned invalid name %q", value, name)
+		}
+	})
+}
+
+// FuzzParseSizeFlags checks numeric and level flags for overflow and inconsistent acceptance.
+func FuzzParseSizeFlags(f *testing.F) {
+	f.Add("2048", "0", "warn")
+	f.Add("-1", "-1", "info")
+	f.Add("8796093022207", "100", "debug")
+	f.Add("8796093022208", "-2", "trace")
+	f.Add("1e3", "0x10", "")
+
+	f.Fuzz(func(t *testing.T, maxMemory, gcPercent, level string) {
+		args := []string{Name, "pods", "--max-memory", maxMemory, "--gc-percent", gcPercent, "--log-level", level}
+
+		opts, err := newTestParser().Parse(args)
+		if err != nil {
+			return
+		}
+		if opts.MaxMemoryMB <= 0 || opts.MaxMemoryMB*bytesPerMB <= 0 {
+			t.Fatalf("accepted max-memory %q yields invalid limit %d", maxMemory, opts.MaxMemoryMB)
+		}
+		if opts.GCPercent < -1 {
+			t.Fatalf("accepted gc-percent %q yields %d", gcPercent, opts.GCPercent)
+		}
+		if _, err := newTestParser().parseLogLevel(level); err != nil {
+			t.Fatalf("accepted invalid log level %q", level)
+		}
+	})
+}
+
+// FuzzParsePeriod checks that every accepted --period is a positive duration.
+func FuzzParsePeriod(f *testing.F) {
+	for _, seed := range []string{"30d", "2w", "12h", "90m", "0d", "-1d", "d", "1.5d", "9999999999w"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		period, err := newTestParser().parsePeriod(value)
+		if err != nil {
+			return
+		}
+		if period <= 0 {
+			t.Fatalf("parsePeriod(%q) accepted non-positive period %v", value, period)
+		}
+	})
+}
+
+// FuzzHeaderFlag checks that accepted --prometheus-header values yield a usable header name.
+func FuzzHeaderFlag(f *testing.F) {
+	for _, seed := range []string{"Authorization: Bearer x", "X-Scope-OrgID:a", ": v", "Bad Name: v", "NoColon", "A:"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		headers := headerFlag{}
+		if err := headers.Set(value); err != nil {
+			return
+		}
+		for name := range headers {
+			if name == "" || strings.ContainsAny(name, ": \t") {
+				t.Fatalf("invalid header name %q from %q", name, value)
+			}
+		}
+	})
+}
+
+func TestParse_Weights(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weights.yaml")
+	if err := os.WriteFile(path, []byte("priorityClasses:\n  batch: 0.5\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := newTestParser().Parse([]string{Name, "pods", "-A", "--weights", path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Weights == nil || opts.Sort != config.SortByScore {
+		t.Errorf("expected weights ranked by score, got %+v", opts)
+	}
+
+	opts, err = newTestParser().Parse([]string{Name, "pods", "-A", "--weights", path, "--sort", "usage"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Sort != config.SortByUsage {
+		t.Errorf("expected an explicit sort to be kept, got %s", opts.Sort)
+	}
+
+	if _, err := newTestParser().Parse([]string{Name, "pods", "--weights", filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Error("expected a missing weights file to fail")
+	}
+}
+
+func TestParse_ScoreExpr(t *testing.T) {
+	const score = `row.percentage * (row.restarts + 1)`
+	opts, err := newTestParser().Parse([]string{Name, "pods", "-A", "--score-expr", score})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.ScoreExpr.String() != score || opts.Sort != config.SortByScore {
+		t.Errorf("expected the score expression ranked by score, got %q sorted by %s", opts.ScoreExpr, opts.Sort)
+	}
+
+	for _, source := range []string{"pcnt * 2.0", `row.namespace`} {
+		_, err := newTestParser().Parse([]string{Name, "pods", "--score-expr", source})
+		if err == nil || !strings.Contains(err.Error(), "--score-expr") {
+			t.Errorf("%s: expected an invalid --score-expr error, got %v", source, err)
+		}
+	}
+}
+
+func TestParse_Filter(t *testing.T) {
+	const filter = `row.percentage > 75 && row.namespace != "kube-system"`
+	for _, name := range []string{"--filter", "--filter-expr"} {
+		opts, err := newTestParser().Parse([]string{Name, "pods", "-A", name, filter})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if opts.FilterExpr == nil || opts.FilterExpr.String() != filter {
+			t.Fatalf("%s: expected the filter to be compiled, got %v", name, opts.FilterExpr)
+		}
+
+		rows, err := analyzer.New().Select([]metrics.Row{{Namespace: "kube-system", Percentage: 80}}, *opts)
+		if err != nil || len(rows) != 0 {
+			t.Errorf("%s: expected kube-system to be filtered out, got %+v (%v)", name, rows, err)
+		}
+	}
+
+	opts, err := newTestParser().Parse([]string{Name, "pods", "-A", "--filter", `pct > 75 && namespace != "kube-system"`})
+	if err != nil {
+		t.Fatalf("unexpected error for the field variables: %v", err)
+	}
+	rows, err := analyzer.New().Select([]metrics.Row{{Namespace: "kube-system", Percentage: 80}, {Namespace: "web", Percentage: 80}}, *opts)
+	if err != nil || len(rows) != 1 || rows[0].Namespace != "web" {
+		t.Errorf("expected only web to be kept, got %+v (%v)", rows, err)
+	}
+
+	_, err = newTestParser().Parse([]string{Name, "pods", "--filter", "row.percentage >"})
+	if err == nil || !strings.Contains(err.Error(), "--filter") {
+		t.Errorf("expected an invalid --filter error, got %v", err)
+	}
+}
+
+func TestParse_Pricing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.yaml")
+	if err := os.WriteFile(path, []byte("cpuCoreHour: 0.04\nmemoryGiBHour: 0.005\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := newTestParser().Parse([]string{Name, "pods", "-A", "--resource", "all", "--pricing", path, "--cost-by", "team"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Pricing == nil || opts.Pricing.CPUCoreHour != 0.04 || opts.CostBy != "team" {
+		t.Errorf("expected pricing rolled up by team, got %+v", opts)
+	}
+
+	invalid := [][]string{
+		{Name, "pods", "--cost-by", "namespace"},
+		{Name, "pods", "--pricing", path, "--cost-by", "not a label"},
+		{Name, "pods", "--pricing", path, "--cost-by", "namespace", "-o", "json"},
+		{Name, "pods", "--pricing", path, "--summary-only"},
+		{Name, "pods", "--pricing", filepath.Join(t.TempDir(), "missing.yaml")},
+	}
+	for _, args := range invalid {
+		if _, err := newTestParser().Parse(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestParse_Watch(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "pods", "-A", "--watch", "30s", "--watch-delta", "10"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Watch != 30*time.Second || opts.WatchDelta != 10 {
+		t.Errorf("expected a 30s watch with a 10 point delta, got %s and %v", opts.Watch, opts.WatchDelta)
+	}
+
+	invalid := [][]string{
+		{Name, "pods", "--watch", "-1s"},
+		{Name, "pods", "--watch", "30s", "--watch-delta", "-1"},
+		{Name, "pods", "--watch", "30s", "-o", "json"},
+		{Name, "pods", "--watch", "30s", "--summary-only"},
+		{Name, "pods", "--watch", "30s", "--cache-ttl", "1m"},
+	}
+	for _, args := range invalid {
+		if _, err := newTestParser().Parse(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestParse_Samples(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "pods", "-A", "--resource", "cpu", "--samples", "5", "--interval", "10s"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Samples != 5 || opts.Interval != 10*time.Second {
+		t.Errorf("expected 5 samples 10s apart, got %d and %s", opts.Samples, opts.Interval)
+	}
+	if opts.Timeout != 30*time.Second+40*time.Second {
+		t.Errorf("expected the timeout to cover the samples, got %s", opts.Timeout)
+	}
+
+	invalid := [][]string{
+		{Name, "pods", "--samples", "0"},
+		{Name, "pods", "--samples", "3", "--interval", "0s"},
+		{Name, "pods", "--samples", "3", "--resource", "all"},
+		{Name, "pods", "--samples", "3", "--low-memory"},
+	}
+	for _, args := range invalid {
+		if _, err := newTestParser().Parse(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestParse_Doctor(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "doctor", "-n", "payments", "--timeout", "10s"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Mode != config.ModeDoctor || opts.Namespace != "payments" || opts.Timeout != 10*time.Second {
+		t.Errorf("expected a doctor run in payments within 10s, got %+v", opts)
+	}
+
+	if _, err := newTestParser().Parse([]string{Name, "doctor", "-l", "app=api"}); err == nil {
+		t.Error("expected an error for a flag doctor does not take")
+	}
+}
+
+func TestParse_Export(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "export", "-A", "--include-labels", "--samples", "3", "--interval", "1m"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !opts.Export || !opts.ExportLabels || opts.Mode != config.ModeContainers || opts.Resource != config.ResourceAll {
+		t.Errorf("expected a labelled export of both resources of containers, got %+v", opts)
+	}
+	if opts.Output != config.OutputCSV || !opts.IncludeNoLimit {
+		t.Errorf("expected csv of every container, limited or not, got %+v", opts)
+	}
+	if opts.Samples != 3 || opts.Timeout != 30*time.Second+2*time.Minute {
+		t.Errorf("expected 3 samples within an extended timeout, got %d and %s", opts.Samples, opts.Timeout)
+	}
+
+	invalid := [][]string{
+		{Name, "export", "--format", "feather"},
+		{Name, "export", "--format", "parquet"},
+		{Name, "export", "--samples", "0"},
+		{Name, "export", "--samples", "3", "--interval", "0s"},
+	}
+	for _, args := range invalid {
+		if _, err := newTestParser().Parse(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+
+	// Feather is named but not written yet; the error points to the conversion
+	_, err = newTestParser().Parse([]string{Name, "export", "--format", "feather"})
+	if err == nil || !strings.Contains(err.Error(), "to_feather") {
+		t.Errorf("expected the feather error to point to the pandas conversion, got %v", err)
+	}
+}
+
+func TestParse_Recommend(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "recommend", "-n", "payments", "--request-headroom", "1.1", "--limit-headroom", "0", "--patch-dir", "patches"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Mode != config.ModeRecommend || !opts.IncludeNoLimit {
+		t.Errorf("expected recommendations for every container, got %+v", opts)
+	}
+	if opts.RequestHeadroom != 1.1 || opts.LimitHeadroom != 0 || opts.PatchDir != "patches" {
+		t.Errorf("expected the headroom factors and patch dir, got %v, %v and %q", opts.RequestHeadroom, opts.LimitHeadroom, opts.PatchDir)
+	}
+
+	opts, err = newTestParser().Parse([]string{Name, "recommend", "--kubectl", "--patch-dir", "patches", "--kustomize"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !opts.KubectlPatches || !opts.Kustomize {
+		t.Errorf("expected kubectl commands and a kustomize component, got %+v", opts)
+	}
+
+	invalid := [][]string{
+		{Name, "recommend", "--request-headroom", "0.8"},
+		{Name, "recommend", "--request-headroom", "1.5", "--limit-headroom", "1.2"},
+		{Name, "recommend", "--samples", "0"},
+		{Name, "recommend", "--kustomize"},
+	}
+	for _, args := range invalid {
+		if _, err := newTestParser().Parse(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestParse_LimitRanges(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "containers", "-n", "team-a", "--limit-ranges"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !opts.LimitRanges {
+		t.Error("expected --limit-ranges to be set")
+	}
+
+	if _, err := newTestParser().Parse([]string{Name, "pods", "-A", "--limit-ranges", "--low-memory", "--top", "10"}); err == nil {
+		t.Error("expected --limit-ranges with --low-memory to fail")
+	}
+}
+
+func TestParse_Quota(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "quota", "-A", "--nx", "^kube-system$", "--threshold", "80"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Mode != config.ModeQuota || !opts.AllNamespaces || opts.ExcludeNamespaces == nil || opts.Threshold != 80 {
+		t.Errorf("expected quotas across all namespaces but kube-system at 80%%, got %+v", opts)
+	}
+
+	opts, err = newTestParser().Parse([]string{Name, "quota", "-n", "team-*"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Threshold != 90 || opts.NamespacePattern != "team-*" {
+		t.Errorf("expected the default threshold and a namespace pattern, got %v and %q", opts.Threshold, opts.NamespacePattern)
+	}
+
+	invalid := [][]string{
+		{Name, "quota", "--threshold", "-1"},
+		{Name, "quota", "-l", "app=web"},
+	}
+	for _, args := range invalid {
+		if _, err := newTestParser().Parse(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestParse_NodesSchedulableOnly(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "nodes", "--schedulable-only"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Mode != config.ModeNodes || !opts.SchedulableOnly {
+		t.Errorf("expected a nodes report of schedulable capacity, got %+v", opts)
+	}
+}
+
+func TestParse_Waste(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "waste", "-A", "--nx", "^kube-system$", "--basis", "Limits", "--resource", "cpu"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Mode != config.ModeWaste || !opts.AllNamespaces || opts.WasteBasis != config.WasteBasisLimits || opts.Resource != config.ResourceCPU {
+		t.Errorf("expected cpu waste against limits across all namespaces, got %+v", opts)
+	}
+	if !opts.IncludeNoLimit {
+		t.Error("expected containers without a limit to be included")
+	}
+
+	opts, err = newTestParser().Parse([]string{Name, "waste", "-n", "payments"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.WasteBasis != config.WasteBasisRequests || opts.Resource != config.ResourceMemory || opts.TopN != 20 {
+		t.Errorf("expected the default basis, resource and top, got %q, %q and %d", opts.WasteBasis, opts.Resource, opts.TopN)
+	}
+
+	invalid := [][]string{
+		{Name, "waste", "--basis", "usage"},
+		{Name, "waste", "--resource", "all"},
+	}
+	for _, args := range invalid {
+		if _, err := newTestParser().Parse(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestParse_APIImpact(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "pods", "-A", "--api-impact"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !opts.APIImpact {
+		t.Error("expected --api-impact to be set")
+	}
+
+	if _, err := newTestParser().Parse([]string{Name, "pods", "-A", "--api-impact", "--dry-run"}); err == nil {
+		t.Error("expected --api-impact with --dry-run to fail")
+	}
+}
+
+func TestParse_Serve(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "serve", "containers", "-A", "--listen", ":8080", "--interval", "2m"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Mode != config.ModeContainers || !opts.AllNamespaces || opts.Resource != config.ResourceAll {
+		t.Errorf("expected containers across all namespaces with both resources, got %+v", opts)
+	}
+	if opts.Listen != ":8080" || opts.Interval != 2*time.Minute {
+		t.Errorf("expected the listen address and interval, got %q and %s", opts.Listen, opts.Interval)
+	}
+
+	opts, err = newTestParser().Parse([]string{Name, "serve"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Mode != config.ModePods || opts.Listen != ":9090" || opts.Interval != time.Minute {
+		t.Errorf("expected the serve defaults, got %+v", opts)
+	}
+
+	invalid := [][]string{
+		{Name, "serve", "nodes"},
+		{Name, "serve", "--interval", "0s"},
+		{Name, "serve", "--top", "10"},
+		{Name, "serve", "--config", filepath.Join(t.TempDir(), "missing.yaml")},
+	}
+	for _, args := range invalid {
+		if _, err := newTestParser().Parse(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+
+	// Budgets collect the pods without limits too
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("budgets:\n- namespace: payments\n  memory: 64Gi\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	opts, err = newTestParser().Parse([]string{Name, "serve", "-A", "--config", path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(opts.Budgets) != 1 || opts.Budgets.For("payments") == nil || !opts.IncludeNoLimit {
+		t.Errorf("expected the payments budget over every pod, got %+v", opts)
+	}
+}
+
+func TestParse_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+	opts, err := newTestParser().Parse([]string{Name, "snapshot", "save", "containers", "-A", "--dir", dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !opts.SaveSnapshot || opts.SnapshotDir != dir || opts.Mode != config.ModeContainers || opts.Resource != config.ResourceAll || !opts.AllNamespaces {
+		t.Errorf("expected a containers snapshot of both resources, got %+v", opts)
+	}
+
+	opts, err = newTestParser().Parse([]string{Name, "snapshot", "list", "--dir", dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Mode != config.ModeSnapshots || opts.SaveSnapshot || opts.SnapshotDir != dir {
+		t.Errorf("expected a snapshot listing, got %+v", opts)
+	}
+
+	invalid := [][]string{
+		{Name, "snapshot"},
+		{Name, "snapshot", "delete"},
+		{Name, "snapshot", "save", "nodes"},
+		{Name, "snapshot", "list", "-A"},
+	}
+	for _, args := range invalid {
+		if _, err := newTestParser().Parse(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestParse_FailAbove(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "pods", "-A", "--resource", "all", "--fail-above", "90"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[config.ResourceKind]float64{config.ResourceMemory: 90, config.ResourceCPU: 90}
+	if !reflect.DeepEqual(opts.FailAbove, want) {
+		t.Errorf("expected %v, got %v", want, opts.FailAbove)
+	}
+
+	opts, err = newTestParser().Parse([]string{Name, "containers", "-A", "--fail-above", "memory=95, CPU=80"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = map[config.ResourceKind]float64{config.ResourceMemory: 95, config.ResourceCPU: 80}
+	if !reflect.DeepEqual(opts.FailAbove, want) {
+		t.Errorf("expected %v, got %v", want, opts.FailAbove)
+	}
+
+	invalid := [][]string{
+		{Name, "pods", "--fail-above", "high"},
+		{Name, "pods", "--fail-above", "-5"},
+		{Name, "pods", "--fail-above", "disk=90"},
+		{Name, "pods", "--fail-above", "memory=90,memory=80"},
+		{Name, "pods", "--fail-above", "90", "--summary-only"},
+	}
+	for _, args := range invalid {
+		if _, err := newTestParser().Parse(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestParse_SampleFraction(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "pods", "-A", "--sample-fraction", "0.1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.SampleFraction != 0.1 {
+		t.Errorf("expected a 0.1 sample, got %v", opts.SampleFraction)
+	}
+
+	for _, fraction := range []string{"0", "-0.5", "1.5", "NaN"} {
+		if _, err := newTestParser().Parse([]string{Name, "pods", "--sample-fraction", fraction}); err == nil {
+			t.Errorf("--sample-fraction %s: expected an error", fraction)
+		}
+	}
+}
+
+func TestParse_PercentageRange(t *testing.T) {
+	opts, err := newTestParser().Parse([]string{Name, "pods", "-A", "--min-pct", "80"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.MinPercentage == nil || *opts.MinPercentage != 80 || opts.MaxPercentage != nil {
+		t.Errorf("expected only a minimum of 80, got %v and %v", opts.MinPercentage, opts.MaxPercentage)
+	}
+
+	opts, err = newTestParser().Parse([]string{Name, "containers", "-A", "--max-pct", "0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.MaxPercentage == nil || *opts.MaxPercentage != 0 {
+		t.Errorf("expected a maximum of 0, got %v", opts.MaxPercentage)
+	}
+
+	invalid := [][]string{
+		{Name, "pods", "--min-pct", "-1"},
+		{Name, "pods", "--min-pct", "80", "--max-pct", "20"},
+	}
+	for _, args := range invalid {
+		if _, err := newTestParser().Parse(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
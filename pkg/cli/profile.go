@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/k8s"
+)
+
+// contextProfile returns the context an analysis with args runs against and
+// the default flags the config file assigns to it in its profiles. The context
+// is the one named by --context, or else the current context of the
+// kubeconfig, which is only read when the config file has profiles. Runs
+// across several contexts have no profile.
+func (p *Parser) contextProfile(args []string) (string, []string, error) {
+	if _, ok := argValue(args, "contexts"); ok {
+		return "", nil, nil
+	}
+
+	// Only an explicitly named config file must exist
+	configPath, ok := argValue(args, "config")
+	if !ok {
+		configPath = os.Getenv(config.ConfigEnv)
+	}
+	required := configPath != ""
+	if !required {
+		configPath = config.DefaultConfigPath()
+	}
+	file, err := config.LoadFile(configPath, required)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(file.Profiles) == 0 {
+		return "", nil, nil
+	}
+
+	name, ok := argValue(args, "context")
+	if !ok {
+		kubeconfig, _ := argValue(args, "kubeconfig")
+		name = k8s.CurrentContext(kubeconfig)
+	}
+	options, ok := file.Profiles[name]
+	if !ok {
+		return "", nil, nil
+	}
+	profile, err := optionArgs(options)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid profile of context %s: %w", name, err)
+	}
+	return name, profile, nil
+}
+
+// argValue returns the value of the string flag name in args, given with one
+// or two dashes as -name value or -name=value, before the flags are parsed.
+// The last occurrence wins, as with the flag package.
+func argValue(args []string, name string) (string, bool) {
+	var (
+		value string
+		found bool
+	)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		// Values of other flags are skipped
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		flagName, flagValue, hasValue := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"), "=")
+		if flagName != name {
+			continue
+		}
+		switch {
+		case hasValue:
+			value, found = flagValue, true
+		case i+1 < len(args):
+			i++
+			value, found = args[i], true
+		}
+	}
+	return value, found
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/prometheus"
+)
+
+// prometheusFlags are the flags configuring access to a Prometheus-compatible
+// backend, shared by every command that queries one.
+type prometheusFlags struct {
+	url     *string
+	tenant  *string
+	timeout *time.Duration
+	headers headerFlag
+}
+
+// definePrometheusFlags registers the Prometheus access flags on fs.
+func (p *Parser) definePrometheusFlags(fs *flag.FlagSet, urlUsage string) *prometheusFlags {
+	f := &prometheusFlags{
+		url:     fs.String("prometheus-url", os.Getenv("KUSAGE_PROMETHEUS_URL"), urlUsage),
+		tenant:  fs.String("prometheus-tenant", os.Getenv("KUSAGE_PROMETHEUS_TENANT"), "Tenant sent as X-Scope-OrgID to multi-tenant stores"),
+		timeout: fs.Duration("prometheus-timeout", 0, "Query evaluation timeout requested from the server (default: server default)"),
+		headers: headerFlag{},
+	}
+	fs.Var(f.headers, "prometheus-header", "Header sent with every query as 'Name: Value' (repeatable)")
+	return f
+}
+
+// apply copies the Prometheus access settings to opts, extending the overall
+// timeout to cover the requested query timeout.
+func (f *prometheusFlags) apply(opts *config.Options) {
+	opts.PrometheusURL = *f.url
+	opts.PrometheusTenant = *f.tenant
+	opts.PrometheusTimeout = *f.timeout
+	if len(f.headers) > 0 {
+		opts.PrometheusHeaders = f.headers
+	}
+	if opts.PrometheusTimeout > 0 && opts.Timeout < opts.PrometheusTimeout {
+		opts.Timeout = opts.PrometheusTimeout
+	}
+}
+
+// headerFlag collects repeated "Name: Value" flags.
+type headerFlag map[string]string
+
+// String returns the header names, omitting values which may hold credentials.
+func (h headerFlag) String() string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// Set parses a single "Name: Value" header.
+func (h headerFlag) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("invalid header %q (expected 'Name: Value')", value)
+	}
+	h[name] = strings.TrimSpace(val)
+	return nil
+}
+
+// newPrometheusClient creates a client for the configured Prometheus-compatible backend.
+func newPrometheusClient(opts config.Options) (*prometheus.Client, error) {
+	client, err := prometheus.New(opts.PrometheusURL)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range opts.PrometheusHeaders {
+		client.WithHeader(name, value)
+	}
+	if opts.PrometheusTenant != "" {
+		client.WithTenant(opts.PrometheusTenant)
+	}
+	if opts.PrometheusTimeout > 0 {
+		client.WithTimeout(opts.PrometheusTimeout)
+	}
+	return client, nil
+}
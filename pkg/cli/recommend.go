@@ -0,0 +1,386 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+
+	"github.com/mchmarny/kusage/pkg/analyzer"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/k8s"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/observability"
+	"github.com/mchmarny/kusage/pkg/output"
+)
+
+// patchAPIVersions are the API versions of the workload kinds patches are
+// written for. Pods, and the jobs of a CronJob, cannot change the resources
+// of a running template, so they get no patch.
+var patchAPIVersions = map[string]string{
+	"Deployment":  "apps/v1",
+	"StatefulSet": "apps/v1",
+	"DaemonSet":   "apps/v1",
+	"ReplicaSet":  "apps/v1",
+}
+
+// parseRecommend parses the flags of the recommend subcommand.
+func (p *Parser) parseRecommend(args []string) (*config.Options, error) {
+	fs := flag.NewFlagSet(p.programName+" recommend", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		allNamespaces   = fs.Bool("A", false, "If present, recommend across all namespaces")
+		namespace       = fs.String("n", "default", "Namespace or glob of namespaces to use (ignored with -A)")
+		labelSelector   = fs.String("l", "", "Label selector")
+		excludeNS       = fs.String("nx", "", "Regex of namespaces to exclude")
+		excludeLabels   = fs.String("lx", "", "Regex of labels to exclude")
+		requestHeadroom = fs.Float64("request-headroom", 1.2, "Factor the peak usage is multiplied by into the suggested requests")
+		limitHeadroom   = fs.Float64("limit-headroom", 1.5, "Factor the peak usage is multiplied by into the suggested limits, 0 to suggest no limits")
+		patchDir        = fs.String("patch-dir", "", "Directory to write a patch YAML per workload to")
+		kustomize       = fs.Bool("kustomize", false, "Also write a kustomize component applying the patches to --patch-dir")
+		kubectlPatches  = fs.Bool("kubectl", false, "Print a kubectl patch command per workload instead of the table")
+		samples         = fs.Int("samples", 1, "Collect usage this many times, --interval apart, and recommend from the peak")
+		interval        = fs.Duration("interval", 30*time.Second, "Time between the collections of --samples")
+		noHeaders       = fs.Bool("no-headers", false, "If true, suppress headers in the output")
+		pageSize        = fs.Int64("page-size", 500, "Number of items to fetch per API call")
+		enableMetrics   = fs.Bool("metrics", false, "Enable detailed performance metrics collection")
+		timeout         = fs.Duration("timeout", 30*time.Second, "Time allowed for the whole run, across all pages and retries (e.g. 5m)")
+		kube            = p.defineKubeconfigFlags(fs)
+
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+	if *samples < 1 {
+		return nil, fmt.Errorf("invalid --samples %d (expected at least 1)", *samples)
+	}
+
+	// Recommendations cover every container, limited or not
+	opts := &config.Options{
+		Namespace:       *namespace,
+		AllNamespaces:   *allNamespaces,
+		LabelSelector:   *labelSelector,
+		Mode:            config.ModeRecommend,
+		Output:          config.OutputTable,
+		NoHeaders:       *noHeaders,
+		LogLevel:        level,
+		IncludeNoLimit:  true,
+		PageSize:        *pageSize,
+		EnableMetrics:   *enableMetrics,
+		Timeout:         *timeout,
+		Samples:         *samples,
+		Interval:        *interval,
+		RequestHeadroom: *requestHeadroom,
+		LimitHeadroom:   *limitHeadroom,
+		PatchDir:        *patchDir,
+		Kustomize:       *kustomize,
+		KubectlPatches:  *kubectlPatches,
+	}
+	kube.apply(opts)
+
+	// Samples are collected --interval apart within the timeout
+	if opts.Samples > 1 && !flagSet(fs, "timeout") {
+		opts.Timeout += time.Duration(opts.Samples-1) * opts.Interval
+	}
+
+	if *excludeNS != "" {
+		excludeRegex, err := regexp.Compile(*excludeNS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nx regex: %w", err)
+		}
+		opts.ExcludeNamespaces = excludeRegex
+	}
+	if *excludeLabels != "" {
+		excludeRegex, err := regexp.Compile(*excludeLabels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --lx regex: %w", err)
+		}
+		opts.ExcludeLabels = excludeRegex
+	}
+
+	p.applyPluginDefaults(fs, opts)
+	p.parseNamespacePattern(opts)
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return opts, nil
+}
+
+// runRecommend collects the containers in scope opts.Samples times and
+// prints the requests and limits their peak usage calls for, or with
+// opts.KubectlPatches the commands applying them, writing a patch per
+// workload to opts.PatchDir when set.
+func runRecommend(opts config.Options, observer *observability.Metrics) error {
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, observer)...)
+	if err != nil {
+		if observer != nil {
+			observer.RecordError(err, "kubernetes client initialization")
+		}
+		return err
+	}
+	dataCollector, err := newDataCollector(clientManager, opts, observer)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	// The containers are collected as a containers run of both resources would
+	collect := opts
+	collect.Mode = config.ModeContainers
+	collect.Resource = config.ResourceAll
+
+	collectionStart := time.Now()
+	samples, err := collectSamples(ctx, dataCollector, collect, waitInterval)
+	if err != nil {
+		if observer != nil {
+			observer.RecordError(err, "data collection")
+		}
+		return err
+	}
+	var rows []metrics.Row
+	for _, sample := range samples {
+		rows = append(rows, sample.Rows...)
+	}
+	if observer != nil {
+		observer.SetCollectionDuration(time.Since(collectionStart))
+		observer.ResultsGenerated = int64(len(rows))
+	}
+
+	dataAnalyzer := analyzer.New()
+	recommendations := dataAnalyzer.Recommend(rows, opts)
+	if len(recommendations) == 0 {
+		slog.Info("no containers found to recommend requests and limits for")
+	}
+
+	// Budgets only add context, so recommendations are reported without them
+	// when they cannot be read, e.g. for lack of permissions
+	budgets, err := dataCollector.DisruptionBudgets(ctx, opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		slog.Warn("reporting recommendations without disruption budgets", "error", err)
+	} else {
+		dataAnalyzer.ApplyDisruptionBudgets(recommendations, budgets)
+	}
+
+	if opts.KubectlPatches {
+		commands, err := kubectlPatchCommands(recommendations, opts)
+		if err != nil {
+			return err
+		}
+		for _, command := range commands {
+			fmt.Println(command)
+		}
+	} else {
+		outputFormatter := output.New()
+		defer outputFormatter.Close()
+		if err := outputFormatter.PrintRecommendations(recommendations, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.PatchDir == "" {
+		return nil
+	}
+	paths, err := writePatches(opts.PatchDir, recommendations, opts.Kustomize)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d patches written to %s\n", len(paths), opts.PatchDir)
+	return nil
+}
+
+// workloadPatch is a strategic merge patch of the container resources of a
+// workload's pod template.
+type workloadPatch struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   patchMetadata `json:"metadata"`
+	Spec       patchSpec     `json:"spec"`
+}
+
+type patchMetadata struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type patchSpec struct {
+	Template patchTemplate `json:"template"`
+}
+
+type patchTemplate struct {
+	Spec patchPodSpec `json:"spec"`
+}
+
+type patchPodSpec struct {
+	Containers []patchContainer `json:"containers"`
+}
+
+type patchContainer struct {
+	Name      string                      `json:"name"`
+	Resources corev1.ResourceRequirements `json:"resources"`
+}
+
+// workloadPatches builds the patch of every workload of a kind in
+// patchAPIVersions, in the order of recommendations, keyed by the file name
+// it is written to. Recommendations of other workloads are skipped.
+func workloadPatches(recommendations []metrics.Recommendation) ([]string, map[string]*workloadPatch) {
+	var (
+		names   []string
+		patches = make(map[string]*workloadPatch)
+	)
+	for _, r := range recommendations {
+		kind, name, _ := strings.Cut(r.Owner, "/")
+		apiVersion, ok := patchAPIVersions[kind]
+		if !ok {
+			slog.Debug("no patch for workload kind", "namespace", r.Namespace, "owner", r.Owner)
+			continue
+		}
+
+		file := r.Namespace + "-" + strings.ToLower(kind) + "-" + name + ".yaml"
+		patch, exists := patches[file]
+		if !exists {
+			patch = &workloadPatch{
+				APIVersion: apiVersion,
+				Kind:       kind,
+				Metadata:   patchMetadata{Name: name, Namespace: r.Namespace},
+			}
+			patches[file] = patch
+			names = append(names, file)
+		}
+		patch.Spec.Template.Spec.Containers = append(patch.Spec.Template.Spec.Containers, patchContainer{
+			Name:      r.Container,
+			Resources: suggestedResources(r.Suggested),
+		})
+	}
+	return names, patches
+}
+
+// suggestedResources converts suggested settings to container resources,
+// leaving out the limits that are not suggested.
+func suggestedResources(s metrics.ResourceSettings) corev1.ResourceRequirements {
+	resources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceMemory: *resource.NewQuantity(metrics.MiToBytes(s.MemoryRequestMi), resource.BinarySI),
+			corev1.ResourceCPU:    *resource.NewMilliQuantity(s.CPURequestMc, resource.DecimalSI),
+		},
+	}
+	if s.MemoryLimitMi > 0 || s.CPULimitMc > 0 {
+		resources.Limits = corev1.ResourceList{}
+	}
+	if s.MemoryLimitMi > 0 {
+		resources.Limits[corev1.ResourceMemory] = *resource.NewQuantity(metrics.MiToBytes(s.MemoryLimitMi), resource.BinarySI)
+	}
+	if s.CPULimitMc > 0 {
+		resources.Limits[corev1.ResourceCPU] = *resource.NewMilliQuantity(s.CPULimitMc, resource.DecimalSI)
+	}
+	return resources
+}
+
+// kustomizeComponent is a kustomize component applying the patches written
+// next to it, included from an overlay with components: [<dir>].
+type kustomizeComponent struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Patches    []kustomizePatch `json:"patches"`
+}
+
+type kustomizePatch struct {
+	Path string `json:"path"`
+}
+
+// writePatches writes the patch of every workload of recommendations to dir
+// and returns their paths. With kustomize a kustomization.yaml declaring a
+// component of the patches is written too.
+func writePatches(dir string, recommendations []metrics.Recommendation, kustomize bool) ([]string, error) {
+	names, patches := workloadPatches(recommendations)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create patch directory: %w", err)
+	}
+
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		data, err := yaml.Marshal(patches[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode patch %s: %w", name, err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write patch: %w", err)
+		}
+		paths = append(paths, path)
+	}
+
+	if !kustomize {
+		return paths, nil
+	}
+	component := kustomizeComponent{APIVersion: "kustomize.config.k8s.io/v1alpha1", Kind: "Component"}
+	for _, name := range names {
+		component.Patches = append(component.Patches, kustomizePatch{Path: name})
+	}
+	data, err := yaml.Marshal(component)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode kustomization: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write kustomization: %w", err)
+	}
+	return paths, nil
+}
+
+// kubectlPatchCommands returns a kubectl patch command per patched workload
+// of recommendations, targeting the context and kubeconfig of opts.
+func kubectlPatchCommands(recommendations []metrics.Recommendation, opts config.Options) ([]string, error) {
+	names, patches := workloadPatches(recommendations)
+	commands := make([]string, 0, len(names))
+	for _, name := range names {
+		patch := patches[name]
+		data, err := json.Marshal(struct {
+			Spec patchSpec `json:"spec"`
+		}{patch.Spec})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode patch %s: %w", name, err)
+		}
+
+		command := fmt.Sprintf("kubectl patch %s %s -n %s", strings.ToLower(patch.Kind), patch.Metadata.Name, patch.Metadata.Namespace)
+		if opts.Context != "" {
+			command += " --context " + opts.Context
+		}
+		if opts.Kubeconfig != "" {
+			command += " --kubeconfig " + opts.Kubeconfig
+		}
+		commands = append(commands, command+" -p '"+string(data)+"'")
+	}
+	return commands, nil
+}
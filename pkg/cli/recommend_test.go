@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+func TestWritePatches(t *testing.T) {
+	suggested := metrics.ResourceSettings{MemoryRequestMi: 361, MemoryLimitMi: 451, CPURequestMc: 180, CPULimitMc: 225}
+	recommendations := []metrics.Recommendation{
+		{Namespace: "payments", Owner: "Deployment/payments-api", Container: "api", Suggested: suggested},
+		{Namespace: "payments", Owner: "Deployment/payments-api", Container: "istio-proxy",
+			Suggested: metrics.ResourceSettings{MemoryRequestMi: 64, CPURequestMc: 20}},
+		{Namespace: "payments", Owner: "Pod/debug", Container: "shell", Suggested: suggested},
+		{Namespace: "batch", Owner: "Job/report-28911", Container: "report", Suggested: suggested},
+	}
+
+	dir := t.TempDir()
+	paths, err := writePatches(dir, recommendations, false)
+	if err != nil {
+		t.Fatalf("writePatches failed: %v", err)
+	}
+	// Pods and jobs cannot be patched, so only the deployment gets a patch
+	want := filepath.Join(dir, "payments-deployment-payments-api.yaml")
+	if len(paths) != 1 || paths[0] != want {
+		t.Fatalf("expected a single deployment patch, got %v", paths)
+	}
+
+	data, err := os.ReadFile(want)
+	if err != nil {
+		t.Fatalf("failed to read patch: %v", err)
+	}
+	expected := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: payments-api
+  namespace: payments
+spec:
+  template:
+    spec:
+      containers:
+      - name: api
+        resources:
+          limits:
+            cpu: 225m
+            memory: 451Mi
+          requests:
+            cpu: 180m
+            memory: 361Mi
+      - name: istio-proxy
+        resources:
+          requests:
+            cpu: 20m
+            memory: 64Mi
+`
+	if string(data) != expected {
+		t.Errorf("unexpected patch:\n%s\nwant:\n%s", data, expected)
+	}
+}
+
+func TestWritePatches_Kustomize(t *testing.T) {
+	recommendations := []metrics.Recommendation{
+		{Namespace: "payments", Owner: "Deployment/payments-api", Container: "api",
+			Suggested: metrics.ResourceSettings{MemoryRequestMi: 64, CPURequestMc: 20}},
+		{Namespace: "payments", Owner: "StatefulSet/payments-db", Container: "postgres",
+			Suggested: metrics.ResourceSettings{MemoryRequestMi: 1024, CPURequestMc: 500}},
+	}
+
+	dir := t.TempDir()
+	if _, err := writePatches(dir, recommendations, true); err != nil {
+		t.Fatalf("writePatches failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "kustomization.yaml"))
+	if err != nil {
+		t.Fatalf("failed to read kustomization: %v", err)
+	}
+	expected := `apiVersion: kustomize.config.k8s.io/v1alpha1
+kind: Component
+patches:
+- path: payments-deployment-payments-api.yaml
+- path: payments-statefulset-payments-db.yaml
+`
+	if string(data) != expected {
+		t.Errorf("unexpected kustomization:\n%s\nwant:\n%s", data, expected)
+	}
+}
+
+func TestKubectlPatchCommands(t *testing.T) {
+	recommendations := []metrics.Recommendation{
+		{Namespace: "payments", Owner: "Deployment/payments-api", Container: "api",
+			Suggested: metrics.ResourceSettings{MemoryRequestMi: 361, MemoryLimitMi: 451, CPURequestMc: 180}},
+		{Namespace: "payments", Owner: "Pod/debug", Container: "shell",
+			Suggested: metrics.ResourceSettings{MemoryRequestMi: 16, CPURequestMc: 10}},
+	}
+
+	commands, err := kubectlPatchCommands(recommendations, config.Options{Context: "prod-us"})
+	if err != nil {
+		t.Fatalf("kubectlPatchCommands failed: %v", err)
+	}
+	expected := `kubectl patch deployment payments-api -n payments --context prod-us -p '{"spec":{"template":{"spec":{"containers":[{"name":"api","resources":{"limits":{"memory":"451Mi"},"requests":{"cpu":"180m","memory":"361Mi"}}}]}}}}'`
+	if len(commands) != 1 || commands[0] != expected {
+		t.Errorf("expected a command for the deployment only, got %v\nwant: %s", commands, expected)
+	}
+}
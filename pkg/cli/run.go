@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/mchmarny/kusage/pkg/config"
+)
+
+// optionsDocument is a declarative invocation read by the run command. Its
+// options are the long or short flag names of the command without dashes, so
+// a document accepts exactly the flags of its command and is validated the
+// same way.
+type optionsDocument struct {
+	// Command is the subcommand to run, e.g. pods or chargeback
+	Command string `json:"command"`
+	// Args are the positional arguments of the command, e.g. [containers] for compare
+	Args []string `json:"args,omitempty"`
+	// Options are the flag values keyed by flag name; lists repeat the flag
+	Options map[string]any `json:"options,omitempty"`
+}
+
+// parseRun parses the run command, which reads the subcommand and its flags
+// from an options document in a file or on stdin. Flags given after the file
+// override the values of the document.
+func (p *Parser) parseRun(args []string) (*config.Options, error) {
+	fs := flag.NewFlagSet(p.programName+" run", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	file := fs.String("f", "", "Options document (YAML or JSON) to run, or - for stdin")
+
+	// Only -f is parsed here; the flags after it are passed on to the command
+	n := min(len(args), 2)
+	if n > 0 && strings.Contains(args[0], "=") {
+		n = 1
+	}
+	if err := fs.Parse(args[:n]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if *file == "" {
+		return nil, errors.New("run requires an options document: -f FILE or -f - for stdin")
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if *file == "-" {
+		data, err = io.ReadAll(p.input)
+	} else {
+		data, err = os.ReadFile(filepath.Clean(*file))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read options document %s: %w", *file, err)
+	}
+
+	command, err := documentArgs(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options document %s: %w", *file, err)
+	}
+	command = append(command, fs.Args()...)
+	return p.Parse(append(append([]string{p.programName}, command...), args[n:]...))
+}
+
+// documentArgs converts an options document to the command line it stands for.
+func documentArgs(data []byte) ([]string, error) {
+	var doc optionsDocument
+	if err := yaml.UnmarshalStrict(data, &doc); err != nil {
+		return nil, err
+	}
+	switch doc.Command {
+	case "":
+		return nil, errors.New("missing command")
+	case "run", "version", "help":
+		return nil, fmt.Errorf("command %q cannot be run from an options document", doc.Command)
+	}
+
+	options, err := optionArgs(doc.Options)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]string{doc.Command}, doc.Args...), options...), nil
+}
+
+// optionArgs converts options keyed by flag name to flags, in name order so
+// the same options always yield the same flags. Lists repeat the flag.
+func optionArgs(options map[string]any) ([]string, error) {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		// YAML 1.1 reads unquoted keys such as n or y as booleans
+		if name == "true" || name == "false" {
+			return nil, fmt.Errorf("option %s: quote flag names read as booleans, e.g. \"n\": dev", name)
+		}
+		values, ok := options[name].([]any)
+		if !ok {
+			values = []any{options[name]}
+		}
+		for _, value := range values {
+			text, err := optionValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("option %s: %w", name, err)
+			}
+			args = append(args, "--"+name+"="+text)
+		}
+	}
+	return args, nil
+}
+
+// optionValue formats a scalar document value as a flag value.
+func optionValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", errors.New("missing value")
+	default:
+		return "", fmt.Errorf("unsupported value %v (expected a string, number, boolean or list of them)", v)
+	}
+}
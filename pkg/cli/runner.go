@@ -2,18 +2,48 @@ package cli
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"golang.org/x/sync/errgroup"
+
 	"github.com/mchmarny/kusage/pkg/analyzer"
+	"github.com/mchmarny/kusage/pkg/cadvisor"
+	"github.com/mchmarny/kusage/pkg/capacity"
+	"github.com/mchmarny/kusage/pkg/chargeback"
 	"github.com/mchmarny/kusage/pkg/collector"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/datadog"
 	"github.com/mchmarny/kusage/pkg/k8s"
+	"github.com/mchmarny/kusage/pkg/kubelet"
+	"github.com/mchmarny/kusage/pkg/kubestate"
+	"github.com/mchmarny/kusage/pkg/metrics"
 	"github.com/mchmarny/kusage/pkg/observability"
 	"github.com/mchmarny/kusage/pkg/output"
+	"github.com/mchmarny/kusage/pkg/promusage"
 )
 
-func Run() error {
+// ErrPolicyViolations is returned by the check command when any policy rule is violated.
+var ErrPolicyViolations = errors.New("policy violations found")
+
+// ErrUnmatchedMetrics is returned with --strict when too many pod metrics
+// belong to pods missing from the pod list.
+var ErrUnmatchedMetrics = errors.New("too many pod metrics without a listed pod")
+
+// ErrThresholdExceeded is returned with --fail-above when the usage percentage
+// of any printed row exceeds the threshold of a resource.
+var ErrThresholdExceeded = errors.New("rows above the --fail-above threshold")
+
+// Run parses the command line and executes the requested analysis.
+// The provided level is updated from the --log-level flag so the logger
+// configured by the caller honors the requested verbosity.
+func Run(level *slog.LevelVar) error {
 	parser := NewParser()
 	opts, err := parser.Parse(os.Args)
 	if err != nil {
@@ -24,32 +54,235 @@ func Run() error {
 		return nil
 	}
 
-	// Initialize metrics if enabled
-	var metrics *observability.Metrics
+	if level != nil {
+		level.Set(opts.LogLevel)
+	}
+
+	applyMemoryTuning(opts)
+
+	// Metrics are always recorded so degraded runs can be reported; the
+	// performance summary is only emitted when enabled
+	metrics := observability.NewMetrics()
+	defer reportReliability(os.Stderr, metrics)
 	if opts.EnableMetrics {
-		metrics = observability.NewMetrics()
-		defer func() {
-			// For metrics output, we want to ensure it's always visible
-			// So we'll use Warn level instead of Info level
-			summary := metrics.GetSummary()
-			slog.Warn("performance metrics summary",
-				"api_calls_total", summary.APICallsTotal,
-				"api_calls_successful", summary.APICallsSuccessful,
-				"api_calls_failed", summary.APICallsFailed,
-				"avg_api_call_duration_ms", summary.AvgAPICallDuration.Milliseconds(),
-				"pods_processed", summary.PodsProcessed,
-				"metrics_processed", summary.MetricsProcessed,
-				"results_generated", summary.ResultsGenerated,
-				"peak_memory_mb", summary.PeakMemoryUsageMB,
-				"current_memory_mb", summary.CurrentMemoryMB,
-				"collection_duration_ms", summary.CollectionDuration.Milliseconds(),
-				"analysis_duration_ms", summary.AnalysisDuration.Milliseconds(),
-				"total_duration_ms", summary.TotalDuration.Milliseconds(),
-				"error_count", summary.ErrorCount)
-		}()
-	}
-
-	clientManager, err := k8s.NewClientManager()
+		defer reportMetrics(metrics, opts.MetricsOutput)
+	}
+	if opts.APIImpact {
+		defer reportAPIImpact(os.Stderr, metrics, *opts)
+	}
+
+	switch opts.Mode {
+	case config.ModeChargeback:
+		return runChargeback(*opts, metrics)
+	case config.ModePools:
+		return runPools(*opts, metrics)
+	case config.ModePending:
+		return runPending(*opts, metrics)
+	case config.ModeVolumes:
+		return runVolumes(*opts, metrics)
+	case config.ModeSidecars:
+		return runSidecars(*opts, metrics)
+	case config.ModeNodes:
+		return runNodes(*opts, metrics)
+	case config.ModeFragmentation:
+		return runFragmentation(*opts, metrics)
+	case config.ModeSnapshots:
+		return runSnapshotList(*opts)
+	case config.ModeRecommend:
+		return runRecommend(*opts, metrics)
+	case config.ModeQuota:
+		return runQuota(*opts, metrics)
+	case config.ModeWaste:
+		return runWaste(*opts, metrics)
+	case config.ModeDoctor:
+		return runDoctor(*opts, metrics)
+	}
+	if opts.DryRun {
+		return runDryRun(*opts)
+	}
+	if opts.Listen != "" {
+		return runServe(*opts)
+	}
+	if opts.SaveSnapshot {
+		return runSnapshotSave(*opts, metrics)
+	}
+	if opts.Export {
+		return runExport(*opts, metrics)
+	}
+	if opts.Policy != nil || opts.Baseline != "" {
+		return runCheck(*opts, metrics)
+	}
+	if opts.Compare {
+		return runCompare(*opts, metrics)
+	}
+	if opts.DebugBundle != "" {
+		return runWithBundle(*opts, metrics)
+	}
+	if opts.Watch > 0 {
+		return runWatch(*opts, metrics)
+	}
+	return run(*opts, metrics)
+}
+
+// runCheck evaluates the policy rules against the pods or containers in scope
+// and, with a baseline, compares workload percentages against it, printing
+// the violations. It fails when any rule is violated so it can gate CI pipelines.
+func runCheck(opts config.Options, observer *observability.Metrics) error {
+	// Read the baseline first so a missing file fails before any API calls
+	var baseline metrics.Baseline
+	if opts.Baseline != "" && !opts.UpdateBaseline {
+		b, err := readBaseline(opts.Baseline)
+		if err != nil {
+			return err
+		}
+		if b.Mode != "" && b.Mode != opts.Mode {
+			return fmt.Errorf("baseline %s was recorded for %s, not %s", opts.Baseline, b.Mode, opts.Mode)
+		}
+		baseline = b
+	}
+
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, observer)...)
+	if err != nil {
+		if observer != nil {
+			observer.RecordError(err, "kubernetes client initialization")
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	// Baselines cover every resource, policies only the resources their rules check
+	resources := []config.ResourceKind{config.ResourceMemory, config.ResourceCPU}
+	if opts.Baseline == "" {
+		resources = opts.Policy.Resources()
+	}
+
+	collectionStart := time.Now()
+	dataCollector := collector.New(clientManager.CoreClient(), clientManager.MetricsClient()).WithMetrics(observer).WithPageSize(opts.PageSize)
+	rows, limits, err := dataCollector.Audit(ctx, opts, resources)
+	if err != nil {
+		if observer != nil {
+			observer.RecordError(err, "policy data collection")
+		}
+		return err
+	}
+	if observer != nil {
+		observer.SetCollectionDuration(time.Since(collectionStart))
+	}
+
+	dataAnalyzer := analyzer.New()
+	var violations []metrics.Violation
+	if opts.Policy != nil {
+		violations = dataAnalyzer.Check(opts.Policy, rows, limits)
+	}
+	if opts.Baseline != "" {
+		current := dataAnalyzer.Baseline(rows, opts)
+		if opts.UpdateBaseline {
+			if err := writeBaseline(opts.Baseline, current); err != nil {
+				return err
+			}
+			slog.Info("baseline updated", "path", opts.Baseline, "workloads", len(current.Workloads))
+		} else {
+			violations = append(violations, dataAnalyzer.Regressions(baseline, current, opts.Tolerance)...)
+		}
+	}
+	if observer != nil {
+		observer.ResultsGenerated = int64(len(violations))
+	}
+
+	outputFormatter := output.New()
+	defer outputFormatter.Close()
+	if err := outputFormatter.PrintViolations(violations, opts); err != nil {
+		return err
+	}
+
+	return violationsError(violations)
+}
+
+// violationsError summarizes the violations per rule, in the order the rules
+// were reported, or returns nil without any.
+func violationsError(violations []metrics.Violation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	var order []string
+	counts := make(map[string]int)
+	for _, violation := range violations {
+		if counts[violation.Rule] == 0 {
+			order = append(order, violation.Rule)
+		}
+		counts[violation.Rule]++
+	}
+	rules := make([]string, len(order))
+	for i, rule := range order {
+		rules[i] = fmt.Sprintf("%s=%d", rule, counts[rule])
+	}
+
+	return fmt.Errorf("%w: %d across %d rules (%s)", ErrPolicyViolations, len(violations), len(rules), strings.Join(rules, ", "))
+}
+
+// runCompare runs the analysis against every context concurrently and prints
+// the results of the first two side by side.
+func runCompare(opts config.Options, observer *observability.Metrics) error {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	dataAnalyzer := analyzer.New()
+	results := make([][]metrics.Row, len(opts.Contexts))
+
+	collectionStart := time.Now()
+	g, gctx := errgroup.WithContext(ctx)
+	for i, name := range opts.Contexts {
+		g.Go(func() error {
+			clientManager, err := k8s.NewClientManager(append(clientOptions(opts, observer), k8s.WithContext(name))...)
+			if err != nil {
+				return err
+			}
+			dataCollector := collector.New(clientManager.CoreClient(), clientManager.MetricsClient()).WithMetrics(observer).WithPageSize(opts.PageSize)
+			rows, err := dataCollector.Collect(gctx, opts)
+			if err != nil {
+				return fmt.Errorf("context %s: %w", name, err)
+			}
+			if err := dataAnalyzer.Score(rows, opts); err != nil {
+				return err
+			}
+			rows, err = dataAnalyzer.Select(rows, opts)
+			if err != nil {
+				return err
+			}
+			results[i] = rows
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		if observer != nil {
+			observer.RecordError(err, "cluster comparison")
+		}
+		return err
+	}
+	if observer != nil {
+		observer.SetCollectionDuration(time.Since(collectionStart))
+	}
+
+	comparisons := dataAnalyzer.Compare(results[0], results[1], opts.MinDelta, opts)
+	if opts.TopN > 0 && len(comparisons) > opts.TopN {
+		comparisons = comparisons[:opts.TopN]
+	}
+	if observer != nil {
+		observer.ResultsGenerated = int64(len(comparisons))
+	}
+
+	outputFormatter := output.New()
+	defer outputFormatter.Close()
+	return outputFormatter.PrintComparison(comparisons, opts.Contexts, opts)
+}
+
+// runPools reports capacity and consumption per node pool, projecting when each
+// pool fills up when a Prometheus URL is configured.
+func runPools(opts config.Options, metrics *observability.Metrics) error {
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, metrics)...)
 	if err != nil {
 		if metrics != nil {
 			metrics.RecordError(err, "kubernetes client initialization")
@@ -57,8 +290,341 @@ func Run() error {
 		return err
 	}
 
-	// app components using dependency injection
-	dataCollector := collector.New(clientManager.CoreClient(), clientManager.MetricsClient())
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	collectionStart := time.Now()
+	dataCollector := collector.New(clientManager.CoreClient(), clientManager.MetricsClient()).WithMetrics(metrics).WithPageSize(opts.PageSize)
+	pools, err := dataCollector.NodePools(ctx, opts)
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "node pool collection")
+		}
+		return err
+	}
+
+	// Growth is optional; without history pools are reported without a projection
+	var growth map[string]float64
+	if opts.PrometheusURL != "" {
+		client, err := newPrometheusClient(opts)
+		if err != nil {
+			return err
+		}
+		growth, err = capacity.New(client).Growth(ctx, opts)
+		if err != nil {
+			if metrics != nil {
+				metrics.RecordError(err, "pool growth history")
+			}
+			return err
+		}
+	}
+	if metrics != nil {
+		metrics.SetCollectionDuration(time.Since(collectionStart))
+		metrics.ResultsGenerated = int64(len(pools))
+	}
+
+	analyzer.New().ProjectPools(pools, growth)
+
+	outputFormatter := output.New()
+	defer outputFormatter.Close()
+	return outputFormatter.PrintPools(pools, opts)
+}
+
+// runPending reports unschedulable pods and whether inflated requests of the
+// pods already running are what keeps them from fitting.
+func runPending(opts config.Options, metrics *observability.Metrics) error {
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, metrics)...)
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "kubernetes client initialization")
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	collectionStart := time.Now()
+	dataCollector := collector.New(clientManager.CoreClient(), clientManager.MetricsClient()).WithMetrics(metrics).WithPageSize(opts.PageSize)
+	pending, nodes, err := dataCollector.Scheduling(ctx, opts)
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "scheduling collection")
+		}
+		return err
+	}
+	if metrics != nil {
+		metrics.SetCollectionDuration(time.Since(collectionStart))
+		metrics.ResultsGenerated = int64(len(pending))
+	}
+
+	if len(pending) == 0 {
+		slog.Info("no unschedulable pods found")
+	}
+	analyzer.New().DiagnosePending(pending, nodes)
+
+	outputFormatter := output.New()
+	defer outputFormatter.Close()
+	return outputFormatter.PrintPending(pending, opts)
+}
+
+// runVolumes reports the fullest persistent volume claims mounted by the pods
+// in scope, from the kubelet Summary API of the nodes they run on.
+func runVolumes(opts config.Options, metrics *observability.Metrics) error {
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, metrics)...)
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "kubernetes client initialization")
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	collectionStart := time.Now()
+	dataCollector := collector.New(clientManager.CoreClient(), clientManager.MetricsClient()).WithMetrics(metrics).WithPageSize(opts.PageSize)
+	volumes, err := dataCollector.Volumes(ctx, opts, kubelet.New(clientManager.CoreClient()))
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "volume collection")
+		}
+		return err
+	}
+	if metrics != nil {
+		metrics.SetCollectionDuration(time.Since(collectionStart))
+		metrics.ResultsGenerated = int64(len(volumes))
+	}
+
+	if len(volumes) == 0 {
+		slog.Info("no persistent volume claims found")
+	}
+	volumes = analyzer.New().RankVolumes(volumes, opts)
+
+	outputFormatter := output.New()
+	defer outputFormatter.Close()
+	return outputFormatter.PrintVolumes(volumes, opts)
+}
+
+// runQuota compares the compute resources of the ResourceQuotas in scope
+// with what they admitted and what the pods of their namespaces use.
+func runQuota(opts config.Options, metrics *observability.Metrics) error {
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, metrics)...)
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "kubernetes client initialization")
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	collectionStart := time.Now()
+	dataCollector := collector.New(clientManager.CoreClient(), clientManager.MetricsClient()).WithMetrics(metrics).WithPageSize(opts.PageSize)
+	quotas, err := dataCollector.Quotas(ctx, opts)
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "quota collection")
+		}
+		return err
+	}
+	if metrics != nil {
+		metrics.SetCollectionDuration(time.Since(collectionStart))
+		metrics.ResultsGenerated = int64(len(quotas))
+	}
+
+	if len(quotas) == 0 {
+		slog.Info("no resource quotas limiting memory or cpu found")
+	}
+	quotas = analyzer.New().RankQuotas(quotas)
+
+	outputFormatter := output.New()
+	defer outputFormatter.Close()
+	return outputFormatter.PrintQuotas(quotas, opts)
+}
+
+// runSidecars reports the share of pod usage and limits consumed by sidecar
+// containers such as service-mesh proxies.
+func runSidecars(opts config.Options, metrics *observability.Metrics) error {
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, metrics)...)
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "kubernetes client initialization")
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	collectionStart := time.Now()
+	dataCollector := collector.New(clientManager.CoreClient(), clientManager.MetricsClient()).WithMetrics(metrics).WithPageSize(opts.PageSize)
+	pods, err := dataCollector.Sidecars(ctx, opts)
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "sidecar collection")
+		}
+		return err
+	}
+	if metrics != nil {
+		metrics.SetCollectionDuration(time.Since(collectionStart))
+		metrics.ResultsGenerated = int64(len(pods))
+	}
+
+	if len(pods) == 0 {
+		slog.Info("no pods with sidecars found", "patterns", opts.SidecarPatterns)
+	}
+	pods, total := analyzer.New().RankSidecars(pods, opts)
+
+	outputFormatter := output.New()
+	defer outputFormatter.Close()
+	return outputFormatter.PrintSidecars(pods, total, opts)
+}
+
+// runNodes reports the requested and used share of the allocatable CPU and
+// memory of every node, and the filesystem usage the kubelet evicts pods on.
+func runNodes(opts config.Options, metrics *observability.Metrics) error {
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, metrics)...)
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "kubernetes client initialization")
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	collectionStart := time.Now()
+	dataCollector := collector.New(clientManager.CoreClient(), clientManager.MetricsClient()).WithMetrics(metrics).WithPageSize(opts.PageSize)
+	nodes, err := dataCollector.Nodes(ctx, kubelet.New(clientManager.CoreClient()))
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "node collection")
+		}
+		return err
+	}
+	if metrics != nil {
+		metrics.SetCollectionDuration(time.Since(collectionStart))
+		metrics.ResultsGenerated = int64(len(nodes))
+	}
+
+	outputFormatter := output.New()
+	defer outputFormatter.Close()
+	return outputFormatter.PrintNodes(nodes, opts)
+}
+
+// runFragmentation reports the free node capacity pods of the typical shape
+// cannot use, to explain pods that do not schedule on a cluster with headroom.
+func runFragmentation(opts config.Options, metrics *observability.Metrics) error {
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, metrics)...)
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "kubernetes client initialization")
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	collectionStart := time.Now()
+	dataCollector := collector.New(clientManager.CoreClient(), clientManager.MetricsClient()).WithMetrics(metrics).WithPageSize(opts.PageSize)
+	_, nodes, err := dataCollector.Scheduling(ctx, opts)
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "scheduling collection")
+		}
+		return err
+	}
+	if metrics != nil {
+		metrics.SetCollectionDuration(time.Since(collectionStart))
+		metrics.ResultsGenerated = int64(len(nodes))
+	}
+
+	a := analyzer.New()
+	// Either request of the shape can be overridden on its own
+	shape := a.TypicalPodShape(nodes)
+	if opts.PodCPUMc > 0 {
+		shape.CPUMc = opts.PodCPUMc
+	}
+	if opts.PodMemoryMi > 0 {
+		shape.MemoryMi = opts.PodMemoryMi
+	}
+	if shape.CPUMc == 0 && shape.MemoryMi == 0 {
+		return errors.New("no pod requests found to derive the typical pod shape from, set --pod-cpu and --pod-memory")
+	}
+
+	outputFormatter := output.New()
+	defer outputFormatter.Close()
+	return outputFormatter.PrintFragmentation(a.Fragmentation(nodes, shape), opts)
+}
+
+// runChargeback reports per-group consumed and reserved resources over the
+// requested period from Prometheus history.
+func runChargeback(opts config.Options, metrics *observability.Metrics) error {
+	client, err := newPrometheusClient(opts)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	collectionStart := time.Now()
+	lines, err := chargeback.New(client).Collect(ctx, opts)
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "chargeback collection")
+		}
+		return err
+	}
+	if metrics != nil {
+		metrics.SetCollectionDuration(time.Since(collectionStart))
+		metrics.ResultsGenerated = int64(len(lines))
+	}
+
+	outputFormatter := output.New()
+	defer outputFormatter.Close()
+	return outputFormatter.PrintChargeback(lines, opts)
+}
+
+// run executes the requested analysis with the parsed options.
+func run(opts config.Options, metrics *observability.Metrics, clientOpts ...k8s.Option) error {
+	// Resolve the output plugin first so a missing plugin fails before any API calls
+	var plugin *output.Plugin
+	if opts.Output.IsPlugin() {
+		p, err := output.LookupPlugin(string(opts.Output))
+		if err != nil {
+			return err
+		}
+		plugin = p
+	}
+
+	// app components using dependency injection; rows of several contexts are
+	// collected by one collector per context
+	var (
+		clientManager *k8s.ClientManager
+		dataCollector *collector.Collector
+		rowSource     rowCollector
+		err           error
+	)
+	if len(opts.Contexts) > 0 {
+		rowSource, err = newFleetCollector(opts, metrics, clientOpts...)
+	} else {
+		clientManager, err = k8s.NewClientManager(append(clientOptions(opts, metrics), clientOpts...)...)
+		if err == nil {
+			dataCollector, err = newDataCollector(clientManager, opts, metrics)
+			rowSource = dataCollector
+		}
+	}
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "kubernetes client initialization")
+		}
+		return err
+	}
 	dataAnalyzer := analyzer.New()
 	outputFormatter := output.New()
 	defer outputFormatter.Close()
@@ -72,9 +638,31 @@ func Run() error {
 		metrics.UpdateMemoryUsage()
 	}
 
-	// Collect data from Kubernetes APIs
+	// Trace a single pod through the pipeline instead of printing the table
+	if opts.WhyPod != "" {
+		return explain(ctx, dataCollector, dataAnalyzer, outputFormatter, opts)
+	}
+
+	// Collect data from Kubernetes APIs, streaming it into a bounded top-N with --low-memory,
+	// reusing the rows of a recent run with --cache-ttl or merging several with --samples
 	collectionStart := time.Now()
-	rows, err := dataCollector.Collect(ctx, *opts)
+	var progress *progressPrinter
+	if opts.LowMemory {
+		topN := newTopNCollector(clientManager.CoreClient(), clientManager.MetricsClient(), dataAnalyzer, opts, metrics)
+		if progressiveOutput(opts) {
+			progress = &progressPrinter{w: os.Stdout, opts: opts}
+			topN.WithProgress(progress.print)
+		}
+		rowSource = topN
+	}
+	if opts.CacheTTL > 0 {
+		rowSource = newCachedCollector(rowSource, clientManager.Config().Host, opts.CacheTTL)
+	}
+	if opts.Samples > 1 {
+		rowSource = newSampledCollector(rowSource, dataAnalyzer, opts.Samples, opts.Interval)
+	}
+	rows, err := rowSource.Collect(ctx, opts)
+	progress.clear()
 	if err != nil {
 		if metrics != nil {
 			metrics.RecordError(err, "data collection")
@@ -87,13 +675,85 @@ func Run() error {
 		metrics.SetCollectionDuration(time.Since(collectionStart))
 		metrics.UpdateMemoryUsage()
 	}
+	if err := checkUnmatched(metrics, opts); err != nil {
+		return err
+	}
 
 	// Analyze and sort the collected data
 	analysisStart := time.Now()
-	dataAnalyzer.Sort(rows, *opts)
+	if opts.CronJobAggregation != "" {
+		rows = dataAnalyzer.GroupCronJobs(rows, opts)
+	}
+	switch opts.GroupBy {
+	case config.GroupByNode:
+		rows = dataAnalyzer.SumByNode(rows, opts)
+	case config.GroupByContainerName:
+		rows = dataAnalyzer.GroupContainerNames(rows)
+	}
+	if err := dataAnalyzer.Score(rows, opts); err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "scoring")
+		}
+		return err
+	}
+	dataAnalyzer.Classify(rows, opts)
+	rows, err = dataAnalyzer.Select(rows, opts)
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "filtering")
+		}
+		return err
+	}
+	dataAnalyzer.Sort(rows, opts)
+
+	// Price the full result set, so cost centers and rollups cover every row
+	rollups, err := priceRows(ctx, dataCollector, dataAnalyzer, rows, opts)
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "pricing")
+		}
+		return err
+	}
+
+	// Attribute the full result set to cost centers when requested
+	if opts.CostCenterKey != "" {
+		costCenters, err := dataCollector.NamespaceAttributes(ctx, opts, opts.CostCenterKey)
+		if err != nil {
+			if metrics != nil {
+				metrics.RecordError(err, "cost center lookup")
+			}
+			return err
+		}
+		groups := dataAnalyzer.GroupByCostCenter(rows, costCenters, opts)
+		if metrics != nil {
+			metrics.SetAnalysisDuration(time.Since(analysisStart))
+			metrics.ResultsGenerated = int64(len(groups))
+		}
+		return outputFormatter.PrintCostCenters(groups, opts)
+	}
+
+	// Print aggregate statistics over the full result set when requested
+	if opts.SummaryOnly {
+		summary := dataAnalyzer.Summarize(rows, opts)
+		if metrics != nil {
+			metrics.SetAnalysisDuration(time.Since(analysisStart))
+			metrics.ResultsGenerated = int64(summary.Count)
+		}
+		return outputFormatter.PrintSummary(summary, opts)
+	}
 
 	// Apply post-processing filters
-	rows = dataAnalyzer.Filter(rows, *opts)
+	rows = dataAnalyzer.Filter(rows, opts)
+
+	// Network rates are only read from the nodes hosting the remaining rows
+	if opts.ShowNetwork {
+		if err := attachNetwork(ctx, kubelet.New(clientManager.CoreClient()), rows); err != nil {
+			if metrics != nil {
+				metrics.RecordError(err, "network stats")
+			}
+			return err
+		}
+	}
 
 	// Record analysis completion
 	if metrics != nil {
@@ -102,10 +762,263 @@ func Run() error {
 	}
 
 	// Format and output the results
-	err = outputFormatter.PrintTable(rows, *opts)
-	if err != nil && metrics != nil {
-		metrics.RecordError(err, "output formatting")
+	switch {
+	case plugin != nil:
+		err = plugin.Render(ctx, rows, opts)
+	case opts.NodeSubtotals:
+		err = outputFormatter.PrintGroups(dataAnalyzer.GroupByNode(rows, opts), opts)
+	default:
+		err = outputFormatter.PrintTable(rows, opts)
+	}
+	if err != nil {
+		if metrics != nil {
+			metrics.RecordError(err, "output formatting")
+		}
+		return err
+	}
+
+	// Cost rollups cover all rows, not only the printed ones
+	if opts.CostBy != "" {
+		if err := outputFormatter.PrintCostRollup(rollups, opts); err != nil {
+			if metrics != nil {
+				metrics.RecordError(err, "output formatting")
+			}
+			return err
+		}
+	}
+
+	return checkFailAbove(rows, opts)
+}
+
+// newDataCollector returns a collector reading pods and usage from the
+// sources selected in opts.
+func newDataCollector(clientManager *k8s.ClientManager, opts config.Options, metrics *observability.Metrics) (*collector.Collector, error) {
+	dataCollector := collector.New(clientManager.CoreClient(), clientManager.MetricsClient()).WithMetrics(metrics).WithPageSize(opts.PageSize)
+	if opts.LimitsSource == config.LimitsSourceKubeStateMetrics {
+		client, err := newPrometheusClient(opts)
+		if err != nil {
+			return nil, err
+		}
+		dataCollector.WithPodSource(kubestate.New(client))
+	}
+	if opts.Source == config.UsageSourcePrometheus {
+		client, err := newPrometheusClient(opts)
+		if err != nil {
+			return nil, err
+		}
+		dataCollector.WithMetricsSource(promusage.New(client))
+	}
+	if opts.Source == config.UsageSourceDatadog {
+		client, err := datadog.NewFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		dataCollector.WithMetricsSource(datadog.NewSource(client))
+	}
+	if opts.Source == config.UsageSourceCAdvisor {
+		dataCollector.WithMetricsSource(cadvisor.New(clientManager.CoreClient()))
+	}
+	return dataCollector, nil
+}
+
+// checkFailAbove fails runs with opts.FailAbove in which the usage percentage
+// of a row exceeds the threshold of any of its resources. Rows without a limit
+// of a resource have no percentage of it and never exceed its threshold.
+func checkFailAbove(rows []metrics.Row, opts config.Options) error {
+	if len(opts.FailAbove) == 0 {
+		return nil
 	}
 
-	return err
+	var (
+		exceeded int
+		worst    string
+		peak     float64
+	)
+	for _, row := range rows {
+		above := false
+		for resource, threshold := range opts.FailAbove {
+			percent, ok := row.ResourcePercentage(resource)
+			if !ok || percent <= threshold {
+				continue
+			}
+			above = true
+			if percent > peak {
+				peak, worst = percent, fmt.Sprintf("%s/%s at %.1f%% %s", row.Namespace, row.Name, percent, resource)
+			}
+		}
+		if above {
+			exceeded++
+		}
+	}
+	if exceeded == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %d of %d rows, highest %s", ErrThresholdExceeded, exceeded, len(rows), worst)
+}
+
+// checkUnmatched fails strict runs in which the share of pod metrics whose pod
+// was missing from the pod list exceeds opts.StrictThreshold.
+func checkUnmatched(metrics *observability.Metrics, opts config.Options) error {
+	if !opts.Strict || metrics == nil {
+		return nil
+	}
+	summary := metrics.GetSummary()
+	if percent := summary.UnmatchedPercent(); percent > opts.StrictThreshold {
+		return fmt.Errorf("%w: %d of %d (%.1f%%, --strict-threshold %.1f%%)",
+			ErrUnmatchedMetrics, summary.UnmatchedMetrics, summary.MetricsProcessed, percent, opts.StrictThreshold)
+	}
+	return nil
+}
+
+// priceRows sets the hourly cost of rows with opts.Pricing, reading the pool
+// of their nodes when prices differ per pool, and returns the costs rolled up
+// by opts.CostBy. Without pricing, rows are left unpriced.
+func priceRows(ctx context.Context, c *collector.Collector, a *analyzer.Analyzer, rows []metrics.Row, opts config.Options) ([]metrics.CostRollup, error) {
+	if opts.Pricing == nil {
+		return nil, nil
+	}
+
+	var pools map[string]string
+	if len(opts.Pricing.Pools) > 0 {
+		var err error
+		if pools, err = c.NodeLabels(ctx, opts.Pricing.PoolLabel); err != nil {
+			return nil, fmt.Errorf("failed to read node pools: %w", err)
+		}
+	}
+	a.Price(rows, opts.Pricing, pools)
+
+	if opts.CostBy == "" {
+		return nil, nil
+	}
+	return a.RollupCost(rows, opts), nil
+}
+
+// attachNetwork sets the network rates of rows, reading the kubelets of the
+// nodes the rows are scheduled on.
+func attachNetwork(ctx context.Context, reader *kubelet.Reader, rows []metrics.Row) error {
+	seen := make(map[string]bool)
+	var nodes []string
+	for _, row := range rows {
+		if row.Node != "" && !seen[row.Node] {
+			seen[row.Node] = true
+			nodes = append(nodes, row.Node)
+		}
+	}
+
+	usage, err := reader.PodNetwork(ctx, nodes)
+	if err != nil {
+		return err
+	}
+	for i := range rows {
+		if network, ok := usage[rows[i].Namespace+"/"+rows[i].Name]; ok {
+			rows[i].Network = &network
+		}
+	}
+	return nil
+}
+
+// explain traces the pod selected with --why through collection, filtering
+// and ranking, and prints the outcome of every stage.
+func explain(ctx context.Context, c *collector.Collector, a *analyzer.Analyzer, f *output.Formatter, opts config.Options) error {
+	traces, err := traceWhy(ctx, c, a, opts)
+	if err != nil {
+		return err
+	}
+	return f.PrintTraces(traces, opts)
+}
+
+// traceWhy returns the traces of the pods named opts.WhyPod, with the outcome
+// of the filter expression and the rank of their rows.
+func traceWhy(ctx context.Context, c *collector.Collector, a *analyzer.Analyzer, opts config.Options) ([]metrics.Trace, error) {
+	traces, rows, err := c.Explain(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.Score(rows, opts); err != nil {
+		return nil, err
+	}
+	a.Classify(rows, opts)
+	a.SelectTraces(traces, opts)
+	rows, err = a.Select(rows, opts)
+	if err != nil {
+		return nil, err
+	}
+	a.Sort(rows, opts)
+	a.Rank(traces, rows, opts)
+
+	return traces, nil
+}
+
+// reportReliability warns on w when any list call was retried, any circuit
+// breaker opened or any page was abandoned, so a degraded run is not mistaken
+// for a clean one. It writes to stderr to keep machine-readable output intact.
+func reportReliability(w io.Writer, metrics *observability.Metrics) {
+	reliability := metrics.GetSummary().Reliability
+	if !reliability.Degraded() {
+		return
+	}
+	if reliability.Complete() {
+		fmt.Fprintf(w, "WARNING: degraded API responses: %s\n", reliability)
+		return
+	}
+	fmt.Fprintf(w, "WARNING: results may be incomplete: %s\n", reliability)
+}
+
+// reportAPIImpact prints the requests the run issued per endpoint on w. Like
+// the reliability warnings it writes to stderr to keep the results intact.
+func reportAPIImpact(w io.Writer, metrics *observability.Metrics, opts config.Options) {
+	fmt.Fprintln(w)
+	if err := output.NewWithWriter(w).PrintAPIImpact(metrics.GetSummary().APITraffic, opts); err != nil {
+		slog.Warn("failed to print api impact", "error", err)
+	}
+}
+
+// reportMetrics finalizes the metrics and emits the summary. When path is set
+// the summary is written as JSON to that file, or to stderr for "-", so that
+// scheduled runs can be collected and trended; otherwise it is logged.
+func reportMetrics(metrics *observability.Metrics, path string) {
+	metrics.Finalize()
+	summary := metrics.GetSummary()
+
+	if path == "" {
+		// For metrics output, we want to ensure it's always visible
+		// So we'll use Warn level instead of Info level
+		slog.Warn("performance metrics summary",
+			"api_calls_total", summary.APICallsTotal,
+			"api_calls_successful", summary.APICallsSuccessful,
+			"api_calls_failed", summary.APICallsFailed,
+			"avg_api_call_duration_ms", summary.AvgAPICallDuration.Milliseconds(),
+			"pages_fetched", summary.PagesFetched,
+			"max_page_duration_ms", summary.MaxPageDuration.Milliseconds(),
+			"pods_processed", summary.PodsProcessed,
+			"metrics_processed", summary.MetricsProcessed,
+			"results_generated", summary.ResultsGenerated,
+			"peak_memory_mb", summary.PeakMemoryUsageMB,
+			"current_memory_mb", summary.CurrentMemoryMB,
+			"collection_duration_ms", summary.CollectionDuration.Milliseconds(),
+			"analysis_duration_ms", summary.AnalysisDuration.Milliseconds(),
+			"total_duration_ms", summary.TotalDuration.Milliseconds(),
+			"error_count", summary.ErrorCount,
+			"reliability", summary.Reliability.String())
+		return
+	}
+
+	if path == "-" {
+		if err := summary.WriteJSON(os.Stderr); err != nil {
+			slog.Error("failed to write metrics summary", "error", err)
+		}
+		return
+	}
+
+	file, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		slog.Error("failed to create metrics summary file", "path", path, "error", err)
+		return
+	}
+	defer file.Close()
+
+	if err := summary.WriteJSON(file); err != nil {
+		slog.Error("failed to write metrics summary", "path", path, "error", err)
+	}
 }
@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+func TestCheckFailAbove(t *testing.T) {
+	rows := []metrics.Row{
+		{Namespace: "payments", Name: "api", UsageMi: 95, LimitMi: 100, UsageMc: 100, LimitMc: 1000},
+		{Namespace: "payments", Name: "worker", UsageMi: 50, LimitMi: 100, UsageMc: 900, LimitMc: 1000},
+		{Namespace: "batch", Name: "job", UsageMi: 500},
+	}
+
+	tests := []struct {
+		name      string
+		failAbove map[config.ResourceKind]float64
+		wantErr   bool
+	}{
+		{name: "unset"},
+		{name: "memory below", failAbove: map[config.ResourceKind]float64{config.ResourceMemory: 95}},
+		{name: "memory above", failAbove: map[config.ResourceKind]float64{config.ResourceMemory: 90}, wantErr: true},
+		{name: "cpu above", failAbove: map[config.ResourceKind]float64{config.ResourceCPU: 80}, wantErr: true},
+		{name: "both below", failAbove: map[config.ResourceKind]float64{config.ResourceMemory: 99, config.ResourceCPU: 90}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkFailAbove(rows, config.Options{FailAbove: tt.failAbove})
+			if tt.wantErr != errors.Is(err, ErrThresholdExceeded) {
+				t.Errorf("expected exceeded %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	err := checkFailAbove(rows, config.Options{FailAbove: map[config.ResourceKind]float64{config.ResourceMemory: 40, config.ResourceCPU: 40}})
+	if want := "rows above the --fail-above threshold: 2 of 3 rows, highest payments/api at 95.0% memory"; err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/analyzer"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// sampledCollector collects rows several times, an interval apart, and
+// merges them into one row per pod or container reporting its mean usage and
+// the spread of the samples, since a single reading is noisy for CPU.
+type sampledCollector struct {
+	collector rowCollector
+	analyzer  *analyzer.Analyzer
+	samples   int
+	interval  time.Duration
+	wait      func(ctx context.Context, d time.Duration) error
+}
+
+// newSampledCollector returns a sampledCollector taking samples collections
+// of c, interval apart.
+func newSampledCollector(c rowCollector, a *analyzer.Analyzer, samples int, interval time.Duration) *sampledCollector {
+	return &sampledCollector{
+		collector: c,
+		analyzer:  a,
+		samples:   samples,
+		interval:  interval,
+		wait:      waitInterval,
+	}
+}
+
+// Collect collects the rows of every sample and merges them.
+func (s *sampledCollector) Collect(ctx context.Context, opts config.Options) ([]metrics.Row, error) {
+	samples := make([][]metrics.Row, 0, s.samples)
+	for i := range s.samples {
+		if i > 0 {
+			if err := s.wait(ctx, s.interval); err != nil {
+				return nil, fmt.Errorf("sampling interrupted after %d of %d samples: %w", i, s.samples, err)
+			}
+		}
+		rows, err := s.collector.Collect(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d of %d: %w", i+1, s.samples, err)
+		}
+		slog.Debug("usage sampled", "sample", i+1, "of", s.samples, "rows", len(rows))
+		samples = append(samples, rows)
+	}
+	return s.analyzer.MergeSamples(samples), nil
+}
+
+// waitInterval waits for d or until ctx is done.
+func waitInterval(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/analyzer"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// sequenceCollector returns its collections in order, one per call.
+type sequenceCollector struct {
+	collections [][]metrics.Row
+	calls       int
+}
+
+func (c *sequenceCollector) Collect(_ context.Context, _ config.Options) ([]metrics.Row, error) {
+	rows := c.collections[c.calls]
+	c.calls++
+	return rows, nil
+}
+
+func TestSampledCollector(t *testing.T) {
+	row := func(usage int64) metrics.Row {
+		return metrics.Row{Namespace: "web", Name: "api-0", Resource: config.ResourceCPU, UsageMc: usage, LimitMc: 1000}
+	}
+	source := &sequenceCollector{collections: [][]metrics.Row{{row(100)}, {row(300)}, {row(500)}}}
+	c := newSampledCollector(source, analyzer.New(), 3, 30*time.Second)
+	var waits []time.Duration
+	c.wait = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	rows, err := c.Collect(context.Background(), config.Options{Resource: config.ResourceCPU})
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if source.calls != 3 || len(waits) != 2 || waits[0] != 30*time.Second {
+		t.Errorf("expected 3 collections 30s apart, got %d collections and waits %v", source.calls, waits)
+	}
+	if len(rows) != 1 || rows[0].UsageMc != 300 || rows[0].Samples == nil || rows[0].Samples.Max != 500 {
+		t.Errorf("expected one row at the mean usage with its samples, got %+v", rows)
+	}
+
+	// An interrupted wait fails the collection
+	source.calls = 0
+	c.wait = func(context.Context, time.Duration) error { return context.Canceled }
+	if _, err := c.Collect(context.Background(), config.Options{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the interruption to be returned, got %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/k8s"
+	"github.com/mchmarny/kusage/pkg/observability"
+	"github.com/mchmarny/kusage/pkg/resilience"
+)
+
+// serveShutdownTimeout bounds how long in-flight scrapes may take to finish
+// once serve mode is interrupted
+const serveShutdownTimeout = 5 * time.Second
+
+// parseServe parses the serve command, which collects the pods (default) or
+// containers named by its first argument on a schedule and exposes them as
+// Prometheus metrics.
+func (p *Parser) parseServe(args []string) (*config.Options, error) {
+	mode := config.ModePods
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		m, err := p.parseMode(args[0])
+		if err != nil || (m != config.ModePods && m != config.ModeContainers) {
+			return nil, fmt.Errorf("unknown serve analysis %q (expected pods|containers)", args[0])
+		}
+		mode, args = m, args[1:]
+	}
+
+	fs := flag.NewFlagSet(p.programName+" serve", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		allNamespaces = fs.Bool("A", false, "If present, collect across all namespaces")
+		namespace     = fs.String("n", "default", "Namespace or glob of namespaces to use (ignored with -A)")
+		labelSelector = fs.String("l", "", "Label selector")
+		excludeNS     = fs.String("nx", "", "Regex of namespaces to exclude")
+		excludeLabels = fs.String("lx", "", "Regex of labels to exclude")
+		listen        = fs.String("listen", ":9090", "Address to serve /metrics on")
+		interval      = fs.Duration("interval", time.Minute, "Time between collections (e.g. 30s)")
+		pageSize      = fs.Int64("page-size", 500, "Number of items to fetch per API call")
+		timeout       = fs.Duration("timeout", 30*time.Second, "Time allowed for each collection, across all pages and retries (e.g. 5m)")
+		configFile    = fs.String("config", os.Getenv(config.ConfigEnv), "Configuration file with namespace budgets (default: kusage/config.yaml in the user config dir)")
+		kube          = p.defineKubeconfigFlags(fs)
+
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows carry both resources so memory and CPU are exposed together
+	opts := &config.Options{
+		Namespace:     *namespace,
+		AllNamespaces: *allNamespaces,
+		LabelSelector: *labelSelector,
+		Mode:          mode,
+		Resource:      config.ResourceAll,
+		Sort:          config.SortByPercentage,
+		Output:        config.OutputTable,
+		LogLevel:      level,
+		PageSize:      *pageSize,
+		Timeout:       *timeout,
+		Listen:        *listen,
+		Interval:      *interval,
+	}
+	kube.apply(opts)
+
+	if *excludeNS != "" {
+		excludeRegex, err := regexp.Compile(*excludeNS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nx regex: %w", err)
+		}
+		opts.ExcludeNamespaces = excludeRegex
+	}
+	if *excludeLabels != "" {
+		excludeRegex, err := regexp.Compile(*excludeLabels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --lx regex: %w", err)
+		}
+		opts.ExcludeLabels = excludeRegex
+	}
+
+	// Load namespace budgets; only an explicitly named file must exist
+	configPath, required := *configFile, *configFile != ""
+	if !required {
+		configPath = config.DefaultConfigPath()
+	}
+	file, err := config.LoadFile(configPath, required)
+	if err != nil {
+		return nil, err
+	}
+	// Namespace usage is only complete with the pods without limits
+	if len(file.Budgets) > 0 {
+		opts.Budgets = file.Budgets
+		opts.IncludeNoLimit = true
+	}
+
+	p.applyPluginDefaults(fs, opts)
+	p.parseNamespacePattern(opts)
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return opts, nil
+}
+
+// runServe collects the rows of opts every opts.Interval and exposes those of
+// the last successful collection, the usage of the namespaces with a budget
+// and the operational metrics of the runs on /metrics until interrupted.
+func runServe(opts config.Options) error {
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, nil)...)
+	if err != nil {
+		return err
+	}
+
+	exporter := observability.NewExporter()
+	usage := observability.NewUsageCollector(opts.Mode)
+	exporter.Registry().MustRegister(usage)
+	var budgets *observability.BudgetCollector
+	if len(opts.Budgets) > 0 {
+		budgets = observability.NewBudgetCollector(opts.Budgets)
+		exporter.Registry().MustRegister(budgets)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter.Handler())
+	server := &http.Server{Addr: opts.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ListenAndServe()
+	}()
+	slog.Info("serving metrics", "address", opts.Listen, "interval", opts.Interval)
+
+	// A collection scheduled while the previous one is still running is
+	// skipped, so collections slower than the interval do not pile up API load
+	guard := resilience.NewOverlapGuard(func() {
+		exporter.Skip()
+		slog.Warn("skipping collection, the previous one is still running", "interval", opts.Interval)
+	})
+	collect := func() {
+		guard.Go(func() {
+			serveCollection(ctx, clientManager, exporter, usage, budgets, opts)
+		})
+	}
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	collect()
+	for {
+		select {
+		case <-ticker.C:
+			collect()
+		case err := <-served:
+			return fmt.Errorf("failed to serve metrics on %s: %w", opts.Listen, err)
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+			defer cancel()
+			err := server.Shutdown(shutdownCtx)
+			guard.Wait()
+			return err
+		}
+	}
+}
+
+// serveCollection runs a single collection of serve mode, folding its
+// operational metrics into the exporter and, when it succeeds, replacing the
+// exposed rows and, with budgets, the namespace usage.
+func serveCollection(ctx context.Context, clientManager *k8s.ClientManager, exporter *observability.Exporter,
+	usage *observability.UsageCollector, budgets *observability.BudgetCollector, opts config.Options) {
+	metrics := observability.NewMetrics()
+	defer func() {
+		metrics.Finalize()
+		exporter.Observe(metrics.GetSummary())
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	dataCollector, err := newDataCollector(clientManager, opts, metrics)
+	if err != nil {
+		metrics.RecordError(err, "data collection")
+		slog.Error("collection failed", "error", err)
+		return
+	}
+
+	collectionStart := time.Now()
+	rows, err := dataCollector.Collect(ctx, opts)
+	if err != nil {
+		metrics.RecordError(err, "data collection")
+		slog.Error("collection failed", "error", err)
+		return
+	}
+	metrics.SetCollectionDuration(time.Since(collectionStart))
+	metrics.ResultsGenerated = int64(len(rows))
+	usage.Update(rows)
+	if budgets != nil {
+		budgets.Update(rows)
+	}
+}
@@ -0,0 +1,306 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/k8s"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/observability"
+	"github.com/mchmarny/kusage/pkg/output"
+)
+
+// unsafeSnapshotChars are replaced in the cluster part of snapshot IDs, which
+// name files
+var unsafeSnapshotChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// parseSnapshot parses the snapshot command: save collects the pods (default)
+// or containers named by its next argument and saves them, list prints the
+// saved snapshots.
+func (p *Parser) parseSnapshot(args []string) (*config.Options, error) {
+	if len(args) == 0 {
+		return nil, errors.New("missing snapshot command: save|list")
+	}
+	switch args[0] {
+	case "save":
+		return p.parseSnapshotSave(args[1:])
+	case "list":
+		return p.parseSnapshotList(args[1:])
+	default:
+		return nil, fmt.Errorf("unknown snapshot command %q (expected save|list)", args[0])
+	}
+}
+
+// parseSnapshotSave parses the flags of snapshot save.
+func (p *Parser) parseSnapshotSave(args []string) (*config.Options, error) {
+	mode := config.ModePods
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		m, err := p.parseMode(args[0])
+		if err != nil || (m != config.ModePods && m != config.ModeContainers) {
+			return nil, fmt.Errorf("unknown snapshot analysis %q (expected pods|containers)", args[0])
+		}
+		mode, args = m, args[1:]
+	}
+
+	fs := flag.NewFlagSet(p.programName+" snapshot save", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		allNamespaces = fs.Bool("A", false, "If present, collect across all namespaces")
+		namespace     = fs.String("n", "default", "Namespace or glob of namespaces to use (ignored with -A)")
+		labelSelector = fs.String("l", "", "Label selector")
+		excludeNS     = fs.String("nx", "", "Regex of namespaces to exclude")
+		excludeLabels = fs.String("lx", "", "Regex of labels to exclude")
+		noLimit       = fs.Bool("include-no-limit", false, "Include pods and containers without a limit")
+		dir           = fs.String("dir", defaultSnapshotDir(), "Directory snapshots are saved to")
+		pageSize      = fs.Int64("page-size", 500, "Number of items to fetch per API call")
+		enableMetrics = fs.Bool("metrics", false, "Enable detailed performance metrics collection")
+		timeout       = fs.Duration("timeout", 30*time.Second, "Time allowed for the whole run, across all pages and retries (e.g. 5m)")
+		kube          = p.defineKubeconfigFlags(fs)
+
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+	if *dir == "" {
+		return nil, errors.New("snapshot save requires --dir when the home directory is unknown")
+	}
+
+	// Snapshots carry both resources so either can be analyzed later
+	opts := &config.Options{
+		Namespace:      *namespace,
+		AllNamespaces:  *allNamespaces,
+		LabelSelector:  *labelSelector,
+		Mode:           mode,
+		Resource:       config.ResourceAll,
+		Sort:           config.SortByPercentage,
+		Output:         config.OutputTable,
+		LogLevel:       level,
+		IncludeNoLimit: *noLimit,
+		PageSize:       *pageSize,
+		EnableMetrics:  *enableMetrics,
+		Timeout:        *timeout,
+		SaveSnapshot:   true,
+		SnapshotDir:    *dir,
+	}
+	kube.apply(opts)
+
+	if *excludeNS != "" {
+		excludeRegex, err := regexp.Compile(*excludeNS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nx regex: %w", err)
+		}
+		opts.ExcludeNamespaces = excludeRegex
+	}
+	if *excludeLabels != "" {
+		excludeRegex, err := regexp.Compile(*excludeLabels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --lx regex: %w", err)
+		}
+		opts.ExcludeLabels = excludeRegex
+	}
+
+	p.applyPluginDefaults(fs, opts)
+	p.parseNamespacePattern(opts)
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return opts, nil
+}
+
+// parseSnapshotList parses the flags of snapshot list.
+func (p *Parser) parseSnapshotList(args []string) (*config.Options, error) {
+	fs := flag.NewFlagSet(p.programName+" snapshot list", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		dir       = fs.String("dir", defaultSnapshotDir(), "Directory snapshots are listed from")
+		noHeaders = fs.Bool("no-headers", false, "If true, suppress headers in the output")
+
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	// Listing only reads local files; the timeout is never used
+	opts := &config.Options{
+		Mode:        config.ModeSnapshots,
+		NoHeaders:   *noHeaders,
+		Output:      config.OutputTable,
+		LogLevel:    level,
+		Timeout:     30 * time.Second,
+		SnapshotDir: *dir,
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return opts, nil
+}
+
+// defaultSnapshotDir returns .kusage/snapshots in the home directory, or an
+// empty string when it cannot be determined.
+func defaultSnapshotDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kusage", "snapshots")
+}
+
+// runSnapshotSave collects the rows in scope and saves them as a snapshot of
+// the current context.
+func runSnapshotSave(opts config.Options, observer *observability.Metrics) error {
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, observer)...)
+	if err != nil {
+		if observer != nil {
+			observer.RecordError(err, "kubernetes client initialization")
+		}
+		return err
+	}
+	dataCollector, err := newDataCollector(clientManager, opts, observer)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	collectionStart := time.Now()
+	rows, err := dataCollector.Collect(ctx, opts)
+	if err != nil {
+		if observer != nil {
+			observer.RecordError(err, "data collection")
+		}
+		return err
+	}
+	if observer != nil {
+		observer.SetCollectionDuration(time.Since(collectionStart))
+		observer.ResultsGenerated = int64(len(rows))
+	}
+
+	cluster := opts.Context
+	if cluster == "" {
+		cluster = k8s.CurrentContext(opts.Kubeconfig)
+	}
+	if cluster == "" {
+		cluster = clientManager.Config().Host
+	}
+
+	snapshot := metrics.Snapshot{TakenAt: collectionStart.UTC(), Cluster: cluster, Mode: opts.Mode, Rows: rows}
+	snapshot.ID = snapshotID(snapshot.TakenAt, cluster)
+	path, err := writeSnapshot(opts.SnapshotDir, snapshot)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("snapshot %s saved with %d rows to %s\n", snapshot.ID, len(rows), path)
+	return nil
+}
+
+// runSnapshotList prints the snapshots saved in the snapshot directory.
+func runSnapshotList(opts config.Options) error {
+	snapshots, err := readSnapshots(opts.SnapshotDir)
+	if err != nil {
+		return err
+	}
+
+	outputFormatter := output.New()
+	defer outputFormatter.Close()
+	return outputFormatter.PrintSnapshots(snapshots, opts)
+}
+
+// snapshotID names a snapshot by the time it was taken and its cluster, so
+// IDs sort by time and are safe to use as file names.
+func snapshotID(takenAt time.Time, cluster string) string {
+	name := strings.Trim(unsafeSnapshotChars.ReplaceAllString(cluster, "-"), "-")
+	if name == "" {
+		name = "cluster"
+	}
+	return takenAt.UTC().Format("20060102T150405Z") + "-" + name
+}
+
+// writeSnapshot saves snapshot to <ID>.json in dir and returns its path.
+func writeSnapshot(dir string, snapshot metrics.Snapshot) (string, error) {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	path := filepath.Join(dir, snapshot.ID+".json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return path, nil
+}
+
+// readSnapshots returns the snapshots saved in dir, oldest first. A missing
+// directory has no snapshots, and unreadable files are skipped with a warning.
+func readSnapshots(dir string) ([]metrics.Snapshot, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	snapshots := make([]metrics.Snapshot, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			slog.Warn("skipping unreadable snapshot", "path", path, "error", err)
+			continue
+		}
+		var snapshot metrics.Snapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			slog.Warn("skipping unreadable snapshot", "path", path, "error", err)
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].TakenAt.Before(snapshots[j].TakenAt)
+	})
+	return snapshots, nil
+}
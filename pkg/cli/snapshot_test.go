@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+func TestSnapshotID(t *testing.T) {
+	taken := time.Date(2025, 6, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	if id := snapshotID(taken, "arn:aws:eks:us-east-1:123:cluster/prod"); id != "20250601T103000Z-arn-aws-eks-us-east-1-123-cluster-prod" {
+		t.Errorf("unexpected id %q", id)
+	}
+	if id := snapshotID(taken, "https://"); id != "20250601T103000Z-https" {
+		t.Errorf("unexpected id %q", id)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "snapshots")
+
+	if snapshots, err := readSnapshots(dir); err != nil || len(snapshots) != 0 {
+		t.Fatalf("expected no snapshots in a missing directory, got %v, %v", snapshots, err)
+	}
+
+	taken := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, snapshot := range []metrics.Snapshot{
+		{TakenAt: taken.Add(time.Hour), Cluster: "prod", Mode: config.ModePods},
+		{TakenAt: taken, Cluster: "prod", Mode: config.ModePods, Rows: []metrics.Row{{Namespace: "payments", Name: "api-0", UsageMi: 100}}},
+	} {
+		snapshot.ID = snapshotID(snapshot.TakenAt, snapshot.Cluster)
+		if _, err := writeSnapshot(dir, snapshot); err != nil {
+			t.Fatalf("writeSnapshot failed: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	snapshots, err := readSnapshots(dir)
+	if err != nil {
+		t.Fatalf("readSnapshots failed: %v", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("expected 2 snapshots without the unreadable one, got %d", len(snapshots))
+	}
+	if !snapshots[0].TakenAt.Equal(taken) || snapshots[0].ID != "20250601T120000Z-prod" {
+		t.Errorf("expected the oldest snapshot first, got %+v", snapshots[0])
+	}
+	if len(snapshots[0].Rows) != 1 || snapshots[0].Rows[0].UsageMi != 100 {
+		t.Errorf("expected the saved rows, got %+v", snapshots[0].Rows)
+	}
+}
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/output"
+)
+
+// VersionInfo describes the build and capabilities of the binary, printed by
+// version -o json for wrapper tooling that enforces a minimum version.
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+	// OutputFormats lists the built-in -o formats; any other name selects an output plugin
+	OutputFormats []string `json:"outputFormats"`
+	// PluginAPI is the protocol version passed to output plugins
+	PluginAPI string `json:"pluginAPI"`
+	// UsageSources lists the --source values usage can be read from
+	UsageSources []string `json:"usageSources"`
+}
+
+// versionInfo returns the build and capability details of this binary.
+func (p *Parser) versionInfo() VersionInfo {
+	return VersionInfo{
+		Version:       p.programVersion,
+		Commit:        p.commitSha,
+		Date:          p.builtTime,
+		GoVersion:     runtime.Version(),
+		Platform:      runtime.GOOS + "/" + runtime.GOARCH,
+		OutputFormats: []string{string(config.OutputTable), string(config.OutputWide), string(config.OutputJSON)},
+		PluginAPI:     output.PluginAPIVersion,
+		UsageSources: []string{
+			string(config.UsageSourceMetricsServer),
+			string(config.UsageSourcePrometheus),
+			string(config.UsageSourceDatadog),
+			string(config.UsageSourceCAdvisor),
+		},
+	}
+}
+
+// printVersion prints the version line, or the full VersionInfo with -o json.
+func (p *Parser) printVersion(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet(p.programName+" version", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	format := fs.String("o", "", "Output format: json (default: a single line)")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil
+		}
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	switch *format {
+	case "":
+		_, err := fmt.Fprintf(w, "%s version %s (commit: %s, date: %s)\n", p.programName, p.programVersion, p.commitSha, p.builtTime)
+		return err
+	case "json":
+		data, err := json.MarshalIndent(p.versionInfo(), "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode version: %w", err)
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	default:
+		return fmt.Errorf("unknown version output format %q (expected json)", *format)
+	}
+}
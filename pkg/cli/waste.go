@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/analyzer"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/k8s"
+	"github.com/mchmarny/kusage/pkg/observability"
+	"github.com/mchmarny/kusage/pkg/output"
+)
+
+// parseWaste parses the flags of the waste subcommand.
+func (p *Parser) parseWaste(args []string) (*config.Options, error) {
+	fs := flag.NewFlagSet(p.programName+" waste", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		allNamespaces = fs.Bool("A", false, "If present, report across all namespaces")
+		namespace     = fs.String("n", "default", "Namespace or glob of namespaces to use (ignored with -A)")
+		labelSelector = fs.String("l", "", "Label selector")
+		excludeNS     = fs.String("nx", "", "Regex of namespaces to exclude")
+		excludeLabels = fs.String("lx", "", "Regex of labels to exclude")
+		basis         = fs.String("basis", string(config.WasteBasisRequests), "Reservation unused resources are measured against: requests|limits")
+		resource      = fs.String("resource", "memory", "Resource pods and namespaces are ranked by: memory|cpu")
+		topN          = fs.Int("top", 20, "Show the top N pods")
+		noHeaders     = fs.Bool("no-headers", false, "If true, suppress headers in the output")
+		pageSize      = fs.Int64("page-size", 500, "Number of items to fetch per API call")
+		enableMetrics = fs.Bool("metrics", false, "Enable detailed performance metrics collection")
+		timeout       = fs.Duration("timeout", 30*time.Second, "Time allowed for the whole run, across all pages and retries (e.g. 5m)")
+		kube          = p.defineKubeconfigFlags(fs)
+
+		logLevel string
+	)
+	fs.StringVar(&logLevel, "v", "warn", "Log level: debug|info|warn|error (shorthand)")
+	fs.StringVar(&logLevel, "log-level", "warn", "Log level: debug|info|warn|error")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			p.PrintUsage()
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	level, err := p.parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	// Waste covers every container, limited or not
+	opts := &config.Options{
+		Namespace:      *namespace,
+		AllNamespaces:  *allNamespaces,
+		LabelSelector:  *labelSelector,
+		Mode:           config.ModeWaste,
+		Resource:       config.ResourceKind(strings.ToLower(*resource)),
+		WasteBasis:     config.WasteBasis(strings.ToLower(*basis)),
+		TopN:           *topN,
+		Output:         config.OutputTable,
+		NoHeaders:      *noHeaders,
+		LogLevel:       level,
+		IncludeNoLimit: true,
+		PageSize:       *pageSize,
+		EnableMetrics:  *enableMetrics,
+		Timeout:        *timeout,
+	}
+	kube.apply(opts)
+
+	if *excludeNS != "" {
+		excludeRegex, err := regexp.Compile(*excludeNS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nx regex: %w", err)
+		}
+		opts.ExcludeNamespaces = excludeRegex
+	}
+	if *excludeLabels != "" {
+		excludeRegex, err := regexp.Compile(*excludeLabels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --lx regex: %w", err)
+		}
+		opts.ExcludeLabels = excludeRegex
+	}
+
+	p.applyPluginDefaults(fs, opts)
+	p.parseNamespacePattern(opts)
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return opts, nil
+}
+
+// runWaste reports the pods and namespaces leaving the most of their
+// reserved resources unused.
+func runWaste(opts config.Options, observer *observability.Metrics) error {
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, observer)...)
+	if err != nil {
+		if observer != nil {
+			observer.RecordError(err, "kubernetes client initialization")
+		}
+		return err
+	}
+	dataCollector, err := newDataCollector(clientManager, opts, observer)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	// The containers are collected as a containers run of both resources would
+	collect := opts
+	collect.Mode = config.ModeContainers
+	collect.Resource = config.ResourceAll
+
+	collectionStart := time.Now()
+	rows, err := dataCollector.Collect(ctx, collect)
+	if err != nil {
+		if observer != nil {
+			observer.RecordError(err, "data collection")
+		}
+		return err
+	}
+	if observer != nil {
+		observer.SetCollectionDuration(time.Since(collectionStart))
+		observer.ResultsGenerated = int64(len(rows))
+	}
+
+	report := analyzer.New().Waste(rows, opts)
+	if len(report.Pods) == 0 {
+		slog.Info("no pods found to report unused resources of")
+	}
+
+	outputFormatter := output.New()
+	defer outputFormatter.Close()
+	return outputFormatter.PrintWaste(report, opts)
+}
@@ -0,0 +1,290 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/analyzer"
+	"github.com/mchmarny/kusage/pkg/collector"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/k8s"
+	"github.com/mchmarny/kusage/pkg/kubelet"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/observability"
+	"github.com/mchmarny/kusage/pkg/output"
+)
+
+// clearScreen moves the cursor home and clears the terminal
+const clearScreen = "\x1b[H\x1b[2J"
+
+// runWatch refreshes the table of opts every opts.Watch until interrupted.
+// Every refresh marks the rows that entered or whose percentage moved by
+// opts.WatchDelta since the previous one and lists the rows that are gone. A
+// failed refresh is reported and the next one is attempted. On a terminal,
+// entering the # of a row shows the detail of its pod until Enter is pressed.
+func runWatch(opts config.Options, observer *observability.Metrics) error {
+	clientManager, err := k8s.NewClientManager(clientOptions(opts, observer)...)
+	if err != nil {
+		if observer != nil {
+			observer.RecordError(err, "kubernetes client initialization")
+		}
+		return err
+	}
+	dataCollector, err := newDataCollector(clientManager, opts, observer)
+	if err != nil {
+		if observer != nil {
+			observer.RecordError(err, "kubernetes client initialization")
+		}
+		return err
+	}
+	dataAnalyzer := analyzer.New()
+	var rowSource rowCollector = dataCollector
+	if opts.LowMemory {
+		rowSource = newTopNCollector(clientManager.CoreClient(), clientManager.MetricsClient(), dataAnalyzer, opts, observer)
+	}
+	if opts.Samples > 1 {
+		rowSource = newSampledCollector(rowSource, dataAnalyzer, opts.Samples, opts.Interval)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The screen is cleared between refreshes on a terminal only, so redirected
+	// output keeps every refresh. With an interactive stdin as well, rows are
+	// numbered and entering a number drills down into the pod of the row
+	terminal := isTerminal(os.Stdout)
+	var input <-chan string
+	if terminal && isTerminal(os.Stdin) {
+		input = readLines(os.Stdin)
+	}
+
+	ticker := time.NewTicker(opts.Watch)
+	defer ticker.Stop()
+
+	var (
+		previous *metrics.Refresh
+		// selected is the row drilled into, nil while the table is shown
+		selected *metrics.Row
+	)
+	for {
+		if selected != nil {
+			traces, err := rowDetail(ctx, dataCollector, dataAnalyzer, *selected, opts)
+			switch {
+			case ctx.Err() != nil:
+				return nil
+			case err != nil:
+				fmt.Fprintf(os.Stderr, "detail refresh failed, retrying in %s: %v\n", opts.Watch, err)
+			default:
+				if err := printDetail(os.Stdout, clearScreen, *selected, traces, opts, time.Now()); err != nil {
+					return err
+				}
+			}
+		} else {
+			rows, err := watchRows(ctx, clientManager, rowSource, dataAnalyzer, opts)
+			switch {
+			case ctx.Err() != nil:
+				return nil
+			case err != nil:
+				if observer != nil {
+					observer.RecordError(err, "watch refresh")
+				}
+				fmt.Fprintf(os.Stderr, "refresh failed, retrying in %s: %v\n", opts.Watch, err)
+			default:
+				// Refreshes are separated by a blank line when the screen is not cleared
+				prefix := ""
+				switch {
+				case terminal:
+					prefix = clearScreen
+				case previous != nil:
+					prefix = "\n"
+				}
+				refresh := dataAnalyzer.Diff(previous, rows, opts.WatchDelta)
+				if err := printRefresh(os.Stdout, prefix, refresh, opts, time.Now(), input != nil); err != nil {
+					return err
+				}
+				previous = &refresh
+			}
+		}
+
+		// Wait for the next refresh, or a selection that redraws the screen now
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				break wait
+			case line, ok := <-input:
+				if !ok {
+					input = nil
+					continue
+				}
+				if strings.EqualFold(line, "q") {
+					return nil
+				}
+				if selected != nil {
+					// Any other input returns from the detail to the table of the last refresh
+					selected = nil
+					if previous != nil {
+						if err := printRefresh(os.Stdout, clearScreen, *previous, opts, time.Now(), true); err != nil {
+							return err
+						}
+					}
+					continue
+				}
+				row, err := selectRow(previous, line, opts)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					continue
+				}
+				selected = &row
+				break wait
+			}
+		}
+	}
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// readLines sends the trimmed lines read from r until it is closed.
+func readLines(r io.Reader) <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- strings.TrimSpace(scanner.Text())
+		}
+	}()
+	return lines
+}
+
+// selectRow returns the listed row of refresh numbered line, as
+// PrintSelectableRefresh numbers them. Only pod and container rows have a
+// pod to drill down into.
+func selectRow(refresh *metrics.Refresh, line string, opts config.Options) (metrics.Row, error) {
+	if refresh == nil {
+		return metrics.Row{}, errors.New("no rows to select yet")
+	}
+	number, err := strconv.Atoi(line)
+	if err != nil || number < 1 || number > len(refresh.Rows) {
+		return metrics.Row{}, fmt.Errorf("invalid row %q (expected a # between 1 and %d, or q to quit)", line, len(refresh.Rows))
+	}
+	row := refresh.Rows[number-1]
+	if _, ok := rowPod(row, opts); !ok {
+		return metrics.Row{}, fmt.Errorf("row %d is a group of pods and has no detail", number)
+	}
+	return row, nil
+}
+
+// rowPod returns the name of the pod of row, or false for rows grouped by
+// node, container name or CronJob, which span several pods.
+func rowPod(row metrics.Row, opts config.Options) (string, bool) {
+	if opts.GroupBy != "" || opts.CronJobAggregation != "" {
+		return "", false
+	}
+	if row.Mode == config.ModeContainers {
+		pod, _, _ := strings.Cut(row.Name, ":")
+		return pod, true
+	}
+	return row.Name, true
+}
+
+// rowDetail traces the pod of row as --why does, for the drill-down: its
+// node, QoS class and restarts, and the usage, limit, request and restarts
+// of every container.
+func rowDetail(ctx context.Context, c *collector.Collector, a *analyzer.Analyzer, row metrics.Row, opts config.Options) ([]metrics.Trace, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	pod, _ := rowPod(row, opts)
+	opts.Namespace, opts.AllNamespaces, opts.NamespacePattern, opts.Namespaces = row.Namespace, false, "", nil
+	opts.WhyPod = pod
+	return traceWhy(ctx, c, a, opts)
+}
+
+// watchRows collects and ranks the rows of a single refresh, as a pods or
+// containers run does before printing its table.
+func watchRows(ctx context.Context, clientManager *k8s.ClientManager, rowSource rowCollector, a *analyzer.Analyzer, opts config.Options) ([]metrics.Row, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	rows, err := rowSource.Collect(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.CronJobAggregation != "" {
+		rows = a.GroupCronJobs(rows, opts)
+	}
+	switch opts.GroupBy {
+	case config.GroupByNode:
+		rows = a.SumByNode(rows, opts)
+	case config.GroupByContainerName:
+		rows = a.GroupContainerNames(rows)
+	}
+	if err := a.Score(rows, opts); err != nil {
+		return nil, err
+	}
+	a.Classify(rows, opts)
+	rows, err = a.Select(rows, opts)
+	if err != nil {
+		return nil, err
+	}
+	a.Sort(rows, opts)
+	rows = a.Filter(rows, opts)
+
+	if opts.ShowNetwork {
+		if err := attachNetwork(ctx, kubelet.New(clientManager.CoreClient()), rows); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// printRefresh writes prefix and a refresh to w, under a line with the
+// interval and the time of the refresh. Selectable refreshes number their
+// rows and end with a prompt for the row to drill down into.
+func printRefresh(w io.Writer, prefix string, refresh metrics.Refresh, opts config.Options, now time.Time, selectable bool) error {
+	if _, err := fmt.Fprintf(w, "%sEvery %s, refreshed at %s\n\n", prefix, opts.Watch, now.Format(time.TimeOnly)); err != nil {
+		return fmt.Errorf("failed to print refresh: %w", err)
+	}
+	if !selectable {
+		return output.NewWithWriter(w).PrintRefresh(refresh, opts)
+	}
+	if err := output.NewWithWriter(w).PrintSelectableRefresh(refresh, opts); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprint(w, "\nEnter a row # for the detail of its pod, or q to quit: "); err != nil {
+		return fmt.Errorf("failed to print refresh: %w", err)
+	}
+	return nil
+}
+
+// printDetail writes prefix and the drill-down of row to w, under a line with
+// the row and the time of the refresh, followed by a prompt to return.
+func printDetail(w io.Writer, prefix string, row metrics.Row, traces []metrics.Trace, opts config.Options, now time.Time) error {
+	if _, err := fmt.Fprintf(w, "%s%s/%s every %s, refreshed at %s\n\n", prefix, row.Namespace, row.Name, opts.Watch, now.Format(time.TimeOnly)); err != nil {
+		return fmt.Errorf("failed to print detail: %w", err)
+	}
+	if err := output.NewWithWriter(w).PrintTraces(traces, opts); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprint(w, "\nPress Enter to return to the table, or q to quit: "); err != nil {
+		return fmt.Errorf("failed to print detail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/analyzer"
+	"github.com/mchmarny/kusage/pkg/collector"
+	"github.com/mchmarny/kusage/pkg/collector/fake"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+func TestPrintRefresh(t *testing.T) {
+	opts := config.Options{Mode: config.ModePods, Resource: config.ResourceMemory, Watch: 30 * time.Second, NoHeaders: true}
+	refresh := metrics.Refresh{
+		Rows:    []metrics.Row{{Namespace: "web", Name: "api-0", Resource: config.ResourceMemory, UsageMi: 90, LimitMi: 100, Percentage: 90}},
+		Changes: []metrics.RowChange{{Entered: true}},
+	}
+	now := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	if err := printRefresh(&out, clearScreen, refresh, opts, now, false); err != nil {
+		t.Fatalf("printRefresh failed: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), clearScreen+"Every 30s, refreshed at 12:30:00\n\n") {
+		t.Errorf("expected the screen cleared before the refresh line, got %q", out.String())
+	}
+	if !strings.Contains(out.String(), "api-0") || !strings.Contains(out.String(), "NEW") {
+		t.Errorf("expected the new row to be marked, got %q", out.String())
+	}
+}
+
+func TestPrintRefresh_Selectable(t *testing.T) {
+	opts := config.Options{Mode: config.ModePods, Resource: config.ResourceMemory, Watch: 30 * time.Second}
+	refresh := metrics.Refresh{
+		Rows:    []metrics.Row{{Namespace: "web", Name: "api-0", Resource: config.ResourceMemory, UsageMi: 90, LimitMi: 100, Percentage: 90}},
+		Changes: []metrics.RowChange{{}},
+	}
+
+	var out bytes.Buffer
+	if err := printRefresh(&out, "", refresh, opts, time.Now(), true); err != nil {
+		t.Fatalf("printRefresh failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "#  NAMESPACE") || !strings.Contains(out.String(), "1  web") {
+		t.Errorf("expected numbered rows, got %q", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "or q to quit: ") {
+		t.Errorf("expected a selection prompt, got %q", out.String())
+	}
+}
+
+func TestSelectRow(t *testing.T) {
+	refresh := &metrics.Refresh{Rows: []metrics.Row{
+		{Namespace: "web", Name: "api-0", Mode: config.ModePods},
+		{Namespace: "web", Name: "api-1:proxy", Mode: config.ModeContainers},
+	}}
+	opts := config.Options{Mode: config.ModePods}
+
+	row, err := selectRow(refresh, "2", opts)
+	if err != nil {
+		t.Fatalf("selectRow failed: %v", err)
+	}
+	if pod, ok := rowPod(row, opts); !ok || pod != "api-1" {
+		t.Errorf("expected the pod of the container row, got %q (%t)", pod, ok)
+	}
+
+	for _, line := range []string{"0", "3", "api-0", ""} {
+		if _, err := selectRow(refresh, line, opts); err == nil {
+			t.Errorf("expected %q to be rejected", line)
+		}
+	}
+	if _, err := selectRow(nil, "1", opts); err == nil {
+		t.Error("expected no selection before the first refresh")
+	}
+	if _, err := selectRow(refresh, "1", config.Options{GroupBy: config.GroupByNode}); err == nil {
+		t.Error("expected grouped rows to have no detail")
+	}
+}
+
+func TestPrintDetail(t *testing.T) {
+	opts := config.Options{Mode: config.ModePods, Resource: config.ResourceMemory, Watch: 30 * time.Second}
+	row := metrics.Row{Namespace: "web", Name: "api-0"}
+	traces := []metrics.Trace{{
+		Namespace: "web", Name: "api-0", Node: "node-a", QoS: "Burstable", Restarts: 2,
+		Steps: []metrics.TraceStep{{Stage: "listed", Passed: true, Detail: "pod found (phase Running)"}},
+	}}
+
+	var out bytes.Buffer
+	if err := printDetail(&out, clearScreen, row, traces, opts, time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("printDetail failed: %v", err)
+	}
+	for _, want := range []string{clearScreen + "web/api-0 every 30s, refreshed at 12:30:00", "NODE: node-a  QOS: Burstable  RESTARTS: 2", "kubectl describe pod api-0 -n web", "Press Enter to return"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in the detail, got %q", want, out.String())
+		}
+	}
+}
+
+func TestRowDetail(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+	coreClient, metricsClient, err := fake.NewClients(fixture)
+	if err != nil {
+		t.Fatalf("failed to create clients: %v", err)
+	}
+
+	opts := config.Options{AllNamespaces: true, Mode: config.ModeContainers, Resource: config.ResourceMemory}
+	opts.ApplyDefaults()
+	row := metrics.Row{Namespace: "payments", Name: "payments-api-7c9d8f6b5-x2kqp:api", Mode: config.ModeContainers}
+
+	traces, err := rowDetail(context.Background(), collector.New(coreClient, metricsClient), analyzer.New(), row, opts)
+	if err != nil {
+		t.Fatalf("rowDetail failed: %v", err)
+	}
+	if len(traces) != 1 || traces[0].Namespace != "payments" || traces[0].Name != "payments-api-7c9d8f6b5-x2kqp" {
+		t.Fatalf("expected the trace of the pod of the row, got %+v", traces)
+	}
+	if traces[0].Node == "" || traces[0].QoS == "" {
+		t.Errorf("expected the node and QoS class of the pod, got %+v", traces[0])
+	}
+}
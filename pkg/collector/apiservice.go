@@ -0,0 +1,199 @@
+// Package collector - metrics API aggregation health
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+const (
+	// metricsAPIService is the APIService registering metrics-server with
+	// the aggregation layer of the API server
+	metricsAPIService = "v1beta1.metrics.k8s.io"
+	// apiServicePath is the path of the APIService objects
+	apiServicePath = "/apis/apiregistration.k8s.io/v1/apiservices"
+	// metricsAPIHint is the advice given when pod metrics cannot be listed
+	// and no failing component of the metrics API was found
+	metricsAPIHint = "ensure metrics-server is running, or use --source prometheus"
+)
+
+// apiService holds the fields of an apiregistration.k8s.io/v1 APIService the
+// diagnosis reads, so the aggregator client is not needed.
+type apiService struct {
+	Spec struct {
+		// Service is the service the API is proxied to; nil for local APIs
+		Service *struct {
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+		} `json:"service"`
+	} `json:"spec"`
+	Status struct {
+		Conditions []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// CheckMetricsAPI checks the components pod metrics are served through, for
+// the doctor command: the metrics APIService is registered and Available, its
+// backing service exists and has ready endpoints, and pod metrics can be
+// listed in the namespace of opts. Components behind one that is missing or
+// cannot be read are not checked.
+func (c *Collector) CheckMetricsAPI(ctx context.Context, opts config.Options) []metrics.Check {
+	checks := c.metricsAPIChecks(ctx)
+
+	namespace, component := opts.Namespace, "PodMetrics in namespace "+opts.Namespace
+	if opts.AllNamespaces {
+		namespace, component = "", "PodMetrics across all namespaces"
+	}
+	start := time.Now()
+	_, err := c.metricsClient.MetricsV1beta1().PodMetricses(namespace).List(ctx, metav1.ListOptions{Limit: 1})
+	c.recordAPICall(start, err, "list pod metrics")
+	if err != nil {
+		return append(checks, metrics.Check{Component: component, Status: metrics.CheckFailed, Detail: fmt.Sprintf("cannot be listed: %v", err)})
+	}
+	return append(checks, metrics.Check{Component: component, Status: metrics.CheckOK, Detail: "listed"})
+}
+
+// diagnoseMetricsAPI names the failing component of the metrics API when pod
+// metrics cannot be listed: the APIService is missing or not Available, or
+// its backing service is missing or has no ready endpoints. It returns an
+// empty string when the components look healthy or cannot be read, e.g.
+// without permission to get APIServices.
+func (c *Collector) diagnoseMetricsAPI(ctx context.Context) string {
+	return diagnosis(c.metricsAPIChecks(ctx))
+}
+
+// diagnosis returns the detail of the last failed check. The backing service
+// and its endpoints come last, so they name the component to fix even when
+// the APIService is already reported unavailable.
+func diagnosis(checks []metrics.Check) string {
+	var detail string
+	for _, check := range checks {
+		if check.Status == metrics.CheckFailed {
+			detail = check.Detail
+		}
+	}
+	return detail
+}
+
+// metricsAPIChecks checks the metrics APIService and, when it is registered,
+// the service it is proxied to.
+func (c *Collector) metricsAPIChecks(ctx context.Context) []metrics.Check {
+	component := "APIService " + metricsAPIService
+	restClient := c.coreClient.Discovery().RESTClient()
+	if restClient == nil {
+		return []metrics.Check{{Component: component, Status: metrics.CheckUnknown, Detail: "cannot be read, the client does not serve APIServices"}}
+	}
+	if err := ctx.Err(); err != nil {
+		return []metrics.Check{{Component: component, Status: metrics.CheckUnknown, Detail: fmt.Sprintf("cannot be read: %v", err)}}
+	}
+
+	start := time.Now()
+	raw, err := restClient.Get().AbsPath(apiServicePath, metricsAPIService).DoRaw(ctx)
+	c.recordAPICall(start, err, "get metrics api service")
+	if apierrors.IsNotFound(err) {
+		return []metrics.Check{{Component: component, Status: metrics.CheckFailed,
+			Detail: fmt.Sprintf("APIService %s is not registered, install metrics-server", metricsAPIService)}}
+	}
+	if err != nil {
+		slog.Debug("failed to read the metrics APIService", "error", err)
+		return []metrics.Check{{Component: component, Status: metrics.CheckUnknown, Detail: fmt.Sprintf("cannot be read: %v", err)}}
+	}
+
+	var service apiService
+	if err := json.Unmarshal(raw, &service); err != nil {
+		slog.Debug("failed to decode the metrics APIService", "error", err)
+		return []metrics.Check{{Component: component, Status: metrics.CheckUnknown, Detail: fmt.Sprintf("cannot be decoded: %v", err)}}
+	}
+	return c.checkAPIService(ctx, &service)
+}
+
+// checkAPIService checks the Available condition of the metrics APIService,
+// then the existence and ready endpoints of its backing service.
+func (c *Collector) checkAPIService(ctx context.Context, service *apiService) []metrics.Check {
+	check := metrics.Check{Component: "APIService " + metricsAPIService, Status: metrics.CheckOK, Detail: "registered"}
+	for _, condition := range service.Status.Conditions {
+		if condition.Type != "Available" {
+			continue
+		}
+		if condition.Status == string(metav1.ConditionTrue) {
+			check.Detail = "registered and Available"
+			continue
+		}
+		check.Status = metrics.CheckFailed
+		check.Detail = fmt.Sprintf("APIService %s is not available (%s: %s)", metricsAPIService, condition.Reason, condition.Message)
+	}
+	checks := []metrics.Check{check}
+	if service.Spec.Service == nil {
+		return checks
+	}
+
+	// The backing service and its endpoints are checked even when the
+	// APIService is unavailable, as they name the component to fix
+	namespace, name := service.Spec.Service.Namespace, service.Spec.Service.Name
+	component := fmt.Sprintf("Service %s/%s", namespace, name)
+	start := time.Now()
+	_, err := c.coreClient.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	c.recordAPICall(start, err, "get metrics api backing service")
+	if apierrors.IsNotFound(err) {
+		return append(checks, metrics.Check{Component: component, Status: metrics.CheckFailed,
+			Detail: fmt.Sprintf("service %s/%s backing APIService %s does not exist", namespace, name, metricsAPIService)})
+	}
+	if err != nil {
+		return append(checks, metrics.Check{Component: component, Status: metrics.CheckUnknown, Detail: fmt.Sprintf("cannot be read: %v", err)})
+	}
+	checks = append(checks, metrics.Check{Component: component, Status: metrics.CheckOK, Detail: "exists"})
+
+	component = fmt.Sprintf("EndpointSlices of %s/%s", namespace, name)
+	start = time.Now()
+	slices, err := c.coreClient.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + name,
+	})
+	c.recordAPICall(start, err, "list metrics api endpoint slices")
+	if err != nil {
+		return append(checks, metrics.Check{Component: component, Status: metrics.CheckUnknown, Detail: fmt.Sprintf("cannot be listed: %v", err)})
+	}
+	ready := readyEndpoints(slices.Items)
+	if ready == 0 {
+		return append(checks, metrics.Check{Component: component, Status: metrics.CheckFailed,
+			Detail: fmt.Sprintf("service %s/%s backing APIService %s has no ready endpoints, check the metrics-server pods", namespace, name, metricsAPIService)})
+	}
+	return append(checks, metrics.Check{Component: component, Status: metrics.CheckOK, Detail: fmt.Sprintf("%d ready endpoints", ready)})
+}
+
+// readyEndpoints counts the ready endpoints across slices. Endpoints without
+// a ready condition are ready, as in the EndpointSlice API.
+func readyEndpoints(slices []discoveryv1.EndpointSlice) int {
+	var ready int
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				ready++
+			}
+		}
+	}
+	return ready
+}
+
+// describeMetricsFailure returns the diagnosis of the metrics API, or the
+// generic hint when no component was found failing.
+func (c *Collector) describeMetricsFailure(ctx context.Context) string {
+	if diagnosis := c.diagnoseMetricsAPI(ctx); diagnosis != "" {
+		return diagnosis
+	}
+	return metricsAPIHint
+}
@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+func TestCheckAPIService(t *testing.T) {
+	const registered = `{"spec":{"service":{"namespace":"kube-system","name":"metrics-server"}},
+		"status":{"conditions":[{"type":"Available","status":"%s","reason":"MissingEndpoints","message":"endpoints for service/metrics-server in \"kube-system\" have no addresses"}]}}`
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "metrics-server"}}
+	slice := func(ready bool) *discoveryv1.EndpointSlice {
+		return &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "kube-system",
+				Name:      "metrics-server-abc12",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "metrics-server"},
+			},
+			Endpoints: []discoveryv1.Endpoint{{Addresses: []string{"10.0.0.7"}, Conditions: discoveryv1.EndpointConditions{Ready: &ready}}},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		available string
+		objects   []runtime.Object
+		expected  string
+	}{
+		{name: "healthy", available: "True", objects: []runtime.Object{service, slice(true)}},
+		{name: "service missing", available: "False", expected: "service kube-system/metrics-server backing APIService v1beta1.metrics.k8s.io does not exist"},
+		{name: "no ready endpoints", available: "False", objects: []runtime.Object{service, slice(false)}, expected: "has no ready endpoints"},
+		{name: "unavailable", available: "False", objects: []runtime.Object{service, slice(true)}, expected: "is not available (MissingEndpoints: endpoints"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var api apiService
+			if err := json.Unmarshal([]byte(strings.Replace(registered, "%s", tt.available, 1)), &api); err != nil {
+				t.Fatalf("failed to decode APIService: %v", err)
+			}
+			c := New(k8sfake.NewClientset(tt.objects...), nil)
+
+			got := diagnosis(c.checkAPIService(context.Background(), &api))
+			if tt.expected == "" && got != "" {
+				t.Errorf("expected no diagnosis, got %q", got)
+			}
+			if !strings.Contains(got, tt.expected) {
+				t.Errorf("expected a diagnosis containing %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDescribeMetricsFailure_Undiagnosed(t *testing.T) {
+	// The fake clientset has no REST client to read APIServices with
+	c := New(k8sfake.NewClientset(), nil)
+	if hint := c.describeMetricsFailure(context.Background()); hint != metricsAPIHint {
+		t.Errorf("expected the generic hint, got %q", hint)
+	}
+}
+
+func TestCheckMetricsAPI(t *testing.T) {
+	metricsClient := metricsfake.NewSimpleClientset()
+	c := New(k8sfake.NewClientset(), metricsClient)
+
+	checks := c.CheckMetricsAPI(context.Background(), config.Options{Namespace: "payments"})
+	if len(checks) != 2 {
+		t.Fatalf("expected the APIService and pod metrics checks, got %+v", checks)
+	}
+	if checks[0].Status != metrics.CheckUnknown {
+		t.Errorf("expected an unreadable APIService to be unknown, got %+v", checks[0])
+	}
+	if checks[1].Component != "PodMetrics in namespace payments" || checks[1].Status != metrics.CheckOK {
+		t.Errorf("expected pod metrics to be listed in payments, got %+v", checks[1])
+	}
+
+	metricsClient.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("the server is currently unable to handle the request")
+	})
+	checks = c.CheckMetricsAPI(context.Background(), config.Options{AllNamespaces: true})
+	last := checks[len(checks)-1]
+	if last.Component != "PodMetrics across all namespaces" || last.Status != metrics.CheckFailed {
+		t.Errorf("expected pod metrics to fail across all namespaces, got %+v", last)
+	}
+	if !strings.Contains(last.Detail, "unable to handle the request") {
+		t.Errorf("expected the list error in the detail, got %q", last.Detail)
+	}
+}
@@ -0,0 +1,75 @@
+// Package collector - data collection for policy checks
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// Audit fetches the pods and metrics in scope once and returns the usage rows
+// of every requested resource, in the analysis mode of opts, together with the
+// limits set by each container of the pods in scope. Unlike the rows, the
+// container limits include containers without any limit.
+func (c *Collector) Audit(ctx context.Context, opts config.Options, resources []config.ResourceKind) (map[config.ResourceKind][]metrics.Row, []metrics.ContainerLimits, error) {
+	labelSelector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid label selector %q: %w", opts.LabelSelector, err)
+	}
+
+	opts, err = c.resolveNamespaces(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pods, podMetrics, err := c.fetch(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defaults, err := c.fetchLimitDefaults(ctx, pods, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows := make(map[config.ResourceKind][]metrics.Row, len(resources))
+	for _, resource := range resources {
+		resourceOpts := opts
+		resourceOpts.Resource = resource
+		resourceRows, err := c.correlateData(pods, podMetrics, defaults, resourceOpts)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows[resource] = resourceRows
+	}
+
+	var limits []metrics.ContainerLimits
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if !inScope(pod, opts, labelSelector) {
+			continue
+		}
+
+		owner := metrics.ResolveOwner(pod)
+		for _, container := range pod.Spec.Containers {
+			limits = append(limits, metrics.ContainerLimits{
+				Namespace: pod.Namespace,
+				Pod:       pod.Name,
+				Container: container.Name,
+				Owner:     owner,
+				Labels:    pod.Labels,
+				CPU:       quantity(container.Resources.Limits, config.ResourceCPU) > 0,
+				Memory:    quantity(container.Resources.Limits, config.ResourceMemory) > 0,
+			})
+		}
+	}
+
+	return rows, limits, nil
+}
@@ -7,40 +7,123 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"log/slog"
+	"math"
+	"path"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
 
 	"github.com/mchmarny/kusage/pkg/config"
 	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/observability"
+	"github.com/mchmarny/kusage/pkg/resilience"
 )
 
 // Collector handles the collection and correlation of Kubernetes resource data.
 // This type implements the collector pattern and encapsulates all the complex
 // logic for gathering data from multiple Kubernetes APIs concurrently.
 type Collector struct {
-	coreClient    *kubernetes.Clientset
-	metricsClient *metricsv.Clientset
+	coreClient    kubernetes.Interface
+	metricsClient metricsv.Interface
+	podSource     PodSource
+	metricsSource MetricsSource
+	observer      *observability.Metrics
+	pageSize      int64
+	retry         resilience.RetryConfig
+	breakers      map[string]*resilience.CircuitBreaker
+	// warnings records the warnings of a collection; nil unless collected
+	// by CollectWithWarnings
+	warnings *warnings
+}
+
+// PodSource provides pod specifications from somewhere other than the
+// Kubernetes API, such as kube-state-metrics series. Pods are filtered by the
+// collector, so sources only need to honor the target namespace.
+type PodSource interface {
+	Pods(ctx context.Context, opts config.Options) ([]corev1.Pod, error)
 }
 
 // New creates a new Collector instance.
-func New(coreClient *kubernetes.Clientset, metricsClient *metricsv.Clientset) *Collector {
-	return &Collector{
+func New(coreClient kubernetes.Interface, metricsClient metricsv.Interface) *Collector {
+	c := &Collector{
 		coreClient:    coreClient,
 		metricsClient: metricsClient,
+		pageSize:      DefaultPageSize,
+		retry:         resilience.DefaultRetryConfig(),
+		breakers:      newBreakers(),
+	}
+	for _, breaker := range c.breakers {
+		breaker.WithOnOpen(func(endpoint string) {
+			slog.Warn("circuit breaker opened", "endpoint", endpoint)
+			if c.observer != nil {
+				c.observer.RecordBreakerTrip(endpoint)
+			}
+		})
 	}
+	return c
+}
+
+// WithMetrics enables recording of API call, pagination and processing
+// metrics into the provided instance. A nil value disables recording.
+func (c *Collector) WithMetrics(m *observability.Metrics) *Collector {
+	c.observer = m
+	return c
+}
+
+// MetricsSource provides pod usage from somewhere other than the metrics API,
+// such as Prometheus history. Like pod sources, it only needs to honor the
+// target namespace.
+type MetricsSource interface {
+	PodMetrics(ctx context.Context, opts config.Options) ([]metrics.PodMetrics, error)
+}
+
+// WithPodSource reads pod specifications from source instead of listing pods.
+// A nil value restores listing pods through the Kubernetes API.
+func (c *Collector) WithPodSource(source PodSource) *Collector {
+	c.podSource = source
+	return c
+}
+
+// WithMetricsSource reads pod usage from source instead of the metrics API.
+// A nil value restores reading usage from metrics-server.
+func (c *Collector) WithMetricsSource(source MetricsSource) *Collector {
+	c.metricsSource = source
+	return c
 }
 
 // Collect gathers pod specifications and metrics data, then correlates them to produce
 // resource usage analysis results. This method implements concurrent data collection
 // using errgroup for improved performance in distributed environments.
 func (c *Collector) Collect(ctx context.Context, opts config.Options) ([]metrics.Row, error) {
+	opts, err := c.resolveNamespaces(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	podsList, metricsList, err := c.fetch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := c.fetchLimitDefaults(ctx, podsList, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Correlate data and compute results
+	return c.correlateData(podsList, metricsList, defaults, opts)
+}
+
+// fetch concurrently retrieves pod specifications and pod metrics and validates
+// that both are present before correlation.
+func (c *Collector) fetch(ctx context.Context, opts config.Options) ([]corev1.Pod, []metrics.PodMetrics, error) {
 	var (
 		podsList    []corev1.Pod
 		metricsList []metrics.PodMetrics
@@ -73,19 +156,21 @@ func (c *Collector) Collect(ctx context.Context, opts config.Options) ([]metrics
 
 	// Wait for both operations to complete
 	if err := g.Wait(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Validate that we have the necessary data
 	if len(podsList) == 0 {
-		return nil, errors.New("no pods found - check namespace and label selector")
+		return nil, nil, errors.New("no pods found - check namespace and label selector")
+	}
+	if len(metricsList) == 0 && c.metricsSource != nil {
+		return nil, nil, errors.New("no pod metrics found - check the usage source covers the namespace and label selector")
 	}
 	if len(metricsList) == 0 {
-		return nil, errors.New("no pod metrics found - ensure metrics-server is installed and running")
+		return nil, nil, errors.New("no pod metrics found - ensure metrics-server is installed and running, or read usage from Prometheus with --source prometheus")
 	}
 
-	// Correlate data and compute results
-	return c.correlateData(podsList, metricsList, opts)
+	return podsList, metricsList, nil
 }
 
 // fetchPods retrieves pod specifications from the Kubernetes API.
@@ -95,28 +180,38 @@ func (c *Collector) fetchPods(ctx context.Context, opts config.Options) ([]corev
 		namespace = ""
 	}
 
-	listOptions := metav1.ListOptions{
-		LabelSelector: opts.LabelSelector,
+	if c.podSource != nil {
+		start := time.Now()
+		pods, err := c.podSource.Pods(ctx, opts)
+		c.recordAPICall(start, err, "list pods from pod source")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pods in namespace %q: %w", namespace, err)
+		}
+		slog.Debug("read pods from pod source", "count", len(pods))
+		return pods, nil
 	}
 
 	slog.Debug("fetching pods",
 		"namespace", namespace,
+		"namespaces", opts.Namespaces,
 		"labelSelector", opts.LabelSelector)
 
-	podList, err := c.coreClient.CoreV1().Pods(namespace).List(ctx, listOptions)
+	pods, err := listAcross(ctx, targetNamespaces(opts), func(ctx context.Context, namespace string) ([]corev1.Pod, error) {
+		return c.listPods(ctx, namespace, opts.LabelSelector)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list pods in namespace %q: %w", namespace, err)
 	}
 
-	if podList == nil || len(podList.Items) == 0 {
+	if len(pods) == 0 {
 		slog.Warn("no pods found",
 			"namespace", namespace,
 			"labelSelector", opts.LabelSelector)
 		return nil, nil
 	}
 
-	slog.Debug("fetched pods", "count", len(podList.Items))
-	return podList.Items, nil
+	slog.Debug("fetched pods", "count", len(pods))
+	return pods, nil
 }
 
 // fetchPodMetrics retrieves pod metrics from the metrics API.
@@ -126,51 +221,70 @@ func (c *Collector) fetchPodMetrics(ctx context.Context, opts config.Options) ([
 		namespace = ""
 	}
 
-	listOptions := metav1.ListOptions{
-		LabelSelector: opts.LabelSelector,
+	if c.metricsSource != nil {
+		start := time.Now()
+		podMetrics, err := c.metricsSource.PodMetrics(ctx, opts)
+		c.recordAPICall(start, err, "list pod metrics from metrics source")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pod metrics in namespace %q: %w", namespace, err)
+		}
+		slog.Debug("read pod metrics from metrics source", "count", len(podMetrics))
+		return dropInfrastructure(podMetrics), nil
 	}
 
 	slog.Debug("fetching pod metrics",
 		"namespace", namespace,
+		"namespaces", opts.Namespaces,
 		"labelSelector", opts.LabelSelector)
 
-	metricsList, err := c.metricsClient.MetricsV1beta1().PodMetricses(namespace).List(ctx, listOptions)
+	items, err := listAcross(ctx, targetNamespaces(opts), func(ctx context.Context, namespace string) ([]metricsv1beta1.PodMetrics, error) {
+		return c.listPodMetrics(ctx, namespace, opts.LabelSelector)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list pod metrics in namespace %q (ensure metrics-server is running): %w", namespace, err)
+		return nil, fmt.Errorf("failed to list pod metrics in namespace %q (%s): %w", namespace, c.describeMetricsFailure(ctx), err)
 	}
 
-	if metricsList == nil || len(metricsList.Items) == 0 {
+	if len(items) == 0 {
 		slog.Warn("no pod metrics found",
 			"namespace", namespace,
 			"labelSelector", opts.LabelSelector)
 		return nil, nil
 	}
 
-	// Convert to internal metrics type
-	result := make([]metrics.PodMetrics, 0, len(metricsList.Items))
-	for _, item := range metricsList.Items {
-		pm := metrics.PodMetrics{
-			TypeMeta:   item.TypeMeta,
-			ObjectMeta: item.ObjectMeta,
-			Timestamp:  item.Timestamp,
-			Window:     item.Window,
-			Containers: make([]metrics.ContainerMetrics, 0, len(item.Containers)),
-		}
-		for _, container := range item.Containers {
-			pm.Containers = append(pm.Containers, metrics.ContainerMetrics{
-				Name:  container.Name,
-				Usage: container.Usage,
-			})
-		}
-		result = append(result, pm)
-	}
+	// Convert to internal metrics type. The page is not pooled because the
+	// result is retained by the caller.
+	result := (&metricsPage{}).convert(items)
 
 	slog.Debug("fetched pod metrics", "count", len(result))
 	return result, nil
 }
 
-// correlateData joins pod specifications with metrics data and computes usage analysis.
-func (c *Collector) correlateData(pods []corev1.Pod, podMetrics []metrics.PodMetrics, opts config.Options) ([]metrics.Row, error) {
+// dropInfrastructure removes the infrastructure containers, such as the pause
+// container, some usage sources report with the containers of a pod, so they
+// are neither listed nor summed into the pod.
+func dropInfrastructure(podMetrics []metrics.PodMetrics) []metrics.PodMetrics {
+	var dropped int
+	for i := range podMetrics {
+		pm := &podMetrics[i]
+		kept := pm.Containers[:0]
+		for _, container := range pm.Containers {
+			if metrics.IsInfrastructureContainer(container.Name) {
+				dropped++
+				continue
+			}
+			kept = append(kept, container)
+		}
+		pm.Containers = kept
+	}
+	if dropped > 0 {
+		slog.Debug("dropped infrastructure containers from pod metrics", "count", dropped)
+	}
+	return podMetrics
+}
+
+// correlateData joins pod specifications with metrics data and computes usage
+// analysis. Containers without a limit get the defaults of their namespace.
+func (c *Collector) correlateData(pods []corev1.Pod, podMetrics []metrics.PodMetrics, defaults limitDefaults, opts config.Options) ([]metrics.Row, error) {
 	// Parse label selector for filtering
 	labelSelector, err := labels.Parse(opts.LabelSelector)
 	if err != nil && opts.LabelSelector != "" {
@@ -179,188 +293,433 @@ func (c *Collector) correlateData(pods []corev1.Pod, podMetrics []metrics.PodMet
 
 	// Build an index of pod specifications for efficient lookup
 	// Use map for O(1) lookups instead of O(n) iteration for better performance
+	// Filtered pods are indexed as nil so their metrics are not reported as unmatched
 	podIndex := make(map[string]*metrics.PodSpecInfo, len(pods))
 
 	for i := range pods {
 		pod := &pods[i]
 
-		// Apply namespace exclusion filter
-		if opts.ExcludeNamespaces != nil && opts.ExcludeNamespaces.MatchString(pod.Namespace) {
+		// Apply namespace, label exclusion and label selector filters
+		if stage, _ := filterPod(pod, opts, labelSelector); stage != "" {
+			podIndex[pod.Namespace+"/"+pod.Name] = nil
 			continue
 		}
 
-		// Apply label exclusion filter
-		if opts.ExcludeLabels != nil {
-			labelString := formatLabels(pod.Labels)
-			if opts.ExcludeLabels.MatchString(labelString) {
-				continue
-			}
+		key := pod.Namespace + "/" + pod.Name
+		podIndex[key] = defaults.podInfo(pod)
+	}
+
+	// Process metrics and compute usage rows
+	rows, unmatched, err := c.computeUsageRows(podMetrics, podIndex, opts)
+	if err != nil {
+		return nil, err
+	}
+	c.reportUnmatched(unmatched, len(podMetrics))
+	fresh := newFreshness()
+	fresh.add(podMetrics)
+	c.reportStale(fresh)
+
+	if c.observer != nil {
+		c.observer.RecordProcessing(int64(len(pods)), int64(len(podMetrics)), 0)
+	}
+
+	return rows, nil
+}
+
+// recordAPICall records the duration and outcome of a non-paginated API call.
+func (c *Collector) recordAPICall(start time.Time, err error, operation string) {
+	if c.observer == nil {
+		return
+	}
+	c.observer.RecordAPICall(time.Since(start), err == nil)
+	if err != nil {
+		c.observer.RecordError(err, operation)
+	}
+}
+
+// recordPage records the duration and outcome of a single paginated list call.
+func (c *Collector) recordPage(start time.Time, err error, operation string) {
+	if c.observer == nil {
+		return
+	}
+	c.observer.RecordPage(time.Since(start), err == nil)
+	if err != nil {
+		c.observer.RecordError(err, operation)
+	}
+}
+
+// filterPod evaluates the pod against the configured exclusion rules.
+// It returns the name of the rejecting stage and a human-readable detail,
+// or empty strings when the pod passes all filters.
+func filterPod(pod *corev1.Pod, opts config.Options, labelSelector labels.Selector) (string, string) {
+	// Apply namespace pattern filter
+	if opts.NamespacePattern != "" {
+		if ok, _ := path.Match(opts.NamespacePattern, pod.Namespace); !ok {
+			return StageNamespacePattern, fmt.Sprintf("namespace %q does not match -n %q", pod.Namespace, opts.NamespacePattern)
 		}
+	}
 
-		// Apply label selector filter
-		if labelSelector != nil && !labelSelector.Matches(labels.Set(pod.Labels)) {
-			continue
+	// Apply namespace exclusion filter
+	if opts.ExcludeNamespaces != nil && opts.ExcludeNamespaces.MatchString(pod.Namespace) {
+		return StageNamespaceExclusion, fmt.Sprintf("namespace %q matches --nx %q", pod.Namespace, opts.ExcludeNamespaces)
+	}
+
+	// Apply label exclusion filter
+	if opts.ExcludeLabels != nil {
+		labelString := formatLabels(pod.Labels)
+		if opts.ExcludeLabels.MatchString(labelString) {
+			return StageLabelExclusion, fmt.Sprintf("labels %q match --lx %q", labelString, opts.ExcludeLabels)
 		}
+	}
 
-		key := pod.Namespace + "/" + pod.Name
-		podIndex[key] = metrics.NewPodSpecInfo(pod)
+	// Apply label selector filter
+	if labelSelector != nil && !labelSelector.Matches(labels.Set(pod.Labels)) {
+		return StageLabelSelector, fmt.Sprintf("labels do not match selector %q", labelSelector)
 	}
 
-	// Process metrics and compute usage rows
-	return c.computeUsageRows(podMetrics, podIndex, opts)
+	// Completed batch pods can still report usage from a range source, but no
+	// longer hold their resources
+	if pod.Status.Phase == corev1.PodSucceeded && !opts.IncludeCompleted {
+		return StageCompleted, "pod ran to completion (phase Succeeded), include it with --include-completed"
+	}
+
+	// Crash-looping pods barely use their limits while they are broken
+	if opts.ExcludeCrashLoop {
+		if names := metrics.CrashLoopContainers(pod); len(names) > 0 {
+			return StageCrashLoop, fmt.Sprintf("container %q is waiting in CrashLoopBackOff, include it without --exclude-crashloop", names[0])
+		}
+	}
+
+	// Sample a stable fraction of the pods of enormous clusters
+	if opts.SampleFraction > 0 && opts.SampleFraction < 1 && !inSample(pod.Namespace, pod.Name, opts.SampleFraction) {
+		return StageSample, fmt.Sprintf("pod is not in the %g sample of --sample-fraction", opts.SampleFraction)
+	}
+
+	return "", ""
+}
+
+// inSample reports whether the pod of namespace and name falls within fraction
+// of all pods. Membership depends only on an FNV-1a hash of namespace/name, so
+// successive runs sample the same pods and a larger fraction adds pods to a
+// smaller one's sample; pods of the same name in two namespaces can be sampled
+// differently.
+func inSample(namespace, name string, fraction float64) bool {
+	h := fnv.New64a()
+	h.Write([]byte(namespace + "/" + name))
+	return float64(h.Sum64())/math.MaxUint64 < fraction
 }
 
 // computeUsageRows processes metrics data and computes usage analysis results.
-func (c *Collector) computeUsageRows(podMetrics []metrics.PodMetrics, podIndex map[string]*metrics.PodSpecInfo, opts config.Options) ([]metrics.Row, error) {
-	var rows []metrics.Row
+func (c *Collector) computeUsageRows(podMetrics []metrics.PodMetrics, podIndex map[string]*metrics.PodSpecInfo, opts config.Options) ([]metrics.Row, int, error) {
+	var (
+		rows      []metrics.Row
+		unmatched int
+	)
 
 	for _, pm := range podMetrics {
 		key := pm.Namespace + "/" + pm.Name
 		podInfo, exists := podIndex[key]
 		if !exists {
-			continue // metrics for a pod we didn't list (filtered or race condition)
+			unmatched++ // metrics for a pod we didn't list (deleted or restarted between the list calls)
+			continue
+		}
+		if podInfo == nil {
+			continue // metrics for a filtered pod
 		}
 
 		switch opts.Mode {
 		case config.ModePods:
-			if row := c.computePodRow(pm, podInfo, opts.Resource); row != nil {
+			if row := c.computePodRow(pm, podInfo, opts); row != nil {
 				rows = append(rows, *row)
 			}
 		case config.ModeContainers:
-			containerRows := c.computeContainerRows(pm, podInfo, opts.Resource)
-			rows = append(rows, containerRows...)
+			rows = c.appendContainerRows(rows, pm, podInfo, opts)
 		}
 	}
 
-	return rows, nil
+	return rows, unmatched, nil
+}
+
+// reportUnmatched warns about and records pod metrics whose pod was not in
+// the pod list. Only metrics API samples are reported: usage aggregated over a
+// range by other sources includes pods that no longer exist.
+func (c *Collector) reportUnmatched(unmatched, total int) {
+	if unmatched == 0 || c.metricsSource != nil {
+		return
+	}
+	percent := float64(unmatched) / float64(total) * 100
+	slog.Warn("pod metrics found for pods missing from the pod list",
+		"unmatched", unmatched, "metrics", total,
+		"percent", fmt.Sprintf("%.1f", percent))
+	c.warn(metrics.Warning{
+		Kind:     metrics.WarningUnmatchedMetrics,
+		Endpoint: EndpointPodMetrics,
+		Count:    unmatched,
+		Message:  fmt.Sprintf("%d of %d pod metrics (%.1f%%) belong to pods missing from the pod list", unmatched, total, percent),
+	})
+	if c.observer != nil {
+		c.observer.RecordUnmatchedMetrics(int64(unmatched))
+	}
 }
 
-// computePodRow computes a usage row for pod-level aggregation.
-func (c *Collector) computePodRow(pm metrics.PodMetrics, podInfo *metrics.PodSpecInfo, resource config.ResourceKind) *metrics.Row {
-	switch resource {
+// computePodRow computes a usage row for pod-level aggregation. Pods without
+// a limit of the resource yield no row unless opts.IncludeNoLimit is set.
+func (c *Collector) computePodRow(pm metrics.PodMetrics, podInfo *metrics.PodSpecInfo, opts config.Options) *metrics.Row {
+	switch opts.Resource {
 	case config.ResourceMemory:
-		return c.computePodMemoryRow(pm, podInfo)
+		return c.computePodMemoryRow(pm, podInfo, opts.IncludeNoLimit)
 	case config.ResourceCPU:
-		return c.computePodCPURow(pm, podInfo)
+		return c.computePodCPURow(pm, podInfo, opts.IncludeNoLimit)
+	case config.ResourceAll:
+		memory := c.computePodMemoryRow(pm, podInfo, true)
+		cpu := c.computePodCPURow(pm, podInfo, true)
+		if !opts.IncludeNoLimit && !memory.HasLimit() && !cpu.HasLimit() {
+			return nil
+		}
+		return combineResources(memory, cpu)
 	default:
 		return nil
 	}
 }
 
-// computePodMemoryRow computes memory usage for a pod.
-func (c *Collector) computePodMemoryRow(pm metrics.PodMetrics, podInfo *metrics.PodSpecInfo) *metrics.Row {
-	if !podInfo.HasMemoryLimit() {
+// computePodMemoryRow computes memory usage for a pod. Only containers with a
+// limit count towards the usage of a limited pod; a pod without any limit is
+// reported with the usage of all its containers and no percentage.
+func (c *Collector) computePodMemoryRow(pm metrics.PodMetrics, podInfo *metrics.PodSpecInfo, includeNoLimit bool) *metrics.Row {
+	limited := podInfo.HasMemoryLimit()
+	if !limited && !includeNoLimit {
 		return nil
 	}
 
-	var totalUsageMi float64
+	var totalUsageBytes, latestBytes int64
+	var growth float64
 	for _, container := range pm.Containers {
-		if !podInfo.ContainerHasMemoryLimit(container.Name) {
+		if limited && !podInfo.ContainerHasMemoryLimit(container.Name) {
 			continue
 		}
-		if qty, ok := container.Usage[corev1.ResourceMemory]; ok {
-			totalUsageMi += float64(qty.Value()) / (1024 * 1024)
-		}
+		totalUsageBytes += container.MemoryBytes
+		latestBytes += container.MemoryLatestBytes
+		growth += container.MemoryGrowthBytesPerSecond
 	}
+	totalUsageMi := float64(totalUsageBytes) / metrics.BytesPerMi
 
-	percentage := (totalUsageMi / podInfo.MemoryLimitMi) * 100
-	return &metrics.Row{
-		Namespace:  pm.Namespace,
-		Name:       pm.Name,
-		UsageMi:    totalUsageMi,
-		LimitMi:    podInfo.MemoryLimitMi,
-		Percentage: percentage,
+	var percentage float64
+	if limited {
+		percentage = (totalUsageMi / podInfo.MemoryLimitMi) * 100
+	}
+	row := &metrics.Row{
+		Namespace:     pm.Namespace,
+		Name:          pm.Name,
+		Resource:      config.ResourceMemory,
+		Mode:          config.ModePods,
+		UsageBytes:    totalUsageBytes,
+		LimitBytes:    metrics.MiToBytes(podInfo.MemoryLimitMi),
+		UsageMi:       totalUsageMi,
+		LimitMi:       podInfo.MemoryLimitMi,
+		Percentage:    percentage,
+		Window:        pm.Window.Duration,
+		Timestamp:     pm.Timestamp.Time,
+		Restarts:      podInfo.Restarts,
+		CrashLoop:     podInfo.CrashLooping(),
+		Windows:       podInfo.Windows,
+		Node:          podInfo.NodeName,
+		Owner:         podInfo.Owner,
+		PriorityClass: podInfo.PriorityClass,
+		Labels:        podLabels(podInfo),
 	}
+	row.DefaultMemoryLimit = len(podInfo.DefaultMemoryLimits) > 0
+	setRequests(row, podInfo, "")
+	setForecast(row, latestBytes, growth)
+	return row
 }
 
-// computePodCPURow computes CPU usage for a pod.
-func (c *Collector) computePodCPURow(pm metrics.PodMetrics, podInfo *metrics.PodSpecInfo) *metrics.Row {
-	if !podInfo.HasCPULimit() {
+// computePodCPURow computes CPU usage for a pod, counting containers like
+// computePodMemoryRow.
+func (c *Collector) computePodCPURow(pm metrics.PodMetrics, podInfo *metrics.PodSpecInfo, includeNoLimit bool) *metrics.Row {
+	limited := podInfo.HasCPULimit()
+	if !limited && !includeNoLimit {
 		return nil
 	}
 
-	var totalUsageMc int64
+	var totalUsageMc, periods, throttled int64
 	for _, container := range pm.Containers {
-		if !podInfo.ContainerHasCPULimit(container.Name) {
+		if limited && !podInfo.ContainerHasCPULimit(container.Name) {
 			continue
 		}
-		if qty, ok := container.Usage[corev1.ResourceCPU]; ok {
-			totalUsageMc += qty.MilliValue()
-		}
+		totalUsageMc += container.CPUMillicores
+		periods += container.CPUPeriods
+		throttled += container.CPUThrottledPeriods
 	}
 
-	percentage := (float64(totalUsageMc) / float64(podInfo.CPULimitMc)) * 100
-	return &metrics.Row{
-		Namespace:  pm.Namespace,
-		Name:       pm.Name,
-		UsageMc:    totalUsageMc,
-		LimitMc:    podInfo.CPULimitMc,
-		Percentage: percentage,
+	var percentage float64
+	if limited {
+		percentage = (float64(totalUsageMc) / float64(podInfo.CPULimitMc)) * 100
 	}
+	row := &metrics.Row{
+		Namespace:     pm.Namespace,
+		Name:          pm.Name,
+		Resource:      config.ResourceCPU,
+		Mode:          config.ModePods,
+		UsageMc:       totalUsageMc,
+		LimitMc:       podInfo.CPULimitMc,
+		Percentage:    percentage,
+		Window:        pm.Window.Duration,
+		Timestamp:     pm.Timestamp.Time,
+		Restarts:      podInfo.Restarts,
+		CrashLoop:     podInfo.CrashLooping(),
+		Windows:       podInfo.Windows,
+		Node:          podInfo.NodeName,
+		Owner:         podInfo.Owner,
+		PriorityClass: podInfo.PriorityClass,
+		Labels:        podLabels(podInfo),
+	}
+	row.DefaultCPULimit = len(podInfo.DefaultCPULimits) > 0
+	row.SetThrottle(periods, throttled)
+	setRequests(row, podInfo, "")
+	return row
 }
 
-// computeContainerRows computes usage rows for container-level analysis.
-func (c *Collector) computeContainerRows(pm metrics.PodMetrics, podInfo *metrics.PodSpecInfo, resource config.ResourceKind) []metrics.Row {
-	var rows []metrics.Row
-
+// appendContainerRows computes usage rows for container-level analysis and
+// appends them to rows, which lets callers reuse a buffer across pods.
+// Containers without a limit of the resource yield no row unless
+// opts.IncludeNoLimit is set.
+func (c *Collector) appendContainerRows(rows []metrics.Row, pm metrics.PodMetrics, podInfo *metrics.PodSpecInfo, opts config.Options) []metrics.Row {
 	for _, container := range pm.Containers {
 		containerName := pm.Name + ":" + container.Name
 
-		switch resource {
+		var row *metrics.Row
+		switch opts.Resource {
 		case config.ResourceMemory:
-			if row := c.computeContainerMemoryRow(pm.Namespace, containerName, container, podInfo); row != nil {
-				rows = append(rows, *row)
-			}
+			row = c.computeContainerMemoryRow(pm.Namespace, containerName, container, podInfo, opts.IncludeNoLimit)
 		case config.ResourceCPU:
-			if row := c.computeContainerCPURow(pm.Namespace, containerName, container, podInfo); row != nil {
-				rows = append(rows, *row)
+			row = c.computeContainerCPURow(pm.Namespace, containerName, container, podInfo, opts.IncludeNoLimit)
+		case config.ResourceAll:
+			memory := c.computeContainerMemoryRow(pm.Namespace, containerName, container, podInfo, true)
+			cpu := c.computeContainerCPURow(pm.Namespace, containerName, container, podInfo, true)
+			if opts.IncludeNoLimit || memory.HasLimit() || cpu.HasLimit() {
+				row = combineResources(memory, cpu)
 			}
 		}
+		if row != nil {
+			row.Mode = config.ModeContainers
+			row.Window = pm.Window.Duration
+			row.Timestamp = pm.Timestamp.Time
+			row.Restarts = podInfo.ContainerRestarts[container.Name]
+			row.CrashLoop = podInfo.ContainerCrashLoop[container.Name]
+			row.Windows = podInfo.Windows
+			row.Node = podInfo.NodeName
+			row.Owner = podInfo.Owner
+			row.PriorityClass = podInfo.PriorityClass
+			row.Labels = podLabels(podInfo)
+			setRequests(row, podInfo, container.Name)
+			rows = append(rows, *row)
+		}
 	}
 
 	return rows
 }
 
 // computeContainerMemoryRow computes memory usage for a container.
-func (c *Collector) computeContainerMemoryRow(namespace, containerName string, container metrics.ContainerMetrics, podInfo *metrics.PodSpecInfo) *metrics.Row {
-	limitMi, hasLimit := podInfo.ContainerMemoryLimits[container.Name]
-	if !hasLimit || limitMi <= 0 {
+func (c *Collector) computeContainerMemoryRow(namespace, containerName string, container metrics.ContainerMetrics, podInfo *metrics.PodSpecInfo, includeNoLimit bool) *metrics.Row {
+	limitMi := podInfo.ContainerMemoryLimits[container.Name]
+	if limitMi <= 0 && !includeNoLimit {
 		return nil
 	}
 
-	var usageMi float64
-	if qty, ok := container.Usage[corev1.ResourceMemory]; ok {
-		usageMi = float64(qty.Value()) / (1024 * 1024)
-	}
+	usageBytes := container.MemoryBytes
+	usageMi := float64(usageBytes) / metrics.BytesPerMi
 
-	percentage := (usageMi / limitMi) * 100
-	return &metrics.Row{
+	var percentage float64
+	if limitMi > 0 {
+		percentage = (usageMi / limitMi) * 100
+	}
+	row := &metrics.Row{
 		Namespace:  namespace,
 		Name:       containerName,
+		Resource:   config.ResourceMemory,
+		UsageBytes: usageBytes,
+		LimitBytes: metrics.MiToBytes(limitMi),
 		UsageMi:    usageMi,
 		LimitMi:    limitMi,
 		Percentage: percentage,
 	}
+	row.DefaultMemoryLimit = podInfo.DefaultMemoryLimits[container.Name]
+	setForecast(row, container.MemoryLatestBytes, container.MemoryGrowthBytesPerSecond)
+	return row
 }
 
 // computeContainerCPURow computes CPU usage for a container.
-func (c *Collector) computeContainerCPURow(namespace, containerName string, container metrics.ContainerMetrics, podInfo *metrics.PodSpecInfo) *metrics.Row {
-	limitMc, hasLimit := podInfo.ContainerCPULimits[container.Name]
-	if !hasLimit || limitMc <= 0 {
+func (c *Collector) computeContainerCPURow(namespace, containerName string, container metrics.ContainerMetrics, podInfo *metrics.PodSpecInfo, includeNoLimit bool) *metrics.Row {
+	limitMc := podInfo.ContainerCPULimits[container.Name]
+	if limitMc <= 0 && !includeNoLimit {
 		return nil
 	}
 
-	var usageMc int64
-	if qty, ok := container.Usage[corev1.ResourceCPU]; ok {
-		usageMc = qty.MilliValue()
-	}
+	usageMc := container.CPUMillicores
 
-	percentage := (float64(usageMc) / float64(limitMc)) * 100
-	return &metrics.Row{
+	var percentage float64
+	if limitMc > 0 {
+		percentage = (float64(usageMc) / float64(limitMc)) * 100
+	}
+	row := &metrics.Row{
 		Namespace:  namespace,
 		Name:       containerName,
+		Resource:   config.ResourceCPU,
 		UsageMc:    usageMc,
 		LimitMc:    limitMc,
 		Percentage: percentage,
 	}
+	row.DefaultCPULimit = podInfo.DefaultCPULimits[container.Name]
+	row.SetThrottle(container.CPUPeriods, container.CPUThrottledPeriods)
+	return row
+}
+
+// combineResources merges the memory and CPU rows of a pod or container into
+// a row of both resources, ranked by the higher of the two percentages. A
+// resource without a limit counts the usage of all containers.
+func combineResources(memory, cpu *metrics.Row) *metrics.Row {
+	row := *memory
+	row.Resource = config.ResourceAll
+	row.UsageMc, row.LimitMc, row.RequestMc = cpu.UsageMc, cpu.LimitMc, cpu.RequestMc
+	row.DefaultCPULimit = cpu.DefaultCPULimit
+	row.SetThrottle(cpu.CPUPeriods, cpu.ThrottledPeriods)
+	row.Percentage = max(memory.Percentage, cpu.Percentage)
+	return &row
+}
+
+// setForecast estimates the hours until the memory usage of row reaches its
+// limit from the latest usage and its growth rate. Rows whose usage is not
+// growing, or that have no limit, get no forecast.
+func setForecast(row *metrics.Row, latestBytes int64, growthBytesPerSecond float64) {
+	if growthBytesPerSecond <= 0 || row.LimitBytes <= 0 {
+		return
+	}
+	hours := float64(max(row.LimitBytes-latestBytes, 0)) / growthBytesPerSecond / 3600
+	row.HoursToLimit = &hours
+}
+
+// podLabels returns the labels of the pod behind podInfo, if known.
+func podLabels(podInfo *metrics.PodSpecInfo) map[string]string {
+	if podInfo.Pod == nil {
+		return nil
+	}
+	return podInfo.Pod.Labels
+}
+
+// setRequests sets the request of the row's resource, or of both resources,
+// summed across all containers of the pod or taken from the named container.
+func setRequests(row *metrics.Row, podInfo *metrics.PodSpecInfo, containerName string) {
+	if row.Resource != config.ResourceMemory {
+		row.RequestMc = podInfo.CPURequestMc
+		if containerName != "" {
+			row.RequestMc = podInfo.ContainerCPURequests[containerName]
+		}
+	}
+	if row.Resource != config.ResourceCPU {
+		row.RequestMi = podInfo.MemoryRequestMi
+		if containerName != "" {
+			row.RequestMi = podInfo.ContainerMemoryRequests[containerName]
+		}
+		row.RequestBytes = int64(row.RequestMi * metrics.BytesPerMi)
+	}
 }
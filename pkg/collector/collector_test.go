@@ -0,0 +1,1280 @@
+package collector_test
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+
+	"github.com/mchmarny/kusage/pkg/collector"
+	"github.com/mchmarny/kusage/pkg/collector/fake"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/observability"
+)
+
+// newFixtureCollector returns a collector backed by the default recorded fixture.
+func newFixtureCollector(t *testing.T) *collector.Collector {
+	t.Helper()
+
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+	c, err := fake.NewCollector(fixture)
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+	return c
+}
+
+// rowsByName indexes rows by namespace/name.
+func rowsByName(rows []metrics.Row) map[string]metrics.Row {
+	index := make(map[string]metrics.Row, len(rows))
+	for _, row := range rows {
+		index[row.Namespace+"/"+row.Name] = row
+	}
+	return index
+}
+
+func TestCollector_Collect(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     config.Options
+		expected []string
+		excluded []string
+	}{
+		{
+			name: "pods memory across all namespaces",
+			opts: config.Options{AllNamespaces: true, Mode: config.ModePods, Resource: config.ResourceMemory},
+			expected: []string{
+				"payments/payments-api-7c9d8f6b5-m8zrt",
+				"payments/payments-db-0",
+				"kube-system/coredns-668d6bf9bc-4mgrq",
+				"monitoring/node-exporter-p9x4l",
+			},
+			excluded: []string{
+				"default/batch-worker-5b6c7d8e9-k7j2m",        // no limits
+				"default/reports-6f7a8b9c0-zz9xk",             // pending, no metrics
+				"payments/payments-api-7c9d8f6b5-old01",       // metrics without pod
+				"kube-system/metrics-server-84c8f7b8b4-jv5wd", // no limits
+			},
+		},
+		{
+			name: "namespace exclusion",
+			opts: config.Options{
+				AllNamespaces:     true,
+				Mode:              config.ModePods,
+				Resource:          config.ResourceMemory,
+				ExcludeNamespaces: regexp.MustCompile("^(kube-system|monitoring)$"),
+			},
+			expected: []string{"payments/payments-db-0"},
+			excluded: []string{"kube-system/coredns-668d6bf9bc-4mgrq", "monitoring/node-exporter-p9x4l"},
+		},
+		{
+			name:     "containers cpu in single namespace",
+			opts:     config.Options{Namespace: "payments", Mode: config.ModeContainers, Resource: config.ResourceCPU},
+			expected: []string{"payments/payments-api-7c9d8f6b5-x2kqp:api", "payments/payments-api-7c9d8f6b5-x2kqp:istio-proxy"},
+			excluded: []string{"kube-system/coredns-668d6bf9bc-4mgrq:coredns"}, // memory limit only
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := newFixtureCollector(t).Collect(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			index := rowsByName(rows)
+			for _, key := range tt.expected {
+				if _, ok := index[key]; !ok {
+					t.Errorf("expected row %s", key)
+				}
+			}
+			for _, key := range tt.excluded {
+				if _, ok := index[key]; ok {
+					t.Errorf("unexpected row %s", key)
+				}
+			}
+		})
+	}
+}
+
+func TestCollector_CollectValues(t *testing.T) {
+	opts := config.Options{Namespace: "payments", Mode: config.ModePods, Resource: config.ResourceMemory}
+
+	rows, err := newFixtureCollector(t).Collect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	row, ok := rowsByName(rows)["payments/payments-api-7c9d8f6b5-m8zrt"]
+	if !ok {
+		t.Fatal("expected payments-api row")
+	}
+
+	// api 501Mi + istio-proxy 58Mi over 512Mi + 128Mi limits
+	if row.UsageMi != 559 || row.LimitMi != 640 {
+		t.Errorf("unexpected usage/limit: %v/%v", row.UsageMi, row.LimitMi)
+	}
+	if row.UsageBytes != 559*metrics.BytesPerMi {
+		t.Errorf("unexpected usage bytes: %d", row.UsageBytes)
+	}
+	if row.Owner != "Deployment/payments-api" || row.Node != "node-pool-a-2" || row.Restarts != 2 {
+		t.Errorf("unexpected metadata: owner=%s node=%s restarts=%d", row.Owner, row.Node, row.Restarts)
+	}
+	if row.Window.Seconds() < 15 || row.Timestamp.IsZero() {
+		t.Errorf("unexpected sample info: window=%v timestamp=%v", row.Window, row.Timestamp)
+	}
+}
+
+func TestCollector_RecordsMetrics(t *testing.T) {
+	observer := observability.NewMetrics()
+	opts := config.Options{AllNamespaces: true, Mode: config.ModePods, Resource: config.ResourceMemory}
+
+	if _, err := newFixtureCollector(t).WithMetrics(observer).Collect(context.Background(), opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	summary := observer.GetSummary()
+	if summary.APICallsTotal != 2 || summary.APICallsSuccessful != 2 {
+		t.Errorf("expected 2 successful API calls, got %d/%d", summary.APICallsSuccessful, summary.APICallsTotal)
+	}
+	if summary.PodsProcessed != 12 || summary.MetricsProcessed != 12 {
+		t.Errorf("unexpected processing counts: pods=%d metrics=%d", summary.PodsProcessed, summary.MetricsProcessed)
+	}
+}
+
+func TestCollector_Paginated(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+
+	opts := config.Options{AllNamespaces: true, Mode: config.ModeContainers, Resource: config.ResourceMemory}
+	expected, err := newFixtureCollector(t).Collect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("collect failed: %v", err)
+	}
+
+	core, metricsClient := newPagedClients(t, fixture)
+	observer := observability.NewMetrics()
+	c := collector.New(core, metricsClient).WithMetrics(observer).WithPageSize(5)
+
+	rows, err := c.Collect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %d rows, got %d", len(expected), len(rows))
+	}
+
+	// 12 pods and 12 pod metrics in pages of 5
+	if summary := observer.GetSummary(); summary.PagesFetched != 6 {
+		t.Errorf("expected 6 pages, got %d", summary.PagesFetched)
+	}
+}
+
+func TestCollector_Explain(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     config.Options
+		stage    string
+		excluded bool
+		node     string
+	}{
+		{
+			name:     "excluded by namespace",
+			opts:     config.Options{AllNamespaces: true, WhyPod: "coredns-668d6bf9bc-4mgrq", ExcludeNamespaces: regexp.MustCompile("^kube-system$")},
+			stage:    collector.StageNamespaceExclusion,
+			excluded: true,
+		},
+		{
+			name:     "no limits",
+			opts:     config.Options{Namespace: "default", WhyPod: "batch-worker-5b6c7d8e9-k7j2m"},
+			stage:    collector.StageLimits,
+			excluded: true,
+		},
+		{
+			name:     "no metrics",
+			opts:     config.Options{Namespace: "default", WhyPod: "reports-6f7a8b9c0-zz9xk"},
+			stage:    collector.StageMetrics,
+			excluded: true,
+		},
+		{
+			name:     "not listed",
+			opts:     config.Options{Namespace: "default", WhyPod: "missing"},
+			stage:    collector.StageListed,
+			excluded: true,
+		},
+		{
+			name:  "included",
+			opts:  config.Options{Namespace: "payments", WhyPod: "payments-db-0"},
+			stage: collector.StageLimits,
+			node:  "node-pool-b-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Mode = config.ModePods
+			tt.opts.Resource = config.ResourceMemory
+
+			traces, _, err := newFixtureCollector(t).Explain(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(traces) != 1 {
+				t.Fatalf("expected 1 trace, got %d", len(traces))
+			}
+
+			trace := traces[0]
+			if trace.Excluded() != tt.excluded {
+				t.Errorf("expected excluded=%t, got %t", tt.excluded, trace.Excluded())
+			}
+			last := trace.Steps[len(trace.Steps)-1]
+			if last.Stage != tt.stage {
+				t.Errorf("expected last stage %s, got %s (%s)", tt.stage, last.Stage, last.Detail)
+			}
+			if tt.node != "" && trace.Node != tt.node {
+				t.Errorf("expected node %s, got %s", tt.node, trace.Node)
+			}
+		})
+	}
+}
+
+func TestCollector_NamespaceAttributes(t *testing.T) {
+	c := newFixtureCollector(t)
+
+	tests := []struct {
+		name     string
+		opts     config.Options
+		expected map[string]string
+		wantErr  bool
+	}{
+		{
+			name: "all namespaces reads labels then annotations",
+			opts: config.Options{AllNamespaces: true},
+			expected: map[string]string{
+				"kube-system": "platform",
+				"monitoring":  "platform",
+				"payments":    "cc-1042",
+			},
+		},
+		{
+			name:     "single namespace",
+			opts:     config.Options{Namespace: "payments"},
+			expected: map[string]string{"payments": "cc-1042"},
+		},
+		{
+			name:     "namespace without attribute",
+			opts:     config.Options{Namespace: "default"},
+			expected: map[string]string{},
+		},
+		{
+			name:    "missing namespace",
+			opts:    config.Options{Namespace: "missing"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attributes, err := c.NamespaceAttributes(context.Background(), tt.opts, "cost-center")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(attributes) != len(tt.expected) {
+				t.Errorf("expected %d namespaces, got %v", len(tt.expected), attributes)
+			}
+			for ns, want := range tt.expected {
+				if attributes[ns] != want {
+					t.Errorf("%s: expected %q, got %q", ns, want, attributes[ns])
+				}
+			}
+		})
+	}
+}
+
+func TestCollector_NodePools(t *testing.T) {
+	c := newFixtureCollector(t)
+
+	tests := []struct {
+		name     string
+		opts     config.Options
+		expected []metrics.NodePool
+	}{
+		{
+			name: "cpu by gke node pool",
+			opts: config.Options{Resource: config.ResourceCPU, PoolLabel: "cloud.google.com/gke-nodepool"},
+			expected: []metrics.NodePool{
+				{Name: "pool-a", Nodes: 3, Pods: 8, Allocatable: 11760, Requests: 1300, Limits: 2700, Unlimited: 2, Usage: 1945},
+				{Name: "pool-b", Nodes: 1, Pods: 3, Allocatable: 7910, Requests: 1200, Limits: 2250, Unlimited: 1, Usage: 1219},
+			},
+		},
+		{
+			name: "memory without pool label",
+			opts: config.Options{Resource: config.ResourceMemory, PoolLabel: "example.com/pool"},
+			expected: []metrics.NodePool{
+				{Name: collector.UnpooledNodes, Nodes: 4, Pods: 11, Allocatable: 68121.546875, Requests: 3496, Limits: 6790, Unlimited: 2, Usage: 6336.203125},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pools, err := c.NodePools(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatalf("NodePools failed: %v", err)
+			}
+			if len(pools) != len(tt.expected) {
+				t.Fatalf("expected %d pools, got %+v", len(tt.expected), pools)
+			}
+			for i, want := range tt.expected {
+				if pools[i] != want {
+					t.Errorf("pool %d:\n got %+v\nwant %+v", i, pools[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCollector_Scheduling(t *testing.T) {
+	c := newFixtureCollector(t)
+
+	pending, nodes, err := c.Scheduling(context.Background(), config.Options{AllNamespaces: true})
+	if err != nil {
+		t.Fatalf("Scheduling failed: %v", err)
+	}
+
+	if len(pending) != 1 {
+		t.Fatalf("expected 1 pending pod, got %+v", pending)
+	}
+	want := metrics.PendingPod{
+		Namespace: "default", Name: "reports-6f7a8b9c0-zz9xk", Owner: "Deployment/reports",
+		RequestMc: 500, RequestMi: 6144, Message: "0/3 nodes are available: 3 Insufficient memory.",
+	}
+	if pending[0] != want {
+		t.Errorf("unexpected pending pod:\n got %+v\nwant %+v", pending[0], want)
+	}
+
+	// node-pool-b-1 runs payments-db-0, metrics-server and a node exporter; postgres
+	// uses more than it requests, so only the other two contribute reclaimable requests
+	expected := metrics.NodeAllocation{
+		Name: "node-pool-b-1", AllocatableMc: 7910, AllocatableMi: 28413.53515625, AllocatablePods: 110, Pods: 3,
+		RequestedMc: 1200, RequestedMi: 2278,
+		ReclaimableMc: (100 - 6) + (100 - 9), ReclaimableMi: (200 - 24) + (30 - 29),
+	}
+	for _, node := range nodes {
+		if node.Name != expected.Name {
+			continue
+		}
+		if !reflect.DeepEqual(node, expected) {
+			t.Errorf("unexpected allocation:\n got %+v\nwant %+v", node, expected)
+		}
+		return
+	}
+	t.Fatalf("node %s not found in %+v", expected.Name, nodes)
+}
+
+func TestCollector_Audit(t *testing.T) {
+	c := newFixtureCollector(t)
+
+	opts := config.Options{AllNamespaces: true, Mode: config.ModeContainers, ExcludeNamespaces: regexp.MustCompile("^monitoring$")}
+	rows, limits, err := c.Audit(context.Background(), opts, []config.ResourceKind{config.ResourceMemory, config.ResourceCPU})
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+
+	// coredns only limits memory, so it has a memory row but no CPU row
+	if _, ok := rowsByName(rows[config.ResourceMemory])["kube-system/coredns-668d6bf9bc-4mgrq:coredns"]; !ok {
+		t.Error("expected a memory row for coredns")
+	}
+	if _, ok := rowsByName(rows[config.ResourceCPU])["kube-system/coredns-668d6bf9bc-4mgrq:coredns"]; ok {
+		t.Error("expected no CPU row for coredns")
+	}
+
+	index := make(map[string]metrics.ContainerLimits, len(limits))
+	for _, container := range limits {
+		if container.Namespace == "monitoring" {
+			t.Errorf("excluded namespace audited: %+v", container)
+		}
+		index[container.Namespace+"/"+container.Pod+":"+container.Container] = container
+	}
+	expected := map[string][2]bool{
+		"kube-system/coredns-668d6bf9bc-4mgrq:coredns":               {false, true},
+		"kube-system/metrics-server-84c8f7b8b4-jv5wd:metrics-server": {false, false},
+		"default/batch-worker-5b6c7d8e9-k7j2m:worker":                {false, false},
+		"payments/payments-db-0:postgres":                            {true, true},
+	}
+	for key, want := range expected {
+		got, ok := index[key]
+		if !ok {
+			t.Errorf("%s: not audited", key)
+			continue
+		}
+		if got.CPU != want[0] || got.Memory != want[1] {
+			t.Errorf("%s: expected cpu=%v memory=%v, got cpu=%v memory=%v", key, want[0], want[1], got.CPU, got.Memory)
+		}
+	}
+}
+
+// fakeVolumeSource reports one volume per node, and records the nodes it was asked for
+type fakeVolumeSource struct {
+	nodes []string
+}
+
+func (f *fakeVolumeSource) Volumes(_ context.Context, nodes []string) ([]metrics.VolumeUsage, error) {
+	f.nodes = nodes
+	return []metrics.VolumeUsage{
+		{Namespace: "payments", Claim: "data-payments-db-0", Pod: "payments-db-0", Node: "node-pool-b-1", UsedBytes: 9, CapacityBytes: 10, Percentage: 90},
+		{Namespace: "kube-system", Claim: "other", Pod: "metrics-server-84c8f7b8b4-jv5wd", Node: "node-pool-b-1", UsedBytes: 1, CapacityBytes: 10, Percentage: 10},
+	}, nil
+}
+
+func TestCollector_Volumes(t *testing.T) {
+	c := newFixtureCollector(t)
+	source := &fakeVolumeSource{}
+
+	volumes, err := c.Volumes(context.Background(), config.Options{Namespace: "payments"}, source)
+	if err != nil {
+		t.Fatalf("Volumes failed: %v", err)
+	}
+
+	// Only the nodes of the running payments pods are read
+	sort.Strings(source.nodes)
+	if got := strings.Join(source.nodes, ","); got != "node-pool-a-1,node-pool-a-2,node-pool-a-3,node-pool-b-1" {
+		t.Errorf("unexpected nodes read: %s", got)
+	}
+	if len(volumes) != 1 || volumes[0].Claim != "data-payments-db-0" {
+		t.Errorf("expected only the payments volume, got %+v", volumes)
+	}
+}
+
+// fakeFilesystemSource reports the filesystems of node-pool-b-1 only
+type fakeFilesystemSource struct{}
+
+func (fakeFilesystemSource) Filesystems(_ context.Context, _ []string) (map[string]metrics.NodeFilesystems, error) {
+	return map[string]metrics.NodeFilesystems{
+		"node-pool-b-1": {NodeFS: &metrics.FilesystemUsage{UsedBytes: 90, CapacityBytes: 100}},
+	}, nil
+}
+
+func TestCollector_Nodes(t *testing.T) {
+	c := newFixtureCollector(t)
+
+	nodes, err := c.Nodes(context.Background(), fakeFilesystemSource{})
+	if err != nil {
+		t.Fatalf("Nodes failed: %v", err)
+	}
+
+	if len(nodes) != 4 || nodes[0].Name != "node-pool-a-1" || nodes[3].Name != "node-pool-b-1" {
+		t.Fatalf("unexpected nodes %+v", nodes)
+	}
+	if nodes[0].NodeFS != nil {
+		t.Errorf("expected no filesystem usage for %s, got %+v", nodes[0].Name, nodes[0].NodeFS)
+	}
+	b := nodes[3]
+	if b.RequestedMc != 1200 || b.Pods != 3 || b.AllocatablePods != 110 || b.NodeFS == nil || b.NodeFS.Percentage() != 90 {
+		t.Errorf("unexpected node %+v", b)
+	}
+	if want := (metrics.NodeResourceUsage{UsedMc: 2021, UsedMi: 8192}); b.Usage == nil || *b.Usage != want {
+		t.Errorf("expected usage %+v from the node metrics, got %+v", want, b.Usage)
+	}
+	// Nodes the metrics API does not report have no usage
+	if nodes[2].Usage != nil {
+		t.Errorf("expected no usage for %s, got %+v", nodes[2].Name, nodes[2].Usage)
+	}
+}
+
+func TestCollector_NodeTaints(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+	for i := range fixture.Nodes.Items {
+		node := &fixture.Nodes.Items[i]
+		switch node.Name {
+		case "node-pool-a-1":
+			node.Spec.Taints = []corev1.Taint{
+				{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule},
+				{Key: "spot", Effect: corev1.TaintEffectPreferNoSchedule},
+			}
+		case "node-pool-b-1":
+			node.Spec.Unschedulable = true
+			node.Spec.Taints = []corev1.Taint{{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule}}
+		}
+	}
+	c, err := fake.NewCollector(fixture)
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+
+	_, nodes, err := c.Scheduling(context.Background(), config.Options{AllNamespaces: true})
+	if err != nil {
+		t.Fatalf("Scheduling failed: %v", err)
+	}
+	for _, node := range nodes {
+		switch node.Name {
+		case "node-pool-a-1":
+			// Soft taints do not keep pods off the node
+			if !reflect.DeepEqual(node.Taints, []string{"dedicated=gpu:NoSchedule"}) || node.Schedulable() {
+				t.Errorf("expected %s tainted, got %+v", node.Name, node)
+			}
+		case "node-pool-b-1":
+			// The taint of a cordoned node is reported as the cordon
+			if len(node.Taints) != 0 || !node.Unschedulable || node.Schedulable() {
+				t.Errorf("expected %s cordoned without taints, got %+v", node.Name, node)
+			}
+		default:
+			if !node.Schedulable() {
+				t.Errorf("expected %s schedulable, got %+v", node.Name, node)
+			}
+		}
+	}
+}
+
+func TestCollector_CompletedPods(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+	for i := range fixture.Pods.Items {
+		if pod := &fixture.Pods.Items[i]; pod.Name == "payments-db-0" {
+			pod.Status.Phase = corev1.PodSucceeded
+		}
+	}
+	c, err := fake.NewCollector(fixture)
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+
+	for _, include := range []bool{false, true} {
+		opts := config.Options{Namespace: "payments", Mode: config.ModePods, Resource: config.ResourceMemory, IncludeCompleted: include}
+		rows, err := c.Collect(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("Collect failed: %v", err)
+		}
+		if _, found := rowsByName(rows)["payments/payments-db-0"]; found != include {
+			t.Errorf("include completed %t: expected completed pod listed %t, got %t", include, include, found)
+		}
+	}
+}
+
+func TestCollector_CrashLoop(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+	container := ""
+	for i := range fixture.Pods.Items {
+		if pod := &fixture.Pods.Items[i]; pod.Name == "payments-db-0" {
+			container = pod.Spec.Containers[0].Name
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+				Name:         container,
+				RestartCount: 12,
+				State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: metrics.ReasonCrashLoopBackOff}},
+			}}
+		}
+	}
+	c, err := fake.NewCollector(fixture)
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+
+	opts := config.Options{Namespace: "payments", Mode: config.ModePods, Resource: config.ResourceMemory}
+	rows, err := c.Collect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	index := rowsByName(rows)
+	if row, found := index["payments/payments-db-0"]; !found || !row.CrashLoop {
+		t.Errorf("expected the crash-looping pod to be marked, got %+v", row)
+	}
+	for name, row := range index {
+		if name != "payments/payments-db-0" && row.CrashLoop {
+			t.Errorf("expected %s not to be marked", name)
+		}
+	}
+
+	opts.Mode = config.ModeContainers
+	rows, err = c.Collect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if row, found := rowsByName(rows)["payments/payments-db-0:"+container]; !found || !row.CrashLoop {
+		t.Errorf("expected the crash-looping container to be marked, got %+v", row)
+	}
+
+	opts.Mode, opts.ExcludeCrashLoop = config.ModePods, true
+	rows, err = c.Collect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if _, found := rowsByName(rows)["payments/payments-db-0"]; found {
+		t.Error("expected the crash-looping pod to be excluded")
+	}
+}
+
+func TestCollector_NamespacePattern(t *testing.T) {
+	c := newFixtureCollector(t)
+
+	tests := []struct {
+		name       string
+		pattern    string
+		exclude    string
+		namespaces []string
+		wantErr    bool
+	}{
+		{name: "single match", pattern: "pay*", namespaces: []string{"payments"}},
+		{name: "several matches", pattern: "[dk]*", namespaces: []string{"default", "kube-system"}},
+		{name: "composes with exclusion", pattern: "[dk]*", exclude: "^kube-system$", namespaces: []string{"default"}},
+		{name: "no match", pattern: "team-*", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := config.Options{AllNamespaces: true, NamespacePattern: tt.pattern, Mode: config.ModePods, Resource: config.ResourceMemory}
+			if tt.exclude != "" {
+				opts.ExcludeNamespaces = regexp.MustCompile(tt.exclude)
+			}
+			rows, err := c.Collect(context.Background(), opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error for a pattern matching no namespace")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Collect failed: %v", err)
+			}
+
+			seen := make(map[string]bool)
+			for _, row := range rows {
+				seen[row.Namespace] = true
+			}
+			var namespaces []string
+			for ns := range seen {
+				namespaces = append(namespaces, ns)
+			}
+			sort.Strings(namespaces)
+			if strings.Join(namespaces, ",") != strings.Join(tt.namespaces, ",") {
+				t.Errorf("expected namespaces %v, got %v", tt.namespaces, namespaces)
+			}
+		})
+	}
+}
+
+func TestCollector_ExcludeNamespaces(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		exclude string
+		listed  []string
+		wantErr bool
+	}{
+		{name: "several left", exclude: "^kube-system$", listed: []string{"default", "monitoring", "payments"}},
+		{name: "one left", exclude: "^(default|kube-system|monitoring)$", listed: []string{"payments"}},
+		{name: "none left", exclude: ".*", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, metricsClient, err := fake.NewClients(fixture)
+			if err != nil {
+				t.Fatalf("failed to create clients: %v", err)
+			}
+
+			opts := config.Options{AllNamespaces: true, ExcludeNamespaces: regexp.MustCompile(tt.exclude), Mode: config.ModePods, Resource: config.ResourceMemory}
+			rows, err := collector.New(core, metricsClient).Collect(context.Background(), opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error when every namespace is excluded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Collect failed: %v", err)
+			}
+
+			// Pods are only listed in the namespaces left after exclusion
+			var listed []string
+			for _, action := range core.(*k8sfake.Clientset).Actions() {
+				if action.Matches("list", "pods") {
+					listed = append(listed, action.GetNamespace())
+				}
+			}
+			sort.Strings(listed)
+			if strings.Join(listed, ",") != strings.Join(tt.listed, ",") {
+				t.Errorf("expected pods listed in %v, got %v", tt.listed, listed)
+			}
+			for _, row := range rows {
+				if opts.ExcludeNamespaces.MatchString(row.Namespace) {
+					t.Errorf("unexpected row in excluded namespace: %s/%s", row.Namespace, row.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestCollector_Sidecars(t *testing.T) {
+	c := newFixtureCollector(t)
+
+	tests := []struct {
+		name     string
+		patterns []string
+		pods     int
+	}{
+		{name: "container name", patterns: []string{"istio-*"}, pods: 3},
+		{name: "image name", patterns: []string{"proxyv2"}, pods: 3},
+		{name: "no match", patterns: []string{"linkerd-proxy"}, pods: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := config.Options{Namespace: "payments", Mode: config.ModeSidecars, SidecarPatterns: tt.patterns}
+			pods, err := c.Sidecars(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("Sidecars failed: %v", err)
+			}
+			if len(pods) != tt.pods {
+				t.Fatalf("expected %d pods, got %+v", tt.pods, pods)
+			}
+			for _, pod := range pods {
+				if pod.Name != "payments-api-7c9d8f6b5-x2kqp" {
+					continue
+				}
+				want := metrics.SidecarUsage{
+					Namespace: "payments", Name: pod.Name, Containers: []string{"istio-proxy"},
+					Sidecars: metrics.ResourceTotals{MemoryMi: 58, MemoryLimitMi: 128, CPUMc: 21, CPULimitMc: 200},
+					Total:    metrics.ResourceTotals{MemoryMi: 526, MemoryLimitMi: 640, CPUMc: 433, CPULimitMc: 700},
+				}
+				if pod.Sidecars != want.Sidecars || pod.Total != want.Total || strings.Join(pod.Containers, ",") != "istio-proxy" {
+					t.Errorf("unexpected sidecar usage:\n got %+v\nwant %+v", pod, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCollector_Quotas(t *testing.T) {
+	c := newFixtureCollector(t)
+
+	tests := []struct {
+		name   string
+		opts   config.Options
+		quotas []metrics.QuotaUsage
+	}{
+		{
+			name: "namespace",
+			opts: config.Options{Namespace: "payments", Mode: config.ModeQuota},
+			quotas: []metrics.QuotaUsage{
+				{Namespace: "payments", Quota: "compute", Resource: "requests.memory", Hard: 4096, Used: 3008, Usage: 5145},
+				{Namespace: "payments", Quota: "compute", Resource: "limits.memory", Hard: 6144, Used: 6016, Usage: 5145},
+				{Namespace: "payments", Quota: "compute", Resource: "requests.cpu", Hard: 2000, Used: 1900, Usage: 2162},
+				{Namespace: "payments", Quota: "compute", Resource: "limits.cpu", Hard: 8000, Used: 4100, Usage: 2162},
+			},
+		},
+		{
+			name: "scoped quota",
+			opts: config.Options{AllNamespaces: true, Mode: config.ModeQuota, ExcludeNamespaces: regexp.MustCompile("^payments$")},
+			quotas: []metrics.QuotaUsage{
+				{Namespace: "default", Quota: "long-running", Resource: "limits.memory", Hard: 1024, Used: 64, Usage: 911 + 1232.0/1024, Scoped: true},
+			},
+		},
+		{
+			name: "no quota",
+			opts: config.Options{Namespace: "monitoring", Mode: config.ModeQuota},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quotas, err := c.Quotas(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatalf("Quotas failed: %v", err)
+			}
+			if !reflect.DeepEqual(quotas, tt.quotas) {
+				t.Errorf("unexpected quotas:\n got %+v\nwant %+v", quotas, tt.quotas)
+			}
+		})
+	}
+}
+
+func TestCollector_DisruptionBudgets(t *testing.T) {
+	c := newFixtureCollector(t)
+
+	budgets, err := c.DisruptionBudgets(context.Background(), config.Options{AllNamespaces: true, Mode: config.ModeRecommend})
+	if err != nil {
+		t.Fatalf("DisruptionBudgets failed: %v", err)
+	}
+	if len(budgets) != 2 {
+		t.Fatalf("expected the 2 budgets of the payments namespace, got %+v", budgets)
+	}
+
+	allowed := make(map[string]int32)
+	for _, budget := range budgets {
+		if budget.Namespace != "payments" || !budget.Selector.Matches(labels.Set{"app": "payments-api", "team": "payments"}) {
+			t.Errorf("expected budget %s to select the payments-api pods, got %+v", budget.Name, budget)
+		}
+		allowed[budget.Name] = budget.Allowed
+	}
+	if want := map[string]int32{"payments-api": 0, "payments": 1}; !reflect.DeepEqual(allowed, want) {
+		t.Errorf("expected allowed disruptions %v, got %v", want, allowed)
+	}
+
+	budgets, err = c.DisruptionBudgets(context.Background(), config.Options{Namespace: "monitoring", Mode: config.ModeRecommend})
+	if err != nil {
+		t.Fatalf("DisruptionBudgets failed: %v", err)
+	}
+	if len(budgets) != 0 {
+		t.Errorf("expected no budgets in the monitoring namespace, got %+v", budgets)
+	}
+}
+
+func TestCollector_Plan(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		opts  config.Options
+		paths []string
+	}{
+		{
+			name:  "namespace",
+			opts:  config.Options{Namespace: "payments", LabelSelector: "app=payments-api"},
+			paths: []string{"/api/v1/namespaces/payments/pods", "/apis/metrics.k8s.io/v1beta1/namespaces/payments/pods"},
+		},
+		{
+			name:  "all namespaces",
+			opts:  config.Options{AllNamespaces: true},
+			paths: []string{"/api/v1/pods", "/apis/metrics.k8s.io/v1beta1/pods"},
+		},
+		{
+			name:  "excluded namespaces",
+			opts:  config.Options{AllNamespaces: true, ExcludeNamespaces: regexp.MustCompile("^kube-system$")},
+			paths: []string{"/api/v1/namespaces", "/api/v1/namespaces/{namespace}/pods", "/apis/metrics.k8s.io/v1beta1/namespaces/{namespace}/pods"},
+		},
+		{
+			name:  "limit ranges",
+			opts:  config.Options{Namespace: "team-a", LimitRanges: true},
+			paths: []string{"/api/v1/namespaces/team-a/pods", "/apis/metrics.k8s.io/v1beta1/namespaces/team-a/pods", "/api/v1/namespaces/team-a/limitranges"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, metricsClient, err := fake.NewClients(fixture)
+			if err != nil {
+				t.Fatalf("failed to create clients: %v", err)
+			}
+			tt.opts.Mode, tt.opts.Resource = config.ModePods, config.ResourceMemory
+
+			plan := collector.New(core, metricsClient).WithPageSize(250).Plan(tt.opts)
+			var paths []string
+			for _, request := range plan {
+				paths = append(paths, request.Path)
+				if strings.HasSuffix(request.Path, "/pods") && !strings.Contains(request.Params, "limit=250") {
+					t.Errorf("expected %s to be paged by 250, got %q", request.Path, request.Params)
+				}
+				if tt.opts.LabelSelector != "" && strings.HasSuffix(request.Path, "/pods") && !strings.Contains(request.Params, "labelSelector="+tt.opts.LabelSelector) {
+					t.Errorf("expected %s to select %q, got %q", request.Path, tt.opts.LabelSelector, request.Params)
+				}
+			}
+			if strings.Join(paths, ",") != strings.Join(tt.paths, ",") {
+				t.Errorf("expected requests %v, got %v", tt.paths, paths)
+			}
+
+			// Planning issues no requests
+			if actions := core.(*k8sfake.Clientset).Actions(); len(actions) > 0 {
+				t.Errorf("expected no API calls, got %d", len(actions))
+			}
+		})
+	}
+}
+
+func TestCollector_IncludeNoLimit(t *testing.T) {
+	c := newFixtureCollector(t)
+
+	for _, mode := range []config.Mode{config.ModePods, config.ModeContainers} {
+		opts := config.Options{AllNamespaces: true, Mode: mode, Resource: config.ResourceMemory}
+		limited, err := c.Collect(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("Collect failed: %v", err)
+		}
+		opts.IncludeNoLimit = true
+		rows, err := c.Collect(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("Collect failed: %v", err)
+		}
+		if len(rows) <= len(limited) {
+			t.Fatalf("%s: expected rows without limits to be added to %d rows, got %d", mode, len(limited), len(rows))
+		}
+
+		unlimited := 0
+		for _, row := range rows {
+			if row.HasLimit() {
+				continue
+			}
+			unlimited++
+			if row.Percentage != 0 || row.UsageMi <= 0 {
+				t.Errorf("%s: expected %s/%s to have usage and no percentage, got usage=%v pct=%v", mode, row.Namespace, row.Name, row.UsageMi, row.Percentage)
+			}
+		}
+		if unlimited != len(rows)-len(limited) {
+			t.Errorf("%s: expected %d rows without a limit, got %d", mode, len(rows)-len(limited), unlimited)
+		}
+	}
+
+	opts := config.Options{AllNamespaces: true, Mode: config.ModePods, Resource: config.ResourceMemory, IncludeNoLimit: true}
+	rows, err := c.Collect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if _, found := rowsByName(rows)["default/batch-worker-5b6c7d8e9-k7j2m"]; !found {
+		t.Error("expected the pod without limits to be listed")
+	}
+}
+
+func TestCollector_ResourceAll(t *testing.T) {
+	c := newFixtureCollector(t)
+
+	for _, mode := range []config.Mode{config.ModePods, config.ModeContainers} {
+		byResource := make(map[config.ResourceKind]map[string]metrics.Row)
+		for _, resource := range []config.ResourceKind{config.ResourceMemory, config.ResourceCPU} {
+			rows, err := c.Collect(context.Background(), config.Options{AllNamespaces: true, Mode: mode, Resource: resource})
+			if err != nil {
+				t.Fatalf("Collect failed: %v", err)
+			}
+			byResource[resource] = rowsByName(rows)
+		}
+
+		rows, err := c.Collect(context.Background(), config.Options{AllNamespaces: true, Mode: mode, Resource: config.ResourceAll})
+		if err != nil {
+			t.Fatalf("Collect failed: %v", err)
+		}
+		combined := rowsByName(rows)
+
+		for key, memory := range byResource[config.ResourceMemory] {
+			row, ok := combined[key]
+			if !ok {
+				t.Errorf("%s: expected %s with a memory limit in the combined rows", mode, key)
+				continue
+			}
+			if row.Resource != config.ResourceAll || row.UsageMi != memory.UsageMi || row.LimitMi != memory.LimitMi {
+				t.Errorf("%s: expected the memory usage of %s, got %+v", mode, key, row)
+			}
+			if row.Percentage < memory.Percentage {
+				t.Errorf("%s: expected %s to be ranked by at least its memory percentage %.1f, got %.1f", mode, key, memory.Percentage, row.Percentage)
+			}
+		}
+		for key, cpu := range byResource[config.ResourceCPU] {
+			row, ok := combined[key]
+			if !ok {
+				t.Errorf("%s: expected %s with a cpu limit in the combined rows", mode, key)
+				continue
+			}
+			if row.UsageMc != cpu.UsageMc || row.LimitMc != cpu.LimitMc || row.Percentage < cpu.Percentage {
+				t.Errorf("%s: expected the cpu usage of %s, got %+v", mode, key, row)
+			}
+		}
+	}
+}
+
+func TestCollector_LimitRanges(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+	core, metricsClient, err := fake.NewClients(fixture)
+	if err != nil {
+		t.Fatalf("failed to create clients: %v", err)
+	}
+	limitRange := &corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{Name: "defaults", Namespace: "default"},
+		Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+			Type:    corev1.LimitTypeContainer,
+			Default: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi"), corev1.ResourceCPU: resource.MustParse("1")},
+		}}},
+	}
+	if _, err := core.CoreV1().LimitRanges("default").Create(context.Background(), limitRange, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to seed limit range: %v", err)
+	}
+	c := collector.New(core, metricsClient)
+
+	opts := config.Options{Namespace: "default", Mode: config.ModeContainers, Resource: config.ResourceAll}
+	rows, err := c.Collect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := rowsByName(rows)["default/batch-worker-5b6c7d8e9-k7j2m:worker"]; ok {
+		t.Error("expected the container without limits to be skipped without --limit-ranges")
+	}
+
+	opts.LimitRanges = true
+	rows, err = c.Collect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	worker, ok := rowsByName(rows)["default/batch-worker-5b6c7d8e9-k7j2m:worker"]
+	if !ok {
+		t.Fatalf("expected a row for the container with default limits, got %+v", rows)
+	}
+	if worker.LimitMi != 1024 || worker.LimitMc != 1000 || !worker.DefaultMemoryLimit || !worker.DefaultCPULimit {
+		t.Errorf("expected the default limits of the LimitRange, got %+v", worker)
+	}
+	if worker.Percentage != 911.0/1024*100 {
+		t.Errorf("expected the percentage of the default memory limit, got %v", worker.Percentage)
+	}
+	if shell := rowsByName(rows)["default/debug-shell:shell"]; shell.LimitMi != 64 || shell.DefaultMemoryLimit {
+		t.Errorf("expected the own limit of a limited container, got %+v", shell)
+	}
+}
+
+// fakeMetricsSource reports the pod metrics of the fixture with a pause
+// container added to every pod, as some runtimes do.
+type fakeMetricsSource struct {
+	fixture *fake.Fixture
+}
+
+func (f fakeMetricsSource) PodMetrics(_ context.Context, _ config.Options) ([]metrics.PodMetrics, error) {
+	var result []metrics.PodMetrics
+	for _, item := range f.fixture.Metrics.Items {
+		pm := metrics.PodMetrics{ObjectMeta: item.ObjectMeta, Timestamp: item.Timestamp, Window: item.Window}
+		for _, container := range item.Containers {
+			pm.Containers = append(pm.Containers, metrics.NewContainerMetrics(container.Name, container.Usage))
+		}
+		pm.Containers = append(pm.Containers, metrics.ContainerMetrics{Name: "pause", MemoryBytes: 512 * 1024, CPUMillicores: 1})
+		result = append(result, pm)
+	}
+	return result, nil
+}
+
+func TestCollector_InfrastructureContainers(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+	for i := range fixture.Metrics.Items {
+		item := &fixture.Metrics.Items[i]
+		item.Containers = append(item.Containers, metricsv1beta1.ContainerMetrics{
+			Name:  "POD",
+			Usage: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Mi"), corev1.ResourceCPU: resource.MustParse("1m")},
+		})
+	}
+
+	api, err := fake.NewCollector(fixture)
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+	source, err := fake.NewCollector(fixture)
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+	source.WithMetricsSource(fakeMetricsSource{fixture: fixture})
+
+	for name, c := range map[string]*collector.Collector{"metrics api": api, "metrics source": source} {
+		t.Run(name, func(t *testing.T) {
+			containers, err := c.Collect(context.Background(), config.Options{Namespace: "payments", Mode: config.ModeContainers, Resource: config.ResourceAll, IncludeNoLimit: true})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, row := range containers {
+				if strings.HasSuffix(row.Name, ":POD") || strings.HasSuffix(row.Name, ":pause") {
+					t.Errorf("expected no infrastructure container rows, got %s", row.Name)
+				}
+			}
+			if len(containers) != 7 {
+				t.Errorf("expected 7 containers, got %d", len(containers))
+			}
+
+			pods, err := c.Collect(context.Background(), config.Options{Namespace: "payments", Mode: config.ModePods, Resource: config.ResourceCPU, IncludeNoLimit: true})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if db := rowsByName(pods)["payments/payments-db-0"]; db.UsageMc != 1204 {
+				t.Errorf("expected the pod usage without the pause container, got %dm", db.UsageMc)
+			}
+		})
+	}
+}
+
+func TestCollector_UnmatchedMetrics(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+	for i := range fixture.Pods.Items {
+		if pod := &fixture.Pods.Items[i]; pod.Name == "payments-db-0" {
+			pod.Status.Phase = corev1.PodSucceeded
+		}
+	}
+	c, err := fake.NewCollector(fixture)
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+
+	// The fixture records metrics for a pod deleted between the two list
+	// calls; metrics of the completed pod are filtered, not unmatched
+	observer := observability.NewMetrics()
+	opts := config.Options{AllNamespaces: true, Mode: config.ModePods, Resource: config.ResourceMemory}
+	if _, err := c.WithMetrics(observer).Collect(context.Background(), opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	summary := observer.GetSummary()
+	if summary.UnmatchedMetrics != 1 {
+		t.Errorf("expected 1 unmatched pod metric, got %d", summary.UnmatchedMetrics)
+	}
+	if percent := summary.UnmatchedPercent(); percent <= 0 || percent >= 100 {
+		t.Errorf("unexpected unmatched percentage %.1f", percent)
+	}
+}
+
+func TestCollector_SampleFraction(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+	c, err := fake.NewCollector(fixture)
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+
+	collect := func(fraction float64) map[string]metrics.Row {
+		t.Helper()
+		opts := config.Options{AllNamespaces: true, Mode: config.ModeContainers, Resource: config.ResourceMemory, SampleFraction: fraction}
+		rows, err := c.Collect(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return rowsByName(rows)
+	}
+
+	all := collect(0)
+	if full := collect(1); !reflect.DeepEqual(keys(full), keys(all)) {
+		t.Errorf("expected a fraction of 1 to keep every row, got %v of %v", keys(full), keys(all))
+	}
+
+	small, large := collect(0.3), collect(0.7)
+	if len(large) == 0 || len(large) == len(all) {
+		t.Errorf("expected a 0.7 sample to keep some of the %d rows, got %d", len(all), len(large))
+	}
+	for name := range small {
+		if _, ok := large[name]; !ok {
+			t.Errorf("expected %s of the 0.3 sample in the 0.7 sample", name)
+		}
+	}
+	if again := collect(0.7); !reflect.DeepEqual(keys(again), keys(large)) {
+		t.Errorf("expected the same sample on every run, got %v and %v", keys(again), keys(large))
+	}
+}
+
+// keys returns the sorted names of rows.
+func keys(rows map[string]metrics.Row) []string {
+	names := make([]string, 0, len(rows))
+	for name := range rows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCollector_CollectWithWarnings(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+	core, metricsClient := newPagedClients(t, fixture)
+
+	// Every metrics page after the first is unavailable
+	metricsClient.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		if action.(k8stesting.ListActionImpl).GetListOptions().Continue != "" {
+			return true, nil, apierrors.NewServiceUnavailable("metrics-server restarting")
+		}
+		return false, nil, nil
+	})
+
+	c := collector.New(core, metricsClient).WithPageSize(2).WithRetry(fastRetry)
+	opts := config.Options{AllNamespaces: true, Mode: config.ModePods, Resource: config.ResourceMemory}
+	if _, warnings, err := c.CollectWithWarnings(context.Background(), opts); err != nil {
+		t.Fatalf("expected partial results, got error: %v", err)
+	} else if len(warnings) != 1 || warnings[0].Kind != metrics.WarningPartialPages || warnings[0].Endpoint != collector.EndpointPodMetrics {
+		t.Errorf("expected an abandoned pod metrics page, got %+v", warnings)
+	}
+
+	// The fixture holds metrics of a pod missing from the pod list
+	c, err = fake.NewCollector(fixture)
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+	_, warnings, err := c.CollectWithWarnings(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Kind != metrics.WarningUnmatchedMetrics || warnings[0].Count != 1 {
+		t.Errorf("expected one unmatched pod metric, got %+v", warnings)
+	}
+}
+
+func TestCollector_CollectWithWarnings_StaleMetrics(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+	// metrics-server stopped scraping the node of the first pod five minutes ago
+	stale := &fixture.Metrics.Items[0]
+	stale.Timestamp = metav1.NewTime(stale.Timestamp.Add(-5 * time.Minute))
+
+	c, err := fake.NewCollector(fixture)
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+	opts := config.Options{AllNamespaces: true, Mode: config.ModePods, Resource: config.ResourceMemory}
+	_, warnings, err := c.CollectWithWarnings(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var found bool
+	for _, w := range warnings {
+		if w.Kind == metrics.WarningStaleMetrics {
+			found = true
+			if w.Count != 1 {
+				t.Errorf("expected one stale pod metric, got %+v", w)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected a stale metrics warning, got %+v", warnings)
+	}
+
+	// Warnings are only recorded for the collection that asked for them
+	if _, err := c.Collect(context.Background(), opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, warnings, _ := c.CollectWithWarnings(context.Background(), opts); len(warnings) != 2 {
+		t.Errorf("expected the warnings of one collection, got %+v", warnings)
+	}
+}
@@ -0,0 +1,53 @@
+// Package collector - pod disruption budgets
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// DisruptionBudgets returns the PodDisruptionBudgets of the namespaces in
+// scope with the disruptions they currently allow. Budgets with an invalid
+// selector select no pods and are left out.
+func (c *Collector) DisruptionBudgets(ctx context.Context, opts config.Options) ([]metrics.DisruptionBudget, error) {
+	opts, err := c.resolveNamespaces(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pdbs, err := listAcross(ctx, targetNamespaces(opts), func(ctx context.Context, namespace string) ([]policyv1.PodDisruptionBudget, error) {
+		start := time.Now()
+		list, err := c.coreClient.PolicyV1().PodDisruptionBudgets(namespace).List(ctx, metav1.ListOptions{})
+		c.recordAPICall(start, err, "list pod disruption budgets")
+		if err != nil {
+			return nil, err
+		}
+		return list.Items, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pod disruption budgets: %w", err)
+	}
+
+	budgets := make([]metrics.DisruptionBudget, 0, len(pdbs))
+	for i := range pdbs {
+		pdb := &pdbs[i]
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			continue
+		}
+		budgets = append(budgets, metrics.DisruptionBudget{
+			Namespace: pdb.Namespace,
+			Name:      pdb.Name,
+			Selector:  selector,
+			Allowed:   pdb.Status.DisruptionsAllowed,
+		})
+	}
+	return budgets, nil
+}
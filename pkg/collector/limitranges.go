@@ -0,0 +1,85 @@
+// Package collector - LimitRange default limits
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// limitDefaults are the default container limits of the LimitRanges of
+// every namespace that has one. A nil limitDefaults applies no defaults.
+type limitDefaults map[string]metrics.LimitDefaults
+
+// podInfo returns the spec info of pod with the default limits of its
+// namespace given to its containers without a limit.
+func (d limitDefaults) podInfo(pod *corev1.Pod) *metrics.PodSpecInfo {
+	info := metrics.NewPodSpecInfo(pod)
+	if defaults, ok := d[pod.Namespace]; ok {
+		info.ApplyLimitDefaults(defaults)
+	}
+	return info
+}
+
+// fetchLimitDefaults reads the default container limits of the LimitRanges in
+// the namespaces in scope with opts.LimitRanges. LimitRanges are only listed
+// when a pod has a container without a memory or CPU limit. When several
+// LimitRanges of a namespace set a default, the first one by name applies.
+func (c *Collector) fetchLimitDefaults(ctx context.Context, pods []corev1.Pod, opts config.Options) (limitDefaults, error) {
+	if !opts.LimitRanges || !missingLimits(pods) {
+		return nil, nil
+	}
+
+	ranges, err := listAcross(ctx, targetNamespaces(opts), func(ctx context.Context, namespace string) ([]corev1.LimitRange, error) {
+		start := time.Now()
+		list, err := c.coreClient.CoreV1().LimitRanges(namespace).List(ctx, metav1.ListOptions{})
+		c.recordAPICall(start, err, "list limit ranges")
+		if err != nil {
+			return nil, err
+		}
+		return list.Items, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list limit ranges: %w", err)
+	}
+
+	defaults := make(limitDefaults)
+	for _, limitRange := range ranges {
+		for _, item := range limitRange.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			d := defaults[limitRange.Namespace]
+			if d.MemoryMi == 0 {
+				d.MemoryMi = quantity(item.Default, config.ResourceMemory)
+			}
+			if d.CPUMc == 0 {
+				d.CPUMc = int64(quantity(item.Default, config.ResourceCPU))
+			}
+			defaults[limitRange.Namespace] = d
+		}
+	}
+	return defaults, nil
+}
+
+// missingLimits returns true if a container of any pod lacks a memory or CPU limit.
+func missingLimits(pods []corev1.Pod) bool {
+	for i := range pods {
+		for _, container := range pods[i].Spec.Containers {
+			limits := container.Resources.Limits
+			if _, ok := limits[corev1.ResourceMemory]; !ok {
+				return true
+			}
+			if _, ok := limits[corev1.ResourceCPU]; !ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+// Package collector - memory budget watermarks for streaming collection
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrMemoryBudgetExceeded is returned when a memory hook aborts collection.
+var ErrMemoryBudgetExceeded = errors.New("memory budget exceeded")
+
+// DefaultMemoryWatermarks are the fractions of the memory budget at which the
+// memory hook fires when no explicit watermarks are configured.
+var DefaultMemoryWatermarks = []float64{0.7, 0.9}
+
+// heapObjectsMetric is the runtime metric sampled to determine heap usage
+const heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+
+// MemoryEvent describes a crossing of a memory watermark.
+type MemoryEvent struct {
+	// Watermark is the fraction of the budget that was crossed
+	Watermark float64
+	// UsedBytes is the heap usage at the time of the check
+	UsedBytes uint64
+	// BudgetBytes is the memory budget derived from MaxMemoryMB
+	BudgetBytes uint64
+	// PageSize is the page size in effect when the watermark was crossed
+	PageSize int64
+}
+
+// MemoryAction tells the streaming collector how to react to a memory event.
+type MemoryAction int
+
+const (
+	// MemoryContinue keeps collecting without changes
+	MemoryContinue MemoryAction = iota
+	// MemoryReducePageSize halves the page size of subsequent list calls
+	MemoryReducePageSize
+	// MemoryAbort stops collection with ErrMemoryBudgetExceeded
+	MemoryAbort
+)
+
+// MemoryHook is called when heap usage crosses a watermark. Each watermark fires
+// once per upward crossing and re-arms when usage drops back below it. Hooks are
+// called from collection goroutines and must be safe for concurrent use.
+type MemoryHook func(event MemoryEvent) MemoryAction
+
+// WithMemoryHook registers a hook that fires when heap usage crosses the given
+// fractions of opts.MaxMemoryMB (DefaultMemoryWatermarks when none are given).
+// Usage is checked after every fetched page.
+func (c *StreamingCollector) WithMemoryHook(hook MemoryHook, watermarks ...float64) *StreamingCollector {
+	if len(watermarks) == 0 {
+		watermarks = DefaultMemoryWatermarks
+	}
+	c.memoryHook = hook
+	c.memoryWatermarks = append([]float64(nil), watermarks...)
+	sort.Float64s(c.memoryWatermarks)
+	return c
+}
+
+// memoryMonitor tracks watermark state and the effective page size of a single
+// streaming run.
+type memoryMonitor struct {
+	hook       MemoryHook
+	budget     uint64
+	watermarks []float64
+	read       func() uint64
+	pageSize   atomic.Int64
+
+	mutex sync.Mutex
+	armed []bool
+}
+
+// newMemoryMonitor returns a monitor for one run, or nil when no hook is configured.
+func (c *StreamingCollector) newMemoryMonitor(maxMemoryMB int64) *memoryMonitor {
+	if c.memoryHook == nil || maxMemoryMB <= 0 {
+		return nil
+	}
+
+	m := &memoryMonitor{
+		hook:       c.memoryHook,
+		budget:     uint64(maxMemoryMB) * 1024 * 1024, // #nosec G115 - positive, bounded by Options.Validate
+		watermarks: c.memoryWatermarks,
+		read:       readHeapBytes,
+		armed:      make([]bool, len(c.memoryWatermarks)),
+	}
+	for i := range m.armed {
+		m.armed[i] = true
+	}
+	m.pageSize.Store(c.pageSize)
+	return m
+}
+
+// PageSize returns the page size to use for the next list call.
+func (m *memoryMonitor) PageSize() int64 {
+	return m.pageSize.Load()
+}
+
+// checkPage checks heap usage after a page has been fetched. It is a no-op on a
+// nil monitor.
+func (m *memoryMonitor) checkPage() error {
+	if m == nil {
+		return nil
+	}
+	return m.check()
+}
+
+// check samples heap usage and invokes the hook for every newly crossed watermark.
+// It returns ErrMemoryBudgetExceeded when the hook requests an abort.
+func (m *memoryMonitor) check() error {
+	used := m.read()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i, watermark := range m.watermarks {
+		threshold := uint64(watermark * float64(m.budget))
+		if used < threshold {
+			m.armed[i] = true
+			continue
+		}
+		if !m.armed[i] {
+			continue
+		}
+		m.armed[i] = false
+
+		event := MemoryEvent{
+			Watermark:   watermark,
+			UsedBytes:   used,
+			BudgetBytes: m.budget,
+			PageSize:    m.pageSize.Load(),
+		}
+		switch m.hook(event) {
+		case MemoryReducePageSize:
+			if size := event.PageSize / 2; size > 0 {
+				m.pageSize.Store(size)
+			}
+		case MemoryAbort:
+			return fmt.Errorf("%w: heap %d bytes crossed %.0f%% of %d byte budget",
+				ErrMemoryBudgetExceeded, used, watermark*100, m.budget)
+		}
+	}
+
+	return nil
+}
+
+// readHeapBytes returns the bytes occupied by heap objects, including
+// unswept garbage, without stopping the world.
+func readHeapBytes() uint64 {
+	sample := []metrics.Sample{{Name: heapObjectsMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMemoryMonitor_Check(t *testing.T) {
+	const budgetMB = 100
+
+	var (
+		used   uint64
+		events []MemoryEvent
+		action = MemoryContinue
+	)
+
+	c := NewStreamingCollector(nil, nil).WithMemoryHook(func(e MemoryEvent) MemoryAction {
+		events = append(events, e)
+		return action
+	}, 0.9, 0.7)
+	c.WithPageSize(400)
+
+	m := c.newMemoryMonitor(budgetMB)
+	m.read = func() uint64 { return used }
+	mb := func(n uint64) uint64 { return n * 1024 * 1024 }
+
+	steps := []struct {
+		name     string
+		used     uint64
+		action   MemoryAction
+		fired    []float64
+		pageSize int64
+		wantErr  bool
+	}{
+		{name: "below watermarks", used: mb(50), pageSize: 400},
+		{name: "cross low", used: mb(75), action: MemoryReducePageSize, fired: []float64{0.7}, pageSize: 200},
+		{name: "stay above low", used: mb(80), pageSize: 200},
+		{name: "drop below low", used: mb(60), pageSize: 200},
+		{name: "cross both", used: mb(95), fired: []float64{0.7, 0.9}, pageSize: 200},
+		{name: "drop below both", used: mb(50)},
+		{name: "abort", used: mb(92), action: MemoryAbort, fired: []float64{0.7}, pageSize: 200, wantErr: true},
+	}
+
+	for _, step := range steps {
+		used, action, events = step.used, step.action, nil
+
+		err := m.checkPage()
+		if step.wantErr != (err != nil) {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if err != nil && !errors.Is(err, ErrMemoryBudgetExceeded) {
+			t.Fatalf("%s: expected ErrMemoryBudgetExceeded, got %v", step.name, err)
+		}
+		if len(events) != len(step.fired) {
+			t.Fatalf("%s: expected %d events, got %d", step.name, len(step.fired), len(events))
+		}
+		for i, e := range events {
+			if e.Watermark != step.fired[i] || e.UsedBytes != step.used || e.BudgetBytes != mb(budgetMB) {
+				t.Errorf("%s: unexpected event %+v", step.name, e)
+			}
+		}
+		if step.pageSize != 0 && m.PageSize() != step.pageSize {
+			t.Errorf("%s: expected page size %d, got %d", step.name, step.pageSize, m.PageSize())
+		}
+	}
+}
+
+func TestMemoryMonitor_Disabled(t *testing.T) {
+	c := NewStreamingCollector(nil, nil)
+	if m := c.newMemoryMonitor(100); m != nil {
+		t.Error("expected no monitor without a hook")
+	}
+
+	c.WithMemoryHook(func(MemoryEvent) MemoryAction { return MemoryAbort })
+	if m := c.newMemoryMonitor(0); m != nil {
+		t.Error("expected no monitor without a memory budget")
+	}
+
+	var m *memoryMonitor
+	if err := m.checkPage(); err != nil {
+		t.Errorf("expected nil monitor to be a no-op, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+// Package collector - namespace metadata lookups
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// NamespaceAttributes returns the value of key for every namespace in scope,
+// read from the namespace labels or, when no such label exists, its annotations.
+// Namespaces without the key are omitted. With a single target namespace only
+// that namespace is read, which requires get rather than list permission.
+func (c *Collector) NamespaceAttributes(ctx context.Context, opts config.Options, key string) (map[string]string, error) {
+	var namespaces []corev1.Namespace
+
+	if opts.AllNamespaces {
+		start := time.Now()
+		list, err := c.coreClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		c.recordAPICall(start, err, "list namespaces")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list namespaces: %w", err)
+		}
+		namespaces = list.Items
+	} else {
+		start := time.Now()
+		ns, err := c.coreClient.CoreV1().Namespaces().Get(ctx, opts.Namespace, metav1.GetOptions{})
+		c.recordAPICall(start, err, "get namespace")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get namespace %q: %w", opts.Namespace, err)
+		}
+		namespaces = []corev1.Namespace{*ns}
+	}
+
+	attributes := make(map[string]string, len(namespaces))
+	for _, ns := range namespaces {
+		if value, ok := ns.Labels[key]; ok && value != "" {
+			attributes[ns.Name] = value
+			continue
+		}
+		if value, ok := ns.Annotations[key]; ok && value != "" {
+			attributes[ns.Name] = value
+		}
+	}
+
+	return attributes, nil
+}
+
+// resolveNamespaces matches opts.NamespacePattern and, across all namespaces,
+// opts.ExcludeNamespaces against the namespace list and returns opts scoped to
+// the result. A single remaining namespace narrows the pod list to it;
+// otherwise opts.Namespaces lists the namespaces to query, so pods in excluded
+// namespaces are never fetched.
+func (c *Collector) resolveNamespaces(ctx context.Context, opts config.Options) (config.Options, error) {
+	exclude := opts.AllNamespaces && opts.ExcludeNamespaces != nil
+	if opts.NamespacePattern == "" && !exclude {
+		return opts, nil
+	}
+
+	start := time.Now()
+	list, err := c.coreClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	c.recordAPICall(start, err, "list namespaces")
+	if err != nil {
+		if opts.NamespacePattern == "" {
+			// Exclusion still applies to the pods listed across the cluster
+			slog.Debug("failed to list namespaces, excluding namespaces client-side", "error", err)
+			c.warn(metrics.Warning{
+				Kind:    metrics.WarningNamespacesUnresolved,
+				Message: fmt.Sprintf("failed to list namespaces, pods of namespaces excluded by --nx were listed and skipped: %v", err),
+			})
+			return opts, nil
+		}
+		return opts, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	var matched []string
+	for _, ns := range list.Items {
+		if opts.NamespacePattern != "" {
+			if ok, _ := path.Match(opts.NamespacePattern, ns.Name); !ok {
+				continue
+			}
+		}
+		if exclude && opts.ExcludeNamespaces.MatchString(ns.Name) {
+			continue
+		}
+		matched = append(matched, ns.Name)
+	}
+	slog.Debug("resolved namespaces", "pattern", opts.NamespacePattern, "exclude", opts.ExcludeNamespaces, "namespaces", matched)
+
+	switch len(matched) {
+	case 0:
+		if opts.NamespacePattern != "" {
+			return opts, fmt.Errorf("no namespaces match -n %q", opts.NamespacePattern)
+		}
+		return opts, fmt.Errorf("no namespaces left after excluding --nx %q", opts.ExcludeNamespaces)
+	case 1:
+		opts.Namespace = matched[0]
+		opts.AllNamespaces = false
+	default:
+		opts.AllNamespaces = true
+		opts.Namespaces = matched
+	}
+	return opts, nil
+}
+
+// targetNamespaces returns the namespaces to list, where "" lists across the cluster.
+func targetNamespaces(opts config.Options) []string {
+	if !opts.AllNamespaces {
+		return []string{opts.Namespace}
+	}
+	if len(opts.Namespaces) > 0 {
+		return opts.Namespaces
+	}
+	return []string{""}
+}
@@ -0,0 +1,195 @@
+// Package collector - node-pool capacity aggregation
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// UnpooledNodes is the pool of nodes without the pool label
+const UnpooledNodes = "<none>"
+
+// NodePools groups every node by the value of opts.PoolLabel and sums the
+// allocatable capacity of the nodes and the requests, limits and current
+// usage of the pods running on them, for opts.Resource. Pods are counted
+// across all namespaces regardless of the namespace and label filters since
+// every pod on a node consumes its capacity. Pools are ordered by name.
+func (c *Collector) NodePools(ctx context.Context, opts config.Options) ([]metrics.NodePool, error) {
+	nodes, pods, podMetrics, err := c.fetchCluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Index nodes by pool and sum their allocatable capacity
+	pools := make(map[string]*metrics.NodePool)
+	nodePool := make(map[string]*metrics.NodePool, len(nodes))
+	for i := range nodes {
+		node := &nodes[i]
+		name := node.Labels[opts.PoolLabel]
+		if name == "" {
+			name = UnpooledNodes
+		}
+		pool, ok := pools[name]
+		if !ok {
+			pool = &metrics.NodePool{Name: name}
+			pools[name] = pool
+		}
+		pool.Nodes++
+		pool.Allocatable += quantity(node.Status.Allocatable, opts.Resource)
+		nodePool[node.Name] = pool
+	}
+
+	// Sum requests and limits of the pods scheduled to each pool
+	podPool := make(map[string]*metrics.NodePool, len(pods))
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		pool, ok := nodePool[pod.Spec.NodeName]
+		if !ok {
+			continue // not scheduled, or scheduled to a node that no longer exists
+		}
+
+		pool.Pods++
+		pool.Requests += podRequest(pod, opts.Resource)
+		limited := true
+		for _, container := range pod.Spec.Containers {
+			limit := quantity(container.Resources.Limits, opts.Resource)
+			if limit <= 0 {
+				limited = false
+			}
+			pool.Limits += limit
+		}
+		if !limited {
+			pool.Unlimited++
+		}
+		podPool[pod.Namespace+"/"+pod.Name] = pool
+	}
+
+	// Sum the current usage of those pods
+	for _, pm := range podMetrics {
+		pool, ok := podPool[pm.Namespace+"/"+pm.Name]
+		if !ok {
+			continue
+		}
+		for _, container := range pm.Containers {
+			switch opts.Resource {
+			case config.ResourceCPU:
+				pool.Usage += float64(container.CPUMillicores)
+			default:
+				pool.Usage += float64(container.MemoryBytes) / metrics.BytesPerMi
+			}
+		}
+	}
+
+	result := make([]metrics.NodePool, 0, len(pools))
+	for _, pool := range pools {
+		result = append(result, *pool)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// fetchCluster concurrently retrieves all nodes, and the pods and pod metrics of all namespaces.
+func (c *Collector) fetchCluster(ctx context.Context) ([]corev1.Node, []corev1.Pod, []metrics.PodMetrics, error) {
+	var (
+		nodes       []corev1.Node
+		pods        []corev1.Pod
+		podMetrics  []metrics.PodMetrics
+		clusterWide = config.Options{AllNamespaces: true}
+	)
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		start := time.Now()
+		list, err := c.coreClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		c.recordAPICall(start, err, "list nodes")
+		if err != nil {
+			return fmt.Errorf("failed to list nodes: %w", err)
+		}
+		nodes = list.Items
+		return nil
+	})
+	g.Go(func() error {
+		list, err := c.fetchPods(ctx, clusterWide)
+		if err != nil {
+			return fmt.Errorf("failed to fetch pods: %w", err)
+		}
+		pods = list
+		return nil
+	})
+	g.Go(func() error {
+		list, err := c.fetchPodMetrics(ctx, clusterWide)
+		if err != nil {
+			return fmt.Errorf("failed to fetch pod metrics: %w", err)
+		}
+		podMetrics = list
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return nodes, pods, podMetrics, nil
+}
+
+// podRequest returns the request of resource the scheduler accounts for the pod:
+// the sum of its containers, or the largest init container request if higher.
+func podRequest(pod *corev1.Pod, resource config.ResourceKind) float64 {
+	var total float64
+	for _, container := range pod.Spec.Containers {
+		total += quantity(container.Resources.Requests, resource)
+	}
+	for _, container := range pod.Spec.InitContainers {
+		total = max(total, quantity(container.Resources.Requests, resource))
+	}
+	return total
+}
+
+// quantity returns the amount of resource in list, in Mi for memory or millicores for CPU.
+func quantity(list corev1.ResourceList, resource config.ResourceKind) float64 {
+	switch resource {
+	case config.ResourceCPU:
+		if q, ok := list[corev1.ResourceCPU]; ok {
+			return float64(q.MilliValue())
+		}
+	default:
+		if q, ok := list[corev1.ResourceMemory]; ok {
+			return float64(q.Value()) / metrics.BytesPerMi
+		}
+	}
+	return 0
+}
+
+// NodeLabels returns the value of the label key of every node that has it,
+// by node name. Only the nodes with the label are listed.
+func (c *Collector) NodeLabels(ctx context.Context, key string) (map[string]string, error) {
+	start := time.Now()
+	list, err := c.coreClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: key})
+	c.recordAPICall(start, err, "list nodes")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	labels := make(map[string]string, len(list.Items))
+	for _, node := range list.Items {
+		if value := node.Labels[key]; value != "" {
+			labels[node.Name] = value
+		}
+	}
+	return labels, nil
+}
@@ -0,0 +1,85 @@
+// Package collector - node allocation, resource usage and filesystem usage
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// FilesystemSource reads the filesystem usage of nodes, such as the kubelet
+// Summary API.
+type FilesystemSource interface {
+	Filesystems(ctx context.Context, nodes []string) (map[string]metrics.NodeFilesystems, error)
+}
+
+// Nodes returns the allocation of every node, accounting for the requests of
+// all pods on it, with its CPU and memory usage read from the node metrics and
+// the node and image filesystem usage read from source. Nodes are ordered by
+// name. When the node metrics or filesystems cannot be read the nodes are
+// returned without them.
+func (c *Collector) Nodes(ctx context.Context, source FilesystemSource) ([]metrics.NodeUsage, error) {
+	_, allocations, err := c.Scheduling(ctx, config.Options{AllNamespaces: true})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(allocations))
+	for _, allocation := range allocations {
+		names = append(names, allocation.Name)
+	}
+	filesystems, err := source.Filesystems(ctx, names)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to read node filesystems: %w", err)
+		}
+		slog.Warn("reporting nodes without filesystem usage", "error", err)
+	}
+	usage, err := c.nodeUsage(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		slog.Warn("reporting nodes without resource usage", "error", err)
+	}
+
+	nodes := make([]metrics.NodeUsage, 0, len(allocations))
+	for _, allocation := range allocations {
+		nodes = append(nodes, metrics.NodeUsage{
+			NodeAllocation:  allocation,
+			NodeFilesystems: filesystems[allocation.Name],
+			Usage:           usage[allocation.Name],
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	return nodes, nil
+}
+
+// nodeUsage returns the CPU and memory usage of every node the metrics API
+// reports, keyed by node name.
+func (c *Collector) nodeUsage(ctx context.Context) (map[string]*metrics.NodeResourceUsage, error) {
+	start := time.Now()
+	list, err := c.metricsClient.MetricsV1beta1().NodeMetricses().List(ctx, metav1.ListOptions{})
+	c.recordAPICall(start, err, "list node metrics")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list node metrics: %w", err)
+	}
+
+	usage := make(map[string]*metrics.NodeResourceUsage, len(list.Items))
+	for _, item := range list.Items {
+		usage[item.Name] = &metrics.NodeResourceUsage{
+			UsedMc: item.Usage.Cpu().MilliValue(),
+			UsedMi: float64(item.Usage.Memory().Value()) / metrics.BytesPerMi,
+		}
+	}
+	return usage, nil
+}
@@ -2,8 +2,16 @@
 package collector
 
 import (
-	"k8s.io/client-go/kubernetes"
-	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 )
 
 const (
@@ -14,24 +22,111 @@ const (
 	MaxConcurrentPages = 10
 )
 
-// PaginatedCollector implements chunked data collection for large-scale clusters
-type PaginatedCollector struct {
-	coreClient    *kubernetes.Clientset
-	metricsClient *metricsv.Clientset
-	pageSize      int64
+// WithPageSize sets the number of items fetched per list call. A non-positive
+// size keeps the current one.
+func (c *Collector) WithPageSize(size int64) *Collector {
+	if size > 0 {
+		c.pageSize = size
+	}
+	return c
 }
 
-// NewPaginatedCollector creates a collector optimized for large clusters
-func NewPaginatedCollector(coreClient *kubernetes.Clientset, metricsClient *metricsv.Clientset) *PaginatedCollector {
-	return &PaginatedCollector{
-		coreClient:    coreClient,
-		metricsClient: metricsClient,
-		pageSize:      DefaultPageSize,
+// listAcross runs list for every namespace, up to MaxConcurrentPages at a
+// time, and concatenates the results in namespace order.
+func listAcross[T any](ctx context.Context, namespaces []string, list func(ctx context.Context, namespace string) ([]T, error)) ([]T, error) {
+	if len(namespaces) == 1 {
+		return list(ctx, namespaces[0])
 	}
+
+	results := make([][]T, len(namespaces))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(MaxConcurrentPages)
+	for i, namespace := range namespaces {
+		g.Go(func() error {
+			items, err := list(ctx, namespace)
+			if err != nil {
+				return fmt.Errorf("namespace %q: %w", namespace, err)
+			}
+			results[i] = items
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return slices.Concat(results...), nil
 }
 
-// WithPageSize sets a custom page size for testing or tuning
-func (c *PaginatedCollector) WithPageSize(size int64) *PaginatedCollector {
-	c.pageSize = size
-	return c
+// listPods lists the pods in namespace page by page, following continue
+// tokens until the last page, so no single call has to return every pod of a
+// large cluster.
+func (c *Collector) listPods(ctx context.Context, namespace, labelSelector string) ([]corev1.Pod, error) {
+	var (
+		pods          []corev1.Pod
+		continueToken string
+	)
+	for {
+		listOptions := metav1.ListOptions{
+			LabelSelector: labelSelector,
+			Limit:         c.pageSize,
+			Continue:      continueToken,
+		}
+
+		start := time.Now()
+		var page *corev1.PodList
+		err := c.call(ctx, EndpointPods, func() (err error) {
+			page, err = c.coreClient.CoreV1().Pods(namespace).List(ctx, listOptions)
+			return err
+		})
+		c.recordPage(start, err, "list pods page")
+		if err != nil {
+			if continueToken != "" && isDegraded(err) {
+				c.abandonPage(EndpointPods, err)
+				return pods, nil
+			}
+			return nil, err
+		}
+
+		pods = append(pods, page.Items...)
+		if page.Continue == "" {
+			return pods, nil
+		}
+		continueToken = page.Continue
+	}
+}
+
+// listPodMetrics lists the pod metrics in namespace page by page, like listPods.
+func (c *Collector) listPodMetrics(ctx context.Context, namespace, labelSelector string) ([]metricsv1beta1.PodMetrics, error) {
+	var (
+		items         []metricsv1beta1.PodMetrics
+		continueToken string
+	)
+	for {
+		listOptions := metav1.ListOptions{
+			LabelSelector: labelSelector,
+			Limit:         c.pageSize,
+			Continue:      continueToken,
+		}
+
+		start := time.Now()
+		var page *metricsv1beta1.PodMetricsList
+		err := c.call(ctx, EndpointPodMetrics, func() (err error) {
+			page, err = c.metricsClient.MetricsV1beta1().PodMetricses(namespace).List(ctx, listOptions)
+			return err
+		})
+		c.recordPage(start, err, "list pod metrics page")
+		if err != nil {
+			if continueToken != "" && isDegraded(err) {
+				c.abandonPage(EndpointPodMetrics, err)
+				return items, nil
+			}
+			return nil, err
+		}
+
+		items = append(items, page.Items...)
+		if page.Continue == "" {
+			return items, nil
+		}
+		continueToken = page.Continue
+	}
 }
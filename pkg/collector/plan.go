@@ -0,0 +1,107 @@
+// Package collector - request planning for dry runs
+package collector
+
+import (
+	"fmt"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// ServerKubernetes names the Kubernetes API server in planned requests
+const ServerKubernetes = "kubernetes"
+
+// Planner is implemented by pod and metrics sources that can describe the
+// requests they would issue for opts without issuing them.
+type Planner interface {
+	Plan(opts config.Options) []metrics.PlannedRequest
+}
+
+// Plan returns the requests Collect would issue for opts, in the order they
+// are issued, without contacting any API. Pods and pod metrics are listed in
+// pages of the configured page size, so they are planned per page. Retries of
+// failed requests are not included.
+func (c *Collector) Plan(opts config.Options) []metrics.PlannedRequest {
+	var plan []metrics.PlannedRequest
+
+	// Namespaces are resolved from the namespace list before any pod is listed
+	namespace, per := opts.Namespace, ""
+	exclude := opts.AllNamespaces && opts.ExcludeNamespaces != nil
+	switch {
+	case opts.NamespacePattern != "" || exclude:
+		plan = append(plan, metrics.PlannedRequest{Server: ServerKubernetes, Method: "GET", Path: "/api/v1/namespaces", Requests: 1})
+		namespace, per = "{namespace}", "namespace"
+		if opts.NamespacePattern != "" {
+			per += fmt.Sprintf(" matching -n %q", opts.NamespacePattern)
+		}
+		if exclude {
+			per += fmt.Sprintf(" not matching --nx %q", opts.ExcludeNamespaces)
+		}
+	case opts.AllNamespaces:
+		namespace = ""
+	}
+
+	params := fmt.Sprintf("limit=%d", c.pageSize)
+	if opts.LabelSelector != "" {
+		params = "labelSelector=" + opts.LabelSelector + "&" + params
+	}
+	page := func(items string) string {
+		if per == "" {
+			return fmt.Sprintf("page of %d %s", c.pageSize, items)
+		}
+		return fmt.Sprintf("page of %d %s per %s", c.pageSize, items, per)
+	}
+
+	if planner, ok := c.podSource.(Planner); ok {
+		plan = append(plan, planner.Plan(opts)...)
+	} else if c.podSource == nil {
+		plan = append(plan, metrics.PlannedRequest{
+			Server:   ServerKubernetes,
+			Method:   "GET",
+			Path:     namespacedPath("/api/v1", namespace, "pods"),
+			Params:   params,
+			Requests: 1,
+			Per:      page("pods"),
+		})
+	}
+
+	if planner, ok := c.metricsSource.(Planner); ok {
+		plan = append(plan, planner.Plan(opts)...)
+	} else if c.metricsSource == nil {
+		plan = append(plan, metrics.PlannedRequest{
+			Server:   ServerKubernetes,
+			Method:   "GET",
+			Path:     namespacedPath("/apis/metrics.k8s.io/v1beta1", namespace, "pods"),
+			Params:   params,
+			Requests: 1,
+			Per:      page("pod metrics"),
+		})
+	}
+
+	// LimitRanges are only listed when a container lacks a limit, which is
+	// not known before the pods are listed
+	if opts.LimitRanges {
+		request := metrics.PlannedRequest{
+			Server:   ServerKubernetes,
+			Method:   "GET",
+			Path:     namespacedPath("/api/v1", namespace, "limitranges"),
+			Requests: 1,
+			Per:      "run with a container without a limit",
+		}
+		if per != "" {
+			request.Per += ", per " + per
+		}
+		plan = append(plan, request)
+	}
+
+	return plan
+}
+
+// namespacedPath returns the path of resource under prefix in namespace, or
+// across the cluster when namespace is empty.
+func namespacedPath(prefix, namespace, resource string) string {
+	if namespace == "" {
+		return prefix + "/" + resource
+	}
+	return prefix + "/namespaces/" + namespace + "/" + resource
+}
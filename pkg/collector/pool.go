@@ -0,0 +1,93 @@
+// Package collector - buffer reuse for hot-path conversions
+package collector
+
+import (
+	"slices"
+	"sync"
+
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// metricsPage holds a page of pod metrics converted to the internal type.
+// The containers of all pods in the page share a single backing array, so a
+// converted page costs at most two allocations, and pages processed by the
+// streaming path are recycled through metricsPagePool.
+type metricsPage struct {
+	items      []metrics.PodMetrics
+	containers []metrics.ContainerMetrics
+}
+
+// metricsPagePool recycles converted metrics pages between list calls
+var metricsPagePool = sync.Pool{
+	New: func() any { return &metricsPage{} },
+}
+
+// rowBufferPool recycles the scratch row slices used while streaming results
+var rowBufferPool = sync.Pool{
+	New: func() any {
+		rows := make([]metrics.Row, 0, 16)
+		return &rows
+	},
+}
+
+// getMetricsPage returns an empty page from the pool.
+func getMetricsPage() *metricsPage {
+	return metricsPagePool.Get().(*metricsPage)
+}
+
+// release clears the page so it does not retain API objects and returns it to the pool.
+// The page and any slices obtained from it must not be used afterwards.
+func (p *metricsPage) release() {
+	clear(p.items)
+	clear(p.containers)
+	p.items = p.items[:0]
+	p.containers = p.containers[:0]
+	metricsPagePool.Put(p)
+}
+
+// convert fills the page from metrics API items and returns the converted pod
+// metrics. Infrastructure containers such as the pause container are dropped.
+func (p *metricsPage) convert(items []metricsv1beta1.PodMetrics) []metrics.PodMetrics {
+	var containerCount int
+	for i := range items {
+		containerCount += len(items[i].Containers)
+	}
+
+	p.items = slices.Grow(p.items[:0], len(items))
+	p.containers = slices.Grow(p.containers[:0], containerCount)
+
+	for i := range items {
+		item := &items[i]
+		start := len(p.containers)
+		for _, container := range item.Containers {
+			if metrics.IsInfrastructureContainer(container.Name) {
+				continue
+			}
+			p.containers = append(p.containers, metrics.NewContainerMetrics(container.Name, container.Usage))
+		}
+
+		p.items = append(p.items, metrics.PodMetrics{
+			TypeMeta:   item.TypeMeta,
+			ObjectMeta: item.ObjectMeta,
+			Timestamp:  item.Timestamp,
+			Window:     item.Window,
+			Containers: p.containers[start:len(p.containers):len(p.containers)],
+		})
+	}
+
+	return p.items
+}
+
+// getRowBuffer returns an empty row slice from the pool.
+func getRowBuffer() *[]metrics.Row {
+	return rowBufferPool.Get().(*[]metrics.Row)
+}
+
+// putRowBuffer clears the row slice and returns it to the pool.
+func putRowBuffer(rows *[]metrics.Row) {
+	clear(*rows)
+	*rows = (*rows)[:0]
+	rowBufferPool.Put(rows)
+}
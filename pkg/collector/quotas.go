@@ -0,0 +1,147 @@
+// Package collector - resource quota usage
+package collector
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// quotaResources are the compute resources of a ResourceQuota reported, in
+// report order; cpu and memory are the legacy names of the request quotas.
+var quotaResources = []corev1.ResourceName{
+	corev1.ResourceRequestsMemory,
+	corev1.ResourceMemory,
+	corev1.ResourceLimitsMemory,
+	corev1.ResourceRequestsCPU,
+	corev1.ResourceCPU,
+	corev1.ResourceLimitsCPU,
+}
+
+// Quotas returns the compute resources of every ResourceQuota in the
+// namespaces in scope, with the amount the quota reports as used and the
+// summed usage of the running pods of its namespace. Pods are only read when
+// at least one quota limits memory or CPU.
+func (c *Collector) Quotas(ctx context.Context, opts config.Options) ([]metrics.QuotaUsage, error) {
+	opts, err := c.resolveNamespaces(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	quotas, err := listAcross(ctx, targetNamespaces(opts), func(ctx context.Context, namespace string) ([]corev1.ResourceQuota, error) {
+		start := time.Now()
+		list, err := c.coreClient.CoreV1().ResourceQuotas(namespace).List(ctx, metav1.ListOptions{})
+		c.recordAPICall(start, err, "list resource quotas")
+		if err != nil {
+			return nil, err
+		}
+		return list.Items, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resource quotas: %w", err)
+	}
+
+	var result []metrics.QuotaUsage
+	for i := range quotas {
+		quota := &quotas[i]
+		if !quotaInScope(quota.Namespace, opts) {
+			continue
+		}
+		scoped := len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil
+		for _, name := range quotaResources {
+			hard, ok := quota.Status.Hard[name]
+			if !ok {
+				// The quota controller has not reconciled the quota yet
+				if hard, ok = quota.Spec.Hard[name]; !ok {
+					continue
+				}
+			}
+			used := quota.Status.Used[name]
+			result = append(result, metrics.QuotaUsage{
+				Namespace: quota.Namespace,
+				Quota:     quota.Name,
+				Resource:  string(name),
+				Hard:      quotaValue(name, hard),
+				Used:      quotaValue(name, used),
+				Scoped:    scoped,
+			})
+		}
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+
+	usage, err := c.namespaceUsage(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range result {
+		q := &result[i]
+		if q.Memory() {
+			q.Usage = usage[q.Namespace].MemoryMi
+		} else {
+			q.Usage = float64(usage[q.Namespace].CPUMc)
+		}
+	}
+
+	return result, nil
+}
+
+// namespaceUsage sums the memory and CPU usage of the listed pods of every
+// namespace in scope. Metrics of pods missing from the pod list are ignored.
+func (c *Collector) namespaceUsage(ctx context.Context, opts config.Options) (map[string]metrics.ResourceTotals, error) {
+	pods, podMetrics, err := c.fetch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := make(map[string]bool, len(pods))
+	for i := range pods {
+		listed[pods[i].Namespace+"/"+pods[i].Name] = true
+	}
+
+	usage := make(map[string]metrics.ResourceTotals)
+	for _, pm := range podMetrics {
+		if !listed[pm.Namespace+"/"+pm.Name] {
+			continue
+		}
+		totals := usage[pm.Namespace]
+		for _, container := range pm.Containers {
+			totals.MemoryMi += float64(container.MemoryBytes) / metrics.BytesPerMi
+			totals.CPUMc += container.CPUMillicores
+		}
+		usage[pm.Namespace] = totals
+	}
+	return usage, nil
+}
+
+// quotaInScope returns true if the namespace matches opts.NamespacePattern
+// and, across all namespaces, is not excluded by opts.ExcludeNamespaces. The
+// quotas of a cluster-wide list are filtered here when the namespaces could
+// not be resolved upfront.
+func quotaInScope(namespace string, opts config.Options) bool {
+	if opts.NamespacePattern != "" {
+		if ok, _ := path.Match(opts.NamespacePattern, namespace); !ok {
+			return false
+		}
+	}
+	return opts.ExcludeNamespaces == nil || !opts.ExcludeNamespaces.MatchString(namespace)
+}
+
+// quotaValue returns a memory quantity in Mi or a CPU quantity in millicores.
+func quotaValue(name corev1.ResourceName, q resource.Quantity) float64 {
+	switch name {
+	case corev1.ResourceRequestsCPU, corev1.ResourceCPU, corev1.ResourceLimitsCPU:
+		return float64(q.MilliValue())
+	default:
+		return float64(q.Value()) / metrics.BytesPerMi
+	}
+}
@@ -0,0 +1,97 @@
+// Package collector - retries and circuit breaking of API list calls
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/resilience"
+)
+
+const (
+	// EndpointPods and EndpointPodMetrics name the endpoints in the
+	// reliability summary
+	EndpointPods       = "pods"
+	EndpointPodMetrics = "pod metrics"
+
+	// breakerMaxFailures consecutive failed attempts open an endpoint's breaker
+	breakerMaxFailures = 5
+
+	// breakerTimeout is how long an open breaker rejects calls
+	breakerTimeout = 30 * time.Second
+)
+
+// newBreakers returns one circuit breaker per listed endpoint.
+func newBreakers() map[string]*resilience.CircuitBreaker {
+	return map[string]*resilience.CircuitBreaker{
+		EndpointPods:       resilience.NewCircuitBreaker(EndpointPods, breakerMaxFailures, breakerTimeout),
+		EndpointPodMetrics: resilience.NewCircuitBreaker(EndpointPodMetrics, breakerMaxFailures, breakerTimeout),
+	}
+}
+
+// isTransient reports whether err is an API error worth retrying: timeouts,
+// throttling and server-side failures. Everything else, such as a forbidden
+// list or a missing metrics API, fails immediately.
+func isTransient(err error) bool {
+	return apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsInternalError(err) ||
+		apierrors.IsUnexpectedServerError(err)
+}
+
+// isDegraded reports whether err left an endpoint unusable for the rest of
+// the run: transient failures that outlasted the retries, or an open breaker.
+func isDegraded(err error) bool {
+	return isTransient(err) || errors.Is(err, resilience.ErrOpen)
+}
+
+// call runs a list call against endpoint, retrying transient failures with
+// backoff behind the endpoint's circuit breaker. Retries and breaker trips
+// are recorded into the observer.
+func (c *Collector) call(ctx context.Context, endpoint string, fn func() error) error {
+	retry := c.retry
+	retry.Retryable = isTransient
+	retry.OnRetry = func(attempt int, err error) {
+		slog.Debug("retrying list call", "endpoint", endpoint, "attempt", attempt, "error", err)
+		if c.observer != nil {
+			c.observer.RecordRetry(endpoint)
+		}
+	}
+
+	breaker := c.breakers[endpoint]
+	if breaker == nil {
+		return resilience.ExecuteWithRetry(ctx, retry, fn)
+	}
+	return resilience.ExecuteWithRetry(ctx, retry, func() error {
+		return breaker.Execute(ctx, fn)
+	})
+}
+
+// abandonPage gives up on the remaining pages of endpoint after a page failed
+// past its retries, keeping the items listed so far. The first page is never
+// abandoned, so a run that could not read anything still fails.
+func (c *Collector) abandonPage(endpoint string, err error) {
+	slog.Warn("abandoning remaining pages, results will be incomplete", "endpoint", endpoint, "error", err)
+	c.warn(metrics.Warning{
+		Kind:     metrics.WarningPartialPages,
+		Endpoint: endpoint,
+		Message:  fmt.Sprintf("remaining pages of %s abandoned, results are incomplete: %v", endpoint, err),
+	})
+	if c.observer != nil {
+		c.observer.RecordAbandonedPage(endpoint)
+	}
+}
+
+// WithRetry sets the retry backoff of list calls, e.g. to shorten it in tests.
+func (c *Collector) WithRetry(retry resilience.RetryConfig) *Collector {
+	c.retry = retry
+	return c
+}
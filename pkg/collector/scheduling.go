@@ -0,0 +1,134 @@
+// Package collector - scheduling pressure of pending pods
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// Scheduling returns the pods in scope the scheduler marked unschedulable and
+// the allocation of every node. Node allocations account for the requests of
+// all pods on the node, across all namespaces, and how much of those requests
+// exceeds current usage.
+func (c *Collector) Scheduling(ctx context.Context, opts config.Options) ([]metrics.PendingPod, []metrics.NodeAllocation, error) {
+	labelSelector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid label selector %q: %w", opts.LabelSelector, err)
+	}
+
+	opts, err = c.resolveNamespaces(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nodes, pods, podMetrics, err := c.fetchCluster(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	allocations := make([]metrics.NodeAllocation, len(nodes))
+	nodeIndex := make(map[string]*metrics.NodeAllocation, len(nodes))
+	for i := range nodes {
+		allocations[i] = metrics.NodeAllocation{
+			Name:            nodes[i].Name,
+			Unschedulable:   nodes[i].Spec.Unschedulable,
+			Taints:          hardTaints(nodes[i].Spec.Taints),
+			AllocatableMc:   int64(quantity(nodes[i].Status.Allocatable, config.ResourceCPU)),
+			AllocatableMi:   quantity(nodes[i].Status.Allocatable, config.ResourceMemory),
+			AllocatablePods: nodes[i].Status.Allocatable.Pods().Value(),
+		}
+		nodeIndex[nodes[i].Name] = &allocations[i]
+	}
+
+	usage := make(map[string]metrics.PodMetrics, len(podMetrics))
+	for _, pm := range podMetrics {
+		usage[pm.Namespace+"/"+pm.Name] = pm
+	}
+
+	var pending []metrics.PendingPod
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		// Pods bound to a node reserve their requests on it
+		if node, ok := nodeIndex[pod.Spec.NodeName]; ok {
+			requestMc := int64(podRequest(pod, config.ResourceCPU))
+			requestMi := podRequest(pod, config.ResourceMemory)
+			node.Pods++
+			node.RequestedMc += requestMc
+			node.RequestedMi += requestMi
+
+			// Without metrics the requests are not known to be reclaimable
+			if pm, ok := usage[pod.Namespace+"/"+pod.Name]; ok {
+				var usageMc int64
+				var usageBytes int64
+				for _, container := range pm.Containers {
+					usageMc += container.CPUMillicores
+					usageBytes += container.MemoryBytes
+				}
+				node.ReclaimableMc += max(requestMc-usageMc, 0)
+				node.ReclaimableMi += max(requestMi-float64(usageBytes)/metrics.BytesPerMi, 0)
+			}
+			continue
+		}
+
+		if pod.Spec.NodeName != "" || !inScope(pod, opts, labelSelector) {
+			continue
+		}
+		if message, ok := unschedulable(pod); ok {
+			pending = append(pending, metrics.PendingPod{
+				Namespace: pod.Namespace,
+				Name:      pod.Name,
+				Owner:     metrics.ResolveOwner(pod),
+				RequestMc: int64(podRequest(pod, config.ResourceCPU)),
+				RequestMi: podRequest(pod, config.ResourceMemory),
+				Message:   message,
+			})
+		}
+	}
+
+	return pending, allocations, nil
+}
+
+// inScope returns true if the pod is in the target namespaces and passes the exclusion filters.
+func inScope(pod *corev1.Pod, opts config.Options, labelSelector labels.Selector) bool {
+	if !opts.AllNamespaces && opts.Namespace != "" && pod.Namespace != opts.Namespace {
+		return false
+	}
+	stage, _ := filterPod(pod, opts, labelSelector)
+	return stage == ""
+}
+
+// hardTaints returns the NoSchedule and NoExecute taints in key=value:Effect
+// form, as kubectl describes them. The taint of cordoned nodes is left out, as
+// cordoned nodes are reported as unschedulable.
+func hardTaints(taints []corev1.Taint) []string {
+	var hard []string
+	for _, taint := range taints {
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule || taint.Key == corev1.TaintNodeUnschedulable {
+			continue
+		}
+		hard = append(hard, taint.ToString())
+	}
+	return hard
+}
+
+// unschedulable returns the scheduler message of a pod whose PodScheduled
+// condition reports it as unschedulable.
+func unschedulable(pod *corev1.Pod) (string, bool) {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse &&
+			condition.Reason == corev1.PodReasonUnschedulable {
+			return condition.Message, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,112 @@
+// Package collector - sidecar container overhead
+package collector
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// Sidecars returns, for every pod in scope running at least one sidecar, the
+// usage and limits of its sidecars and of the whole pod. Containers are
+// sidecars when their name or image name matches one of opts.SidecarPatterns,
+// or when they are native sidecars (init containers that keep running).
+func (c *Collector) Sidecars(ctx context.Context, opts config.Options) ([]metrics.SidecarUsage, error) {
+	labelSelector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector %q: %w", opts.LabelSelector, err)
+	}
+
+	opts, err = c.resolveNamespaces(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, podMetrics, err := c.fetch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]metrics.PodMetrics, len(podMetrics))
+	for _, pm := range podMetrics {
+		usage[pm.Namespace+"/"+pm.Name] = pm
+	}
+
+	var result []metrics.SidecarUsage
+	for i := range pods {
+		pod := &pods[i]
+		pm, ok := usage[pod.Namespace+"/"+pod.Name]
+		if !ok {
+			continue
+		}
+		if stage, _ := filterPod(pod, opts, labelSelector); stage != "" {
+			continue
+		}
+
+		containers := make(map[string]metrics.ContainerMetrics, len(pm.Containers))
+		for _, container := range pm.Containers {
+			containers[container.Name] = container
+		}
+
+		entry := metrics.SidecarUsage{Namespace: pod.Namespace, Name: pod.Name}
+		add := func(container corev1.Container, sidecar bool) {
+			used := containers[container.Name]
+			totals := metrics.ResourceTotals{
+				MemoryMi:      float64(used.MemoryBytes) / metrics.BytesPerMi,
+				MemoryLimitMi: quantity(container.Resources.Limits, config.ResourceMemory),
+				CPUMc:         used.CPUMillicores,
+				CPULimitMc:    int64(quantity(container.Resources.Limits, config.ResourceCPU)),
+			}
+			entry.Total.Add(totals)
+			if sidecar {
+				entry.Containers = append(entry.Containers, container.Name)
+				entry.Sidecars.Add(totals)
+			}
+		}
+		for _, container := range pod.Spec.InitContainers {
+			if native := container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways; native {
+				add(container, true)
+			}
+		}
+		for _, container := range pod.Spec.Containers {
+			add(container, isSidecar(container, opts.SidecarPatterns))
+		}
+
+		if len(entry.Containers) > 0 {
+			result = append(result, entry)
+		}
+	}
+
+	return result, nil
+}
+
+// isSidecar returns true if the container name or image name matches one of
+// the glob patterns.
+func isSidecar(container corev1.Container, patterns []string) bool {
+	image := imageName(container.Image)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, container.Name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, image); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// imageName returns the last path element of an image reference without its
+// tag or digest, such as proxyv2 for docker.io/istio/proxyv2:1.22.
+func imageName(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	name := path.Base(image)
+	name, _, _ = strings.Cut(name, ":")
+	return name
+}
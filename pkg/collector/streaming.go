@@ -7,13 +7,17 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
 
 	"github.com/mchmarny/kusage/pkg/config"
@@ -39,36 +43,34 @@ type StreamingResult struct {
 
 // StreamingCollector implements memory-efficient streaming collection
 type StreamingCollector struct {
-	*Collector // Embed original collector for compute methods
-	*PaginatedCollector
+	*Collector     // Embed original collector for compute methods and pagination
 	maxConcurrency int64
+
+	memoryHook       MemoryHook
+	memoryWatermarks []float64
 }
 
 // NewStreamingCollector creates a collector optimized for memory efficiency
-func NewStreamingCollector(coreClient *kubernetes.Clientset, metricsClient *metricsv.Clientset) *StreamingCollector {
+func NewStreamingCollector(coreClient kubernetes.Interface, metricsClient metricsv.Interface) *StreamingCollector {
 	return &StreamingCollector{
-		Collector:          New(coreClient, metricsClient),
-		PaginatedCollector: NewPaginatedCollector(coreClient, metricsClient),
-		maxConcurrency:     MaxConcurrency,
+		Collector:      New(coreClient, metricsClient),
+		maxConcurrency: MaxConcurrency,
 	}
 }
 
-// CollectStreaming performs streaming collection with bounded memory usage
-// This method processes data in chunks and streams results to avoid memory exhaustion
+// CollectStreaming performs streaming collection with bounded memory usage.
+// Pod pages are indexed first, then metrics pages are correlated against the
+// completed index and rows are streamed as they are computed. The returned
+// channel is closed once all work has finished and every goroutine started by
+// the collection has exited; a failure is delivered as the last result.
+// Callers must either drain the channel or cancel ctx.
 func (c *StreamingCollector) CollectStreaming(ctx context.Context, opts config.Options) <-chan StreamingResult {
 	resultChan := make(chan StreamingResult, BufferSize)
 
-	// Use errgroup with bounded concurrency
-	g, ctx := errgroup.WithContext(ctx)
-	sem := semaphore.NewWeighted(c.maxConcurrency)
-
 	go func() {
 		defer close(resultChan)
 
-		c.processStreamingData(ctx, opts, resultChan, g, sem)
-
-		// Wait for all processing to complete
-		if err := g.Wait(); err != nil {
+		if err := c.processStreamingData(ctx, opts, resultChan); err != nil {
 			select {
 			case resultChan <- StreamingResult{Error: err}:
 			case <-ctx.Done():
@@ -79,55 +81,89 @@ func (c *StreamingCollector) CollectStreaming(ctx context.Context, opts config.O
 	return resultChan
 }
 
-// processStreamingData handles the core streaming logic
-func (c *StreamingCollector) processStreamingData(
-	ctx context.Context,
-	opts config.Options,
-	resultChan chan<- StreamingResult,
-	g *errgroup.Group,
-	sem *semaphore.Weighted,
-) {
+// processStreamingData runs the pod and metrics fetchers and the correlation
+// stage in a single errgroup and waits for all of them to complete.
+func (c *StreamingCollector) processStreamingData(ctx context.Context, opts config.Options, resultChan chan<- StreamingResult) error {
+	opts, err := c.resolveNamespaces(ctx, opts)
+	if err != nil {
+		return err
+	}
+
 	// Create channels for streaming pod specs and metrics
 	podChan := make(chan []corev1.Pod, 10)
-	metricsChan := make(chan []metrics.PodMetrics, 10)
+	metricsChan := make(chan *metricsPage, 10)
+
+	// Watermark state and page size are tracked per run
+	monitor := c.newMemoryMonitor(opts.MaxMemoryMB)
+
+	g, ctx := errgroup.WithContext(ctx)
 
 	// Start paginated fetching in background
 	g.Go(func() error {
-		return c.streamPods(ctx, opts, podChan)
+		return c.streamPods(ctx, opts, monitor, podChan)
 	})
 
 	g.Go(func() error {
-		return c.streamMetrics(ctx, opts, metricsChan)
+		return c.streamMetrics(ctx, opts, monitor, metricsChan)
 	})
 
-	// Process pods and metrics as they arrive
+	// Index pods, then process metrics as they arrive
 	g.Go(func() error {
-		return c.correlateStreamingData(ctx, opts, podChan, metricsChan, resultChan, g, sem)
+		return c.correlateStreamingData(ctx, opts, podChan, metricsChan, resultChan)
 	})
+
+	err = g.Wait()
+
+	// The correlation stops taking pages when it fails or is cancelled; the
+	// pages it left in the channel, closed by the fetcher on exit, are
+	// released to the pool
+	for page := range metricsChan {
+		page.release()
+	}
+	return err
 }
 
 // streamPods fetches pods in pages and streams them through a channel
-func (c *StreamingCollector) streamPods(ctx context.Context, opts config.Options, podChan chan<- []corev1.Pod) error {
+func (c *StreamingCollector) streamPods(ctx context.Context, opts config.Options, monitor *memoryMonitor, podChan chan<- []corev1.Pod) error {
 	defer close(podChan)
 
-	namespace := opts.Namespace
-	if opts.AllNamespaces {
-		namespace = ""
+	for _, namespace := range targetNamespaces(opts) {
+		if err := c.streamNamespacePods(ctx, namespace, opts, monitor, podChan); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
+// streamNamespacePods streams the pods pages of a single namespace, or of
+// the whole cluster when namespace is empty
+func (c *StreamingCollector) streamNamespacePods(ctx context.Context, namespace string, opts config.Options, monitor *memoryMonitor, podChan chan<- []corev1.Pod) error {
 	continueToken := ""
 
 	for {
 		listOptions := metav1.ListOptions{
 			LabelSelector: opts.LabelSelector,
-			Limit:         c.pageSize,
+			Limit:         c.nextPageSize(monitor),
 			Continue:      continueToken,
 		}
 
-		podList, err := c.PaginatedCollector.coreClient.CoreV1().Pods(namespace).List(ctx, listOptions)
+		start := time.Now()
+		var podList *corev1.PodList
+		err := c.call(ctx, EndpointPods, func() (err error) {
+			podList, err = c.coreClient.CoreV1().Pods(namespace).List(ctx, listOptions)
+			return err
+		})
+		c.recordPage(start, err, "list pods page")
 		if err != nil {
+			if continueToken != "" && isDegraded(err) {
+				c.abandonPage(EndpointPods, err)
+				break
+			}
 			return fmt.Errorf("failed to stream pods page: %w", err)
 		}
+		if err := monitor.checkPage(); err != nil {
+			return err
+		}
 
 		// Send page to processing channel
 		select {
@@ -146,51 +182,58 @@ func (c *StreamingCollector) streamPods(ctx context.Context, opts config.Options
 }
 
 // streamMetrics fetches metrics in pages and streams them through a channel
-func (c *StreamingCollector) streamMetrics(ctx context.Context, opts config.Options, metricsChan chan<- []metrics.PodMetrics) error {
+func (c *StreamingCollector) streamMetrics(ctx context.Context, opts config.Options, monitor *memoryMonitor, metricsChan chan<- *metricsPage) error {
 	defer close(metricsChan)
 
-	namespace := opts.Namespace
-	if opts.AllNamespaces {
-		namespace = ""
+	for _, namespace := range targetNamespaces(opts) {
+		if err := c.streamNamespaceMetrics(ctx, namespace, opts, monitor, metricsChan); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
+// streamNamespaceMetrics streams the metrics pages of a single namespace, or of
+// the whole cluster when namespace is empty
+func (c *StreamingCollector) streamNamespaceMetrics(ctx context.Context, namespace string, opts config.Options, monitor *memoryMonitor, metricsChan chan<- *metricsPage) error {
 	continueToken := ""
 
 	for {
 		listOptions := metav1.ListOptions{
 			LabelSelector: opts.LabelSelector,
-			Limit:         c.pageSize,
+			Limit:         c.nextPageSize(monitor),
 			Continue:      continueToken,
 		}
 
-		metricsList, err := c.PaginatedCollector.metricsClient.MetricsV1beta1().PodMetricses(namespace).List(ctx, listOptions)
+		start := time.Now()
+		var metricsList *metricsv1beta1.PodMetricsList
+		err := c.call(ctx, EndpointPodMetrics, func() (err error) {
+			metricsList, err = c.metricsClient.MetricsV1beta1().PodMetricses(namespace).List(ctx, listOptions)
+			return err
+		})
+		c.recordPage(start, err, "list pod metrics page")
 		if err != nil {
+			if continueToken != "" && isDegraded(err) {
+				c.abandonPage(EndpointPodMetrics, err)
+				break
+			}
 			return fmt.Errorf("failed to stream metrics page: %w", err)
 		}
 
-		// Convert to internal metrics type
-		pageMetrics := make([]metrics.PodMetrics, 0, len(metricsList.Items))
-		for _, item := range metricsList.Items {
-			pm := metrics.PodMetrics{
-				TypeMeta:   item.TypeMeta,
-				ObjectMeta: item.ObjectMeta,
-				Timestamp:  item.Timestamp,
-				Window:     item.Window,
-				Containers: make([]metrics.ContainerMetrics, 0, len(item.Containers)),
-			}
-			for _, container := range item.Containers {
-				pm.Containers = append(pm.Containers, metrics.ContainerMetrics{
-					Name:  container.Name,
-					Usage: container.Usage,
-				})
-			}
-			pageMetrics = append(pageMetrics, pm)
+		// Convert to internal metrics type using a pooled page buffer,
+		// which is released once the page has been processed
+		page := getMetricsPage()
+		page.convert(metricsList.Items)
+		if err := monitor.checkPage(); err != nil {
+			page.release()
+			return err
 		}
 
 		// Send page to processing channel
 		select {
-		case metricsChan <- pageMetrics:
+		case metricsChan <- page:
 		case <-ctx.Done():
+			page.release()
 			return ctx.Err()
 		}
 
@@ -203,105 +246,146 @@ func (c *StreamingCollector) streamMetrics(ctx context.Context, opts config.Opti
 	return nil
 }
 
-// correlateStreamingData processes streaming data and produces results
+// correlateStreamingData indexes every pod page before processing any metrics
+// page, so metrics are never looked up against a partially built index. Both
+// phases process pages concurrently, bounded by maxConcurrency, and each phase
+// waits for its workers before returning.
 func (c *StreamingCollector) correlateStreamingData(
 	ctx context.Context,
 	opts config.Options,
 	podChan <-chan []corev1.Pod,
-	metricsChan <-chan []metrics.PodMetrics,
+	metricsChan <-chan *metricsPage,
 	resultChan chan<- StreamingResult,
-	g *errgroup.Group,
-	sem *semaphore.Weighted,
 ) error {
+	labelSelector, err := labels.Parse(opts.LabelSelector)
+	if err != nil && opts.LabelSelector != "" {
+		return fmt.Errorf("invalid label selector %q: %w", opts.LabelSelector, err)
+	}
+
 	// Build pod index from streaming data
 	podIndex := sync.Map{} // Thread-safe map for concurrent access
+	sem := semaphore.NewWeighted(c.maxConcurrency)
 
-	// Process pods as they arrive
+	// Phase 1: index all pod pages
+	indexGroup, indexCtx := errgroup.WithContext(ctx)
 	for podPage := range podChan {
-		// Process this page concurrently
-		g.Go(func() error {
-			if err := sem.Acquire(ctx, 1); err != nil {
-				return err
-			}
+		if err := sem.Acquire(indexCtx, 1); err != nil {
+			break
+		}
+		indexGroup.Go(func() error {
 			defer sem.Release(1)
-
-			c.indexPodPage(podPage, opts, &podIndex)
+			c.indexPodPage(podPage, opts, labelSelector, &podIndex)
 			return nil
 		})
 	}
+	if err := indexGroup.Wait(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	// Process metrics as they arrive
-	for metricsPage := range metricsChan {
-		// Process this page concurrently
-		g.Go(func() error {
-			if err := sem.Acquire(ctx, 1); err != nil {
-				return err
-			}
+	// Phase 2: correlate metrics pages against the completed index
+	var processed, unmatched atomic.Int64
+	fresh := newFreshness()
+	metricsGroup, metricsCtx := errgroup.WithContext(ctx)
+	for page := range metricsChan {
+		if err := sem.Acquire(metricsCtx, 1); err != nil {
+			// The pages left in the channel are released once the fetcher stops
+			page.release()
+			break
+		}
+		processed.Add(int64(len(page.items)))
+		metricsGroup.Go(func() error {
 			defer sem.Release(1)
-
-			return c.processMetricsPage(ctx, metricsPage, opts, &podIndex, resultChan)
+			return c.processMetricsPage(metricsCtx, page, opts, &podIndex, &unmatched, fresh, resultChan)
 		})
 	}
+	if err := metricsGroup.Wait(); err != nil {
+		return err
+	}
+	c.reportUnmatched(int(unmatched.Load()), int(processed.Load()))
+	c.reportStale(fresh)
 
-	return nil
+	return ctx.Err()
 }
 
-// indexPodPage adds a page of pods to the thread-safe index
-func (c *StreamingCollector) indexPodPage(pods []corev1.Pod, opts config.Options, podIndex *sync.Map) {
+// indexPodPage adds a page of pods that pass the configured filters to the thread-safe index
+func (c *StreamingCollector) indexPodPage(pods []corev1.Pod, opts config.Options, labelSelector labels.Selector, podIndex *sync.Map) {
 	for i := range pods {
 		pod := &pods[i]
 
-		// Apply filters
-		if opts.ExcludeNamespaces != nil && opts.ExcludeNamespaces.MatchString(pod.Namespace) {
+		// Apply namespace, label exclusion and label selector filters; filtered
+		// pods are indexed as nil so their metrics are not reported as unmatched
+		key := pod.Namespace + "/" + pod.Name
+		if stage, _ := filterPod(pod, opts, labelSelector); stage != "" {
+			podIndex.Store(key, (*metrics.PodSpecInfo)(nil))
 			continue
 		}
 
-		// Check label exclusion
-		if opts.ExcludeLabels != nil {
-			labelString := formatLabels(pod.Labels)
-			if opts.ExcludeLabels.MatchString(labelString) {
-				continue
-			}
-		}
-
-		key := pod.Namespace + "/" + pod.Name
 		podIndex.Store(key, metrics.NewPodSpecInfo(pod))
 	}
+
+	if c.observer != nil {
+		c.observer.RecordProcessing(int64(len(pods)), 0, 0)
+	}
 }
 
-// processMetricsPage processes a page of metrics and sends results
+// processMetricsPage processes a page of metrics and sends results.
+// The page is released back to the pool when processing completes.
 func (c *StreamingCollector) processMetricsPage(
 	ctx context.Context,
-	metricsPage []metrics.PodMetrics,
+	page *metricsPage,
 	opts config.Options,
 	podIndex *sync.Map,
+	unmatched *atomic.Int64,
+	fresh *freshness,
 	resultChan chan<- StreamingResult,
 ) error {
+	var results int64
+	defer func() {
+		if c.observer != nil {
+			c.observer.RecordProcessing(0, int64(len(page.items)), results)
+		}
+		page.release()
+	}()
 
-	for _, pm := range metricsPage {
+	fresh.add(page.items)
+
+	// Scratch buffer for container rows, reused across pods in the page
+	buffer := getRowBuffer()
+	defer putRowBuffer(buffer)
+
+	for _, pm := range page.items {
 		key := pm.Namespace + "/" + pm.Name
 		value, exists := podIndex.Load(key)
 		if !exists {
-			continue // No matching pod spec
+			unmatched.Add(1) // No matching pod spec
+			continue
 		}
 
 		podInfo := value.(*metrics.PodSpecInfo)
+		if podInfo == nil {
+			continue // Filtered pod
+		}
 
 		// Process based on mode
 		switch opts.Mode {
 		case config.ModePods:
-			if row := c.computePodRow(pm, podInfo, opts.Resource); row != nil {
+			if row := c.computePodRow(pm, podInfo, opts); row != nil {
 				select {
 				case resultChan <- StreamingResult{Row: row}:
+					results++
 				case <-ctx.Done():
 					return ctx.Err()
 				}
 			}
 		case config.ModeContainers:
-			containerRows := c.computeContainerRows(pm, podInfo, opts.Resource)
-			for _, row := range containerRows {
+			*buffer = c.appendContainerRows((*buffer)[:0], pm, podInfo, opts)
+			for _, row := range *buffer {
 				select {
 				case resultChan <- StreamingResult{Row: &row}:
+					results++
 				case <-ctx.Done():
 					return ctx.Err()
 				}
@@ -312,6 +396,15 @@ func (c *StreamingCollector) processMetricsPage(
 	return nil
 }
 
+// nextPageSize returns the page size for the next list call, which the memory
+// monitor may have reduced.
+func (c *StreamingCollector) nextPageSize(monitor *memoryMonitor) int64 {
+	if monitor == nil {
+		return c.pageSize
+	}
+	return monitor.PageSize()
+}
+
 // WithMaxConcurrency sets the maximum concurrent operations
 func (c *StreamingCollector) WithMaxConcurrency(maxConcurrency int64) *StreamingCollector {
 	c.maxConcurrency = maxConcurrency
@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+
+	"github.com/mchmarny/kusage/pkg/config"
+)
+
+func TestCorrelateStreamingData_SemaphoreLimit(t *testing.T) {
+	const limit = 3
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:      "app",
+			Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("100Mi")}},
+		}}},
+	}
+	item := metricsv1beta1.PodMetrics{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod"},
+		Containers: []metricsv1beta1.ContainerMetrics{{
+			Name:  "app",
+			Usage: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("50Mi")},
+		}},
+	}
+
+	c := NewStreamingCollector(nil, nil).WithMaxConcurrency(limit)
+	opts := config.Options{Mode: config.ModePods, Resource: config.ResourceMemory}
+
+	podChan := make(chan []corev1.Pod, 1)
+	podChan <- []corev1.Pod{pod}
+	close(podChan)
+
+	// Results are never read, so every worker blocks on its first send
+	// while holding a semaphore slot
+	metricsChan := make(chan *metricsPage)
+	resultChan := make(chan StreamingResult)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.correlateStreamingData(ctx, opts, podChan, metricsChan, resultChan)
+	}()
+
+	// The correlator accepts one page per worker plus the page it holds
+	// while waiting to acquire the semaphore
+	var sent int
+	for accepting := true; accepting && sent <= limit+1; {
+		page := getMetricsPage()
+		page.convert([]metricsv1beta1.PodMetrics{item})
+
+		select {
+		case metricsChan <- page:
+			sent++
+		case <-time.After(200 * time.Millisecond):
+			page.release()
+			accepting = false
+		}
+	}
+	if sent != limit+1 {
+		t.Errorf("expected %d pages accepted with %d workers, got %d", limit+1, limit, sent)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("correlation did not stop after cancellation")
+	}
+}
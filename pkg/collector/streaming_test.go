@@ -0,0 +1,476 @@
+package collector_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+
+	"github.com/mchmarny/kusage/pkg/collector"
+	"github.com/mchmarny/kusage/pkg/collector/fake"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/observability"
+	"github.com/mchmarny/kusage/pkg/resilience"
+)
+
+// paginate returns the page of items selected by the Limit/Continue list options,
+// using the offset of the next item as the continue token.
+func paginate[T any](items []T, opts metav1.ListOptions) ([]T, string, error) {
+	offset := 0
+	if opts.Continue != "" {
+		var err error
+		if offset, err = strconv.Atoi(opts.Continue); err != nil {
+			return nil, "", fmt.Errorf("invalid continue token %q", opts.Continue)
+		}
+	}
+	if offset > len(items) {
+		offset = len(items)
+	}
+
+	page := items[offset:]
+	if opts.Limit > 0 && int64(len(page)) > opts.Limit {
+		page = page[:opts.Limit]
+		return page, strconv.Itoa(offset + len(page)), nil
+	}
+	return page, "", nil
+}
+
+// inNamespace returns the items in namespace, or all items when namespace is empty.
+func inNamespace[T any](items []T, namespace string, nsOf func(T) string) []T {
+	if namespace == "" {
+		return items
+	}
+	var matched []T
+	for _, item := range items {
+		if nsOf(item) == namespace {
+			matched = append(matched, item)
+		}
+	}
+	return matched
+}
+
+// newPagedStreamingCollector returns a streaming collector backed by fixture
+// clients whose list calls honor Limit/Continue pagination.
+func newPagedStreamingCollector(t *testing.T, fixture *fake.Fixture, pageSize int64) *collector.StreamingCollector {
+	t.Helper()
+
+	core, metricsClient := newPagedClients(t, fixture)
+	c := collector.NewStreamingCollector(core, metricsClient)
+	c.WithPageSize(pageSize)
+	return c
+}
+
+// newPagedClients returns fixture clients whose list calls honor
+// Limit/Continue pagination.
+func newPagedClients(t *testing.T, fixture *fake.Fixture) (*k8sfake.Clientset, *metricsfake.Clientset) {
+	t.Helper()
+
+	core, metricsClient, err := fake.NewClients(fixture)
+	if err != nil {
+		t.Fatalf("failed to create clients: %v", err)
+	}
+
+	core.(*k8sfake.Clientset).PrependReactor("list", "pods", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		list := action.(k8stesting.ListActionImpl)
+		pods := inNamespace(fixture.Pods.Items, list.GetNamespace(), func(p corev1.Pod) string { return p.Namespace })
+		page, token, err := paginate(pods, list.GetListOptions())
+		if err != nil {
+			return true, nil, err
+		}
+		return true, &corev1.PodList{ListMeta: metav1.ListMeta{Continue: token}, Items: page}, nil
+	})
+
+	metricsClient.(*metricsfake.Clientset).PrependReactor("list", "pods", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		list := action.(k8stesting.ListActionImpl)
+		items := inNamespace(fixture.Metrics.Items, list.GetNamespace(), func(m metricsv1beta1.PodMetrics) string { return m.Namespace })
+		page, token, err := paginate(items, list.GetListOptions())
+		if err != nil {
+			return true, nil, err
+		}
+		return true, &metricsv1beta1.PodMetricsList{ListMeta: metav1.ListMeta{Continue: token}, Items: page}, nil
+	})
+
+	return core.(*k8sfake.Clientset), metricsClient.(*metricsfake.Clientset)
+}
+
+// drain reads all results from the channel and returns the rows and the first error.
+func drain(results <-chan collector.StreamingResult) ([]metrics.Row, error) {
+	var (
+		rows []metrics.Row
+		err  error
+	)
+	for result := range results {
+		if result.Error != nil {
+			if err == nil {
+				err = result.Error
+			}
+			continue
+		}
+		rows = append(rows, *result.Row)
+	}
+	return rows, err
+}
+
+// waitForGoroutines fails the test if the goroutine count does not return to baseline.
+func waitForGoroutines(t *testing.T, baseline int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			n := runtime.Stack(buf, true)
+			t.Fatalf("goroutines leaked: baseline %d, now %d\n%s", baseline, runtime.NumGoroutine(), buf[:n])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStreamingCollector_MatchesCollect(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+
+	optionSets := []config.Options{
+		{AllNamespaces: true, Mode: config.ModePods, Resource: config.ResourceMemory},
+		{AllNamespaces: true, Mode: config.ModeContainers, Resource: config.ResourceCPU},
+		{Namespace: "payments", Mode: config.ModeContainers, Resource: config.ResourceMemory},
+	}
+
+	for _, opts := range optionSets {
+		expected, err := newFixtureCollector(t).Collect(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("collect failed: %v", err)
+		}
+
+		for _, pageSize := range []int64{1, 3, 100} {
+			t.Run(fmt.Sprintf("%s/%s/%s/page-%d", opts.Mode, opts.Resource, opts.Namespace, pageSize), func(t *testing.T) {
+				baseline := runtime.NumGoroutine()
+
+				c := newPagedStreamingCollector(t, fixture, pageSize)
+				rows, err := drain(c.CollectStreaming(context.Background(), opts))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				if len(rows) != len(expected) {
+					t.Fatalf("expected %d rows, got %d", len(expected), len(rows))
+				}
+				index := rowsByName(rows)
+				for _, want := range expected {
+					got, ok := index[want.Namespace+"/"+want.Name]
+					if !ok {
+						t.Errorf("missing row %s/%s", want.Namespace, want.Name)
+						continue
+					}
+					if got.Percentage != want.Percentage {
+						t.Errorf("row %s: expected %.2f%%, got %.2f%%", want.Name, want.Percentage, got.Percentage)
+					}
+				}
+
+				waitForGoroutines(t, baseline)
+			})
+		}
+	}
+}
+
+func TestStreamingCollector_Cancel(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+
+	baseline := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	opts := config.Options{AllNamespaces: true, Mode: config.ModePods, Resource: config.ResourceMemory}
+	results := newPagedStreamingCollector(t, fixture, 1).CollectStreaming(ctx, opts)
+
+	select {
+	case <-closed(results):
+	case <-time.After(2 * time.Second):
+		t.Fatal("result channel not closed after cancellation")
+	}
+
+	waitForGoroutines(t, baseline)
+}
+
+// closed drains results in the background and returns a channel closed once results is closed.
+func closed(results <-chan collector.StreamingResult) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range results {
+		}
+	}()
+	return done
+}
+
+// syntheticFixture returns a fixture of pods spread across namespaces, each with
+// containers that have memory and cpu limits and a matching metrics entry.
+func syntheticFixture(namespaces, podsPerNamespace, containersPerPod int) *fake.Fixture {
+	fixture := &fake.Fixture{}
+
+	for n := 0; n < namespaces; n++ {
+		namespace := fmt.Sprintf("ns-%d", n)
+		for p := 0; p < podsPerNamespace; p++ {
+			pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: fmt.Sprintf("pod-%d", p)}}
+			pm := metricsv1beta1.PodMetrics{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: pod.Name},
+				Window:     metav1.Duration{Duration: 30 * time.Second},
+			}
+
+			for i := 0; i < containersPerPod; i++ {
+				name := fmt.Sprintf("c-%d", i)
+				pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{
+					Name: name,
+					Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse("100Mi"),
+						corev1.ResourceCPU:    resource.MustParse("100m"),
+					}},
+				})
+				pm.Containers = append(pm.Containers, metricsv1beta1.ContainerMetrics{
+					Name: name,
+					Usage: corev1.ResourceList{
+						corev1.ResourceMemory: *resource.NewQuantity(int64(p%100+1)*metrics.BytesPerMi, resource.BinarySI),
+						corev1.ResourceCPU:    *resource.NewMilliQuantity(int64(p%100+1), resource.DecimalSI),
+					},
+				})
+			}
+
+			fixture.Pods.Items = append(fixture.Pods.Items, pod)
+			fixture.Metrics.Items = append(fixture.Metrics.Items, pm)
+		}
+	}
+
+	return fixture
+}
+
+func TestStreamingCollector_ConcurrentRuns(t *testing.T) {
+	const (
+		namespaces       = 10
+		podsPerNamespace = 50
+		containersPerPod = 3
+		runs             = 8
+	)
+	fixture := syntheticFixture(namespaces, podsPerNamespace, containersPerPod)
+
+	tests := []struct {
+		name     string
+		opts     config.Options
+		expected int
+	}{
+		{
+			name:     "pods",
+			opts:     config.Options{AllNamespaces: true, Mode: config.ModePods, Resource: config.ResourceMemory},
+			expected: namespaces * podsPerNamespace,
+		},
+		{
+			name:     "containers",
+			opts:     config.Options{AllNamespaces: true, Mode: config.ModeContainers, Resource: config.ResourceCPU},
+			expected: namespaces * podsPerNamespace * containersPerPod,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseline := runtime.NumGoroutine()
+
+			var wg sync.WaitGroup
+			errs := make(chan error, runs)
+			for i := 0; i < runs; i++ {
+				concurrency := int64(i%4 + 1)
+				c := newPagedStreamingCollector(t, fixture, 17).WithMaxConcurrency(concurrency)
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					rows, err := drain(c.CollectStreaming(context.Background(), tt.opts))
+					if err != nil {
+						errs <- err
+						return
+					}
+					if len(rows) != tt.expected {
+						errs <- fmt.Errorf("concurrency %d: expected %d rows, got %d", concurrency, tt.expected, len(rows))
+						return
+					}
+					if unique := len(rowsByName(rows)); unique != tt.expected {
+						errs <- fmt.Errorf("concurrency %d: expected %d unique rows, got %d", concurrency, tt.expected, unique)
+					}
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				t.Error(err)
+			}
+
+			waitForGoroutines(t, baseline)
+		})
+	}
+}
+
+func TestStreamingCollector_CancelMidStream(t *testing.T) {
+	fixture := syntheticFixture(5, 100, 2)
+	baseline := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	opts := config.Options{AllNamespaces: true, Mode: config.ModeContainers, Resource: config.ResourceMemory}
+	results := newPagedStreamingCollector(t, fixture, 10).WithMaxConcurrency(2).CollectStreaming(ctx, opts)
+
+	// Read a few results, then abandon the stream
+	for i := 0; i < 5; i++ {
+		if result, ok := <-results; !ok || result.Error != nil {
+			t.Fatalf("expected a row before cancellation, got %+v (open=%t)", result, ok)
+		}
+	}
+	cancel()
+
+	select {
+	case <-closed(results):
+	case <-time.After(2 * time.Second):
+		t.Fatal("result channel not closed after cancellation")
+	}
+
+	waitForGoroutines(t, baseline)
+}
+
+func TestStreamingCollector_MemoryHookAbort(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+
+	baseline := runtime.NumGoroutine()
+
+	var fired atomic.Int32
+	c := newPagedStreamingCollector(t, fixture, 1).WithMemoryHook(func(collector.MemoryEvent) collector.MemoryAction {
+		fired.Add(1)
+		return collector.MemoryAbort
+	}, 0.001)
+
+	// Any live heap exceeds 0.1% of a 1MB budget
+	opts := config.Options{AllNamespaces: true, Mode: config.ModePods, Resource: config.ResourceMemory, MaxMemoryMB: 1}
+	_, err = drain(c.CollectStreaming(context.Background(), opts))
+	if !errors.Is(err, collector.ErrMemoryBudgetExceeded) {
+		t.Fatalf("expected ErrMemoryBudgetExceeded, got %v", err)
+	}
+	if fired.Load() == 0 {
+		t.Error("expected memory hook to fire")
+	}
+
+	waitForGoroutines(t, baseline)
+}
+
+// fastRetry retries without meaningful backoff.
+var fastRetry = resilience.RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1}
+
+func TestStreamingCollector_RetriesTransientErrors(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+
+	core, metricsClient := newPagedClients(t, fixture)
+
+	// Every other metrics list call is throttled
+	var calls atomic.Int32
+	metricsClient.PrependReactor("list", "pods", func(k8stesting.Action) (bool, k8sruntime.Object, error) {
+		if calls.Add(1)%2 == 1 {
+			return true, nil, apierrors.NewTooManyRequests("slow down", 1)
+		}
+		return false, nil, nil
+	})
+
+	observer := observability.NewMetrics()
+	c := collector.NewStreamingCollector(core, metricsClient)
+	c.WithPageSize(2)
+	c.WithMetrics(observer).WithRetry(fastRetry)
+
+	opts := config.Options{AllNamespaces: true, Mode: config.ModePods, Resource: config.ResourceMemory}
+	rows, err := drain(c.CollectStreaming(context.Background(), opts))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want, err := newFixtureCollector(t).Collect(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("collect failed: %v", err)
+	}
+	if len(rows) != len(want) {
+		t.Errorf("expected %d rows, got %d", len(want), len(rows))
+	}
+
+	reliability := observer.GetSummary().Reliability
+	if reliability.Retries[collector.EndpointPodMetrics] == 0 {
+		t.Errorf("expected pod metrics retries, got %v", reliability.Retries)
+	}
+	if !reliability.Complete() {
+		t.Errorf("expected complete results, got %s", reliability)
+	}
+}
+
+func TestStreamingCollector_AbandonsFailingPages(t *testing.T) {
+	fixture, err := fake.DefaultFixture()
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+
+	core, metricsClient := newPagedClients(t, fixture)
+
+	// Every metrics page after the first is unavailable
+	metricsClient.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		if action.(k8stesting.ListActionImpl).GetListOptions().Continue != "" {
+			return true, nil, apierrors.NewServiceUnavailable("metrics-server restarting")
+		}
+		return false, nil, nil
+	})
+
+	observer := observability.NewMetrics()
+	c := collector.NewStreamingCollector(core, metricsClient)
+	c.WithPageSize(2)
+	c.WithMetrics(observer).WithRetry(fastRetry)
+
+	opts := config.Options{AllNamespaces: true, Mode: config.ModePods, Resource: config.ResourceMemory}
+	rows, err := drain(c.CollectStreaming(context.Background(), opts))
+	if err != nil {
+		t.Fatalf("expected partial results, got error: %v", err)
+	}
+	if len(rows) == 0 || len(rows) > 2 {
+		t.Errorf("expected the rows of the first page only, got %d", len(rows))
+	}
+
+	reliability := observer.GetSummary().Reliability
+	if reliability.PagesAbandoned[collector.EndpointPodMetrics] != 1 {
+		t.Errorf("expected one abandoned pod metrics page, got %v", reliability.PagesAbandoned)
+	}
+	if reliability.Retries[collector.EndpointPodMetrics] != int64(fastRetry.MaxAttempts-1) {
+		t.Errorf("expected %d retries, got %v", fastRetry.MaxAttempts-1, reliability.Retries)
+	}
+	if reliability.Complete() {
+		t.Error("expected incomplete results")
+	}
+}
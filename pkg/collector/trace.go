@@ -0,0 +1,186 @@
+// Package collector - per-pod tracing through the filter and correlation pipeline
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+const (
+	// StageListed reports whether the pod was returned by the pod list call
+	StageListed = "listed"
+	// StageNamespacePattern reports the outcome of a -n glob such as team-*
+	StageNamespacePattern = "namespace-pattern"
+	// StageNamespaceExclusion reports the outcome of the --nx filter
+	StageNamespaceExclusion = "namespace-exclusion"
+	// StageLabelExclusion reports the outcome of the --lx filter
+	StageLabelExclusion = "label-exclusion"
+	// StageLabelSelector reports the outcome of the -l filter
+	StageLabelSelector = "label-selector"
+	// StageCompleted reports whether a pod that ran to completion was excluded
+	StageCompleted = "completed"
+	// StageCrashLoop reports whether a pod with a container in CrashLoopBackOff was excluded
+	StageCrashLoop = "crash-loop"
+	// StageSample reports whether the pod fell outside the --sample-fraction sample
+	StageSample = "sample"
+	// StageMetrics reports whether metrics-server returned metrics for the pod
+	StageMetrics = "metrics"
+	// StageLimits reports how the pod limits contributed to the percentage
+	StageLimits = "limits"
+)
+
+// Explain collects data like Collect does, but additionally traces every pod
+// matching opts.WhyPod through the pipeline, recording which rule excluded it
+// or how its percentage was computed. The full result set is returned as well
+// so the caller can determine the pod's rank.
+func (c *Collector) Explain(ctx context.Context, opts config.Options) ([]metrics.Trace, []metrics.Row, error) {
+	// Excluded namespaces are still listed so their pods can be traced to --nx
+	exclude := opts.ExcludeNamespaces
+	opts.ExcludeNamespaces = nil
+	opts, err := c.resolveNamespaces(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts.ExcludeNamespaces = exclude
+
+	podsList, metricsList, err := c.fetch(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defaults, err := c.fetchLimitDefaults(ctx, podsList, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := c.correlateData(podsList, metricsList, defaults, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	labelSelector, err := labels.Parse(opts.LabelSelector)
+	if err != nil && opts.LabelSelector != "" {
+		return nil, nil, fmt.Errorf("invalid label selector %q: %w", opts.LabelSelector, err)
+	}
+
+	// Index metrics for lookup of the traced pods
+	metricsIndex := make(map[string]metrics.PodMetrics, len(metricsList))
+	for _, pm := range metricsList {
+		metricsIndex[pm.Namespace+"/"+pm.Name] = pm
+	}
+
+	var traces []metrics.Trace
+	for i := range podsList {
+		pod := &podsList[i]
+		if pod.Name != opts.WhyPod {
+			continue
+		}
+		traces = append(traces, c.tracePod(pod, metricsIndex, labelSelector, defaults, opts))
+	}
+
+	if len(traces) == 0 {
+		namespace := opts.Namespace
+		if opts.AllNamespaces {
+			namespace = "*"
+		}
+		trace := metrics.Trace{Namespace: namespace, Name: opts.WhyPod}
+		trace.AddStep(StageListed, false, fmt.Sprintf("pod not returned by the API in namespace %q with label selector %q", namespace, opts.LabelSelector))
+		traces = append(traces, trace)
+	}
+
+	return traces, rows, nil
+}
+
+// tracePod evaluates a single pod against each pipeline stage in order,
+// stopping at the first stage that rejects it.
+func (c *Collector) tracePod(pod *corev1.Pod, metricsIndex map[string]metrics.PodMetrics, labelSelector labels.Selector, defaults limitDefaults, opts config.Options) metrics.Trace {
+	podInfo := defaults.podInfo(pod)
+	trace := metrics.Trace{
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		Node:      pod.Spec.NodeName,
+		QoS:       string(pod.Status.QOSClass),
+		Restarts:  podInfo.Restarts,
+	}
+	trace.AddStep(StageListed, true, fmt.Sprintf("pod found (phase %s)", pod.Status.Phase))
+
+	if stage, detail := filterPod(pod, opts, labelSelector); stage != "" {
+		trace.AddStep(stage, false, detail)
+		return trace
+	}
+	trace.AddStep("filters", true, "not excluded by -n, --nx, --lx, -l or completion")
+
+	pm, exists := metricsIndex[pod.Namespace+"/"+pod.Name]
+	if !exists {
+		trace.AddStep(StageMetrics, false, "no metrics reported by metrics-server (pod may be starting, completed or not yet scraped)")
+		return trace
+	}
+	trace.AddStep(StageMetrics, true, fmt.Sprintf("metrics found for %d container(s)", len(pm.Containers)))
+
+	for _, container := range pm.Containers {
+		trace.AddStep(StageLimits, true, describeContainer(container, podInfo, opts.Resource))
+	}
+
+	switch opts.Mode {
+	case config.ModePods:
+		if row := c.computePodRow(pm, podInfo, opts); row != nil {
+			trace.Rows = append(trace.Rows, *row)
+		}
+	case config.ModeContainers:
+		trace.Rows = c.appendContainerRows(nil, pm, podInfo, opts)
+	}
+
+	if len(trace.Rows) == 0 {
+		trace.AddStep(StageLimits, false, fmt.Sprintf("no container has a %s limit, so no percentage can be computed", opts.Resource))
+	}
+
+	return trace
+}
+
+// describeContainer explains how a single container contributes to the pod
+// percentage, along with its request and restarts.
+func describeContainer(container metrics.ContainerMetrics, podInfo *metrics.PodSpecInfo, resource config.ResourceKind) string {
+	var detail string
+	switch resource {
+	case config.ResourceCPU:
+		usageMc := container.CPUMillicores
+		if !podInfo.ContainerHasCPULimit(container.Name) {
+			detail = fmt.Sprintf("container %q: usage %dm, no cpu limit (not counted)", container.Name, usageMc)
+		} else {
+			detail = fmt.Sprintf("container %q: usage %dm of %dm %s (counted)",
+				container.Name, usageMc, podInfo.ContainerCPULimits[container.Name], limitKind(podInfo.DefaultCPULimits[container.Name]))
+		}
+	default:
+		usageMi := float64(container.MemoryBytes) / metrics.BytesPerMi
+		if !podInfo.ContainerHasMemoryLimit(container.Name) {
+			detail = fmt.Sprintf("container %q: usage %.1fMi, no memory limit (not counted)", container.Name, usageMi)
+		} else {
+			detail = fmt.Sprintf("container %q: usage %.1fMi of %.1fMi %s (counted)",
+				container.Name, usageMi, podInfo.ContainerMemoryLimits[container.Name], limitKind(podInfo.DefaultMemoryLimits[container.Name]))
+		}
+	}
+
+	switch {
+	case resource == config.ResourceCPU && podInfo.ContainerHasCPURequest(container.Name):
+		detail += fmt.Sprintf(", request %dm", podInfo.ContainerCPURequests[container.Name])
+	case resource != config.ResourceCPU && podInfo.ContainerHasMemoryRequest(container.Name):
+		detail += fmt.Sprintf(", request %.1fMi", podInfo.ContainerMemoryRequests[container.Name])
+	}
+	if restarts := podInfo.ContainerRestarts[container.Name]; restarts > 0 {
+		detail += fmt.Sprintf(", %d restarts", restarts)
+	}
+	return detail
+}
+
+// limitKind names a limit of the pod spec or a LimitRange default.
+func limitKind(defaulted bool) string {
+	if defaulted {
+		return "LimitRange default limit"
+	}
+	return "limit"
+}
@@ -0,0 +1,70 @@
+// Package collector - persistent volume usage
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// VolumeSource reads the usage of the persistent volume claims mounted by the
+// pods on the given nodes, such as the kubelet Summary API.
+type VolumeSource interface {
+	Volumes(ctx context.Context, nodes []string) ([]metrics.VolumeUsage, error)
+}
+
+// Volumes returns the usage of the persistent volume claims mounted by the
+// running pods in scope. Only the nodes those pods run on are read from source.
+func (c *Collector) Volumes(ctx context.Context, opts config.Options, source VolumeSource) ([]metrics.VolumeUsage, error) {
+	labelSelector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector %q: %w", opts.LabelSelector, err)
+	}
+
+	opts, err = c.resolveNamespaces(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := c.fetchPods(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pods: %w", err)
+	}
+
+	scoped := make(map[string]bool)
+	seen := make(map[string]bool)
+	var nodes []string
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase != corev1.PodRunning || pod.Spec.NodeName == "" || !inScope(pod, opts, labelSelector) {
+			continue
+		}
+		scoped[pod.Namespace+"/"+pod.Name] = true
+		if !seen[pod.Spec.NodeName] {
+			seen[pod.Spec.NodeName] = true
+			nodes = append(nodes, pod.Spec.NodeName)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+
+	volumes, err := source.Volumes(ctx, nodes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read volume stats: %w", err)
+	}
+
+	// Nodes also report the volumes of pods outside the scope
+	result := volumes[:0]
+	for _, volume := range volumes {
+		if scoped[volume.Namespace+"/"+volume.Pod] {
+			result = append(result, volume)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,140 @@
+// Package collector - warnings of degraded collections
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+const (
+	// staleWindows is the number of scrape windows a pod metrics sample may
+	// trail the newest sample of the same list by: metrics-server rescrapes
+	// every node each window, so an older sample belongs to a node it failed
+	// to scrape since
+	staleWindows = 3
+	// defaultScrapeWindow stands in for the window of samples without one
+	defaultScrapeWindow = 30 * time.Second
+)
+
+// warnings accumulates the warnings of one collection. Namespaces are listed
+// concurrently, so warnings may be added from several goroutines.
+type warnings struct {
+	mutex sync.Mutex
+	items []metrics.Warning
+}
+
+// add records w.
+func (w *warnings) add(item metrics.Warning) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.items = append(w.items, item)
+}
+
+// list returns the recorded warnings in the order they were added.
+func (w *warnings) list() []metrics.Warning {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return append([]metrics.Warning(nil), w.items...)
+}
+
+// warn records w into the warnings of the collection, when c collects them.
+func (c *Collector) warn(w metrics.Warning) {
+	if c.warnings == nil {
+		return
+	}
+	c.warnings.add(w)
+}
+
+// CollectWithWarnings is like Collect but also returns the warnings of the
+// collection: abandoned pages, unmatched or stale pod metrics and an
+// unresolved namespace list. Warnings are returned with the error of a failed
+// collection as well.
+func (c *Collector) CollectWithWarnings(ctx context.Context, opts config.Options) ([]metrics.Row, []metrics.Warning, error) {
+	// Warnings are recorded on a copy of the collector, so collections
+	// running concurrently on c keep their warnings apart
+	run := *c
+	run.warnings = &warnings{}
+	rows, err := run.Collect(ctx, opts)
+	return rows, run.warnings.list(), err
+}
+
+// scrape identifies the pod metrics samples of one metrics-server scrape.
+type scrape struct {
+	timestamp int64
+	window    time.Duration
+}
+
+// freshness counts pod metrics samples by scrape, to find those metrics-server
+// stopped refreshing. Samples of one node scrape share their timestamp, so the
+// counts stay small however many pods are listed. Pages are correlated
+// concurrently, so samples may be added from several goroutines.
+type freshness struct {
+	mutex   sync.Mutex
+	scrapes map[scrape]int
+}
+
+// newFreshness returns an empty freshness count.
+func newFreshness() *freshness {
+	return &freshness{scrapes: make(map[scrape]int)}
+}
+
+// add counts the samples of items.
+func (f *freshness) add(items []metrics.PodMetrics) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for i := range items {
+		f.scrapes[scrape{timestamp: items[i].Timestamp.UnixNano(), window: items[i].Window.Duration}]++
+	}
+}
+
+// stale returns the number of samples older than staleWindows of their scrape
+// windows relative to the newest sample, and the number of samples counted.
+// Comparing samples with each other rather than with the local clock keeps
+// clock skew between the machine and the cluster from marking samples stale.
+func (f *freshness) stale() (stale, total int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var newest int64
+	for s, n := range f.scrapes {
+		newest = max(newest, s.timestamp)
+		total += n
+	}
+	for s, n := range f.scrapes {
+		window := s.window
+		if window <= 0 {
+			window = defaultScrapeWindow
+		}
+		if time.Duration(newest-s.timestamp) > staleWindows*window {
+			stale += n
+		}
+	}
+	return stale, total
+}
+
+// reportStale warns about and records pod metrics samples metrics-server
+// stopped refreshing. Only metrics API samples are checked: other sources
+// aggregate usage over a range rather than scraping it.
+func (c *Collector) reportStale(f *freshness) {
+	if c.metricsSource != nil {
+		return
+	}
+	stale, total := f.stale()
+	if stale == 0 {
+		return
+	}
+	slog.Warn("pod metrics not refreshed by metrics-server, usage of their pods is out of date",
+		"stale", stale, "metrics", total)
+	c.warn(metrics.Warning{
+		Kind:     metrics.WarningStaleMetrics,
+		Endpoint: EndpointPodMetrics,
+		Count:    stale,
+		Message: fmt.Sprintf("%d of %d pod metrics trail the newest by more than %d scrape windows, "+
+			"metrics-server may be failing to scrape their nodes", stale, total, staleWindows),
+	})
+}
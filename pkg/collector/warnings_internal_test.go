@@ -0,0 +1,33 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+func TestFreshness_Stale(t *testing.T) {
+	newest := time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC)
+	sample := func(age, window time.Duration) metrics.PodMetrics {
+		return metrics.PodMetrics{Timestamp: metav1.NewTime(newest.Add(-age)), Window: metav1.Duration{Duration: window}}
+	}
+
+	f := newFreshness()
+	f.add([]metrics.PodMetrics{
+		sample(0, 15*time.Second),
+		sample(30*time.Second, 15*time.Second), // two windows behind, in the previous scrape
+		sample(time.Minute, 15*time.Second),    // four windows behind
+	})
+	f.add([]metrics.PodMetrics{
+		sample(time.Minute, 30*time.Second), // two windows behind
+		sample(2*time.Minute, 0),            // four default windows behind
+	})
+
+	stale, total := f.stale()
+	if stale != 2 || total != 5 {
+		t.Errorf("expected 2 of 5 samples stale, got %d of %d", stale, total)
+	}
+}
@@ -0,0 +1,65 @@
+// Package config - namespace usage budgets
+package config
+
+import (
+	"fmt"
+	"path"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// NamespaceBudget is the memory and CPU usage the namespaces matching a glob
+// pattern are each expected to stay within, exposed by serve mode. Either
+// resource may be left unbudgeted.
+//
+//	budgets:
+//	- namespace: payments
+//	  memory: 64Gi
+//	  cpu: 32
+//	- namespace: "team-*"
+//	  memory: 16Gi
+type NamespaceBudget struct {
+	// Namespace is a glob pattern matched against the namespace (e.g. "team-*")
+	Namespace string `json:"namespace"`
+	// Memory is the memory working set budget of each matching namespace
+	Memory *resource.Quantity `json:"memory,omitempty"`
+	// CPU is the CPU usage budget of each matching namespace
+	CPU *resource.Quantity `json:"cpu,omitempty"`
+}
+
+// Budgets are namespace budgets matched in order; the first matching budget
+// applies to a namespace.
+type Budgets []NamespaceBudget
+
+// validate checks that every budget has a valid pattern and a positive
+// budget of at least one resource.
+func (b Budgets) validate() error {
+	for i, budget := range b {
+		if budget.Namespace == "" {
+			return fmt.Errorf("budget %d: namespace is required", i+1)
+		}
+		if _, err := path.Match(budget.Namespace, ""); err != nil {
+			return fmt.Errorf("budget %d: invalid namespace pattern %q: %w", i+1, budget.Namespace, err)
+		}
+		if budget.Memory == nil && budget.CPU == nil {
+			return fmt.Errorf("budget %s: memory or cpu is required", budget.Namespace)
+		}
+		if budget.Memory != nil && budget.Memory.Sign() <= 0 {
+			return fmt.Errorf("budget %s: memory must be positive, got %s", budget.Namespace, budget.Memory)
+		}
+		if budget.CPU != nil && budget.CPU.Sign() <= 0 {
+			return fmt.Errorf("budget %s: cpu must be positive, got %s", budget.Namespace, budget.CPU)
+		}
+	}
+	return nil
+}
+
+// For returns the budget of namespace, or nil when no budget matches it.
+func (b Budgets) For(namespace string) *NamespaceBudget {
+	for i := range b {
+		if ok, _ := path.Match(b[i].Namespace, namespace); ok {
+			return &b[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+// Package config - compiled row expressions
+package config
+
+import (
+	"github.com/google/cel-go/cel"
+)
+
+// Expression is a compiled CEL expression over the row variable, as given to
+// --score-expr and --filter. The analyzer compiles and evaluates it.
+type Expression struct {
+	// Source is the expression as given on the command line
+	Source string
+	// Program evaluates the expression against a row activation
+	Program cel.Program
+}
+
+// String returns the source of the expression.
+func (e *Expression) String() string {
+	if e == nil {
+		return ""
+	}
+	return e.Source
+}
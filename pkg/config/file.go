@@ -0,0 +1,219 @@
+// Package config - configuration file and threshold policies
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ConfigEnv is the environment variable naming the configuration file
+	ConfigEnv = "KUSAGE_CONFIG"
+	// DefaultCriticalThreshold is the critical usage percentage used when none is configured
+	DefaultCriticalThreshold = 95.0
+)
+
+// File is the optional kusage configuration file.
+//
+//	thresholds:
+//	  warning: 80
+//	  critical: 95
+//	  policies:
+//	  - namespace: "dev-*"
+//	    warning: 90
+//	    critical: 110
+//	  - selector: tier=batch
+//	    critical: 100
+//	profiles:
+//	  prod:
+//	    A: true
+//	    nx: ^(kube-system|monitoring)$
+//	  dev:
+//	    "n": dev
+//	budgets:
+//	- namespace: "team-*"
+//	  memory: 16Gi
+//	  cpu: 8
+type File struct {
+	// Thresholds configures the warning and critical usage percentages
+	Thresholds *Thresholds `json:"thresholds,omitempty"`
+	// Profiles are the default flags of the pods and containers analyses per
+	// kubeconfig context, keyed by flag name without dashes
+	Profiles map[string]map[string]any `json:"profiles,omitempty"`
+	// Budgets are the namespace usage budgets exposed by serve mode
+	Budgets Budgets `json:"budgets,omitempty"`
+}
+
+// Thresholds are the usage percentages at which rows are reported as warning
+// or critical. Policies override them for matching namespaces or pods; the
+// first matching policy applies.
+type Thresholds struct {
+	// Warning is the default warning percentage
+	Warning float64 `json:"warning,omitempty"`
+	// Critical is the default critical percentage
+	Critical float64 `json:"critical,omitempty"`
+	// Policies assign different thresholds to namespaces or label selectors
+	Policies []ThresholdPolicy `json:"policies,omitempty"`
+}
+
+// ThresholdPolicy assigns thresholds to the rows of matching pods. A policy
+// matches when both its namespace pattern and its selector, if set, match.
+// Thresholds left unset fall back to the defaults.
+type ThresholdPolicy struct {
+	// Namespace is a glob pattern matched against the namespace (e.g. "dev-*")
+	Namespace string `json:"namespace,omitempty"`
+	// Selector is a Kubernetes label selector matched against the pod labels
+	Selector string `json:"selector,omitempty"`
+	// Warning overrides the warning percentage
+	Warning *float64 `json:"warning,omitempty"`
+	// Critical overrides the critical percentage
+	Critical *float64 `json:"critical,omitempty"`
+
+	selector labels.Selector
+}
+
+// DefaultConfigPath returns the configuration file read when neither --config
+// nor KUSAGE_CONFIG is set: kusage/config.yaml in the user configuration directory.
+func DefaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "kusage", "config.yaml")
+}
+
+// LoadFile reads and validates the configuration file at path. A missing file
+// is only an error when required is set, otherwise an empty File is returned.
+func LoadFile(path string, required bool) (*File, error) {
+	file := &File{}
+	if path == "" {
+		return file, nil
+	}
+
+	data, err := os.ReadFile(filepath.Clean(path))
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return file, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, file); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if file.Thresholds != nil {
+		if err := file.Thresholds.compile(); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+	if err := file.Budgets.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	return file, nil
+}
+
+// compile validates the thresholds and parses the policy selectors.
+func (t *Thresholds) compile() error {
+	if err := checkThresholds(t.Warning, t.Critical); err != nil {
+		return err
+	}
+
+	for i := range t.Policies {
+		policy := &t.Policies[i]
+		if policy.Namespace == "" && policy.Selector == "" {
+			return fmt.Errorf("threshold policy %d: namespace or selector is required", i+1)
+		}
+		selector, err := compileScope(policy.Namespace, policy.Selector)
+		if err != nil {
+			return fmt.Errorf("threshold policy %d: %w", i+1, err)
+		}
+		policy.selector = selector
+
+		for _, value := range []*float64{policy.Warning, policy.Critical} {
+			if value != nil {
+				if err := checkThresholds(*value, 0); err != nil {
+					return fmt.Errorf("threshold policy %d: %w", i+1, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkThresholds rejects negative and NaN percentages.
+func checkThresholds(values ...float64) error {
+	for _, v := range values {
+		if math.IsNaN(v) || v < 0 {
+			return fmt.Errorf("threshold must be non-negative, got %v", v)
+		}
+	}
+	return nil
+}
+
+// compileScope validates a namespace glob pattern and parses a label selector.
+func compileScope(namespace, selector string) (labels.Selector, error) {
+	if _, err := path.Match(namespace, ""); err != nil {
+		return nil, fmt.Errorf("invalid namespace pattern %q: %w", namespace, err)
+	}
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+	}
+	return parsed, nil
+}
+
+// inScope returns true if namespace matches the glob pattern and podLabels
+// match the selector; an empty pattern or nil selector matches everything.
+func inScope(pattern string, selector labels.Selector, namespace string, podLabels map[string]string) bool {
+	if pattern != "" {
+		if ok, _ := path.Match(pattern, namespace); !ok {
+			return false
+		}
+	}
+	return selector == nil || selector.Matches(labels.Set(podLabels))
+}
+
+// Matches returns true if the policy applies to a pod in namespace with podLabels.
+func (p ThresholdPolicy) Matches(namespace string, podLabels map[string]string) bool {
+	return inScope(p.Namespace, p.selector, namespace, podLabels)
+}
+
+// For returns the warning and critical percentages of a pod in namespace with
+// podLabels. Unset defaults are taken from fallbackWarning and DefaultCriticalThreshold.
+func (t *Thresholds) For(namespace string, podLabels map[string]string, fallbackWarning float64) (warning, critical float64) {
+	warning, critical = fallbackWarning, DefaultCriticalThreshold
+	if t == nil {
+		return warning, critical
+	}
+	if t.Warning > 0 {
+		warning = t.Warning
+	}
+	if t.Critical > 0 {
+		critical = t.Critical
+	}
+
+	for _, policy := range t.Policies {
+		if !policy.Matches(namespace, podLabels) {
+			continue
+		}
+		if policy.Warning != nil {
+			warning = *policy.Warning
+		}
+		if policy.Critical != nil {
+			critical = *policy.Critical
+		}
+		break
+	}
+
+	return warning, critical
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadFile_Thresholds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `thresholds:
+  warning: 75
+  policies:
+  - namespace: "dev-*"
+    warning: 90
+    critical: 110
+  - selector: tier=batch
+    critical: 100
+  - namespace: payments
+    selector: tier in (web,api)
+    warning: 60
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := LoadFile(path, true)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+
+	tests := []struct {
+		namespace string
+		labels    map[string]string
+		warning   float64
+		critical  float64
+	}{
+		{namespace: "dev-alice", warning: 90, critical: 110},
+		{namespace: "dev-alice", labels: map[string]string{"tier": "batch"}, warning: 90, critical: 110}, // first match wins
+		{namespace: "prod", labels: map[string]string{"tier": "batch"}, warning: 75, critical: 100},
+		{namespace: "payments", labels: map[string]string{"tier": "web"}, warning: 60, critical: DefaultCriticalThreshold},
+		{namespace: "payments", labels: map[string]string{"tier": "db"}, warning: 75, critical: DefaultCriticalThreshold},
+	}
+	for _, tt := range tests {
+		warning, critical := file.Thresholds.For(tt.namespace, tt.labels, 80)
+		if warning != tt.warning || critical != tt.critical {
+			t.Errorf("For(%s, %v) = %v/%v, want %v/%v", tt.namespace, tt.labels, warning, critical, tt.warning, tt.critical)
+		}
+	}
+
+	// Without a config file the fallback warning threshold applies
+	var none *Thresholds
+	if warning, critical := none.For("default", nil, 80); warning != 80 || critical != DefaultCriticalThreshold {
+		t.Errorf("nil thresholds = %v/%v", warning, critical)
+	}
+}
+
+func TestLoadFile_Budgets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `budgets:
+- namespace: payments
+  memory: 64Gi
+  cpu: 32
+- namespace: "team-*"
+  cpu: 500m
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := LoadFile(path, true)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	payments := file.Budgets.For("payments")
+	if payments == nil || payments.Memory.Value() != 64<<30 || payments.CPU.MilliValue() != 32000 {
+		t.Errorf("expected the payments budget, got %+v", payments)
+	}
+	team := file.Budgets.For("team-a")
+	if team == nil || team.Memory != nil || team.CPU.MilliValue() != 500 {
+		t.Errorf("expected the team CPU budget, got %+v", team)
+	}
+	if budget := file.Budgets.For("default"); budget != nil {
+		t.Errorf("expected no budget for default, got %+v", budget)
+	}
+}
+
+func TestLoadFile_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	if file, err := LoadFile(filepath.Join(dir, "missing.yaml"), false); err != nil || file.Thresholds != nil {
+		t.Errorf("optional missing file: expected empty config, got %+v, %v", file, err)
+	}
+	if _, err := LoadFile(filepath.Join(dir, "missing.yaml"), true); err == nil {
+		t.Error("required missing file: expected error")
+	}
+
+	tests := map[string]string{
+		"unknown field":     "thresholds:\n  warn: 80\n",
+		"negative":          "thresholds:\n  critical: -1\n",
+		"empty policy":      "thresholds:\n  policies:\n  - warning: 90\n",
+		"invalid selector":  "thresholds:\n  policies:\n  - selector: 'tier in web'\n",
+		"invalid namespace": "thresholds:\n  policies:\n  - namespace: 'dev-['\n",
+		"empty budget":      "budgets:\n- namespace: payments\n",
+		"negative budget":   "budgets:\n- namespace: payments\n  memory: -1Gi\n",
+		"invalid quantity":  "budgets:\n- namespace: payments\n  cpu: lots\n",
+		"budget pattern":    "budgets:\n- namespace: 'team-['\n  cpu: 1\n",
+	}
+	for name, data := range tests {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-")+".yaml")
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadFile(path, true); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Package config - policy rules evaluated by the check command
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// Policy is a set of rules the check command evaluates against the collected
+// rows and container specifications.
+//
+//	rules:
+//	- name: memory-ceiling
+//	  maxPercent: 90
+//	  namespace: "prod-*"
+//	  exceptions: ["prod-batch/Job/*"]
+//	- name: cpu-ceiling
+//	  resource: cpu
+//	  maxPercent: 150
+//	- name: memory-limits
+//	  requireLimits: [memory]
+//	- name: no-unlimited
+//	  forbidUnlimited: true
+type Policy struct {
+	// Rules are evaluated independently and reported in order
+	Rules []Rule `json:"rules"`
+}
+
+// Rule is a single policy check. Exactly one of MaxPercent, RequireLimits and
+// ForbidUnlimited is set. A rule applies to the pods matching both its
+// namespace pattern and its selector, if set, except the excepted workloads.
+type Rule struct {
+	// Name identifies the rule in the report
+	Name string `json:"name"`
+	// Namespace is a glob pattern matched against the namespace (e.g. "prod-*")
+	Namespace string `json:"namespace,omitempty"`
+	// Selector is a Kubernetes label selector matched against the pod labels
+	Selector string `json:"selector,omitempty"`
+	// Exceptions are glob patterns matched against namespace/Kind/name of the
+	// owning workload, or namespace/Pod/name for pods without an owner
+	Exceptions []string `json:"exceptions,omitempty"`
+
+	// MaxPercent is the highest usage percentage of the limit a row may report
+	MaxPercent *float64 `json:"maxPercent,omitempty"`
+	// Resource is the resource MaxPercent applies to (default: memory)
+	Resource ResourceKind `json:"resource,omitempty"`
+	// RequireLimits lists the resources every container must set a limit for
+	RequireLimits []ResourceKind `json:"requireLimits,omitempty"`
+	// ForbidUnlimited rejects containers that set no limit at all
+	ForbidUnlimited bool `json:"forbidUnlimited,omitempty"`
+
+	selector labels.Selector
+}
+
+// LoadPolicy reads and validates the policy file at path.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file %s: %w", path, err)
+	}
+	if err := policy.compile(); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+
+	return policy, nil
+}
+
+// compile validates the rules, applies defaults and parses the rule selectors.
+func (p *Policy) compile() error {
+	if len(p.Rules) == 0 {
+		return errors.New("no rules defined")
+	}
+
+	names := make(map[string]bool, len(p.Rules))
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d: name is required", i+1)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rule %d: duplicate name %q", i+1, rule.Name)
+		}
+		names[rule.Name] = true
+
+		if err := rule.compile(); err != nil {
+			return fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// compile validates a single rule.
+func (r *Rule) compile() error {
+	checks := 0
+	if r.MaxPercent != nil {
+		checks++
+		if err := checkThresholds(*r.MaxPercent); err != nil {
+			return fmt.Errorf("maxPercent: %w", err)
+		}
+		if r.Resource == "" {
+			r.Resource = ResourceMemory
+		}
+	}
+	if len(r.RequireLimits) > 0 {
+		checks++
+	}
+	if r.ForbidUnlimited {
+		checks++
+	}
+	if checks != 1 {
+		return errors.New("exactly one of maxPercent, requireLimits or forbidUnlimited is required")
+	}
+
+	if r.Resource != "" && r.MaxPercent == nil {
+		return errors.New("resource only applies to maxPercent")
+	}
+	for _, resource := range append([]ResourceKind{r.Resource}, r.RequireLimits...) {
+		if resource != "" && resource != ResourceMemory && resource != ResourceCPU {
+			return fmt.Errorf("invalid resource %q (expected memory|cpu)", resource)
+		}
+	}
+
+	for _, pattern := range r.Exceptions {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exception pattern %q: %w", pattern, err)
+		}
+	}
+
+	selector, err := compileScope(r.Namespace, r.Selector)
+	if err != nil {
+		return err
+	}
+	r.selector = selector
+
+	return nil
+}
+
+// Resources returns the distinct resources of the maxPercent rules, in rule order.
+func (p *Policy) Resources() []ResourceKind {
+	var resources []ResourceKind
+	seen := make(map[ResourceKind]bool)
+	for _, rule := range p.Rules {
+		if rule.MaxPercent != nil && !seen[rule.Resource] {
+			seen[rule.Resource] = true
+			resources = append(resources, rule.Resource)
+		}
+	}
+	return resources
+}
+
+// Matches returns true if the rule applies to a pod in namespace with podLabels.
+func (r Rule) Matches(namespace string, podLabels map[string]string) bool {
+	return inScope(r.Namespace, r.selector, namespace, podLabels)
+}
+
+// Excepted returns true if the workload owner (Kind/Name) in namespace is
+// exempt from the rule. Pods without an owner are identified as Pod/podName.
+func (r Rule) Excepted(namespace, owner, podName string) bool {
+	if owner == "" {
+		owner = "Pod/" + podName
+	}
+	workload := namespace + "/" + owner
+	for _, pattern := range r.Exceptions {
+		if ok, _ := path.Match(pattern, workload); ok {
+			return true
+		}
+	}
+	return false
+}
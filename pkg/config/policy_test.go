@@ -0,0 +1,86 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	data := `rules:
+- name: memory-ceiling
+  maxPercent: 90
+  namespace: "prod-*"
+  exceptions: ["prod-batch/Job/*", "*/Pod/debug"]
+- name: cpu-ceiling
+  resource: cpu
+  maxPercent: 150
+- name: limits
+  requireLimits: [memory]
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy failed: %v", err)
+	}
+
+	if got := policy.Resources(); !reflect.DeepEqual(got, []ResourceKind{ResourceMemory, ResourceCPU}) {
+		t.Errorf("unexpected resources %v", got)
+	}
+
+	rule := policy.Rules[0]
+	if !rule.Matches("prod-eu", nil) || rule.Matches("dev", nil) {
+		t.Error("namespace pattern not applied")
+	}
+	tests := []struct {
+		namespace, owner, pod string
+		excepted              bool
+	}{
+		{namespace: "prod-batch", owner: "Job/import-123", pod: "import-123-x", excepted: true},
+		{namespace: "prod-batch", owner: "Deployment/api", pod: "api-x"},
+		{namespace: "prod-eu", pod: "debug", excepted: true},
+		{namespace: "prod-eu", owner: "StatefulSet/debug", pod: "debug-0"},
+	}
+	for _, tt := range tests {
+		if got := rule.Excepted(tt.namespace, tt.owner, tt.pod); got != tt.excepted {
+			t.Errorf("Excepted(%s, %s, %s) = %v, want %v", tt.namespace, tt.owner, tt.pod, got, tt.excepted)
+		}
+	}
+}
+
+func TestLoadPolicy_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := LoadPolicy(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("missing file: expected error")
+	}
+
+	tests := map[string]string{
+		"no rules":          "rules: []\n",
+		"unknown field":     "rules:\n- name: a\n  maxPct: 90\n",
+		"missing name":      "rules:\n- maxPercent: 90\n",
+		"duplicate name":    "rules:\n- name: a\n  maxPercent: 90\n- name: a\n  forbidUnlimited: true\n",
+		"no check":          "rules:\n- name: a\n",
+		"two checks":        "rules:\n- name: a\n  maxPercent: 90\n  forbidUnlimited: true\n",
+		"negative percent":  "rules:\n- name: a\n  maxPercent: -1\n",
+		"invalid resource":  "rules:\n- name: a\n  requireLimits: [gpu]\n",
+		"stray resource":    "rules:\n- name: a\n  resource: cpu\n  forbidUnlimited: true\n",
+		"invalid exception": "rules:\n- name: a\n  forbidUnlimited: true\n  exceptions: ['ns/[']\n",
+		"invalid selector":  "rules:\n- name: a\n  forbidUnlimited: true\n  selector: 'tier in web'\n",
+	}
+	for name, data := range tests {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-")+".yaml")
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadPolicy(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
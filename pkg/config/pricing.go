@@ -0,0 +1,120 @@
+// Package config - resource prices of cost estimates
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Pricing are the resource prices of --pricing, turning usage into an hourly
+// cost. Pods on nodes whose pool label matches the pattern of a pool are
+// priced at that pool, e.g. spot capacity, and other pods at the defaults.
+// Prices are in any currency, as long as they are in the same one.
+//
+//	cpuCoreHour: 0.0316
+//	memoryGiBHour: 0.0042
+//	poolLabel: cloud.google.com/gke-nodepool
+//	pools:
+//	- pool: "spot-*"
+//	  cpuCoreHour: 0.0095
+//	  memoryGiBHour: 0.0013
+type Pricing struct {
+	Price
+	// PoolLabel is the node label the pools are matched against
+	PoolLabel string `json:"poolLabel,omitempty"`
+	// Pools are the prices of node pools, matched in order
+	Pools []PoolPrice `json:"pools,omitempty"`
+}
+
+// Price is the cost of a CPU core and a GiB of memory for an hour.
+type Price struct {
+	// CPUCoreHour is the cost of one CPU core for an hour
+	CPUCoreHour float64 `json:"cpuCoreHour"`
+	// MemoryGiBHour is the cost of one GiB of memory for an hour
+	MemoryGiBHour float64 `json:"memoryGiBHour"`
+}
+
+// PoolPrice is the price of the nodes whose pool label matches a glob pattern.
+type PoolPrice struct {
+	// Pool is a glob pattern matched against the pool label (e.g. "spot-*")
+	Pool string `json:"pool"`
+	Price
+}
+
+// LoadPricing reads and validates the pricing file at path.
+func LoadPricing(path string) (*Pricing, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pricing file: %w", err)
+	}
+
+	pricing := &Pricing{}
+	if err := yaml.UnmarshalStrict(data, pricing); err != nil {
+		return nil, fmt.Errorf("failed to parse pricing file %s: %w", path, err)
+	}
+	if err := pricing.validate(); err != nil {
+		return nil, fmt.Errorf("invalid pricing file %s: %w", path, err)
+	}
+
+	return pricing, nil
+}
+
+// validate checks that there is a price, that no price is negative and that
+// pools have a label to match and valid glob patterns.
+func (p *Pricing) validate() error {
+	if p.CPUCoreHour == 0 && p.MemoryGiBHour == 0 && len(p.Pools) == 0 {
+		return errors.New("no cpuCoreHour, memoryGiBHour or pools prices defined")
+	}
+	if err := p.Price.validate(); err != nil {
+		return err
+	}
+	if len(p.Pools) > 0 && p.PoolLabel == "" {
+		return errors.New("pools require a poolLabel")
+	}
+	for i, pool := range p.Pools {
+		if pool.Pool == "" {
+			return fmt.Errorf("pool price %d: pool is required", i+1)
+		}
+		if _, err := path.Match(pool.Pool, ""); err != nil {
+			return fmt.Errorf("pool price %d: invalid pool pattern %q: %w", i+1, pool.Pool, err)
+		}
+		if err := pool.Price.validate(); err != nil {
+			return fmt.Errorf("pool price %s: %w", pool.Pool, err)
+		}
+	}
+	return nil
+}
+
+// validate checks that neither price is negative.
+func (p Price) validate() error {
+	if p.CPUCoreHour < 0 {
+		return fmt.Errorf("cpuCoreHour must not be negative, got %v", p.CPUCoreHour)
+	}
+	if p.MemoryGiBHour < 0 {
+		return fmt.Errorf("memoryGiBHour must not be negative, got %v", p.MemoryGiBHour)
+	}
+	return nil
+}
+
+// For returns the price of the first pool matching pool, or the default price
+// when none does or the pool is not known.
+func (p *Pricing) For(pool string) Price {
+	if pool != "" {
+		for _, price := range p.Pools {
+			if ok, _ := path.Match(price.Pool, pool); ok {
+				return price.Price
+			}
+		}
+	}
+	return p.Price
+}
+
+// Cost returns the hourly cost of millicores of CPU and mebibytes of memory.
+func (p Price) Cost(millicores int64, mebibytes float64) float64 {
+	return float64(millicores)/1000*p.CPUCoreHour + mebibytes/1024*p.MemoryGiBHour
+}
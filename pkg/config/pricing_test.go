@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadPricing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.yaml")
+	data := `cpuCoreHour: 0.04
+memoryGiBHour: 0.005
+poolLabel: cloud.google.com/gke-nodepool
+pools:
+- pool: "spot-*"
+  cpuCoreHour: 0.01
+  memoryGiBHour: 0.002
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pricing, err := LoadPricing(path)
+	if err != nil {
+		t.Fatalf("LoadPricing failed: %v", err)
+	}
+
+	tests := []struct {
+		pool string
+		want Price
+	}{
+		{pool: "spot-a", want: Price{CPUCoreHour: 0.01, MemoryGiBHour: 0.002}},
+		{pool: "standard", want: Price{CPUCoreHour: 0.04, MemoryGiBHour: 0.005}},
+		{want: Price{CPUCoreHour: 0.04, MemoryGiBHour: 0.005}},
+	}
+	for _, tt := range tests {
+		if got := pricing.For(tt.pool); got != tt.want {
+			t.Errorf("For(%q) = %+v, expected %+v", tt.pool, got, tt.want)
+		}
+	}
+
+	if got := pricing.For("standard").Cost(500, 2048); got != 0.03 {
+		t.Errorf("expected half a core and 2 GiB to cost 0.03, got %v", got)
+	}
+}
+
+func TestLoadPricing_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"empty":           "poolLabel: pool\n",
+		"negative price":  "cpuCoreHour: -1\n",
+		"pools no label":  "pools:\n- pool: spot\n  cpuCoreHour: 0.01\n",
+		"missing pool":    "poolLabel: pool\npools:\n- cpuCoreHour: 0.01\n",
+		"invalid pattern": "poolLabel: pool\npools:\n- pool: \"[\"\n  cpuCoreHour: 0.01\n",
+		"negative pool":   "poolLabel: pool\npools:\n- pool: spot\n  memoryGiBHour: -0.01\n",
+		"unknown field":   "cpuHour: 0.04\n",
+	}
+	for name, data := range tests {
+		path := filepath.Join(t.TempDir(), "pricing.yaml")
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadPricing(path)
+		if err == nil || !strings.Contains(err.Error(), "pricing file") {
+			t.Errorf("%s: expected a pricing file error, got %v", name, err)
+		}
+	}
+}
@@ -5,11 +5,18 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"math"
+	"path"
 	"regexp"
 	"strings"
 	"time"
 )
 
+// DefaultSidecarPatterns are the container and image names of common
+// service-mesh proxies and agents injected next to application containers.
+const DefaultSidecarPatterns = "istio-proxy,proxyv2,linkerd-proxy,envoy*,consul-dataplane,cloud-sql-proxy,vault-agent*,fluent-bit"
+
 // Mode represents the analysis mode for resource usage calculation.
 type Mode string
 
@@ -18,6 +25,30 @@ const (
 	ModePods Mode = "pods"
 	// ModeContainers analyzes resource usage at the container level
 	ModeContainers Mode = "containers"
+	// ModeChargeback reports per-group consumed and reserved resources over a period
+	ModeChargeback Mode = "chargeback"
+	// ModePools reports capacity and consumption per node pool
+	ModePools Mode = "pools"
+	// ModePending reports unschedulable pods against free node capacity
+	ModePending Mode = "pending"
+	// ModeVolumes reports persistent volume claim usage against capacity
+	ModeVolumes Mode = "volumes"
+	// ModeFragmentation reports free node capacity the typical pod shape cannot use
+	ModeFragmentation Mode = "fragmentation"
+	// ModeSidecars reports the share of pod usage and limits sidecar containers account for
+	ModeSidecars Mode = "sidecars"
+	// ModeNodes reports the allocation, resource usage and filesystem usage of every node
+	ModeNodes Mode = "nodes"
+	// ModeSnapshots lists the snapshots saved by snapshot save
+	ModeSnapshots Mode = "snapshots"
+	// ModeRecommend suggests container requests and limits from observed usage
+	ModeRecommend Mode = "recommend"
+	// ModeQuota reports namespace usage against ResourceQuota hard limits
+	ModeQuota Mode = "quota"
+	// ModeWaste reports the reserved resources pods leave unused
+	ModeWaste Mode = "waste"
+	// ModeDoctor checks the components pod metrics are served through
+	ModeDoctor Mode = "doctor"
 )
 
 // ResourceKind represents the type of Kubernetes resource to analyze.
@@ -28,6 +59,9 @@ const (
 	ResourceMemory ResourceKind = "memory"
 	// ResourceCPU analyzes CPU usage and limits
 	ResourceCPU ResourceKind = "cpu"
+	// ResourceAll analyzes memory and CPU side by side, ranking rows by the
+	// higher of the two percentages
+	ResourceAll ResourceKind = "all"
 )
 
 // SortKey represents the sorting strategy for results.
@@ -40,6 +74,100 @@ const (
 	SortByUsage SortKey = "usage"
 	// SortByLimit sorts by raw limit values (descending)
 	SortByLimit SortKey = "limit"
+	// SortByRestarts sorts by container restart count (descending)
+	SortByRestarts SortKey = "restarts"
+	// SortByScore sorts by the result of the score expression (descending)
+	SortByScore SortKey = "score"
+	// SortByThrottle sorts by the share of CFS periods throttled (descending)
+	SortByThrottle SortKey = "throttle"
+	// SortByForecast sorts by the hours until memory reaches the limit (ascending)
+	SortByForecast SortKey = "forecast"
+)
+
+// OutputFormat represents the presentation format of the results.
+type OutputFormat string
+
+const (
+	// OutputTable renders the default aligned table
+	OutputTable OutputFormat = "table"
+	// OutputWide renders the table with additional diagnostic columns
+	OutputWide OutputFormat = "wide"
+	// OutputCSV renders comma-separated values (chargeback reports)
+	OutputCSV OutputFormat = "csv"
+	// OutputJSON renders the result rows as a JSON array
+	OutputJSON OutputFormat = "json"
+)
+
+// IsPlugin reports whether the format is rendered by an external
+// kusage-output-<name> plugin rather than a built-in formatter.
+func (f OutputFormat) IsPlugin() bool {
+	switch f {
+	case "", OutputTable, OutputWide, OutputJSON:
+		return false
+	default:
+		return true
+	}
+}
+
+// LimitsSource is where pod limits, requests and metadata are read from.
+type LimitsSource string
+
+const (
+	// LimitsSourceAPI lists pods through the Kubernetes API
+	LimitsSourceAPI LimitsSource = "api"
+	// LimitsSourceKubeStateMetrics reads kube-state-metrics series from Prometheus
+	LimitsSourceKubeStateMetrics LimitsSource = "kube-state-metrics"
+)
+
+// UsageSource is where pod usage is read from.
+type UsageSource string
+
+const (
+	// UsageSourceMetricsServer reads the latest sample from the metrics API
+	UsageSourceMetricsServer UsageSource = "metrics-server"
+	// UsageSourcePrometheus aggregates cAdvisor series over a range from Prometheus
+	UsageSourcePrometheus UsageSource = "prometheus"
+	// UsageSourceDatadog aggregates kubelet check metrics over a range from Datadog
+	UsageSourceDatadog UsageSource = "datadog"
+	// UsageSourceCAdvisor scrapes the kubelet cAdvisor endpoint of every node through the API server
+	UsageSourceCAdvisor UsageSource = "cadvisor"
+)
+
+// GroupKey represents the attribute pod rows are summed by.
+type GroupKey string
+
+const (
+	// GroupByNode sums the pods scheduled on each node
+	GroupByNode GroupKey = "node"
+	// GroupByContainerName merges the containers of the same name across the
+	// replicas of a workload
+	GroupByContainerName GroupKey = "container-name"
+)
+
+// CostByNamespace is the CostBy rolling costs up per namespace rather than
+// per value of a pod label.
+const CostByNamespace = "namespace"
+
+// Aggregation is how usage samples over a range are combined into one value.
+type Aggregation string
+
+const (
+	// AggregationAvg averages the samples
+	AggregationAvg Aggregation = "avg"
+	// AggregationMax takes the highest sample
+	AggregationMax Aggregation = "max"
+	// AggregationP95 takes the 95th percentile of the samples
+	AggregationP95 Aggregation = "p95"
+)
+
+// WasteBasis is the reservation unused resources are measured against.
+type WasteBasis string
+
+const (
+	// WasteBasisRequests measures unused resources against the requests
+	WasteBasisRequests WasteBasis = "requests"
+	// WasteBasisLimits measures unused resources against the limits
+	WasteBasisLimits WasteBasis = "limits"
 )
 
 // Options contains all configuration parameters for the kusage tool.
@@ -50,6 +178,13 @@ type Options struct {
 	Namespace string
 	// AllNamespaces indicates whether to analyze across all namespaces
 	AllNamespaces bool
+	// NamespacePattern is a glob of the namespaces to analyze (e.g. team-*),
+	// matched against the namespace list when -n contains a wildcard
+	NamespacePattern string
+	// Namespaces lists the namespaces to query with AllNamespaces, resolved
+	// by the collector from NamespacePattern and ExcludeNamespaces so that
+	// excluded namespaces are never listed. Empty queries the whole cluster.
+	Namespaces []string
 	// LabelSelector is a Kubernetes label selector for filtering resources
 	LabelSelector string
 	// ExcludeNamespaces is a compiled regex for excluding namespaces
@@ -66,8 +201,175 @@ type Options struct {
 	TopN int
 	// NoHeaders suppresses table headers in output
 	NoHeaders bool
+	// Output determines the presentation format of the results
+	Output OutputFormat
 	// Timeout configures the context timeout for Kubernetes API calls
 	Timeout time.Duration
+	// CacheTTL reuses the rows collected by a previous run against the same
+	// cluster and scope while they are younger than this (0 disables caching)
+	CacheTTL time.Duration
+	// NodeSubtotals groups table rows by node and prints a subtotal per node
+	NodeSubtotals bool
+	// IncludeCompleted keeps pods that ran to completion (phase Succeeded) in
+	// the pods and containers views
+	IncludeCompleted bool
+	// ExcludeCrashLoop drops pods with a container waiting in CrashLoopBackOff
+	// from the pods and containers views instead of marking their rows
+	ExcludeCrashLoop bool
+	// SampleFraction analyzes only this fraction of the pods, chosen by a hash
+	// of their namespace and name so runs sample the same pods; 0 or 1 analyze all
+	SampleFraction float64
+	// IncludeNoLimit keeps pods and containers without a limit of the analyzed
+	// resource, reported with their usage and no percentage
+	IncludeNoLimit bool
+	// LimitRanges gives containers without a limit the default limit of the
+	// LimitRange of their namespace, marking their rows as defaulted
+	LimitRanges bool
+	// Forecast estimates the hours until memory usage reaches the limit from its
+	// growth over the range of a history usage source
+	Forecast bool
+	// GroupBy, when set, replaces the pod rows with one row per group summing
+	// the usage and limits of its pods
+	GroupBy GroupKey
+	// CronJobAggregation, when set, merges the rows of pods created by CronJob
+	// executions into one row per CronJob, combining executions by max or avg
+	CronJobAggregation Aggregation
+	// ShowDensity adds the pods scheduled on each node against its pod capacity to the nodes report
+	ShowDensity bool
+	// SchedulableOnly leaves cordoned nodes and nodes with NoSchedule or
+	// NoExecute taints out of the capacity total of the nodes report
+	SchedulableOnly bool
+	// ShowNetwork adds pod network receive and transmit rates from the kubelet Summary API
+	ShowNetwork bool
+	// SummaryOnly prints aggregate statistics instead of per-row output
+	SummaryOnly bool
+	// Threshold is the usage percentage counted as "over threshold" in the summary
+	// and the default warning threshold
+	Threshold float64
+	// Thresholds are the warning and critical thresholds read from the config file
+	Thresholds *Thresholds
+	// Color highlights usage percentages at or above their thresholds
+	Color bool
+	// LogLevel controls the verbosity of diagnostic logging
+	LogLevel slog.Level
+	// CostCenterKey is the namespace label or annotation rows are attributed by;
+	// when set, a per cost center report is printed instead of the table
+	CostCenterKey string
+	// GroupLabel is the pod label chargeback totals are grouped by
+	GroupLabel string
+	// Period is the chargeback reporting period, ending now
+	Period time.Duration
+	// PrometheusURL is the base URL of the Prometheus-compatible query API
+	PrometheusURL string
+	// PrometheusHeaders are sent with every Prometheus query (e.g. Authorization)
+	PrometheusHeaders map[string]string
+	// PrometheusTenant is sent as X-Scope-OrgID to multi-tenant stores
+	PrometheusTenant string
+	// PrometheusTimeout is the query evaluation timeout requested from the server
+	PrometheusTimeout time.Duration
+	// LimitsSource is where pod limits and requests are read from (default: the Kubernetes API)
+	LimitsSource LimitsSource
+	// Source is where pod usage is read from (default: metrics-server)
+	Source UsageSource
+	// UsageRange is the period usage is aggregated over with the Prometheus and Datadog sources
+	UsageRange time.Duration
+	// Aggregation combines the usage samples over UsageRange
+	Aggregation Aggregation
+	// PoolLabel is the node label nodes are grouped into pools by
+	PoolLabel string
+	// GrowthWindow is how far back pool usage growth is measured when
+	// a Prometheus URL is configured
+	GrowthWindow time.Duration
+	// SidecarPatterns are the glob patterns matched against container names
+	// and image names to tell sidecars from application containers
+	SidecarPatterns []string
+	// PodCPUMc and PodMemoryMi override the typical pod shape free capacity is
+	// packed with in the fragmentation report (default: the mean pod request)
+	PodCPUMc    int64
+	PodMemoryMi float64
+	// Contexts are the kubeconfig contexts the analysis collects from
+	// concurrently, ranking their rows together
+	Contexts []string
+	// Compare shows the results of the two Contexts side by side instead
+	Compare bool
+	// LabelColumns are the pod labels whose values are shown as columns (-L)
+	LabelColumns []string
+	// Context, Kubeconfig and Cluster override the kubeconfig context, file
+	// and cluster the API clients are created from (default: as kubectl)
+	Context    string
+	Kubeconfig string
+	Cluster    string
+	// Listen is the address serve mode exposes the collected rows on as
+	// Prometheus metrics
+	Listen string
+	// Budgets are the namespace usage budgets serve mode exposes usage against
+	Budgets Budgets
+	// Interval is the time between the collections of serve mode, or between
+	// the samples of Samples
+	Interval time.Duration
+	// Samples is the number of collections whose usage is merged into the
+	// min, avg, p95 and max of every row (1 reads usage once)
+	Samples int
+	// Watch refreshes the table every interval until interrupted, marking the
+	// rows that changed since the previous refresh (0 disables watch mode)
+	Watch time.Duration
+	// WatchDelta is the change of the percentage, in percentage points, that
+	// marks a row in watch mode
+	WatchDelta float64
+	// SaveSnapshot saves the collected rows to SnapshotDir instead of printing them
+	SaveSnapshot bool
+	// SnapshotDir is the directory snapshots are saved to and listed from
+	SnapshotDir string
+	// Export writes every sample of every container as a CSV row instead of
+	// printing the table
+	Export bool
+	// ExportLabels adds a column per pod label to the exported rows
+	ExportLabels bool
+	// RequestHeadroom multiplies the peak usage into the suggested requests
+	// of recommend mode
+	RequestHeadroom float64
+	// LimitHeadroom multiplies the peak usage into the suggested limits of
+	// recommend mode (0 suggests no limits)
+	LimitHeadroom float64
+	// PatchDir is the directory recommend mode writes a patch per workload to
+	PatchDir string
+	// Kustomize adds a kustomize component applying the patches of PatchDir
+	Kustomize bool
+	// KubectlPatches prints a kubectl patch command per workload instead of
+	// the recommendations table
+	KubectlPatches bool
+	// WasteBasis is the reservation waste mode measures unused resources against
+	WasteBasis WasteBasis
+	// MinDelta hides compared workloads whose usage percentage changed by fewer points
+	MinDelta float64
+	// Policy holds the rules evaluated by the check command
+	Policy *Policy
+	// Baseline is the file of accepted workload percentages the check command
+	// detects regressions against
+	Baseline string
+	// UpdateBaseline records the current workload percentages as the baseline
+	UpdateBaseline bool
+	// Tolerance is how many percentage points a workload may exceed its
+	// baseline by before it counts as a regression
+	Tolerance float64
+	// WhyPod is the name of a pod to trace through the filter and correlation pipeline
+	WhyPod string
+	// ScoreExpr is a compiled CEL expression whose result populates the SCORE column
+	ScoreExpr *Expression
+	// Weights multiply the score of every row by the weight of its priority
+	// class or namespace tier; without ScoreExpr the percentage is weighted
+	Weights *Weights
+	// Pricing prices the rows into an hourly COST column
+	Pricing *Pricing
+	// CostBy is the pod label the costs of the rows are rolled up by below
+	// the table, or CostByNamespace; requires Pricing
+	CostBy string
+	// FilterExpr is a compiled boolean CEL expression; rows for which it is false are dropped
+	FilterExpr *Expression
+	// MinPercentage drops rows below this usage percentage, and rows without a limit
+	MinPercentage *float64
+	// MaxPercentage drops rows above this usage percentage, and rows without a limit
+	MaxPercentage *float64
 
 	// Performance and scale options for large clusters
 	// PageSize controls the number of items fetched per API call
@@ -76,8 +378,39 @@ type Options struct {
 	MaxConcurrency int
 	// EnableMetrics enables detailed performance metrics collection
 	EnableMetrics bool
+	// MetricsOutput is where the metrics summary is written as JSON:
+	// a file path, "-" for stderr, or empty to log it
+	MetricsOutput string
 	// MaxMemoryMB sets the maximum memory usage limit in megabytes
 	MaxMemoryMB int64
+	// LowMemory streams pages of pods and metrics into a bounded top-N heap
+	// so peak memory does not grow with the number of rows
+	LowMemory bool
+	// Strict fails the run when more than StrictThreshold percent of the pod
+	// metrics belong to pods missing from the pod list
+	Strict bool
+	// StrictThreshold is the percentage of unmatched pod metrics Strict tolerates
+	StrictThreshold float64
+	// FailAbove fails the run when the usage percentage of any printed row
+	// exceeds the threshold of a resource
+	FailAbove map[ResourceKind]float64
+	// DryRun prints the requests the analysis would issue instead of issuing them
+	DryRun bool
+	// DebugBundle is the path of a diagnostic bundle (.tar.gz) to write, if any
+	DebugBundle string
+	// DebugBundleResponses includes the raw API responses in the diagnostic bundle
+	DebugBundleResponses bool
+	// APIImpact reports the requests the run issued, per endpoint, on stderr
+	APIImpact bool
+	// GCPercent sets the garbage collection target percentage (-1 disables
+	// collection until the memory limit is approached, 0 keeps the default)
+	GCPercent int
+}
+
+// Scored reports whether rows are scored, by a score expression, weights or
+// both, and so have a SCORE column.
+func (o *Options) Scored() bool {
+	return o.ScoreExpr != nil || o.Weights != nil
 }
 
 // Validate performs comprehensive validation of the configuration options.
@@ -94,6 +427,11 @@ func (o *Options) Validate() error {
 		return fmt.Errorf("top must be non-negative, got %d", o.TopN)
 	}
 
+	// Validate summary threshold
+	if math.IsNaN(o.Threshold) || o.Threshold < 0 {
+		return fmt.Errorf("threshold must be non-negative, got %v", o.Threshold)
+	}
+
 	// Validate label selector format (basic validation)
 	if o.LabelSelector != "" {
 		// Basic validation - more comprehensive validation happens in the collector
@@ -102,6 +440,339 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	// Validate namespace glob syntax
+	if o.NamespacePattern != "" {
+		if _, err := path.Match(o.NamespacePattern, ""); err != nil {
+			return fmt.Errorf("invalid namespace pattern %q: %w", o.NamespacePattern, err)
+		}
+	}
+
+	// Chargeback reports are computed from Prometheus history
+	if o.Mode == ModeChargeback {
+		if o.PrometheusURL == "" {
+			return fmt.Errorf("chargeback requires a prometheus url")
+		}
+		if o.GroupLabel == "" {
+			return fmt.Errorf("chargeback requires a group label")
+		}
+		if o.Period <= 0 {
+			return fmt.Errorf("period must be positive, got %v", o.Period)
+		}
+	}
+
+	// Node-pool reports group nodes by a label
+	if o.Mode == ModePools {
+		if o.PoolLabel == "" {
+			return fmt.Errorf("pools requires a pool label")
+		}
+		if o.GrowthWindow <= 0 {
+			return fmt.Errorf("growth window must be positive, got %v", o.GrowthWindow)
+		}
+	}
+
+	// Executions are combined by their largest or mean usage
+	switch o.CronJobAggregation {
+	case "", AggregationAvg, AggregationMax:
+	default:
+		return fmt.Errorf("cronjob executions can only be combined by avg or max, got %q", o.CronJobAggregation)
+	}
+
+	// Pods are summed per node, or containers merged per workload, instead of listed
+	switch o.GroupBy {
+	case "":
+	case GroupByNode:
+		if o.Mode != ModePods {
+			return fmt.Errorf("group-by node requires pods mode")
+		}
+		if o.NodeSubtotals || o.CronJobAggregation != "" || o.CostCenterKey != "" || o.ShowNetwork || o.WhyPod != "" || o.LowMemory || len(o.Contexts) > 0 {
+			return fmt.Errorf("group-by node cannot be combined with --node-subtotals, --group-cronjobs, --cost-center, --show-network, --why, --low-memory or --contexts")
+		}
+	case GroupByContainerName:
+		if o.Mode != ModeContainers {
+			return fmt.Errorf("group-by container-name requires containers mode")
+		}
+		if o.Resource == ResourceAll {
+			return fmt.Errorf("group-by container-name requires the memory or cpu resource")
+		}
+		if o.NodeSubtotals || o.CronJobAggregation != "" || o.CostCenterKey != "" || o.WhyPod != "" || o.LowMemory {
+			return fmt.Errorf("group-by container-name cannot be combined with --node-subtotals, --group-cronjobs, --cost-center, --why or --low-memory")
+		}
+	default:
+		return fmt.Errorf("rows can only be grouped by node or container-name, got %q", o.GroupBy)
+	}
+
+	// Grouped rows have no labels to show
+	if len(o.LabelColumns) > 0 && o.GroupBy != "" {
+		return fmt.Errorf("label columns cannot be combined with --group-by")
+	}
+
+	// Rows without a limit have no percentage to summarize or subtotal
+	if o.IncludeNoLimit && (o.SummaryOnly || o.NodeSubtotals || o.GroupBy != "") {
+		return fmt.Errorf("include-no-limit cannot be combined with --summary-only, --node-subtotals or --group-by")
+	}
+
+	// Sidecars are told apart by name or image
+	if o.Mode == ModeSidecars && len(o.SidecarPatterns) == 0 {
+		return fmt.Errorf("sidecars requires at least one sidecar pattern")
+	}
+
+	// A custom pod shape must request something
+	if o.PodCPUMc < 0 || o.PodMemoryMi < 0 {
+		return fmt.Errorf("pod shape requests must not be negative")
+	}
+
+	// Network stats are reported per pod, shared by its containers
+	if o.ShowNetwork && o.Mode != ModePods {
+		return fmt.Errorf("show-network requires pods mode")
+	}
+
+	// Memory and CPU are analyzed side by side in the pods and containers views
+	if o.Resource == ResourceAll {
+		if o.Mode != ModePods && o.Mode != ModeContainers {
+			return fmt.Errorf("resource all requires pods or containers mode")
+		}
+		if o.SummaryOnly || o.CostCenterKey != "" || o.WhyPod != "" || o.Compare {
+			return fmt.Errorf("resource all cannot be combined with --summary-only, --cost-center, --why or cluster comparison")
+		}
+	}
+
+	// Throttling only applies to CPU limits
+	if o.Sort == SortByThrottle && o.Resource != ResourceCPU {
+		return fmt.Errorf("sort by throttle requires the cpu resource")
+	}
+
+	// Forecasts fit a line through the memory history of a usage source
+	if o.Forecast {
+		if o.Source != UsageSourcePrometheus && o.Source != UsageSourceDatadog {
+			return fmt.Errorf("forecast requires --source prometheus or datadog")
+		}
+		if o.Resource == ResourceCPU {
+			return fmt.Errorf("forecast requires the memory resource")
+		}
+	}
+	if o.Sort == SortByForecast && !o.Forecast {
+		return fmt.Errorf("sort by forecast requires --forecast")
+	}
+
+	// Sorting by score requires a score expression or weights
+	if o.Sort == SortByScore && !o.Scored() {
+		return fmt.Errorf("sort by score requires a score expression or weights")
+	}
+
+	// The cost center report replaces the other report formats
+	if o.CostCenterKey != "" && (o.SummaryOnly || o.NodeSubtotals || o.WhyPod != "" || o.Output.IsPlugin()) {
+		return fmt.Errorf("cost center report cannot be combined with --summary-only, --node-subtotals, --why or output plugins")
+	}
+
+	// Low-memory runs keep only the top rows of a stream from the metrics API
+	if o.LowMemory {
+		if o.TopN <= 0 {
+			return fmt.Errorf("low-memory requires --top greater than 0")
+		}
+		if o.SummaryOnly || o.NodeSubtotals || o.CostCenterKey != "" || o.CronJobAggregation != "" || o.WhyPod != "" || len(o.Contexts) > 0 || o.LimitRanges {
+			return fmt.Errorf("low-memory cannot be combined with --summary-only, --node-subtotals, --cost-center, --group-cronjobs, --why, --contexts or --limit-ranges")
+		}
+		if (o.Source != "" && o.Source != UsageSourceMetricsServer) || o.LimitsSource == LimitsSourceKubeStateMetrics {
+			return fmt.Errorf("low-memory reads usage from metrics-server and limits from the API")
+		}
+	}
+
+	// Unmatched pod metrics are tolerated up to a percentage
+	if math.IsNaN(o.StrictThreshold) || o.StrictThreshold < 0 || o.StrictThreshold > 100 {
+		return fmt.Errorf("strict-threshold must be between 0 and 100, got %v", o.StrictThreshold)
+	}
+
+	// Percentage ranges select rows by their percentage
+	if o.MinPercentage != nil && (math.IsNaN(*o.MinPercentage) || *o.MinPercentage < 0) {
+		return fmt.Errorf("min-pct must be non-negative, got %v", *o.MinPercentage)
+	}
+	if o.MaxPercentage != nil && (math.IsNaN(*o.MaxPercentage) || *o.MaxPercentage < 0) {
+		return fmt.Errorf("max-pct must be non-negative, got %v", *o.MaxPercentage)
+	}
+	if o.MinPercentage != nil && o.MaxPercentage != nil && *o.MinPercentage > *o.MaxPercentage {
+		return fmt.Errorf("min-pct %v must not exceed max-pct %v", *o.MinPercentage, *o.MaxPercentage)
+	}
+
+	// Pods are sampled by fraction
+	if math.IsNaN(o.SampleFraction) || o.SampleFraction < 0 || o.SampleFraction > 1 {
+		return fmt.Errorf("sample-fraction must be between 0 and 1, got %v", o.SampleFraction)
+	}
+
+	// Rows are gated on the percentages of the printed table
+	for resource, threshold := range o.FailAbove {
+		if resource != ResourceMemory && resource != ResourceCPU {
+			return fmt.Errorf("fail-above resource must be memory or cpu, got %q", resource)
+		}
+		if math.IsNaN(threshold) || threshold < 0 {
+			return fmt.Errorf("fail-above threshold of %s must be non-negative, got %v", resource, threshold)
+		}
+	}
+	if len(o.FailAbove) > 0 && (o.SummaryOnly || o.CostCenterKey != "" || o.WhyPod != "" || o.Watch > 0) {
+		return fmt.Errorf("fail-above checks the printed rows and cannot be combined with --summary-only, --cost-center, --why or --watch")
+	}
+
+	// Rows are priced by the pool of their node, which is read from a single
+	// cluster, and costs are shown with the rows
+	if o.Pricing != nil && (o.SummaryOnly || o.Watch > 0 || len(o.Contexts) > 0) {
+		return fmt.Errorf("pricing cannot be combined with --summary-only, --watch or --contexts")
+	}
+	if o.CostBy != "" && o.Pricing == nil {
+		return fmt.Errorf("cost-by requires --pricing")
+	}
+	if o.CostBy != "" && (o.CostCenterKey != "" || o.LowMemory || (o.Output != OutputTable && o.Output != OutputWide)) {
+		return fmt.Errorf("cost-by rolls all rows up below the table and cannot be combined with --cost-center, --low-memory, json output or output plugins")
+	}
+
+	// Dry runs plan the requests of a single pods or containers analysis
+	if o.DryRun && (o.WhyPod != "" || o.DebugBundle != "" || len(o.Contexts) > 0) {
+		return fmt.Errorf("dry-run cannot be combined with --why, --debug-bundle or --contexts")
+	}
+	if o.DryRun && o.APIImpact {
+		return fmt.Errorf("api-impact reports issued requests, which a dry-run does not issue")
+	}
+
+	// Cached rows replace the collection, which these modes observe
+	if o.CacheTTL < 0 {
+		return fmt.Errorf("cache-ttl must be non-negative, got %v", o.CacheTTL)
+	}
+	if o.CacheTTL > 0 && (o.LowMemory || o.DebugBundle != "" || len(o.Contexts) > 0) {
+		return fmt.Errorf("cache-ttl cannot be combined with --low-memory, --debug-bundle or --contexts")
+	}
+
+	// JSON output carries the result rows only
+	if o.Output == OutputJSON && (o.SummaryOnly || o.NodeSubtotals || o.CostCenterKey != "") {
+		return fmt.Errorf("json output cannot be combined with --summary-only, --node-subtotals or --cost-center")
+	}
+
+	// Comparisons are rendered as a side-by-side table
+	if o.Compare && (o.SummaryOnly || o.NodeSubtotals || o.WhyPod != "" || o.CostCenterKey != "" || o.DebugBundle != "" || o.Output.IsPlugin() || o.Output == OutputJSON) {
+		return fmt.Errorf("cluster comparison cannot be combined with --summary-only, --node-subtotals, --why, --cost-center, --debug-bundle, json output or output plugins")
+	}
+
+	// Rows of several contexts are ranked together, each naming its context
+	if len(o.Contexts) > 0 && !o.Compare && (o.NodeSubtotals || o.CronJobAggregation != "" || o.WhyPod != "" || o.CostCenterKey != "" || o.ShowNetwork || o.DebugBundle != "") {
+		return fmt.Errorf("contexts cannot be combined with --node-subtotals, --group-cronjobs, --why, --cost-center, --show-network or --debug-bundle")
+	}
+	if len(o.Contexts) > 0 && (o.Context != "" || o.Cluster != "") {
+		return fmt.Errorf("contexts cannot be combined with --context or --cluster")
+	}
+	if math.IsNaN(o.MinDelta) || o.MinDelta < 0 {
+		return fmt.Errorf("min-delta must be non-negative, got %v", o.MinDelta)
+	}
+
+	// Limits read from kube-state-metrics are queried from Prometheus
+	if o.LimitsSource == LimitsSourceKubeStateMetrics {
+		if o.PrometheusURL == "" {
+			return fmt.Errorf("limits source %s requires a prometheus url", o.LimitsSource)
+		}
+		if len(o.Contexts) > 0 {
+			return fmt.Errorf("limits source %s cannot be combined with --contexts", o.LimitsSource)
+		}
+	}
+
+	// Usage aggregated from Prometheus or Datadog history
+	if o.Source == UsageSourcePrometheus || o.Source == UsageSourceDatadog {
+		if o.Source == UsageSourcePrometheus && o.PrometheusURL == "" {
+			return fmt.Errorf("usage source %s requires a prometheus url", o.Source)
+		}
+		if len(o.Contexts) > 0 {
+			return fmt.Errorf("usage source %s cannot be combined with --contexts", o.Source)
+		}
+		if o.UsageRange <= 0 {
+			return fmt.Errorf("range must be positive, got %v", o.UsageRange)
+		}
+	}
+
+	// Scrapes go through the API server of the current context only
+	if o.Source == UsageSourceCAdvisor && len(o.Contexts) > 0 {
+		return fmt.Errorf("usage source %s cannot be combined with --contexts", o.Source)
+	}
+
+	// Serve mode collects pods or containers on a schedule
+	if o.Listen != "" {
+		if o.Mode != ModePods && o.Mode != ModeContainers {
+			return fmt.Errorf("serve requires pods or containers mode")
+		}
+		if o.Interval <= 0 {
+			return fmt.Errorf("interval must be positive, got %v", o.Interval)
+		}
+	}
+
+	// Samples are collected Interval apart and merged per row
+	if o.Samples < 0 {
+		return fmt.Errorf("samples must be non-negative, got %d", o.Samples)
+	}
+	if o.Samples > 1 {
+		if o.Interval <= 0 {
+			return fmt.Errorf("interval must be positive, got %v", o.Interval)
+		}
+		if o.Resource == ResourceAll && !o.Export {
+			return fmt.Errorf("samples require --resource memory or cpu")
+		}
+		if o.LowMemory || o.CacheTTL > 0 || o.WhyPod != "" {
+			return fmt.Errorf("samples cannot be combined with --low-memory, --cache-ttl or --why")
+		}
+	}
+
+	// Waste is measured against requests or limits and ranked by one resource
+	if o.Mode == ModeWaste {
+		if o.WasteBasis != WasteBasisRequests && o.WasteBasis != WasteBasisLimits {
+			return fmt.Errorf("waste basis must be requests or limits, got %q", o.WasteBasis)
+		}
+		if o.Resource != ResourceMemory && o.Resource != ResourceCPU {
+			return fmt.Errorf("waste is ranked by memory or cpu, got %q", o.Resource)
+		}
+	}
+
+	// Recommendations scale the peak usage up, never down
+	if o.Mode == ModeRecommend {
+		if math.IsNaN(o.RequestHeadroom) || o.RequestHeadroom < 1 {
+			return fmt.Errorf("request headroom must be at least 1, got %v", o.RequestHeadroom)
+		}
+		if math.IsNaN(o.LimitHeadroom) || (o.LimitHeadroom != 0 && o.LimitHeadroom < o.RequestHeadroom) {
+			return fmt.Errorf("limit headroom must be 0 or at least the request headroom %v, got %v", o.RequestHeadroom, o.LimitHeadroom)
+		}
+		if o.Kustomize && o.PatchDir == "" {
+			return fmt.Errorf("kustomize requires a patch directory")
+		}
+	}
+
+	// Exports are tidy CSV datasets of container rows
+	if o.Export && (o.Mode != ModeContainers || o.Output != OutputCSV) {
+		return fmt.Errorf("export requires containers mode and csv output")
+	}
+
+	// Watch mode refreshes a table of rows
+	if o.Watch < 0 {
+		return fmt.Errorf("watch interval must be non-negative, got %v", o.Watch)
+	}
+	if o.Watch > 0 && (o.Output == OutputJSON || o.Output.IsPlugin() || o.SummaryOnly || o.NodeSubtotals ||
+		o.CostCenterKey != "" || o.WhyPod != "" || o.DryRun || o.DebugBundle != "" || len(o.Contexts) > 0 || o.CacheTTL > 0) {
+		return fmt.Errorf("watch refreshes a table and cannot be combined with -o json, output plugins, --summary-only, " +
+			"--node-subtotals, --cost-center, --why, --dry-run, --debug-bundle, --contexts or --cache-ttl")
+	}
+	if math.IsNaN(o.WatchDelta) || o.WatchDelta < 0 {
+		return fmt.Errorf("watch-delta must be non-negative, got %v", o.WatchDelta)
+	}
+
+	// Baseline regressions are measured in percentage points
+	if math.IsNaN(o.Tolerance) || o.Tolerance < 0 {
+		return fmt.Errorf("tolerance must be non-negative, got %v", o.Tolerance)
+	}
+	if o.UpdateBaseline && o.Baseline == "" {
+		return fmt.Errorf("update-baseline requires a baseline file")
+	}
+
+	// Output plugins receive rows only
+	if o.Output.IsPlugin() && (o.SummaryOnly || o.NodeSubtotals || o.WhyPod != "") {
+		return fmt.Errorf("output plugin %q cannot be combined with --summary-only, --node-subtotals or --why", o.Output)
+	}
+
+	// Validate GC target
+	if o.GCPercent < -1 {
+		return fmt.Errorf("gc-percent must be -1 or greater, got %d", o.GCPercent)
+	}
+
 	// Validate performance options
 	if o.PageSize <= 0 {
 		o.PageSize = 500 // Default page size for large clusters
@@ -114,6 +785,9 @@ func (o *Options) Validate() error {
 	if o.MaxMemoryMB <= 0 {
 		o.MaxMemoryMB = 2048 // Default 2GB memory limit
 	}
+	if o.MaxMemoryMB > math.MaxInt64>>20 {
+		return fmt.Errorf("max-memory must not exceed %d MB, got %d", int64(math.MaxInt64>>20), o.MaxMemoryMB)
+	}
 
 	return nil
 }
@@ -0,0 +1,100 @@
+// Package config - score weights of priority and namespace tiers
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Weights are the score multipliers of --weights, so that pods of critical
+// tiers rank above batch pods at the same percentage. The weight of a pod is
+// the weight of its priority class, or else the weight of the first namespace
+// pattern it matches, or else 1.
+//
+//	priorityClasses:
+//	  system-cluster-critical: 3
+//	  high-priority: 2
+//	  batch: 0.5
+//	namespaces:
+//	- namespace: "prod-*"
+//	  weight: 1.5
+//	- namespace: "ci-*"
+//	  weight: 0.25
+type Weights struct {
+	// PriorityClasses maps priority class names to their weight
+	PriorityClasses map[string]float64 `json:"priorityClasses,omitempty"`
+	// Namespaces are the weights of namespace tiers, matched in order
+	Namespaces []NamespaceWeight `json:"namespaces,omitempty"`
+}
+
+// NamespaceWeight is the weight of the namespaces matching a glob pattern.
+type NamespaceWeight struct {
+	// Namespace is a glob pattern matched against the namespace (e.g. "prod-*")
+	Namespace string `json:"namespace"`
+	// Weight multiplies the score of the pods in matching namespaces
+	Weight float64 `json:"weight"`
+}
+
+// LoadWeights reads and validates the weights file at path.
+func LoadWeights(path string) (*Weights, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read weights file: %w", err)
+	}
+
+	weights := &Weights{}
+	if err := yaml.UnmarshalStrict(data, weights); err != nil {
+		return nil, fmt.Errorf("failed to parse weights file %s: %w", path, err)
+	}
+	if err := weights.validate(); err != nil {
+		return nil, fmt.Errorf("invalid weights file %s: %w", path, err)
+	}
+
+	return weights, nil
+}
+
+// validate checks that there is at least one weight, that every weight is
+// positive and that the namespace patterns are valid globs.
+func (w *Weights) validate() error {
+	if len(w.PriorityClasses) == 0 && len(w.Namespaces) == 0 {
+		return errors.New("no priorityClasses or namespaces weights defined")
+	}
+	for name, weight := range w.PriorityClasses {
+		if weight <= 0 {
+			return fmt.Errorf("priority class %s: weight must be positive, got %v", name, weight)
+		}
+	}
+	for i, tier := range w.Namespaces {
+		if tier.Namespace == "" {
+			return fmt.Errorf("namespace weight %d: namespace is required", i+1)
+		}
+		if _, err := path.Match(tier.Namespace, ""); err != nil {
+			return fmt.Errorf("namespace weight %d: invalid namespace pattern %q: %w", i+1, tier.Namespace, err)
+		}
+		if tier.Weight <= 0 {
+			return fmt.Errorf("namespace weight %s: weight must be positive, got %v", tier.Namespace, tier.Weight)
+		}
+	}
+	return nil
+}
+
+// For returns the weight of a pod in namespace with priorityClass.
+func (w *Weights) For(namespace, priorityClass string) float64 {
+	if w == nil {
+		return 1
+	}
+	if weight, ok := w.PriorityClasses[priorityClass]; ok && priorityClass != "" {
+		return weight
+	}
+	for _, tier := range w.Namespaces {
+		if ok, _ := path.Match(tier.Namespace, namespace); ok {
+			return tier.Weight
+		}
+	}
+	return 1
+}
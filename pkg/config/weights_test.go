@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadWeights(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weights.yaml")
+	data := `priorityClasses:
+  system-cluster-critical: 3
+  batch: 0.5
+namespaces:
+- namespace: "prod-*"
+  weight: 1.5
+- namespace: "*"
+  weight: 0.8
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	weights, err := LoadWeights(path)
+	if err != nil {
+		t.Fatalf("LoadWeights failed: %v", err)
+	}
+
+	tests := []struct {
+		namespace, priorityClass string
+		want                     float64
+	}{
+		{namespace: "prod-eu", priorityClass: "system-cluster-critical", want: 3},
+		{namespace: "prod-eu", priorityClass: "batch", want: 0.5},
+		{namespace: "prod-eu", want: 1.5},
+		{namespace: "prod-eu", priorityClass: "unlisted", want: 1.5},
+		{namespace: "dev", want: 0.8},
+	}
+	for _, tt := range tests {
+		if got := weights.For(tt.namespace, tt.priorityClass); got != tt.want {
+			t.Errorf("For(%q, %q) = %v, expected %v", tt.namespace, tt.priorityClass, got, tt.want)
+		}
+	}
+
+	var none *Weights
+	if got := none.For("prod-eu", "batch"); got != 1 {
+		t.Errorf("expected no weights to weigh 1, got %v", got)
+	}
+}
+
+func TestLoadWeights_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"empty":             "namespaces: []\n",
+		"zero weight":       "priorityClasses:\n  batch: 0\n",
+		"negative weight":   "namespaces:\n- namespace: dev\n  weight: -1\n",
+		"missing namespace": "namespaces:\n- weight: 2\n",
+		"invalid pattern":   "namespaces:\n- namespace: \"[\"\n  weight: 2\n",
+		"unknown field":     "tiers:\n  batch: 0.5\n",
+	}
+	for name, data := range tests {
+		path := filepath.Join(t.TempDir(), "weights.yaml")
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadWeights(path)
+		if err == nil || !strings.Contains(err.Error(), "weights file") {
+			t.Errorf("%s: expected a weights file error, got %v", name, err)
+		}
+	}
+}
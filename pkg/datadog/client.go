@@ -0,0 +1,183 @@
+// Package datadog reads pod usage from the Datadog metrics query API, for
+// clusters without a metrics-server where the Datadog Agent is the only
+// collector of container usage.
+package datadog
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSite is the Datadog site queried when none is configured
+	DefaultSite = "datadoghq.com"
+	// maxErrorBody limits how much of an unexpected response body is included in errors
+	maxErrorBody = 512
+)
+
+// Series is a single timeseries returned by a query.
+type Series struct {
+	// Tags are the group-by tags of the series, keyed by tag name
+	Tags map[string]string
+	// Points are the non-null values of the series, in time order
+	Points []float64
+	// Times are the timestamps of Points
+	Times []time.Time
+}
+
+// Querier evaluates Datadog metric queries over a time range. It is satisfied by *Client.
+type Querier interface {
+	Query(ctx context.Context, query string, from, to time.Time) ([]Series, error)
+}
+
+// Client queries timeseries from the Datadog v1 metrics query API.
+type Client struct {
+	baseURL    *url.URL
+	apiKey     string
+	appKey     string
+	httpClient *http.Client
+}
+
+// New creates a client for the Datadog site (e.g. datadoghq.eu, us5.datadoghq.com)
+// authenticating with the API and application keys.
+func New(site, apiKey, appKey string) (*Client, error) {
+	if apiKey == "" || appKey == "" {
+		return nil, fmt.Errorf("datadog api and application keys are required")
+	}
+	if site == "" {
+		site = DefaultSite
+	}
+	u, err := url.Parse("https://api." + strings.TrimPrefix(site, "api."))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid datadog site %q", site)
+	}
+
+	return &Client{
+		baseURL:    u,
+		apiKey:     apiKey,
+		appKey:     appKey,
+		httpClient: &http.Client{},
+	}, nil
+}
+
+// NewFromEnv creates a client from the DD_API_KEY, DD_APP_KEY (or
+// DD_APPLICATION_KEY) and DD_SITE environment variables used by the Datadog
+// tooling, so keys never appear on the command line or in process listings.
+func NewFromEnv() (*Client, error) {
+	apiKey := os.Getenv("DD_API_KEY")
+	appKey := cmp.Or(os.Getenv("DD_APP_KEY"), os.Getenv("DD_APPLICATION_KEY"))
+	if apiKey == "" || appKey == "" {
+		return nil, fmt.Errorf("usage source datadog requires DD_API_KEY and DD_APP_KEY to be set")
+	}
+	return New(os.Getenv("DD_SITE"), apiKey, appKey)
+}
+
+// WithBaseURL overrides the API endpoint derived from the site, e.g. for a proxy.
+func (c *Client) WithBaseURL(baseURL *url.URL) *Client {
+	c.baseURL = baseURL
+	return c
+}
+
+// WithHTTPClient sets the HTTP client used for queries.
+func (c *Client) WithHTTPClient(httpClient *http.Client) *Client {
+	c.httpClient = httpClient
+	return c
+}
+
+// queryResponse is the body of a metrics query response
+type queryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Series []struct {
+		TagSet    []string      `json:"tag_set"`
+		Pointlist [][2]*float64 `json:"pointlist"`
+	} `json:"series"`
+}
+
+// errorResponse is the body of a rejected request
+type errorResponse struct {
+	Errors []string `json:"errors"`
+}
+
+// Query evaluates query over [from, to] and returns the resulting series.
+func (c *Client) Query(ctx context.Context, query string, from, to time.Time) ([]Series, error) {
+	endpoint := c.baseURL.JoinPath("api", "v1", "query")
+	endpoint.RawQuery = url.Values{
+		"query": {query},
+		"from":  {strconv.FormatInt(from.Unix(), 10)},
+		"to":    {strconv.FormatInt(to.Unix(), 10)},
+	}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create datadog request: %w", err)
+	}
+	req.Header.Set("DD-API-KEY", c.apiKey)
+	req.Header.Set("DD-APPLICATION-KEY", c.appKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("datadog query failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read datadog response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var rejected errorResponse
+		if err := json.Unmarshal(body, &rejected); err == nil && len(rejected.Errors) > 0 {
+			return nil, fmt.Errorf("datadog query failed (HTTP %d): %s", resp.StatusCode, strings.Join(rejected.Errors, "; "))
+		}
+		return nil, fmt.Errorf("unexpected datadog response (HTTP %d): %s", resp.StatusCode, truncate(body))
+	}
+
+	var result queryResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode datadog response: %w", err)
+	}
+	if result.Status == "error" {
+		return nil, fmt.Errorf("datadog query failed: %s", result.Error)
+	}
+
+	series := make([]Series, 0, len(result.Series))
+	for _, s := range result.Series {
+		tags := make(map[string]string, len(s.TagSet))
+		for _, tag := range s.TagSet {
+			if name, value, ok := strings.Cut(tag, ":"); ok {
+				tags[name] = value
+			}
+		}
+		points := make([]float64, 0, len(s.Pointlist))
+		times := make([]time.Time, 0, len(s.Pointlist))
+		for _, point := range s.Pointlist {
+			if point[0] != nil && point[1] != nil {
+				points = append(points, *point[1])
+				times = append(times, time.UnixMilli(int64(*point[0])))
+			}
+		}
+		series = append(series, Series{Tags: tags, Points: points, Times: times})
+	}
+
+	return series, nil
+}
+
+// truncate shortens a response body for inclusion in an error message.
+func truncate(body []byte) string {
+	if len(body) > maxErrorBody {
+		return string(body[:maxErrorBody]) + "..."
+	}
+	return string(body)
+}
@@ -0,0 +1,231 @@
+package datadog
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/config"
+)
+
+func TestClient_Query(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    []Series
+		wantErr string
+	}{
+		{
+			name:   "series",
+			status: http.StatusOK,
+			body: `{"status":"ok","series":[
+				{"tag_set":["kube_namespace:web","pod_name:api-a","kube_container_name:app"],"pointlist":[[1700000000000,1.5],[1700000060000,null],[1700000120000,2.5]]}]}`,
+			want: []Series{{
+				Tags:   map[string]string{"kube_namespace": "web", "pod_name": "api-a", "kube_container_name": "app"},
+				Points: []float64{1.5, 2.5},
+				Times:  []time.Time{time.UnixMilli(1700000000000), time.UnixMilli(1700000120000)},
+			}},
+		},
+		{
+			name:    "query error",
+			status:  http.StatusOK,
+			body:    `{"status":"error","error":"Error parsing query"}`,
+			wantErr: "datadog query failed: Error parsing query",
+		},
+		{
+			name:    "forbidden",
+			status:  http.StatusForbidden,
+			body:    `{"errors":["Forbidden"]}`,
+			wantErr: "datadog query failed (HTTP 403): Forbidden",
+		},
+		{
+			name:    "not datadog",
+			status:  http.StatusBadGateway,
+			body:    `<html>bad gateway</html>`,
+			wantErr: "unexpected datadog response (HTTP 502)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRequest *http.Request
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotRequest = r
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client, err := New("", "api-key", "app-key")
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			base, _ := url.Parse(server.URL)
+			client.WithBaseURL(base)
+
+			from := time.Unix(1700000000, 0)
+			got, err := client.Query(context.Background(), "max:kubernetes.memory.working_set{*}", from, from.Add(time.Hour))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+
+			if gotRequest.URL.Path != "/api/v1/query" || gotRequest.URL.Query().Get("from") != "1700000000" || gotRequest.URL.Query().Get("to") != "1700003600" {
+				t.Errorf("unexpected request %s", gotRequest.URL)
+			}
+			if gotRequest.Header.Get("DD-API-KEY") != "api-key" || gotRequest.Header.Get("DD-APPLICATION-KEY") != "app-key" {
+				t.Errorf("missing authentication headers %v", gotRequest.Header)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d series, got %d", len(tt.want), len(got))
+			}
+			for i := range got {
+				if len(got[i].Points) != len(tt.want[i].Points) || got[i].Tags["pod_name"] != tt.want[i].Tags["pod_name"] {
+					t.Errorf("series %d: expected %+v, got %+v", i, tt.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		site    string
+		apiKey  string
+		want    string
+		wantErr bool
+	}{
+		{site: "", apiKey: "k", want: "https://api.datadoghq.com"},
+		{site: "datadoghq.eu", apiKey: "k", want: "https://api.datadoghq.eu"},
+		{site: "api.us5.datadoghq.com", apiKey: "k", want: "https://api.us5.datadoghq.com"},
+		{site: "datadoghq.com", apiKey: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		client, err := New(tt.site, tt.apiKey, "app")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.site)
+			}
+			continue
+		}
+		if err != nil || client.baseURL.String() != tt.want {
+			t.Errorf("%q: expected %s, got %v (%v)", tt.site, tt.want, client, err)
+		}
+	}
+}
+
+// fakeQuerier answers queries by the metric they select
+type fakeQuerier struct {
+	mutex   sync.Mutex
+	queries []string
+	results map[string][]Series
+}
+
+func (f *fakeQuerier) Query(_ context.Context, query string, _, _ time.Time) ([]Series, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.queries = append(f.queries, query)
+	for metric, series := range f.results {
+		if strings.Contains(query, metric+"{") {
+			return series, nil
+		}
+	}
+	return nil, nil
+}
+
+// series returns a series of a container in the web namespace
+func series(pod, container string, points ...float64) Series {
+	return Series{
+		Tags:   map[string]string{"kube_namespace": "web", "pod_name": pod, "kube_container_name": container},
+		Points: points,
+	}
+}
+
+func TestSource_PodMetrics(t *testing.T) {
+	const mi = 1024 * 1024
+	querier := &fakeQuerier{results: map[string][]Series{
+		memoryMetric: {
+			series("api-b", "app", 256*mi),
+			series("api-a", "proxy", 32*mi),
+			series("api-a", "app", 100*mi, 300*mi, 200*mi),
+			series("api-a", "empty"),
+		},
+		cpuMetric: {
+			series("api-a", "app", 100e6, 150e6),
+		},
+	}}
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	source := NewSource(querier)
+	source.now = func() time.Time { return now }
+
+	opts := config.Options{Namespace: "web", UsageRange: 24 * time.Hour, Aggregation: config.AggregationMax}
+	pods, err := source.PodMetrics(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("PodMetrics failed: %v", err)
+	}
+
+	for _, query := range querier.queries {
+		if !strings.Contains(query, "{kube_namespace:web}") || !strings.HasSuffix(query, ".rollup(max, 288)") {
+			t.Errorf("unexpected query %s", query)
+		}
+	}
+
+	if len(pods) != 2 || pods[0].Name != "api-a" || pods[1].Name != "api-b" {
+		t.Fatalf("unexpected pods %+v", pods)
+	}
+	api := pods[0]
+	if api.Window.Duration != 24*time.Hour || !api.Timestamp.Time.Equal(now) {
+		t.Errorf("unexpected window/timestamp %v/%v", api.Window.Duration, api.Timestamp)
+	}
+	if len(api.Containers) != 2 || api.Containers[0].Name != "app" || api.Containers[1].Name != "proxy" {
+		t.Fatalf("unexpected containers %+v", api.Containers)
+	}
+	if c := api.Containers[0]; c.MemoryBytes != 300*mi || c.CPUMillicores != 150 {
+		t.Errorf("unexpected app usage %+v", c)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	points := []float64{5, 1, 4, 2, 3, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+	tests := []struct {
+		aggregation config.Aggregation
+		want        float64
+	}{
+		{config.AggregationAvg, 10.5},
+		{config.AggregationMax, 20},
+		{config.AggregationP95, 19},
+	}
+	for _, tt := range tests {
+		if got := aggregate(points, tt.aggregation); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.aggregation, tt.want, got)
+		}
+	}
+}
+
+func TestSlope(t *testing.T) {
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	times := []time.Time{start, start.Add(time.Minute), start.Add(3 * time.Minute), start.Add(4 * time.Minute)}
+
+	// 100 bytes per minute with noise around the line
+	if got := slope(times, []float64{1000, 1110, 1290, 1400}); math.Abs(got-100.0/60) > 0.1 {
+		t.Errorf("expected about %.2f bytes per second, got %.2f", 100.0/60, got)
+	}
+	if got := slope(times[:1], []float64{1000}); got != 0 {
+		t.Errorf("expected no slope for a single point, got %v", got)
+	}
+	if got := slope([]time.Time{start, start}, []float64{1, 2}); got != 0 {
+		t.Errorf("expected no slope for points at the same time, got %v", got)
+	}
+}
@@ -0,0 +1,225 @@
+package datadog
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+const (
+	// memoryMetric is the container working set reported by the kubelet check, in bytes
+	memoryMetric = "kubernetes.memory.working_set"
+	// cpuMetric is the container CPU usage reported by the kubelet check, in nanocores
+	cpuMetric = "kubernetes.cpu.usage.total"
+	// maxPoints bounds the points requested per series; Datadog rolls up larger ranges itself
+	maxPoints = 300
+	// minRollup is the finest rollup interval requested
+	minRollup = time.Minute
+)
+
+// Source aggregates pod usage over a range from Datadog kubelet metrics.
+// It satisfies collector.MetricsSource.
+type Source struct {
+	querier Querier
+	now     func() time.Time
+}
+
+// NewSource creates a usage source using the provided querier.
+func NewSource(querier Querier) *Source {
+	return &Source{
+		querier: querier,
+		now:     time.Now,
+	}
+}
+
+// PodMetrics returns the usage of every container of the target namespace, or
+// of all namespaces with opts.AllNamespaces, aggregated with opts.Aggregation
+// over opts.UsageRange ending now. Pods are ordered by namespace and name.
+func (s *Source) PodMetrics(ctx context.Context, opts config.Options) ([]metrics.PodMetrics, error) {
+	scope := namespaceScope(opts)
+
+	to := s.now()
+	from := to.Add(-opts.UsageRange)
+	var memory, cpu []Series
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		series, err := s.querier.Query(gctx, Query(memoryMetric, scope, opts.UsageRange, opts.Aggregation), from, to)
+		if err != nil {
+			return fmt.Errorf("failed to query memory usage: %w", err)
+		}
+		memory = series
+		return nil
+	})
+	g.Go(func() error {
+		series, err := s.querier.Query(gctx, Query(cpuMetric, scope, opts.UsageRange, opts.Aggregation), from, to)
+		if err != nil {
+			return fmt.Errorf("failed to query cpu usage: %w", err)
+		}
+		cpu = series
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// Index containers by namespace/pod/container; series of both queries merge
+	type entry struct {
+		pod       *metrics.PodMetrics
+		container *metrics.ContainerMetrics
+	}
+	pods := make(map[string]*metrics.PodMetrics)
+	containers := make(map[string]entry)
+	container := func(tags map[string]string) *metrics.ContainerMetrics {
+		podKey := tags["kube_namespace"] + "/" + tags["pod_name"]
+		pod, ok := pods[podKey]
+		if !ok {
+			pod = &metrics.PodMetrics{
+				ObjectMeta: metav1.ObjectMeta{Namespace: tags["kube_namespace"], Name: tags["pod_name"]},
+				Timestamp:  metav1.NewTime(to),
+				Window:     metav1.Duration{Duration: opts.UsageRange},
+			}
+			pods[podKey] = pod
+		}
+		key := podKey + "/" + tags["kube_container_name"]
+		e, ok := containers[key]
+		if !ok {
+			e = entry{pod: pod, container: &metrics.ContainerMetrics{Name: tags["kube_container_name"]}}
+			containers[key] = e
+		}
+		return e.container
+	}
+	valid := func(s Series) bool {
+		return len(s.Points) > 0 && s.Tags["kube_namespace"] != "" && s.Tags["pod_name"] != "" && s.Tags["kube_container_name"] != ""
+	}
+
+	for _, series := range memory {
+		if valid(series) {
+			c := container(series.Tags)
+			c.MemoryBytes = int64(aggregate(series.Points, opts.Aggregation))
+			if opts.Forecast {
+				c.MemoryLatestBytes = int64(series.Points[len(series.Points)-1])
+				c.MemoryGrowthBytesPerSecond = slope(series.Times, series.Points)
+			}
+		}
+	}
+	for _, series := range cpu {
+		if valid(series) {
+			container(series.Tags).CPUMillicores = int64(math.Round(aggregate(series.Points, opts.Aggregation) / 1e6))
+		}
+	}
+
+	// Attach containers in name order so results are stable
+	keys := make([]string, 0, len(containers))
+	for key := range containers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		e := containers[key]
+		e.pod.Containers = append(e.pod.Containers, *e.container)
+	}
+
+	result := make([]metrics.PodMetrics, 0, len(pods))
+	for _, pm := range pods {
+		result = append(result, *pm)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// Plan returns the queries PodMetrics issues for opts, for dry runs.
+func (s *Source) Plan(opts config.Options) []metrics.PlannedRequest {
+	scope := namespaceScope(opts)
+	plan := make([]metrics.PlannedRequest, 0, 2)
+	for _, metric := range []string{memoryMetric, cpuMetric} {
+		plan = append(plan, metrics.PlannedRequest{
+			Server:   "datadog",
+			Method:   "GET",
+			Path:     "/api/v1/query",
+			Params:   fmt.Sprintf("query=%s&from=now-%s&to=now", Query(metric, scope, opts.UsageRange, opts.Aggregation), opts.UsageRange),
+			Requests: 1,
+		})
+	}
+	return plan
+}
+
+// namespaceScope returns the tag scope of the target namespace, or of all
+// namespaces with opts.AllNamespaces.
+func namespaceScope(opts config.Options) string {
+	if !opts.AllNamespaces && opts.Namespace != "" {
+		return "kube_namespace:" + opts.Namespace
+	}
+	return "*"
+}
+
+// Query returns a query for metric per container within scope, rolled up so a
+// series over period holds at most maxPoints points. Points are rolled up with
+// max for the max aggregation and avg otherwise.
+func Query(metric, scope string, period time.Duration, aggregation config.Aggregation) string {
+	rollup := "avg"
+	if aggregation == config.AggregationMax {
+		rollup = "max"
+	}
+	interval := max(period/maxPoints, minRollup)
+	return fmt.Sprintf(`max:%s{%s} by {kube_namespace,pod_name,kube_container_name}.rollup(%s, %d)`,
+		metric, scope, rollup, int64(interval.Seconds()))
+}
+
+// slope returns the rate of change of points per second, from a least squares
+// fit through the points at times, or 0 with fewer than two points.
+func slope(times []time.Time, points []float64) float64 {
+	if len(points) < 2 || len(times) != len(points) {
+		return 0
+	}
+
+	origin := times[0]
+	var sumX, sumY, sumXY, sumXX float64
+	for i, y := range points {
+		x := times[i].Sub(origin).Seconds()
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(points))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+// aggregate combines the points of a series; p95 uses the nearest-rank method.
+func aggregate(points []float64, aggregation config.Aggregation) float64 {
+	switch aggregation {
+	case config.AggregationMax:
+		return slices.Max(points)
+	case config.AggregationP95:
+		sorted := slices.Sorted(slices.Values(points))
+		rank := int(math.Ceil(0.95 * float64(len(sorted))))
+		return sorted[max(rank, 1)-1]
+	default:
+		var sum float64
+		for _, p := range points {
+			sum += p
+		}
+		return sum / float64(len(points))
+	}
+}
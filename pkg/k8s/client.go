@@ -4,6 +4,7 @@
 package k8s
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/flowcontrol"
 	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
 )
 
@@ -23,11 +25,87 @@ type ClientManager struct {
 	metrics *metricsv.Clientset
 }
 
+// Option customizes the client configuration created by NewClientManager.
+type Option func(*settings)
+
+// settings holds the values configured through Option functions.
+type settings struct {
+	transportWrappers []func(http.RoundTripper) http.RoundTripper
+	rateLimitObserver func(time.Duration)
+	context           string
+	kubeconfig        string
+	cluster           string
+}
+
+// WithContext selects a kubeconfig context other than the current one. An
+// explicitly selected context must exist; there is no in-cluster fallback.
+func WithContext(name string) Option {
+	return func(s *settings) {
+		s.context = name
+	}
+}
+
+// WithKubeconfig reads the kubeconfig from path instead of $KUBECONFIG or
+// ~/.kube/config. An explicitly selected file must exist; there is no
+// in-cluster fallback.
+func WithKubeconfig(path string) Option {
+	return func(s *settings) {
+		s.kubeconfig = path
+	}
+}
+
+// WithCluster selects a kubeconfig cluster other than the one of the context,
+// keeping the credentials of the context.
+func WithCluster(name string) Option {
+	return func(s *settings) {
+		s.cluster = name
+	}
+}
+
+// SelectionOptions returns the options selecting the kubeconfig context, file
+// and cluster, as the --context, --kubeconfig and --cluster flags of kubectl
+// do. Empty values keep the defaults.
+func SelectionOptions(context, kubeconfig, cluster string) []Option {
+	var opts []Option
+	if context != "" {
+		opts = append(opts, WithContext(context))
+	}
+	if kubeconfig != "" {
+		opts = append(opts, WithKubeconfig(kubeconfig))
+	}
+	if cluster != "" {
+		opts = append(opts, WithCluster(cluster))
+	}
+	return opts
+}
+
+// WithTransportWrapper adds a wrapper around the HTTP transport used by all clients,
+// applied after the default connection pool settings. This is used to observe or
+// record API traffic, e.g. for diagnostic bundles.
+func WithTransportWrapper(wrap func(http.RoundTripper) http.RoundTripper) Option {
+	return func(s *settings) {
+		s.transportWrappers = append(s.transportWrappers, wrap)
+	}
+}
+
+// WithRateLimitObserver reports the time every request waits on the
+// client-side rate limit (QPS and Burst) before it is sent.
+func WithRateLimitObserver(observe func(wait time.Duration)) Option {
+	return func(s *settings) {
+		s.rateLimitObserver = observe
+	}
+}
+
 // NewClientManager creates a new Kubernetes client manager with production-ready defaults.
 // This function implements the factory pattern and handles the complex client configuration
 // logic required for reliable operation in various Kubernetes environments.
-func NewClientManager() (*ClientManager, error) {
-	config, err := loadConfig()
+func NewClientManager(opts ...Option) (*ClientManager, error) {
+	var s settings
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	config, err := loadConfig(s)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
 	}
@@ -35,12 +113,16 @@ func NewClientManager() (*ClientManager, error) {
 	// Apply production-ready defaults
 	configureClientDefaults(config)
 
-	core, err := kubernetes.NewForConfig(config)
+	for _, wrap := range s.transportWrappers {
+		config.Wrap(wrap)
+	}
+
+	core, err := kubernetes.NewForConfig(s.rateLimited(config))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create core client: %w", err)
 	}
 
-	metrics, err := metricsv.NewForConfig(config)
+	metrics, err := metricsv.NewForConfig(s.rateLimited(config))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create metrics client: %w", err)
 	}
@@ -52,6 +134,70 @@ func NewClientManager() (*ClientManager, error) {
 	}, nil
 }
 
+// rateLimited returns config with a rate limiter of its own that reports its
+// waits when a rate limit observer is set, just as every client created from
+// config otherwise creates a limiter of its own.
+func (s settings) rateLimited(config *rest.Config) *rest.Config {
+	if s.rateLimitObserver == nil {
+		return config
+	}
+	limited := rest.CopyConfig(config)
+	limited.RateLimiter = &observedRateLimiter{
+		RateLimiter: flowcontrol.NewTokenBucketRateLimiter(config.QPS, config.Burst),
+		observe:     s.rateLimitObserver,
+	}
+	return limited
+}
+
+// observedRateLimiter reports the time requests wait on a rate limiter.
+type observedRateLimiter struct {
+	flowcontrol.RateLimiter
+	observe func(time.Duration)
+}
+
+// Accept blocks until a request may be sent.
+func (l *observedRateLimiter) Accept() {
+	start := time.Now()
+	l.RateLimiter.Accept()
+	l.observe(time.Since(start))
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+func (l *observedRateLimiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := l.RateLimiter.Wait(ctx)
+	l.observe(time.Since(start))
+	return err
+}
+
+// CurrentContext returns the current context of the kubeconfig at path, or of
+// the one found by the standard loading rules when path is empty, or an empty
+// string when there is none.
+func CurrentContext(path string) string {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = path
+	raw, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).RawConfig()
+	if err != nil {
+		return ""
+	}
+	return raw.CurrentContext
+}
+
+// ContextNamespace returns the namespace of the named context of the
+// kubeconfig at path, or of its current context when name is empty, as
+// kubectl defaults -n to it. It returns "default" when the context sets no
+// namespace or cannot be loaded.
+func ContextNamespace(path, name string) string {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = path
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: name}
+	namespace, _, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).Namespace()
+	if err != nil || namespace == "" {
+		return "default"
+	}
+	return namespace
+}
+
 // CoreClient returns the core Kubernetes API client.
 func (cm *ClientManager) CoreClient() *kubernetes.Clientset {
 	return cm.core
@@ -69,15 +215,25 @@ func (cm *ClientManager) Config() *rest.Config {
 
 // loadConfig attempts to load Kubernetes configuration using the standard precedence:
 // 1. kubeconfig file (standard kubectl configuration)
-// 2. in-cluster configuration (when running inside a pod)
-func loadConfig() (*rest.Config, error) {
+// 2. in-cluster configuration (when running inside a pod and no context is selected)
+func loadConfig(s settings) (*rest.Config, error) {
 	// Try standard kubeconfig chain (works for kubectl plugins)
 	rules := clientcmd.NewDefaultClientConfigLoadingRules()
-	overrides := &clientcmd.ConfigOverrides{}
+	rules.ExplicitPath = s.kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: s.context}
+	overrides.Context.Cluster = s.cluster
 	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
 	if err == nil {
 		return config, nil
 	}
+	switch {
+	case s.context != "":
+		return nil, fmt.Errorf("cannot load context %q: %w", s.context, err)
+	case s.kubeconfig != "":
+		return nil, fmt.Errorf("cannot load kubeconfig %s: %w", s.kubeconfig, err)
+	case s.cluster != "":
+		return nil, fmt.Errorf("cannot load cluster %q: %w", s.cluster, err)
+	}
 
 	// Fallback to in-cluster configuration (if running inside a pod)
 	config, err = rest.InClusterConfig()
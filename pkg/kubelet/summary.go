@@ -0,0 +1,344 @@
+// Package kubelet reads pod network, volume and node filesystem statistics
+// from the kubelet Summary API (/stats/summary) of every node through the API server node
+// proxy. It requires get on the nodes/proxy resource.
+package kubelet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+const (
+	// DefaultInterval is the time between the two reads network rates are computed
+	// over; the kubelet refreshes network stats every 10-15s
+	DefaultInterval = 15 * time.Second
+	// maxConcurrentNodes bounds the number of nodes read at once
+	maxConcurrentNodes = 10
+)
+
+// fsStats are the stats of a filesystem in the Summary API response
+type fsStats struct {
+	UsedBytes     *uint64 `json:"usedBytes"`
+	CapacityBytes *uint64 `json:"capacityBytes"`
+}
+
+// usage returns the filesystem usage, or nil when either value is missing.
+func (f *fsStats) usage() *metrics.FilesystemUsage {
+	if f == nil || f.UsedBytes == nil || f.CapacityBytes == nil || *f.CapacityBytes == 0 {
+		return nil
+	}
+	return &metrics.FilesystemUsage{UsedBytes: int64(*f.UsedBytes), CapacityBytes: int64(*f.CapacityBytes)}
+}
+
+// interfaceStats are the cumulative bytes of a pod network interface
+type interfaceStats struct {
+	RxBytes *uint64 `json:"rxBytes"`
+	TxBytes *uint64 `json:"txBytes"`
+}
+
+// summary is the subset of the Summary API response holding pod network and
+// volume stats and node filesystem stats
+type summary struct {
+	Node struct {
+		Fs      *fsStats `json:"fs"`
+		Runtime *struct {
+			ImageFs *fsStats `json:"imageFs"`
+		} `json:"runtime"`
+	} `json:"node"`
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Network *struct {
+			Time       time.Time        `json:"time"`
+			RxBytes    *uint64          `json:"rxBytes"`
+			TxBytes    *uint64          `json:"txBytes"`
+			Interfaces []interfaceStats `json:"interfaces"`
+		} `json:"network"`
+		Volumes []struct {
+			PVCRef *struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"pvcRef"`
+			UsedBytes     *uint64 `json:"usedBytes"`
+			CapacityBytes *uint64 `json:"capacityBytes"`
+		} `json:"volume"`
+	} `json:"pods"`
+}
+
+// counters are the cumulative network bytes of a pod at a point in time
+type counters struct {
+	at     time.Time
+	rx, tx uint64
+}
+
+// Reader reads pod statistics from the kubelet of each node.
+type Reader struct {
+	client   kubernetes.Interface
+	interval time.Duration
+	fetch    func(ctx context.Context, node string) ([]byte, error)
+	sleep    func(ctx context.Context, d time.Duration) error
+}
+
+// New creates a reader proxying to nodes with client.
+func New(client kubernetes.Interface) *Reader {
+	r := &Reader{
+		client:   client,
+		interval: DefaultInterval,
+		sleep:    sleep,
+	}
+	r.fetch = r.proxy
+	return r
+}
+
+// WithInterval sets the time between the two reads rates are computed over.
+func (r *Reader) WithInterval(interval time.Duration) *Reader {
+	r.interval = interval
+	return r
+}
+
+// PodNetwork returns the receive and transmit rates of the pods on nodes,
+// keyed by namespace/name. Every node is read twice and the rates between the
+// two reads are reported; pods without network stats, such as host network
+// pods, are omitted, as are nodes that cannot be read.
+func (r *Reader) PodNetwork(ctx context.Context, nodes []string) (map[string]metrics.NetworkUsage, error) {
+	first := r.readNodes(ctx, nodes)
+	if err := r.sleep(ctx, r.interval); err != nil {
+		return nil, err
+	}
+	second := r.readNodes(ctx, nodes)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(nodes) > 0 && len(second) == 0 {
+		return nil, fmt.Errorf("failed to read kubelet stats on all %d nodes (requires get on nodes/proxy)", len(nodes))
+	}
+
+	usage := make(map[string]metrics.NetworkUsage)
+	for node, pods := range second {
+		for key, last := range pods {
+			prev, ok := first[node][key]
+			elapsed := last.at.Sub(prev.at).Seconds()
+			// Pods started between reads, or with reset counters, have no rate yet
+			if !ok || elapsed <= 0 || last.rx < prev.rx || last.tx < prev.tx {
+				continue
+			}
+			usage[key] = metrics.NetworkUsage{
+				RxBytesPerSecond: float64(last.rx-prev.rx) / elapsed,
+				TxBytesPerSecond: float64(last.tx-prev.tx) / elapsed,
+			}
+		}
+	}
+
+	return usage, nil
+}
+
+// readNodes reads every node concurrently, returning the pod counters by node
+// name. Nodes that cannot be read are logged and omitted.
+func (r *Reader) readNodes(ctx context.Context, nodes []string) map[string]map[string]counters {
+	var mutex sync.Mutex
+	result := make(map[string]map[string]counters, len(nodes))
+
+	var g errgroup.Group
+	g.SetLimit(maxConcurrentNodes)
+	for _, node := range nodes {
+		g.Go(func() error {
+			pods, err := r.readNode(ctx, node)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("skipping node, failed to read kubelet stats", "node", node, "error", err)
+				}
+				return nil
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			result[node] = pods
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	return result
+}
+
+// readNode returns the network counters of the pods on node, keyed by namespace/name.
+func (r *Reader) readNode(ctx context.Context, node string) (map[string]counters, error) {
+	stats, err := r.readSummary(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make(map[string]counters, len(stats.Pods))
+	for _, pod := range stats.Pods {
+		network := pod.Network
+		if network == nil {
+			continue
+		}
+		if network.RxBytes != nil && network.TxBytes != nil {
+			pods[pod.PodRef.Namespace+"/"+pod.PodRef.Name] = counters{at: network.Time, rx: *network.RxBytes, tx: *network.TxBytes}
+			continue
+		}
+		// Windows kubelets report no default interface, only the per-interface stats
+		if rx, tx, ok := sumInterfaces(network.Interfaces); ok {
+			pods[pod.PodRef.Namespace+"/"+pod.PodRef.Name] = counters{at: network.Time, rx: rx, tx: tx}
+		}
+	}
+	return pods, nil
+}
+
+// sumInterfaces returns the bytes received and transmitted across interfaces,
+// or false when there are none or any of them lacks a counter.
+func sumInterfaces(interfaces []interfaceStats) (uint64, uint64, bool) {
+	var rx, tx uint64
+	for _, stats := range interfaces {
+		if stats.RxBytes == nil || stats.TxBytes == nil {
+			return 0, 0, false
+		}
+		rx += *stats.RxBytes
+		tx += *stats.TxBytes
+	}
+	return rx, tx, len(interfaces) > 0
+}
+
+// Volumes returns the usage of the persistent volume claims mounted by the
+// pods on nodes. A claim mounted by several pods is reported once per pod.
+// Nodes that cannot be read are skipped with a warning.
+func (r *Reader) Volumes(ctx context.Context, nodes []string) ([]metrics.VolumeUsage, error) {
+	var (
+		mutex   sync.Mutex
+		volumes []metrics.VolumeUsage
+		read    int
+	)
+
+	var g errgroup.Group
+	g.SetLimit(maxConcurrentNodes)
+	for _, node := range nodes {
+		g.Go(func() error {
+			stats, err := r.readSummary(ctx, node)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("skipping node, failed to read kubelet stats", "node", node, "error", err)
+				}
+				return nil
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			read++
+			for _, pod := range stats.Pods {
+				for _, volume := range pod.Volumes {
+					if volume.PVCRef == nil || volume.UsedBytes == nil || volume.CapacityBytes == nil || *volume.CapacityBytes == 0 {
+						continue
+					}
+					usage := metrics.VolumeUsage{
+						Namespace:     pod.PodRef.Namespace,
+						Claim:         volume.PVCRef.Name,
+						Pod:           pod.PodRef.Name,
+						Node:          node,
+						UsedBytes:     int64(*volume.UsedBytes),
+						CapacityBytes: int64(*volume.CapacityBytes),
+					}
+					usage.Percentage = float64(usage.UsedBytes) / float64(usage.CapacityBytes) * 100
+					volumes = append(volumes, usage)
+				}
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(nodes) > 0 && read == 0 {
+		return nil, fmt.Errorf("failed to read kubelet stats on all %d nodes (requires get on nodes/proxy)", len(nodes))
+	}
+	return volumes, nil
+}
+
+// Filesystems returns the node and image filesystem usage of nodes, keyed by
+// node name. Nodes that cannot be read are skipped with a warning.
+func (r *Reader) Filesystems(ctx context.Context, nodes []string) (map[string]metrics.NodeFilesystems, error) {
+	var mutex sync.Mutex
+	result := make(map[string]metrics.NodeFilesystems, len(nodes))
+
+	var g errgroup.Group
+	g.SetLimit(maxConcurrentNodes)
+	for _, node := range nodes {
+		g.Go(func() error {
+			stats, err := r.readSummary(ctx, node)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("skipping node, failed to read kubelet stats", "node", node, "error", err)
+				}
+				return nil
+			}
+
+			filesystems := metrics.NodeFilesystems{NodeFS: stats.Node.Fs.usage()}
+			if stats.Node.Runtime != nil {
+				filesystems.ImageFS = stats.Node.Runtime.ImageFs.usage()
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			result[node] = filesystems
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(nodes) > 0 && len(result) == 0 {
+		return nil, fmt.Errorf("failed to read kubelet stats on all %d nodes (requires get on nodes/proxy)", len(nodes))
+	}
+	return result, nil
+}
+
+// readSummary reads and decodes the Summary API response of node.
+func (r *Reader) readSummary(ctx context.Context, node string) (*summary, error) {
+	data, err := r.fetch(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats summary
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("failed to decode kubelet stats of node %s: %w", node, err)
+	}
+	return &stats, nil
+}
+
+// proxy reads /stats/summary of node through the API server node proxy.
+func (r *Reader) proxy(ctx context.Context, node string) ([]byte, error) {
+	data, err := r.client.CoreV1().RESTClient().Get().
+		AbsPath("/api/v1/nodes", node, "proxy", "stats", "summary").
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubelet stats of node %s: %w", node, err)
+	}
+	return data, nil
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
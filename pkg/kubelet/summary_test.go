@@ -0,0 +1,135 @@
+package kubelet
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// reads are the two Summary API responses of node-a, 10s apart
+var reads = []string{
+	`{"pods":[
+		{"podRef":{"namespace":"web","name":"api-a"},"network":{"time":"2025-06-01T00:00:00Z","rxBytes":1000,"txBytes":5000}},
+		{"podRef":{"namespace":"web","name":"api-b"},"network":{"time":"2025-06-01T00:00:00Z","rxBytes":9000,"txBytes":9000}},
+		{"podRef":{"namespace":"web","name":"api-w"},"network":{"time":"2025-06-01T00:00:00Z","interfaces":[{"rxBytes":100,"txBytes":100},{"rxBytes":100,"txBytes":100}]}},
+		{"podRef":{"namespace":"kube-system","name":"kube-proxy-x"}}
+	]}`,
+	`{"pods":[
+		{"podRef":{"namespace":"web","name":"api-a"},"network":{"time":"2025-06-01T00:00:10Z","rxBytes":11240,"txBytes":5500}},
+		{"podRef":{"namespace":"web","name":"api-b"},"network":{"time":"2025-06-01T00:00:10Z","rxBytes":10,"txBytes":10}},
+		{"podRef":{"namespace":"web","name":"api-c"},"network":{"time":"2025-06-01T00:00:10Z","rxBytes":10,"txBytes":10}},
+		{"podRef":{"namespace":"web","name":"api-w"},"network":{"time":"2025-06-01T00:00:10Z","interfaces":[{"rxBytes":1100,"txBytes":200},{"rxBytes":100,"txBytes":200}]}},
+		{"podRef":{"namespace":"kube-system","name":"kube-proxy-x"}}
+	]}`,
+}
+
+// newTestReader returns a reader where node-a answers with reads and every other node fails.
+func newTestReader() *Reader {
+	var mutex sync.Mutex
+	calls := 0
+	reader := New(fake.NewClientset())
+	reader.sleep = func(context.Context, time.Duration) error { return nil }
+	reader.fetch = func(_ context.Context, node string) ([]byte, error) {
+		if node != "node-a" {
+			return nil, errors.New("forbidden")
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		data := reads[calls]
+		calls++
+		return []byte(data), nil
+	}
+	return reader
+}
+
+func TestReader_PodNetwork(t *testing.T) {
+	usage, err := newTestReader().PodNetwork(context.Background(), []string{"node-a", "node-b"})
+	if err != nil {
+		t.Fatalf("PodNetwork failed: %v", err)
+	}
+
+	// api-b reset its counters and api-c started between reads
+	if len(usage) != 2 {
+		t.Fatalf("expected 2 pods with rates, got %+v", usage)
+	}
+	api, ok := usage["web/api-a"]
+	if !ok || api.RxBytesPerSecond != 1024 || api.TxBytesPerSecond != 50 {
+		t.Errorf("unexpected api-a rates %+v", api)
+	}
+
+	// Windows pods only report per-interface counters
+	windows, ok := usage["web/api-w"]
+	if !ok || windows.RxBytesPerSecond != 100 || windows.TxBytesPerSecond != 20 {
+		t.Errorf("unexpected api-w rates %+v", windows)
+	}
+}
+
+func TestReader_PodNetwork_AllNodesFail(t *testing.T) {
+	if _, err := newTestReader().PodNetwork(context.Background(), []string{"node-b"}); err == nil {
+		t.Fatal("expected error when no node can be read")
+	}
+}
+
+func TestReader_Volumes(t *testing.T) {
+	reader := New(fake.NewClientset())
+	reader.fetch = func(_ context.Context, node string) ([]byte, error) {
+		if node != "node-a" {
+			return nil, errors.New("forbidden")
+		}
+		return []byte(`{"pods":[
+			{"podRef":{"namespace":"payments","name":"db-0"},"volume":[
+				{"name":"data","pvcRef":{"namespace":"payments","name":"data-db-0"},"usedBytes":750,"capacityBytes":1000},
+				{"name":"kube-api-access-x","usedBytes":4,"capacityBytes":1000}
+			]},
+			{"podRef":{"namespace":"web","name":"api-a"}}
+		]}`), nil
+	}
+
+	volumes, err := reader.Volumes(context.Background(), []string{"node-a", "node-b"})
+	if err != nil {
+		t.Fatalf("Volumes failed: %v", err)
+	}
+	if len(volumes) != 1 {
+		t.Fatalf("expected only the claim volume, got %+v", volumes)
+	}
+	if v := volumes[0]; v.Claim != "data-db-0" || v.Pod != "db-0" || v.Node != "node-a" || v.Percentage != 75 {
+		t.Errorf("unexpected volume %+v", v)
+	}
+
+	if _, err := reader.Volumes(context.Background(), []string{"node-b"}); err == nil {
+		t.Error("expected error when no node can be read")
+	}
+}
+
+func TestReader_Filesystems(t *testing.T) {
+	reader := New(fake.NewClientset())
+	reader.fetch = func(_ context.Context, node string) ([]byte, error) {
+		switch node {
+		case "node-a":
+			return []byte(`{"node":{"fs":{"usedBytes":850,"capacityBytes":1000},"runtime":{"imageFs":{"usedBytes":300,"capacityBytes":1000}}}}`), nil
+		case "node-b":
+			return []byte(`{"node":{"fs":{"usedBytes":100,"capacityBytes":1000}}}`), nil
+		}
+		return nil, errors.New("forbidden")
+	}
+
+	filesystems, err := reader.Filesystems(context.Background(), []string{"node-a", "node-b", "node-c"})
+	if err != nil {
+		t.Fatalf("Filesystems failed: %v", err)
+	}
+	if len(filesystems) != 2 {
+		t.Fatalf("expected the two readable nodes, got %+v", filesystems)
+	}
+	a := filesystems["node-a"]
+	if a.NodeFS == nil || a.NodeFS.Percentage() != 85 || a.ImageFS == nil || a.ImageFS.Percentage() != 30 {
+		t.Errorf("unexpected node-a filesystems %+v", a)
+	}
+	// Without a separate image filesystem the runtime reports none
+	if b := filesystems["node-b"]; b.NodeFS == nil || b.ImageFS != nil {
+		t.Errorf("unexpected node-b filesystems %+v", b)
+	}
+}
@@ -0,0 +1,283 @@
+// Package kubestate reads pod specifications from kube-state-metrics series
+// through a Prometheus-compatible backend, for environments where listing pods
+// across namespaces is not permitted but metrics are readable. Limits, requests,
+// owners, nodes, phases and restart counts are exported by default; pod labels
+// only for the keys allowed with --metric-labels-allowlist=pods=[...], and
+// under their sanitized names (app.kubernetes.io/name becomes app_kubernetes_io_name).
+package kubestate
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/prometheus"
+)
+
+// labelPrefix is the prefix of pod label names on kube_pod_labels
+const labelPrefix = "label_"
+
+// Source builds pod specifications from kube-state-metrics series.
+// It satisfies collector.PodSource.
+type Source struct {
+	querier prometheus.Querier
+}
+
+// New creates a pod source using the provided querier.
+func New(querier prometheus.Querier) *Source {
+	return &Source{querier: querier}
+}
+
+// query is one of the kube-state-metrics series a pod is assembled from
+type query struct {
+	// expr is a PromQL expression deduplicating the series of KSM replicas
+	expr string
+	// apply merges a sample into the pods being built
+	apply func(b *builder, labels map[string]string, value float64)
+}
+
+// Pods returns the pods of the target namespace, or of all namespaces with
+// opts.AllNamespaces, ordered by namespace and name. Containers are ordered by
+// name since kube-state-metrics does not preserve their spec order.
+func (s *Source) Pods(ctx context.Context, opts config.Options) ([]corev1.Pod, error) {
+	queries := podQueries(namespaceMatcher(opts))
+
+	results := make([][]prometheus.Sample, len(queries))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, q := range queries {
+		g.Go(func() error {
+			samples, err := s.querier.Query(gctx, q.expr, time.Time{})
+			if err != nil {
+				return fmt.Errorf("failed to query kube-state-metrics: %w", err)
+			}
+			results[i] = samples
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	b := newBuilder()
+	for i, q := range queries {
+		for _, sample := range results[i] {
+			if sample.Labels["namespace"] == "" || (sample.Labels["pod"] == "" && sample.Labels["replicaset"] == "") {
+				continue
+			}
+			q.apply(b, sample.Labels, sample.Value)
+		}
+	}
+
+	return b.build(), nil
+}
+
+// Plan returns the instant queries Pods issues for opts, for dry runs.
+func (s *Source) Plan(opts config.Options) []metrics.PlannedRequest {
+	queries := podQueries(namespaceMatcher(opts))
+	plan := make([]metrics.PlannedRequest, 0, len(queries))
+	for _, q := range queries {
+		plan = append(plan, metrics.PlannedRequest{Server: "prometheus", Method: "POST", Path: "/api/v1/query", Params: "query=" + q.expr, Requests: 1})
+	}
+	return plan
+}
+
+// namespaceMatcher matches the series of the target namespace, or of all
+// namespaces with opts.AllNamespaces.
+func namespaceMatcher(opts config.Options) string {
+	if !opts.AllNamespaces && opts.Namespace != "" {
+		return "namespace=" + prometheus.QuoteValue(opts.Namespace)
+	}
+	return ""
+}
+
+// podQueries returns the series pods are assembled from, restricted by matcher.
+func podQueries(matcher string) []query {
+	return []query{
+		{
+			expr:  fmt.Sprintf(`max by (namespace, pod, node) (kube_pod_info{%s})`, matcher),
+			apply: func(b *builder, l map[string]string, _ float64) { b.pod(l).Spec.NodeName = l["node"] },
+		},
+		{
+			expr: fmt.Sprintf(`max by (namespace, pod, phase) (kube_pod_status_phase{%s}) == 1`, matcher),
+			apply: func(b *builder, l map[string]string, _ float64) {
+				b.pod(l).Status.Phase = corev1.PodPhase(l["phase"])
+			},
+		},
+		{
+			expr:  fmt.Sprintf(`max by (namespace, pod, container, resource) (kube_pod_container_resource_limits{%s})`, selector(matcher, `resource=~"cpu|memory"`)),
+			apply: func(b *builder, l map[string]string, v float64) { b.quantity(l, v, true) },
+		},
+		{
+			expr:  fmt.Sprintf(`max by (namespace, pod, container, resource) (kube_pod_container_resource_requests{%s})`, selector(matcher, `resource=~"cpu|memory"`)),
+			apply: func(b *builder, l map[string]string, v float64) { b.quantity(l, v, false) },
+		},
+		{
+			expr:  fmt.Sprintf(`max by (namespace, pod, container) (kube_pod_container_status_restarts_total{%s})`, matcher),
+			apply: func(b *builder, l map[string]string, v float64) { b.container(l).restarts = int32(v) },
+		},
+		{
+			expr: fmt.Sprintf(`max by (namespace, pod, owner_kind, owner_name) (kube_pod_owner{%s})`, selector(matcher, `owner_is_controller="true"`)),
+			apply: func(b *builder, l map[string]string, _ float64) {
+				if l["owner_kind"] != "" && l["owner_kind"] != "<none>" {
+					b.owners[key(l)] = metav1.OwnerReference{Kind: l["owner_kind"], Name: l["owner_name"]}
+				}
+			},
+		},
+		{
+			expr: fmt.Sprintf(`max by (namespace, replicaset, owner_name) (kube_replicaset_owner{%s})`, selector(matcher, `owner_kind="Deployment"`)),
+			apply: func(b *builder, l map[string]string, _ float64) {
+				b.deployments[l["namespace"]+"/"+l["replicaset"]] = l["owner_name"]
+			},
+		},
+		{
+			expr: fmt.Sprintf(`kube_pod_labels{%s}`, matcher),
+			apply: func(b *builder, l map[string]string, _ float64) {
+				pod := b.pod(l)
+				for name, value := range l {
+					if label, ok := strings.CutPrefix(name, labelPrefix); ok && value != "" {
+						if pod.Labels == nil {
+							pod.Labels = make(map[string]string)
+						}
+						pod.Labels[label] = value
+					}
+				}
+			},
+		},
+	}
+}
+
+// selector joins non-empty label matchers.
+func selector(matchers ...string) string {
+	var parts []string
+	for _, m := range matchers {
+		if m != "" {
+			parts = append(parts, m)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// key identifies a pod by namespace/name.
+func key(l map[string]string) string {
+	return l["namespace"] + "/" + l["pod"]
+}
+
+// container accumulates the series of a single container
+type container struct {
+	limits   corev1.ResourceList
+	requests corev1.ResourceList
+	restarts int32
+}
+
+// builder assembles pods from the samples of every query
+type builder struct {
+	pods        map[string]*corev1.Pod
+	containers  map[string]map[string]*container
+	owners      map[string]metav1.OwnerReference
+	deployments map[string]string
+}
+
+func newBuilder() *builder {
+	return &builder{
+		pods:        make(map[string]*corev1.Pod),
+		containers:  make(map[string]map[string]*container),
+		owners:      make(map[string]metav1.OwnerReference),
+		deployments: make(map[string]string),
+	}
+}
+
+// pod returns the pod of a sample, creating it on first use.
+func (b *builder) pod(l map[string]string) *corev1.Pod {
+	k := key(l)
+	pod, ok := b.pods[k]
+	if !ok {
+		pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: l["namespace"], Name: l["pod"]}}
+		b.pods[k] = pod
+	}
+	return pod
+}
+
+// container returns the container of a sample, creating it and its pod on first use.
+func (b *builder) container(l map[string]string) *container {
+	b.pod(l)
+	k := key(l)
+	if b.containers[k] == nil {
+		b.containers[k] = make(map[string]*container)
+	}
+	c, ok := b.containers[k][l["container"]]
+	if !ok {
+		c = &container{limits: corev1.ResourceList{}, requests: corev1.ResourceList{}}
+		b.containers[k][l["container"]] = c
+	}
+	return c
+}
+
+// quantity records a limit or request sample, in cores for CPU and bytes for memory.
+func (b *builder) quantity(l map[string]string, value float64, limit bool) {
+	c := b.container(l)
+	list := c.requests
+	if limit {
+		list = c.limits
+	}
+	switch l["resource"] {
+	case "cpu":
+		list[corev1.ResourceCPU] = *resource.NewMilliQuantity(int64(math.Round(value*1000)), resource.DecimalSI)
+	case "memory":
+		list[corev1.ResourceMemory] = *resource.NewQuantity(int64(value), resource.BinarySI)
+	}
+}
+
+// build returns the assembled pods ordered by namespace and name. Pods owned
+// by a ReplicaSet of a Deployment are attributed to the Deployment directly,
+// since the pod-template-hash label is usually not exported.
+func (b *builder) build() []corev1.Pod {
+	pods := make([]corev1.Pod, 0, len(b.pods))
+	for k, pod := range b.pods {
+		names := make([]string, 0, len(b.containers[k]))
+		for name := range b.containers[k] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			c := b.containers[k][name]
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{
+				Name:      name,
+				Resources: corev1.ResourceRequirements{Limits: c.limits, Requests: c.requests},
+			})
+			pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+				Name:         name,
+				RestartCount: c.restarts,
+			})
+		}
+
+		if owner, ok := b.owners[k]; ok {
+			if deployment, ok := b.deployments[pod.Namespace+"/"+owner.Name]; ok && owner.Kind == "ReplicaSet" {
+				owner = metav1.OwnerReference{Kind: "Deployment", Name: deployment}
+			}
+			controller := true
+			owner.Controller = &controller
+			pod.OwnerReferences = []metav1.OwnerReference{owner}
+		}
+
+		pods = append(pods, *pod)
+	}
+
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Name < pods[j].Name
+	})
+	return pods
+}
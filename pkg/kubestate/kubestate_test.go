@@ -0,0 +1,128 @@
+package kubestate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/prometheus"
+)
+
+// fakeQuerier answers queries by the metric they select
+type fakeQuerier struct {
+	mutex   sync.Mutex
+	queries []string
+	results map[string][]prometheus.Sample
+	err     error
+}
+
+func (f *fakeQuerier) Query(_ context.Context, query string, _ time.Time) ([]prometheus.Sample, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.queries = append(f.queries, query)
+	if f.err != nil {
+		return nil, f.err
+	}
+	for metric, samples := range f.results {
+		if strings.Contains(query, metric+"{") {
+			return samples, nil
+		}
+	}
+	return nil, nil
+}
+
+// sample returns a sample of a pod with the given extra labels
+func sample(pod string, value float64, labels ...string) prometheus.Sample {
+	l := map[string]string{"namespace": "web", "pod": pod}
+	for i := 0; i+1 < len(labels); i += 2 {
+		l[labels[i]] = labels[i+1]
+	}
+	return prometheus.Sample{Labels: l, Value: value}
+}
+
+func TestSource_Pods(t *testing.T) {
+	querier := &fakeQuerier{results: map[string][]prometheus.Sample{
+		"kube_pod_info":         {sample("api-7c9d8-a", 1, "node", "node-1"), sample("debug", 1, "node", "node-2")},
+		"kube_pod_status_phase": {sample("api-7c9d8-a", 1, "phase", "Running"), sample("debug", 1, "phase", "Running")},
+		"kube_pod_container_resource_limits": {
+			sample("api-7c9d8-a", 0.5, "container", "app", "resource", "cpu"),
+			sample("api-7c9d8-a", 512*1024*1024, "container", "app", "resource", "memory"),
+			sample("api-7c9d8-a", 128*1024*1024, "container", "proxy", "resource", "memory"),
+		},
+		"kube_pod_container_resource_requests": {
+			sample("api-7c9d8-a", 0.25, "container", "app", "resource", "cpu"),
+		},
+		"kube_pod_container_status_restarts_total": {
+			sample("api-7c9d8-a", 3, "container", "app"),
+			sample("debug", 0, "container", "shell"),
+		},
+		"kube_pod_owner": {
+			sample("api-7c9d8-a", 1, "owner_kind", "ReplicaSet", "owner_name", "api-7c9d8"),
+			sample("debug", 1, "owner_kind", "<none>", "owner_name", "<none>"),
+		},
+		"kube_replicaset_owner": {
+			{Labels: map[string]string{"namespace": "web", "replicaset": "api-7c9d8", "owner_name": "api"}, Value: 1},
+		},
+		"kube_pod_labels": {sample("api-7c9d8-a", 1, "label_app", "api", "label_tier", "")},
+	}}
+
+	pods, err := New(querier).Pods(context.Background(), config.Options{Namespace: "web"})
+	if err != nil {
+		t.Fatalf("Pods failed: %v", err)
+	}
+
+	for _, query := range querier.queries {
+		if !strings.Contains(query, `namespace="web"`) {
+			t.Errorf("query not restricted to the namespace: %s", query)
+		}
+	}
+
+	if len(pods) != 2 || pods[0].Name != "api-7c9d8-a" || pods[1].Name != "debug" {
+		t.Fatalf("unexpected pods %+v", pods)
+	}
+
+	api := pods[0]
+	if api.Spec.NodeName != "node-1" || api.Status.Phase != corev1.PodRunning {
+		t.Errorf("unexpected node/phase %s/%s", api.Spec.NodeName, api.Status.Phase)
+	}
+	if owner := metrics.ResolveOwner(&api); owner != "Deployment/api" {
+		t.Errorf("expected owner Deployment/api, got %q", owner)
+	}
+	if len(api.Labels) != 1 || api.Labels["app"] != "api" {
+		t.Errorf("unexpected labels %v", api.Labels)
+	}
+
+	info := metrics.NewPodSpecInfo(&api)
+	if info.MemoryLimitMi != 640 || info.CPULimitMc != 500 || info.ContainerMemoryLimits["proxy"] != 128 {
+		t.Errorf("unexpected limits %+v", info)
+	}
+	if len(api.Spec.Containers) != 2 || api.Spec.Containers[0].Name != "app" || api.Status.ContainerStatuses[0].RestartCount != 3 {
+		t.Errorf("unexpected containers %+v", api.Spec.Containers)
+	}
+	if q := api.Spec.Containers[0].Resources.Requests[corev1.ResourceCPU]; q.MilliValue() != 250 {
+		t.Errorf("expected 250m CPU request, got %s", q.String())
+	}
+
+	if owner := metrics.ResolveOwner(&pods[1]); owner != "" {
+		t.Errorf("expected no owner for debug, got %q", owner)
+	}
+}
+
+func TestSource_PodsError(t *testing.T) {
+	querier := &fakeQuerier{err: errors.New("connection refused")}
+	if _, err := New(querier).Pods(context.Background(), config.Options{AllNamespaces: true}); err == nil {
+		t.Fatal("expected error")
+	}
+	for _, query := range querier.queries {
+		if strings.Contains(query, "namespace=") {
+			t.Errorf("all-namespace query restricted to a namespace: %s", query)
+		}
+	}
+}
@@ -4,8 +4,15 @@
 package metrics
 
 import (
+	"math"
+	"strings"
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/mchmarny/kusage/pkg/config"
 )
 
 // PodMetrics represents a simplified view of pod metrics for internal use.
@@ -20,39 +27,803 @@ type PodMetrics struct {
 }
 
 // ContainerMetrics represents container-level resource usage.
-// This type encapsulates the resource usage data for a single container,
-// providing a clean abstraction over the underlying metrics API.
+// Only the quantities used for scoring are extracted from the metrics API
+// ResourceList, so converting large metrics lists does not retain a map per container.
 type ContainerMetrics struct {
-	Name  string              `json:"name"`
-	Usage corev1.ResourceList `json:"usage"`
+	Name          string `json:"name"`
+	MemoryBytes   int64  `json:"memory_bytes"`
+	CPUMillicores int64  `json:"cpu_millicores"`
+	// CPUPeriods and CPUThrottledPeriods are the CFS periods elapsed and throttled
+	// over the window; only sources reading cAdvisor counters report them
+	CPUPeriods          int64 `json:"cpu_periods,omitempty"`
+	CPUThrottledPeriods int64 `json:"cpu_throttled_periods,omitempty"`
+	// MemoryLatestBytes and MemoryGrowthBytesPerSecond are the last working set
+	// sample and its linear growth rate over the window; only history sources
+	// report them, with --forecast
+	MemoryLatestBytes          int64   `json:"memory_latest_bytes,omitempty"`
+	MemoryGrowthBytesPerSecond float64 `json:"memory_growth_bytes_per_second,omitempty"`
+}
+
+// NewContainerMetrics extracts memory and CPU usage from a metrics API ResourceList.
+// Missing quantities are reported as zero.
+func NewContainerMetrics(name string, usage corev1.ResourceList) ContainerMetrics {
+	cm := ContainerMetrics{Name: name}
+	if qty, ok := usage[corev1.ResourceMemory]; ok {
+		cm.MemoryBytes = qty.Value()
+	}
+	if qty, ok := usage[corev1.ResourceCPU]; ok {
+		cm.CPUMillicores = qty.MilliValue()
+	}
+	return cm
+}
+
+// IsInfrastructureContainer reports whether a container name belongs to the pod
+// sandbox rather than to a container of the pod spec. Some runtimes and usage
+// pipelines report the pause container, named POD by dockershim and
+// cri-dockerd (k8s_POD_* as a raw Docker name) or pause, and unnamed series of
+// the pod-level cgroup next to the real containers.
+func IsInfrastructureContainer(name string) bool {
+	switch name {
+	case "", "POD", "pause":
+		return true
+	}
+	return strings.HasPrefix(name, "k8s_POD_")
 }
 
 // Row represents a single result row in the resource usage analysis.
 // This type follows the data transfer object (DTO) pattern and contains
-// all computed values needed for display and sorting.
+// all computed values needed for display and sorting. Its serialized form
+// is the stable contract for JSON output and the library API, so every
+// field carries its unit in the field name.
 type Row struct {
+	// Cluster is the kubeconfig context the row was collected from with --contexts
+	Cluster string `json:"cluster,omitempty" yaml:"cluster,omitempty"`
 	// Namespace is the Kubernetes namespace of the resource
-	Namespace string
+	Namespace string `json:"namespace" yaml:"namespace"`
 	// Name is the resource name (pod name or "pod:container" for container mode)
-	Name string
+	Name string `json:"name" yaml:"name"`
+	// Resource is the resource kind the percentage was computed for
+	Resource config.ResourceKind `json:"resource" yaml:"resource"`
+	// Mode is the analysis granularity the row was produced with
+	Mode config.Mode `json:"mode" yaml:"mode"`
+	// UsageBytes is the memory usage in bytes
+	UsageBytes int64 `json:"usage_bytes,omitempty" yaml:"usage_bytes,omitempty"`
+	// LimitBytes is the memory limit in bytes
+	LimitBytes int64 `json:"limit_bytes,omitempty" yaml:"limit_bytes,omitempty"`
 	// UsageMi is the memory usage in mebibytes (Mi)
-	UsageMi float64
+	UsageMi float64 `json:"usage_mi,omitempty" yaml:"usage_mi,omitempty"`
 	// LimitMi is the memory limit in mebibytes (Mi)
-	LimitMi float64
+	LimitMi float64 `json:"limit_mi,omitempty" yaml:"limit_mi,omitempty"`
 	// UsageMc is the CPU usage in millicores (mCPU)
-	UsageMc int64
+	UsageMc int64 `json:"usage_millicores,omitempty" yaml:"usage_millicores,omitempty"`
 	// LimitMc is the CPU limit in millicores (mCPU)
-	LimitMc int64
+	LimitMc int64 `json:"limit_millicores,omitempty" yaml:"limit_millicores,omitempty"`
+	// RequestBytes is the memory request in bytes
+	RequestBytes int64 `json:"request_bytes,omitempty" yaml:"request_bytes,omitempty"`
+	// RequestMi is the memory request in mebibytes (Mi)
+	RequestMi float64 `json:"request_mi,omitempty" yaml:"request_mi,omitempty"`
+	// RequestMc is the CPU request in millicores (mCPU)
+	RequestMc int64 `json:"request_millicores,omitempty" yaml:"request_millicores,omitempty"`
 	// Percentage is the usage/limit ratio as a percentage
+	Percentage float64 `json:"percentage" yaml:"percentage"`
+	// Cost is the hourly cost of the greater of the request and the usage of
+	// the row's resources, when priced with --pricing
+	Cost float64 `json:"cost_per_hour,omitempty" yaml:"cost_per_hour,omitempty"`
+	// Score is the result of the user-supplied score expression (--score-expr)
+	Score float64 `json:"score,omitempty" yaml:"score,omitempty"`
+	// Severity classifies Percentage against the thresholds that apply to the row
+	Severity Severity `json:"severity,omitempty" yaml:"severity,omitempty"`
+	// Window is the interval over which metrics-server computed the usage sample
+	Window time.Duration `json:"window_ns,omitempty" yaml:"window_ns,omitempty"`
+	// Timestamp is the time at which the usage sample was collected
+	Timestamp time.Time `json:"timestamp" yaml:"timestamp"`
+	// CPUPeriods is the number of CFS periods elapsed over the window, when the usage source reports throttling
+	CPUPeriods int64 `json:"cpu_periods,omitempty" yaml:"cpu_periods,omitempty"`
+	// ThrottledPeriods is the number of CFS periods in which the CPU limit was reached
+	ThrottledPeriods int64 `json:"throttled_periods,omitempty" yaml:"throttled_periods,omitempty"`
+	// ThrottlePercent is ThrottledPeriods relative to CPUPeriods as a percentage
+	ThrottlePercent float64 `json:"throttle_percent,omitempty" yaml:"throttle_percent,omitempty"`
+	// HoursToLimit is the time until memory usage reaches the limit at its linear
+	// growth rate over the window, when requested with --forecast and growing
+	HoursToLimit *float64 `json:"hours_to_limit,omitempty" yaml:"hours_to_limit,omitempty"`
+	// Network is the pod network throughput, when requested with --show-network
+	Network *NetworkUsage `json:"network,omitempty" yaml:"network,omitempty"`
+	// Replicas summarizes the containers merged into the row with --group-by container-name
+	Replicas *ReplicaStats `json:"replicas,omitempty" yaml:"replicas,omitempty"`
+	// Samples summarizes the usage over the collections of --samples
+	Samples *SampleStats `json:"samples,omitempty" yaml:"samples,omitempty"`
+	// Restarts is the container restart count (summed across containers for pods)
+	Restarts int32 `json:"restarts" yaml:"restarts"`
+	// CrashLoop reports a container (any container for pods) waiting in
+	// CrashLoopBackOff, whose near-zero usage does not mean it is oversized
+	CrashLoop bool `json:"crash_loop,omitempty" yaml:"crash_loop,omitempty"`
+	// Windows reports a pod scheduled for Windows nodes, whose memory usage is
+	// the private working set rather than the cgroup working set of Linux
+	Windows bool `json:"windows,omitempty" yaml:"windows,omitempty"`
+	// DefaultMemoryLimit and DefaultCPULimit report a limit that includes the
+	// default of the namespace LimitRange for a container without its own
+	DefaultMemoryLimit bool `json:"default_memory_limit,omitempty" yaml:"default_memory_limit,omitempty"`
+	DefaultCPULimit    bool `json:"default_cpu_limit,omitempty" yaml:"default_cpu_limit,omitempty"`
+	// Node is the name of the node the pod is scheduled on
+	Node string `json:"node,omitempty" yaml:"node,omitempty"`
+	// Owner is the controlling workload in Kind/Name form (e.g. Deployment/my-api)
+	Owner string `json:"owner,omitempty" yaml:"owner,omitempty"`
+	// PriorityClass is the priority class of the pod (spec.priorityClassName)
+	PriorityClass string `json:"priority_class,omitempty" yaml:"priority_class,omitempty"`
+	// Labels are the labels of the pod the row was produced from
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// HasLimit reports whether the row has a limit of its resource, or of either
+// resource for rows of both. Rows without one are only collected with
+// --include-no-limit and have no percentage.
+func (r Row) HasLimit() bool {
+	switch r.Resource {
+	case config.ResourceCPU:
+		return r.LimitMc > 0
+	case config.ResourceAll:
+		return r.LimitMi > 0 || r.LimitMc > 0
+	default:
+		return r.LimitMi > 0
+	}
+}
+
+// ResourcePercentage returns the usage of resource as a percentage of its
+// limit, or false when the row has no limit of resource.
+func (r Row) ResourcePercentage(resource config.ResourceKind) (float64, bool) {
+	if resource == config.ResourceCPU {
+		if r.LimitMc <= 0 {
+			return 0, false
+		}
+		return float64(r.UsageMc) / float64(r.LimitMc) * 100, true
+	}
+	if r.LimitMi <= 0 {
+		return 0, false
+	}
+	return r.UsageMi / r.LimitMi * 100, true
+}
+
+// NetworkUsage is the network throughput of a pod across its interfaces.
+type NetworkUsage struct {
+	// RxBytesPerSecond is the receive rate in bytes per second
+	RxBytesPerSecond float64 `json:"rx_bytes_per_second" yaml:"rx_bytes_per_second"`
+	// TxBytesPerSecond is the transmit rate in bytes per second
+	TxBytesPerSecond float64 `json:"tx_bytes_per_second" yaml:"tx_bytes_per_second"`
+}
+
+// ReplicaStats summarizes the usage percentages of the containers of the same
+// name across the replicas of a workload.
+type ReplicaStats struct {
+	// Count is the number of containers merged
+	Count int `json:"count" yaml:"count"`
+	// MeanPercentage is the mean of their percentages
+	MeanPercentage float64 `json:"mean_percentage" yaml:"mean_percentage"`
+	// P95Percentage is the 95th percentile of their percentages (nearest rank)
+	P95Percentage float64 `json:"p95_percentage" yaml:"p95_percentage"`
+	// MaxPercentage is the highest of their percentages
+	MaxPercentage float64 `json:"max_percentage" yaml:"max_percentage"`
+}
+
+// SampleStats summarizes the usage of a row over repeated collections, in the
+// units of its resource: Mi for memory and millicores for CPU.
+type SampleStats struct {
+	// Count is the number of collections the row was found in
+	Count int `json:"count" yaml:"count"`
+	// Min is the lowest usage sampled
+	Min float64 `json:"min" yaml:"min"`
+	// Avg is the mean usage, which the usage and percentage of the row report
+	Avg float64 `json:"avg" yaml:"avg"`
+	// P95 is the 95th percentile of the usage sampled (nearest rank)
+	P95 float64 `json:"p95" yaml:"p95"`
+	// Max is the highest usage sampled
+	Max float64 `json:"max" yaml:"max"`
+}
+
+// SetThrottle records the CFS periods of a row and computes its throttle percentage.
+func (r *Row) SetThrottle(periods, throttled int64) {
+	r.CPUPeriods = periods
+	r.ThrottledPeriods = throttled
+	r.ThrottlePercent = 0
+	if periods > 0 {
+		r.ThrottlePercent = float64(throttled) / float64(periods) * 100
+	}
+}
+
+// BytesPerMi is the number of bytes in a mebibyte.
+const BytesPerMi = 1024 * 1024
+
+// MiToBytes converts mebibytes to bytes.
+func MiToBytes(mi float64) int64 {
+	return int64(math.Round(mi * BytesPerMi))
+}
+
+// Group is a set of rows sharing a grouping key (e.g. node name)
+// together with their aggregated totals.
+type Group struct {
+	// Key is the value shared by all rows in the group
+	Key string
+	// Rows are the member rows in their original order
+	Rows []Row
+	// Total aggregates usage, limits and restarts across Rows
+	Total Row
+	// Namespaces lists the distinct namespaces of Rows, in order of appearance
+	Namespaces []string
+	// Headroom is the unused limit summed across Rows, ignoring rows over
+	// their limit (Mi for memory, millicores for CPU)
+	Headroom float64
+}
+
+// Severity classifies a usage percentage against warning and critical thresholds.
+type Severity string
+
+const (
+	// SeverityOK is below the warning threshold
+	SeverityOK Severity = "ok"
+	// SeverityWarning is at or above the warning threshold
+	SeverityWarning Severity = "warning"
+	// SeverityCritical is at or above the critical threshold
+	SeverityCritical Severity = "critical"
+)
+
+// ChargebackLine contains the resources a group consumed and reserved over a
+// period, expressed in resource-hours so periods of different lengths compare.
+type ChargebackLine struct {
+	// Group is the value of the grouping label (e.g. the team name)
+	Group string `json:"group" yaml:"group"`
+	// CPUCoreHoursUsed is the CPU consumed, in core-hours
+	CPUCoreHoursUsed float64 `json:"cpu_core_hours_used" yaml:"cpu_core_hours_used"`
+	// CPUCoreHoursReserved is the CPU requested, in core-hours
+	CPUCoreHoursReserved float64 `json:"cpu_core_hours_reserved" yaml:"cpu_core_hours_reserved"`
+	// MemoryGiBHoursUsed is the working set memory consumed, in GiB-hours
+	MemoryGiBHoursUsed float64 `json:"memory_gib_hours_used" yaml:"memory_gib_hours_used"`
+	// MemoryGiBHoursReserved is the memory requested, in GiB-hours
+	MemoryGiBHoursReserved float64 `json:"memory_gib_hours_reserved" yaml:"memory_gib_hours_reserved"`
+}
+
+// WorkloadUsage is the combined usage of a workload's rows in one cluster,
+// expressed in the unit of the analyzed resource (Mi for memory, millicores for CPU).
+type WorkloadUsage struct {
+	// Rows is the number of pod or container rows of the workload
+	Rows int
+	// Usage is the sum of usage across the rows
+	Usage float64
+	// Limit is the sum of limits across the rows
+	Limit float64
+	// Percentage is Usage relative to Limit
+	Percentage float64
+}
+
+// Comparison pairs the usage of a workload in two clusters. Left or Right is
+// nil when the workload only runs in the other cluster.
+type Comparison struct {
+	// Namespace is the Kubernetes namespace of the workload
+	Namespace string
+	// Workload identifies the workload (Kind/Name, with :container in container mode)
+	Workload string
+	// Left is the usage in the first cluster
+	Left *WorkloadUsage
+	// Right is the usage in the second cluster
+	Right *WorkloadUsage
+}
+
+// Delta returns the change of the usage percentage from Left to Right, in
+// percentage points. It returns false unless the workload runs in both clusters.
+func (c Comparison) Delta() (float64, bool) {
+	if c.Left == nil || c.Right == nil {
+		return 0, false
+	}
+	return c.Right.Percentage - c.Left.Percentage, true
+}
+
+// Refresh is one refresh of watch mode: the rows listed and how they differ
+// from the rows of the previous refresh.
+type Refresh struct {
+	// Rows are the listed rows, ranked
+	Rows []Row
+	// Changes holds the change of every listed row, in the order of Rows
+	Changes []RowChange
+	// Gone are the rows of the previous refresh no longer listed, e.g. deleted
+	// or OOM-killed pods and rows that dropped out of the top rows
+	Gone []Row
+}
+
+// RowChange describes how a listed row differs from the previous refresh.
+type RowChange struct {
+	// Entered is true for rows that were not listed in the previous refresh
+	Entered bool
+	// Delta is the change of the percentage since the previous refresh, in
+	// percentage points, when it moved by at least the watch delta
+	Delta float64
+}
+
+// NodePool aggregates the capacity and consumption of the nodes sharing a pool
+// label value. Quantities are expressed in the unit of the analyzed resource
+// (Mi for memory, millicores for CPU).
+type NodePool struct {
+	// Name is the value of the pool label
+	Name string
+	// Nodes is the number of nodes in the pool
+	Nodes int
+	// Pods is the number of running pods scheduled to the pool
+	Pods int
+	// Allocatable is the sum of node allocatable capacity
+	Allocatable float64
+	// Requests is the sum of pod requests
+	Requests float64
+	// Limits is the sum of pod limits; pods without a limit are counted in Unlimited
+	Limits float64
+	// Unlimited is the number of pods without a limit for the resource
+	Unlimited int
+	// Usage is the sum of current pod usage
+	Usage float64
+	// GrowthPerDay is the usage change per day observed in history
+	GrowthPerDay float64
+	// HasGrowth indicates whether GrowthPerDay was computed from history
+	HasGrowth bool
+}
+
+// Headroom returns the allocatable capacity not currently used.
+func (p NodePool) Headroom() float64 {
+	return p.Allocatable - p.Usage
+}
+
+// DaysToFull projects the number of days until usage reaches allocatable
+// capacity at the current growth rate. It returns false when there is no
+// history or usage is not growing.
+func (p NodePool) DaysToFull() (float64, bool) {
+	if !p.HasGrowth || p.GrowthPerDay <= 0 {
+		return 0, false
+	}
+	return max(p.Headroom(), 0) / p.GrowthPerDay, true
+}
+
+// NodeAllocation describes the capacity of a node and how much of it is
+// reserved by the requests of its pods. Memory is expressed in Mi and CPU in
+// millicores.
+type NodeAllocation struct {
+	// Name is the node name
+	Name string
+	// Unschedulable indicates the node is cordoned
+	Unschedulable bool
+	// Taints are the NoSchedule and NoExecute taints of the node in
+	// key=value:Effect form, which keep pods without a toleration off it
+	Taints []string
+	// AllocatableMc is the CPU available to pods
+	AllocatableMc int64
+	// AllocatableMi is the memory available to pods
+	AllocatableMi float64
+	// AllocatablePods is the number of pods the node accepts
+	AllocatablePods int64
+	// Pods is the number of pods bound to the node that have not terminated
+	Pods int64
+	// RequestedMc is the CPU requested by the pods on the node
+	RequestedMc int64
+	// RequestedMi is the memory requested by the pods on the node
+	RequestedMi float64
+	// ReclaimableMc is the CPU requested above current usage
+	ReclaimableMc int64
+	// ReclaimableMi is the memory requested above current usage
+	ReclaimableMi float64
+}
+
+// Schedulable returns true if the node is neither cordoned nor tainted
+// against pods without a toleration.
+func (n NodeAllocation) Schedulable() bool {
+	return !n.Unschedulable && len(n.Taints) == 0
+}
+
+// Fits returns true if the requests fit into the unrequested capacity of the node.
+func (n NodeAllocation) Fits(requestMc int64, requestMi float64) bool {
+	return requestMc <= n.AllocatableMc-n.RequestedMc && requestMi <= n.AllocatableMi-n.RequestedMi
+}
+
+// FitsRightsized returns true if the requests would fit were the requests of
+// the pods on the node reduced to their current usage.
+func (n NodeAllocation) FitsRightsized(requestMc int64, requestMi float64) bool {
+	return requestMc <= n.AllocatableMc-n.RequestedMc+n.ReclaimableMc &&
+		requestMi <= n.AllocatableMi-n.RequestedMi+n.ReclaimableMi
+}
+
+// PodShape is the CPU and memory a pod requests.
+type PodShape struct {
+	// CPUMc is the requested CPU in millicores
+	CPUMc int64
+	// MemoryMi is the requested memory in Mi
+	MemoryMi float64
+}
+
+// NodeFragmentation is the unrequested capacity of a node and the part of it
+// pods of a given shape cannot use.
+type NodeFragmentation struct {
+	// Name is the node name
+	Name string
+	// FreeMc is the allocatable CPU not requested by the pods on the node
+	FreeMc int64
+	// FreeMi is the allocatable memory not requested by the pods on the node
+	FreeMi float64
+	// Fits is the number of pods of the shape the free capacity holds
+	Fits int64
+	// StrandedMc is the free CPU left once Fits pods are placed
+	StrandedMc int64
+	// StrandedMi is the free memory left once Fits pods are placed
+	StrandedMi float64
+}
+
+// Fragmentation is the free capacity of the schedulable nodes that pods of
+// the typical shape cannot use, because one resource runs out before the other.
+type Fragmentation struct {
+	// Shape is the pod shape the free capacity is packed with
+	Shape PodShape
+	// Nodes are the schedulable nodes, by name
+	Nodes []NodeFragmentation
+	// AllocatableMc is the total allocatable CPU of the schedulable nodes
+	AllocatableMc int64
+	// AllocatableMi is the total allocatable memory of the schedulable nodes
+	AllocatableMi float64
+}
+
+// PendingPod is a pod the scheduler could not place, with the resources it requests.
+type PendingPod struct {
+	// Namespace is the Kubernetes namespace of the pod
+	Namespace string
+	// Name is the pod name
+	Name string
+	// Owner is the controlling workload in Kind/Name form
+	Owner string
+	// RequestMc is the CPU the pod requests (millicores)
+	RequestMc int64
+	// RequestMi is the memory the pod requests (Mi)
+	RequestMi float64
+	// Message is the scheduler's explanation from the PodScheduled condition
+	Message string
+	// FitsNow is the number of schedulable nodes with enough unrequested capacity
+	FitsNow int
+	// FitsRightsized is the number of schedulable nodes that would have enough
+	// capacity if the requests of their pods matched current usage
+	FitsRightsized int
+	// Verdict summarizes what blocks scheduling
+	Verdict string
+}
+
+// VolumeUsage is the filesystem usage of a persistent volume claim mounted by a pod.
+type VolumeUsage struct {
+	// Namespace is the Kubernetes namespace of the pod and claim
+	Namespace string
+	// Claim is the name of the persistent volume claim
+	Claim string
+	// Pod is the name of the pod mounting the claim
+	Pod string
+	// Node is the name of the node the pod runs on
+	Node string
+	// UsedBytes is the space used on the volume
+	UsedBytes int64
+	// CapacityBytes is the total space of the volume
+	CapacityBytes int64
+	// Percentage is UsedBytes relative to CapacityBytes
 	Percentage float64
 }
 
+// ResourceTotals are the summed usage and limits of a set of containers.
+type ResourceTotals struct {
+	// MemoryMi is the memory working set (Mi)
+	MemoryMi float64
+	// MemoryLimitMi is the memory limit (Mi)
+	MemoryLimitMi float64
+	// CPUMc is the CPU usage (millicores)
+	CPUMc int64
+	// CPULimitMc is the CPU limit (millicores)
+	CPULimitMc int64
+}
+
+// Add accumulates other into t.
+func (t *ResourceTotals) Add(other ResourceTotals) {
+	t.MemoryMi += other.MemoryMi
+	t.MemoryLimitMi += other.MemoryLimitMi
+	t.CPUMc += other.CPUMc
+	t.CPULimitMc += other.CPULimitMc
+}
+
+// SidecarUsage is the share of a pod's usage and limits its sidecar containers account for.
+type SidecarUsage struct {
+	// Namespace is the Kubernetes namespace of the pod
+	Namespace string
+	// Name is the pod name
+	Name string
+	// Containers are the names of the sidecar containers
+	Containers []string
+	// Sidecars are the totals of the sidecar containers
+	Sidecars ResourceTotals
+	// Total are the totals of all containers of the pod, sidecars included
+	Total ResourceTotals
+}
+
+// Waste is the memory and CPU reserved by the requests or limits of a pod,
+// or of all pods of a namespace, and the part of it left unused. Unused
+// resources are summed per container, so a container using more than it
+// reserved does not offset another's waste. Memory values are in Mi and CPU
+// values in millicores.
+type Waste struct {
+	// Namespace is the Kubernetes namespace
+	Namespace string
+	// Name is the pod name, empty for the totals of a namespace
+	Name string
+	// Pods is the number of pods summed
+	Pods int
+	// ReservedMi is the reserved memory
+	ReservedMi float64
+	// UsedMi is the memory working set
+	UsedMi float64
+	// UnusedMi is the reserved memory left unused
+	UnusedMi float64
+	// ReservedMc is the reserved CPU
+	ReservedMc int64
+	// UsedMc is the CPU usage
+	UsedMc int64
+	// UnusedMc is the reserved CPU left unused
+	UnusedMc int64
+}
+
+// Add accumulates other into w.
+func (w *Waste) Add(other Waste) {
+	w.Pods += other.Pods
+	w.ReservedMi += other.ReservedMi
+	w.UsedMi += other.UsedMi
+	w.UnusedMi += other.UnusedMi
+	w.ReservedMc += other.ReservedMc
+	w.UsedMc += other.UsedMc
+	w.UnusedMc += other.UnusedMc
+}
+
+// WasteReport ranks the pods and namespaces with the most reserved
+// resources left unused.
+type WasteReport struct {
+	// Pods are the pods with the most unused resources
+	Pods []Waste
+	// Namespaces are the totals of every namespace, across all pods
+	Namespaces []Waste
+	// Total sums every namespace
+	Total Waste
+}
+
+// CostRollup is the hourly cost of the rows sharing a namespace or the value
+// of a pod label.
+type CostRollup struct {
+	// Key is the namespace or label value shared by the rows
+	Key string
+	// Rows is the number of rows summed
+	Rows int
+	// Cost is the summed hourly cost of the rows
+	Cost float64
+}
+
+// QuotaUsage is a compute resource of a ResourceQuota: its hard limit, what
+// the quota has admitted against it and what the pods of its namespace use.
+// Memory values are in Mi and CPU values in millicores.
+type QuotaUsage struct {
+	// Namespace is the Kubernetes namespace of the quota
+	Namespace string
+	// Quota is the name of the ResourceQuota
+	Quota string
+	// Resource is the quota resource, such as limits.memory or requests.cpu
+	Resource string
+	// Hard is the hard limit of the resource
+	Hard float64
+	// Used is the amount the quota reports as used: the summed requests or
+	// limits of the non-terminal pods of the namespace
+	Used float64
+	// Usage is the summed actual usage of the running pods of the namespace
+	Usage float64
+	// Scoped is true when the quota only covers some pods, such as those of a
+	// priority class, so Usage, which covers all pods, is not comparable
+	Scoped bool
+}
+
+// Memory returns true when the resource is memory rather than CPU.
+func (q QuotaUsage) Memory() bool {
+	return strings.HasSuffix(q.Resource, "memory")
+}
+
+// Percentage is Used relative to Hard.
+func (q QuotaUsage) Percentage() float64 {
+	if q.Hard <= 0 {
+		return 0
+	}
+	return q.Used / q.Hard * 100
+}
+
+// UsagePercentage is Usage relative to Hard.
+func (q QuotaUsage) UsagePercentage() float64 {
+	if q.Hard <= 0 {
+		return 0
+	}
+	return q.Usage / q.Hard * 100
+}
+
+// Recommendation is the suggested requests and limits of a container of a
+// workload, derived from the peak usage observed across its replicas.
+type Recommendation struct {
+	// Namespace is the Kubernetes namespace of the workload
+	Namespace string
+	// Owner is the workload in Kind/Name form, or Pod/<name> for pods without a controller
+	Owner string
+	// Container is the container name
+	Container string
+	// Pods is the number of replicas the usage was observed on
+	Pods int
+	// UsedMi is the peak memory working set observed (Mi)
+	UsedMi float64
+	// UsedMc is the peak CPU usage observed (millicores)
+	UsedMc int64
+	// Current are the requests and limits the container is set to now
+	Current ResourceSettings
+	// Suggested are the requests and limits the observed usage calls for;
+	// a zero limit suggests no limit
+	Suggested ResourceSettings
+	// Labels are the labels of a pod of the workload
+	Labels map[string]string
+	// Disruption is the PodDisruptionBudget limiting voluntary evictions of the
+	// pods of the workload, e.g. by node drains; nil when the budgets were not read
+	Disruption *Disruption
+}
+
+// Disruption is the PodDisruptionBudget allowing the fewest evictions of the
+// pods of a workload.
+type Disruption struct {
+	// Budget is the name of the budget, empty when no budget selects the pods
+	Budget string
+	// Allowed is the number of pods the budget currently allows to be evicted
+	Allowed int32
+}
+
+// DisruptionBudget is a PodDisruptionBudget and the evictions it currently
+// allows among the pods it selects.
+type DisruptionBudget struct {
+	// Namespace is the Kubernetes namespace of the budget and its pods
+	Namespace string
+	// Name is the budget name
+	Name string
+	// Selector selects the pods of the budget
+	Selector labels.Selector
+	// Allowed is the number of pods that may be evicted now (status.disruptionsAllowed)
+	Allowed int32
+}
+
+// ResourceSettings are the memory and CPU requests and limits of a container.
+// Values that are not set are zero.
+type ResourceSettings struct {
+	// MemoryRequestMi is the memory request (Mi)
+	MemoryRequestMi float64
+	// MemoryLimitMi is the memory limit (Mi)
+	MemoryLimitMi float64
+	// CPURequestMc is the CPU request (millicores)
+	CPURequestMc int64
+	// CPULimitMc is the CPU limit (millicores)
+	CPULimitMc int64
+}
+
+// FilesystemUsage is the used space of a node filesystem.
+type FilesystemUsage struct {
+	// UsedBytes is the space used on the filesystem
+	UsedBytes int64
+	// CapacityBytes is the total space of the filesystem
+	CapacityBytes int64
+}
+
+// Percentage returns UsedBytes relative to CapacityBytes, or 0 without capacity.
+func (u FilesystemUsage) Percentage() float64 {
+	if u.CapacityBytes <= 0 {
+		return 0
+	}
+	return float64(u.UsedBytes) / float64(u.CapacityBytes) * 100
+}
+
+// NodeFilesystems is the usage of the filesystems the kubelet evicts pods on
+// when they run low. Either is nil when the kubelet does not report it.
+type NodeFilesystems struct {
+	// NodeFS is the root filesystem holding kubelet data, logs and emptyDir volumes
+	NodeFS *FilesystemUsage
+	// ImageFS is the filesystem holding container images and writable layers
+	ImageFS *FilesystemUsage
+}
+
+// NodeResourceUsage is the CPU and memory in use on a node, as the metrics
+// API reports it for the node as a whole, system daemons included.
+type NodeResourceUsage struct {
+	// UsedMc is the CPU in use (millicores)
+	UsedMc int64
+	// UsedMi is the memory working set (Mi)
+	UsedMi float64
+}
+
+// NodeUsage is the allocation, resource usage and filesystem usage of a node.
+type NodeUsage struct {
+	NodeAllocation
+	NodeFilesystems
+	// Usage is nil when the metrics API does not report the node
+	Usage *NodeResourceUsage
+}
+
+// ContainerLimits records which resource limits a container of a pod sets.
+type ContainerLimits struct {
+	// Namespace is the Kubernetes namespace of the pod
+	Namespace string
+	// Pod is the pod name
+	Pod string
+	// Container is the container name
+	Container string
+	// Owner is the controlling workload in Kind/Name form
+	Owner string
+	// Labels are the labels of the pod
+	Labels map[string]string
+	// CPU is true if the container sets a CPU limit
+	CPU bool
+	// Memory is true if the container sets a memory limit
+	Memory bool
+}
+
+// Baseline is the accepted usage percentage of every workload, against which
+// the check command detects regressions.
+type Baseline struct {
+	// Mode is the analysis granularity the baseline was recorded with
+	Mode config.Mode `json:"mode"`
+	// Workloads are ordered by namespace, workload and resource
+	Workloads []BaselineEntry `json:"workloads"`
+}
+
+// BaselineEntry is the accepted usage percentage of a workload for a resource.
+type BaselineEntry struct {
+	// Namespace is the Kubernetes namespace of the workload
+	Namespace string `json:"namespace"`
+	// Workload identifies the workload (Kind/Name, with :container in container mode)
+	Workload string `json:"workload"`
+	// Resource is the resource the percentage was computed for
+	Resource config.ResourceKind `json:"resource"`
+	// Percentage is the combined usage of the workload relative to its limits
+	Percentage float64 `json:"percentage"`
+}
+
+// Snapshot is a collection saved by snapshot save, so usage can be compared
+// across runs.
+type Snapshot struct {
+	// ID names the snapshot by the time it was taken and its cluster
+	ID string `json:"id"`
+	// TakenAt is when the rows were collected
+	TakenAt time.Time `json:"taken_at"`
+	// Cluster is the kubeconfig context the rows were collected from
+	Cluster string `json:"cluster"`
+	// Mode is the analysis granularity of the rows
+	Mode config.Mode `json:"mode"`
+	// Rows are the collected rows, with memory and CPU side by side
+	Rows []Row `json:"rows"`
+}
+
+// Violation is a pod or container that breaks a policy rule.
+type Violation struct {
+	// Rule is the name of the broken rule
+	Rule string
+	// Namespace is the Kubernetes namespace of the pod
+	Namespace string
+	// Name is the pod name, "pod:container" for container checks, or the
+	// workload for baseline regressions
+	Name string
+	// Owner is the controlling workload in Kind/Name form
+	Owner string
+	// Detail describes how the rule is broken
+	Detail string
+}
+
 // PodSpecInfo contains computed resource limits and other metadata for a pod.
 // This type serves as an optimized lookup structure that pre-computes resource
 // limits to avoid repeated calculations during metrics processing.
 type PodSpecInfo struct {
 	// Pod is a reference to the original pod specification
 	Pod *corev1.Pod
+	// NodeName is the node the pod is scheduled on (spec.nodeName)
+	NodeName string
+	// Owner is the controlling workload in Kind/Name form (e.g. Deployment/my-api)
+	Owner string
+	// PriorityClass is the priority class of the pod (spec.priorityClassName)
+	PriorityClass string
 	// MemoryLimitMi is the total memory limit across all containers (Mi)
 	MemoryLimitMi float64
 	// CPULimitMc is the total CPU limit across all containers (millicores)
@@ -61,6 +832,63 @@ type PodSpecInfo struct {
 	ContainerMemoryLimits map[string]float64
 	// ContainerCPULimits maps container names to their CPU limits (millicores)
 	ContainerCPULimits map[string]int64
+	// MemoryRequestMi is the total memory request across all containers (Mi)
+	MemoryRequestMi float64
+	// CPURequestMc is the total CPU request across all containers (millicores)
+	CPURequestMc int64
+	// ContainerMemoryRequests maps container names to their memory requests (Mi)
+	ContainerMemoryRequests map[string]float64
+	// ContainerCPURequests maps container names to their CPU requests (millicores)
+	ContainerCPURequests map[string]int64
+	// Restarts is the total restart count across all containers
+	Restarts int32
+	// ContainerRestarts maps container names to their restart counts
+	ContainerRestarts map[string]int32
+	// ContainerCrashLoop holds the containers and init containers waiting in
+	// CrashLoopBackOff
+	ContainerCrashLoop map[string]bool
+	// Windows is true for pods scheduled for Windows nodes
+	Windows bool
+	// DefaultMemoryLimits and DefaultCPULimits hold the containers whose limit
+	// is the LimitRange default of the namespace rather than their own
+	DefaultMemoryLimits map[string]bool
+	DefaultCPULimits    map[string]bool
+}
+
+// LimitDefaults are the default container limits of a namespace, from the
+// default of its LimitRange of type Container. Zero means no default.
+type LimitDefaults struct {
+	// MemoryMi is the default memory limit (Mi)
+	MemoryMi float64
+	// CPUMc is the default CPU limit (millicores)
+	CPUMc int64
+}
+
+// ApplyLimitDefaults gives the containers of the pod without a limit the
+// default limit of its namespace, as the LimitRange admission plugin does for
+// pods created after the LimitRange, and records them as defaulted.
+func (p *PodSpecInfo) ApplyLimitDefaults(defaults LimitDefaults) {
+	if p.Pod == nil {
+		return
+	}
+	for _, container := range p.Pod.Spec.Containers {
+		if defaults.MemoryMi > 0 && !p.ContainerHasMemoryLimit(container.Name) {
+			if p.DefaultMemoryLimits == nil {
+				p.DefaultMemoryLimits = make(map[string]bool)
+			}
+			p.MemoryLimitMi += defaults.MemoryMi
+			p.ContainerMemoryLimits[container.Name] = defaults.MemoryMi
+			p.DefaultMemoryLimits[container.Name] = true
+		}
+		if defaults.CPUMc > 0 && !p.ContainerHasCPULimit(container.Name) {
+			if p.DefaultCPULimits == nil {
+				p.DefaultCPULimits = make(map[string]bool)
+			}
+			p.CPULimitMc += defaults.CPUMc
+			p.ContainerCPULimits[container.Name] = defaults.CPUMc
+			p.DefaultCPULimits[container.Name] = true
+		}
+	}
 }
 
 // NewPodSpecInfo creates a new PodSpecInfo from a pod specification.
@@ -69,16 +897,35 @@ type PodSpecInfo struct {
 // in high-performance distributed systems.
 func NewPodSpecInfo(pod *corev1.Pod) *PodSpecInfo {
 	info := &PodSpecInfo{
-		Pod:                   pod,
-		ContainerMemoryLimits: make(map[string]float64, len(pod.Spec.Containers)),
-		ContainerCPULimits:    make(map[string]int64, len(pod.Spec.Containers)),
+		Pod:                     pod,
+		NodeName:                pod.Spec.NodeName,
+		Owner:                   ResolveOwner(pod),
+		PriorityClass:           pod.Spec.PriorityClassName,
+		Windows:                 IsWindowsPod(pod),
+		ContainerMemoryLimits:   make(map[string]float64, len(pod.Spec.Containers)),
+		ContainerCPULimits:      make(map[string]int64, len(pod.Spec.Containers)),
+		ContainerMemoryRequests: make(map[string]float64, len(pod.Spec.Containers)),
+		ContainerCPURequests:    make(map[string]int64, len(pod.Spec.Containers)),
+		ContainerRestarts:       make(map[string]int32, len(pod.Status.ContainerStatuses)),
+	}
+
+	// Capture restart counts from container statuses
+	for _, status := range pod.Status.ContainerStatuses {
+		info.Restarts += status.RestartCount
+		info.ContainerRestarts[status.Name] = status.RestartCount
+	}
+	for _, name := range CrashLoopContainers(pod) {
+		if info.ContainerCrashLoop == nil {
+			info.ContainerCrashLoop = make(map[string]bool)
+		}
+		info.ContainerCrashLoop[name] = true
 	}
 
-	// Pre-compute resource limits for all containers
+	// Pre-compute resource limits and requests for all containers
 	for _, container := range pod.Spec.Containers {
 		// Memory limits
 		if limit, ok := container.Resources.Limits[corev1.ResourceMemory]; ok {
-			memoryMi := float64(limit.Value()) / (1024 * 1024) // Convert bytes to Mi
+			memoryMi := float64(limit.Value()) / BytesPerMi // Convert bytes to Mi
 			info.MemoryLimitMi += memoryMi
 			info.ContainerMemoryLimits[container.Name] = memoryMi
 		}
@@ -89,11 +936,81 @@ func NewPodSpecInfo(pod *corev1.Pod) *PodSpecInfo {
 			info.CPULimitMc += cpuMc
 			info.ContainerCPULimits[container.Name] = cpuMc
 		}
+
+		// Memory requests
+		if request, ok := container.Resources.Requests[corev1.ResourceMemory]; ok {
+			memoryMi := float64(request.Value()) / BytesPerMi
+			info.MemoryRequestMi += memoryMi
+			info.ContainerMemoryRequests[container.Name] = memoryMi
+		}
+
+		// CPU requests
+		if request, ok := container.Resources.Requests[corev1.ResourceCPU]; ok {
+			cpuMc := request.MilliValue()
+			info.CPURequestMc += cpuMc
+			info.ContainerCPURequests[container.Name] = cpuMc
+		}
 	}
 
 	return info
 }
 
+// CrashLooping reports whether any container of the pod is waiting in
+// CrashLoopBackOff.
+func (p *PodSpecInfo) CrashLooping() bool {
+	return len(p.ContainerCrashLoop) > 0
+}
+
+// ReasonCrashLoopBackOff is the waiting reason of containers the kubelet
+// restarts with an increasing back-off after they repeatedly fail
+const ReasonCrashLoopBackOff = "CrashLoopBackOff"
+
+// CrashLoopContainers returns the names of the init containers and
+// containers of pod waiting in CrashLoopBackOff.
+func CrashLoopContainers(pod *corev1.Pod) []string {
+	var names []string
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.State.Waiting != nil && status.State.Waiting.Reason == ReasonCrashLoopBackOff {
+				names = append(names, status.Name)
+			}
+		}
+	}
+	return names
+}
+
+// IsWindowsPod reports whether pod is scheduled for Windows nodes, by its
+// spec.os or a kubernetes.io/os node selector. Nodes are not listed, so pods
+// relying on other scheduling constraints are not recognized.
+func IsWindowsPod(pod *corev1.Pod) bool {
+	if pod.Spec.OS != nil {
+		return pod.Spec.OS.Name == corev1.Windows
+	}
+	return pod.Spec.NodeSelector[corev1.LabelOSStable] == string(corev1.Windows)
+}
+
+// ResolveOwner returns the controlling workload of a pod in Kind/Name form.
+// Pods managed by a ReplicaSet carrying the pod-template-hash label are
+// attributed to their Deployment by stripping the hash suffix, which avoids
+// an additional API call per ReplicaSet. Pods without a controller are
+// reported as standalone.
+func ResolveOwner(pod *corev1.Pod) string {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return ""
+	}
+
+	if owner.Kind == "ReplicaSet" {
+		if hash, ok := pod.Labels["pod-template-hash"]; ok && hash != "" {
+			if name, found := strings.CutSuffix(owner.Name, "-"+hash); found {
+				return "Deployment/" + name
+			}
+		}
+	}
+
+	return owner.Kind + "/" + owner.Name
+}
+
 // HasMemoryLimit returns true if the pod has memory limits configured.
 func (p *PodSpecInfo) HasMemoryLimit() bool {
 	return p.MemoryLimitMi > 0
@@ -115,3 +1032,172 @@ func (p *PodSpecInfo) ContainerHasCPULimit(containerName string) bool {
 	limit, exists := p.ContainerCPULimits[containerName]
 	return exists && limit > 0
 }
+
+// ContainerHasMemoryRequest returns true if the specified container has a memory request.
+func (p *PodSpecInfo) ContainerHasMemoryRequest(containerName string) bool {
+	request, exists := p.ContainerMemoryRequests[containerName]
+	return exists && request > 0
+}
+
+// ContainerHasCPURequest returns true if the specified container has a CPU request.
+func (p *PodSpecInfo) ContainerHasCPURequest(containerName string) bool {
+	request, exists := p.ContainerCPURequests[containerName]
+	return exists && request > 0
+}
+
+// CheckStatus is the outcome of a doctor check.
+type CheckStatus string
+
+const (
+	// CheckOK means the component is healthy
+	CheckOK CheckStatus = "ok"
+	// CheckFailed means the component is the cause of failing pod metrics
+	CheckFailed CheckStatus = "failed"
+	// CheckUnknown means the component could not be read, e.g. without
+	// permission
+	CheckUnknown CheckStatus = "unknown"
+)
+
+// Check is the result of checking one component pod metrics are served
+// through, as reported by the doctor command.
+type Check struct {
+	// Component names the checked object, e.g. APIService v1beta1.metrics.k8s.io
+	Component string
+	// Status is the outcome of the check
+	Status CheckStatus
+	// Detail explains the outcome and, for failures, what to fix
+	Detail string
+}
+
+// Trace records how a single pod moved through the filter and correlation pipeline.
+// It is produced by the collector and extended by the analyzer so users can see
+// exactly which rule excluded a pod, or how its percentage was derived.
+type Trace struct {
+	// Namespace is the Kubernetes namespace of the traced pod
+	Namespace string
+	// Name is the traced pod name
+	Name string
+	// Node is the node the pod is scheduled on, if any
+	Node string
+	// QoS is the pod quality of service class (Guaranteed, Burstable or BestEffort)
+	QoS string
+	// Restarts is the total restart count across all containers
+	Restarts int32
+	// Steps lists each pipeline stage the pod was evaluated against, in order
+	Steps []TraceStep
+	// Rows contains the result rows produced by the pod (empty if it was excluded)
+	Rows []Row
+}
+
+// TraceStep represents the outcome of a single pipeline stage for a traced pod.
+type TraceStep struct {
+	// Stage is a short identifier for the pipeline stage (e.g. "namespace-exclusion")
+	Stage string
+	// Passed indicates whether the pod passed this stage
+	Passed bool
+	// Detail is a human-readable explanation of the outcome
+	Detail string
+}
+
+// Excluded returns true if any stage rejected the pod.
+func (t *Trace) Excluded() bool {
+	for _, step := range t.Steps {
+		if !step.Passed {
+			return true
+		}
+	}
+	return false
+}
+
+// AddStep appends a stage outcome to the trace.
+func (t *Trace) AddStep(stage string, passed bool, detail string) {
+	t.Steps = append(t.Steps, TraceStep{Stage: stage, Passed: passed, Detail: detail})
+}
+
+// WarningKind identifies the kind of degradation a Warning reports.
+type WarningKind string
+
+const (
+	// WarningPartialPages reports the remaining pages of an endpoint abandoned
+	// after a page failed past its retries, so rows may be missing
+	WarningPartialPages WarningKind = "partial-pages"
+	// WarningUnmatchedMetrics reports stale pod metrics of pods missing from
+	// the pod list, deleted or restarted between the list calls
+	WarningUnmatchedMetrics WarningKind = "unmatched-metrics"
+	// WarningNamespacesUnresolved reports a namespace list that failed, so
+	// excluded namespaces were listed and their pods skipped client-side
+	WarningNamespacesUnresolved WarningKind = "namespaces-unresolved"
+	// WarningStaleMetrics reports pod metrics samples trailing the newest of
+	// the list by several scrape windows, from nodes metrics-server stopped
+	// scraping, so their usage is out of date
+	WarningStaleMetrics WarningKind = "stale-metrics"
+)
+
+// Warning is a degradation of a collection that did not fail it, such as
+// rows missing after an abandoned page. Warnings let library callers surface
+// incomplete results without parsing the log.
+type Warning struct {
+	// Kind identifies the degradation
+	Kind WarningKind `json:"kind" yaml:"kind"`
+	// Endpoint is the endpoint degraded, if specific to one (e.g. "pod metrics")
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	// Count is the number of items affected, if known
+	Count int `json:"count,omitempty" yaml:"count,omitempty"`
+	// Message is a human-readable explanation
+	Message string `json:"message" yaml:"message"`
+}
+
+// Summary contains aggregate statistics over a set of result rows.
+// Usage and limit totals are expressed in the unit of the analyzed resource
+// (Mi for memory, millicores for CPU).
+type Summary struct {
+	// Count is the number of rows included in the summary
+	Count int
+	// TotalUsage is the sum of usage across all rows
+	TotalUsage float64
+	// TotalLimit is the sum of limits across all rows
+	TotalLimit float64
+	// AvgPercentage is the mean usage/limit percentage
+	AvgPercentage float64
+	// MaxPercentage is the highest usage/limit percentage
+	MaxPercentage float64
+	// Threshold is the percentage used to compute OverThreshold
+	Threshold float64
+	// OverThreshold is the number of rows at or above Threshold
+	OverThreshold int
+	// Buckets is the distribution of rows across percentage ranges
+	Buckets []Bucket
+}
+
+// Bucket counts rows whose percentage falls within [Min, Max).
+type Bucket struct {
+	// Label is the display name of the bucket (e.g. "50-75%")
+	Label string
+	// Min is the inclusive lower bound of the bucket
+	Min float64
+	// Max is the exclusive upper bound of the bucket
+	Max float64
+	// Count is the number of rows in the bucket
+	Count int
+}
+
+// PlannedRequest is a request a run would issue, reported by --dry-run
+// instead of issuing it.
+type PlannedRequest struct {
+	// Server is the API the request is sent to (kubernetes, prometheus or datadog)
+	Server string
+	// Method is the HTTP method of the request
+	Method string
+	// Path is the request path; {namespace} and {node} stand for values only
+	// known once earlier requests have returned
+	Path string
+	// Params are the query parameters, unescaped for readability
+	// (e.g. labelSelector=app=api&limit=500)
+	Params string
+	// Requests is the number of requests issued when Per is unset, or per
+	// item of Per otherwise
+	Requests int
+	// Per names what the request is repeated for (e.g. "page of 500 pods"),
+	// empty when it is issued a fixed number of times
+	Per string
+}
@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolveOwner(t *testing.T) {
+	controller := true
+
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		owners   []metav1.OwnerReference
+		expected string
+	}{
+		{
+			name:     "standalone pod",
+			expected: "",
+		},
+		{
+			name:   "deployment via replicaset",
+			labels: map[string]string{"pod-template-hash": "5d9f8c7b6"},
+			owners: []metav1.OwnerReference{
+				{Kind: "ReplicaSet", Name: "my-api-5d9f8c7b6", Controller: &controller},
+			},
+			expected: "Deployment/my-api",
+		},
+		{
+			name: "bare replicaset",
+			owners: []metav1.OwnerReference{
+				{Kind: "ReplicaSet", Name: "my-rs", Controller: &controller},
+			},
+			expected: "ReplicaSet/my-rs",
+		},
+		{
+			name: "statefulset",
+			owners: []metav1.OwnerReference{
+				{Kind: "StatefulSet", Name: "db", Controller: &controller},
+			},
+			expected: "StatefulSet/db",
+		},
+		{
+			name: "non-controller reference ignored",
+			owners: []metav1.OwnerReference{
+				{Kind: "ConfigMap", Name: "cfg"},
+			},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "pod",
+					Labels:          tt.labels,
+					OwnerReferences: tt.owners,
+				},
+			}
+
+			if got := ResolveOwner(pod); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewContainerMetrics(t *testing.T) {
+	tests := []struct {
+		name        string
+		usage       corev1.ResourceList
+		memoryBytes int64
+		cpuMc       int64
+	}{
+		{
+			name: "memory and cpu",
+			usage: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("256Mi"),
+				corev1.ResourceCPU:    resource.MustParse("250m"),
+			},
+			memoryBytes: 256 * BytesPerMi,
+			cpuMc:       250,
+		},
+		{
+			name:        "fractional cpu in nanocores",
+			usage:       corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1500000n")},
+			memoryBytes: 0,
+			cpuMc:       2,
+		},
+		{
+			name: "empty usage",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := NewContainerMetrics("app", tt.usage)
+			if cm.Name != "app" || cm.MemoryBytes != tt.memoryBytes || cm.CPUMillicores != tt.cpuMc {
+				t.Errorf("unexpected container metrics: %+v", cm)
+			}
+		})
+	}
+}
+
+func TestIsInfrastructureContainer(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "POD", want: true},
+		{name: "pause", want: true},
+		{name: "", want: true},
+		{name: "k8s_POD_payments-db-0_payments_0", want: true},
+		{name: "postgres"},
+		{name: "pause-exporter"},
+	}
+	for _, tt := range tests {
+		if got := IsInfrastructureContainer(tt.name); got != tt.want {
+			t.Errorf("IsInfrastructureContainer(%q) = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewPodSpecInfo_Requests(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "api",
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceMemory: resource.MustParse("256Mi"),
+							corev1.ResourceCPU:    resource.MustParse("250m"),
+						},
+						Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+					},
+				},
+				{
+					Name: "proxy",
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+					},
+				},
+			},
+		},
+	}
+
+	info := NewPodSpecInfo(pod)
+	if info.MemoryRequestMi != 256 || info.CPURequestMc != 350 {
+		t.Errorf("expected pod requests 256Mi/350m, got %.1fMi/%dm", info.MemoryRequestMi, info.CPURequestMc)
+	}
+	if info.ContainerMemoryRequests["api"] != 256 || info.ContainerCPURequests["proxy"] != 100 {
+		t.Errorf("unexpected container requests: %v %v", info.ContainerMemoryRequests, info.ContainerCPURequests)
+	}
+	if !info.ContainerHasMemoryRequest("api") || info.ContainerHasMemoryRequest("proxy") {
+		t.Error("expected only the api container to have a memory request")
+	}
+	if !info.ContainerHasCPURequest("proxy") {
+		t.Error("expected the proxy container to have a cpu request")
+	}
+}
+
+func TestIsWindowsPod(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     corev1.PodSpec
+		expected bool
+	}{
+		{name: "no os", expected: false},
+		{name: "spec os", spec: corev1.PodSpec{OS: &corev1.PodOS{Name: corev1.Windows}}, expected: true},
+		{name: "node selector", spec: corev1.PodSpec{NodeSelector: map[string]string{corev1.LabelOSStable: "windows"}}, expected: true},
+		{name: "linux node selector", spec: corev1.PodSpec{NodeSelector: map[string]string{corev1.LabelOSStable: "linux"}}, expected: false},
+		{
+			name:     "spec os wins",
+			spec:     corev1.PodSpec{OS: &corev1.PodOS{Name: corev1.Linux}, NodeSelector: map[string]string{corev1.LabelOSStable: "windows"}},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsWindowsPod(&corev1.Pod{Spec: tt.spec}); got != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Package observability - Prometheus exposition of namespace budgets
+package observability
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// namespaceUsage is the usage of all pods of a namespace.
+type namespaceUsage struct {
+	memoryBytes int64
+	cpuMc       int64
+}
+
+// BudgetCollector exposes the usage of every namespace with a budget against
+// that budget: the usage, the budget, their ratio and whether the budget is
+// breached, so alerting rules are plain comparisons such as
+// kusage_namespace_memory_budget_breached == 1. Namespaces are only exposed
+// for the resources they have a budget of and while they have rows.
+type BudgetCollector struct {
+	budgets config.Budgets
+	mutex   sync.RWMutex
+	usage   map[string]namespaceUsage
+
+	memoryUsage    *prometheus.Desc
+	memoryBudget   *prometheus.Desc
+	memoryRatio    *prometheus.Desc
+	memoryBreached *prometheus.Desc
+	cpuUsage       *prometheus.Desc
+	cpuBudget      *prometheus.Desc
+	cpuRatio       *prometheus.Desc
+	cpuBreached    *prometheus.Desc
+}
+
+// NewBudgetCollector creates a collector of the namespace usage of rows
+// against budgets. Rows must carry both resources (config.ResourceAll).
+func NewBudgetCollector(budgets config.Budgets) *BudgetCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(MetricsNamespace, "namespace", name), help, []string{"namespace"}, nil)
+	}
+
+	return &BudgetCollector{
+		budgets:        budgets,
+		memoryUsage:    desc("memory_usage_bytes", "Memory working set of all pods of the namespace in bytes."),
+		memoryBudget:   desc("memory_budget_bytes", "Memory budget of the namespace in bytes."),
+		memoryRatio:    desc("memory_budget_ratio", "Memory working set relative to the memory budget."),
+		memoryBreached: desc("memory_budget_breached", "1 when the memory working set exceeds the memory budget, else 0."),
+		cpuUsage:       desc("cpu_usage_cores", "CPU usage of all pods of the namespace in cores."),
+		cpuBudget:      desc("cpu_budget_cores", "CPU budget of the namespace in cores."),
+		cpuRatio:       desc("cpu_budget_ratio", "CPU usage relative to the CPU budget."),
+		cpuBreached:    desc("cpu_budget_breached", "1 when the CPU usage exceeds the CPU budget, else 0."),
+	}
+}
+
+// Update replaces the namespace usage with the sums of the rows of the latest
+// collection, keeping only the namespaces with a budget.
+func (c *BudgetCollector) Update(rows []metrics.Row) {
+	usage := make(map[string]namespaceUsage)
+	for _, row := range rows {
+		if c.budgets.For(row.Namespace) == nil {
+			continue
+		}
+		u := usage[row.Namespace]
+		u.memoryBytes += row.UsageBytes
+		u.cpuMc += row.UsageMc
+		usage[row.Namespace] = u
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.usage = usage
+}
+
+// Describe sends the descriptors of the budget gauges.
+func (c *BudgetCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		c.memoryUsage, c.memoryBudget, c.memoryRatio, c.memoryBreached,
+		c.cpuUsage, c.cpuBudget, c.cpuRatio, c.cpuBreached,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect sends the budget gauges of every namespace with a budget, in
+// namespace order.
+func (c *BudgetCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	namespaces := make([]string, 0, len(c.usage))
+	for namespace := range c.usage {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	for _, namespace := range namespaces {
+		usage, budget := c.usage[namespace], c.budgets.For(namespace)
+		if budget.Memory != nil {
+			used, limit := float64(usage.memoryBytes), float64(budget.Memory.Value())
+			ch <- prometheus.MustNewConstMetric(c.memoryUsage, prometheus.GaugeValue, used, namespace)
+			ch <- prometheus.MustNewConstMetric(c.memoryBudget, prometheus.GaugeValue, limit, namespace)
+			ch <- prometheus.MustNewConstMetric(c.memoryRatio, prometheus.GaugeValue, used/limit, namespace)
+			ch <- prometheus.MustNewConstMetric(c.memoryBreached, prometheus.GaugeValue, breached(used, limit), namespace)
+		}
+		if budget.CPU != nil {
+			used, limit := float64(usage.cpuMc)/1000, float64(budget.CPU.MilliValue())/1000
+			ch <- prometheus.MustNewConstMetric(c.cpuUsage, prometheus.GaugeValue, used, namespace)
+			ch <- prometheus.MustNewConstMetric(c.cpuBudget, prometheus.GaugeValue, limit, namespace)
+			ch <- prometheus.MustNewConstMetric(c.cpuRatio, prometheus.GaugeValue, used/limit, namespace)
+			ch <- prometheus.MustNewConstMetric(c.cpuBreached, prometheus.GaugeValue, breached(used, limit), namespace)
+		}
+	}
+}
+
+// breached returns 1 when used exceeds budget, else 0.
+func breached(used, budget float64) float64 {
+	if used > budget {
+		return 1
+	}
+	return 0
+}
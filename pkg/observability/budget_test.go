@@ -0,0 +1,60 @@
+package observability
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+func TestBudgetCollector(t *testing.T) {
+	memory, cpu := resource.MustParse("1Gi"), resource.MustParse("500m")
+	e := NewExporter()
+	budgets := NewBudgetCollector(config.Budgets{
+		{Namespace: "payments", Memory: &memory, CPU: &cpu},
+		{Namespace: "team-*", CPU: &cpu},
+	})
+	e.Registry().MustRegister(budgets)
+
+	budgets.Update([]metrics.Row{
+		{Namespace: "payments", Name: "api-0", UsageBytes: 768 << 20, UsageMc: 400},
+		{Namespace: "payments", Name: "api-1", UsageBytes: 512 << 20, UsageMc: 50},
+		{Namespace: "team-a", Name: "job-0", UsageBytes: 1 << 30, UsageMc: 250},
+		{Namespace: "default", Name: "web-0", UsageBytes: 1 << 30, UsageMc: 1000},
+	})
+
+	rec := httptest.NewRecorder()
+	e.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	data, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	body := string(data)
+
+	expected := []string{
+		`kusage_namespace_memory_usage_bytes{namespace="payments"} 1.34217728e+09`,
+		`kusage_namespace_memory_budget_bytes{namespace="payments"} 1.073741824e+09`,
+		`kusage_namespace_memory_budget_ratio{namespace="payments"} 1.25`,
+		`kusage_namespace_memory_budget_breached{namespace="payments"} 1`,
+		`kusage_namespace_cpu_usage_cores{namespace="payments"} 0.45`,
+		`kusage_namespace_cpu_budget_ratio{namespace="payments"} 0.9`,
+		`kusage_namespace_cpu_budget_breached{namespace="payments"} 0`,
+		`kusage_namespace_cpu_budget_ratio{namespace="team-a"} 0.5`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected %q in exposition", line)
+		}
+	}
+	// Namespaces are only exposed for the resources they have a budget of
+	for _, unexpected := range []string{`kusage_namespace_memory_usage_bytes{namespace="team-a"}`, `namespace="default"`} {
+		if strings.Contains(body, unexpected) {
+			t.Errorf("expected no %q in exposition", unexpected)
+		}
+	}
+}
@@ -3,10 +3,15 @@ package observability
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"math"
 	"runtime"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -19,10 +24,15 @@ type Metrics struct {
 	APICallsFailed     int64
 	APICallDuration    time.Duration
 
+	// Pagination metrics
+	PagesFetched    int64
+	MaxPageDuration time.Duration
+
 	// Processing metrics
 	PodsProcessed    int64
 	MetricsProcessed int64
 	ResultsGenerated int64
+	UnmatchedMetrics int64
 
 	// Memory metrics
 	PeakMemoryUsageMB int64
@@ -37,14 +47,28 @@ type Metrics struct {
 	// Error tracking
 	Errors []string
 
+	// Reliability metrics, per endpoint
+	Retries        map[string]int64
+	BreakerTrips   map[string]int64
+	PagesAbandoned map[string]int64
+
+	// API traffic, per method and path, and the time spent waiting on the
+	// client-side rate limit
+	Traffic       map[string]*EndpointTraffic
+	RateLimitWait time.Duration
+
 	mutex sync.RWMutex
 }
 
 // NewMetrics creates a new metrics tracker
 func NewMetrics() *Metrics {
 	return &Metrics{
-		StartTime: time.Now(),
-		Errors:    make([]string, 0),
+		StartTime:      time.Now(),
+		Errors:         make([]string, 0),
+		Retries:        make(map[string]int64),
+		BreakerTrips:   make(map[string]int64),
+		PagesAbandoned: make(map[string]int64),
+		Traffic:        make(map[string]*EndpointTraffic),
 	}
 }
 
@@ -63,6 +87,26 @@ func (m *Metrics) RecordAPICall(duration time.Duration, success bool) {
 	}
 }
 
+// RecordPage records a single paginated list call, including its duration
+// and whether it succeeded. Every page also counts as an API call.
+func (m *Metrics) RecordPage(duration time.Duration, success bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.APICallsTotal++
+	m.APICallDuration += duration
+	m.PagesFetched++
+	if duration > m.MaxPageDuration {
+		m.MaxPageDuration = duration
+	}
+
+	if success {
+		m.APICallsSuccessful++
+	} else {
+		m.APICallsFailed++
+	}
+}
+
 // RecordProcessing records processing metrics
 func (m *Metrics) RecordProcessing(pods, metrics, results int64) {
 	m.mutex.Lock()
@@ -73,6 +117,14 @@ func (m *Metrics) RecordProcessing(pods, metrics, results int64) {
 	m.ResultsGenerated += results
 }
 
+// RecordUnmatchedMetrics records pod metrics dropped because their pod was
+// not in the pod list, e.g. pods deleted or restarted between the list calls
+func (m *Metrics) RecordUnmatchedMetrics(count int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.UnmatchedMetrics += count
+}
+
 // UpdateMemoryUsage updates memory usage metrics
 func (m *Metrics) UpdateMemoryUsage() {
 	var memStats runtime.MemStats
@@ -104,6 +156,28 @@ func (m *Metrics) RecordError(err error, context string) {
 	m.Errors = append(m.Errors, errorMsg)
 }
 
+// RecordRetry records a retried call to an endpoint
+func (m *Metrics) RecordRetry(endpoint string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Retries[endpoint]++
+}
+
+// RecordBreakerTrip records the circuit breaker of an endpoint opening
+func (m *Metrics) RecordBreakerTrip(endpoint string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.BreakerTrips[endpoint]++
+}
+
+// RecordAbandonedPage records a page of an endpoint that was given up on,
+// leaving the results incomplete
+func (m *Metrics) RecordAbandonedPage(endpoint string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.PagesAbandoned[endpoint]++
+}
+
 // SetCollectionDuration sets the collection phase duration
 func (m *Metrics) SetCollectionDuration(duration time.Duration) {
 	m.mutex.Lock()
@@ -136,32 +210,95 @@ func (m *Metrics) GetSummary() MetricsSummary {
 	}
 
 	return MetricsSummary{
+		StartTime:          m.StartTime,
 		APICallsTotal:      m.APICallsTotal,
 		APICallsSuccessful: m.APICallsSuccessful,
 		APICallsFailed:     m.APICallsFailed,
 		AvgAPICallDuration: avgAPICallDuration,
+		PagesFetched:       m.PagesFetched,
+		MaxPageDuration:    m.MaxPageDuration,
 		PodsProcessed:      m.PodsProcessed,
 		MetricsProcessed:   m.MetricsProcessed,
 		ResultsGenerated:   m.ResultsGenerated,
+		UnmatchedMetrics:   m.UnmatchedMetrics,
 		PeakMemoryUsageMB:  m.PeakMemoryUsageMB,
 		CurrentMemoryMB:    m.CurrentMemoryMB,
 		CollectionDuration: m.CollectionDuration,
 		AnalysisDuration:   m.AnalysisDuration,
 		TotalDuration:      m.TotalDuration,
 		ErrorCount:         len(m.Errors),
-		Errors:             make([]string, len(m.Errors)),
+		Errors:             append([]string(nil), m.Errors...),
+		Reliability: Reliability{
+			Retries:        maps.Clone(m.Retries),
+			BreakerTrips:   maps.Clone(m.BreakerTrips),
+			PagesAbandoned: maps.Clone(m.PagesAbandoned),
+		},
+		APITraffic: m.apiTraffic(),
 	}
 }
 
+// Reliability summarizes the degradation of a run, per endpoint.
+type Reliability struct {
+	Retries        map[string]int64 `json:"retries,omitempty"`
+	BreakerTrips   map[string]int64 `json:"breaker_trips,omitempty"`
+	PagesAbandoned map[string]int64 `json:"pages_abandoned,omitempty"`
+}
+
+// Degraded reports whether any call was retried, any breaker opened or any
+// page abandoned.
+func (r Reliability) Degraded() bool {
+	return len(r.Retries) > 0 || len(r.BreakerTrips) > 0 || len(r.PagesAbandoned) > 0
+}
+
+// Complete reports whether every page was read, so the results cover all
+// matching pods despite any retries.
+func (r Reliability) Complete() bool {
+	return len(r.PagesAbandoned) == 0
+}
+
+// String returns a compact one-line description, e.g.
+// "3 retries (pod metrics 3), 1 page abandoned (pod metrics 1)".
+func (r Reliability) String() string {
+	var parts []string
+	for _, counter := range []struct {
+		singular, plural string
+		counts           map[string]int64
+	}{
+		{"retry", "retries", r.Retries},
+		{"circuit breaker trip", "circuit breaker trips", r.BreakerTrips},
+		{"page abandoned", "pages abandoned", r.PagesAbandoned},
+	} {
+		if len(counter.counts) == 0 {
+			continue
+		}
+		var total int64
+		endpoints := make([]string, 0, len(counter.counts))
+		for _, endpoint := range slices.Sorted(maps.Keys(counter.counts)) {
+			total += counter.counts[endpoint]
+			endpoints = append(endpoints, fmt.Sprintf("%s %d", endpoint, counter.counts[endpoint]))
+		}
+		label := counter.plural
+		if total == 1 {
+			label = counter.singular
+		}
+		parts = append(parts, fmt.Sprintf("%d %s (%s)", total, label, strings.Join(endpoints, ", ")))
+	}
+	return strings.Join(parts, ", ")
+}
+
 // MetricsSummary provides a snapshot of metrics
 type MetricsSummary struct {
+	StartTime          time.Time     `json:"start_time"`
 	APICallsTotal      int64         `json:"api_calls_total"`
 	APICallsSuccessful int64         `json:"api_calls_successful"`
 	APICallsFailed     int64         `json:"api_calls_failed"`
 	AvgAPICallDuration time.Duration `json:"avg_api_call_duration"`
+	PagesFetched       int64         `json:"pages_fetched"`
+	MaxPageDuration    time.Duration `json:"max_page_duration"`
 	PodsProcessed      int64         `json:"pods_processed"`
 	MetricsProcessed   int64         `json:"metrics_processed"`
 	ResultsGenerated   int64         `json:"results_generated"`
+	UnmatchedMetrics   int64         `json:"unmatched_metrics"`
 	PeakMemoryUsageMB  int64         `json:"peak_memory_usage_mb"`
 	CurrentMemoryMB    int64         `json:"current_memory_mb"`
 	CollectionDuration time.Duration `json:"collection_duration"`
@@ -169,6 +306,28 @@ type MetricsSummary struct {
 	TotalDuration      time.Duration `json:"total_duration"`
 	ErrorCount         int           `json:"error_count"`
 	Errors             []string      `json:"errors,omitempty"`
+	Reliability        Reliability   `json:"reliability"`
+	APITraffic         APITraffic    `json:"api_traffic"`
+}
+
+// UnmatchedPercent returns the share of processed pod metrics whose pod was
+// not in the pod list, as a percentage.
+func (s MetricsSummary) UnmatchedPercent() float64 {
+	if s.MetricsProcessed == 0 {
+		return 0
+	}
+	return float64(s.UnmatchedMetrics) / float64(s.MetricsProcessed) * 100
+}
+
+// WriteJSON writes the summary to w as a single indented JSON document.
+// Durations are encoded in nanoseconds.
+func (s MetricsSummary) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(s); err != nil {
+		return fmt.Errorf("failed to encode metrics summary: %w", err)
+	}
+	return nil
 }
 
 // LogSummary logs a comprehensive metrics summary
@@ -178,6 +337,8 @@ func (s MetricsSummary) LogSummary() {
 		"api_calls_successful", s.APICallsSuccessful,
 		"api_calls_failed", s.APICallsFailed,
 		"avg_api_call_duration_ms", s.AvgAPICallDuration.Milliseconds(),
+		"pages_fetched", s.PagesFetched,
+		"max_page_duration_ms", s.MaxPageDuration.Milliseconds(),
 		"pods_processed", s.PodsProcessed,
 		"metrics_processed", s.MetricsProcessed,
 		"results_generated", s.ResultsGenerated,
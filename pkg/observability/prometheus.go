@@ -0,0 +1,153 @@
+// Package observability - Prometheus exposition of operational metrics
+package observability
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsNamespace prefixes every metric exposed by kusage
+const MetricsNamespace = "kusage"
+
+// Exporter exposes the tool's own operational metrics in Prometheus format.
+// It is intended for long-running (serve) mode, where every collection run
+// produces a Metrics instance whose summary is folded into the exporter with
+// Observe. Usage gauges can be registered on the same Registry so both are
+// served from a single /metrics endpoint.
+type Exporter struct {
+	registry *prometheus.Registry
+
+	runs               *prometheus.CounterVec
+	skippedRuns        prometheus.Counter
+	collectionDuration prometheus.Histogram
+	totalDuration      prometheus.Histogram
+	apiCalls           prometheus.Counter
+	apiErrors          prometheus.Counter
+	pagesFetched       prometheus.Counter
+	maxPageDuration    prometheus.Gauge
+	podsProcessed      prometheus.Counter
+	rowsProduced       prometheus.Counter
+	peakMemory         prometheus.Gauge
+}
+
+// NewExporter creates an exporter with its own registry, including the
+// standard Go runtime and process collectors.
+func NewExporter() *Exporter {
+	e := &Exporter{
+		registry: prometheus.NewRegistry(),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "collection_runs_total",
+			Help:      "Number of collection runs by result (success or error).",
+		}, []string{"result"}),
+		skippedRuns: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "collection_runs_skipped_total",
+			Help:      "Number of scheduled runs skipped because the previous run was still in progress.",
+		}),
+		collectionDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "collection_duration_seconds",
+			Help:      "Duration of the collection phase of a run.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+		}),
+		totalDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "run_duration_seconds",
+			Help:      "Total duration of a run, including analysis.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+		}),
+		apiCalls: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "api_calls_total",
+			Help:      "Number of Kubernetes API calls issued, including paginated list calls.",
+		}),
+		apiErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "api_errors_total",
+			Help:      "Number of Kubernetes API calls that failed.",
+		}),
+		pagesFetched: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "pages_fetched_total",
+			Help:      "Number of list pages fetched from the Kubernetes API.",
+		}),
+		maxPageDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "last_run_max_page_duration_seconds",
+			Help:      "Duration of the slowest list page in the last run.",
+		}),
+		podsProcessed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "pods_processed_total",
+			Help:      "Number of pods processed across runs.",
+		}),
+		rowsProduced: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "rows_produced_total",
+			Help:      "Number of result rows produced across runs.",
+		}),
+		peakMemory: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "last_run_peak_memory_bytes",
+			Help:      "Peak heap allocation observed during the last run.",
+		}),
+	}
+
+	e.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		e.runs,
+		e.skippedRuns,
+		e.collectionDuration,
+		e.totalDuration,
+		e.apiCalls,
+		e.apiErrors,
+		e.pagesFetched,
+		e.maxPageDuration,
+		e.podsProcessed,
+		e.rowsProduced,
+		e.peakMemory,
+	)
+
+	return e
+}
+
+// Registry returns the registry the operational metrics are registered on,
+// so callers can add their own collectors to the same endpoint.
+func (e *Exporter) Registry() *prometheus.Registry {
+	return e.registry
+}
+
+// Observe folds the summary of a single run into the exported metrics.
+func (e *Exporter) Observe(s MetricsSummary) {
+	result := "success"
+	if s.ErrorCount > 0 {
+		result = "error"
+	}
+	e.runs.WithLabelValues(result).Inc()
+
+	e.collectionDuration.Observe(s.CollectionDuration.Seconds())
+	e.totalDuration.Observe(s.TotalDuration.Seconds())
+	e.apiCalls.Add(float64(s.APICallsTotal))
+	e.apiErrors.Add(float64(s.APICallsFailed))
+	e.pagesFetched.Add(float64(s.PagesFetched))
+	e.maxPageDuration.Set(s.MaxPageDuration.Seconds())
+	e.podsProcessed.Add(float64(s.PodsProcessed))
+	e.rowsProduced.Add(float64(s.ResultsGenerated))
+	e.peakMemory.Set(float64(s.PeakMemoryUsageMB * 1024 * 1024))
+}
+
+// Skip records a scheduled run that did not start because the previous run
+// was still in progress.
+func (e *Exporter) Skip() {
+	e.skippedRuns.Inc()
+}
+
+// Handler returns an HTTP handler serving the registry in Prometheus text format.
+func (e *Exporter) Handler() http.Handler {
+	return promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{})
+}
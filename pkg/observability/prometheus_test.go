@@ -0,0 +1,50 @@
+package observability
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExporter_Observe(t *testing.T) {
+	e := NewExporter()
+
+	e.Observe(MetricsSummary{
+		APICallsTotal:      4,
+		APICallsFailed:     1,
+		PagesFetched:       3,
+		MaxPageDuration:    250 * time.Millisecond,
+		PodsProcessed:      120,
+		ResultsGenerated:   20,
+		CollectionDuration: 2 * time.Second,
+		TotalDuration:      3 * time.Second,
+		ErrorCount:         1,
+	})
+	e.Observe(MetricsSummary{APICallsTotal: 2, PagesFetched: 2, ResultsGenerated: 5})
+
+	rec := httptest.NewRecorder()
+	e.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+
+	expected := []string{
+		`kusage_collection_runs_total{result="error"} 1`,
+		`kusage_collection_runs_total{result="success"} 1`,
+		`kusage_api_calls_total 6`,
+		`kusage_api_errors_total 1`,
+		`kusage_pages_fetched_total 5`,
+		`kusage_rows_produced_total 25`,
+		`kusage_pods_processed_total 120`,
+		`kusage_collection_duration_seconds_count 2`,
+		`go_goroutines`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("expected %q in exposition", line)
+		}
+	}
+}
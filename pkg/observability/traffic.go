@@ -0,0 +1,168 @@
+// Package observability - API traffic accounting
+package observability
+
+import (
+	"cmp"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// EndpointTraffic summarizes the requests issued to one API endpoint.
+type EndpointTraffic struct {
+	Method string `json:"method"`
+	// Path is the request path with namespace and node names replaced by
+	// placeholders, e.g. /api/v1/nodes/{node}/proxy/stats/summary
+	Path     string        `json:"path"`
+	Requests int64         `json:"requests"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+	// Throttled counts the responses with status 429 Too Many Requests
+	Throttled int64 `json:"throttled,omitempty"`
+	// Failed counts the requests without a response or with a 5xx status
+	Failed int64 `json:"failed,omitempty"`
+}
+
+// APITraffic summarizes the requests a run issued to the Kubernetes APIs.
+type APITraffic struct {
+	Endpoints []EndpointTraffic `json:"endpoints,omitempty"`
+	// RateLimitWait is the time requests waited on the client-side rate limit
+	RateLimitWait time.Duration `json:"rate_limit_wait"`
+}
+
+// Totals returns the sum of the requests of all endpoints.
+func (t APITraffic) Totals() EndpointTraffic {
+	var total EndpointTraffic
+	for _, e := range t.Endpoints {
+		total.Requests += e.Requests
+		total.Bytes += e.Bytes
+		total.Duration += e.Duration
+		total.Throttled += e.Throttled
+		total.Failed += e.Failed
+	}
+	return total
+}
+
+// RecordRequest records a request to path that completed with status after
+// transferring bytes of response body. A status of 0 stands for a request
+// that got no response.
+func (m *Metrics) RecordRequest(method, path string, status int, bytes int64, duration time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := method + " " + path
+	e, ok := m.Traffic[key]
+	if !ok {
+		e = &EndpointTraffic{Method: method, Path: path}
+		m.Traffic[key] = e
+	}
+	e.Requests++
+	e.Bytes += bytes
+	e.Duration += duration
+	switch {
+	case status == http.StatusTooManyRequests:
+		e.Throttled++
+	case status == 0 || status >= http.StatusInternalServerError:
+		e.Failed++
+	}
+}
+
+// RecordRateLimitWait records the time a request waited on the client-side
+// rate limit before it was sent.
+func (m *Metrics) RecordRateLimitWait(wait time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.RateLimitWait += wait
+}
+
+// apiTraffic returns the recorded traffic, busiest endpoint first. The caller
+// must hold the read lock.
+func (m *Metrics) apiTraffic() APITraffic {
+	traffic := APITraffic{RateLimitWait: m.RateLimitWait}
+	for _, e := range m.Traffic {
+		traffic.Endpoints = append(traffic.Endpoints, *e)
+	}
+	slices.SortFunc(traffic.Endpoints, func(a, b EndpointTraffic) int {
+		return cmp.Or(
+			cmp.Compare(b.Requests, a.Requests),
+			cmp.Compare(a.Path, b.Path),
+			cmp.Compare(a.Method, b.Method),
+		)
+	})
+	return traffic
+}
+
+// WrapTransport returns a transport that records every request sent through
+// rt. A request is recorded when its response body is closed, so its bytes
+// and duration cover reading the whole body.
+func (m *Metrics) WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return &trafficTransport{next: rt, metrics: m}
+}
+
+// trafficTransport records the requests it forwards to next.
+type trafficTransport struct {
+	next    http.RoundTripper
+	metrics *Metrics
+}
+
+// RoundTrip forwards req and wraps the response body to count its bytes.
+func (t *trafficTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	path := trafficPath(req.URL.Path)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.metrics.RecordRequest(req.Method, path, 0, 0, time.Since(start))
+		return resp, err
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, done: func(bytes int64) {
+		t.metrics.RecordRequest(req.Method, path, resp.StatusCode, bytes, time.Since(start))
+	}}
+	return resp, nil
+}
+
+// countingBody counts the bytes read from a response body and reports them
+// once, when the body is closed.
+type countingBody struct {
+	io.ReadCloser
+	bytes  atomic.Int64
+	closed atomic.Bool
+	done   func(bytes int64)
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes.Add(int64(n))
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.closed.CompareAndSwap(false, true) {
+		b.done(b.bytes.Load())
+	}
+	return err
+}
+
+// trafficPath replaces the namespace and node names in path with
+// placeholders so requests to the same endpoint are recorded together, e.g.
+// /api/v1/namespaces/payments/pods becomes /api/v1/namespaces/{namespace}/pods.
+// A name that ends the path, as in a get of one namespace, is kept as the
+// placeholder too.
+func trafficPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		switch segments[i-1] {
+		case "namespaces":
+			segments[i] = "{namespace}"
+		case "nodes":
+			segments[i] = "{node}"
+		default:
+			continue
+		}
+		i++
+	}
+	return strings.Join(segments, "/")
+}
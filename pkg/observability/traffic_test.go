@@ -0,0 +1,71 @@
+package observability
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrapTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/summary") {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = io.WriteString(w, strings.Repeat("x", 1000))
+	}))
+	defer server.Close()
+
+	m := NewMetrics()
+	client := &http.Client{Transport: m.WrapTransport(http.DefaultTransport)}
+	get := func(path string) {
+		t.Helper()
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+	get("/api/v1/namespaces/payments/pods")
+	get("/api/v1/namespaces/web/pods")
+	get("/api/v1/nodes/node-a/proxy/stats/summary")
+	m.RecordRateLimitWait(50 * time.Millisecond)
+
+	traffic := m.GetSummary().APITraffic
+	if len(traffic.Endpoints) != 2 {
+		t.Fatalf("expected 2 endpoints, got %+v", traffic.Endpoints)
+	}
+	pods := traffic.Endpoints[0]
+	if pods.Method != "GET" || pods.Path != "/api/v1/namespaces/{namespace}/pods" || pods.Requests != 2 || pods.Bytes != 2000 {
+		t.Errorf("expected 2 pod lists of 1000 bytes first, got %+v", pods)
+	}
+	summary := traffic.Endpoints[1]
+	if summary.Path != "/api/v1/nodes/{node}/proxy/stats/summary" || summary.Throttled != 1 || summary.Failed != 0 {
+		t.Errorf("expected a throttled summary request, got %+v", summary)
+	}
+	if total := traffic.Totals(); total.Requests != 3 || total.Bytes != 2000 || total.Throttled != 1 {
+		t.Errorf("unexpected totals %+v", total)
+	}
+	if traffic.RateLimitWait != 50*time.Millisecond {
+		t.Errorf("expected 50ms rate limit wait, got %v", traffic.RateLimitWait)
+	}
+}
+
+func TestTrafficPath(t *testing.T) {
+	tests := map[string]string{
+		"/api/v1/pods":                                     "/api/v1/pods",
+		"/api/v1/namespaces":                               "/api/v1/namespaces",
+		"/api/v1/namespaces/payments":                      "/api/v1/namespaces/{namespace}",
+		"/apis/metrics.k8s.io/v1beta1/namespaces/web/pods": "/apis/metrics.k8s.io/v1beta1/namespaces/{namespace}/pods",
+		"/api/v1/nodes/node-a/proxy/stats/summary":         "/api/v1/nodes/{node}/proxy/stats/summary",
+	}
+	for path, expected := range tests {
+		if got := trafficPath(path); got != expected {
+			t.Errorf("trafficPath(%q) = %q, expected %q", path, got, expected)
+		}
+	}
+}
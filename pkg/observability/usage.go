@@ -0,0 +1,91 @@
+// Package observability - Prometheus exposition of resource usage
+package observability
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// UsageCollector exposes the rows of the last collection as gauges of the
+// memory and CPU usage, limit and usage-to-limit ratio of every pod, or every
+// container in containers mode. Rows are replaced as a whole by Update, so
+// series of deleted pods disappear with the next collection.
+type UsageCollector struct {
+	mode  config.Mode
+	mutex sync.RWMutex
+	rows  []metrics.Row
+
+	memoryUsage *prometheus.Desc
+	memoryLimit *prometheus.Desc
+	memoryRatio *prometheus.Desc
+	cpuUsage    *prometheus.Desc
+	cpuLimit    *prometheus.Desc
+	cpuRatio    *prometheus.Desc
+}
+
+// NewUsageCollector creates a collector of the rows of mode, which must be
+// pods or containers. Rows must carry both resources (config.ResourceAll).
+func NewUsageCollector(mode config.Mode) *UsageCollector {
+	scope, labels := "pod", []string{"namespace", "pod"}
+	if mode == config.ModeContainers {
+		scope, labels = "container", []string{"namespace", "pod", "container"}
+	}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(MetricsNamespace, scope, name), help, labels, nil)
+	}
+
+	return &UsageCollector{
+		mode:        mode,
+		memoryUsage: desc("memory_usage_bytes", "Memory working set in bytes."),
+		memoryLimit: desc("memory_limit_bytes", "Memory limit in bytes."),
+		memoryRatio: desc("memory_usage_ratio", "Memory working set relative to the memory limit."),
+		cpuUsage:    desc("cpu_usage_cores", "CPU usage in cores."),
+		cpuLimit:    desc("cpu_limit_cores", "CPU limit in cores."),
+		cpuRatio:    desc("cpu_usage_ratio", "CPU usage relative to the CPU limit."),
+	}
+}
+
+// Update replaces the exposed rows with those of the latest collection.
+func (c *UsageCollector) Update(rows []metrics.Row) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.rows = rows
+}
+
+// Describe sends the descriptors of the usage gauges.
+func (c *UsageCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{c.memoryUsage, c.memoryLimit, c.memoryRatio, c.cpuUsage, c.cpuLimit, c.cpuRatio} {
+		ch <- desc
+	}
+}
+
+// Collect sends the usage gauges of every row. Limits and ratios are only
+// sent for rows with a limit of the resource.
+func (c *UsageCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, row := range c.rows {
+		labels := []string{row.Namespace, row.Name}
+		if c.mode == config.ModeContainers {
+			pod, container, _ := strings.Cut(row.Name, ":")
+			labels = []string{row.Namespace, pod, container}
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.memoryUsage, prometheus.GaugeValue, float64(row.UsageBytes), labels...)
+		if percentage, ok := row.ResourcePercentage(config.ResourceMemory); ok {
+			ch <- prometheus.MustNewConstMetric(c.memoryLimit, prometheus.GaugeValue, float64(row.LimitBytes), labels...)
+			ch <- prometheus.MustNewConstMetric(c.memoryRatio, prometheus.GaugeValue, percentage/100, labels...)
+		}
+		ch <- prometheus.MustNewConstMetric(c.cpuUsage, prometheus.GaugeValue, float64(row.UsageMc)/1000, labels...)
+		if percentage, ok := row.ResourcePercentage(config.ResourceCPU); ok {
+			ch <- prometheus.MustNewConstMetric(c.cpuLimit, prometheus.GaugeValue, float64(row.LimitMc)/1000, labels...)
+			ch <- prometheus.MustNewConstMetric(c.cpuRatio, prometheus.GaugeValue, percentage/100, labels...)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package observability
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+func TestUsageCollector(t *testing.T) {
+	e := NewExporter()
+	usage := NewUsageCollector(config.ModeContainers)
+	e.Registry().MustRegister(usage)
+
+	usage.Update([]metrics.Row{
+		{Namespace: "payments", Name: "api-0:app", UsageBytes: 100 << 20, LimitBytes: 200 << 20, UsageMi: 100, LimitMi: 200, UsageMc: 250, LimitMc: 500},
+		{Namespace: "payments", Name: "api-0:proxy", UsageBytes: 10 << 20, UsageMi: 10, UsageMc: 5},
+	})
+	e.Skip()
+
+	scrape := func() string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		e.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		body, err := io.ReadAll(rec.Body)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		return string(body)
+	}
+
+	body := scrape()
+	expected := []string{
+		`kusage_container_memory_usage_bytes{container="app",namespace="payments",pod="api-0"} 1.048576e+08`,
+		`kusage_container_memory_limit_bytes{container="app",namespace="payments",pod="api-0"} 2.097152e+08`,
+		`kusage_container_memory_usage_ratio{container="app",namespace="payments",pod="api-0"} 0.5`,
+		`kusage_container_cpu_usage_cores{container="app",namespace="payments",pod="api-0"} 0.25`,
+		`kusage_container_cpu_limit_cores{container="app",namespace="payments",pod="api-0"} 0.5`,
+		`kusage_container_cpu_usage_ratio{container="app",namespace="payments",pod="api-0"} 0.5`,
+		`kusage_container_cpu_usage_cores{container="proxy",namespace="payments",pod="api-0"} 0.005`,
+		`kusage_collection_runs_skipped_total 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected %q in exposition", line)
+		}
+	}
+	if strings.Contains(body, `kusage_container_memory_limit_bytes{container="proxy"`) {
+		t.Error("expected no limit for a container without one")
+	}
+
+	// Rows of the next collection replace the previous ones
+	usage.Update(nil)
+	if body := scrape(); strings.Contains(body, "kusage_container_memory_usage_bytes") {
+		t.Error("expected rows of the previous collection to be dropped")
+	}
+}
@@ -4,13 +4,20 @@
 package output
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/mchmarny/kusage/pkg/config"
 	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/observability"
 )
 
 // Formatter handles the formatting and presentation of analysis results.
@@ -23,9 +30,15 @@ type Formatter struct {
 // New creates a new Formatter instance configured for tabular output.
 // The tabwriter is configured with production-ready defaults for CLI tools.
 func New() *Formatter {
+	return NewWithWriter(os.Stdout)
+}
+
+// NewWithWriter creates a new Formatter that writes to the provided writer.
+// This is useful for embedding and for tests that capture the rendered output.
+func NewWithWriter(w io.Writer) *Formatter {
 	// Configure tabwriter for clean, aligned output
 	// Parameters: output, minwidth, tabwidth, padding, padchar, flags
-	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	writer := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
 
 	return &Formatter{
 		writer: writer,
@@ -39,16 +52,27 @@ func New() *Formatter {
 // The output format is optimized for human readability while maintaining
 // machine-parseable structure when headers are suppressed.
 func (f *Formatter) PrintTable(rows []metrics.Row, opts config.Options) error {
+	switch opts.Resource {
+	case config.ResourceMemory, config.ResourceCPU, config.ResourceAll:
+	default:
+		return fmt.Errorf("unknown resource type: %v", opts.Resource)
+	}
+	if opts.Output == config.OutputJSON {
+		return f.PrintJSON(rows)
+	}
+
+	columns := f.columns(opts, hasThrottle(rows), hasStatus(rows))
+
 	// Print headers unless suppressed
 	if !opts.NoHeaders {
-		if err := f.printHeaders(opts); err != nil {
+		if err := f.printHeaders(columns); err != nil {
 			return fmt.Errorf("failed to print headers: %w", err)
 		}
 	}
 
 	// Print data rows
 	for _, row := range rows {
-		if err := f.printRow(row, opts); err != nil {
+		if err := f.printRow(row, columns); err != nil {
 			return fmt.Errorf("failed to print row: %w", err)
 		}
 	}
@@ -57,53 +81,1522 @@ func (f *Formatter) PrintTable(rows []metrics.Row, opts config.Options) error {
 	return f.writer.Flush()
 }
 
-// printHeaders outputs the table headers based on the analysis configuration.
-func (f *Formatter) printHeaders(opts config.Options) error {
-	// Format the resource name column header
-	var resourceName string
-	if opts.Mode == config.ModeContainers {
-		resourceName = "CONTAINER (POD)"
-	} else {
-		resourceName = "POD"
-	}
+// PrintRefresh outputs the rows of a watch mode refresh as PrintTable does,
+// with a CHANGE column marking the rows that entered (NEW) or whose percentage
+// moved by the watch delta (+/- percentage points), followed by the rows of
+// the previous refresh no longer listed (GONE).
+func (f *Formatter) PrintRefresh(refresh metrics.Refresh, opts config.Options) error {
+	return f.printRefresh(refresh, opts, false)
+}
 
-	// Format the resource-specific columns
-	var usageHeader, limitHeader string
+// PrintSelectableRefresh outputs a refresh as PrintRefresh does, with a
+// leading # column numbering the listed rows from 1 so that one can be
+// selected for a drill-down. The rows no longer listed are not numbered.
+func (f *Formatter) PrintSelectableRefresh(refresh metrics.Refresh, opts config.Options) error {
+	return f.printRefresh(refresh, opts, true)
+}
+
+// printRefresh outputs a refresh, numbering the listed rows when numbered is true.
+func (f *Formatter) printRefresh(refresh metrics.Refresh, opts config.Options, numbered bool) error {
 	switch opts.Resource {
-	case config.ResourceMemory:
-		usageHeader = "USED(Mi)"
-		limitHeader = "LIMIT(Mi)"
-	case config.ResourceCPU:
-		usageHeader = "USED(mCPU)"
-		limitHeader = "LIMIT(mCPU)"
+	case config.ResourceMemory, config.ResourceCPU, config.ResourceAll:
 	default:
-		usageHeader = "USED"
-		limitHeader = "LIMIT"
+		return fmt.Errorf("unknown resource type: %v", opts.Resource)
 	}
 
-	_, err := fmt.Fprintf(f.writer, "NAMESPACE\t%s\t%s\t%s\t%%USED\n",
-		resourceName, usageHeader, limitHeader)
-	return err
+	// The change and the number of every row, by namespace and name
+	changes := make(map[string]string, len(refresh.Rows)+len(refresh.Gone))
+	numbers := make(map[string]string, len(refresh.Rows))
+	for i, row := range refresh.Rows {
+		numbers[row.Namespace+"/"+row.Name] = strconv.Itoa(i + 1)
+		change, severity := "-", metrics.SeverityOK
+		switch c := refresh.Changes[i]; {
+		case c.Entered:
+			change, severity = "NEW", metrics.SeverityWarning
+		case c.Delta > 0:
+			change, severity = fmt.Sprintf("+%.1f", c.Delta), metrics.SeverityWarning
+		case c.Delta < 0:
+			change = fmt.Sprintf("%.1f", c.Delta)
+		}
+		if opts.Color {
+			change = colorize(change, severity)
+		}
+		changes[row.Namespace+"/"+row.Name] = change
+	}
+	for _, row := range refresh.Gone {
+		change := "GONE"
+		if opts.Color {
+			change = colorize(change, "")
+		}
+		changes[row.Namespace+"/"+row.Name] = change
+	}
+
+	rows := append(append([]metrics.Row(nil), refresh.Rows...), refresh.Gone...)
+	header := "CHANGE"
+	if opts.Color {
+		header = colorize(header, "")
+	}
+	columns := append(f.columns(opts, hasThrottle(rows), hasStatus(rows)), column{header: header, value: func(row metrics.Row) string {
+		return changes[row.Namespace+"/"+row.Name]
+	}})
+	if numbered {
+		columns = append([]column{{header: "#", value: func(row metrics.Row) string {
+			if number, ok := numbers[row.Namespace+"/"+row.Name]; ok {
+				return number
+			}
+			return "-"
+		}}}, columns...)
+	}
+
+	if !opts.NoHeaders {
+		if err := f.printHeaders(columns); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+	for _, row := range rows {
+		if err := f.printRow(row, columns); err != nil {
+			return fmt.Errorf("failed to print row: %w", err)
+		}
+	}
+
+	return f.writer.Flush()
 }
 
-// printRow outputs a single data row in the appropriate format.
-func (f *Formatter) printRow(row metrics.Row, opts config.Options) error {
-	// Format the resource name for display
-	displayName := f.formatResourceName(row.Name, opts.Mode)
+// PrintJSON outputs the result rows as an indented JSON array, with the
+// same fields output plugins receive, for use with jq and scripts.
+func (f *Formatter) PrintJSON(rows []metrics.Row) error {
+	if rows == nil {
+		rows = []metrics.Row{}
+	}
+	data, err := json.MarshalIndent(rows, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode rows: %w", err)
+	}
+	if _, err := f.writer.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to print rows: %w", err)
+	}
+	return f.writer.Flush()
+}
 
-	// Format the resource values based on type
+// PrintGroups outputs the grouped results as a single table in which each
+// group's rows are followed by a subtotal line.
+func (f *Formatter) PrintGroups(groups []metrics.Group, opts config.Options) error {
 	switch opts.Resource {
-	case config.ResourceMemory:
-		_, err := fmt.Fprintf(f.writer, "%s\t%s\t%.1f\t%.1f\t%.1f%%\n",
-			row.Namespace, displayName, row.UsageMi, row.LimitMi, row.Percentage)
+	case config.ResourceMemory, config.ResourceCPU, config.ResourceAll:
+	default:
+		return fmt.Errorf("unknown resource type: %v", opts.Resource)
+	}
+
+	throttle, status := false, false
+	for _, group := range groups {
+		throttle = throttle || hasThrottle(group.Rows)
+		status = status || hasStatus(group.Rows)
+	}
+	columns := f.columns(opts, throttle, status)
+
+	if !opts.NoHeaders {
+		if err := f.printHeaders(columns); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	for _, group := range groups {
+		for _, row := range group.Rows {
+			if err := f.printRow(row, columns); err != nil {
+				return fmt.Errorf("failed to print row: %w", err)
+			}
+		}
+
+		subtotal := group.Total
+		subtotal.Namespace = "SUBTOTAL"
+		subtotal.Name = "node/" + group.Key
+		if err := f.printRow(subtotal, columns); err != nil {
+			return fmt.Errorf("failed to print subtotal: %w", err)
+		}
+	}
+
+	return f.writer.Flush()
+}
+
+// PrintCostCenters outputs one line per cost center with its namespaces,
+// aggregated usage and limits, and the unused headroom below the limits,
+// followed by a total across all cost centers. Priced rows add the hourly
+// cost of every cost center.
+func (f *Formatter) PrintCostCenters(groups []metrics.Group, opts config.Options) error {
+	unit := "Mi"
+	format := func(v float64) string { return fmt.Sprintf("%.1f", v) }
+	usage := func(row metrics.Row) float64 { return row.UsageMi }
+	limit := func(row metrics.Row) float64 { return row.LimitMi }
+	if opts.Resource == config.ResourceCPU {
+		unit = "mCPU"
+		format = func(v float64) string { return fmt.Sprintf("%.0f", v) }
+		usage = func(row metrics.Row) float64 { return float64(row.UsageMc) }
+		limit = func(row metrics.Row) float64 { return float64(row.LimitMc) }
+	}
+	costHeader, cost := "", func(float64) string { return "" }
+	if opts.Pricing != nil {
+		costHeader, cost = "\tCOST/h", func(v float64) string { return "\t" + formatCost(v) }
+	}
+
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintf(f.writer, "COST CENTER\tNAMESPACES\tROWS\tUSED(%s)\tLIMIT(%s)\tHEADROOM(%s)\t%%USED%s\n", unit, unit, unit, costHeader); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	var (
+		rows                                        int
+		totalUsage, totalLimit, headroom, totalCost float64
+	)
+	for _, group := range groups {
+		if _, err := fmt.Fprintf(f.writer, "%s\t%s\t%d\t%s\t%s\t%s\t%.1f%%%s\n",
+			group.Key, strings.Join(group.Namespaces, ","), len(group.Rows),
+			format(usage(group.Total)), format(limit(group.Total)), format(group.Headroom), group.Total.Percentage,
+			cost(group.Total.Cost)); err != nil {
+			return fmt.Errorf("failed to print cost center: %w", err)
+		}
+		rows += len(group.Rows)
+		totalUsage += usage(group.Total)
+		totalLimit += limit(group.Total)
+		headroom += group.Headroom
+		totalCost += group.Total.Cost
+	}
+
+	var percentage float64
+	if totalLimit > 0 {
+		percentage = totalUsage / totalLimit * 100
+	}
+	if _, err := fmt.Fprintf(f.writer, "TOTAL\t-\t%d\t%s\t%s\t%s\t%.1f%%%s\n",
+		rows, format(totalUsage), format(totalLimit), format(headroom), percentage, cost(totalCost)); err != nil {
+		return fmt.Errorf("failed to print total: %w", err)
+	}
+
+	return f.writer.Flush()
+}
+
+// PrintCostRollup outputs the hourly cost of the rows of every namespace, or
+// of every value of the pod label of opts.CostBy, with its share of the
+// total, followed by the total. It is separated from the table above it by a
+// blank line.
+func (f *Formatter) PrintCostRollup(rollups []metrics.CostRollup, opts config.Options) error {
+	header := "NAMESPACE"
+	if opts.CostBy != config.CostByNamespace {
+		header = labelHeader(opts.CostBy)
+	}
+
+	var total metrics.CostRollup
+	for _, rollup := range rollups {
+		total.Rows += rollup.Rows
+		total.Cost += rollup.Cost
+	}
+
+	if _, err := fmt.Fprintln(f.writer); err != nil {
+		return fmt.Errorf("failed to print cost rollup: %w", err)
+	}
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintf(f.writer, "%s\tROWS\tCOST/h\t%%COST\n", header); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+	for _, rollup := range rollups {
+		if _, err := fmt.Fprintf(f.writer, "%s\t%d\t%s\t%s\n",
+			rollup.Key, rollup.Rows, formatCost(rollup.Cost), formatShare(rollup.Cost, total.Cost)); err != nil {
+			return fmt.Errorf("failed to print cost rollup: %w", err)
+		}
+	}
+	if _, err := fmt.Fprintf(f.writer, "TOTAL\t%d\t%s\t%s\n", total.Rows, formatCost(total.Cost), formatShare(total.Cost, total.Cost)); err != nil {
+		return fmt.Errorf("failed to print total: %w", err)
+	}
+
+	return f.writer.Flush()
+}
+
+// PrintComparison outputs the usage of every workload in two clusters side by
+// side with the change of its usage percentage. Columns of a cluster the
+// workload does not run in are shown as -.
+func (f *Formatter) PrintComparison(comparisons []metrics.Comparison, contexts []string, opts config.Options) error {
+	if len(contexts) != 2 {
+		return fmt.Errorf("comparison requires two contexts, got %d", len(contexts))
+	}
+
+	unit := "Mi"
+	format := func(v float64) string { return fmt.Sprintf("%.1f", v) }
+	if opts.Resource == config.ResourceCPU {
+		unit = "mCPU"
+		format = func(v float64) string { return fmt.Sprintf("%.0f", v) }
+	}
+
+	if !opts.NoHeaders {
+		header := []string{"NAMESPACE", "WORKLOAD"}
+		for _, name := range contexts {
+			name = strings.ToUpper(name)
+			header = append(header, name+" ROWS", fmt.Sprintf("%s USED(%s)", name, unit), name+" %USED")
+		}
+		header = append(header, "DELTA")
+		if _, err := fmt.Fprintln(f.writer, strings.Join(header, "\t")); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	side := func(usage *metrics.WorkloadUsage) string {
+		if usage == nil {
+			return "-\t-\t-"
+		}
+		return fmt.Sprintf("%d\t%s\t%.1f%%", usage.Rows, format(usage.Usage), usage.Percentage)
+	}
+
+	for _, c := range comparisons {
+		delta := "-"
+		if d, ok := c.Delta(); ok {
+			delta = fmt.Sprintf("%+.1f", d)
+		}
+		if _, err := fmt.Fprintf(f.writer, "%s\t%s\t%s\t%s\t%s\n", c.Namespace, c.Workload, side(c.Left), side(c.Right), delta); err != nil {
+			return fmt.Errorf("failed to print comparison: %w", err)
+		}
+	}
+
+	return f.writer.Flush()
+}
+
+// PrintPools outputs capacity and consumption per node pool. Growth and the
+// projected time until usage reaches allocatable capacity are shown as - when
+// no history is available or usage is not growing.
+func (f *Formatter) PrintPools(pools []metrics.NodePool, opts config.Options) error {
+	unit := "Mi"
+	format := func(v float64) string { return fmt.Sprintf("%.1f", v) }
+	if opts.Resource == config.ResourceCPU {
+		unit = "mCPU"
+		format = func(v float64) string { return fmt.Sprintf("%.0f", v) }
+	}
+	percent := func(v float64, pool metrics.NodePool) string {
+		if pool.Allocatable <= 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", v/pool.Allocatable*100)
+	}
+
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintf(f.writer, "POOL\tNODES\tPODS\tALLOCATABLE(%s)\tREQUESTS(%s)\tLIMITS(%s)\tNO-LIMIT\tUSED(%s)\t%%REQ\t%%USED\tHEADROOM(%s)\tGROWTH(%s/d)\tFULL IN\n",
+			unit, unit, unit, unit, unit, unit); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	for _, pool := range pools {
+		growth, fullIn := "-", "-"
+		if pool.HasGrowth {
+			growth = format(pool.GrowthPerDay)
+		}
+		if days, ok := pool.DaysToFull(); ok {
+			fullIn = fmt.Sprintf("%.0fd", days)
+		}
+
+		if _, err := fmt.Fprintf(f.writer, "%s\t%d\t%d\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			pool.Name, pool.Nodes, pool.Pods,
+			format(pool.Allocatable), format(pool.Requests), format(pool.Limits), pool.Unlimited, format(pool.Usage),
+			percent(pool.Requests, pool), percent(pool.Usage, pool), format(pool.Headroom()), growth, fullIn); err != nil {
+			return fmt.Errorf("failed to print pool: %w", err)
+		}
+	}
+
+	return f.writer.Flush()
+}
+
+// PrintSnapshots outputs one line per saved snapshot with when it was taken,
+// its cluster and mode, and the number of rows it holds.
+func (f *Formatter) PrintSnapshots(snapshots []metrics.Snapshot, opts config.Options) error {
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintln(f.writer, "ID\tTAKEN\tCLUSTER\tMODE\tROWS"); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	for _, snapshot := range snapshots {
+		if _, err := fmt.Fprintf(f.writer, "%s\t%s\t%s\t%s\t%d\n",
+			snapshot.ID, formatTimestamp(snapshot.TakenAt), valueOrDash(snapshot.Cluster), snapshot.Mode, len(snapshot.Rows)); err != nil {
+			return fmt.Errorf("failed to print snapshot: %w", err)
+		}
+	}
+
+	return f.writer.Flush()
+}
+
+// PrintPending outputs pending pods with the number of nodes they fit into as
+// allocated now and with right-sized requests, and what blocks their scheduling.
+func (f *Formatter) PrintPending(pending []metrics.PendingPod, opts config.Options) error {
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintln(f.writer, "NAMESPACE\tNAME\tOWNER\tCPU REQ(mCPU)\tMEM REQ(Mi)\tFITS NOW\tFITS RIGHT-SIZED\tVERDICT\tMESSAGE"); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	for _, pod := range pending {
+		if _, err := fmt.Fprintf(f.writer, "%s\t%s\t%s\t%d\t%.1f\t%d\t%d\t%s\t%s\n",
+			pod.Namespace, pod.Name, valueOrDash(pod.Owner), pod.RequestMc, pod.RequestMi,
+			pod.FitsNow, pod.FitsRightsized, pod.Verdict, valueOrDash(pod.Message)); err != nil {
+			return fmt.Errorf("failed to print pending pod: %w", err)
+		}
+	}
+
+	return f.writer.Flush()
+}
+
+// PrintVolumes outputs the usage of every persistent volume claim, one per mounting pod.
+func (f *Formatter) PrintVolumes(volumes []metrics.VolumeUsage, opts config.Options) error {
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintf(f.writer, "NAMESPACE\tPVC\tPOD\tUSED\tCAPACITY\t%%USED\n"); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	for _, volume := range volumes {
+		if _, err := fmt.Fprintf(f.writer, "%s\t%s\t%s\t%s\t%s\t%.1f%%\n",
+			volume.Namespace, volume.Claim, volume.Pod, formatBytes(float64(volume.UsedBytes)),
+			formatBytes(float64(volume.CapacityBytes)), volume.Percentage); err != nil {
+			return fmt.Errorf("failed to print volume: %w", err)
+		}
+	}
+
+	return f.writer.Flush()
+}
+
+// PrintQuotas outputs the compute resources of every ResourceQuota: the hard
+// limit, what the quota has admitted and the actual usage of the pods of its
+// namespace. STATUS is EXHAUSTED once the quota admits nothing more and NEAR
+// at opts.Threshold percent of the hard limit. Scoped quotas show no usage.
+func (f *Formatter) PrintQuotas(quotas []metrics.QuotaUsage, opts config.Options) error {
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintf(f.writer, "NAMESPACE\tQUOTA\tRESOURCE\tHARD\tUSED\t%%USED\tUSAGE\t%%USAGE\tSTATUS\n"); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	for _, q := range quotas {
+		usage, usagePercentage := "-", "-"
+		if !q.Scoped {
+			usage = formatQuotaValue(q, q.Usage)
+			usagePercentage = fmt.Sprintf("%.1f%%", q.UsagePercentage())
+		}
+
+		status := "ok"
+		switch {
+		case q.Percentage() >= 100:
+			status = "EXHAUSTED"
+		case q.Percentage() >= opts.Threshold:
+			status = "NEAR"
+		}
+
+		if _, err := fmt.Fprintf(f.writer, "%s\t%s\t%s\t%s\t%s\t%.1f%%\t%s\t%s\t%s\n",
+			q.Namespace, q.Quota, q.Resource, formatQuotaValue(q, q.Hard), formatQuotaValue(q, q.Used),
+			q.Percentage(), usage, usagePercentage, status); err != nil {
+			return fmt.Errorf("failed to print quota: %w", err)
+		}
+	}
+
+	return f.writer.Flush()
+}
+
+// formatQuotaValue formats a memory value of a quota in Mi or a CPU value in millicores.
+func formatQuotaValue(q metrics.QuotaUsage, value float64) string {
+	if q.Memory() {
+		return fmt.Sprintf("%.0fMi", value)
+	}
+	return fmt.Sprintf("%.0fm", value)
+}
+
+// PrintWaste outputs the pods with the most reserved resources left unused,
+// followed by the unused resources of every namespace and a TOTAL line.
+func (f *Formatter) PrintWaste(report metrics.WasteReport, opts config.Options) error {
+	reserved := "REQUEST"
+	if opts.WasteBasis == config.WasteBasisLimits {
+		reserved = "LIMIT"
+	}
+
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintf(f.writer, "NAMESPACE\tPOD\tMEM %[1]s(Mi)\tMEM USED(Mi)\tMEM UNUSED(Mi)\tCPU %[1]s(mCPU)\tCPU USED(mCPU)\tCPU UNUSED(mCPU)\n", reserved); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+	for _, pod := range report.Pods {
+		if _, err := fmt.Fprintf(f.writer, "%s\t%s\t%.1f\t%.1f\t%.1f\t%d\t%d\t%d\n",
+			pod.Namespace, pod.Name, pod.ReservedMi, pod.UsedMi, pod.UnusedMi, pod.ReservedMc, pod.UsedMc, pod.UnusedMc); err != nil {
+			return fmt.Errorf("failed to print waste line: %w", err)
+		}
+	}
+	if err := f.writer.Flush(); err != nil {
 		return err
-	case config.ResourceCPU:
-		_, err := fmt.Fprintf(f.writer, "%s\t%s\t%d\t%d\t%.1f%%\n",
-			row.Namespace, displayName, row.UsageMc, row.LimitMc, row.Percentage)
+	}
+
+	if _, err := fmt.Fprintln(f.writer); err != nil {
+		return fmt.Errorf("failed to print namespace waste: %w", err)
+	}
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintf(f.writer, "NAMESPACE\tPODS\tMEM %[1]s(Mi)\tMEM UNUSED(Mi)\t%%UNUSED\tCPU %[1]s(mCPU)\tCPU UNUSED(mCPU)\t%%UNUSED\n", reserved); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+	for _, namespace := range report.Namespaces {
+		if err := f.printNamespaceWaste(namespace); err != nil {
+			return err
+		}
+	}
+	if err := f.printNamespaceWaste(report.Total); err != nil {
+		return err
+	}
+
+	return f.writer.Flush()
+}
+
+// printNamespaceWaste prints the unused resources of a namespace with their
+// share of its reservations.
+func (f *Formatter) printNamespaceWaste(namespace metrics.Waste) error {
+	if _, err := fmt.Fprintf(f.writer, "%s\t%d\t%.1f\t%.1f\t%s\t%d\t%d\t%s\n",
+		namespace.Namespace, namespace.Pods,
+		namespace.ReservedMi, namespace.UnusedMi, formatShare(namespace.UnusedMi, namespace.ReservedMi),
+		namespace.ReservedMc, namespace.UnusedMc, formatShare(float64(namespace.UnusedMc), float64(namespace.ReservedMc))); err != nil {
+		return fmt.Errorf("failed to print namespace waste: %w", err)
+	}
+	return nil
+}
+
+// PrintSidecars outputs, for every pod, the share of its memory and CPU usage
+// and limits its sidecars account for, followed by a TOTAL line over all pods.
+func (f *Formatter) PrintSidecars(pods []metrics.SidecarUsage, total metrics.SidecarUsage, opts config.Options) error {
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintln(f.writer, "NAMESPACE\tPOD\tSIDECARS\tMEM USED\tMEM LIMIT\tCPU USED\tCPU LIMIT"); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	for _, pod := range pods {
+		if err := f.printSidecarLine(pod); err != nil {
+			return err
+		}
+	}
+	if err := f.printSidecarLine(total); err != nil {
 		return err
+	}
+
+	return f.writer.Flush()
+}
+
+// printSidecarLine prints a single sidecar table line with the sidecar shares of usage.
+func (f *Formatter) printSidecarLine(pod metrics.SidecarUsage) error {
+	if _, err := fmt.Fprintf(f.writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		pod.Namespace, pod.Name, valueOrDash(strings.Join(pod.Containers, ",")),
+		formatShare(pod.Sidecars.MemoryMi, pod.Total.MemoryMi),
+		formatShare(pod.Sidecars.MemoryLimitMi, pod.Total.MemoryLimitMi),
+		formatShare(float64(pod.Sidecars.CPUMc), float64(pod.Total.CPUMc)),
+		formatShare(float64(pod.Sidecars.CPULimitMc), float64(pod.Total.CPULimitMc))); err != nil {
+		return fmt.Errorf("failed to print sidecar line: %w", err)
+	}
+	return nil
+}
+
+// PrintRecommendations outputs the current and suggested requests and limits
+// of every workload container next to the peak usage they are derived from.
+// Settings that are not set, and limits not suggested, are shown as a dash.
+// The PDB column is the PodDisruptionBudget limiting voluntary evictions of
+// the pods, as by node drains; rollouts are not held to it.
+func (f *Formatter) PrintRecommendations(recommendations []metrics.Recommendation, opts config.Options) error {
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintln(f.writer, "NAMESPACE\tWORKLOAD\tCONTAINER\tPODS\tMEM USED(Mi)\tMEM REQ(Mi)\tMEM LIMIT(Mi)\tCPU USED(mCPU)\tCPU REQ(mCPU)\tCPU LIMIT(mCPU)\tPDB"); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	for _, r := range recommendations {
+		if _, err := fmt.Fprintf(f.writer, "%s\t%s\t%s\t%d\t%.1f\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			r.Namespace, r.Owner, r.Container, r.Pods,
+			r.UsedMi,
+			formatSetting(r.Current.MemoryRequestMi, r.Suggested.MemoryRequestMi),
+			formatSetting(r.Current.MemoryLimitMi, r.Suggested.MemoryLimitMi),
+			r.UsedMc,
+			formatSetting(float64(r.Current.CPURequestMc), float64(r.Suggested.CPURequestMc)),
+			formatSetting(float64(r.Current.CPULimitMc), float64(r.Suggested.CPULimitMc)),
+			formatDisruption(r.Disruption)); err != nil {
+			return fmt.Errorf("failed to print recommendation: %w", err)
+		}
+	}
+
+	return f.writer.Flush()
+}
+
+// formatSetting formats a change of a request or limit as "current -> suggested".
+func formatSetting(current, suggested float64) string {
+	format := func(value float64) string {
+		if value <= 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.0f", value)
+	}
+	return format(current) + " -> " + format(suggested)
+}
+
+// formatDisruption formats the budget constraining a workload with the pod
+// evictions it allows now, a dash when no budget selects its pods, or unknown
+// when the budgets were not read.
+func formatDisruption(disruption *metrics.Disruption) string {
+	switch {
+	case disruption == nil:
+		return "unknown"
+	case disruption.Budget == "":
+		return "-"
+	case disruption.Allowed <= 0:
+		return disruption.Budget + " (blocked)"
 	default:
-		return fmt.Errorf("unknown resource type: %v", opts.Resource)
+		return fmt.Sprintf("%s (%d allowed)", disruption.Budget, disruption.Allowed)
+	}
+}
+
+// PrintNodes outputs the requested and used share of the allocatable CPU and
+// memory of every node and its node and image filesystem usage, and with
+// opts.ShowDensity the pods scheduled against its pod capacity. Usage the
+// metrics API and filesystems the kubelet do not report are shown as a dash. Cordoned and tainted nodes
+// are marked, and a TOTAL line sums the capacity of all nodes, or with
+// opts.SchedulableOnly of the nodes that are neither.
+func (f *Formatter) PrintNodes(nodes []metrics.NodeUsage, opts config.Options) error {
+	tainted := false
+	for _, node := range nodes {
+		tainted = tainted || len(node.Taints) > 0
+	}
+
+	if !opts.NoHeaders {
+		header := "NODE\tCPU REQ\tCPU USED\tMEM REQ\tMEM USED\tNODEFS\tIMAGEFS"
+		if opts.ShowDensity {
+			header += "\tPODS\tDENSITY"
+		}
+		if tainted {
+			header += "\tTAINTS"
+		}
+		if _, err := fmt.Fprintln(f.writer, header); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	total := metrics.NodeAllocation{Name: "TOTAL"}
+	if opts.SchedulableOnly {
+		total.Name = "TOTAL (schedulable)"
+	}
+	// The total usage is only known when every node in the total reports it
+	totalUsage := &metrics.NodeResourceUsage{}
+	for _, node := range nodes {
+		name := node.Name
+		switch {
+		case node.Unschedulable:
+			name += " (cordoned)"
+		case len(node.Taints) > 0:
+			name += " (tainted)"
+		}
+		if err := f.printNodeLine(name, node.NodeAllocation, node.Usage, node.NodeFilesystems, tainted, opts); err != nil {
+			return err
+		}
+
+		// Capacity pods cannot be scheduled to is left out of the total on request
+		if opts.SchedulableOnly && !node.Schedulable() {
+			continue
+		}
+		total.AllocatableMc += node.AllocatableMc
+		total.AllocatableMi += node.AllocatableMi
+		total.AllocatablePods += node.AllocatablePods
+		total.Pods += node.Pods
+		total.RequestedMc += node.RequestedMc
+		total.RequestedMi += node.RequestedMi
+		if node.Usage == nil {
+			totalUsage = nil
+		} else if totalUsage != nil {
+			totalUsage.UsedMc += node.Usage.UsedMc
+			totalUsage.UsedMi += node.Usage.UsedMi
+		}
+	}
+	if err := f.printNodeLine(total.Name, total, totalUsage, metrics.NodeFilesystems{}, tainted, opts); err != nil {
+		return err
+	}
+
+	return f.writer.Flush()
+}
+
+// printNodeLine prints the requested and used share of the allocatable
+// capacity of a node, or of the total of the nodes, under name.
+func (f *Formatter) printNodeLine(name string, node metrics.NodeAllocation, usage *metrics.NodeResourceUsage, filesystems metrics.NodeFilesystems, tainted bool, opts config.Options) error {
+	usedCPU, usedMemory := "-", "-"
+	if usage != nil {
+		usedCPU = formatShare(float64(usage.UsedMc), float64(node.AllocatableMc))
+		usedMemory = formatShare(usage.UsedMi, node.AllocatableMi)
+	}
+	line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s",
+		name, formatShare(float64(node.RequestedMc), float64(node.AllocatableMc)), usedCPU,
+		formatShare(node.RequestedMi, node.AllocatableMi), usedMemory,
+		formatFilesystem(filesystems.NodeFS), formatFilesystem(filesystems.ImageFS))
+	if opts.ShowDensity {
+		line += fmt.Sprintf("\t%d/%d\t%s", node.Pods, node.AllocatablePods,
+			formatShare(float64(node.Pods), float64(node.AllocatablePods)))
+	}
+	if tainted {
+		line += "\t" + valueOrDash(strings.Join(node.Taints, ","))
+	}
+	if _, err := fmt.Fprintln(f.writer, line); err != nil {
+		return fmt.Errorf("failed to print node: %w", err)
+	}
+	return nil
+}
+
+// PrintViolations outputs the policy violations, one per line, grouped by rule.
+func (f *Formatter) PrintViolations(violations []metrics.Violation, opts config.Options) error {
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintln(f.writer, "RULE\tNAMESPACE\tNAME\tOWNER\tVIOLATION"); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	for _, violation := range violations {
+		if _, err := fmt.Fprintf(f.writer, "%s\t%s\t%s\t%s\t%s\n",
+			violation.Rule, violation.Namespace, violation.Name, valueOrDash(violation.Owner), violation.Detail); err != nil {
+			return fmt.Errorf("failed to print violation: %w", err)
+		}
+	}
+
+	return f.writer.Flush()
+}
+
+// PrintChecks outputs one line per doctor check with the checked component,
+// its status and the detail of the outcome.
+func (f *Formatter) PrintChecks(checks []metrics.Check, opts config.Options) error {
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintln(f.writer, "COMPONENT\tSTATUS\tDETAIL"); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	for _, check := range checks {
+		if _, err := fmt.Fprintf(f.writer, "%s\t%s\t%s\n", check.Component, check.Status, check.Detail); err != nil {
+			return fmt.Errorf("failed to print check: %w", err)
+		}
+	}
+
+	return f.writer.Flush()
+}
+
+// PrintPlan outputs the requests a dry run would issue against the API server
+// at server and the other usage sources, followed by the estimated number of
+// requests. Requests repeated per page, namespace or node are counted once.
+func (f *Formatter) PrintPlan(plan []metrics.PlannedRequest, server string, opts config.Options) error {
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintln(f.writer, "SERVER\tMETHOD\tPATH\tPARAMS\tREQUESTS"); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	total, repeated := 0, false
+	for _, request := range plan {
+		requests := fmt.Sprintf("%d", request.Requests)
+		if request.Per != "" {
+			requests += " per " + request.Per
+			repeated = true
+		}
+		if _, err := fmt.Fprintf(f.writer, "%s\t%s\t%s\t%s\t%s\n",
+			request.Server, request.Method, request.Path, valueOrDash(request.Params), requests); err != nil {
+			return fmt.Errorf("failed to print planned request: %w", err)
+		}
+		total += request.Requests
+	}
+	if err := f.writer.Flush(); err != nil {
+		return err
+	}
+
+	estimate := fmt.Sprintf("%d requests", total)
+	if repeated {
+		estimate = fmt.Sprintf("at least %d requests, one more for every additional page, namespace or node", total)
+	}
+	if _, err := fmt.Fprintf(f.writer, "\nAPI server: %s\nEstimated: %s (retries not included)\n", server, estimate); err != nil {
+		return fmt.Errorf("failed to print plan summary: %w", err)
+	}
+	return f.writer.Flush()
+}
+
+// PrintAPIImpact outputs the requests a run issued per endpoint, busiest
+// first, followed by a TOTAL line and the time requests waited on the
+// client-side rate limit, so page size and QPS can be tuned against them.
+func (f *Formatter) PrintAPIImpact(traffic observability.APITraffic, opts config.Options) error {
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintln(f.writer, "METHOD\tPATH\tREQUESTS\tRECEIVED\tTIME\tTHROTTLED\tFAILED"); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	total := traffic.Totals()
+	total.Method = "TOTAL"
+	for _, e := range append(traffic.Endpoints, total) {
+		if _, err := fmt.Fprintf(f.writer, "%s\t%s\t%d\t%s\t%s\t%d\t%d\n",
+			e.Method, valueOrDash(e.Path), e.Requests, formatBytes(float64(e.Bytes)),
+			e.Duration.Round(time.Millisecond), e.Throttled, e.Failed); err != nil {
+			return fmt.Errorf("failed to print endpoint traffic: %w", err)
+		}
+	}
+	if err := f.writer.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(f.writer, "\nClient-side rate limit wait: %s, lists read in pages of %d\n",
+		traffic.RateLimitWait.Round(time.Millisecond), opts.PageSize); err != nil {
+		return fmt.Errorf("failed to print api impact summary: %w", err)
+	}
+	return f.writer.Flush()
+}
+
+// PrintFragmentation outputs the free capacity of every schedulable node, how
+// many pods of the typical shape it holds and what is stranded once they are
+// placed, followed by a TOTAL line and the stranded share of allocatable capacity.
+func (f *Formatter) PrintFragmentation(fragmentation metrics.Fragmentation, opts config.Options) error {
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintln(f.writer, "NODE\tFREE CPU(mCPU)\tFREE MEM(Mi)\tFITS\tSTRANDED CPU(mCPU)\tSTRANDED MEM(Mi)"); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	total := metrics.NodeFragmentation{Name: "TOTAL"}
+	for _, node := range fragmentation.Nodes {
+		if err := f.printFragmentationLine(node); err != nil {
+			return err
+		}
+		total.FreeMc += node.FreeMc
+		total.FreeMi += node.FreeMi
+		total.Fits += node.Fits
+		total.StrandedMc += node.StrandedMc
+		total.StrandedMi += node.StrandedMi
+	}
+	if err := f.printFragmentationLine(total); err != nil {
+		return err
+	}
+	if err := f.writer.Flush(); err != nil {
+		return err
+	}
+
+	shape := fragmentation.Shape
+	_, err := fmt.Fprintf(f.writer, "\nPod shape %dm CPU / %.1fMi memory: %s of allocatable CPU and %s of allocatable memory stranded\n",
+		shape.CPUMc, shape.MemoryMi,
+		formatShare(float64(total.StrandedMc), float64(fragmentation.AllocatableMc)),
+		formatShare(total.StrandedMi, fragmentation.AllocatableMi))
+	if err != nil {
+		return fmt.Errorf("failed to print fragmentation summary: %w", err)
+	}
+	return f.writer.Flush()
+}
+
+// printFragmentationLine prints a single fragmentation table line.
+func (f *Formatter) printFragmentationLine(node metrics.NodeFragmentation) error {
+	if _, err := fmt.Fprintf(f.writer, "%s\t%d\t%.1f\t%d\t%d\t%.1f\n",
+		node.Name, node.FreeMc, node.FreeMi, node.Fits, node.StrandedMc, node.StrandedMi); err != nil {
+		return fmt.Errorf("failed to print fragmentation line: %w", err)
+	}
+	return nil
+}
+
+// PrintChargeback outputs consumed and reserved resource totals per group.
+// Tables include efficiency percentages and a TOTAL line; CSV output carries
+// only the raw totals so it can be imported into billing systems as is.
+func (f *Formatter) PrintChargeback(lines []metrics.ChargebackLine, opts config.Options) error {
+	if opts.Output == config.OutputCSV {
+		return f.printChargebackCSV(lines, opts)
+	}
+
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintln(f.writer, "GROUP\tCPU USED(core-h)\tCPU RESERVED(core-h)\tCPU EFF%\tMEM USED(GiB-h)\tMEM RESERVED(GiB-h)\tMEM EFF%"); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	var total metrics.ChargebackLine
+	for _, line := range lines {
+		if err := f.printChargebackLine(line); err != nil {
+			return err
+		}
+		total.CPUCoreHoursUsed += line.CPUCoreHoursUsed
+		total.CPUCoreHoursReserved += line.CPUCoreHoursReserved
+		total.MemoryGiBHoursUsed += line.MemoryGiBHoursUsed
+		total.MemoryGiBHoursReserved += line.MemoryGiBHoursReserved
+	}
+
+	total.Group = "TOTAL"
+	if err := f.printChargebackLine(total); err != nil {
+		return err
+	}
+
+	return f.writer.Flush()
+}
+
+// printChargebackLine prints a single chargeback table line.
+func (f *Formatter) printChargebackLine(line metrics.ChargebackLine) error {
+	if _, err := fmt.Fprintf(f.writer, "%s\t%.1f\t%.1f\t%s\t%.1f\t%.1f\t%s\n",
+		line.Group,
+		line.CPUCoreHoursUsed, line.CPUCoreHoursReserved, efficiency(line.CPUCoreHoursUsed, line.CPUCoreHoursReserved),
+		line.MemoryGiBHoursUsed, line.MemoryGiBHoursReserved, efficiency(line.MemoryGiBHoursUsed, line.MemoryGiBHoursReserved)); err != nil {
+		return fmt.Errorf("failed to print chargeback line: %w", err)
+	}
+	return nil
+}
+
+// printChargebackCSV prints chargeback lines as RFC 4180 CSV.
+func (f *Formatter) printChargebackCSV(lines []metrics.ChargebackLine, opts config.Options) error {
+	w := csv.NewWriter(f.writer)
+	if !opts.NoHeaders {
+		if err := w.Write([]string{
+			"group", "cpu_core_hours_used", "cpu_core_hours_reserved", "memory_gib_hours_used", "memory_gib_hours_reserved",
+		}); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	for _, line := range lines {
+		if err := w.Write([]string{
+			line.Group,
+			fmt.Sprintf("%.3f", line.CPUCoreHoursUsed),
+			fmt.Sprintf("%.3f", line.CPUCoreHoursReserved),
+			fmt.Sprintf("%.3f", line.MemoryGiBHoursUsed),
+			fmt.Sprintf("%.3f", line.MemoryGiBHoursReserved),
+		}); err != nil {
+			return fmt.Errorf("failed to print chargeback line: %w", err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to print chargeback lines: %w", err)
+	}
+	return f.writer.Flush()
+}
+
+// PrintExport outputs the container rows of every sample as a tidy CSV
+// dataset, one line per container per sample, for analysis in notebooks.
+// Memory is in bytes and CPU in millicores; requests and limits that are not
+// set are left empty. With opts.ExportLabels every pod label seen in any
+// sample becomes a label_<key> column, empty for pods without it.
+func (f *Formatter) PrintExport(samples []metrics.Snapshot, opts config.Options) error {
+	var labelKeys []string
+	if opts.ExportLabels {
+		seen := make(map[string]bool)
+		for _, sample := range samples {
+			for _, row := range sample.Rows {
+				for key := range row.Labels {
+					if !seen[key] {
+						seen[key] = true
+						labelKeys = append(labelKeys, key)
+					}
+				}
+			}
+		}
+		slices.Sort(labelKeys)
+	}
+
+	w := csv.NewWriter(f.writer)
+	if !opts.NoHeaders {
+		headers := []string{
+			"sample", "timestamp", "namespace", "pod", "container", "node", "owner", "priority_class",
+			"memory_usage_bytes", "memory_request_bytes", "memory_limit_bytes",
+			"cpu_usage_millicores", "cpu_request_millicores", "cpu_limit_millicores",
+			"restarts", "crash_loop",
+		}
+		for _, key := range labelKeys {
+			headers = append(headers, "label_"+key)
+		}
+		if err := w.Write(headers); err != nil {
+			return fmt.Errorf("failed to print headers: %w", err)
+		}
+	}
+
+	for i, sample := range samples {
+		for _, row := range sample.Rows {
+			pod, container, _ := strings.Cut(row.Name, ":")
+			record := []string{
+				strconv.Itoa(i + 1),
+				sample.TakenAt.UTC().Format(time.RFC3339),
+				row.Namespace,
+				pod,
+				container,
+				row.Node,
+				row.Owner,
+				row.PriorityClass,
+				strconv.FormatInt(row.UsageBytes, 10),
+				countOrEmpty(row.RequestBytes),
+				countOrEmpty(row.LimitBytes),
+				strconv.FormatInt(row.UsageMc, 10),
+				countOrEmpty(row.RequestMc),
+				countOrEmpty(row.LimitMc),
+				strconv.FormatInt(int64(row.Restarts), 10),
+				strconv.FormatBool(row.CrashLoop),
+			}
+			for _, key := range labelKeys {
+				record = append(record, row.Labels[key])
+			}
+			if err := w.Write(record); err != nil {
+				return fmt.Errorf("failed to print export row: %w", err)
+			}
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to print export rows: %w", err)
+	}
+	return f.writer.Flush()
+}
+
+// countOrEmpty formats a request or limit, or an empty string when it is not set.
+func countOrEmpty(value int64) string {
+	if value <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(value, 10)
+}
+
+// efficiency formats used as a percentage of reserved, or - when nothing was reserved.
+func efficiency(used, reserved float64) string {
+	if reserved <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", used/reserved*100)
+}
+
+// PrintSummary outputs aggregate statistics without per-row output.
+// The layout is a simple key/value table followed by the percentage distribution,
+// suitable for dashboards and digest emails.
+func (f *Formatter) PrintSummary(summary metrics.Summary, opts config.Options) error {
+	unit := "Mi"
+	if opts.Resource == config.ResourceCPU {
+		unit = "mCPU"
+	}
+
+	lines := []string{
+		fmt.Sprintf("ROWS\t%d", summary.Count),
+		fmt.Sprintf("TOTAL USED(%s)\t%.1f", unit, summary.TotalUsage),
+		fmt.Sprintf("TOTAL LIMIT(%s)\t%.1f", unit, summary.TotalLimit),
+		fmt.Sprintf("AVG %%USED\t%.1f%%", summary.AvgPercentage),
+		fmt.Sprintf("MAX %%USED\t%.1f%%", summary.MaxPercentage),
+		fmt.Sprintf("OVER %.0f%%\t%d", summary.Threshold, summary.OverThreshold),
+	}
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(f.writer, line); err != nil {
+			return fmt.Errorf("failed to print summary: %w", err)
+		}
+	}
+
+	if !opts.NoHeaders {
+		if _, err := fmt.Fprintln(f.writer, "\nDISTRIBUTION\tROWS"); err != nil {
+			return fmt.Errorf("failed to print summary: %w", err)
+		}
+	}
+	for _, bucket := range summary.Buckets {
+		if _, err := fmt.Fprintf(f.writer, "%s\t%d\n", bucket.Label, bucket.Count); err != nil {
+			return fmt.Errorf("failed to print summary: %w", err)
+		}
+	}
+
+	return f.writer.Flush()
+}
+
+// PrintTraces outputs the pipeline trace for each pod selected with --why.
+// Each trace is rendered as a stage table followed by the final verdict.
+func (f *Formatter) PrintTraces(traces []metrics.Trace, opts config.Options) error {
+	for i, trace := range traces {
+		if i > 0 {
+			if _, err := fmt.Fprintln(f.writer); err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintf(f.writer, "POD: %s/%s\n", trace.Namespace, trace.Name); err != nil {
+			return fmt.Errorf("failed to print trace: %w", err)
+		}
+		if trace.Node != "" || trace.QoS != "" {
+			if _, err := fmt.Fprintf(f.writer, "NODE: %s  QOS: %s  RESTARTS: %d\n", trace.Node, trace.QoS, trace.Restarts); err != nil {
+				return fmt.Errorf("failed to print trace: %w", err)
+			}
+		}
+		if _, err := fmt.Fprintln(f.writer, "STAGE\tRESULT\tDETAIL"); err != nil {
+			return fmt.Errorf("failed to print trace: %w", err)
+		}
+
+		for _, step := range trace.Steps {
+			result := "pass"
+			if !step.Passed {
+				result = "EXCLUDED"
+			}
+			if _, err := fmt.Fprintf(f.writer, "%s\t%s\t%s\n", step.Stage, result, step.Detail); err != nil {
+				return fmt.Errorf("failed to print trace: %w", err)
+			}
+		}
+
+		for _, row := range trace.Rows {
+			if _, err := fmt.Fprintf(f.writer, "result\t%.1f%%\t%s\n",
+				row.Percentage, f.formatResourceName(row.Name, opts.Mode)); err != nil {
+				return fmt.Errorf("failed to print trace: %w", err)
+			}
+		}
+
+		if commands := investigateCommands(trace); len(commands) > 0 {
+			if _, err := fmt.Fprintln(f.writer, "INVESTIGATE:"); err != nil {
+				return fmt.Errorf("failed to print trace: %w", err)
+			}
+			for _, command := range commands {
+				if _, err := fmt.Fprintf(f.writer, "  %s\n", command); err != nil {
+					return fmt.Errorf("failed to print trace: %w", err)
+				}
+			}
+		}
+
+		// Flush per trace so column widths are computed per pod
+		if err := f.writer.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// investigateCommands returns the kubectl commands to look further into a
+// traced pod, or none when the pod was not found.
+func investigateCommands(trace metrics.Trace) []string {
+	if len(trace.Steps) == 0 || !trace.Steps[0].Passed {
+		return nil
+	}
+
+	commands := []string{
+		fmt.Sprintf("kubectl describe pod %s -n %s", trace.Name, trace.Namespace),
+		fmt.Sprintf("kubectl top pod %s -n %s --containers", trace.Name, trace.Namespace),
+	}
+	if trace.Restarts > 0 {
+		commands = append(commands, fmt.Sprintf("kubectl logs %s -n %s --all-containers --previous", trace.Name, trace.Namespace))
+	}
+	commands = append(commands, fmt.Sprintf("kubectl get events -n %s --field-selector involvedObject.name=%s", trace.Namespace, trace.Name))
+	if trace.Node != "" {
+		commands = append(commands, fmt.Sprintf("kubectl describe node %s", trace.Node))
+	}
+	return commands
+}
+
+// column describes a single table column and how to render its value for a row.
+type column struct {
+	header string
+	value  func(row metrics.Row) string
+}
+
+// columns returns the ordered list of table columns for the configured
+// mode, resource and output format. throttle reports whether any row
+// carries CPU throttling data, status whether any row has a status marker.
+func (f *Formatter) columns(opts config.Options, throttle, status bool) []column {
+	// Format the resource name column header
+	resourceName := "POD"
+	if opts.Mode == config.ModeContainers {
+		resourceName = "CONTAINER (POD)"
+	}
+
+	columns := []column{
+		{header: "NAMESPACE", value: func(row metrics.Row) string { return row.Namespace }},
+		{header: resourceName, value: func(row metrics.Row) string { return f.formatResourceName(row.Name, opts.Mode) }},
+	}
+	// Rows summed per node are named after the node, merged containers after
+	// their workload and name
+	switch opts.GroupBy {
+	case config.GroupByNode:
+		columns = []column{{header: "NODE", value: func(row metrics.Row) string { return row.Name }}}
+	case config.GroupByContainerName:
+		columns = []column{
+			{header: "NAMESPACE", value: func(row metrics.Row) string { return row.Namespace }},
+			{header: "WORKLOAD", value: func(row metrics.Row) string { return row.Owner }},
+			{header: "CONTAINER", value: func(row metrics.Row) string { return row.Name }},
+		}
+	}
+	// Rows of several contexts name their context first
+	if len(opts.Contexts) > 0 {
+		columns = append([]column{{header: "CLUSTER", value: func(row metrics.Row) string { return row.Cluster }}}, columns...)
+	}
+
+	// Format the resource-specific columns
+	switch opts.Resource {
+	case config.ResourceAll:
+		columns = append(columns,
+			column{header: "USED(Mi)", value: func(row metrics.Row) string { return fmt.Sprintf("%.1f", row.UsageMi) }},
+			column{header: "LIMIT(Mi)", value: func(row metrics.Row) string {
+				return positiveOrDash(row.LimitMi, formatLimit(fmt.Sprintf("%.1f", row.LimitMi), row.DefaultMemoryLimit))
+			}},
+			percentColumn("%MEM", config.ResourceMemory, opts.Color),
+			column{header: "USED(mCPU)", value: func(row metrics.Row) string { return fmt.Sprintf("%d", row.UsageMc) }},
+			column{header: "LIMIT(mCPU)", value: func(row metrics.Row) string {
+				return positiveOrDash(float64(row.LimitMc), formatLimit(fmt.Sprintf("%d", row.LimitMc), row.DefaultCPULimit))
+			}},
+			percentColumn("%CPU", config.ResourceCPU, opts.Color),
+		)
+	case config.ResourceCPU:
+		columns = append(columns, usageColumns(opts, "mCPU", "%.0f", func(row metrics.Row) string { return fmt.Sprintf("%d", row.UsageMc) })...)
+		columns = append(columns,
+			column{header: "LIMIT(mCPU)", value: func(row metrics.Row) string {
+				return limitOrDash(row, formatLimit(fmt.Sprintf("%d", row.LimitMc), row.DefaultCPULimit))
+			}},
+		)
+	default:
+		columns = append(columns, usageColumns(opts, "Mi", "%.1f", func(row metrics.Row) string { return fmt.Sprintf("%.1f", row.UsageMi) })...)
+		columns = append(columns,
+			column{header: "LIMIT(Mi)", value: func(row metrics.Row) string {
+				return limitOrDash(row, formatLimit(fmt.Sprintf("%.1f", row.LimitMi), row.DefaultMemoryLimit))
+			}},
+		)
+	}
+
+	// Percentages are highlighted by severity when color is enabled; merged
+	// containers show the spread of their replicas, highlighting the max
+	switch {
+	case opts.Resource == config.ResourceAll:
+		// Both percentages are already shown
+	case opts.GroupBy == config.GroupByContainerName:
+		maxHeader := "%MAX"
+		if opts.Color {
+			maxHeader = colorize(maxHeader, "")
+		}
+		columns = append(columns,
+			column{header: "COUNT", value: func(row metrics.Row) string {
+				return replicaValue(row, func(s *metrics.ReplicaStats) string { return fmt.Sprintf("%d", s.Count) })
+			}},
+			column{header: "%MEAN", value: func(row metrics.Row) string {
+				return replicaValue(row, func(s *metrics.ReplicaStats) string { return fmt.Sprintf("%.1f%%", s.MeanPercentage) })
+			}},
+			column{header: "%P95", value: func(row metrics.Row) string {
+				return replicaValue(row, func(s *metrics.ReplicaStats) string { return fmt.Sprintf("%.1f%%", s.P95Percentage) })
+			}},
+			column{header: maxHeader, value: func(row metrics.Row) string {
+				value := fmt.Sprintf("%.1f%%", row.Percentage)
+				if opts.Color {
+					return colorize(value, row.Severity)
+				}
+				return value
+			}},
+		)
+	case opts.Color:
+		columns = append(columns,
+			column{header: colorize("%USED", ""), value: func(row metrics.Row) string {
+				return colorize(limitOrDash(row, fmt.Sprintf("%.1f%%", row.Percentage)), row.Severity)
+			}},
+		)
+	default:
+		columns = append(columns,
+			column{header: "%USED", value: func(row metrics.Row) string { return limitOrDash(row, fmt.Sprintf("%.1f%%", row.Percentage)) }},
+		)
+	}
+
+	// Pricing adds the hourly cost of every row
+	if opts.Pricing != nil {
+		columns = append(columns,
+			column{header: "COST/h", value: func(row metrics.Row) string { return formatCost(row.Cost) }},
+		)
+	}
+
+	// Network rates are shown when requested
+	if opts.ShowNetwork {
+		columns = append(columns,
+			column{header: "RX/s", value: func(row metrics.Row) string {
+				if row.Network == nil {
+					return "-"
+				}
+				return formatRate(row.Network.RxBytesPerSecond)
+			}},
+			column{header: "TX/s", value: func(row metrics.Row) string {
+				if row.Network == nil {
+					return "-"
+				}
+				return formatRate(row.Network.TxBytesPerSecond)
+			}},
+		)
+	}
+
+	// Throttling is shown for CPU when the usage source reports CFS periods
+	if opts.Resource != config.ResourceMemory && (throttle || opts.Sort == config.SortByThrottle) {
+		columns = append(columns,
+			column{header: "THROTTLE%", value: func(row metrics.Row) string {
+				if row.CPUPeriods == 0 {
+					return "-"
+				}
+				return fmt.Sprintf("%.1f%%", row.ThrottlePercent)
+			}},
+		)
+	}
+
+	// Forecasts estimate the time until memory reaches the limit
+	if opts.Forecast {
+		columns = append(columns,
+			column{header: "FORECAST", value: func(row metrics.Row) string { return formatForecast(row.HoursToLimit) }},
+		)
+	}
+
+	// A score expression or weights add the score as a sortable column
+	if opts.Scored() {
+		columns = append(columns,
+			column{header: "SCORE", value: func(row metrics.Row) string { return fmt.Sprintf("%.2f", row.Score) }},
+		)
+	}
+
+	// Rows whose usage reads differently are marked, e.g. crash-looping pods
+	// whose low usage is not headroom
+	if status {
+		columns = append(columns,
+			column{header: "STATUS", value: func(row metrics.Row) string { return valueOrDash(rowStatus(row)) }},
+		)
+	}
+
+	// Wide output adds diagnostic columns; grouped rows only have restarts
+	switch {
+	case opts.Output == config.OutputWide && opts.GroupBy != "":
+		columns = append(columns,
+			column{header: "RESTARTS", value: func(row metrics.Row) string { return fmt.Sprintf("%d", row.Restarts) }},
+		)
+	case opts.Output == config.OutputWide:
+		columns = append(columns,
+			column{header: "OWNER", value: func(row metrics.Row) string { return valueOrDash(row.Owner) }},
+			column{header: "NODE", value: func(row metrics.Row) string { return valueOrDash(row.Node) }},
+			column{header: "WINDOW", value: func(row metrics.Row) string { return formatDuration(row.Window) }},
+			column{header: "TIMESTAMP", value: func(row metrics.Row) string { return formatTimestamp(row.Timestamp) }},
+			column{header: "RESTARTS", value: func(row metrics.Row) string { return fmt.Sprintf("%d", row.Restarts) }},
+		)
+	}
+
+	// Label columns come last, as in kubectl
+	for _, key := range opts.LabelColumns {
+		columns = append(columns, column{header: labelHeader(key), value: func(row metrics.Row) string { return valueOrDash(row.Labels[key]) }})
+	}
+
+	return columns
+}
+
+// replicaValue formats the replica statistics of a row, or returns a dash for
+// rows without them.
+func replicaValue(row metrics.Row, format func(*metrics.ReplicaStats) string) string {
+	if row.Replicas == nil {
+		return "-"
+	}
+	return format(row.Replicas)
+}
+
+// labelHeader returns the column header of label key: its name without the
+// prefix, upper-cased as by kubectl -L.
+func labelHeader(key string) string {
+	return strings.ToUpper(key[strings.LastIndex(key, "/")+1:])
+}
+
+// percentColumn returns a column with the usage percentage of resource in rows
+// of both resources. With color, the percentage the row is ranked by is
+// highlighted by severity.
+func percentColumn(header string, resource config.ResourceKind, color bool) column {
+	value := func(row metrics.Row) string {
+		percentage, ok := row.ResourcePercentage(resource)
+		if !ok {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", percentage)
+	}
+	if !color {
+		return column{header: header, value: value}
+	}
+	return column{header: colorize(header, ""), value: func(row metrics.Row) string {
+		severity := metrics.SeverityOK
+		if percentage, ok := row.ResourcePercentage(resource); ok && percentage == row.Percentage {
+			severity = row.Severity
+		}
+		return colorize(value(row), severity)
+	}}
+}
+
+// printHeaders outputs the table headers for the given columns.
+func (f *Formatter) printHeaders(columns []column) error {
+	headers := make([]string, 0, len(columns))
+	for _, col := range columns {
+		headers = append(headers, col.header)
+	}
+	_, err := fmt.Fprintln(f.writer, strings.Join(headers, "\t"))
+	return err
+}
+
+// printRow outputs a single data row for the given columns.
+func (f *Formatter) printRow(row metrics.Row, columns []column) error {
+	values := make([]string, 0, len(columns))
+	for _, col := range columns {
+		values = append(values, col.value(row))
+	}
+	_, err := fmt.Fprintln(f.writer, strings.Join(values, "\t"))
+	return err
+}
+
+// colorize wraps value in ANSI color codes for the severity. Every value is
+// wrapped in codes of the same length, including the default color, because
+// the tabwriter counts escape codes towards the column width.
+func colorize(value string, severity metrics.Severity) string {
+	code := "\x1b[39m" // default foreground
+	switch severity {
+	case metrics.SeverityWarning:
+		code = "\x1b[33m" // yellow
+	case metrics.SeverityCritical:
+		code = "\x1b[31m" // red
+	}
+	return code + value + "\x1b[0m"
+}
+
+// usageColumns returns the USED column of a single resource in unit, or with
+// --samples the MIN, AVG, P95 and MAX of the usage sampled, formatted with
+// format. AVG is the usage the percentage is computed from.
+func usageColumns(opts config.Options, unit, format string, used func(row metrics.Row) string) []column {
+	if opts.Samples <= 1 {
+		return []column{{header: "USED(" + unit + ")", value: used}}
+	}
+	sampled := func(header string, value func(s *metrics.SampleStats) float64) column {
+		return column{header: header + "(" + unit + ")", value: func(row metrics.Row) string {
+			if row.Samples == nil {
+				return "-"
+			}
+			return fmt.Sprintf(format, value(row.Samples))
+		}}
+	}
+	return []column{
+		sampled("MIN", func(s *metrics.SampleStats) float64 { return s.Min }),
+		sampled("AVG", func(s *metrics.SampleStats) float64 { return s.Avg }),
+		sampled("P95", func(s *metrics.SampleStats) float64 { return s.P95 }),
+		sampled("MAX", func(s *metrics.SampleStats) float64 { return s.Max }),
+	}
+}
+
+// hasThrottle reports whether any row carries CPU throttling data.
+func hasThrottle(rows []metrics.Row) bool {
+	for _, row := range rows {
+		if row.CPUPeriods > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasStatus reports whether any row has a status marker.
+func hasStatus(rows []metrics.Row) bool {
+	for _, row := range rows {
+		if rowStatus(row) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// rowStatus returns the comma-separated status markers of row: CRASHLOOP for
+// containers waiting in CrashLoopBackOff and WINDOWS for pods on Windows nodes.
+func rowStatus(row metrics.Row) string {
+	var markers []string
+	if row.CrashLoop {
+		markers = append(markers, "CRASHLOOP")
+	}
+	if row.Windows {
+		markers = append(markers, "WINDOWS")
+	}
+	return strings.Join(markers, ",")
+}
+
+// formatRate renders a byte rate with a binary unit (e.g. 1.5MiB).
+func formatRate(bytesPerSecond float64) string {
+	return formatBytes(bytesPerSecond)
+}
+
+// formatBytes renders a byte count with a binary unit (e.g. 1.5GiB).
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f%s", bytes, units[unit])
+	}
+	return fmt.Sprintf("%.1f%s", bytes, units[unit])
+}
+
+// formatCost formats an hourly cost; prices are per hour, so fractions of a
+// cent are kept.
+func formatCost(cost float64) string {
+	return fmt.Sprintf("%.4f", cost)
+}
+
+// formatShare formats part as a percentage of total, or a dash without total.
+func formatShare(part, total float64) string {
+	if total <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", part/total*100)
+}
+
+// formatFilesystem formats the used share of a filesystem, or a dash when unknown.
+func formatFilesystem(usage *metrics.FilesystemUsage) string {
+	if usage == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", usage.Percentage())
+}
+
+// valueOrDash renders an optional string value, using "-" when empty.
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// positiveOrDash renders value when limit is positive, or "-" otherwise.
+func positiveOrDash(limit float64, value string) string {
+	if limit <= 0 {
+		return "-"
+	}
+	return value
+}
+
+// limitOrDash renders a limit or percentage of row, using "-" when the row
+// has no limit.
+func limitOrDash(row metrics.Row, value string) string {
+	if !row.HasLimit() {
+		return "-"
+	}
+	return value
+}
+
+// formatLimit marks a limit that includes a LimitRange default.
+func formatLimit(value string, defaulted bool) string {
+	if defaulted {
+		return value + " (default)"
+	}
+	return value
+}
+
+// formatForecast renders the hours until a limit is reached, in hours under
+// two days and in days beyond, using "-" when usage is not growing.
+func formatForecast(hours *float64) string {
+	switch {
+	case hours == nil:
+		return "-"
+	case *hours < 1:
+		return "<1h"
+	case *hours < 48:
+		return fmt.Sprintf("%.0fh", *hours)
+	default:
+		return fmt.Sprintf("%.1fd", *hours/24)
+	}
+}
+
+// formatDuration renders a metrics window, using "-" when unknown.
+func formatDuration(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return d.String()
+}
+
+// formatTimestamp renders a sample timestamp in UTC, using "-" when unknown.
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return "-"
 	}
+	return t.UTC().Format(time.RFC3339)
 }
 
 // formatResourceName formats the resource name for display based on the analysis mode.
@@ -0,0 +1,674 @@
+package output
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/analyzer"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/observability"
+)
+
+// update rewrites the golden files with the current output:
+//
+//	go test ./pkg/output -update
+var update = flag.Bool("update", false, "update golden files")
+
+// goldenDir holds the expected output of every golden test case
+const goldenDir = "testdata/golden"
+
+// sampleTime is the fixed sample timestamp used by the golden rows
+var sampleTime = time.Date(2025, 9, 1, 12, 30, 0, 0, time.UTC)
+
+// podMemoryRows returns a fixed set of pod memory rows.
+func podMemoryRows() []metrics.Row {
+	return []metrics.Row{
+		{
+			Namespace: "monitoring", Name: "node-exporter-p9x4l", Resource: config.ResourceMemory, Mode: config.ModePods,
+			UsageBytes: 47 * metrics.BytesPerMi, LimitBytes: 50 * metrics.BytesPerMi, UsageMi: 47, LimitMi: 50, Percentage: 94,
+			Window: 15 * time.Second, Timestamp: sampleTime, Node: "node-pool-a-1", Owner: "DaemonSet/node-exporter",
+		},
+		{
+			Namespace: "payments", Name: "payments-db-0", Resource: config.ResourceMemory, Mode: config.ModePods,
+			UsageBytes: 1740 * metrics.BytesPerMi, LimitBytes: 2048 * metrics.BytesPerMi, UsageMi: 1740, LimitMi: 2048, Percentage: 84.9609375,
+			Window: 20 * time.Second, Timestamp: sampleTime, Node: "node-pool-b-1", Owner: "StatefulSet/payments-db",
+		},
+		{
+			Namespace: "payments", Name: "payments-api-7c9d8f6b5-m8zrt", Resource: config.ResourceMemory, Mode: config.ModePods,
+			UsageBytes: 559 * metrics.BytesPerMi, LimitBytes: 640 * metrics.BytesPerMi, UsageMi: 559, LimitMi: 640, Percentage: 87.34375,
+			Window: 15 * time.Second, Timestamp: sampleTime, Restarts: 2, Node: "node-pool-a-2", Owner: "Deployment/payments-api",
+		},
+		{
+			Namespace: "default", Name: "debug-shell", Resource: config.ResourceMemory, Mode: config.ModePods,
+			UsageBytes: 3 * metrics.BytesPerMi, LimitBytes: 64 * metrics.BytesPerMi, UsageMi: 3, LimitMi: 64, Percentage: 4.6875,
+		},
+	}
+}
+
+// containerCPURows returns a fixed set of container cpu rows.
+func containerCPURows() []metrics.Row {
+	return []metrics.Row{
+		{
+			Namespace: "payments", Name: "payments-api-7c9d8f6b5-x2kqp:api", Resource: config.ResourceCPU, Mode: config.ModeContainers,
+			UsageMc: 412, LimitMc: 500, Percentage: 82.4,
+			Window: 15 * time.Second, Timestamp: sampleTime, Node: "node-pool-a-3", Owner: "Deployment/payments-api",
+		},
+		{
+			Namespace: "payments", Name: "payments-api-7c9d8f6b5-x2kqp:istio-proxy", Resource: config.ResourceCPU, Mode: config.ModeContainers,
+			UsageMc: 38, LimitMc: 200, Percentage: 19, Restarts: 1,
+			Window: 15 * time.Second, Timestamp: sampleTime, Node: "node-pool-a-3", Owner: "Deployment/payments-api",
+		},
+	}
+}
+
+// assertGolden compares got with the named golden file, rewriting it when -update is set.
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join(goldenDir, name+".golden")
+	if *update {
+		if err := os.MkdirAll(goldenDir, 0o755); err != nil {
+			t.Fatalf("failed to create golden dir: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o600); err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run go test ./pkg/output -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output does not match %s (run go test ./pkg/output -update to accept)\n--- got ---\n%s\n--- want ---\n%s", path, got, want)
+	}
+}
+
+// chargebackLines returns chargeback lines for a 30 day period, including an
+// unlabeled group with "odd, characters" that must be quoted in CSV output.
+func chargebackLines() []metrics.ChargebackLine {
+	return []metrics.ChargebackLine{
+		{Group: "<unlabeled>", CPUCoreHoursUsed: 12.25, MemoryGiBHoursUsed: 30.5},
+		{Group: "payments", CPUCoreHoursUsed: 410.4, CPUCoreHoursReserved: 720, MemoryGiBHoursUsed: 2950.125, MemoryGiBHoursReserved: 5760},
+		{Group: "search, ranking", CPUCoreHoursUsed: 1320.75, CPUCoreHoursReserved: 1440, MemoryGiBHoursUsed: 8102, MemoryGiBHoursReserved: 11520},
+	}
+}
+
+func TestFormatter_Golden(t *testing.T) {
+	podsMemory := config.Options{Mode: config.ModePods, Resource: config.ResourceMemory, Output: config.OutputTable, Threshold: 80}
+	containersCPU := config.Options{Mode: config.ModeContainers, Resource: config.ResourceCPU, Output: config.OutputTable, Threshold: 80}
+
+	with := func(opts config.Options, change func(*config.Options)) config.Options {
+		change(&opts)
+		return opts
+	}
+
+	tests := []struct {
+		name   string
+		render func(f *Formatter) error
+	}{
+		{
+			name:   "table_pods_memory",
+			render: func(f *Formatter) error { return f.PrintTable(podMemoryRows(), podsMemory) },
+		},
+		{
+			name: "table_pods_memory_no_headers",
+			render: func(f *Formatter) error {
+				return f.PrintTable(podMemoryRows(), with(podsMemory, func(o *config.Options) { o.NoHeaders = true }))
+			},
+		},
+		{
+			name:   "table_containers_cpu",
+			render: func(f *Formatter) error { return f.PrintTable(containerCPURows(), containersCPU) },
+		},
+		{
+			name: "table_containers_cpu_throttle",
+			render: func(f *Formatter) error {
+				rows := containerCPURows()
+				rows[0].SetThrottle(6000, 1470)
+				return f.PrintTable(rows, containersCPU)
+			},
+		},
+		{
+			name: "table_containers_cpu_samples",
+			render: func(f *Formatter) error {
+				rows := containerCPURows()
+				rows[0].Samples = &metrics.SampleStats{Count: 5, Min: 120, Avg: 310.4, P95: 610, Max: 610}
+				opts := containersCPU
+				opts.Samples = 5
+				return f.PrintTable(rows, opts)
+			},
+		},
+		{
+			name: "table_pods_memory_network",
+			render: func(f *Formatter) error {
+				rows := podMemoryRows()
+				rows[0].Network = &metrics.NetworkUsage{RxBytesPerSecond: 512, TxBytesPerSecond: 2048}
+				rows[1].Network = &metrics.NetworkUsage{RxBytesPerSecond: 3.5 * metrics.BytesPerMi, TxBytesPerSecond: 1.25 * 1024 * metrics.BytesPerMi}
+				return f.PrintTable(rows, with(podsMemory, func(o *config.Options) { o.ShowNetwork = true }))
+			},
+		},
+		{
+			name: "table_pods_memory_no_limit",
+			render: func(f *Formatter) error {
+				rows := podMemoryRows()[:2]
+				rows = append(rows, metrics.Row{Namespace: "default", Name: "batch-worker-5b6c7d8e9-k7j2m", Resource: config.ResourceMemory, UsageMi: 312.5})
+				return f.PrintTable(rows, podsMemory)
+			},
+		},
+		{
+			name: "table_pods_memory_default_limit",
+			render: func(f *Formatter) error {
+				rows := podMemoryRows()[:2]
+				rows = append(rows, metrics.Row{
+					Namespace: "default", Name: "batch-worker-5b6c7d8e9-k7j2m", Resource: config.ResourceMemory,
+					UsageMi: 911, LimitMi: 1024, Percentage: 88.96484375, DefaultMemoryLimit: true,
+				})
+				return f.PrintTable(rows, podsMemory)
+			},
+		},
+		{
+			name: "table_pods_memory_status",
+			render: func(f *Formatter) error {
+				rows := podMemoryRows()
+				rows[2].CrashLoop = true
+				rows[3].CrashLoop, rows[3].Windows = true, true
+				return f.PrintTable(rows, podsMemory)
+			},
+		},
+		{
+			name: "table_pods_all",
+			render: func(f *Formatter) error {
+				rows := podMemoryRows()[:3]
+				for i := range rows {
+					rows[i].Resource = config.ResourceAll
+				}
+				rows[0].UsageMc, rows[0].LimitMc = 12, 100
+				rows[1].UsageMc, rows[1].LimitMc, rows[1].Percentage = 1900, 2000, 95
+				rows[2].UsageMc = 230
+				return f.PrintTable(rows, with(podsMemory, func(o *config.Options) { o.Resource = config.ResourceAll }))
+			},
+		},
+		{
+			name: "table_pods_memory_forecast",
+			render: func(f *Formatter) error {
+				rows := podMemoryRows()[:3]
+				soon, later, days := 0.5, 30.0, 100.0
+				rows[0].HoursToLimit, rows[1].HoursToLimit, rows[2].HoursToLimit = &soon, &days, &later
+				return f.PrintTable(rows, with(podsMemory, func(o *config.Options) { o.Forecast = true }))
+			},
+		},
+		{
+			name: "wide_pods_memory",
+			render: func(f *Formatter) error {
+				return f.PrintTable(podMemoryRows(), with(podsMemory, func(o *config.Options) { o.Output = config.OutputWide }))
+			},
+		},
+		{
+			name: "wide_containers_cpu",
+			render: func(f *Formatter) error {
+				return f.PrintTable(containerCPURows(), with(containersCPU, func(o *config.Options) { o.Output = config.OutputWide }))
+			},
+		},
+		{
+			name: "json_pods_memory",
+			render: func(f *Formatter) error {
+				return f.PrintTable(podMemoryRows()[:2], with(podsMemory, func(o *config.Options) { o.Output = config.OutputJSON }))
+			},
+		},
+		{
+			name: "json_empty",
+			render: func(f *Formatter) error {
+				return f.PrintTable(nil, with(podsMemory, func(o *config.Options) { o.Output = config.OutputJSON }))
+			},
+		},
+		{
+			name: "table_pods_memory_score",
+			render: func(f *Formatter) error {
+				score, err := analyzer.CompileScore("row.percentage * (row.restarts + 1.0)")
+				if err != nil {
+					return err
+				}
+				rows := podMemoryRows()
+				for i := range rows {
+					rows[i].Score = rows[i].Percentage * float64(rows[i].Restarts+1)
+				}
+				return f.PrintTable(rows, with(podsMemory, func(o *config.Options) { o.ScoreExpr = score }))
+			},
+		},
+		{
+			name: "table_pods_memory_color",
+			render: func(f *Formatter) error {
+				rows := podMemoryRows()
+				for i, severity := range []metrics.Severity{metrics.SeverityCritical, metrics.SeverityWarning, metrics.SeverityWarning, metrics.SeverityOK} {
+					rows[i].Severity = severity
+				}
+				return f.PrintTable(rows, with(podsMemory, func(o *config.Options) { o.Color = true }))
+			},
+		},
+		{
+			name:   "table_empty",
+			render: func(f *Formatter) error { return f.PrintTable(nil, podsMemory) },
+		},
+		{
+			name: "wide_pods_by_node_memory",
+			render: func(f *Formatter) error {
+				rows := []metrics.Row{
+					{Name: "node-pool-a-1", Node: "node-pool-a-1", UsageMi: 47, LimitMi: 50, Percentage: 94, Restarts: 3},
+					{Name: "node-pool-a-2", Node: "node-pool-a-2", UsageMi: 559, LimitMi: 640, Percentage: 87.34375},
+				}
+				return f.PrintTable(rows, with(podsMemory, func(o *config.Options) { o.GroupBy, o.Output = config.GroupByNode, config.OutputWide }))
+			},
+		},
+		{
+			name: "table_pods_memory_contexts",
+			render: func(f *Formatter) error {
+				rows := podMemoryRows()[:2]
+				rows[0].Cluster, rows[1].Cluster = "prod-us", "prod-eu"
+				return f.PrintTable(rows, with(podsMemory, func(o *config.Options) { o.Contexts = []string{"prod-us", "prod-eu"} }))
+			},
+		},
+		{
+			name: "table_pods_memory_label_columns",
+			render: func(f *Formatter) error {
+				rows := podMemoryRows()[:2]
+				rows[0].Labels = map[string]string{"app.kubernetes.io/name": "node-exporter"}
+				rows[1].Labels = map[string]string{"app.kubernetes.io/name": "payments-db", "team": "payments"}
+				return f.PrintTable(rows, with(podsMemory, func(o *config.Options) { o.LabelColumns = []string{"app.kubernetes.io/name", "team"} }))
+			},
+		},
+		{
+			name: "wide_containers_by_name_memory",
+			render: func(f *Formatter) error {
+				rows := []metrics.Row{
+					{Namespace: "payments", Name: "app", Owner: "Deployment/api", UsageMi: 90, LimitMi: 100, Percentage: 90, Restarts: 3,
+						Replicas: &metrics.ReplicaStats{Count: 3, MeanPercentage: 50, P95Percentage: 90, MaxPercentage: 90}},
+					{Namespace: "payments", Name: "proxy", Owner: "Deployment/api", UsageMi: 10, LimitMi: 50, Percentage: 20,
+						Replicas: &metrics.ReplicaStats{Count: 1, MeanPercentage: 20, P95Percentage: 20, MaxPercentage: 20}},
+				}
+				return f.PrintTable(rows, with(podsMemory, func(o *config.Options) {
+					o.Mode, o.GroupBy, o.Output = config.ModeContainers, config.GroupByContainerName, config.OutputWide
+				}))
+			},
+		},
+		{
+			name: "groups_pods_memory",
+			render: func(f *Formatter) error {
+				rows := podMemoryRows()[:3]
+				groups := []metrics.Group{
+					{Key: "node-pool-a-1", Rows: rows[:1], Total: metrics.Row{UsageMi: 47, LimitMi: 50, Percentage: 94}},
+					{Key: "node-pool-a-2", Rows: rows[2:3], Total: metrics.Row{UsageMi: 559, LimitMi: 640, Percentage: 87.34375}},
+					{Key: "node-pool-b-1", Rows: rows[1:2], Total: metrics.Row{UsageMi: 1740, LimitMi: 2048, Percentage: 84.9609375}},
+				}
+				return f.PrintGroups(groups, podsMemory)
+			},
+		},
+		{
+			name: "cost_centers_pods_memory",
+			render: func(f *Formatter) error {
+				rows := podMemoryRows()
+				return f.PrintCostCenters([]metrics.Group{
+					{
+						Key: "cc-1042", Rows: rows[1:3], Namespaces: []string{"payments"}, Headroom: 389,
+						Total: metrics.Row{UsageMi: 2299, LimitMi: 2688, Percentage: 85.52827380952381},
+					},
+					{
+						Key: "<unassigned>", Rows: []metrics.Row{rows[0], rows[3]}, Namespaces: []string{"monitoring", "default"}, Headroom: 64,
+						Total: metrics.Row{UsageMi: 50, LimitMi: 114, Percentage: 43.859649122807014},
+					},
+				}, podsMemory)
+			},
+		},
+		{
+			name: "table_pods_memory_cost",
+			render: func(f *Formatter) error {
+				rows := podMemoryRows()
+				for i, cost := range []float64{0.0002, 0.0072, 0.0026, 0.0003} {
+					rows[i].Cost = cost
+				}
+				return f.PrintTable(rows, with(podsMemory, func(o *config.Options) { o.Pricing = &config.Pricing{} }))
+			},
+		},
+		{
+			name: "cost_rollup",
+			render: func(f *Formatter) error {
+				return f.PrintCostRollup([]metrics.CostRollup{
+					{Key: "payments", Rows: 2, Cost: 0.0098},
+					{Key: "<none>", Rows: 2, Cost: 0.0005},
+				}, with(podsMemory, func(o *config.Options) { o.CostBy = "app.kubernetes.io/team" }))
+			},
+		},
+		{
+			name: "compare_pods_memory",
+			render: func(f *Formatter) error {
+				return f.PrintComparison([]metrics.Comparison{
+					{Namespace: "web", Workload: "Deployment/worker", Right: &metrics.WorkloadUsage{Rows: 1, Usage: 10, Limit: 20, Percentage: 50}},
+					{Namespace: "web", Workload: "Deployment/api", Left: &metrics.WorkloadUsage{Rows: 2, Usage: 200, Limit: 400, Percentage: 50},
+						Right: &metrics.WorkloadUsage{Rows: 1, Usage: 300, Limit: 400, Percentage: 75}},
+					{Namespace: "web", Workload: "StatefulSet/cache", Left: &metrics.WorkloadUsage{Rows: 1, Usage: 92, Limit: 100, Percentage: 92},
+						Right: &metrics.WorkloadUsage{Rows: 1, Usage: 90, Limit: 100, Percentage: 90}},
+				}, []string{"prod-a", "prod-b"}, podsMemory)
+			},
+		},
+		{
+			name: "pools_memory",
+			render: func(f *Formatter) error {
+				return f.PrintPools([]metrics.NodePool{
+					{Name: "pool-b", Nodes: 1, Pods: 3, Allocatable: 28413.53515625, Requests: 2278, Limits: 4276, Unlimited: 1, Usage: 3843, GrowthPerDay: 350.5, HasGrowth: true},
+					{Name: "pool-a", Nodes: 3, Pods: 8, Allocatable: 39708.01171875, Requests: 1218, Limits: 2514, Unlimited: 1, Usage: 2493.203125, GrowthPerDay: -12, HasGrowth: true},
+					{Name: "<none>", Nodes: 1, Pods: 0, Allocatable: 0},
+				}, podsMemory)
+			},
+		},
+		{
+			name: "pending",
+			render: func(f *Formatter) error {
+				return f.PrintPending([]metrics.PendingPod{
+					{
+						Namespace: "default", Name: "reports-6f7a8b9c0-zz9xk", Owner: "Deployment/reports", RequestMc: 500, RequestMi: 6144,
+						FitsRightsized: 2, Verdict: "request-inflation", Message: "0/3 nodes are available: 3 Insufficient memory.",
+					},
+					{Namespace: "ml", Name: "trainer-0", Owner: "StatefulSet/trainer", RequestMc: 16000, RequestMi: 65536, Verdict: "capacity"},
+				}, podsMemory)
+			},
+		},
+		{
+			name: "nodes",
+			render: func(f *Formatter) error {
+				return f.PrintNodes([]metrics.NodeUsage{
+					{
+						NodeAllocation:  metrics.NodeAllocation{Name: "node-pool-a-1", AllocatableMc: 3920, AllocatableMi: 12288, RequestedMc: 2940, RequestedMi: 4096},
+						NodeFilesystems: metrics.NodeFilesystems{NodeFS: &metrics.FilesystemUsage{UsedBytes: 87, CapacityBytes: 100}, ImageFS: &metrics.FilesystemUsage{UsedBytes: 42, CapacityBytes: 100}},
+						Usage:           &metrics.NodeResourceUsage{UsedMc: 1312, UsedMi: 5120},
+					},
+					{
+						NodeAllocation: metrics.NodeAllocation{Name: "node-pool-b-1", Unschedulable: true, AllocatableMc: 7910, AllocatableMi: 28413, RequestedMc: 1200, RequestedMi: 2278},
+					},
+				}, config.Options{})
+			},
+		},
+		{
+			name: "nodes_density",
+			render: func(f *Formatter) error {
+				return f.PrintNodes([]metrics.NodeUsage{
+					{
+						NodeAllocation: metrics.NodeAllocation{Name: "node-pool-a-1", AllocatableMc: 3920, AllocatableMi: 12288, RequestedMc: 980, RequestedMi: 2048, AllocatablePods: 110, Pods: 104},
+						Usage:          &metrics.NodeResourceUsage{UsedMc: 846, UsedMi: 3072},
+					},
+					{
+						NodeAllocation: metrics.NodeAllocation{Name: "node-pool-b-1", AllocatableMc: 7910, AllocatableMi: 28413, RequestedMc: 1200, RequestedMi: 2278, AllocatablePods: 110, Pods: 3},
+						Usage:          &metrics.NodeResourceUsage{UsedMc: 2021, UsedMi: 8192},
+					},
+				}, config.Options{ShowDensity: true})
+			},
+		},
+		{
+			name: "nodes_schedulable",
+			render: func(f *Formatter) error {
+				return f.PrintNodes([]metrics.NodeUsage{
+					{NodeAllocation: metrics.NodeAllocation{Name: "node-pool-a-1", AllocatableMc: 3920, AllocatableMi: 12288, RequestedMc: 2940, RequestedMi: 4096}},
+					{NodeAllocation: metrics.NodeAllocation{Name: "node-pool-a-2", Taints: []string{"dedicated=gpu:NoSchedule"}, AllocatableMc: 3920, AllocatableMi: 12288, RequestedMc: 500, RequestedMi: 1024}},
+					{NodeAllocation: metrics.NodeAllocation{Name: "node-pool-b-1", Unschedulable: true, AllocatableMc: 7910, AllocatableMi: 28413, RequestedMc: 1200, RequestedMi: 2278}},
+				}, config.Options{SchedulableOnly: true})
+			},
+		},
+		{
+			name: "snapshots",
+			render: func(f *Formatter) error {
+				taken := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+				return f.PrintSnapshots([]metrics.Snapshot{
+					{ID: "20250601T120000Z-prod-us", TakenAt: taken, Cluster: "prod-us", Mode: config.ModePods, Rows: podMemoryRows()},
+					{ID: "20250602T120000Z-prod-us", TakenAt: taken.Add(24 * time.Hour), Cluster: "prod-us", Mode: config.ModeContainers},
+				}, config.Options{})
+			},
+		},
+		{
+			name: "checks",
+			render: func(f *Formatter) error {
+				return f.PrintChecks([]metrics.Check{
+					{Component: "APIService v1beta1.metrics.k8s.io", Status: metrics.CheckFailed, Detail: "APIService v1beta1.metrics.k8s.io is not available (MissingEndpoints: endpoints for service/metrics-server in \"kube-system\" have no addresses)"},
+					{Component: "Service kube-system/metrics-server", Status: metrics.CheckOK, Detail: "exists"},
+					{Component: "EndpointSlices of kube-system/metrics-server", Status: metrics.CheckFailed, Detail: "service kube-system/metrics-server backing APIService v1beta1.metrics.k8s.io has no ready endpoints, check the metrics-server pods"},
+					{Component: "PodMetrics in namespace payments", Status: metrics.CheckFailed, Detail: "cannot be listed: the server is currently unable to handle the request"},
+				}, config.Options{})
+			},
+		},
+		{
+			name: "plan",
+			render: func(f *Formatter) error {
+				return f.PrintPlan([]metrics.PlannedRequest{
+					{Server: "kubernetes", Method: "GET", Path: "/api/v1/namespaces", Requests: 1},
+					{Server: "kubernetes", Method: "GET", Path: "/api/v1/namespaces/{namespace}/pods", Params: "labelSelector=tier=web&limit=250", Requests: 1, Per: `page of 250 pods per namespace not matching --nx "^kube-system$"`},
+					{Server: "prometheus", Method: "POST", Path: "/api/v1/query", Params: "query=kube_pod_labels{}", Requests: 1},
+				}, "https://10.0.0.1:6443", config.Options{})
+			},
+		},
+		{
+			name: "refresh",
+			render: func(f *Formatter) error {
+				rows := podMemoryRows()
+				return f.PrintRefresh(metrics.Refresh{
+					Rows:    rows[:2],
+					Changes: []metrics.RowChange{{Delta: 12.5}, {Entered: true}},
+					Gone:    rows[2:],
+				}, config.Options{Mode: config.ModePods, Resource: config.ResourceMemory, Watch: 30 * time.Second})
+			},
+		},
+		{
+			name: "refresh_selectable",
+			render: func(f *Formatter) error {
+				rows := podMemoryRows()
+				return f.PrintSelectableRefresh(metrics.Refresh{
+					Rows:    rows[:2],
+					Changes: []metrics.RowChange{{Delta: 12.5}, {Entered: true}},
+					Gone:    rows[2:],
+				}, config.Options{Mode: config.ModePods, Resource: config.ResourceMemory, Watch: 30 * time.Second})
+			},
+		},
+		{
+			name: "api_impact",
+			render: func(f *Formatter) error {
+				return f.PrintAPIImpact(observability.APITraffic{
+					Endpoints: []observability.EndpointTraffic{
+						{Method: "GET", Path: "/api/v1/pods", Requests: 12, Bytes: 6 << 20, Duration: 2400 * time.Millisecond},
+						{Method: "GET", Path: "/apis/metrics.k8s.io/v1beta1/pods", Requests: 12, Bytes: 1 << 20, Duration: 900 * time.Millisecond, Throttled: 1},
+						{Method: "GET", Path: "/api/v1/nodes/{node}/proxy/stats/summary", Requests: 6, Bytes: 48 << 10, Duration: 300 * time.Millisecond, Failed: 1},
+					},
+					RateLimitWait: 120 * time.Millisecond,
+				}, config.Options{PageSize: 500})
+			},
+		},
+		{
+			name: "fragmentation",
+			render: func(f *Formatter) error {
+				return f.PrintFragmentation(metrics.Fragmentation{
+					Shape: metrics.PodShape{CPUMc: 500, MemoryMi: 1024},
+					Nodes: []metrics.NodeFragmentation{
+						{Name: "node-pool-a-1", FreeMc: 250, FreeMi: 6144, StrandedMc: 250, StrandedMi: 6144},
+						{Name: "node-pool-a-2", FreeMc: 3000, FreeMi: 2560, Fits: 2, StrandedMc: 2000, StrandedMi: 512},
+					},
+					AllocatableMc: 8000,
+					AllocatableMi: 16384,
+				}, config.Options{})
+			},
+		},
+		{
+			name: "sidecars",
+			render: func(f *Formatter) error {
+				return f.PrintSidecars([]metrics.SidecarUsage{
+					{
+						Namespace: "payments", Name: "payments-api-7c9d8f6b5-q4wvn", Containers: []string{"istio-proxy"},
+						Sidecars: metrics.ResourceTotals{MemoryMi: 58, MemoryLimitMi: 128, CPUMc: 21, CPULimitMc: 200},
+						Total:    metrics.ResourceTotals{MemoryMi: 270, MemoryLimitMi: 640, CPUMc: 116, CPULimitMc: 700},
+					},
+					{
+						Namespace: "web", Name: "frontend-0", Containers: []string{"linkerd-proxy", "vault-agent"},
+						Sidecars: metrics.ResourceTotals{MemoryMi: 40, CPUMc: 12},
+						Total:    metrics.ResourceTotals{MemoryMi: 400, MemoryLimitMi: 512, CPUMc: 120},
+					},
+				}, metrics.SidecarUsage{
+					Namespace: "TOTAL", Name: "2 pods",
+					Sidecars: metrics.ResourceTotals{MemoryMi: 98, MemoryLimitMi: 128, CPUMc: 33, CPULimitMc: 200},
+					Total:    metrics.ResourceTotals{MemoryMi: 670, MemoryLimitMi: 1152, CPUMc: 236, CPULimitMc: 700},
+				}, config.Options{})
+			},
+		},
+		{
+			name: "quotas",
+			render: func(f *Formatter) error {
+				return f.PrintQuotas([]metrics.QuotaUsage{
+					{Namespace: "payments", Quota: "compute", Resource: "limits.memory", Hard: 6144, Used: 6144, Usage: 5145},
+					{Namespace: "payments", Quota: "compute", Resource: "requests.cpu", Hard: 2000, Used: 1900, Usage: 2162},
+					{Namespace: "payments", Quota: "compute", Resource: "limits.cpu", Hard: 8000, Used: 4100, Usage: 2162},
+					{Namespace: "default", Quota: "long-running", Resource: "limits.memory", Hard: 1024, Used: 64, Scoped: true},
+				}, config.Options{Threshold: 90})
+			},
+		},
+		{
+			name: "waste",
+			render: func(f *Formatter) error {
+				return f.PrintWaste(metrics.WasteReport{
+					Pods: []metrics.Waste{
+						{Namespace: "payments", Name: "payments-db-0", Pods: 1, ReservedMi: 4096, UsedMi: 1200, UnusedMi: 2896, ReservedMc: 2000, UsedMc: 150, UnusedMc: 1850},
+						{Namespace: "web", Name: "frontend-0", Pods: 1, ReservedMi: 512, UsedMi: 600, ReservedMc: 500, UsedMc: 80, UnusedMc: 420},
+					},
+					Namespaces: []metrics.Waste{
+						{Namespace: "payments", Pods: 3, ReservedMi: 6144, UsedMi: 2100, UnusedMi: 4044, ReservedMc: 3000, UsedMc: 400, UnusedMc: 2600},
+						{Namespace: "web", Pods: 1, ReservedMi: 512, UsedMi: 600, ReservedMc: 500, UsedMc: 80, UnusedMc: 420},
+						{Namespace: "batch", Pods: 2, UsedMi: 300, UsedMc: 900},
+					},
+					Total: metrics.Waste{Namespace: "TOTAL", Pods: 6, ReservedMi: 6656, UsedMi: 3000, UnusedMi: 4044, ReservedMc: 3500, UsedMc: 1380, UnusedMc: 3020},
+				}, config.Options{WasteBasis: config.WasteBasisRequests})
+			},
+		},
+		{
+			name: "volumes",
+			render: func(f *Formatter) error {
+				return f.PrintVolumes([]metrics.VolumeUsage{
+					{Namespace: "payments", Claim: "data-payments-db-0", Pod: "payments-db-0", UsedBytes: 92 * 1024 * metrics.BytesPerMi, CapacityBytes: 100 * 1024 * metrics.BytesPerMi, Percentage: 92},
+					{Namespace: "monitoring", Claim: "prometheus-db", Pod: "prometheus-0", UsedBytes: 300 * metrics.BytesPerMi, CapacityBytes: 2 * 1024 * 1024 * metrics.BytesPerMi, Percentage: 0.0143},
+				}, config.Options{})
+			},
+		},
+		{
+			name: "violations",
+			render: func(f *Formatter) error {
+				return f.PrintViolations([]metrics.Violation{
+					{Rule: "memory-ceiling", Namespace: "payments", Name: "payments-db-0", Owner: "StatefulSet/payments-db", Detail: "memory usage at 94.0% of limit exceeds 90.0%"},
+					{Rule: "memory-limits", Namespace: "default", Name: "debug:shell", Detail: "missing memory limit"},
+					{Rule: "no-unlimited", Namespace: "default", Name: "debug:shell", Detail: "no resource limits set"},
+				}, podsMemory)
+			},
+		},
+		{
+			name: "chargeback_table",
+			render: func(f *Formatter) error {
+				return f.PrintChargeback(chargebackLines(), config.Options{Mode: config.ModeChargeback, Output: config.OutputTable})
+			},
+		},
+		{
+			name: "chargeback_csv",
+			render: func(f *Formatter) error {
+				return f.PrintChargeback(chargebackLines(), config.Options{Mode: config.ModeChargeback, Output: config.OutputCSV})
+			},
+		},
+		{
+			name: "export_labels",
+			render: func(f *Formatter) error {
+				api := metrics.Row{
+					Namespace: "payments", Name: "payments-api-7c9d8f6b5-x2kqp:api", Resource: config.ResourceAll, Mode: config.ModeContainers,
+					UsageBytes: 268435456, RequestBytes: 134217728, LimitBytes: 536870912, UsageMc: 412, RequestMc: 250, LimitMc: 500,
+					Node: "node-pool-a-3", Owner: "Deployment/payments-api", PriorityClass: "high-priority",
+					Labels: map[string]string{"app": "payments-api", "team": "payments"},
+				}
+				batch := metrics.Row{
+					Namespace: "batch", Name: "report-28911:report", Resource: config.ResourceAll, Mode: config.ModeContainers,
+					UsageBytes: 104857600, UsageMc: 900, Restarts: 3, CrashLoop: true,
+					Node: "node-pool-b-1", Owner: "Job/report-28911",
+					Labels: map[string]string{"job-name": "report-28911"},
+				}
+				return f.PrintExport([]metrics.Snapshot{
+					{TakenAt: sampleTime, Rows: []metrics.Row{api, batch}},
+					{TakenAt: sampleTime.Add(30 * time.Second), Rows: []metrics.Row{api}},
+				}, config.Options{Mode: config.ModeContainers, Output: config.OutputCSV, Export: true, ExportLabels: true})
+			},
+		},
+		{
+			name: "recommendations",
+			render: func(f *Formatter) error {
+				return f.PrintRecommendations([]metrics.Recommendation{
+					{
+						Namespace: "payments", Owner: "Deployment/payments-api", Container: "api", Pods: 3, UsedMi: 300.4, UsedMc: 150,
+						Current:    metrics.ResourceSettings{MemoryRequestMi: 512, MemoryLimitMi: 1024, CPURequestMc: 500, CPULimitMc: 1000},
+						Suggested:  metrics.ResourceSettings{MemoryRequestMi: 361, MemoryLimitMi: 451, CPURequestMc: 180, CPULimitMc: 225},
+						Disruption: &metrics.Disruption{Budget: "payments-api", Allowed: 0},
+					},
+					{
+						Namespace: "payments", Owner: "Deployment/payments-worker", Container: "worker", Pods: 4, UsedMi: 120, UsedMc: 80,
+						Current:    metrics.ResourceSettings{MemoryRequestMi: 256, CPURequestMc: 250},
+						Suggested:  metrics.ResourceSettings{MemoryRequestMi: 144, CPURequestMc: 96},
+						Disruption: &metrics.Disruption{Budget: "payments-worker", Allowed: 1},
+					},
+					{
+						Namespace: "payments", Owner: "Pod/debug", Container: "shell", Pods: 1, UsedMi: 1.2, UsedMc: 1,
+						Suggested:  metrics.ResourceSettings{MemoryRequestMi: 16, CPURequestMc: 10},
+						Disruption: &metrics.Disruption{},
+					},
+				}, config.Options{Mode: config.ModeRecommend})
+			},
+		},
+		{
+			name: "summary_pods_memory",
+			render: func(f *Formatter) error {
+				summary := metrics.Summary{
+					Count: 4, TotalUsage: 2349, TotalLimit: 2802, AvgPercentage: 67.748046875, MaxPercentage: 94,
+					Threshold: 80, OverThreshold: 3,
+					Buckets: []metrics.Bucket{
+						{Label: "0-25%", Count: 1}, {Label: "25-50%"}, {Label: "50-75%"},
+						{Label: "75-90%", Count: 2}, {Label: "90-100%", Count: 1}, {Label: ">=100%"},
+					},
+				}
+				return f.PrintSummary(summary, podsMemory)
+			},
+		},
+		{
+			name: "traces_pods_memory",
+			render: func(f *Formatter) error {
+				included := metrics.Trace{Namespace: "payments", Name: "payments-db-0", Node: "node-pool-b-1", QoS: "Burstable", Restarts: 2, Rows: podMemoryRows()[1:2]}
+				included.AddStep("listed", true, "pod found (phase Running)")
+				included.AddStep("limits", true, `container "postgres": usage 1740.0Mi of 2048.0Mi limit (counted), request 1024.0Mi, 2 restarts`)
+				included.AddStep("ranking", true, "rank 3 of 4")
+
+				excluded := metrics.Trace{Namespace: "kube-system", Name: "coredns-668d6bf9bc-4mgrq"}
+				excluded.AddStep("listed", true, "pod found (phase Running)")
+				excluded.AddStep("namespace-exclusion", false, `namespace "kube-system" matches --nx "^kube-system$"`)
+
+				return f.PrintTraces([]metrics.Trace{included, excluded}, podsMemory)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.render(NewWithWriter(&buf)); err != nil {
+				t.Fatalf("render failed: %v", err)
+			}
+			assertGolden(t, tt.name, buf.Bytes())
+		})
+	}
+}
+
+func TestFormatter_UnknownResource(t *testing.T) {
+	var buf bytes.Buffer
+	opts := config.Options{Mode: config.ModePods, Resource: config.ResourceKind("gpu")}
+	if err := NewWithWriter(&buf).PrintTable(podMemoryRows(), opts); err == nil {
+		t.Error("expected error for unknown resource")
+	}
+}
@@ -0,0 +1,124 @@
+// Package output - exec-based output plugins
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+const (
+	// PluginPrefix is prepended to the output format name to find the plugin executable on PATH
+	PluginPrefix = "kusage-output-"
+	// PluginAPIVersion is passed to plugins in KUSAGE_PLUGIN_API so they can detect protocol changes
+	PluginAPIVersion = "v1"
+)
+
+// pluginNamePattern restricts plugin names to safe executable name suffixes
+var pluginNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ValidPluginName reports whether name can be used to look up an output plugin.
+func ValidPluginName(name string) bool {
+	return pluginNamePattern.MatchString(name)
+}
+
+// Plugin renders results with an external kusage-output-<name> executable.
+// The plugin receives one JSON-encoded row per line (NDJSON) on stdin and
+// writes the report to stdout. The analysis context is passed in environment
+// variables: KUSAGE_PLUGIN_API, KUSAGE_MODE, KUSAGE_RESOURCE and KUSAGE_NO_HEADERS.
+type Plugin struct {
+	name   string
+	path   string
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// LookupPlugin finds the kusage-output-<name> executable on PATH.
+func LookupPlugin(name string) (*Plugin, error) {
+	if !ValidPluginName(name) {
+		return nil, fmt.Errorf("invalid output plugin name %q", name)
+	}
+
+	path, err := exec.LookPath(PluginPrefix + name)
+	if err != nil {
+		return nil, fmt.Errorf("output plugin %s%s not found on PATH: %w", PluginPrefix, name, err)
+	}
+
+	return &Plugin{
+		name:   name,
+		path:   path,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}, nil
+}
+
+// WithOutput sets the writers the plugin's stdout and stderr are connected to.
+func (p *Plugin) WithOutput(stdout, stderr io.Writer) *Plugin {
+	p.stdout = stdout
+	p.stderr = stderr
+	return p
+}
+
+// Path returns the resolved path of the plugin executable.
+func (p *Plugin) Path() string {
+	return p.path
+}
+
+// Render runs the plugin and streams rows to it. The plugin is killed when
+// ctx is canceled; a non-zero exit status is returned as an error.
+func (p *Plugin) Render(ctx context.Context, rows []metrics.Row, opts config.Options) error {
+	cmd := exec.CommandContext(ctx, p.path) // #nosec G204 - path resolved from a validated name on PATH
+	cmd.Env = append(os.Environ(),
+		"KUSAGE_PLUGIN_API="+PluginAPIVersion,
+		"KUSAGE_MODE="+string(opts.Mode),
+		"KUSAGE_RESOURCE="+string(opts.Resource),
+		"KUSAGE_NO_HEADERS="+strconv.FormatBool(opts.NoHeaders),
+	)
+	cmd.Stdout = p.stdout
+	cmd.Stderr = p.stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to connect to output plugin %s: %w", p.name, err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start output plugin %s: %w", p.name, err)
+	}
+
+	// A plugin that exits early breaks the pipe; its exit status is the
+	// more useful error, so the write error is only reported if it exited cleanly
+	writeErr := writeRows(stdin, rows)
+	if err := stdin.Close(); err != nil && writeErr == nil && !errors.Is(err, os.ErrClosed) {
+		writeErr = err
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("output plugin %s failed: %w", p.name, err)
+	}
+	if writeErr != nil {
+		return fmt.Errorf("failed to write rows to output plugin %s: %w", p.name, writeErr)
+	}
+
+	return nil
+}
+
+// writeRows encodes rows as newline-delimited JSON.
+func writeRows(w io.Writer, rows []metrics.Row) error {
+	encoder := json.NewEncoder(w)
+	for i := range rows {
+		if err := encoder.Encode(&rows[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+// installPlugin writes a shell script plugin to a temporary directory and
+// puts that directory first on PATH.
+func installPlugin(t *testing.T, name, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script plugins are not supported on windows")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, PluginPrefix+name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o700); err != nil { // #nosec G306 - test plugin must be executable
+		t.Fatalf("failed to write plugin: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestPlugin_Render(t *testing.T) {
+	installPlugin(t, "echo", `echo "api=$KUSAGE_PLUGIN_API mode=$KUSAGE_MODE resource=$KUSAGE_RESOURCE no_headers=$KUSAGE_NO_HEADERS"; cat`)
+
+	plugin, err := LookupPlugin("echo")
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	rows := podMemoryRows()
+	opts := config.Options{Mode: config.ModePods, Resource: config.ResourceMemory, NoHeaders: true}
+	if err := plugin.WithOutput(&stdout, &stderr).Render(context.Background(), rows, opts); err != nil {
+		t.Fatalf("render failed: %v (stderr: %s)", err, stderr.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if want := "api=v1 mode=pods resource=memory no_headers=true"; lines[0] != want {
+		t.Errorf("expected environment %q, got %q", want, lines[0])
+	}
+	if len(lines)-1 != len(rows) {
+		t.Fatalf("expected %d NDJSON lines, got %d", len(rows), len(lines)-1)
+	}
+	for i, line := range lines[1:] {
+		var row metrics.Row
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			t.Fatalf("line %d is not a JSON row: %v", i, err)
+		}
+		if row.Namespace != rows[i].Namespace || row.Name != rows[i].Name || row.Percentage != rows[i].Percentage {
+			t.Errorf("line %d: expected %s/%s, got %s/%s", i, rows[i].Namespace, rows[i].Name, row.Namespace, row.Name)
+		}
+	}
+}
+
+func TestPlugin_RenderFailure(t *testing.T) {
+	// The plugin exits without reading stdin, which must surface the exit status
+	installPlugin(t, "fail", `echo "boom" >&2; exit 3`)
+
+	plugin, err := LookupPlugin("fail")
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = plugin.WithOutput(&stdout, &stderr).Render(context.Background(), podMemoryRows(), config.Options{})
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Fatalf("expected exit status error, got %v", err)
+	}
+	if strings.TrimSpace(stderr.String()) != "boom" {
+		t.Errorf("expected plugin stderr to be forwarded, got %q", stderr.String())
+	}
+}
+
+func TestLookupPlugin_Errors(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	for _, name := range []string{"missing", "../etc", "", "Upper"} {
+		if _, err := LookupPlugin(name); err == nil {
+			t.Errorf("expected error for plugin %q", name)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Package prometheus provides a minimal client for the Prometheus HTTP query
+// API, sufficient for evaluating instant PromQL queries that return vectors.
+// It also works against API-compatible backends such as Thanos Querier,
+// Cortex/Mimir and VictoriaMetrics: multi-tenant stores are addressed with a
+// tenant header or, for VictoriaMetrics cluster, a tenant path in the base URL
+// (e.g. http://vmselect:8481/select/0/prometheus).
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxErrorBody limits how much of an unexpected response body is included in errors
+	maxErrorBody = 512
+	// TenantHeader is the header multi-tenant stores (Cortex, Mimir, Thanos
+	// receive, Loki) read the tenant from
+	TenantHeader = "X-Scope-OrgID"
+)
+
+// Sample is a single element of an instant vector.
+type Sample struct {
+	// Labels are the series labels, including __name__ when present
+	Labels map[string]string
+	// Value is the sample value
+	Value float64
+	// Timestamp is the evaluation time of the sample
+	Timestamp time.Time
+}
+
+// Querier evaluates instant PromQL queries. It is satisfied by *Client.
+type Querier interface {
+	Query(ctx context.Context, query string, ts time.Time) ([]Sample, error)
+}
+
+// Client evaluates PromQL queries against a Prometheus-compatible API.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	headers    http.Header
+	timeout    time.Duration
+}
+
+// New creates a client for the Prometheus server at baseURL
+// (e.g. http://prometheus.monitoring:9090).
+func New(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prometheus url %q: %w", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid prometheus url %q: scheme must be http or https", baseURL)
+	}
+
+	return &Client{
+		baseURL:    u,
+		httpClient: &http.Client{},
+		headers:    http.Header{},
+	}, nil
+}
+
+// WithHeader adds a header sent with every query, such as an Authorization
+// header required by a hosted or gateway-fronted store.
+func (c *Client) WithHeader(name, value string) *Client {
+	c.headers.Add(name, value)
+	return c
+}
+
+// WithTenant sets the tenant of multi-tenant stores through the X-Scope-OrgID header.
+func (c *Client) WithTenant(tenant string) *Client {
+	c.headers.Set(TenantHeader, tenant)
+	return c
+}
+
+// WithTimeout sets the evaluation timeout requested from the server, for long
+// range queries that exceed the server default (typically 2m).
+func (c *Client) WithTimeout(timeout time.Duration) *Client {
+	c.timeout = timeout
+	return c
+}
+
+// WithHTTPClient sets the HTTP client used for queries.
+func (c *Client) WithHTTPClient(httpClient *http.Client) *Client {
+	c.httpClient = httpClient
+	return c
+}
+
+// apiResponse is the envelope of every Prometheus API response
+type apiResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+}
+
+// queryData is the data of an instant query response
+type queryData struct {
+	ResultType string            `json:"resultType"`
+	Result     []json.RawMessage `json:"result"`
+}
+
+// vectorSample is a single element of a vector result
+type vectorSample struct {
+	Metric map[string]string `json:"metric"`
+	Value  [2]any            `json:"value"`
+}
+
+// Query evaluates an instant query at ts (now when zero) and returns the
+// resulting vector. Scalar results are returned as a single unlabeled sample.
+func (c *Client) Query(ctx context.Context, query string, ts time.Time) ([]Sample, error) {
+	params := url.Values{"query": {query}}
+	if !ts.IsZero() {
+		params.Set("time", strconv.FormatFloat(float64(ts.UnixMilli())/1000, 'f', 3, 64))
+	}
+	if c.timeout > 0 {
+		params.Set("timeout", c.timeout.String())
+	}
+
+	endpoint := c.baseURL.JoinPath("api", "v1", "query")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create prometheus request: %w", err)
+	}
+	for name, values := range c.headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("prometheus query failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prometheus response: %w", err)
+	}
+
+	var envelope apiResponse
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("unexpected prometheus response (HTTP %d): %s", resp.StatusCode, truncate(body))
+	}
+	if envelope.Status != "success" {
+		return nil, fmt.Errorf("prometheus query failed (%s): %s", envelope.ErrorType, envelope.Error)
+	}
+
+	var data queryData
+	if err := json.Unmarshal(envelope.Data, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode prometheus query data: %w", err)
+	}
+
+	return decodeResult(data)
+}
+
+// decodeResult converts vector and scalar results to samples.
+func decodeResult(data queryData) ([]Sample, error) {
+	switch data.ResultType {
+	case "vector":
+		samples := make([]Sample, 0, len(data.Result))
+		for _, raw := range data.Result {
+			var vs vectorSample
+			if err := json.Unmarshal(raw, &vs); err != nil {
+				return nil, fmt.Errorf("failed to decode prometheus sample: %w", err)
+			}
+			sample, err := decodeValue(vs.Value)
+			if err != nil {
+				return nil, err
+			}
+			sample.Labels = vs.Metric
+			samples = append(samples, sample)
+		}
+		return samples, nil
+	case "scalar":
+		var value [2]any
+		if len(data.Result) != 2 {
+			return nil, fmt.Errorf("unexpected scalar result with %d elements", len(data.Result))
+		}
+		for i := range value {
+			if err := json.Unmarshal(data.Result[i], &value[i]); err != nil {
+				return nil, fmt.Errorf("failed to decode prometheus scalar: %w", err)
+			}
+		}
+		sample, err := decodeValue(value)
+		if err != nil {
+			return nil, err
+		}
+		return []Sample{sample}, nil
+	default:
+		return nil, fmt.Errorf("unsupported prometheus result type %q (expected vector)", data.ResultType)
+	}
+}
+
+// decodeValue converts a [timestamp, "value"] pair to a sample.
+func decodeValue(pair [2]any) (Sample, error) {
+	ts, ok := pair[0].(float64)
+	if !ok {
+		return Sample{}, fmt.Errorf("invalid sample timestamp %v", pair[0])
+	}
+	text, ok := pair[1].(string)
+	if !ok {
+		return Sample{}, fmt.Errorf("invalid sample value %v", pair[1])
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return Sample{}, fmt.Errorf("invalid sample value %q: %w", text, err)
+	}
+	return Sample{Value: value, Timestamp: time.UnixMilli(int64(ts * 1000))}, nil
+}
+
+// truncate shortens a response body for inclusion in an error message.
+func truncate(body []byte) string {
+	if len(body) > maxErrorBody {
+		return string(body[:maxErrorBody]) + "..."
+	}
+	return string(body)
+}
+
+// LabelName converts a Kubernetes label key to the label name kube-state-metrics
+// exposes it under on kube_*_labels series (app.kubernetes.io/team becomes
+// label_app_kubernetes_io_team).
+func LabelName(key string) string {
+	var sb strings.Builder
+	sb.WriteString("label_")
+	for _, r := range key {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+			continue
+		}
+		sb.WriteByte('_')
+	}
+	return sb.String()
+}
+
+// QuoteValue quotes s for use as a label matcher value in PromQL.
+func QuoteValue(s string) string {
+	return strconv.Quote(s)
+}
@@ -0,0 +1,154 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_Query(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    []Sample
+		wantErr string
+	}{
+		{
+			name:   "vector",
+			status: http.StatusOK,
+			body: `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"label_team":"payments"},"value":[1700000000.5,"12.25"]},
+				{"metric":{},"value":[1700000000.5,"0.5"]}]}}`,
+			want: []Sample{
+				{Labels: map[string]string{"label_team": "payments"}, Value: 12.25},
+				{Labels: map[string]string{}, Value: 0.5},
+			},
+		},
+		{
+			name:   "scalar",
+			status: http.StatusOK,
+			body:   `{"status":"success","data":{"resultType":"scalar","result":[1700000000.5,"3"]}}`,
+			want:   []Sample{{Value: 3}},
+		},
+		{
+			name:    "api error",
+			status:  http.StatusBadRequest,
+			body:    `{"status":"error","errorType":"bad_data","error":"parse error at char 4"}`,
+			wantErr: "prometheus query failed (bad_data): parse error at char 4",
+		},
+		{
+			name:    "not prometheus",
+			status:  http.StatusBadGateway,
+			body:    `<html>bad gateway</html>`,
+			wantErr: "unexpected prometheus response (HTTP 502)",
+		},
+		{
+			name:    "matrix",
+			status:  http.StatusOK,
+			body:    `{"status":"success","data":{"resultType":"matrix","result":[]}}`,
+			wantErr: `unsupported prometheus result type "matrix"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotQuery, gotTime string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/prom/api/v1/query" {
+					t.Errorf("unexpected path %q", r.URL.Path)
+				}
+				gotQuery = r.FormValue("query")
+				gotTime = r.FormValue("time")
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client, err := New(server.URL + "/prom")
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+
+			samples, err := client.Query(context.Background(), "up", time.UnixMilli(1700000000500))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+
+			if gotQuery != "up" || gotTime != "1700000000.500" {
+				t.Errorf("unexpected request query=%q time=%q", gotQuery, gotTime)
+			}
+			if len(samples) != len(tt.want) {
+				t.Fatalf("expected %d samples, got %d", len(tt.want), len(samples))
+			}
+			for i, want := range tt.want {
+				got := samples[i]
+				if got.Labels["label_team"] != want.Labels["label_team"] || len(got.Labels) != len(want.Labels) {
+					t.Errorf("sample %d: expected labels %v, got %v", i, want.Labels, got.Labels)
+				}
+				if got.Value != want.Value {
+					t.Errorf("sample %d: expected value %v, got %v", i, want.Value, got.Value)
+				}
+				if !got.Timestamp.Equal(time.UnixMilli(1700000000500)) {
+					t.Errorf("sample %d: unexpected timestamp %v", i, got.Timestamp)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_QueryHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(TenantHeader); got != "team-a" {
+			t.Errorf("expected tenant team-a, got %q", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("expected authorization header, got %q", got)
+		}
+		if got := r.FormValue("timeout"); got != "5m0s" {
+			t.Errorf("expected timeout 5m0s, got %q", got)
+		}
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer server.Close()
+
+	client, err := New(server.URL)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	client.WithTenant("team-a").WithHeader("Authorization", "Bearer secret").WithTimeout(5 * time.Minute)
+
+	if _, err := client.Query(context.Background(), "up", time.Time{}); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+}
+
+func TestNew_InvalidURL(t *testing.T) {
+	for _, raw := range []string{"prometheus:9090", "ftp://prometheus", "http://[::1"} {
+		if _, err := New(raw); err == nil {
+			t.Errorf("New(%q) expected error", raw)
+		}
+	}
+}
+
+func TestLabelName(t *testing.T) {
+	tests := map[string]string{
+		"team":                   "label_team",
+		"app.kubernetes.io/team": "label_app_kubernetes_io_team",
+		"cost-center":            "label_cost_center",
+	}
+	for key, want := range tests {
+		if got := LabelName(key); got != want {
+			t.Errorf("LabelName(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// Package promusage reads pod usage from cAdvisor series in a Prometheus-compatible
+// backend, aggregated over a range. A single metrics-server sample reflects the
+// last scrape window only; averages, maxima or percentiles over an hour or a day
+// are more robust for comparing usage with limits.
+package promusage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/prometheus"
+)
+
+// step is the subquery resolution CPU rates are aggregated at
+const step = time.Minute
+
+// Source aggregates pod usage over a range from cAdvisor series.
+// It satisfies collector.MetricsSource.
+type Source struct {
+	querier prometheus.Querier
+	now     func() time.Time
+}
+
+// New creates a usage source using the provided querier.
+func New(querier prometheus.Querier) *Source {
+	return &Source{
+		querier: querier,
+		now:     time.Now,
+	}
+}
+
+// PodMetrics returns the usage of every container of the target namespace, or
+// of all namespaces with opts.AllNamespaces, aggregated with opts.Aggregation
+// over opts.UsageRange ending now. Pods are ordered by namespace and name.
+func (s *Source) PodMetrics(ctx context.Context, opts config.Options) ([]metrics.PodMetrics, error) {
+	selector := containerSelector(opts)
+
+	now := s.now()
+	var memory, cpu, periods, throttled, latest, growth []prometheus.Sample
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		samples, err := s.querier.Query(gctx, MemoryQuery(selector, opts.UsageRange, opts.Aggregation), now)
+		if err != nil {
+			return fmt.Errorf("failed to query memory usage: %w", err)
+		}
+		memory = samples
+		return nil
+	})
+	g.Go(func() error {
+		samples, err := s.querier.Query(gctx, CPUQuery(selector, opts.UsageRange, opts.Aggregation), now)
+		if err != nil {
+			return fmt.Errorf("failed to query cpu usage: %w", err)
+		}
+		cpu = samples
+		return nil
+	})
+	g.Go(func() error {
+		samples, err := s.querier.Query(gctx, PeriodsQuery(selector, "container_cpu_cfs_periods_total", opts.UsageRange), now)
+		if err != nil {
+			return fmt.Errorf("failed to query cpu periods: %w", err)
+		}
+		periods = samples
+		return nil
+	})
+	g.Go(func() error {
+		samples, err := s.querier.Query(gctx, PeriodsQuery(selector, "container_cpu_cfs_throttled_periods_total", opts.UsageRange), now)
+		if err != nil {
+			return fmt.Errorf("failed to query cpu throttled periods: %w", err)
+		}
+		throttled = samples
+		return nil
+	})
+	if opts.Forecast {
+		g.Go(func() error {
+			samples, err := s.querier.Query(gctx, MemoryLatestQuery(selector), now)
+			if err != nil {
+				return fmt.Errorf("failed to query latest memory usage: %w", err)
+			}
+			latest = samples
+			return nil
+		})
+		g.Go(func() error {
+			samples, err := s.querier.Query(gctx, MemoryGrowthQuery(selector, opts.UsageRange), now)
+			if err != nil {
+				return fmt.Errorf("failed to query memory growth: %w", err)
+			}
+			growth = samples
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// Index containers by namespace/pod/container; samples of both queries merge
+	type entry struct {
+		pod       *metrics.PodMetrics
+		container *metrics.ContainerMetrics
+	}
+	pods := make(map[string]*metrics.PodMetrics)
+	containers := make(map[string]entry)
+	container := func(l map[string]string) *metrics.ContainerMetrics {
+		podKey := l["namespace"] + "/" + l["pod"]
+		pod, ok := pods[podKey]
+		if !ok {
+			pod = &metrics.PodMetrics{
+				ObjectMeta: metav1.ObjectMeta{Namespace: l["namespace"], Name: l["pod"]},
+				Timestamp:  metav1.NewTime(now),
+				Window:     metav1.Duration{Duration: opts.UsageRange},
+			}
+			pods[podKey] = pod
+		}
+		key := podKey + "/" + l["container"]
+		e, ok := containers[key]
+		if !ok {
+			e = entry{pod: pod, container: &metrics.ContainerMetrics{Name: l["container"]}}
+			containers[key] = e
+		}
+		return e.container
+	}
+
+	for _, sample := range memory {
+		container(sample.Labels).MemoryBytes = int64(sample.Value)
+	}
+	for _, sample := range cpu {
+		container(sample.Labels).CPUMillicores = int64(math.Round(sample.Value * 1000))
+	}
+	for _, sample := range periods {
+		container(sample.Labels).CPUPeriods = int64(math.Round(sample.Value))
+	}
+	for _, sample := range throttled {
+		container(sample.Labels).CPUThrottledPeriods = int64(math.Round(sample.Value))
+	}
+	for _, sample := range latest {
+		container(sample.Labels).MemoryLatestBytes = int64(sample.Value)
+	}
+	for _, sample := range growth {
+		container(sample.Labels).MemoryGrowthBytesPerSecond = sample.Value
+	}
+
+	// Attach containers in name order so results are stable
+	keys := make([]string, 0, len(containers))
+	for key := range containers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		e := containers[key]
+		e.pod.Containers = append(e.pod.Containers, *e.container)
+	}
+
+	result := make([]metrics.PodMetrics, 0, len(pods))
+	for _, pm := range pods {
+		result = append(result, *pm)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// Plan returns the instant queries PodMetrics issues for opts, for dry runs.
+func (s *Source) Plan(opts config.Options) []metrics.PlannedRequest {
+	selector := containerSelector(opts)
+	queries := []string{
+		MemoryQuery(selector, opts.UsageRange, opts.Aggregation),
+		CPUQuery(selector, opts.UsageRange, opts.Aggregation),
+		PeriodsQuery(selector, "container_cpu_cfs_periods_total", opts.UsageRange),
+		PeriodsQuery(selector, "container_cpu_cfs_throttled_periods_total", opts.UsageRange),
+	}
+	if opts.Forecast {
+		queries = append(queries, MemoryLatestQuery(selector), MemoryGrowthQuery(selector, opts.UsageRange))
+	}
+
+	plan := make([]metrics.PlannedRequest, 0, len(queries))
+	for _, query := range queries {
+		plan = append(plan, metrics.PlannedRequest{Server: "prometheus", Method: "POST", Path: "/api/v1/query", Params: "query=" + query, Requests: 1})
+	}
+	return plan
+}
+
+// containerSelector matches the series of the containers in the target
+// namespace, or in all namespaces with opts.AllNamespaces.
+func containerSelector(opts config.Options) string {
+	selector := `container!="", container!="POD", pod!=""`
+	if !opts.AllNamespaces && opts.Namespace != "" {
+		selector += ", namespace=" + prometheus.QuoteValue(opts.Namespace)
+	}
+	return selector
+}
+
+// MemoryQuery returns a query aggregating the working set of every container
+// matching selector over period, in bytes.
+func MemoryQuery(selector string, period time.Duration, aggregation config.Aggregation) string {
+	series := fmt.Sprintf(`container_memory_working_set_bytes{%s}[%ds]`, selector, seconds(period))
+	return fmt.Sprintf(`max by (namespace, pod, container) (%s)`, overTime(series, aggregation))
+}
+
+// CPUQuery returns a query aggregating the CPU usage rate of every container
+// matching selector over period, in cores.
+func CPUQuery(selector string, period time.Duration, aggregation config.Aggregation) string {
+	series := fmt.Sprintf(`rate(container_cpu_usage_seconds_total{%s}[5m])[%ds:%ds]`, selector, seconds(period), seconds(step))
+	return fmt.Sprintf(`max by (namespace, pod, container) (%s)`, overTime(series, aggregation))
+}
+
+// MemoryLatestQuery returns a query for the current working set of every
+// container matching selector, in bytes.
+func MemoryLatestQuery(selector string) string {
+	return fmt.Sprintf(`max by (namespace, pod, container) (container_memory_working_set_bytes{%s})`, selector)
+}
+
+// MemoryGrowthQuery returns a query for the growth rate of the working set of
+// every container matching selector, from a linear regression over period, in
+// bytes per second.
+func MemoryGrowthQuery(selector string, period time.Duration) string {
+	return fmt.Sprintf(`max by (namespace, pod, container) (deriv(container_memory_working_set_bytes{%s}[%ds]))`, selector, seconds(period))
+}
+
+// PeriodsQuery returns a query for the increase of a CFS period counter of
+// every container matching selector over period. The counters are only
+// exported for containers with a CPU limit.
+func PeriodsQuery(selector, metric string, period time.Duration) string {
+	return fmt.Sprintf(`max by (namespace, pod, container) (increase(%s{%s}[%ds]))`, metric, selector, seconds(period))
+}
+
+// overTime applies the aggregation to a range vector expression.
+func overTime(series string, aggregation config.Aggregation) string {
+	switch aggregation {
+	case config.AggregationMax:
+		return fmt.Sprintf(`max_over_time(%s)`, series)
+	case config.AggregationP95:
+		return fmt.Sprintf(`quantile_over_time(0.95, %s)`, series)
+	default:
+		return fmt.Sprintf(`avg_over_time(%s)`, series)
+	}
+}
+
+// seconds returns d in whole seconds, at least one.
+func seconds(d time.Duration) int64 {
+	return max(int64(d.Seconds()), 1)
+}
@@ -0,0 +1,153 @@
+package promusage
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/prometheus"
+)
+
+// fakeQuerier answers queries by the longest part of the query they contain,
+// such as the metric they select
+type fakeQuerier struct {
+	mutex   sync.Mutex
+	queries []string
+	results map[string][]prometheus.Sample
+}
+
+func (f *fakeQuerier) Query(_ context.Context, query string, _ time.Time) ([]prometheus.Sample, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.queries = append(f.queries, query)
+	var match string
+	for part := range f.results {
+		if strings.Contains(query, part) && len(part) > len(match) {
+			match = part
+		}
+	}
+	return f.results[match], nil
+}
+
+// sample returns a sample of a container in the web namespace
+func sample(pod, container string, value float64) prometheus.Sample {
+	return prometheus.Sample{Labels: map[string]string{"namespace": "web", "pod": pod, "container": container}, Value: value}
+}
+
+func TestSource_PodMetrics(t *testing.T) {
+	querier := &fakeQuerier{results: map[string][]prometheus.Sample{
+		"container_memory_working_set_bytes": {
+			sample("api-b", "app", 256*1024*1024),
+			sample("api-a", "proxy", 32*1024*1024),
+			sample("api-a", "app", 300*1024*1024),
+		},
+		"container_cpu_usage_seconds_total": {
+			sample("api-a", "app", 0.1234),
+		},
+		"container_cpu_cfs_periods_total": {
+			sample("api-a", "app", 864000),
+		},
+		"container_cpu_cfs_throttled_periods_total": {
+			sample("api-a", "app", 43200.4),
+		},
+	}}
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	source := New(querier)
+	source.now = func() time.Time { return now }
+
+	opts := config.Options{Namespace: "web", UsageRange: 24 * time.Hour, Aggregation: config.AggregationP95}
+	pods, err := source.PodMetrics(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("PodMetrics failed: %v", err)
+	}
+
+	for _, query := range querier.queries {
+		aggregated := strings.Contains(query, "quantile_over_time(0.95, ") || strings.Contains(query, "increase(")
+		if !strings.Contains(query, `namespace="web"`) || !aggregated || !strings.Contains(query, "[86400s") {
+			t.Errorf("unexpected query %s", query)
+		}
+	}
+
+	if len(pods) != 2 || pods[0].Name != "api-a" || pods[1].Name != "api-b" {
+		t.Fatalf("unexpected pods %+v", pods)
+	}
+	api := pods[0]
+	if api.Window.Duration != 24*time.Hour || !api.Timestamp.Time.Equal(now) {
+		t.Errorf("unexpected window/timestamp %v/%v", api.Window.Duration, api.Timestamp)
+	}
+	if len(api.Containers) != 2 || api.Containers[0].Name != "app" || api.Containers[1].Name != "proxy" {
+		t.Fatalf("unexpected containers %+v", api.Containers)
+	}
+	if c := api.Containers[0]; c.MemoryBytes != 300*1024*1024 || c.CPUMillicores != 123 || c.CPUPeriods != 864000 || c.CPUThrottledPeriods != 43200 {
+		t.Errorf("unexpected app usage %+v", c)
+	}
+}
+
+func TestSource_PodMetricsForecast(t *testing.T) {
+	querier := &fakeQuerier{results: map[string][]prometheus.Sample{
+		"container_memory_working_set_bytes": {
+			sample("api-a", "app", 300*1024*1024),
+		},
+		") (container_memory_working_set_bytes": {
+			sample("api-a", "app", 400*1024*1024),
+		},
+		"deriv(container_memory_working_set_bytes": {
+			sample("api-a", "app", 2048),
+		},
+	}}
+	source := New(querier)
+
+	opts := config.Options{Namespace: "web", UsageRange: 6 * time.Hour, Aggregation: config.AggregationAvg}
+	if _, err := source.PodMetrics(context.Background(), opts); err != nil {
+		t.Fatalf("PodMetrics failed: %v", err)
+	}
+	if len(querier.queries) != 4 {
+		t.Errorf("expected no forecast queries without --forecast, got %d queries", len(querier.queries))
+	}
+
+	opts.Forecast = true
+	pods, err := source.PodMetrics(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("PodMetrics failed: %v", err)
+	}
+	if len(pods) != 1 || len(pods[0].Containers) != 1 {
+		t.Fatalf("unexpected pods %+v", pods)
+	}
+	c := pods[0].Containers[0]
+	if c.MemoryBytes != 300*1024*1024 || c.MemoryLatestBytes != 400*1024*1024 || c.MemoryGrowthBytesPerSecond != 2048 {
+		t.Errorf("unexpected forecast inputs %+v", c)
+	}
+	if got, want := MemoryGrowthQuery(`pod!=""`, 6*time.Hour), `max by (namespace, pod, container) (deriv(container_memory_working_set_bytes{pod!=""}[21600s]))`; got != want {
+		t.Errorf("growth query:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	tests := []struct {
+		aggregation config.Aggregation
+		memory      string
+		cpu         string
+	}{
+		{
+			aggregation: config.AggregationAvg,
+			memory:      `max by (namespace, pod, container) (avg_over_time(container_memory_working_set_bytes{pod!=""}[3600s]))`,
+			cpu:         `max by (namespace, pod, container) (avg_over_time(rate(container_cpu_usage_seconds_total{pod!=""}[5m])[3600s:60s]))`,
+		},
+		{
+			aggregation: config.AggregationMax,
+			memory:      `max by (namespace, pod, container) (max_over_time(container_memory_working_set_bytes{pod!=""}[3600s]))`,
+			cpu:         `max by (namespace, pod, container) (max_over_time(rate(container_cpu_usage_seconds_total{pod!=""}[5m])[3600s:60s]))`,
+		},
+	}
+	for _, tt := range tests {
+		if got := MemoryQuery(`pod!=""`, time.Hour, tt.aggregation); got != tt.memory {
+			t.Errorf("%s memory query:\n got %s\nwant %s", tt.aggregation, got, tt.memory)
+		}
+		if got := CPUQuery(`pod!=""`, time.Hour, tt.aggregation); got != tt.cpu {
+			t.Errorf("%s cpu query:\n got %s\nwant %s", tt.aggregation, got, tt.cpu)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package resilience
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"runtime"
@@ -20,6 +21,9 @@ const (
 	StateOpen
 )
 
+// ErrOpen is returned, wrapped, by Execute while the circuit is open
+var ErrOpen = errors.New("circuit breaker is open")
+
 // CircuitBreaker implements the circuit breaker pattern for fault tolerance
 // Reference: https://microservices.io/patterns/reliability/circuit-breaker.html
 type CircuitBreaker struct {
@@ -30,6 +34,7 @@ type CircuitBreaker struct {
 	failureCount int32
 	lastFailure  int64 // Unix timestamp
 	successCount int32
+	onOpen       func(name string)
 }
 
 // NewCircuitBreaker creates a new circuit breaker with specified parameters
@@ -41,10 +46,16 @@ func NewCircuitBreaker(name string, maxFailures int32, timeout time.Duration) *C
 	}
 }
 
+// WithOnOpen registers a callback invoked each time the circuit opens
+func (cb *CircuitBreaker) WithOnOpen(fn func(name string)) *CircuitBreaker {
+	cb.onOpen = fn
+	return cb
+}
+
 // Execute runs the provided function with circuit breaker protection
 func (cb *CircuitBreaker) Execute(_ context.Context, fn func() error) error {
 	if !cb.canExecute() {
-		return fmt.Errorf("circuit breaker %s is open", cb.name)
+		return fmt.Errorf("%s: %w", cb.name, ErrOpen)
 	}
 
 	// Execute the function
@@ -89,8 +100,11 @@ func (cb *CircuitBreaker) recordFailure() {
 	atomic.StoreInt64(&cb.lastFailure, time.Now().Unix())
 
 	if failures >= cb.maxFailures {
-		atomic.StoreInt32(&cb.currentState, int32(StateOpen))
+		previous := atomic.SwapInt32(&cb.currentState, int32(StateOpen))
 		atomic.StoreInt32(&cb.successCount, 0)
+		if previous != int32(StateOpen) && cb.onOpen != nil {
+			cb.onOpen(cb.name)
+		}
 	}
 }
 
@@ -211,6 +225,10 @@ type RetryConfig struct {
 	InitialDelay  time.Duration
 	MaxDelay      time.Duration
 	BackoffFactor float64
+	// Retryable reports whether an error is worth retrying (default: all errors)
+	Retryable func(err error) bool
+	// OnRetry is called before each retry with the attempt that failed
+	OnRetry func(attempt int, err error)
 }
 
 // DefaultRetryConfig provides sensible defaults for Kubernetes API operations
@@ -239,11 +257,20 @@ func ExecuteWithRetry(ctx context.Context, config RetryConfig, fn func() error)
 			return ctx.Err()
 		}
 
+		// Permanent errors are returned as is
+		if config.Retryable != nil && !config.Retryable(lastErr) {
+			return lastErr
+		}
+
 		// Don't sleep after the last attempt
 		if attempt == config.MaxAttempts {
 			break
 		}
 
+		if config.OnRetry != nil {
+			config.OnRetry(attempt, lastErr)
+		}
+
 		// Exponential backoff with jitter
 		select {
 		case <-time.After(delay):
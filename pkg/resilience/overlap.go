@@ -0,0 +1,45 @@
+// Package resilience - overlap protection for scheduled runs
+package resilience
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// OverlapGuard runs at most one scheduled run at a time, skipping those
+// scheduled while another is still running, so runs slower than their
+// interval do not pile up load on the API server.
+type OverlapGuard struct {
+	running atomic.Bool
+	wg      sync.WaitGroup
+	skip    func()
+}
+
+// NewOverlapGuard creates a guard calling skip for every run it skips, e.g.
+// to count skipped runs.
+func NewOverlapGuard(skip func()) *OverlapGuard {
+	return &OverlapGuard{skip: skip}
+}
+
+// Go starts run in the background, or calls skip when the previous run is
+// still running. It reports whether run was started.
+func (g *OverlapGuard) Go(run func()) bool {
+	if !g.running.CompareAndSwap(false, true) {
+		if g.skip != nil {
+			g.skip()
+		}
+		return false
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer g.running.Store(false)
+		run()
+	}()
+	return true
+}
+
+// Wait waits for the run in progress, if any, to finish.
+func (g *OverlapGuard) Wait() {
+	g.wg.Wait()
+}
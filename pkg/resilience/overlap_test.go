@@ -0,0 +1,30 @@
+package resilience
+
+import (
+	"testing"
+)
+
+func TestOverlapGuard(t *testing.T) {
+	skipped := 0
+	guard := NewOverlapGuard(func() { skipped++ })
+
+	release := make(chan struct{})
+	if !guard.Go(func() { <-release }) {
+		t.Fatal("expected the first run to start")
+	}
+	if guard.Go(func() { t.Error("expected an overlapping run not to start") }) {
+		t.Error("expected an overlapping run to be skipped")
+	}
+	if skipped != 1 {
+		t.Errorf("expected 1 skip, got %d", skipped)
+	}
+
+	close(release)
+	guard.Wait()
+	ran := make(chan struct{})
+	if !guard.Go(func() { close(ran) }) {
+		t.Error("expected a run to start after the previous one finished")
+	}
+	<-ran
+	guard.Wait()
+}
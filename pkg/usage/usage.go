@@ -0,0 +1,353 @@
+// Package usage provides the supported Go API for embedding kusage in other tools.
+// It encapsulates Kubernetes client setup, data collection, analysis and filtering
+// behind a small set of functions, so callers do not need to wire the collector,
+// analyzer and output packages themselves.
+package usage
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/analyzer"
+	"github.com/mchmarny/kusage/pkg/cadvisor"
+	"github.com/mchmarny/kusage/pkg/collector"
+	"github.com/mchmarny/kusage/pkg/config"
+	"github.com/mchmarny/kusage/pkg/datadog"
+	"github.com/mchmarny/kusage/pkg/k8s"
+	"github.com/mchmarny/kusage/pkg/kubestate"
+	"github.com/mchmarny/kusage/pkg/metrics"
+	"github.com/mchmarny/kusage/pkg/prometheus"
+	"github.com/mchmarny/kusage/pkg/promusage"
+)
+
+// Options configures a library invocation: the pods or containers to collect
+// and how the rows are ranked. It is independent of the CLI flags, which
+// configure output, caching and the other commands the library does not run.
+type Options struct {
+	// Namespace is the namespace to analyze, ignored with AllNamespaces
+	Namespace string
+	// AllNamespaces analyzes every namespace
+	AllNamespaces bool
+	// LabelSelector is a Kubernetes label selector of the pods to analyze
+	LabelSelector string
+	// ExcludeNamespaces drops the namespaces it matches
+	ExcludeNamespaces *regexp.Regexp
+	// ExcludeLabels drops the pods with a key=value label it matches
+	ExcludeLabels *regexp.Regexp
+	// Mode is ModePods or ModeContainers
+	Mode Mode
+	// Resource is the resource the rows report
+	Resource Resource
+	// Sort is the key rows are ranked by
+	Sort SortKey
+	// TopN is the number of rows Run returns; the summary covers all rows
+	TopN int
+	// Threshold is the usage percentage counted as over threshold in the summary
+	Threshold float64
+	// IncludeNoLimit also returns pods and containers without a limit
+	IncludeNoLimit bool
+	// IncludeCompleted also returns pods that ran to completion (phase Succeeded)
+	IncludeCompleted bool
+	// ExcludeCrashLoop drops pods with a container waiting in CrashLoopBackOff
+	// instead of marking their rows
+	ExcludeCrashLoop bool
+	// SampleFraction analyzes only this fraction of the pods, chosen by a hash
+	// of their namespace and name so runs sample the same pods; 0 or 1 analyze all
+	SampleFraction float64
+	// ScoreExpr is a CEL expression over the row fields computing Row.Score
+	// (e.g. pct * (restarts + 1)); rows are ranked by it with SortByScore
+	ScoreExpr string
+	// Filter is a boolean CEL expression over the row fields selecting the
+	// rows to return (e.g. pct > 75 && namespace != "kube-system")
+	Filter string
+	// LimitsSource is where pod limits and requests are read from (default: the Kubernetes API)
+	LimitsSource LimitsSource
+	// Source is where pod usage is read from (default: metrics-server)
+	Source UsageSource
+	// UsageRange is the period usage is aggregated over with the Prometheus and Datadog sources
+	UsageRange time.Duration
+	// PrometheusURL and PrometheusHeaders configure the Prometheus-compatible
+	// query API read by the Prometheus and kube-state-metrics sources; the
+	// Datadog source reads its keys from DD_API_KEY, DD_APP_KEY and DD_SITE
+	PrometheusURL     string
+	PrometheusHeaders map[string]string
+	// Timeout bounds the whole collection, across all pages and retries
+	Timeout time.Duration
+	// PageSize is the number of items fetched per list call (default 500)
+	PageSize int64
+	// Context, Kubeconfig and Cluster select the cluster as the kubectl flags
+	// of the same names do; empty values use the current context of the
+	// default kubeconfig, or the in-cluster configuration
+	Context    string
+	Kubeconfig string
+	Cluster    string
+}
+
+// Mode is the granularity of the rows.
+type Mode = config.Mode
+
+const (
+	// ModePods reports a row per pod
+	ModePods = config.ModePods
+	// ModeContainers reports a row per container
+	ModeContainers = config.ModeContainers
+)
+
+// Resource is the resource the rows report.
+type Resource = config.ResourceKind
+
+const (
+	// ResourceMemory reports memory usage against memory limits
+	ResourceMemory = config.ResourceMemory
+	// ResourceCPU reports CPU usage against CPU limits
+	ResourceCPU = config.ResourceCPU
+	// ResourceAll reports both, ranked by the higher percentage
+	ResourceAll = config.ResourceAll
+)
+
+// SortKey is the key rows are ranked by.
+type SortKey = config.SortKey
+
+const (
+	// SortByPercentage ranks rows by usage relative to the limit
+	SortByPercentage = config.SortByPercentage
+	// SortByUsage ranks rows by absolute usage
+	SortByUsage = config.SortByUsage
+	// SortByLimit ranks rows by limit
+	SortByLimit = config.SortByLimit
+	// SortByRestarts ranks rows by container restarts
+	SortByRestarts = config.SortByRestarts
+	// SortByScore ranks rows by the result of ScoreExpr
+	SortByScore = config.SortByScore
+)
+
+// LimitsSource is where pod limits and requests are read from.
+type LimitsSource = config.LimitsSource
+
+const (
+	// LimitsSourceAPI lists pods through the Kubernetes API
+	LimitsSourceAPI = config.LimitsSourceAPI
+	// LimitsSourceKubeStateMetrics reads kube-state-metrics series from Prometheus
+	LimitsSourceKubeStateMetrics = config.LimitsSourceKubeStateMetrics
+)
+
+// UsageSource is where pod usage is read from.
+type UsageSource = config.UsageSource
+
+const (
+	// UsageSourceMetricsServer reads the current usage from the metrics API
+	UsageSourceMetricsServer = config.UsageSourceMetricsServer
+	// UsageSourcePrometheus aggregates usage over UsageRange from Prometheus
+	UsageSourcePrometheus = config.UsageSourcePrometheus
+	// UsageSourceDatadog aggregates usage over UsageRange from Datadog
+	UsageSourceDatadog = config.UsageSourceDatadog
+	// UsageSourceCAdvisor reads usage from the kubelet cAdvisor endpoints
+	UsageSourceCAdvisor = config.UsageSourceCAdvisor
+)
+
+// Row is a single ranked result row.
+type Row = metrics.Row
+
+// Summary contains aggregate statistics over the complete result set.
+type Summary = metrics.Summary
+
+// Warning is a degradation of a collection that did not fail it, such as
+// rows missing after an abandoned page.
+type Warning = metrics.Warning
+
+// Collector is the data source used by RunWithCollector. It is passed the
+// collector configuration Options converts to. The Kubernetes-backed
+// *collector.Collector satisfies this interface, and tests can supply canned
+// data through their own implementation.
+type Collector interface {
+	Collect(ctx context.Context, opts config.Options) ([]metrics.Row, error)
+}
+
+// DefaultOptions returns options matching the CLI defaults:
+// pod-level memory analysis in the "default" namespace, sorted by percentage.
+func DefaultOptions() Options {
+	return Options{
+		Namespace:  "default",
+		Mode:       ModePods,
+		Resource:   ResourceMemory,
+		Sort:       SortByPercentage,
+		TopN:       20,
+		Threshold:  80,
+		Timeout:    30 * time.Second,
+		PageSize:   500,
+		UsageRange: time.Hour,
+	}
+}
+
+// config returns the collector and analyzer configuration of o, or an
+// error when o is invalid.
+func (o Options) config() (config.Options, error) {
+	if o.Mode != ModePods && o.Mode != ModeContainers {
+		return config.Options{}, fmt.Errorf("invalid options: unsupported mode %q (expected pods or containers)", o.Mode)
+	}
+
+	opts := config.Options{
+		Namespace:         o.Namespace,
+		AllNamespaces:     o.AllNamespaces,
+		LabelSelector:     o.LabelSelector,
+		ExcludeNamespaces: o.ExcludeNamespaces,
+		ExcludeLabels:     o.ExcludeLabels,
+		Mode:              o.Mode,
+		Resource:          o.Resource,
+		Sort:              o.Sort,
+		TopN:              o.TopN,
+		Threshold:         o.Threshold,
+		IncludeNoLimit:    o.IncludeNoLimit,
+		IncludeCompleted:  o.IncludeCompleted,
+		ExcludeCrashLoop:  o.ExcludeCrashLoop,
+		SampleFraction:    o.SampleFraction,
+		LimitsSource:      o.LimitsSource,
+		Source:            o.Source,
+		UsageRange:        o.UsageRange,
+		PrometheusURL:     o.PrometheusURL,
+		PrometheusHeaders: o.PrometheusHeaders,
+		Timeout:           o.Timeout,
+		PageSize:          o.PageSize,
+		Context:           o.Context,
+		Kubeconfig:        o.Kubeconfig,
+		Cluster:           o.Cluster,
+		Output:            config.OutputTable,
+	}
+	if o.ScoreExpr != "" {
+		score, err := analyzer.CompileScore(o.ScoreExpr)
+		if err != nil {
+			return config.Options{}, fmt.Errorf("invalid options: score expression: %w", err)
+		}
+		opts.ScoreExpr = score
+	}
+	if o.Filter != "" {
+		filter, err := analyzer.CompileFilter(o.Filter)
+		if err != nil {
+			return config.Options{}, fmt.Errorf("invalid options: filter: %w", err)
+		}
+		opts.FilterExpr = filter
+	}
+	opts.ApplyDefaults()
+	if err := opts.Validate(); err != nil {
+		return config.Options{}, fmt.Errorf("invalid options: %w", err)
+	}
+	return opts, nil
+}
+
+// NewCollector creates a Kubernetes-backed collector for the cluster selected
+// by the Context, Kubeconfig and Cluster of o, using the standard kubeconfig
+// loading rules (or in-cluster configuration) for those not set, listing
+// PageSize items per call and reading from the LimitsSource and Source of o.
+func NewCollector(o Options) (*collector.Collector, error) {
+	opts, err := o.config()
+	if err != nil {
+		return nil, err
+	}
+	return newCollector(opts)
+}
+
+// newCollector creates the collector of validated options.
+func newCollector(opts config.Options) (*collector.Collector, error) {
+	clientManager, err := k8s.NewClientManager(k8s.SelectionOptions(opts.Context, opts.Kubeconfig, opts.Cluster)...)
+	if err != nil {
+		return nil, err
+	}
+	c := collector.New(clientManager.CoreClient(), clientManager.MetricsClient()).WithPageSize(opts.PageSize)
+
+	if opts.LimitsSource == config.LimitsSourceKubeStateMetrics || opts.Source == config.UsageSourcePrometheus {
+		client, err := prometheus.New(opts.PrometheusURL)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range opts.PrometheusHeaders {
+			client.WithHeader(name, value)
+		}
+		if opts.LimitsSource == config.LimitsSourceKubeStateMetrics {
+			c.WithPodSource(kubestate.New(client))
+		}
+		if opts.Source == config.UsageSourcePrometheus {
+			c.WithMetricsSource(promusage.New(client))
+		}
+	}
+	switch opts.Source {
+	case config.UsageSourceDatadog:
+		client, err := datadog.NewFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		c.WithMetricsSource(datadog.NewSource(client))
+	case config.UsageSourceCAdvisor:
+		c.WithMetricsSource(cadvisor.New(clientManager.CoreClient()))
+	}
+	return c, nil
+}
+
+// Collect gathers the unsorted, unfiltered usage rows from the cluster.
+func Collect(ctx context.Context, opts Options) ([]Row, error) {
+	rows, _, err := CollectWithWarnings(ctx, opts)
+	return rows, err
+}
+
+// CollectWithWarnings is like Collect but also returns the warnings of the
+// collection, such as abandoned pages or stale pod metrics, so callers can
+// tell complete results from degraded ones.
+func CollectWithWarnings(ctx context.Context, o Options) ([]Row, []Warning, error) {
+	opts, err := o.config()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, err := newCollector(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	return c.CollectWithWarnings(ctx, opts)
+}
+
+// Run collects usage from the cluster, sorts it, computes the summary over
+// all rows and returns the top N rows as configured in opts.
+func Run(ctx context.Context, opts Options) ([]Row, Summary, error) {
+	c, err := NewCollector(opts)
+	if err != nil {
+		return nil, Summary{}, err
+	}
+
+	return RunWithCollector(ctx, c, opts)
+}
+
+// RunWithCollector is like Run but uses the provided collector instead of
+// creating one from the local kubeconfig.
+func RunWithCollector(ctx context.Context, c Collector, o Options) ([]Row, Summary, error) {
+	opts, err := o.config()
+	if err != nil {
+		return nil, Summary{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	rows, err := c.Collect(ctx, opts)
+	if err != nil {
+		return nil, Summary{}, err
+	}
+
+	a := analyzer.New()
+	if err := a.Score(rows, opts); err != nil {
+		return nil, Summary{}, err
+	}
+	a.Classify(rows, opts)
+	rows, err = a.Select(rows, opts)
+	if err != nil {
+		return nil, Summary{}, err
+	}
+	a.Sort(rows, opts)
+	summary := a.Summarize(rows, opts)
+
+	return a.Filter(rows, opts), summary, nil
+}
@@ -0,0 +1,137 @@
+package usage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mchmarny/kusage/pkg/collector/fake"
+	"github.com/mchmarny/kusage/pkg/metrics"
+)
+
+func TestRunWithCollector(t *testing.T) {
+	c := &fake.Collector{Rows: []metrics.Row{
+		{Namespace: "default", Name: "pod-a", UsageMi: 10, LimitMi: 100, Percentage: 10},
+		{Namespace: "default", Name: "pod-b", UsageMi: 95, LimitMi: 100, Percentage: 95},
+		{Namespace: "default", Name: "pod-c", UsageMi: 50, LimitMi: 100, Percentage: 50},
+	}}
+
+	opts := DefaultOptions()
+	opts.TopN = 2
+
+	rows, summary, err := RunWithCollector(context.Background(), c, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	if rows[0].Name != "pod-b" || rows[1].Name != "pod-c" {
+		t.Errorf("unexpected order: %s, %s", rows[0].Name, rows[1].Name)
+	}
+	if summary.Count != 3 {
+		t.Errorf("expected summary over all 3 rows, got %d", summary.Count)
+	}
+	if summary.OverThreshold != 1 {
+		t.Errorf("expected 1 row over threshold, got %d", summary.OverThreshold)
+	}
+	calls := c.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 collect call, got %d", len(calls))
+	}
+	if calls[0].Namespace != "default" || calls[0].Mode != ModePods || calls[0].PageSize != 500 {
+		t.Errorf("expected the collector to be passed the library options, got %+v", calls[0])
+	}
+}
+
+func TestRunWithCollector_Expressions(t *testing.T) {
+	c := &fake.Collector{Rows: []metrics.Row{
+		{Namespace: "default", Name: "pod-a", UsageMi: 80, LimitMi: 100, Percentage: 80},
+		{Namespace: "default", Name: "pod-b", UsageMi: 60, LimitMi: 100, Percentage: 60, Restarts: 2},
+		{Namespace: "kube-system", Name: "pod-c", UsageMi: 90, LimitMi: 100, Percentage: 90, Restarts: 1},
+	}}
+
+	opts := DefaultOptions()
+	opts.AllNamespaces = true
+	opts.ScoreExpr = "pct * (restarts + 1)"
+	opts.Filter = `pct > 50 && namespace != "kube-system"`
+	opts.Sort = SortByScore
+	opts.SampleFraction = 0.5
+	opts.IncludeCompleted = true
+	opts.ExcludeCrashLoop = true
+	opts.Source = UsageSourceCAdvisor
+
+	rows, _, err := RunWithCollector(context.Background(), c, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Name != "pod-b" || rows[0].Score != 180 || rows[1].Name != "pod-a" {
+		t.Errorf("expected pod-b scored 180 ranked above pod-a, got %+v", rows)
+	}
+
+	call := c.Calls()[0]
+	if call.SampleFraction != 0.5 || !call.IncludeCompleted || !call.ExcludeCrashLoop || call.Source != UsageSourceCAdvisor || call.UsageRange != time.Hour {
+		t.Errorf("expected the collector to be passed the pod and source options, got %+v", call)
+	}
+
+	for _, invalid := range []func(*Options){
+		func(o *Options) { o.ScoreExpr = "pcnt * 2" },
+		func(o *Options) { o.Filter = "pct" },
+		func(o *Options) { o.SampleFraction = 2 },
+		func(o *Options) { o.Source = UsageSourcePrometheus },
+	} {
+		opts := DefaultOptions()
+		invalid(&opts)
+		if _, _, err := RunWithCollector(context.Background(), &fake.Collector{}, opts); err == nil || !strings.Contains(err.Error(), "invalid options") {
+			t.Errorf("expected an invalid options error for %+v, got %v", opts, err)
+		}
+	}
+}
+
+func TestRunWithCollector_InvalidOptions(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Mode = "nodes"
+
+	if _, _, err := RunWithCollector(context.Background(), &fake.Collector{}, opts); err == nil {
+		t.Error("expected an error for a mode the library does not run")
+	}
+}
+
+func TestNewCollector_SelectsContext(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	data := `apiVersion: v1
+kind: Config
+clusters:
+- name: staging
+  cluster:
+    server: https://staging.example.com
+users:
+- name: admin
+  user:
+    token: abc
+contexts:
+- name: staging
+  context:
+    cluster: staging
+    user: admin
+`
+	if err := os.WriteFile(kubeconfig, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultOptions()
+	opts.Kubeconfig = kubeconfig
+	opts.Context = "staging"
+	if _, err := NewCollector(opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	opts.Context = "production"
+	if _, err := NewCollector(opts); err == nil {
+		t.Error("expected an error for a context missing from the kubeconfig")
+	}
+}